@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/bench"
+)
+
+// runBench implements the "bench" subcommand, which load-tests an HLS origin
+// with a mix of simulated player personas.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	var (
+		clients  = fs.Int("clients", 10, "Number of concurrent simulated players")
+		duration = fs.Duration("duration", time.Minute, "How long to run the benchmark")
+		rampUp   = fs.Duration("ramp-up", 0, "Spread client start times over this period")
+		mix      = fs.String("mix", bench.DefaultMix.String(), "Persona mix as name=weight pairs (aggressive, llhls, mobile, seeker)")
+		seed     = fs.Int64("seed", 1, "Random seed for variant selection and seeking")
+		slos     = fs.String("slo", "", "Comma-separated objectives, e.g. 'media:p99<200ms,segment:p95<2s,errors<0.5%'")
+		report   = fs.String("report", "", "Write a JSON report to this file ('-' for stdout)")
+		verbose  = fs.Bool("verbose", false, "Enable verbose logging")
+	)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s bench [options] <playlist-url>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Simulates a population of HLS players against an origin.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s bench --clients 100 --mix aggressive=1,mobile=8,seeker=1 http://localhost:8080/playlist.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s bench --slo 'media:p99<200ms,errors<1%%' --report report.json http://localhost:8080/playlist.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nExits non-zero if any objective fails.\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("playlist URL is required")
+	}
+
+	personaMix, err := bench.ParseMix(*mix)
+	if err != nil {
+		return fmt.Errorf("invalid --mix: %w", err)
+	}
+
+	objectives, err := bench.ParseSLOs(*slos)
+	if err != nil {
+		return fmt.Errorf("invalid --slo: %w", err)
+	}
+
+	logLevel := slog.LevelInfo
+	if *verbose {
+		logLevel = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := bench.Run(ctx, bench.Config{
+		URL:      fs.Arg(0),
+		Clients:  *clients,
+		Duration: *duration,
+		RampUp:   *rampUp,
+		Mix:      personaMix,
+		Seed:     *seed,
+		SLOs:     objectives,
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	if *report != "-" {
+		if err := result.WriteText(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if *report != "" {
+		if err := writeBenchReport(result, *report); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	}
+
+	if !result.Pass {
+		failed := 0
+		for _, s := range result.SLOs {
+			if !s.Pass {
+				failed++
+			}
+		}
+		return fmt.Errorf("%d of %d SLOs failed", failed, len(result.SLOs))
+	}
+
+	return nil
+}
+
+// writeBenchReport writes the JSON report to path, or stdout if path is "-".
+func writeBenchReport(result *bench.Result, path string) error {
+	if path == "-" {
+		return result.WriteJSON(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := result.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/agleyzer/encodersim/internal/compat"
+	"github.com/agleyzer/encodersim/internal/playlist"
+	"github.com/agleyzer/encodersim/internal/server"
+)
+
+// runCompat implements the "compat" subcommand, which serves every origin
+// profile on successive ports and writes a manifest of their endpoints.
+func runCompat(args []string) error {
+	fs := flag.NewFlagSet("compat", flag.ContinueOnError)
+	var (
+		basePort  = fs.Int("base-port", 8080, "Port of the first profile; the others use the following ports")
+		host      = fs.String("host", "localhost", "Host name used in the manifest URLs")
+		mediaBase = fs.String("media-base", "http://localhost:8000", "Base URL of the test media; segments are referenced as <media-base>/<profile>/<rendition>/...")
+		profiles  = fs.String("profiles", "", "Comma-separated profiles to serve (default all: "+strings.Join(compat.Names(), ", ")+")")
+		manifest  = fs.String("manifest", "-", "Write the endpoint manifest to this file ('-' for stdout)")
+		verbose   = fs.Bool("verbose", false, "Enable verbose logging")
+	)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s compat [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Serves predefined origin profiles for player compatibility testing.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s compat --base-port 9000 --manifest endpoints.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s compat --profiles hls-v3,fmp4 --media-base https://media.example.com/compat\n", os.Args[0])
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	var names []string
+	if *profiles != "" {
+		for _, name := range strings.Split(*profiles, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	selected, err := compat.Select(names)
+	if err != nil {
+		return fmt.Errorf("invalid --profiles: %w", err)
+	}
+	if *basePort <= 0 || *basePort+len(selected)-1 > 65535 {
+		return fmt.Errorf("invalid --base-port %d for %d profiles", *basePort, len(selected))
+	}
+
+	// Fail before serving anything if a port is taken
+	for i := range selected {
+		l, err := net.Listen("tcp", ":"+strconv.Itoa(*basePort+i))
+		if err != nil {
+			return fmt.Errorf("port for profile %s: %w", selected[i].Name, err)
+		}
+		l.Close()
+	}
+
+	logLevel := slog.LevelInfo
+	if *verbose {
+		logLevel = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(selected))
+	for i, profile := range selected {
+		profileLogger := logger.With("profile", profile.Name)
+		lp, err := playlist.New(profile.Variants(*mediaBase), profile.WindowSize, nil, profileLogger)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+		go lp.StartAutoAdvance(ctx)
+
+		srv := server.NewWithOptions(lp, server.Options{Port: *basePort + i, Version: version}, profileLogger)
+		go func() {
+			if err := srv.Start(ctx); err != nil {
+				errs <- fmt.Errorf("profile %s: %w", profile.Name, err)
+			}
+		}()
+	}
+
+	m := compat.NewManifest(selected, *host, *basePort, *mediaBase)
+	if err := writeCompatManifest(m, *manifest); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	logger.Info("serving compatibility profiles", "profiles", len(selected), "basePort", *basePort)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// writeCompatManifest writes the manifest to path, or stdout if path is "-".
+func writeCompatManifest(m compat.Manifest, path string) error {
+	if path == "-" {
+		return m.WriteJSON(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := m.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -2,51 +2,222 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/admin"
+	"github.com/agleyzer/encodersim/internal/audit"
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/buildinfo"
 	"github.com/agleyzer/encodersim/internal/cluster"
+	"github.com/agleyzer/encodersim/internal/config"
+	"github.com/agleyzer/encodersim/internal/events"
+	"github.com/agleyzer/encodersim/internal/faults"
+	"github.com/agleyzer/encodersim/internal/features"
+	"github.com/agleyzer/encodersim/internal/health"
+	"github.com/agleyzer/encodersim/internal/metrics"
+	"github.com/agleyzer/encodersim/internal/mirror"
 	"github.com/agleyzer/encodersim/internal/parser"
+	"github.com/agleyzer/encodersim/internal/player"
 	"github.com/agleyzer/encodersim/internal/playlist"
+	"github.com/agleyzer/encodersim/internal/prime"
+	"github.com/agleyzer/encodersim/internal/probe"
+	"github.com/agleyzer/encodersim/internal/scenario"
 	"github.com/agleyzer/encodersim/internal/segment"
 	"github.com/agleyzer/encodersim/internal/server"
+	"github.com/agleyzer/encodersim/internal/standby"
+	"github.com/agleyzer/encodersim/internal/storage"
+	"github.com/agleyzer/encodersim/internal/tenant"
+	"github.com/agleyzer/encodersim/internal/upstream"
 	"github.com/agleyzer/encodersim/internal/variant"
+	"github.com/agleyzer/encodersim/internal/watch"
 )
 
 const (
 	version = "1.0.0"
+
+	// stdinSource is the playlist argument that reads the source from stdin.
+	stdinSource = "-"
+
+	// probeTenant is the tenant of the player probe with --api-keys.
+	probeTenant = "player-probe"
 )
 
 func main() {
+	// Dispatch subcommands before parsing the server flags
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		if err := runBench(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compat" {
+		if err := runCompat(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	defaultCacheDir, _ := parser.DefaultCacheDir()
+
 	// Parse command-line flags
 	var (
+		configF     = flag.String("config", "", "Load settings from this YAML or JSON file (keys named after the flags); flags on the command line take precedence")
 		port        = flag.Int("port", 8080, "HTTP server port")
+		tlsCert     = flag.String("tls-cert", "", "PEM certificate to serve HTTPS with on --port instead of HTTP (requires --tls-key)")
+		tlsKey      = flag.String("tls-key", "", "PEM private key for --tls-cert")
+		tlsClientCA = flag.String("tls-client-ca", "", "PEM CA bundle that clients must present a certificate from (mutual TLS; requires --tls-cert)")
+		redirPort   = flag.Int("http-redirect-port", 0, "Plain HTTP port that redirects every request to HTTPS on --port (requires --tls-cert; 0 disables)")
+		reusePort   = flag.Bool("reuse-port", false, "Bind --port (and --http-redirect-port) with SO_REUSEPORT so that several processes share it, the kernel spreading connections among them")
 		windowSize  = flag.Int("window-size", 6, "Number of segments in sliding window")
+		windowPol   = flag.String("window-policy", string(playlist.WindowPerVariant), "When --window-size exceeds a variant's segment count: 'per-variant' clamps that variant, 'clamp-min' clamps every variant to the shortest, 'error' refuses to start")
+		pdtF        = flag.String("program-date-time", "", "Stamp segments with EXT-X-PROGRAM-DATE-TIME: 'continuous' across loop points, or 'reset' to the wall clock at each loop point (not supported in cluster mode)")
+		pdtAnomaly  = flag.String("pdt-anomalies", "", "Inject anomalies into EXT-X-PROGRAM-DATE-TIME, as a comma-separated list of 'dst:N' (fall back an hour, then spring forward), 'leap:N' (second 60) and 'backward=DURATION:N' (clock jumps back), each at every Nth segment (requires --program-date-time)")
+		pdtZone     = flag.String("pdt-zone", "", "Time zone of EXT-X-PROGRAM-DATE-TIME values: 'UTC' (default), a UTC offset such as '+05:30', or an IANA name such as 'America/New_York' (requires --program-date-time)")
+		pdtOffset   = flag.Bool("pdt-offset", false, "Write a zero UTC offset in EXT-X-PROGRAM-DATE-TIME values as '+00:00' instead of 'Z' (requires --program-date-time)")
+		pdtPrec     = flag.String("pdt-precision", "", "Fractional seconds of EXT-X-PROGRAM-DATE-TIME values: 's' (none), 'ms' (default), 'us' or 'ns' (requires --program-date-time)")
 		verbose     = flag.Bool("verbose", false, "Enable verbose logging")
 		showVersion = flag.Bool("version", false, "Show version and exit")
+		dumpDash    = flag.Bool("dump-dashboard", false, "Print a Grafana dashboard JSON for the /metrics endpoint and exit")
 		master      = flag.Bool("master", false, "Expect master playlist with multiple variants (auto-detected if not set)")
 		variants    = flag.String("variants", "", "Comma-separated list of variant indices to serve (e.g., '0,2,4'). Serves all if not specified")
 		loopAfter   = flag.String("loop-after", "", "Maximum duration of content to use before looping (e.g., '10s', '1m30s'). Uses all segments if not specified")
+		loopSegs    = flag.Int("loop-segments", 0, "Maximum number of segments per variant to use before looping (0 for no limit)")
+		loopBytes   = flag.String("loop-bytes", "", "Maximum total segment size per variant to use before looping (e.g., '500MB', '2GiB'; requires --probe-segments)")
+		parseMode   = flag.String("parse-mode", string(parser.ModeLenient), "Source parsing mode: 'strict' rejects malformed playlists, 'lenient' tolerates them with warnings")
+		tmplMode    = flag.String("template", string(parser.TemplateNone), "Expand source playlists before parsing: 'env' substitutes ${NAME}, 'go' executes them as Go templates")
+		tmplVars    = flag.String("template-vars", "", "Comma-separated NAME=VALUE template variables (take precedence over environment variables)")
+		passthrough = flag.String("passthrough-tags", "", "Comma-separated custom source tags to re-emit in generated playlists (e.g., 'EXT-X-CUSTOM,EXT-X-AD-*'; '*' for all non-standard tags)")
+		probeSegs   = flag.Bool("probe-segments", false, "HEAD every segment at startup to record sizes and measure real variant bitrates")
+		probeConc   = flag.Int("probe-concurrency", 8, "Number of concurrent requests when probing or verifying segments")
+		probeBW     = flag.Bool("bandwidth-from-probe", false, "Advertise measured peak bitrates as BANDWIDTH in the master playlist (requires --probe-segments)")
+		verifySrc   = flag.Bool("verify-source", false, "Download segments at startup and refuse to start if any is unreachable or empty")
+		verifyN     = flag.Int("verify-sample", 0, "Verify only this many evenly spaced segments per variant (0 for all)")
+		verifyFmt   = flag.Bool("verify-format", false, "With --verify-source, also check MPEG-TS sync bytes / fMP4 box headers")
+		mediaSeq    = flag.String("media-sequence", "rebase", "How to number output segments when the source has a non-zero EXT-X-MEDIA-SEQUENCE: 'rebase' starts at 0, 'preserve' starts at the source value")
+		startPos    = flag.Int("start-position", 0, "Segment index in the loop at which the first window starts, to join the content mid-stream (a position resumed from --state-file takes precedence)")
+		startSeq    = flag.Uint64("start-sequence", 0, "EXT-X-MEDIA-SEQUENCE of the first window, as if the channel had been running for a while (cannot be combined with --media-sequence preserve)")
+		timeScale   = flag.Float64("time-scale", 1, "Advance the live window this many times faster than real time (e.g., 4 to reach discontinuity and sequence rollovers sooner)")
+		scaleDurs   = flag.String("time-scale-durations", "scaled", "With --time-scale: 'scaled' divides the advertised EXTINF/TARGETDURATION by the scale, 'real' keeps the source durations")
+		preRender   = flag.Bool("prerender", false, "Pre-render every window position at startup to minimize per-request CPU (small sources only)")
+		dashOut     = flag.Bool("dash", false, "Also serve the looped CMAF content as a live DASH manifest at /manifest.mpd (requires fMP4 variants with aligned segments)")
+		debugSubs   = flag.Bool("debug-subtitles", false, "Add a WebVTT subtitle rendition to the master playlist whose cues show the media sequence, loop position, loop count and wall clock of each segment")
+		smoothOut   = flag.Bool("smooth", false, "Also serve the looped CMAF content as a best-effort live Smooth Streaming manifest at /smooth/Manifest (same requirements as --dash, plus distinct bandwidths)")
+		baseURL     = flag.String("base-url", "", "Base URL for resolving relative URIs when the playlist is read from stdin ('-') or a local file")
+		cacheDir    = flag.String("cache-dir", defaultCacheDir, "Where to cache source snapshots, revalidated with ETag/Last-Modified: a directory, s3://bucket/prefix or memory: (empty disables caching)")
+		noCache     = flag.Bool("no-cache", false, "Ignore cached source snapshots and refetch everything (the cache is still updated)")
+		plType      = flag.String("playlist-type", "live", "Variant playlist type: 'live' sliding window, 'event' growing from the start of the stream (EXT-X-PLAYLIST-TYPE:EVENT), or 'vod' serving --playlist-loops loops at once with EXT-X-ENDLIST")
+		segGaps     = flag.String("segment-gaps", "", "Simulate encoder segment loss by losing every Nth media sequence number, as MODE:N: 'gap:N' marks the segment with EXT-X-GAP, 'skip:N' leaves it out of the playlist")
+		encryptF    = flag.String("encryption", "", "Declare segments encrypted with EXT-X-KEY tags: 'aes-128' or 'sample-aes' (the segments themselves are not encrypted)")
+		keyURI      = flag.String("key-uri", "", "Key URI of the EXT-X-KEY tags, in which {id} is replaced by the key ID (default '"+playlist.DefaultKeyURI+"', served by the simulator; requires --encryption)")
+		keyRotation = flag.Uint64("key-rotation", 0, "Rotate the key and IV every N media sequence numbers (0 never rotates; requires --encryption)")
+		plLoops     = flag.Int("playlist-loops", 0, "End an event playlist with EXT-X-ENDLIST after this many loops of the source (0 never ends it); the number of loops in a vod playlist (default 1)")
+		watchSrc    = flag.Bool("watch", false, "Reload a local source file when it changes, swapping in the new segments at the next loop boundary")
+		watchdogN   = flag.Int("advance-watchdog", 3, "Flag the advance loop as stalled when no advance completes within this many target durations (0 disables)")
+		watchdogRst = flag.Bool("advance-watchdog-restart", false, "Restart the advance loop when the advance watchdog detects a stall")
+		stateFile   = flag.String("state-file", "", "Save the window position to this file after every advance and resume from it at startup")
+		catchUp     = flag.Bool("catch-up", false, "When resuming from --state-file, fast-forward by the advance intervals missed while stopped")
+		scenarioF   = flag.String("scenario", "", "Run the scripted timeline of actions (stalls, ad breaks, variant failures) in this YAML file")
+		scenarioX   = flag.Bool("scenario-exit", false, "Exit when the --scenario finishes, with status 0 if every assertion passed and 1 otherwise")
+		playerProbe = flag.Bool("player-probe", false, "Play the served variant playlists with a built-in headless player and report anomalies in /health, /metrics and /events")
+		probeMedia  = flag.Bool("player-probe-segments", false, "Also HEAD every segment the player probe sees to check that it is available (requires --player-probe)")
+		primeCDN    = flag.String("prime-cdn", "", "Fetch every segment that reaches the live edge through this CDN edge URL (e.g., 'https://edge.example.com/prefix'; segment paths are appended) and export the fill latency in /health and /metrics")
+		latencyF    = flag.String("latency", "", "Delay responses by endpoint class before serving them, e.g. 'variant=normal:200ms:50ms,playlist=pareto:20ms:1.5' (distributions: fixed, uniform, normal, pareto)")
+		profilesF   = flag.String("network-profiles", "", "Load named network-condition profiles (latency, jitter, error rate, throughput cap) from this YAML file, switchable at runtime via /network-profile")
+		profileF    = flag.String("network-profile", "", "Network profile from --network-profiles to activate at startup")
+		faultsF     = flag.String("faults", "", "Inject faults by request path, as ';'-separated 'PATH_REGEX FAULTS' rules, e.g. '^/variant/1/ error=404:5%; ^/playlist\\.m3u8$ latency=fixed:300ms' (faults: latency, error, throughput, stale, stall, truncate, outage)")
+		cdnF        = flag.String("cdn-headers", "", "Add synthetic CDN headers to playlists, manifests and segments, e.g. 'hit=80%,age=uniform:0s:30s,via=1.1 edge-sim' (options: hit, pattern=HIT:MISS:..., age, via)")
+		apiKeysF    = flag.String("api-keys", "", "Require API keys from the tenants in this YAML file, each limited to its endpoints and request rate and counted in encodersim_tenant_requests_total")
+		adminTokF   = flag.String("admin-tokens", "", "Require a bearer token from this YAML file for the admin endpoints (/network-profile, /admin/reload, /connections, /events, /cluster/status); viewer tokens may read them, operator tokens may also change the simulator")
+		auditLogF   = flag.String("audit-log", "", "Also append the audit trail of admin API calls and scenario actions, served by /events?type=audit, to this file as JSON lines")
+		experiments = flag.String("enable-feature", "", "Comma-separated experimental features to enable, listed with their state in /version (available: ll-hls, delta-updates)")
+		cacheMaster = flag.String("cache-control-master", "", "Cache-Control of the master playlist ({target} and {half-target} expand to the target duration and half of it in seconds; default \""+server.DefaultCacheControl+"\")")
+		cacheMedia  = flag.String("cache-control-media", "", "Cache-Control of the media playlists and other live manifests, e.g. 'max-age={half-target}' (same placeholders and default as --cache-control-master)")
+		cacheSegs   = flag.String("cache-control-segments", "", "Cache-Control of the segments served by encodersim: debug subtitle cues and Smooth Streaming fragment redirects (same placeholders and default as --cache-control-master)")
+		srcCheck    = flag.Duration("source-check-interval", 30*time.Second, "How often to refetch the source playlist to report it as unreachable in /health (0 disables)")
+
+		// Upstream fetch flags
+		upstreamTimeout     = flag.Duration("upstream-timeout", upstream.DefaultConfig().Timeout, "Timeout for each request to the origin")
+		upstreamIdlePerHost = flag.Int("upstream-max-idle-per-host", upstream.DefaultConfig().MaxIdleConnsPerHost, "Idle keep-alive connections kept per origin host")
+		upstreamConnPerHost = flag.Int("upstream-max-conns-per-host", 0, "Maximum concurrent connections per origin host (0 for no limit)")
+		upstreamProxy       = flag.String("upstream-proxy", "", "Proxy for all origin requests (http://, https://, socks5:// or socks5h://); overrides HTTPS_PROXY/HTTP_PROXY")
+		sourceClientCert    = flag.String("source-client-cert", "", "PEM client certificate presented to origins that require mutual TLS")
+		sourceClientKey     = flag.String("source-client-key", "", "PEM private key for --source-client-cert")
+		sourceCA            = flag.String("source-ca", "", "PEM CA bundle used to verify origin certificates instead of the system roots")
+		recordSource        = flag.String("record-source", "", "Save every origin response fetched while parsing the source into this directory or s3://bucket/prefix")
+		mirrorDir           = flag.String("mirror", "", "Debug: save every response served (body, headers and request metadata) to this directory or s3://bucket/prefix, indexed in requests.jsonl")
+		replaySource        = flag.String("replay-source", "", "Parse the source from responses saved with --record-source (a directory or s3://bucket/prefix) instead of the network")
+
+		// Client connection limit flags
+		readHeaderTimeout = flag.Duration("read-header-timeout", server.DefaultLimits().ReadHeaderTimeout, "How long a client may take to send its request headers; closes slow loris connections (0 disables)")
+		readTimeout       = flag.Duration("read-timeout", server.DefaultLimits().ReadTimeout, "How long a client may take to send a whole request (0 disables)")
+		writeTimeout      = flag.Duration("write-timeout", server.DefaultLimits().WriteTimeout, "How long writing a response may take; keep it above blocking reloads and throttled responses (0 disables)")
+		idleTimeout       = flag.Duration("idle-timeout", server.DefaultLimits().IdleTimeout, "How long idle keep-alive connections are kept open (0 disables)")
+		maxHeaderBytes    = flag.String("max-header-bytes", "64KiB", "Maximum size of the request line and headers (0 for the net/http default of 1MiB)")
+		maxBodyBytes      = flag.String("max-body-bytes", "1MiB", "Maximum size of a request body, larger ones get 413 (0 for no limit)")
+		maxConns          = flag.Int("max-conns", 0, "Maximum open client connections; requests on connections over the cap get 429 and the connection is closed (0 for no cap)")
+		rateLimit         = flag.Float64("rate-limit", 0, "Requests per second served to all clients together, more get 429 with Retry-After (0 for no limit)")
+		rateLimitBurst    = flag.Int("rate-limit-burst", 0, "Burst of requests allowed over --rate-limit (0 for one second of requests)")
+		clientRateLimit   = flag.Float64("client-rate-limit", 0, "Requests per second served to each client IP, more get 429 with Retry-After (0 for no limit)")
+		clientRateBurst   = flag.Int("client-rate-limit-burst", 0, "Burst of requests allowed over --client-rate-limit (0 for one second of requests)")
+
+		// Resource budget flags
+		memoryLimit   = flag.String("memory-limit", "", "Soft memory limit of the Go runtime (e.g., '512MiB'); overrides GOMEMLIMIT")
+		maxProcs      = flag.Int("max-procs", 0, "Maximum CPU cores executing Go code at once, as GOMAXPROCS (0 keeps the default)")
+		maxCacheBytes = flag.String("max-cache-bytes", "", "Maximum bytes held by in-memory caches: pre-rendered windows and a memory: --cache-dir (e.g., '64MiB')")
 
 		// Cluster mode flags
 		clusterMode = flag.Bool("cluster", false, "Enable cluster mode with Raft consensus")
 		raftID      = flag.String("raft-id", "", "Unique Raft node ID (required for cluster mode)")
 		raftBind    = flag.String("raft-bind", "", "Raft bind address for inter-node communication (host:port, required for cluster mode)")
 		peers       = flag.String("peers", "", "Comma-separated list of all peer Raft addresses including this node (required for cluster mode)")
+		clockSkew   = flag.Duration("clock-skew", 0, "Testing: offset this node's perceived clock (e.g., '90s', '-2m') to check that skewed nodes serve identical windows")
+		raftDir     = flag.String("raft-dir", "", "Directory for the Raft log, stable state and snapshots, so the stream position survives a full-cluster restart (in memory if not set)")
+		raftArchive = flag.String("raft-snapshot-archive", "", "Copy every Raft snapshot this node takes or receives to this directory, s3://bucket/prefix or memory:, under <raft-id>/<snapshot-id>/")
+		raftDelay   = flag.String("raft-delay", "", "Testing: delay every Raft message this node sends to simulate cross-region links, e.g. 'fixed:40ms' or 'normal:40ms:10ms' (same distributions as --latency); the round trip between two nodes is the sum of their delays")
+
+		// Standby pair flags
+		standbyRole    = flag.String("standby-role", "", "Run as one node of an active/standby pair without Raft: 'primary' advances the window and streams its position, 'standby' follows it and takes over when its heartbeats stop")
+		standbyListen  = flag.String("standby-listen", "", "Address (host:port) to stream the window position on while this node is active (required with --standby-role)")
+		standbyPeer    = flag.String("standby-peer", "", "The other node's --standby-listen address, followed while this node is the standby (required with --standby-role)")
+		standbySecret  = flag.String("standby-secret-file", "", "File holding the secret shared by both nodes to authenticate the position stream, at least 16 bytes (required with --standby-role)")
+		standbyTimeout = flag.Duration("standby-failover-timeout", 3*time.Second, "How long the standby waits without a heartbeat from the primary before taking over")
 	)
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "EncoderSim - HLS Live Looping Tool v%s\n\n", version)
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <playlist-url>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <playlist-url>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s bench [options] <playlist-url>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s replay [options] <mirror-dir> <target-url>\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Arguments:\n")
-		fmt.Fprintf(os.Stderr, "  <playlist-url>    URL of the static HLS playlist (media or master)\n\n")
+		fmt.Fprintf(os.Stderr, "  <playlist-url>    URL or local path of the static HLS playlist (media or master), or '-' to read it from stdin\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
@@ -55,27 +226,84 @@ func main() {
 		fmt.Fprintf(os.Stderr, "    %s --port 8080 --window-size 6 https://example.com/playlist.m3u8\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "    %s --loop-after 10s https://example.com/playlist.m3u8\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "    %s --master https://example.com/master.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    %s --config encodersim.yaml\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    %s --watch --base-url https://cdn.example.com/vod/ fixtures/vod.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    generate-playlist | %s --base-url https://cdn.example.com/vod/ -\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\n  Cluster mode (3-node cluster):\n")
 		fmt.Fprintf(os.Stderr, "    Node 1: %s --cluster --raft-id=node1 --raft-bind=10.0.0.1:9000 --peers=10.0.0.1:9000,10.0.0.2:9000,10.0.0.3:9000 https://example.com/playlist.m3u8\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "    Node 2: %s --cluster --raft-id=node2 --raft-bind=10.0.0.2:9000 --peers=10.0.0.1:9000,10.0.0.2:9000,10.0.0.3:9000 https://example.com/playlist.m3u8\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "    Node 3: %s --cluster --raft-id=node3 --raft-bind=10.0.0.3:9000 --peers=10.0.0.1:9000,10.0.0.2:9000,10.0.0.3:9000 https://example.com/playlist.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\n  Standby pair:\n")
+		fmt.Fprintf(os.Stderr, "    Primary: %s --standby-role=primary --standby-listen=10.0.0.1:9100 --standby-peer=10.0.0.2:9100 --standby-secret-file=pair.key https://example.com/playlist.m3u8\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Standby: %s --standby-role=standby --standby-listen=10.0.0.2:9100 --standby-peer=10.0.0.1:9100 --standby-secret-file=pair.key https://example.com/playlist.m3u8\n", os.Args[0])
 	}
 
 	flag.Parse()
 
 	if *showVersion {
-		fmt.Printf("EncoderSim v%s\n", version)
+		build := buildinfo.Read(version, nil, nil)
+		fmt.Printf("EncoderSim v%s (commit %s, built %s, %s)\n", build.Version, build.Commit, build.Date, build.GoVersion)
+		os.Exit(0)
+	}
+
+	if *dumpDash {
+		dashboard, err := metrics.Dashboard()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(dashboard))
 		os.Exit(0)
 	}
 
+	// Apply the configuration file to the flags not given on the command line
+	var configSource string
+	if *configF != "" {
+		cfg, err := config.Load(*configF)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --config: %v\n", err)
+			os.Exit(1)
+		}
+		onCommandLine := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) { onCommandLine[f.Name] = true })
+		values := cfg.FlagValues()
+		for _, name := range cfg.FlagNames() {
+			if onCommandLine[name] {
+				continue
+			}
+			if flag.Lookup(name) == nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid --config: unknown flag %q\n", name)
+				os.Exit(1)
+			}
+			if err := flag.Set(name, values[name]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid --config: %s: %v\n", name, err)
+				os.Exit(1)
+			}
+		}
+		configSource = cfg.Source
+	}
+
 	// Check for playlist URL argument
-	if flag.NArg() < 1 {
+	playlistURL := flag.Arg(0)
+	if playlistURL == "" {
+		playlistURL = configSource
+	}
+	if playlistURL == "" {
 		fmt.Fprintf(os.Stderr, "Error: playlist URL is required\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	playlistURL := flag.Arg(0)
+	// Anything that is not stdin or a URL is a local file path
+	if playlistURL != stdinSource {
+		sourceURL, err := parser.SourceURL(playlistURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		playlistURL = sourceURL
+	}
+	_, localSource := parser.LocalPath(playlistURL)
 
 	// Validate flags
 	if *port < 1 || *port > 65535 {
@@ -83,238 +311,1740 @@ func main() {
 		os.Exit(1)
 	}
 
+	serverTLS, err := server.LoadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid server TLS settings: %v\n", err)
+		os.Exit(1)
+	}
+	if *redirPort != 0 {
+		if serverTLS == nil {
+			fmt.Fprintf(os.Stderr, "Error: --http-redirect-port requires --tls-cert\n")
+			os.Exit(1)
+		}
+		if *redirPort < 1 || *redirPort > 65535 || *redirPort == *port {
+			fmt.Fprintf(os.Stderr, "Error: --http-redirect-port must be between 1 and 65535 and differ from --port\n")
+			os.Exit(1)
+		}
+	}
+
+	if *reusePort && !server.ReusePortSupported {
+		fmt.Fprintf(os.Stderr, "Error: --reuse-port is not supported on %s\n", runtime.GOOS)
+		os.Exit(1)
+	}
+
 	if *windowSize < 1 {
 		fmt.Fprintf(os.Stderr, "Error: window size must be at least 1\n")
 		os.Exit(1)
 	}
 
-	// Validate cluster flags
-	if *clusterMode {
-		if *raftID == "" {
-			fmt.Fprintf(os.Stderr, "Error: --raft-id is required when --cluster is enabled\n")
+	windowPolicy, err := playlist.ParseWindowPolicy(*windowPol)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --window-policy: %v\n", err)
+		os.Exit(1)
+	}
+
+	pdtMode, err := playlist.ParseProgramDateTime(*pdtF)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --program-date-time: %v\n", err)
+		os.Exit(1)
+	}
+	if pdtMode != playlist.PDTOff && *clusterMode {
+		fmt.Fprintf(os.Stderr, "Error: --program-date-time is not supported in cluster mode\n")
+		os.Exit(1)
+	}
+	var pdtAnomalies playlist.PDTAnomalies
+	if *pdtAnomaly != "" {
+		if pdtAnomalies, err = playlist.ParsePDTAnomalies(*pdtAnomaly); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --pdt-anomalies: %v\n", err)
 			os.Exit(1)
 		}
-		if *raftBind == "" {
-			fmt.Fprintf(os.Stderr, "Error: --raft-bind is required when --cluster is enabled\n")
+		if pdtMode == playlist.PDTOff {
+			fmt.Fprintf(os.Stderr, "Error: --pdt-anomalies requires --program-date-time\n")
 			os.Exit(1)
 		}
-		if *peers == "" {
-			fmt.Fprintf(os.Stderr, "Error: --peers is required when --cluster is enabled\n")
+	}
+	pdtFormat := playlist.PDTFormat{Offset: *pdtOffset}
+	if pdtFormat.Zone, err = playlist.ParsePDTZone(*pdtZone); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --pdt-zone: %v\n", err)
+		os.Exit(1)
+	}
+	if *pdtPrec != "" {
+		if pdtFormat.Precision, err = playlist.ParsePDTPrecision(*pdtPrec); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --pdt-precision: %v\n", err)
 			os.Exit(1)
 		}
 	}
-
-	// Setup logger
-	logLevel := slog.LevelInfo
-	if *verbose {
-		logLevel = slog.LevelDebug
+	if (*pdtZone != "" || *pdtOffset || *pdtPrec != "") && pdtMode == playlist.PDTOff {
+		fmt.Fprintf(os.Stderr, "Error: --pdt-zone, --pdt-offset and --pdt-precision require --program-date-time\n")
+		os.Exit(1)
 	}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
-	}))
-
-	logger.Info("EncoderSim starting", "version", version)
-
-	// Parse peer addresses if cluster mode enabled
-	var peerAddrs []string
-	if *clusterMode {
-		peerAddrs = strings.Split(*peers, ",")
-		for i := range peerAddrs {
-			peerAddrs[i] = strings.TrimSpace(peerAddrs[i])
+	playlistType, err := playlist.ParsePlaylistType(*plType)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --playlist-type: %v\n", err)
+		os.Exit(1)
+	}
+	if *plLoops < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --playlist-loops must not be negative, got: %d\n", *plLoops)
+		os.Exit(1)
+	}
+	if *plLoops > 0 && playlistType == playlist.TypeLive {
+		fmt.Fprintf(os.Stderr, "Error: --playlist-loops requires --playlist-type event or vod\n")
+		os.Exit(1)
+	}
+	if playlistType != playlist.TypeLive {
+		for _, conflict := range []struct {
+			flag string
+			set  bool
+		}{
+			{"--program-date-time", pdtMode != playlist.PDTOff},
+			{"--debug-subtitles", *debugSubs},
+			{"--watch", *watchSrc},
+		} {
+			if conflict.set {
+				fmt.Fprintf(os.Stderr, "Error: %s is not supported with --playlist-type %s\n", conflict.flag, playlistType)
+				os.Exit(1)
+			}
 		}
 	}
 
-	// Run the application
-	if err := run(playlistURL, *port, *windowSize, *master, *variants, *loopAfter, *clusterMode, *raftID, *raftBind, peerAddrs, logger); err != nil {
-		logger.Error("application error", "error", err)
+	mode, err := parser.ParseMode(*parseMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --parse-mode: %v\n", err)
 		os.Exit(1)
 	}
 
-	logger.Info("EncoderSim stopped")
-}
+	templateMode, err := parser.ParseTemplateMode(*tmplMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --template: %v\n", err)
+		os.Exit(1)
+	}
+	templateVars, err := parser.ParseTemplateVars(*tmplVars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --template-vars: %v\n", err)
+		os.Exit(1)
+	}
+	if len(templateVars) > 0 && templateMode == parser.TemplateNone {
+		fmt.Fprintf(os.Stderr, "Error: --template-vars requires --template env or go\n")
+		os.Exit(1)
+	}
 
-func run(playlistURL string, port, windowSize int, master bool, variants, loopAfter string, clusterMode bool, raftID, raftBind string, peers []string, logger *slog.Logger) error {
-	// Note: variants parameter for filtering variants will be implemented in future enhancement
-	_ = variants
+	passthroughTags, err := parser.ParseTagAllowlist(*passthrough)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --passthrough-tags: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Parse and validate loop-after duration if specified
-	var loopAfterDuration time.Duration
-	if loopAfter != "" {
-		duration, err := time.ParseDuration(loopAfter)
+	upstreamConfig := upstream.DefaultConfig()
+	upstreamConfig.Timeout = *upstreamTimeout
+	upstreamConfig.MaxIdleConnsPerHost = *upstreamIdlePerHost
+	upstreamConfig.MaxConnsPerHost = *upstreamConnPerHost
+	if *upstreamProxy != "" {
+		proxyURL, err := upstream.ParseProxyURL(*upstreamProxy)
 		if err != nil {
-			return fmt.Errorf("invalid --loop-after duration '%s': %w", loopAfter, err)
-		}
-		if duration <= 0 {
-			return fmt.Errorf("--loop-after duration must be positive, got: %s", loopAfter)
+			fmt.Fprintf(os.Stderr, "Error: invalid --upstream-proxy: %v\n", err)
+			os.Exit(1)
 		}
-		loopAfterDuration = duration
-		logger.Info("loop-after specified", "duration", duration)
+		upstreamConfig.ProxyURL = proxyURL
 	}
-
-	// Parse the source playlist
-	logger.Info("fetching source playlist", "url", playlistURL)
-	playlistInfo, err := parser.ParsePlaylist(playlistURL)
+	tlsConfig, err := upstream.LoadTLSConfig(*sourceClientCert, *sourceClientKey, *sourceCA)
 	if err != nil {
-		return fmt.Errorf("failed to parse playlist: %w", err)
+		fmt.Fprintf(os.Stderr, "Error: invalid source TLS settings: %v\n", err)
+		os.Exit(1)
 	}
-
-	// Check if explicit mode is set, otherwise use detected mode
-	if master && !playlistInfo.IsMaster {
-		return fmt.Errorf("--master flag set but URL is a media playlist, not a master playlist")
+	upstreamConfig.TLSConfig = tlsConfig
+	if err := upstreamConfig.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid upstream settings: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Initialize cluster manager if cluster mode is enabled
-	var clusterMgr *cluster.Manager
-	if clusterMode {
-		logger.Info("initializing cluster mode",
-			"raft_id", raftID,
-			"raft_bind", raftBind,
-			"peers", len(peers),
-		)
+	serverLimits := server.Limits{
+		ReadHeaderTimeout:  *readHeaderTimeout,
+		ReadTimeout:        *readTimeout,
+		WriteTimeout:       *writeTimeout,
+		IdleTimeout:        *idleTimeout,
+		RequestRate:        *rateLimit,
+		RequestBurst:       *rateLimitBurst,
+		ClientRequestRate:  *clientRateLimit,
+		ClientRequestBurst: *clientRateBurst,
+		MaxConns:           *maxConns,
+	}
+	headerBytes, err := parseByteSize(*maxHeaderBytes)
+	if err != nil || headerBytes > math.MaxInt32 {
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-header-bytes %q: must be a size such as 64KiB\n", *maxHeaderBytes)
+		os.Exit(1)
+	}
+	serverLimits.MaxHeaderBytes = int(headerBytes)
+	if serverLimits.MaxBodyBytes, err = parseByteSize(*maxBodyBytes); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --max-body-bytes %q: must be a size such as 1MiB\n", *maxBodyBytes)
+		os.Exit(1)
+	}
+	if err := serverLimits.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid server limits: %v\n", err)
+		os.Exit(1)
+	}
 
-		clusterConfig := cluster.Config{
-			RaftID:   raftID,
-			BindAddr: raftBind,
-			Peers:    peers,
+	budgetLimits := budget.Limits{Procs: *maxProcs}
+	if *memoryLimit != "" {
+		if budgetLimits.Memory, err = parseByteSize(*memoryLimit); err != nil || budgetLimits.Memory == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --memory-limit %q: must be a positive size such as 512MiB\n", *memoryLimit)
+			os.Exit(1)
 		}
-
-		var err error
-		clusterMgr, err = cluster.NewManager(clusterConfig, logger)
-		if err != nil {
-			return fmt.Errorf("failed to create cluster manager: %w", err)
+	}
+	if *maxCacheBytes != "" {
+		if budgetLimits.CacheBytes, err = parseByteSize(*maxCacheBytes); err != nil || budgetLimits.CacheBytes == 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --max-cache-bytes %q: must be a positive size such as 64MiB\n", *maxCacheBytes)
+			os.Exit(1)
 		}
-
-		// Create context for cluster operations
-		ctx := context.Background()
-		if err := clusterMgr.Start(ctx); err != nil {
-			return fmt.Errorf("failed to start cluster: %w", err)
+	}
+	// GOMEMLIMIT alone is worth reporting the headroom of
+	var resourceBudget *budget.Budget
+	if budgetLimits != (budget.Limits{}) || os.Getenv("GOMEMLIMIT") != "" {
+		if resourceBudget, err = budget.New(budgetLimits); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid resource budget: %v\n", err)
+			os.Exit(1)
 		}
+	}
 
-		// Wait for leader election (with timeout)
-		leaderCtx, leaderCancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer leaderCancel()
-		if err := clusterMgr.WaitForLeader(leaderCtx); err != nil {
-			return fmt.Errorf("leader election failed: %w", err)
+	if *baseURL != "" {
+		if playlistURL != stdinSource && !localSource {
+			fmt.Fprintf(os.Stderr, "Error: --base-url is only used when reading the playlist from stdin ('-') or a local file\n")
+			os.Exit(1)
+		}
+		u, err := url.Parse(*baseURL)
+		if err != nil || !u.IsAbs() {
+			fmt.Fprintf(os.Stderr, "Error: --base-url must be an absolute URL\n")
+			os.Exit(1)
 		}
-
-		logger.Info("cluster initialized",
-			"is_leader", clusterMgr.IsLeader(),
-			"leader_address", clusterMgr.LeaderAddr(),
-			"raft_state", clusterMgr.State(),
-		)
 	}
 
-	// Build variants slice - either from master playlist or by wrapping single media playlist
-	var playlistVariants []variant.Variant
-
-	if playlistInfo.IsMaster {
-		logger.Info("parsed master playlist",
-			"variants", len(playlistInfo.Variants),
-			"targetDuration", playlistInfo.TargetDuration,
-		)
-		playlistVariants = playlistInfo.Variants
-	} else {
-		logger.Info("parsed media playlist",
-			"segments", len(playlistInfo.Segments),
-			"targetDuration", playlistInfo.TargetDuration,
-		)
-
-		// Wrap single media playlist as a single variant
-		playlistVariants = []variant.Variant{
-			{
-				Bandwidth:      0, // Unknown for single media playlist
-				Resolution:     "",
-				Codecs:         "",
-				PlaylistURL:    playlistURL,
-				Segments:       playlistInfo.Segments,
-				TargetDuration: playlistInfo.TargetDuration,
-			},
-		}
+	if *recordSource != "" && *replaySource != "" {
+		fmt.Fprintf(os.Stderr, "Error: --record-source and --replay-source are mutually exclusive\n")
+		os.Exit(1)
 	}
 
-	// Apply loop-after to each variant if specified
-	if loopAfterDuration > 0 {
-		variantsWithSubset := make([]variant.Variant, len(playlistVariants))
-		for i, v := range playlistVariants {
-			variantsWithSubset[i] = v
-			variantsWithSubset[i].Segments = calculateSegmentSubset(v.Segments, loopAfterDuration)
-			logger.Info("applied loop-after to variant",
-				"variantIndex", i,
-				"originalSegments", len(v.Segments),
-				"includedSegments", len(variantsWithSubset[i].Segments),
-				"duration", loopAfterDuration,
-			)
+	if *watchSrc {
+		if !localSource {
+			fmt.Fprintf(os.Stderr, "Error: --watch requires a local playlist file\n")
+			os.Exit(1)
+		}
+		if *clusterMode {
+			fmt.Fprintf(os.Stderr, "Error: --watch is not supported in cluster mode\n")
+			os.Exit(1)
 		}
-		playlistVariants = variantsWithSubset
 	}
 
-	// Log variant details
-	for i, v := range playlistVariants {
-		logger.Info("variant",
-			"index", i,
-			"bandwidth", v.Bandwidth,
-			"resolution", v.Resolution,
-			"segments", len(v.Segments),
-		)
+	if *watchdogN < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --advance-watchdog must not be negative\n")
+		os.Exit(1)
+	}
+	if *watchdogRst && *watchdogN == 0 {
+		fmt.Fprintf(os.Stderr, "Error: --advance-watchdog-restart requires --advance-watchdog\n")
+		os.Exit(1)
 	}
 
-	// Create the live playlist
-	livePlaylist, err := playlist.New(playlistVariants, windowSize, clusterMgr, logger)
-	if err != nil {
-		return fmt.Errorf("failed to create live playlist: %w", err)
+	if *catchUp && *stateFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --catch-up requires --state-file\n")
+		os.Exit(1)
 	}
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	var sc *scenario.Scenario
+	if *scenarioF != "" {
+		var err error
+		if sc, err = scenario.Load(*scenarioF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --scenario: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *scenarioX && sc == nil {
+		fmt.Fprintf(os.Stderr, "Error: --scenario-exit requires --scenario\n")
+		os.Exit(1)
+	}
+	if *probeMedia && !*playerProbe {
+		fmt.Fprintf(os.Stderr, "Error: --player-probe-segments requires --player-probe\n")
+		os.Exit(1)
+	}
+	if *playerProbe && *tlsClientCA != "" {
+		// The probe has no client certificate to present
+		fmt.Fprintf(os.Stderr, "Error: --player-probe is not supported with --tls-client-ca\n")
+		os.Exit(1)
+	}
+	var primeEdge *url.URL
+	if *primeCDN != "" {
+		var err error
+		if primeEdge, err = prime.ParseEdge(*primeCDN); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --prime-cdn: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Setup cluster shutdown if enabled
-	if clusterMode {
-		defer func() {
-			logger.Info("shutting down cluster")
-			if err := clusterMgr.Shutdown(); err != nil {
-				logger.Error("failed to shutdown cluster", "error", err)
+	var latency map[string]faults.Distribution
+	if *latencyF != "" {
+		var err error
+		if latency, err = faults.ParseLatency(*latencyF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --latency: %v\n", err)
+			os.Exit(1)
+		}
+		for class := range latency {
+			if !slices.Contains(server.EndpointClasses(), class) {
+				fmt.Fprintf(os.Stderr, "Error: invalid --latency: unknown endpoint class %q (want one of %s)\n",
+					class, strings.Join(server.EndpointClasses(), ", "))
+				os.Exit(1)
 			}
-		}()
+		}
 	}
 
-	// Setup signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		sig := <-sigChan
-		logger.Info("received signal", "signal", sig)
-		cancel()
+	var (
+		profiles     []faults.Profile
+		profileNames []string
+	)
+	if *profilesF != "" {
+		var err error
+		if profiles, err = faults.LoadProfiles(*profilesF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --network-profiles: %v\n", err)
+			os.Exit(1)
+		}
+		for _, p := range profiles {
+			profileNames = append(profileNames, p.Name)
+			for _, class := range p.Endpoints {
+				if !slices.Contains(server.EndpointClasses(), class) {
+					fmt.Fprintf(os.Stderr, "Error: invalid --network-profiles: profile %q: unknown endpoint class %q (want one of %s)\n",
+						p.Name, class, strings.Join(server.EndpointClasses(), ", "))
+					os.Exit(1)
+				}
+			}
+		}
+	}
+	if *profileF != "" && !slices.Contains(profileNames, *profileF) {
+		fmt.Fprintf(os.Stderr, "Error: --network-profile %q is not defined in --network-profiles\n", *profileF)
+		os.Exit(1)
+	}
+	if sc != nil {
+		for i, step := range sc.Steps {
+			if step.Action == scenario.ActionNetworkProfile && step.Profile != "" && !slices.Contains(profileNames, step.Profile) {
+				fmt.Fprintf(os.Stderr, "Error: invalid --scenario: step %d: network profile %q is not defined in --network-profiles\n", i+1, step.Profile)
+				os.Exit(1)
+			}
+		}
+	}
+
+	var faultRules []faults.Rule
+	if *faultsF != "" {
+		var err error
+		if faultRules, err = faults.ParseRules(*faultsF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --faults: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var cdn *faults.CDN
+	if *cdnF != "" {
+		parsed, err := faults.ParseCDN(*cdnF)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --cdn-headers: %v\n", err)
+			os.Exit(1)
+		}
+		cdn = &parsed
+	}
+
+	var tenants []tenant.Tenant
+	if *apiKeysF != "" {
+		var err error
+		if tenants, err = tenant.Load(*apiKeysF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --api-keys: %v\n", err)
+			os.Exit(1)
+		}
+		for _, t := range tenants {
+			if t.Name == probeTenant && *playerProbe {
+				fmt.Fprintf(os.Stderr, "Error: invalid --api-keys: tenant name %q is reserved for --player-probe\n", probeTenant)
+				os.Exit(1)
+			}
+			for _, class := range t.Endpoints {
+				if !slices.Contains(server.EndpointClasses(), class) {
+					fmt.Fprintf(os.Stderr, "Error: invalid --api-keys: tenant %q: unknown endpoint class %q (want one of %s)\n",
+						t.Name, class, strings.Join(server.EndpointClasses(), ", "))
+					os.Exit(1)
+				}
+			}
+		}
+	}
+
+	var adminTokens []admin.Token
+	if *adminTokF != "" {
+		var err error
+		if adminTokens, err = admin.Load(*adminTokF); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --admin-tokens: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	experimental, err := features.Parse(*experiments)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --enable-feature: %v\n", err)
+		os.Exit(1)
+	}
+
+	var gaps playlist.Gaps
+	if *segGaps != "" {
+		if gaps, err = playlist.ParseGaps(*segGaps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --segment-gaps: %v\n", err)
+			os.Exit(1)
+		}
+		if gaps.Mode == playlist.GapSkip && (experimental.Enabled(features.LLHLS) || experimental.Enabled(features.DeltaUpdates)) {
+			fmt.Fprintf(os.Stderr, "Error: --segment-gaps skip is not supported with --enable-feature ll-hls or delta-updates\n")
+			os.Exit(1)
+		}
+	}
+
+	encryptMethod, err := playlist.ParseEncryptionMethod(*encryptF)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --encryption: %v\n", err)
+		os.Exit(1)
+	}
+	if encryptMethod == playlist.EncryptionNone && (*keyURI != "" || *keyRotation != 0) {
+		fmt.Fprintf(os.Stderr, "Error: --key-uri and --key-rotation require --encryption\n")
+		os.Exit(1)
+	}
+	if encryptMethod == playlist.EncryptionNone && sc != nil && sc.Uses(scenario.ActionRotateKeys) {
+		fmt.Fprintf(os.Stderr, "Error: --scenario rotate-keys steps require --encryption\n")
+		os.Exit(1)
+	}
+
+	var cacheControl server.CacheControl
+	for _, c := range []struct {
+		flag  string
+		value string
+		dst   *string
+	}{
+		{"cache-control-master", *cacheMaster, &cacheControl.Master},
+		{"cache-control-media", *cacheMedia, &cacheControl.Media},
+		{"cache-control-segments", *cacheSegs, &cacheControl.Segment},
+	} {
+		if *c.dst, err = server.ParseCacheControl(c.value); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --%s: %v\n", c.flag, err)
+			os.Exit(1)
+		}
+	}
+
+	if *srcCheck < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --source-check-interval must not be negative\n")
+		os.Exit(1)
+	}
+
+	if *loopSegs < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --loop-segments must not be negative\n")
+		os.Exit(1)
+	}
+	var loopByteLimit int64
+	if *loopBytes != "" {
+		n, err := parseByteSize(*loopBytes)
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --loop-bytes %q: must be a positive size such as 500MB\n", *loopBytes)
+			os.Exit(1)
+		}
+		if !*probeSegs {
+			fmt.Fprintf(os.Stderr, "Error: --loop-bytes requires --probe-segments\n")
+			os.Exit(1)
+		}
+		loopByteLimit = n
+	}
+
+	if *probeBW && !*probeSegs {
+		fmt.Fprintf(os.Stderr, "Error: --bandwidth-from-probe requires --probe-segments\n")
+		os.Exit(1)
+	}
+	if *mediaSeq != "rebase" && *mediaSeq != "preserve" {
+		fmt.Fprintf(os.Stderr, "Error: --media-sequence must be 'rebase' or 'preserve'\n")
+		os.Exit(1)
+	}
+	if *startPos < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --start-position must not be negative\n")
+		os.Exit(1)
+	}
+	if *startSeq != 0 && *mediaSeq == "preserve" {
+		fmt.Fprintf(os.Stderr, "Error: --start-sequence cannot be combined with --media-sequence preserve\n")
+		os.Exit(1)
+	}
+	if *timeScale <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --time-scale must be positive\n")
+		os.Exit(1)
+	}
+	durationMode, err := playlist.ParseDurationMode(*scaleDurs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --time-scale-durations: %v\n", err)
+		os.Exit(1)
+	}
+	var variantIndices []int
+	if *variants != "" {
+		indices, err := variant.ParseIndices(*variants)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --variants: %v\n", err)
+			os.Exit(1)
+		}
+		variantIndices = indices
+	}
+	if *verifyN < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --verify-sample must not be negative\n")
+		os.Exit(1)
+	}
+	if *probeConc < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --probe-concurrency must be at least 1\n")
+		os.Exit(1)
+	}
+
+	// Validate cluster flags
+	if *clusterMode {
+		if *raftID == "" {
+			fmt.Fprintf(os.Stderr, "Error: --raft-id is required when --cluster is enabled\n")
+			os.Exit(1)
+		}
+		if *raftBind == "" {
+			fmt.Fprintf(os.Stderr, "Error: --raft-bind is required when --cluster is enabled\n")
+			os.Exit(1)
+		}
+		if *peers == "" {
+			fmt.Fprintf(os.Stderr, "Error: --peers is required when --cluster is enabled\n")
+			os.Exit(1)
+		}
+	}
+	if *raftDir != "" && !*clusterMode {
+		fmt.Fprintf(os.Stderr, "Error: --raft-dir requires --cluster\n")
+		os.Exit(1)
+	}
+	if *raftArchive != "" && !*clusterMode {
+		fmt.Fprintf(os.Stderr, "Error: --raft-snapshot-archive requires --cluster\n")
+		os.Exit(1)
+	}
+	var transportDelay faults.Distribution
+	if *raftDelay != "" {
+		if !*clusterMode {
+			fmt.Fprintf(os.Stderr, "Error: --raft-delay requires --cluster\n")
+			os.Exit(1)
+		}
+		var err error
+		if transportDelay, err = faults.ParseDistribution(*raftDelay); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --raft-delay: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Validate standby pair flags
+	var standbyConfig *standby.Config
+	if *standbyRole != "" {
+		if *clusterMode {
+			fmt.Fprintf(os.Stderr, "Error: --standby-role and --cluster are mutually exclusive\n")
+			os.Exit(1)
+		}
+		if *standbySecret == "" {
+			fmt.Fprintf(os.Stderr, "Error: --standby-secret-file is required when --standby-role is set\n")
+			os.Exit(1)
+		}
+		secret, err := os.ReadFile(*standbySecret)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --standby-secret-file: %v\n", err)
+			os.Exit(1)
+		}
+		standbyConfig = &standby.Config{
+			Role:            standby.Role(*standbyRole),
+			Listen:          *standbyListen,
+			Peer:            *standbyPeer,
+			Secret:          bytes.TrimSpace(secret),
+			FailoverTimeout: *standbyTimeout,
+		}
+		if err := standbyConfig.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid standby pair settings: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Setup logger
+	logLevel := slog.LevelInfo
+	if *verbose {
+		logLevel = slog.LevelDebug
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: logLevel,
+	}))
+
+	build := buildinfo.Read(version, nil, nil)
+	logger.Info("EncoderSim starting", "version", version, "commit", build.Commit, "build_date", build.Date, "go_version", build.GoVersion)
+
+	// Parse peer addresses if cluster mode enabled
+	var peerAddrs []string
+	if *clusterMode {
+		peerAddrs = strings.Split(*peers, ",")
+		for i := range peerAddrs {
+			peerAddrs[i] = strings.TrimSpace(peerAddrs[i])
+		}
+	}
+
+	// Run the application
+	opts := options{
+		playlistURL: playlistURL,
+		baseURL:     *baseURL,
+		watch:       *watchSrc,
+		sourceCheck: *srcCheck,
+		scenario:    sc,
+		scenarioEnd: *scenarioX,
+		playerProbe: *playerProbe,
+		probeMedia:  *probeMedia,
+		primeEdge:   primeEdge,
+		latency:     latency,
+		profiles:    profiles,
+		profile:     *profileF,
+		faults:      faultRules,
+		cdn:         cdn,
+		tenants:     tenants,
+		admin:       adminTokens,
+		experiments: experimental,
+		cache:       cacheControl,
+		watchdog: playlist.WatchdogOptions{
+			Multiplier: *watchdogN,
+			Restart:    *watchdogRst,
+		},
+		cacheDir:    *cacheDir,
+		noCache:     *noCache,
+		recordDir:   *recordSource,
+		mirrorDir:   *mirrorDir,
+		auditLog:    *auditLogF,
+		replayDir:   *replaySource,
+		port:        *port,
+		tls:         serverTLS,
+		redirPort:   *redirPort,
+		reusePort:   *reusePort,
+		windowSize:  *windowSize,
+		windowPol:   windowPolicy,
+		pdt:         pdtMode,
+		pdtAnomaly:  pdtAnomalies,
+		pdtFormat:   pdtFormat,
+		plType:      playlistType,
+		plLoops:     *plLoops,
+		gaps:        gaps,
+		encryption:  playlist.Encryption{Method: encryptMethod, URI: *keyURI, Rotation: *keyRotation},
+		master:      *master,
+		variants:    variantIndices,
+		loopAfter:   *loopAfter,
+		loopSegs:    *loopSegs,
+		loopBytes:   loopByteLimit,
+		parseMode:   mode,
+		template:    parser.Template{Mode: templateMode, Vars: templateVars},
+		passthrough: passthroughTags,
+		probe:       *probeSegs,
+		probeConc:   *probeConc,
+		probeBW:     *probeBW,
+		verify:      *verifySrc,
+		verifyN:     *verifyN,
+		verifyFmt:   *verifyFmt,
+		preserveSeq: *mediaSeq == "preserve",
+		startPos:    *startPos,
+		startSeq:    *startSeq,
+		timeScale:   *timeScale,
+		scaleDurs:   durationMode,
+		preRender:   *preRender,
+		dash:        *dashOut,
+		smooth:      *smoothOut,
+		debugSubs:   *debugSubs,
+		stateFile:   *stateFile,
+		catchUp:     *catchUp,
+		upstream:    upstreamConfig,
+		limits:      serverLimits,
+		budget:      resourceBudget,
+		clusterMode: *clusterMode,
+		raftID:      *raftID,
+		raftBind:    *raftBind,
+		peers:       peerAddrs,
+		clockSkew:   *clockSkew,
+		raftDir:     *raftDir,
+		raftArchive: *raftArchive,
+		raftDelay:   transportDelay,
+		standby:     standbyConfig,
+	}
+	if err := run(opts, logger); err != nil {
+		logger.Error("application error", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("EncoderSim stopped")
+}
+
+// options holds the validated command-line configuration passed to run.
+type options struct {
+	playlistURL string
+	baseURL     string
+	watch       bool
+	sourceCheck time.Duration
+	scenario    *scenario.Scenario
+	scenarioEnd bool // exit when the scenario finishes
+	playerProbe bool
+	probeMedia  bool
+	primeEdge   *url.URL                       // --prime-cdn
+	latency     map[string]faults.Distribution // by endpoint class
+	profiles    []faults.Profile
+	profile     string // initially active network profile
+	faults      []faults.Rule
+	cdn         *faults.CDN     // --cdn-headers
+	tenants     []tenant.Tenant // --api-keys
+	admin       []admin.Token   // --admin-tokens
+	experiments features.Set    // --enable-feature
+	cache       server.CacheControl
+	watchdog    playlist.WatchdogOptions
+	cacheDir    string
+	noCache     bool
+	recordDir   string
+	mirrorDir   string
+	auditLog    string // --audit-log
+	replayDir   string
+	port        int
+	tls         *tls.Config // --tls-cert, nil to serve HTTP
+	redirPort   int         // --http-redirect-port
+	reusePort   bool
+	windowSize  int
+	windowPol   playlist.WindowPolicy
+	pdt         playlist.ProgramDateTime
+	pdtAnomaly  playlist.PDTAnomalies // --pdt-anomalies
+	pdtFormat   playlist.PDTFormat    // --pdt-zone, --pdt-offset, --pdt-precision
+	plType      playlist.PlaylistType
+	plLoops     int
+	gaps        playlist.Gaps       // --segment-gaps
+	encryption  playlist.Encryption // --encryption, --key-uri, --key-rotation
+	master      bool
+	variants    []int // --variants, nil to serve all in source order
+	loopAfter   string
+	loopSegs    int
+	loopBytes   int64
+	parseMode   parser.Mode
+	template    parser.Template
+	passthrough parser.TagAllowlist
+	probe       bool
+	probeConc   int
+	probeBW     bool
+	verify      bool
+	verifyN     int
+	verifyFmt   bool
+	preserveSeq bool
+	startPos    int
+	startSeq    uint64
+	timeScale   float64
+	scaleDurs   playlist.DurationMode
+	preRender   bool
+	dash        bool
+	smooth      bool
+	debugSubs   bool
+	stateFile   string
+	catchUp     bool
+	upstream    upstream.Config
+	limits      server.Limits
+	budget      *budget.Budget // nil without resource budget flags
+
+	clusterMode bool
+	raftID      string
+	raftBind    string
+	peers       []string
+	clockSkew   time.Duration
+	raftDir     string
+	raftArchive string
+	raftDelay   faults.Distribution // --raft-delay, nil if not set
+
+	standby *standby.Config // --standby-role, nil if not set
+}
+
+func run(opts options, logger *slog.Logger) error {
+	opts.budget.ApplyRuntime(logger)
+
+	// Parse and validate loop-after duration if specified
+	var loopAfterDuration time.Duration
+	if opts.loopAfter != "" {
+		duration, err := time.ParseDuration(opts.loopAfter)
+		if err != nil {
+			return fmt.Errorf("invalid --loop-after duration '%s': %w", opts.loopAfter, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("--loop-after duration must be positive, got: %s", opts.loopAfter)
+		}
+		loopAfterDuration = duration
+		logger.Info("loop-after specified", "duration", duration)
+	}
+	limits := loopLimits{
+		duration: loopAfterDuration,
+		segments: opts.loopSegs,
+		bytes:    opts.loopBytes,
+	}
+
+	upstreamClient := upstream.NewClient(opts.upstream)
+
+	// Parsing may go through a recording or a replay of the origin; segment
+	// probing and verification always use the network
+	parseClient := upstreamClient
+	switch {
+	case opts.recordDir != "":
+		store, err := storage.Open(opts.recordDir, upstreamClient)
+		if err != nil {
+			return fmt.Errorf("invalid --record-source: %w", err)
+		}
+		chargeMemoryStorage(store, opts.budget)
+		transport := upstream.NewRecordingTransport(upstreamClient.Transport, store)
+		parseClient = &http.Client{Transport: transport, Timeout: upstreamClient.Timeout}
+		logger.Info("recording source responses", "storage", store.String())
+	case opts.replayDir != "":
+		store, err := storage.Open(opts.replayDir, upstreamClient)
+		if err != nil {
+			return fmt.Errorf("invalid --replay-source: %w", err)
+		}
+		transport, err := upstream.NewReplayTransport(context.Background(), store)
+		if err != nil {
+			return err
+		}
+		parseClient = &http.Client{Transport: transport}
+		logger.Info("replaying recorded source responses", "storage", store.String())
+	}
+
+	// Cache parsed HTTP sources across restarts. A recording must capture
+	// every playlist, and a replay is already offline, so neither uses it.
+	var sourceCache *parser.Cache
+	if opts.cacheDir != "" && opts.recordDir == "" && opts.replayDir == "" {
+		store, err := storage.Open(opts.cacheDir, upstreamClient)
+		if err != nil {
+			logger.Warn("source cache disabled", "error", err)
+		} else {
+			chargeMemoryStorage(store, opts.budget)
+			sourceCache = parser.NewCache(store)
+		}
+	}
+
+	sourceParser := parser.New(parser.Options{
+		Client:          parseClient,
+		Mode:            opts.parseMode,
+		PassthroughTags: opts.passthrough,
+		Template:        opts.template,
+		Cache:           sourceCache,
+		RefreshCache:    opts.noCache,
+	})
+
+	// Initialize cluster manager if cluster mode is enabled
+	var clusterMgr *cluster.Manager
+	if opts.clusterMode {
+		logger.Info("initializing cluster mode",
+			"raft_id", opts.raftID,
+			"raft_bind", opts.raftBind,
+			"peers", len(opts.peers),
+		)
+
+		clusterConfig := cluster.Config{
+			RaftID:         opts.raftID,
+			BindAddr:       opts.raftBind,
+			Peers:          opts.peers,
+			TransportDelay: opts.raftDelay,
+			DataDir:        opts.raftDir,
+		}
+		if opts.raftArchive != "" {
+			store, err := storage.Open(opts.raftArchive, upstreamClient)
+			if err != nil {
+				return fmt.Errorf("invalid --raft-snapshot-archive: %w", err)
+			}
+			chargeMemoryStorage(store, opts.budget)
+			clusterConfig.SnapshotArchive = store
+			logger.Info("archiving Raft snapshots", "storage", store.String())
+		}
+
+		var err error
+		clusterMgr, err = cluster.NewManager(clusterConfig, logger)
+		if err != nil {
+			return fmt.Errorf("failed to create cluster manager: %w", err)
+		}
+
+		// Create context for cluster operations
+		ctx := context.Background()
+		if err := clusterMgr.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start cluster: %w", err)
+		}
+
+		// Wait for leader election (with timeout)
+		leaderCtx, leaderCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer leaderCancel()
+		if err := clusterMgr.WaitForLeader(leaderCtx); err != nil {
+			return fmt.Errorf("leader election failed: %w", err)
+		}
+
+		logger.Info("cluster initialized",
+			"is_leader", clusterMgr.IsLeader(),
+			"leader_address", clusterMgr.LeaderAddr(),
+			"raft_state", clusterMgr.State(),
+		)
+
+		// Apply the log kept in --raft-dir before the playlist resumes from it
+		if opts.raftDir != "" && clusterMgr.IsLeader() {
+			if err := clusterMgr.Barrier(10 * time.Second); err != nil {
+				return fmt.Errorf("failed to apply the stored Raft log: %w", err)
+			}
+		}
+	}
+
+	// Keep serving the variants at the indices they had before a restart
+	var sources []string
+	if opts.stateFile != "" {
+		var err error
+		sources, err = playlist.LoadSources(opts.stateFile)
+		if err != nil {
+			logger.Warn("ignoring unreadable variant mapping", "path", opts.stateFile, "error", err)
+		}
+	}
+
+	// Followers serve the variants at the indices the cluster serves them at
+	var clusterVariants []string
+	if clusterMgr != nil && !clusterMgr.IsLeader() {
+		clusterVariants = clusterSources(clusterMgr, logger)
+		if clusterVariants != nil {
+			sources = clusterVariants
+		}
+	}
+	playlistVariants, renditions, originFetch, err := loadSource(opts, sourceParser, upstreamClient, limits, sources, logger)
+	if err != nil {
+		return err
+	}
+	renditions = compatibleRenditions(opts, renditions, logger)
+	if clusterVariants != nil && !slices.Equal(append(variant.Sources(playlistVariants), variant.MediaSources(renditions)...), clusterVariants) {
+		return fmt.Errorf("this node cannot serve the cluster's variants %v: check the source", clusterVariants)
+	}
+
+	// Log variant details
+	for i, v := range playlistVariants {
+		logger.Info("variant",
+			"index", i,
+			"bandwidth", v.Bandwidth,
+			"resolution", v.Resolution,
+			"segments", len(v.Segments),
+			"measuredBandwidth", v.MeasuredBandwidth,
+		)
+	}
+
+	// Create the live playlist
+	livePlaylist, err := playlist.NewWithOptions(playlistVariants, playlist.Options{
+		WindowSize:            opts.windowSize,
+		WindowPolicy:          opts.windowPol,
+		PreRender:             opts.preRender,
+		PreserveMediaSequence: opts.preserveSeq,
+		StartPosition:         opts.startPos,
+		StartSequence:         opts.startSeq,
+		TimeScale:             opts.timeScale,
+		TimeScaleDurations:    opts.scaleDurs,
+		SegmentStore:          segment.NewStore(),
+		Budget:                opts.budget,
+		StateFile:             opts.stateFile,
+		CatchUp:               opts.catchUp,
+		ClockSkew:             opts.clockSkew,
+		DASH:                  opts.dash,
+		Smooth:                opts.smooth,
+		DebugSubtitles:        opts.debugSubs,
+		BlockingReload:        opts.experiments.Enabled(features.LLHLS),
+		DeltaUpdates:          opts.experiments.Enabled(features.DeltaUpdates),
+		ProgramDateTime:       opts.pdt,
+		Type:                  opts.plType,
+		Loops:                 opts.plLoops,
+		Gaps:                  opts.gaps,
+		PDTAnomalies:          opts.pdtAnomaly,
+		PDTFormat:             opts.pdtFormat,
+		Encryption:            opts.encryption,
+		Renditions:            renditions,
+	}, clusterMgr, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create live playlist: %w", err)
+	}
+	if opts.scenario != nil {
+		if err := opts.scenario.Validate(len(playlistVariants)); err != nil {
+			return fmt.Errorf("invalid --scenario: %w", err)
+		}
+	}
+
+	// Create context for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Setup cluster shutdown if enabled
+	if opts.clusterMode {
+		defer func() {
+			logger.Info("shutting down cluster")
+			if err := clusterMgr.Shutdown(); err != nil {
+				logger.Error("failed to shutdown cluster", "error", err)
+			}
+		}()
+	}
+
+	// Setup signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	tracker := health.NewTracker(logger)
+	eventLog := events.NewLog(0)
+	auditLog, err := audit.New(opts.auditLog, eventLog)
+	if err != nil {
+		return fmt.Errorf("invalid --audit-log: %w", err)
+	}
+	defer auditLog.Close()
+
+	go func() {
+		sig := <-sigChan
+		logger.Info("received signal", "signal", sig)
+		tracker.MarkStopping()
+		cancel()
 	}()
 
-	// Start auto-advance in a goroutine
-	go livePlaylist.StartAutoAdvance(ctx)
+	// Join the standby pair before the first advance, so that a standby
+	// never advances on its own
+	standbyDone := make(chan error, 1)
+	if opts.standby != nil {
+		node, err := standby.NewNode(*opts.standby, livePlaylist, logger)
+		if err != nil {
+			return fmt.Errorf("invalid standby pair settings: %w", err)
+		}
+		go func() {
+			err := node.Run(ctx)
+			if err != nil {
+				// Without the stream, the other node would take over too
+				logger.Error("standby pair stopped", "error", err)
+				tracker.MarkStopping()
+				cancel()
+			}
+			standbyDone <- err
+		}()
+	}
+
+	// Start auto-advance in a goroutine, watched by the advance watchdog
+	go livePlaylist.RunAutoAdvance(ctx, opts.watchdog)
+
+	// Keep /health current: a stalled window, a leaderless cluster and an
+	// unreachable source each degrade the service with their own reason
+	go tracker.Watch(ctx, health.ReasonAdvanceStalled, time.Second,
+		health.StallCheck(livePlaylist.MediaSequence, livePlaylist.AdvanceInterval()))
+	if opts.watchdog.Multiplier > 0 {
+		go tracker.Watch(ctx, health.ReasonAdvanceLoopStuck, time.Second, func() error {
+			if stalled, since := livePlaylist.AdvanceStalled(); stalled {
+				return fmt.Errorf("no advance completed for %s", since.Round(time.Second))
+			}
+			return nil
+		})
+	}
+	if opts.clusterMode {
+		go tracker.Watch(ctx, health.ReasonQuorumLost, time.Second, func() error {
+			if clusterMgr.LeaderAddr() == "" {
+				return fmt.Errorf("no Raft leader (this node is %s)", clusterMgr.State())
+			}
+			return nil
+		})
+	}
+	if check := sourceCheck(opts, upstreamClient); check != nil && opts.sourceCheck > 0 {
+		go tracker.Watch(ctx, health.ReasonSourceUnreachable, opts.sourceCheck, check)
+	}
+
+	var adminTokens *admin.Tokens
+	if opts.admin != nil {
+		adminTokens = admin.NewTokens(opts.admin)
+	}
+
+	// The player probe gets its own tenant, with a key nobody else knows
+	var tenants *tenant.Registry
+	probeQuery := ""
+	if opts.tenants != nil {
+		all := opts.tenants
+		if opts.playerProbe {
+			key, err := tenant.NewKey()
+			if err != nil {
+				return err
+			}
+			all = append(slices.Clone(all), tenant.Tenant{Name: probeTenant, Key: key})
+			probeQuery = "?" + tenant.QueryParam + "=" + key
+		}
+		tenants = tenant.NewRegistry(all)
+	}
+
+	// Where this server is reached locally, by the probe and in the logs
+	scheme := "http"
+	if opts.tls != nil {
+		scheme = "https"
+	}
+	localURL := fmt.Sprintf("%s://localhost:%d", scheme, opts.port)
+
+	// Play our own output to catch anomalies without an external player
+	var playerProbe *player.Probe
+	if opts.playerProbe {
+		urls := make([]string, len(playlistVariants))
+		for i := range urls {
+			urls[i] = fmt.Sprintf("%s/variant/%d/playlist.m3u8%s", localURL, i, probeQuery)
+		}
+		var probeClient *http.Client
+		if opts.tls != nil {
+			// The certificate need not name localhost, and this is our own server
+			probeClient = &http.Client{
+				Timeout:   5 * time.Second,
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+			}
+		}
+		playerProbe = player.New(player.Options{
+			URLs:          urls,
+			Client:        probeClient,
+			CheckSegments: opts.probeMedia,
+			SegmentClient: upstreamClient,
+			Events:        eventLog,
+		}, logger.With("component", "player-probe"))
+		go playerProbe.Run(ctx)
+	}
+
+	// Fill the CDN with every new live edge segment, as its first player would
+	var primer *prime.Primer
+	if opts.primeEdge != nil {
+		primer = prime.New(livePlaylist, prime.Options{
+			Edge:   opts.primeEdge,
+			Client: upstreamClient,
+		}, logger.With("component", "cdn-primer"))
+		go primer.Run(ctx)
+		logger.Info("priming CDN", "edge", opts.primeEdge.String())
+	}
+
+	var shaper *faults.Shaper
+	if opts.profiles != nil {
+		shaper = faults.NewShaper(opts.profiles, time.Now().UnixNano())
+	}
+
+	var responseMirror *mirror.Mirror
+	if opts.mirrorDir != "" {
+		store, err := storage.Open(opts.mirrorDir, upstreamClient)
+		if err != nil {
+			return fmt.Errorf("invalid --mirror: %w", err)
+		}
+		chargeMemoryStorage(store, opts.budget)
+		if responseMirror, err = mirror.New(context.Background(), store); err != nil {
+			return fmt.Errorf("invalid --mirror: %w", err)
+		}
+		logger.Info("mirroring served responses", "storage", store.String())
+	}
+
+	// Re-fetch the source on SIGHUP or POST /admin/reload and splice it in
+	// at the live edge
+	var reload server.Reloader
+	if err := reloadable(opts, livePlaylist); err != nil {
+		logger.Debug("reloading the source is disabled", "reason", err)
+	} else {
+		reload = func(context.Context) (server.OriginFetch, error) {
+			variants, _, fetch, err := loadSource(opts, sourceParser, upstreamClient, limits, variant.Sources(playlistVariants), logger)
+			if err != nil {
+				return fetch, err
+			}
+			return fetch, livePlaylist.Splice(variants)
+		}
+	}
+
+	// Create and start the HTTP server
+	var cdnHeaders *faults.CDNHeaders
+	if opts.cdn != nil {
+		cdnHeaders = faults.NewCDNHeaders(*opts.cdn, time.Now().UnixNano())
+	}
+	srv := server.NewWithOptions(livePlaylist, server.Options{
+		Port:         opts.port,
+		TLS:          opts.tls,
+		RedirectPort: opts.redirPort,
+		ReusePort:    opts.reusePort,
+		Version:      version,
+		Build:        buildinfo.Read(version, enabledFeatures(opts), opts.experiments),
+		Health:       tracker,
+		Events:       eventLog,
+		Player:       playerProbe,
+		Primer:       primer,
+		Budget:       opts.budget,
+		Latency:      faults.NewLatency(opts.latency, time.Now().UnixNano()),
+		Shaper:       shaper,
+		Faults:       faults.NewPathFaults(opts.faults, time.Now().UnixNano()),
+		Mirror:       responseMirror,
+		CacheControl: opts.cache,
+		CDN:          cdnHeaders,
+		Tenants:      tenants,
+		Admin:        adminTokens,
+		Audit:        auditLog,
+		Limits:       opts.limits,
+		Reload:       reload,
+	}, logger)
+	srv.SetOriginFetch(originFetch)
+	if opts.profile != "" {
+		if err := srv.SetNetworkProfile(opts.profile); err != nil {
+			return fmt.Errorf("invalid --network-profile: %w", err)
+		}
+	}
+
+	// Reload edited local sources; the swap happens at the next loop boundary
+	if opts.watch {
+		path, _ := parser.LocalPath(opts.playlistURL)
+		go func() {
+			err := watch.File(ctx, path, watch.DefaultDebounce, func() {
+				logger.Info("source file changed, reloading", "path", path)
+				variants, _, fetch, err := loadSource(opts, sourceParser, upstreamClient, limits, variant.Sources(playlistVariants), logger)
+				if err != nil {
+					logger.Error("failed to reload source, keeping current segments", "error", err)
+					return
+				}
+				srv.SetOriginFetch(fetch)
+				if err := livePlaylist.Replace(variants); err != nil {
+					logger.Error("failed to replace segments, keeping current segments", "error", err)
+				}
+			}, logger)
+			if err != nil {
+				logger.Error("source file watcher stopped", "error", err)
+			}
+		}()
+	}
 
-	// Create and start the HTTP server
-	srv := server.New(livePlaylist, port, logger)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hupChan:
+				logger.Info("received SIGHUP, reloading source")
+				if err := srv.Reload(ctx); err != nil {
+					logger.Error("failed to reload source, keeping current segments", "error", err)
+				}
+			}
+		}
+	}()
+
+	scenarioDone := make(chan error, 1)
+	if opts.scenario != nil {
+		go func() {
+			err := scenario.Run(ctx, opts.scenario, scenarioTarget{livePlaylist, srv}, eventLog, auditLog, logger)
+			if err != nil && ctx.Err() == nil {
+				logger.Error("scenario failed", "error", err)
+			}
+			scenarioDone <- err
+			if opts.scenarioEnd {
+				tracker.MarkStopping()
+				cancel()
+			}
+		}()
+	}
 
 	logMsg := "live HLS stream ready"
 	logArgs := []any{
-		"master_url", fmt.Sprintf("http://localhost:%d/playlist.m3u8", port),
-		"health", fmt.Sprintf("http://localhost:%d/health", port),
+		"master_url", localURL + "/playlist.m3u8",
+		"health", localURL + "/health",
 		"variants", len(playlistVariants),
+		"features", strings.Join(enabledFeatures(opts), ","),
+	}
+	if names := opts.experiments.Names(); len(names) > 0 {
+		logArgs = append(logArgs, "experimental", strings.Join(names, ","))
 	}
-	if clusterMode {
+	if opts.dash {
+		logArgs = append(logArgs, "dash_url", localURL+"/manifest.mpd")
+	}
+	if opts.smooth {
+		logArgs = append(logArgs, "smooth_url", localURL+"/smooth/Manifest")
+	}
+	if opts.profiles != nil {
+		logArgs = append(logArgs, "network_profile", localURL+"/network-profile")
+	}
+	if opts.clusterMode {
 		logMsg += " (cluster mode)"
-		logArgs = append(logArgs, "cluster_status", fmt.Sprintf("http://localhost:%d/cluster/status", port))
+		logArgs = append(logArgs, "cluster_status", localURL+"/cluster/status")
+	}
+	if opts.standby != nil {
+		logMsg += fmt.Sprintf(" (standby pair, %s)", opts.standby.Role)
+		logArgs = append(logArgs, "standby_peer", opts.standby.Peer)
 	}
 	logger.Info(logMsg, logArgs...)
+	tracker.MarkReady()
 
 	// Start server (blocks until shutdown)
-	return srv.Start(ctx)
+	err = srv.Start(ctx)
+	if opts.standby != nil {
+		cancel()
+		if standbyErr := <-standbyDone; standbyErr != nil && err == nil {
+			err = fmt.Errorf("standby pair: %w", standbyErr)
+		}
+	}
+	if opts.scenarioEnd {
+		if scenarioErr := <-scenarioDone; scenarioErr != nil {
+			return fmt.Errorf("scenario %s failed: %w", opts.scenario.Name, scenarioErr)
+		}
+		logger.Info("scenario passed", "scenario", opts.scenario.Name)
+	}
+	return err
+}
+
+// enabledFeatures lists the optional subsystems opts enables, as reported by
+// /version.
+func enabledFeatures(opts options) []string {
+	enabled := []struct {
+		name string
+		on   bool
+	}{
+		{"cluster", opts.clusterMode},
+		{"standby", opts.standby != nil},
+		{"dash", opts.dash},
+		{"smooth", opts.smooth},
+		{"debug-subtitles", opts.debugSubs},
+		{"pre-render", opts.preRender},
+		{"program-date-time", opts.pdt != playlist.PDTOff},
+		{"pdt-anomalies", opts.pdtAnomaly.Enabled()},
+		{"pdt-format", opts.pdtFormat != playlist.PDTFormat{}},
+		{"playlist-type", opts.plType != playlist.TypeLive},
+		{"segment-gaps", opts.gaps.Every != 0},
+		{"time-scale", opts.timeScale != 1},
+		{"encryption", opts.encryption.Method != playlist.EncryptionNone},
+		{"watch", opts.watch},
+		{"state-file", opts.stateFile != ""},
+		{"scenario", opts.scenario != nil},
+		{"player-probe", opts.playerProbe},
+		{"prime-cdn", opts.primeEdge != nil},
+		{"latency", opts.latency != nil},
+		{"network-profiles", opts.profiles != nil},
+		{"faults", opts.faults != nil},
+		{"cdn-headers", opts.cdn != nil},
+		{"api-keys", opts.tenants != nil},
+		{"admin-tokens", opts.admin != nil},
+		{"tls", opts.tls != nil},
+		{"reuse-port", opts.reusePort},
+		{"mutual-tls", opts.tls != nil && opts.tls.ClientCAs != nil},
+		{"mirror", opts.mirrorDir != ""},
+		{"audit-log", opts.auditLog != ""},
+		{"cache-control", opts.cache != server.CacheControl{}},
+		{"rate-limit", opts.limits.RequestRate > 0 || opts.limits.ClientRequestRate > 0},
+		{"max-conns", opts.limits.MaxConns > 0},
+		{"resource-budget", opts.budget != nil},
+	}
+	features := []string{}
+	for _, f := range enabled {
+		if f.on {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
+
+// chargeMemoryStorage charges the values of a memory: storage to the cache
+// limit of b. Other backends hold nothing in memory.
+func chargeMemoryStorage(store storage.Storage, b *budget.Budget) {
+	if mem, ok := store.(*storage.Memory); ok && b != nil {
+		mem.SetQuota(b)
+	}
+}
+
+// loadSource parses the source playlist and prepares its variants for
+// serving: it selects and orders them (see selectVariants), applies the loop
+// limits and, if requested, probes and verifies the segments. It runs at
+// startup and again whenever a watched source changes.
+func loadSource(opts options, sourceParser *parser.Parser, client *http.Client, limits loopLimits, sources []string, logger *slog.Logger) ([]variant.Variant, []variant.Rendition, server.OriginFetch, error) {
+	// Parse the source playlist
+	sourceURL := opts.playlistURL
+	var (
+		playlistInfo *parser.PlaylistInfo
+		err          error
+	)
+	start := time.Now()
+	if opts.playlistURL == stdinSource {
+		logger.Info("reading source playlist from stdin", "baseURL", opts.baseURL)
+		playlistInfo, err = sourceParser.ParseReader(os.Stdin, opts.baseURL)
+		sourceURL = opts.baseURL
+	} else if path, ok := parser.LocalPath(opts.playlistURL); ok && opts.baseURL != "" {
+		logger.Info("reading source playlist", "path", path, "baseURL", opts.baseURL)
+		playlistInfo, err = parseFile(sourceParser, path, opts.baseURL)
+		sourceURL = opts.baseURL
+	} else {
+		logger.Info("fetching source playlist", "url", opts.playlistURL)
+		playlistInfo, err = sourceParser.Parse(opts.playlistURL)
+	}
+	if err != nil {
+		return nil, nil, server.OriginFetch{}, fmt.Errorf("failed to parse playlist: %w", err)
+	}
+	fetch := server.OriginFetch{Duration: time.Since(start), FromCache: playlistInfo.FromCache}
+	if playlistInfo.FromCache {
+		logger.Info("source unchanged, using cached snapshot", "url", opts.playlistURL)
+	}
+	if err := playlistInfo.CacheErr; err != nil {
+		attrs := []any{"url", opts.playlistURL, "error", err}
+		if errors.Is(err, budget.ErrExceeded) {
+			attrs = append(attrs, "budget", "--max-cache-bytes")
+		}
+		logger.Warn("failed to write the source cache", attrs...)
+	}
+
+	// Report everything lenient parsing had to tolerate
+	for _, w := range playlistInfo.Warnings {
+		logger.Warn("tolerated source playlist issue",
+			"url", w.URL,
+			"line", w.Line,
+			"issue", w.Issue,
+			"detail", w.Detail,
+		)
+	}
+	if len(playlistInfo.Warnings) > 0 {
+		logger.Warn("source playlist parsed with warnings",
+			"warnings", len(playlistInfo.Warnings),
+			"hint", "use --parse-mode strict to reject such sources",
+		)
+	}
+
+	// Check if explicit mode is set, otherwise use detected mode
+	if opts.master && !playlistInfo.IsMaster {
+		return nil, nil, server.OriginFetch{}, fmt.Errorf("--master flag set but URL is a media playlist, not a master playlist")
+	}
+
+	// Build variants slice - either from master playlist or by wrapping single media playlist
+	var playlistVariants []variant.Variant
+
+	if playlistInfo.IsMaster {
+		logger.Info("parsed master playlist",
+			"variants", len(playlistInfo.Variants),
+			"renditions", len(playlistInfo.Renditions),
+			"targetDuration", playlistInfo.TargetDuration,
+		)
+		playlistVariants = playlistInfo.Variants
+	} else {
+		logger.Info("parsed media playlist",
+			"segments", len(playlistInfo.Segments),
+			"targetDuration", playlistInfo.TargetDuration,
+		)
+
+		// Wrap single media playlist as a single variant
+		playlistVariants = []variant.Variant{
+			{
+				Bandwidth:      0, // Unknown for single media playlist
+				Resolution:     "",
+				Codecs:         "",
+				PlaylistURL:    sourceURL,
+				Segments:       playlistInfo.Segments,
+				TargetDuration: playlistInfo.TargetDuration,
+				MediaSequence:  playlistInfo.MediaSequence,
+				Version:        playlistInfo.Version,
+				HeaderTags:     playlistInfo.HeaderTags,
+			},
+		}
+	}
+
+	// Saved sources list the rendition playlists after the variants; the
+	// renditions follow the variants they belong to
+	sources = slices.DeleteFunc(slices.Clone(sources), func(source string) bool {
+		return slices.Contains(variant.MediaSources(playlistInfo.Renditions), source)
+	})
+	playlistVariants, err = selectVariants(playlistVariants, opts.variants, sources, logger)
+	if err != nil {
+		return nil, nil, server.OriginFetch{}, err
+	}
+	renditions := variant.Referenced(playlistInfo.Renditions, playlistVariants)
+
+	// Relative segments of a local source resolve to sibling files, which
+	// only players on this machine can open
+	if n := localSegments(playlistVariants); n > 0 {
+		logger.Warn("segments resolve to local file:// URLs that HTTP players cannot fetch",
+			"segments", n,
+			"hint", "serve the fixture directory over HTTP and pass its URL as --base-url",
+		)
+	}
+
+	// Apply loop-after and --loop-segments to each variant if specified;
+	// --loop-bytes needs segment sizes and is applied after probing
+	if limits.duration > 0 || limits.segments > 0 {
+		// Cut every variant at the same loop duration where possible
+		var matched []int
+		if limits.duration > 0 && len(playlistVariants) > 1 {
+			matched = matchLoopDurations(playlistVariants, limits.duration)
+			if matched == nil {
+				logger.Warn("variants share no loop point near --loop-after; trimming each variant independently",
+					"duration", limits.duration,
+					"tolerance", loopMatchTolerance,
+				)
+			}
+		}
+
+		variantsWithSubset := make([]variant.Variant, len(playlistVariants))
+		for i, v := range playlistVariants {
+			variantsWithSubset[i] = v
+			var subset []segment.Segment
+			if matched != nil {
+				subset = v.Segments[:matched[i]]
+			} else {
+				subset = calculateSegmentSubset(v.Segments, limits.duration)
+			}
+			subset = limitSegmentCount(subset, limits.segments)
+			variantsWithSubset[i].Segments = subset
+			logger.Info("applied loop limits to variant",
+				"variantIndex", i,
+				"originalSegments", len(v.Segments),
+				"includedSegments", len(subset),
+				"duration", limits.duration,
+				"maxSegments", limits.segments,
+			)
+		}
+		playlistVariants = variantsWithSubset
+
+		// Renditions are cut at the loop duration on their own
+		renditionsWithSubset := make([]variant.Rendition, len(renditions))
+		for i, r := range renditions {
+			renditionsWithSubset[i] = r
+			if !r.HasMedia() {
+				continue
+			}
+			subset := limitSegmentCount(calculateSegmentSubset(r.Media.Segments, limits.duration), limits.segments)
+			renditionsWithSubset[i].Media.Segments = subset
+			logger.Info("applied loop limits to rendition",
+				"renditionIndex", i,
+				"originalSegments", len(r.Media.Segments),
+				"includedSegments", len(subset),
+			)
+		}
+		renditions = renditionsWithSubset
+	}
+
+	// Measure real segment sizes and bitrates if requested
+	if opts.probe {
+		segmentCount := 0
+		for _, v := range playlistVariants {
+			segmentCount += len(v.Segments)
+		}
+		logger.Info("probing segments", "segments", segmentCount, "concurrency", opts.probeConc)
+
+		probed, summary, err := probe.Segments(context.Background(), playlistVariants, probe.Options{
+			Client:      client,
+			Concurrency: opts.probeConc,
+		}, logger)
+		if err != nil {
+			return nil, nil, server.OriginFetch{}, fmt.Errorf("failed to probe segments: %w", err)
+		}
+		logger.Info("probed segments", "probed", summary.Probed, "failed", summary.Failed)
+
+		for i := range probed {
+			if opts.probeBW && probed[i].MeasuredBandwidth > 0 {
+				probed[i].Bandwidth = probed[i].MeasuredBandwidth
+			}
+		}
+		playlistVariants = probed
+	}
+
+	if limits.bytes > 0 {
+		for i, v := range playlistVariants {
+			subset := limitSegmentBytes(v.Segments, limits.bytes)
+			var total int64
+			unknown := 0
+			for _, seg := range subset {
+				total += seg.Size
+				if seg.Size == 0 {
+					unknown++
+				}
+			}
+			if unknown > 0 {
+				logger.Warn("segments with unknown size count as zero bytes toward --loop-bytes",
+					"variantIndex", i,
+					"segments", unknown,
+				)
+			}
+			playlistVariants[i].Segments = subset
+			logger.Info("applied loop-bytes to variant",
+				"variantIndex", i,
+				"originalSegments", len(v.Segments),
+				"includedSegments", len(subset),
+				"bytes", total,
+				"maxBytes", limits.bytes,
+			)
+		}
+	}
+
+	warnLoopDurationMismatch(playlistVariants, logger)
+
+	// Fail fast on dead or corrupt segments rather than letting players find them
+	if opts.verify {
+		logger.Info("verifying source segments", "sample", opts.verifyN, "checkFormat", opts.verifyFmt)
+
+		report, err := probe.Verify(context.Background(), playlistVariants, probe.VerifyOptions{
+			Client:      client,
+			Concurrency: opts.probeConc,
+			Sample:      opts.verifyN,
+			CheckFormat: opts.verifyFmt,
+		})
+		if err != nil {
+			return nil, nil, server.OriginFetch{}, fmt.Errorf("failed to verify source: %w", err)
+		}
+
+		failed := report.Failed()
+		for _, res := range failed {
+			logger.Error("segment failed verification",
+				"variant", res.Variant,
+				"index", res.Index,
+				"url", res.URL,
+				"error", res.Error,
+			)
+		}
+		if len(failed) > 0 {
+			report.WriteText(os.Stderr)
+			return nil, nil, server.OriginFetch{}, fmt.Errorf("source verification failed: %d of %d segments", len(failed), len(report.Results))
+		}
+		logger.Info("source verified", "segments", len(report.Results))
+	}
+
+	return playlistVariants, renditions, fetch, nil
+}
+
+// sourceCheck returns a health check that refetches the source playlist, or
+// nil if the source cannot be refetched: stdin is consumed at startup and a
+// replayed recording is offline by design.
+func sourceCheck(opts options, client *http.Client) func() error {
+	if opts.playlistURL == stdinSource || opts.replayDir != "" {
+		return nil
+	}
+
+	if path, ok := parser.LocalPath(opts.playlistURL); ok {
+		return func() error {
+			_, err := os.Stat(path)
+			return err
+		}
+	}
+
+	return func() error {
+		resp, err := client.Get(opts.playlistURL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("source playlist returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// parseFile parses a local playlist file, resolving relative URIs against
+// baseURL.
+func parseFile(p *parser.Parser, path, baseURL string) (*parser.PlaylistInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return p.ParseReader(f, baseURL)
+}
+
+// selectVariants returns the source variants to serve, in the order of their
+// /variant/N/ indices. The indices of --variants refer to positions in the
+// source, which a reordered ladder changes, so sources, the playlist URLs of
+// the variants served before, take precedence: they pin the mapping across
+// restarts and source edits. If a variant of sources is gone, the mapping
+// starts over from --variants.
+func selectVariants(variants []variant.Variant, indices []int, sources []string, logger *slog.Logger) ([]variant.Variant, error) {
+	if sources != nil {
+		arranged, err := variant.Arrange(variants, sources)
+		if err == nil {
+			if indices != nil && !slices.Equal(sources, selectedSources(variants, indices)) {
+				logger.Info("keeping the saved variant mapping instead of --variants",
+					"sources", sources,
+					"hint", "remove the --state-file to apply --variants",
+				)
+			}
+			return arranged, nil
+		}
+		logger.Warn("saved variant mapping does not match the source, applying --variants", "error", err)
+	}
+	if indices == nil {
+		return variants, nil
+	}
+	selected, err := variant.Select(variants, indices)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --variants: %w", err)
+	}
+	logger.Info("selected variants", "indices", indices, "variants", len(selected))
+	return selected, nil
+}
+
+// selectedSources returns the sources --variants selects, or nil if its
+// indices are out of range.
+func selectedSources(variants []variant.Variant, indices []int) []string {
+	selected, err := variant.Select(variants, indices)
+	if err != nil {
+		return nil
+	}
+	return variant.Sources(selected)
+}
+
+// clusterStateTimeout bounds how long a follower waits for the leader to
+// publish the variant mapping.
+const clusterStateTimeout = 10 * time.Second
+
+// clusterSources returns the playlist URLs of the variants the cluster
+// serves, in order, or nil if the leader has not published them.
+func clusterSources(clusterMgr *cluster.Manager, logger *slog.Logger) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), clusterStateTimeout)
+	defer cancel()
+	state, err := clusterMgr.WaitForState(ctx)
+	if err != nil {
+		logger.Warn("cluster state not initialized, using the local variant mapping", "error", err)
+		return nil
+	}
+
+	sources := make([]string, len(state.Variants))
+	for i, vs := range state.Variants {
+		if vs.Source == "" {
+			// Initialized by a node that does not record the mapping
+			return nil
+		}
+		sources[i] = vs.Source
+	}
+	return sources
+}
+
+// compatibleRenditions returns the renditions the playlist can loop with
+// opts, dropping the others with a warning: DASH and Smooth Streaming
+// support none, and the debug subtitles replace the subtitle renditions.
+func compatibleRenditions(opts options, renditions []variant.Rendition, logger *slog.Logger) []variant.Rendition {
+	if len(renditions) == 0 {
+		return nil
+	}
+	if opts.dash || opts.smooth {
+		logger.Warn("alternate renditions are not supported with DASH or Smooth Streaming, dropping them", "renditions", len(renditions))
+		return nil
+	}
+	if opts.debugSubs {
+		kept := slices.DeleteFunc(slices.Clone(renditions), func(r variant.Rendition) bool {
+			return r.Type == variant.RenditionSubtitles
+		})
+		if dropped := len(renditions) - len(kept); dropped > 0 {
+			logger.Warn("debug subtitles replace the subtitle renditions, dropping them", "renditions", dropped)
+		}
+		renditions = kept
+	}
+	for i, r := range renditions {
+		logger.Info("rendition",
+			"index", i,
+			"type", r.Type,
+			"group", r.GroupID,
+			"name", r.Name,
+			"segments", len(r.Media.Segments),
+		)
+	}
+	return renditions
+}
+
+// localSegments returns the number of segments of variants with file://
+// URLs.
+func localSegments(variants []variant.Variant) int {
+	n := 0
+	for _, v := range variants {
+		for _, seg := range v.Segments {
+			if _, ok := parser.LocalPath(seg.URL); ok {
+				n++
+			}
+		}
+	}
+	return n
 }
 
 // calculateSegmentSubset returns a subset of segments that fit within the specified duration.
 // It sums segment durations from the start until the threshold is reached.
 // A segment is included if adding it doesn't exceed the threshold by more than 50%.
 // Returns at least 1 segment even if the first segment exceeds the duration.
+//
+// Byte-range sub-segments of one resource (consecutive segments sharing a URL,
+// such as the fragments of a single fMP4 file) are kept or dropped together,
+// and the rules above apply to each such group as a whole. A loop therefore
+// never ends part way through a resource, and every pass plays a contiguous,
+// gap-free timeline.
 func calculateSegmentSubset(segments []segment.Segment, maxDuration time.Duration) []segment.Segment {
 	if len(segments) == 0 {
 		return segments
@@ -327,34 +2057,252 @@ func calculateSegmentSubset(segments []segment.Segment, maxDuration time.Duratio
 
 	maxDurationSeconds := maxDuration.Seconds()
 	var totalDuration float64
-	var result []segment.Segment
+	end := 0
+
+	for end < len(segments) {
+		groupEnd := byteRangeGroupEnd(segments, end)
+		var groupDuration float64
+		for _, seg := range segments[end:groupEnd] {
+			groupDuration += seg.Duration
+		}
+
+		// Always include at least the first group
+		newTotal := totalDuration + groupDuration
+		if end > 0 && newTotal > maxDurationSeconds {
+			// Would exceed threshold - include it anyway only if it
+			// doesn't exceed by more than 50%, then stop
+			if newTotal-maxDurationSeconds <= maxDurationSeconds*0.5 {
+				end = groupEnd
+			}
+			break
+		}
+
+		end = groupEnd
+		totalDuration = newTotal
+	}
+
+	return segments[:end]
+}
+
+// byteRangeGroupEnd returns the index just past the byte-range group that
+// starts at start: the run of consecutive byte-range segments sharing its URL.
+// A segment without a byte range is a group of its own.
+func byteRangeGroupEnd(segments []segment.Segment, start int) int {
+	end := start + 1
+	if segments[start].ByteRange == "" {
+		return end
+	}
+	for end < len(segments) && segments[end].ByteRange != "" && segments[end].URL == segments[start].URL {
+		end++
+	}
+	return end
+}
+
+// loopMatchTolerance is how far apart, in seconds, variant loop durations may
+// be and still count as equal. It absorbs EXTINF rounding such as 6.006
+// versus 6.0 without letting renditions drift noticeably per loop.
+const loopMatchTolerance = 0.1
+
+// loopCut is a place where a variant can loop: after segments segments,
+// which together last duration seconds.
+type loopCut struct {
+	segments int
+	duration float64
+}
+
+// loopCuts returns every place segments can be cut for looping, which is the
+// end of each byte-range group, in order.
+func loopCuts(segments []segment.Segment) []loopCut {
+	var cuts []loopCut
+	var total float64
+	for start := 0; start < len(segments); {
+		end := byteRangeGroupEnd(segments, start)
+		for _, seg := range segments[start:end] {
+			total += seg.Duration
+		}
+		cuts = append(cuts, loopCut{segments: end, duration: total})
+		start = end
+	}
+	return cuts
+}
+
+// matchLoopDurations picks a cut point for every variant so that all loops
+// last the same time. Cutting each variant independently at maxDuration gives
+// loops of different lengths when renditions use different segment
+// durations, and the renditions then drift further apart on every pass.
+//
+// The candidates are the cut points of the first variant up to the 50%
+// overage calculateSegmentSubset allows. A candidate qualifies when every
+// other variant has a cut point within loopMatchTolerance of it, and the
+// qualifying candidate closest to maxDuration wins, the shorter one on ties.
+// It returns the number of segments to keep per variant, or nil if the
+// variants have no common cut point in range.
+func matchLoopDurations(variants []variant.Variant, maxDuration time.Duration) []int {
+	if len(variants) == 0 || maxDuration <= 0 {
+		return nil
+	}
+
+	cuts := make([][]loopCut, len(variants))
+	for i, v := range variants {
+		cuts[i] = loopCuts(v.Segments)
+	}
 
-	for i, seg := range segments {
-		// Always include at least the first segment
-		if i == 0 {
-			result = append(result, seg)
-			totalDuration += seg.Duration
+	limit := maxDuration.Seconds()
+	var best []int
+	bestDistance := math.Inf(1)
+
+	for k, candidate := range cuts[0] {
+		if k > 0 && candidate.duration > limit*1.5 {
+			break
+		}
+		distance := math.Abs(candidate.duration - limit)
+		if distance >= bestDistance {
 			continue
 		}
 
-		// Check if adding this segment would exceed the threshold
-		newTotal := totalDuration + seg.Duration
-		if newTotal <= maxDurationSeconds {
-			// Within threshold, include it
-			result = append(result, seg)
-			totalDuration = newTotal
-		} else {
-			// Would exceed threshold - check if we should include it anyway
-			// Include if it doesn't exceed by more than 50%
-			exceedAmount := newTotal - maxDurationSeconds
-			if exceedAmount <= (maxDurationSeconds * 0.5) {
-				result = append(result, seg)
-				totalDuration = newTotal
-			}
-			// Stop processing further segments
+		counts := []int{candidate.segments}
+		for _, other := range cuts[1:] {
+			j := sort.Search(len(other), func(j int) bool {
+				return other[j].duration >= candidate.duration-loopMatchTolerance
+			})
+			if j == len(other) || other[j].duration > candidate.duration+loopMatchTolerance {
+				counts = nil
+				break
+			}
+			counts = append(counts, other[j].segments)
+		}
+		if counts != nil {
+			best, bestDistance = counts, distance
+		}
+	}
+
+	return best
+}
+
+// warnLoopDurationMismatch logs a warning when the variants' loops differ in
+// length by more than loopMatchTolerance, since players switching renditions
+// would then see content jump by the difference on every loop.
+func warnLoopDurationMismatch(variants []variant.Variant, logger *slog.Logger) {
+	if len(variants) < 2 {
+		return
+	}
+
+	durations := make([]float64, len(variants))
+	shortest, longest := math.Inf(1), 0.0
+	for i, v := range variants {
+		for _, seg := range v.Segments {
+			durations[i] += seg.Duration
+		}
+		shortest = min(shortest, durations[i])
+		longest = max(longest, durations[i])
+	}
+
+	if longest-shortest > loopMatchTolerance {
+		logger.Warn("variant loop durations differ; renditions will drift apart on every loop",
+			"loopDurations", durations,
+			"spread", longest-shortest,
+			"hint", "pick a --loop-after value that all segment durations divide evenly",
+		)
+	}
+}
+
+// loopLimits bounds how much of each variant's content is used before
+// looping. Zero values mean no limit; when several are set, the most
+// restrictive one wins.
+type loopLimits struct {
+	duration time.Duration
+	segments int
+	bytes    int64
+}
+
+// limitSegmentCount returns at most the first maxSegments segments, cut at
+// the end of a byte-range group as in calculateSegmentSubset. At least the
+// first group is returned, even if it holds more than maxSegments segments.
+// A maxSegments of 0 returns all segments.
+func limitSegmentCount(segments []segment.Segment, maxSegments int) []segment.Segment {
+	if maxSegments <= 0 || maxSegments >= len(segments) {
+		return segments
+	}
+
+	end := byteRangeGroupEnd(segments, 0)
+	for end < len(segments) {
+		next := byteRangeGroupEnd(segments, end)
+		if next > maxSegments {
+			break
+		}
+		end = next
+	}
+	return segments[:end]
+}
+
+// limitSegmentBytes returns the longest prefix of segments whose total Size
+// does not exceed maxBytes, cut at the end of a byte-range group as in
+// calculateSegmentSubset. Unlike the duration limit, the budget is never
+// exceeded, except that at least the first group is always returned.
+func limitSegmentBytes(segments []segment.Segment, maxBytes int64) []segment.Segment {
+	if maxBytes <= 0 || len(segments) == 0 {
+		return segments
+	}
+
+	var total int64
+	end := 0
+	for end < len(segments) {
+		groupEnd := byteRangeGroupEnd(segments, end)
+		for _, seg := range segments[end:groupEnd] {
+			total += seg.Size
+		}
+		if end > 0 && total > maxBytes {
 			break
 		}
+		end = groupEnd
+	}
+	return segments[:end]
+}
+
+// parseByteSize parses a size such as "1048576", "500MB" or "2GiB". Decimal
+// suffixes (KB, MB, GB, TB) are powers of 1000; binary suffixes (KiB, MiB,
+// GiB, TiB) are powers of 1024.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') {
+		i--
+	}
+	number, unit := s[:i], strings.ToUpper(strings.TrimSpace(s[i:]))
+
+	multipliers := map[string]int64{
+		"": 1, "B": 1,
+		"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+		"KIB": 1 << 10, "MIB": 1 << 20, "GIB": 1 << 30, "TIB": 1 << 40,
+	}
+	mult, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", s[i:])
 	}
 
-	return result
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * mult, nil
+}
+
+// reloadable reports why the source cannot be reloaded and spliced into
+// the live playlist, or nil if it can. The standby of a pair follows the
+// primary's positions, which a splice on either node would invalidate.
+func reloadable(opts options, lp *playlist.Playlist) error {
+	if opts.standby != nil {
+		return fmt.Errorf("reloading the source is not supported in standby pair mode")
+	}
+	return lp.CanSplice()
+}
+
+// scenarioTarget applies scenario actions: stalls, ad breaks and key
+// rotations to the playlist, variant failures to the server.
+type scenarioTarget struct {
+	*playlist.Playlist
+	*server.Server
 }
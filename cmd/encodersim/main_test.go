@@ -1,10 +1,20 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/parser"
 	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
 )
 
 func TestCalculateSegmentSubset(t *testing.T) {
@@ -193,3 +203,349 @@ func TestCalculateSegmentSubset_PreservesSegmentFields(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculateSegmentSubset_KeepsByteRangeGroups(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "a.ts", Duration: 4.0, ByteRange: "1000@0"},
+		{URL: "a.ts", Duration: 4.0, ByteRange: "1000@1000"},
+		{URL: "a.ts", Duration: 4.0, ByteRange: "1000@2000"},
+		{URL: "b.ts", Duration: 4.0, ByteRange: "1000@0"},
+		{URL: "b.ts", Duration: 4.0, ByteRange: "1000@1000"},
+		{URL: "c.ts", Duration: 4.0},
+	}
+
+	tests := []struct {
+		name        string
+		maxDuration time.Duration
+		wantCount   int
+	}{
+		{name: "inside first group keeps whole group", maxDuration: 5 * time.Second, wantCount: 3},
+		{name: "ending exactly on a group", maxDuration: 12 * time.Second, wantCount: 3},
+		{name: "second group within 50% overage", maxDuration: 16 * time.Second, wantCount: 5},
+		{name: "second group beyond 50% overage", maxDuration: 13 * time.Second, wantCount: 3},
+		{name: "plain segment after groups", maxDuration: 24 * time.Second, wantCount: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := calculateSegmentSubset(segments, tt.maxDuration)
+			if len(result) != tt.wantCount {
+				t.Errorf("calculateSegmentSubset() returned %d segments, want %d", len(result), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestLocalSegments(t *testing.T) {
+	variants := []variant.Variant{
+		{Segments: []segment.Segment{{URL: "file:///fixtures/seg0.ts"}, {URL: "https://cdn.example.com/seg1.ts"}}},
+		{Segments: []segment.Segment{{URL: "file:///fixtures/low/seg0.ts"}}},
+	}
+	if got := localSegments(variants); got != 2 {
+		t.Errorf("localSegments() = %d, want 2", got)
+	}
+}
+
+func TestSelectVariants(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	low := variant.Variant{PlaylistURL: "low.m3u8"}
+	mid := variant.Variant{PlaylistURL: "mid.m3u8"}
+	high := variant.Variant{PlaylistURL: "high.m3u8"}
+	source := []variant.Variant{low, mid, high}
+
+	tests := []struct {
+		name    string
+		source  []variant.Variant
+		indices []int
+		sources []string
+		want    []string
+		wantErr bool
+	}{
+		{"all", source, nil, nil, []string{"low.m3u8", "mid.m3u8", "high.m3u8"}, false},
+		{"filtered and reordered", source, []int{2, 0}, nil, []string{"high.m3u8", "low.m3u8"}, false},
+		{"out of range", source, []int{3}, nil, nil, true},
+		{"saved mapping survives a reordered source", []variant.Variant{high, mid, low}, []int{2, 0}, []string{"high.m3u8", "low.m3u8"}, []string{"high.m3u8", "low.m3u8"}, false},
+		{"stale mapping falls back to --variants", []variant.Variant{mid, high}, []int{1}, []string{"low.m3u8"}, []string{"high.m3u8"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectVariants(tt.source, tt.indices, tt.sources, logger)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("selectVariants() should fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectVariants() error = %v", err)
+			}
+			if sources := variant.Sources(got); !slices.Equal(sources, tt.want) {
+				t.Errorf("selectVariants() = %v, want %v", sources, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompatibleRenditions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	renditions := []variant.Rendition{
+		{Type: variant.RenditionAudio, Name: "English"},
+		{Type: variant.RenditionSubtitles, Name: "French"},
+	}
+
+	tests := []struct {
+		name string
+		opts options
+		want []string
+	}{
+		{"all", options{}, []string{"English", "French"}},
+		{"dash", options{dash: true}, nil},
+		{"smooth", options{smooth: true}, nil},
+		{"debug subtitles", options{debugSubs: true}, []string{"English"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range compatibleRenditions(tt.opts, renditions, logger) {
+				got = append(got, r.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("compatibleRenditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitSegmentCount(t *testing.T) {
+	segments := []segment.Segment{{URL: "seg0.ts"}, {URL: "seg1.ts"}, {URL: "seg2.ts"}}
+
+	// Two byte-range groups of three and two fragments, then a plain segment
+	ranged := []segment.Segment{
+		{URL: "a.mp4", ByteRange: "100@0"},
+		{URL: "a.mp4", ByteRange: "100@100"},
+		{URL: "a.mp4", ByteRange: "100@200"},
+		{URL: "b.mp4", ByteRange: "100@0"},
+		{URL: "b.mp4", ByteRange: "100@100"},
+		{URL: "c.ts"},
+	}
+
+	tests := []struct {
+		name        string
+		segments    []segment.Segment
+		maxSegments int
+		wantCount   int
+	}{
+		{name: "no limit", segments: segments, maxSegments: 0, wantCount: 3},
+		{name: "one", segments: segments, maxSegments: 1, wantCount: 1},
+		{name: "two", segments: segments, maxSegments: 2, wantCount: 2},
+		{name: "more than there are", segments: segments, maxSegments: 10, wantCount: 3},
+		{name: "inside the first group keeps it whole", segments: ranged, maxSegments: 1, wantCount: 3},
+		{name: "group boundary", segments: ranged, maxSegments: 3, wantCount: 3},
+		{name: "inside the second group drops it", segments: ranged, maxSegments: 4, wantCount: 3},
+		{name: "after the second group", segments: ranged, maxSegments: 5, wantCount: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitSegmentCount(tt.segments, tt.maxSegments); len(got) != tt.wantCount {
+				t.Errorf("limitSegmentCount(%d) returned %d segments, want %d", tt.maxSegments, len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestLimitSegmentBytes(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Size: 400},
+		{URL: "seg1.ts", Size: 400},
+		{URL: "seg2.ts", Size: 400},
+	}
+
+	// A byte-range group of 300 bytes, one of 200 bytes, then 400 bytes
+	ranged := []segment.Segment{
+		{URL: "a.mp4", ByteRange: "100@0", Size: 100},
+		{URL: "a.mp4", ByteRange: "100@100", Size: 100},
+		{URL: "a.mp4", ByteRange: "100@200", Size: 100},
+		{URL: "b.mp4", ByteRange: "100@0", Size: 100},
+		{URL: "b.mp4", ByteRange: "100@100", Size: 100},
+		{URL: "c.ts", Size: 400},
+	}
+
+	tests := []struct {
+		name      string
+		segments  []segment.Segment
+		maxBytes  int64
+		wantCount int
+	}{
+		{name: "no limit", segments: segments, maxBytes: 0, wantCount: 3},
+		{name: "exact fit", segments: segments, maxBytes: 800, wantCount: 2},
+		{name: "never exceeds budget", segments: segments, maxBytes: 1199, wantCount: 2},
+		{name: "everything fits", segments: segments, maxBytes: 5000, wantCount: 3},
+		{name: "first segment over budget", segments: segments, maxBytes: 100, wantCount: 1},
+		{name: "first group over budget is kept whole", segments: ranged, maxBytes: 150, wantCount: 3},
+		{name: "second group does not fit", segments: ranged, maxBytes: 450, wantCount: 3},
+		{name: "second group fits", segments: ranged, maxBytes: 500, wantCount: 5},
+		{name: "all groups fit", segments: ranged, maxBytes: 900, wantCount: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitSegmentBytes(tt.segments, tt.maxBytes); len(got) != tt.wantCount {
+				t.Errorf("limitSegmentBytes(%d) returned %d segments, want %d", tt.maxBytes, len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "1048576", want: 1048576},
+		{in: "500MB", want: 500_000_000},
+		{in: "2GiB", want: 2 << 30},
+		{in: "64 kib", want: 64 << 10},
+		{in: "10B", want: 10},
+		{in: "1.5GB", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "10XB", wantErr: true},
+		{in: "99999999999TB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseByteSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+// uniformSegments returns n segments of the given duration.
+func uniformSegments(n int, duration float64) []segment.Segment {
+	segments := make([]segment.Segment, n)
+	for i := range segments {
+		segments[i] = segment.Segment{URL: fmt.Sprintf("seg%d.ts", i), Duration: duration}
+	}
+	return segments
+}
+
+func TestMatchLoopDurations(t *testing.T) {
+	packed := []segment.Segment{
+		{URL: "a.mp4", Duration: 4.0, ByteRange: "100@0"},
+		{URL: "a.mp4", Duration: 4.0, ByteRange: "100@100"},
+		{URL: "a.mp4", Duration: 4.0, ByteRange: "100@200"},
+		{URL: "b.mp4", Duration: 4.0, ByteRange: "100@0"},
+		{URL: "b.mp4", Duration: 4.0, ByteRange: "100@100"},
+		{URL: "b.mp4", Duration: 4.0, ByteRange: "100@200"},
+	}
+
+	tests := []struct {
+		name        string
+		variants    [][]segment.Segment
+		maxDuration time.Duration
+		want        []int
+	}{
+		{
+			name:        "mixed segment durations meet at a common point",
+			variants:    [][]segment.Segment{uniformSegments(10, 6.0), uniformSegments(15, 4.0)},
+			maxDuration: 20 * time.Second,
+			want:        []int{4, 6}, // 24s each; independent cuts give 24s and 20s
+		},
+		{
+			name:        "closest common point below the limit",
+			variants:    [][]segment.Segment{uniformSegments(10, 6.0), uniformSegments(15, 4.0)},
+			maxDuration: 14 * time.Second,
+			want:        []int{2, 3},
+		},
+		{
+			name:        "EXTINF rounding within tolerance",
+			variants:    [][]segment.Segment{uniformSegments(10, 6.006), uniformSegments(10, 6.0)},
+			maxDuration: 30 * time.Second,
+			want:        []int{5, 5},
+		},
+		{
+			name:        "byte-range groups are not split",
+			variants:    [][]segment.Segment{packed, uniformSegments(6, 4.0)},
+			maxDuration: 8 * time.Second,
+			want:        []int{3, 3},
+		},
+		{
+			name:        "no common point within the overage",
+			variants:    [][]segment.Segment{uniformSegments(10, 6.0), uniformSegments(10, 5.0)},
+			maxDuration: 10 * time.Second,
+			want:        nil,
+		},
+		{
+			name:        "no limit",
+			variants:    [][]segment.Segment{uniformSegments(3, 6.0), uniformSegments(3, 6.0)},
+			maxDuration: 0,
+			want:        nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variants := make([]variant.Variant, len(tt.variants))
+			for i, segments := range tt.variants {
+				variants[i].Segments = segments
+			}
+			got := matchLoopDurations(variants, tt.maxDuration)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matchLoopDurations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/live.m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer server.Close()
+
+	existing := filepath.Join(t.TempDir(), "vod.m3u8")
+	if err := os.WriteFile(existing, []byte("#EXTM3U\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	existingURL, _ := parser.FileURL(existing)
+	missingURL, _ := parser.FileURL(existing + ".gone")
+
+	tests := []struct {
+		name    string
+		opts    options
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "stdin has no check", opts: options{playlistURL: stdinSource}, wantNil: true},
+		{name: "replay has no check", opts: options{playlistURL: server.URL + "/live.m3u8", replayDir: "rec"}, wantNil: true},
+		{name: "reachable URL", opts: options{playlistURL: server.URL + "/live.m3u8"}},
+		{name: "URL returning 404", opts: options{playlistURL: server.URL + "/gone.m3u8"}, wantErr: true},
+		{name: "existing file", opts: options{playlistURL: existingURL}},
+		{name: "missing file", opts: options{playlistURL: missingURL}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := sourceCheck(tt.opts, server.Client())
+			if (check == nil) != tt.wantNil {
+				t.Fatalf("sourceCheck() nil = %v, want %v", check == nil, tt.wantNil)
+			}
+			if check == nil {
+				return
+			}
+			if err := check(); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
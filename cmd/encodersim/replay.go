@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	"github.com/agleyzer/encodersim/internal/replay"
+)
+
+// runReplay implements the replay subcommand.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var (
+		pathRe  = fs.String("path", "", "Replay only requests whose path matches this regular expression, e.g. '^/variant/1/' for one channel")
+		speed   = fs.Float64("speed", 1, "Replay speed: 2 sends the requests twice as fast as recorded")
+		report  = fs.String("report", "", "Write a JSON report to this file ('-' for stdout)")
+		verbose = fs.Bool("verbose", false, "Enable verbose logging")
+	)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s replay [options] <mirror> <target-url>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Replays the requests saved with --mirror (a directory, s3://bucket/prefix or an index file) against another origin with their original timing.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s replay ./served http://packager.example.com\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s replay --path '^/variant/1/' --speed 4 --report report.json ./served http://localhost:9090\n", os.Args[0])
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("mirror and target URL are required")
+	}
+	if *speed <= 0 {
+		return fmt.Errorf("--speed must be positive")
+	}
+
+	var filter *regexp.Regexp
+	if *pathRe != "" {
+		var err error
+		if filter, err = regexp.Compile(*pathRe); err != nil {
+			return fmt.Errorf("invalid --path: %w", err)
+		}
+	}
+	entries, err := replay.Load(context.Background(), fs.Arg(0), filter)
+	if err != nil {
+		return err
+	}
+
+	logLevel := slog.LevelInfo
+	if *verbose {
+		logLevel = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("replaying requests", "requests", len(entries), "target", fs.Arg(1), "speed", *speed)
+	result, err := replay.Run(ctx, replay.Config{
+		Target:  fs.Arg(1),
+		Entries: entries,
+		Speed:   *speed,
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	if *report != "-" {
+		if err := result.WriteText(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if *report != "" {
+		if err := writeReplayReport(result, *report); err != nil {
+			return fmt.Errorf("write report: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeReplayReport writes the JSON report to path, or stdout if path is
+// "-".
+func writeReplayReport(result *replay.Result, path string) error {
+	if path == "-" {
+		return result.WriteJSON(os.Stdout)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := result.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,145 @@
+// Package admin authenticates requests to the admin endpoints with bearer
+// tokens (--admin-tokens), each granting a role.
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Role is what a token may do with the admin endpoints.
+type Role string
+
+const (
+	// RoleViewer may read the admin endpoints.
+	RoleViewer Role = "viewer"
+
+	// RoleOperator may also change the simulator through them.
+	RoleOperator Role = "operator"
+)
+
+// Allows reports whether r grants at least the permissions of required.
+func (r Role) Allows(required Role) bool {
+	switch r {
+	case RoleOperator:
+		return true
+	case RoleViewer:
+		return required == RoleViewer
+	default:
+		return false
+	}
+}
+
+// Token grants a role to whoever presents its secret.
+type Token struct {
+	// Name identifies the token holder in the request log.
+	Name string
+
+	// Secret is presented as "Authorization: Bearer SECRET".
+	Secret string
+
+	Role Role
+}
+
+// tokenFile is the YAML form of a tokens file.
+type tokenFile struct {
+	Tokens []struct {
+		Name   string `yaml:"name"`
+		Secret string `yaml:"token"`
+		Role   Role   `yaml:"role"`
+	} `yaml:"tokens"`
+}
+
+// Load reads and parses a tokens file.
+func Load(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// Parse parses YAML tokens:
+//
+//	tokens:
+//	  - name: alice
+//	    token: 3c9a0f...
+//	    role: operator   # or viewer
+//
+// Names and secrets must be unique.
+func Parse(data []byte) ([]Token, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var file tokenFile
+	if err := dec.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("tokens file is empty")
+		}
+		return nil, fmt.Errorf("parse tokens: %w", err)
+	}
+	if len(file.Tokens) == 0 {
+		return nil, fmt.Errorf("no tokens defined")
+	}
+
+	names := make(map[string]bool)
+	secrets := make(map[string]bool)
+	tokens := make([]Token, 0, len(file.Tokens))
+	for i, f := range file.Tokens {
+		if f.Name == "" {
+			return nil, fmt.Errorf("token %d: name is required", i+1)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("token %q defined twice", f.Name)
+		}
+		names[f.Name] = true
+		if f.Secret == "" {
+			return nil, fmt.Errorf("token %q: token is required", f.Name)
+		}
+		if secrets[f.Secret] {
+			return nil, fmt.Errorf("token %q: token is already used by another name", f.Name)
+		}
+		secrets[f.Secret] = true
+		if f.Role != RoleViewer && f.Role != RoleOperator {
+			return nil, fmt.Errorf("token %q: unknown role %q (want %s or %s)", f.Name, f.Role, RoleViewer, RoleOperator)
+		}
+		tokens = append(tokens, Token{Name: f.Name, Secret: f.Secret, Role: f.Role})
+	}
+	return tokens, nil
+}
+
+// Tokens authenticates bearer tokens.
+type Tokens struct {
+	tokens []Token
+}
+
+// NewTokens creates a Tokens accepting tokens.
+func NewTokens(tokens []Token) *Tokens {
+	return &Tokens{tokens: tokens}
+}
+
+// Authenticate returns the token of an Authorization header value, which
+// must use the Bearer scheme. Secrets are compared in constant time.
+func (t *Tokens) Authenticate(authorization string) (Token, bool) {
+	scheme, secret, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || secret == "" {
+		return Token{}, false
+	}
+	for _, tok := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(tok.Secret), []byte(secret)) == 1 {
+			return tok, true
+		}
+	}
+	return Token{}, false
+}
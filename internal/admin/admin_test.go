@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tokens, err := Parse([]byte(`
+tokens:
+  - name: alice
+    token: secret-a
+    role: operator
+  - {name: bob, token: secret-b, role: viewer}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Token{
+		{Name: "alice", Secret: "secret-a", Role: RoleOperator},
+		{Name: "bob", Secret: "secret-b", Role: RoleViewer},
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Parse() = %+v, want %+v", tokens, want)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "", "is empty"},
+		{"no tokens", "tokens: []", "no tokens"},
+		{"unknown field", "tokens:\n  - {name: a, token: s, role: viewer, expires: never}", "field expires not found"},
+		{"no name", "tokens:\n  - {token: s, role: viewer}", "name is required"},
+		{"no token", "tokens:\n  - {name: a, role: viewer}", "token is required"},
+		{"no role", "tokens:\n  - {name: a, token: s}", "unknown role"},
+		{"unknown role", "tokens:\n  - {name: a, token: s, role: admin}", "unknown role"},
+		{"duplicate name", "tokens:\n  - {name: a, token: s1, role: viewer}\n  - {name: a, token: s2, role: viewer}", "defined twice"},
+		{"duplicate token", "tokens:\n  - {name: a, token: s, role: viewer}\n  - {name: b, token: s, role: viewer}", "already used"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	if err := os.WriteFile(path, []byte("tokens:\n  - {name: a, token: s, role: root}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("Load() error = %v, want it prefixed with the path", err)
+	}
+}
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role, required Role
+		want           bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{"", RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestTokens_Authenticate(t *testing.T) {
+	tokens := NewTokens([]Token{
+		{Name: "alice", Secret: "secret-a", Role: RoleOperator},
+		{Name: "bob", Secret: "secret-b", Role: RoleViewer},
+	})
+	tests := []struct {
+		authorization string
+		wantName      string
+		wantOK        bool
+	}{
+		{"Bearer secret-a", "alice", true},
+		{"bearer secret-b", "bob", true},
+		{"Bearer secret-c", "", false},
+		{"Basic secret-a", "", false},
+		{"secret-a", "", false},
+		{"Bearer ", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		tok, ok := tokens.Authenticate(tt.authorization)
+		if tok.Name != tt.wantName || ok != tt.wantOK {
+			t.Errorf("Authenticate(%q) = %q, %v, want %q, %v", tt.authorization, tok.Name, ok, tt.wantName, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package audit records who changed the simulator, how and when: calls to
+// the admin API and the actions of scenarios. Entries are published to the
+// event log as EventType, so /events?type=audit serves them as a stream of
+// their own, and optionally appended to a JSON lines file (--audit-log).
+//
+// Post-incident, the audit trail tells faults injected on purpose apart
+// from real bugs.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/events"
+)
+
+// EventType is the type of the events that carry audit entries.
+const EventType = "audit"
+
+// Sources of audit entries.
+const (
+	SourceAPI      = "api"
+	SourceScenario = "scenario"
+)
+
+// Anonymous is the actor of API calls made without an admin token.
+const Anonymous = "anonymous"
+
+// Entry is one audited action.
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	// Actor is who acted: the name of an admin token, Anonymous, or the
+	// name of a scenario.
+	Actor string `json:"actor"`
+
+	// Source is SourceAPI or SourceScenario.
+	Source string `json:"source"`
+
+	// Action is what was done, such as "PUT /network-profile" or
+	// "fail-variant".
+	Action string `json:"action"`
+
+	// Params are the parameters of the action, such as a request body.
+	Params map[string]any `json:"params,omitempty"`
+
+	// Remote is the client address of API calls.
+	Remote string `json:"remote,omitempty"`
+
+	// Status is the HTTP status of API calls, including refused ones.
+	Status int `json:"status,omitempty"`
+}
+
+// Log records audit entries. A nil Log records nothing. It is safe for
+// concurrent use.
+type Log struct {
+	events *events.Log
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// New creates a Log publishing to events, if not nil, and appending to the
+// file at path, if not empty.
+func New(path string, events *events.Log) (*Log, error) {
+	l := &Log{events: events}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open audit log: %w", err)
+		}
+		l.file = f
+	}
+	return l, nil
+}
+
+// Record records e, setting its Time if unset. Only failures to write the
+// file are returned; the event is published regardless.
+func (l *Log) Record(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if l.events != nil {
+		fields := map[string]any{
+			"actor":  e.Actor,
+			"source": e.Source,
+			"action": e.Action,
+		}
+		if e.Params != nil {
+			fields["params"] = e.Params
+		}
+		if e.Remote != "" {
+			fields["remote"] = e.Remote
+		}
+		if e.Status != 0 {
+			fields["status"] = e.Status
+		}
+		l.events.Publish(EventType, e.Actor+": "+e.Action, fields)
+	}
+
+	if l.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encode audit entry: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the audit log file.
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/events"
+)
+
+func TestLog_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	eventLog := events.NewLog(10)
+	l, err := New(path, eventLog)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	entries := []Entry{
+		{Actor: "alice", Source: SourceAPI, Action: "PUT /network-profile", Params: map[string]any{"active": "3g"}, Remote: "10.0.0.1:5000", Status: 200},
+		{Actor: "stall-then-fail", Source: SourceScenario, Action: "fail-variant", Params: map[string]any{"variant": float64(1)}},
+	}
+	for _, e := range entries {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// The file holds one JSON entry per line
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != len(entries) {
+		t.Fatalf("audit log has %d lines, want %d:\n%s", len(lines), len(entries), data)
+	}
+	for i, line := range lines {
+		var got Entry
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if got.Time.IsZero() {
+			t.Errorf("line %d: Expected the time to be set", i+1)
+		}
+		got.Time = entries[i].Time
+		if !reflect.DeepEqual(got, entries[i]) {
+			t.Errorf("line %d = %+v, want %+v", i+1, got, entries[i])
+		}
+	}
+
+	// Every entry is also an event
+	list, _ := eventLog.Since(0)
+	if len(list) != len(entries) {
+		t.Fatalf("published %d events, want %d", len(list), len(entries))
+	}
+	e := list[0]
+	if e.Type != EventType || e.Message != "alice: PUT /network-profile" || e.Fields["status"] != 200 || e.Fields["remote"] != "10.0.0.1:5000" {
+		t.Errorf("event = %+v", e)
+	}
+	if _, ok := list[1].Fields["status"]; ok {
+		t.Errorf("Expected no status for a scenario action, got %+v", list[1])
+	}
+}
+
+func TestLog_Nil(t *testing.T) {
+	var l *Log
+	if err := l.Record(Entry{Actor: "alice"}); err != nil {
+		t.Errorf("Record() on a nil Log error = %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() on a nil Log error = %v", err)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	if _, err := New(filepath.Join(t.TempDir(), "missing", "audit.jsonl"), nil); err == nil {
+		t.Error("New() in a missing directory succeeded")
+	}
+}
@@ -0,0 +1,557 @@
+// Package bench implements a load generator that simulates a population of
+// HLS players with distinct request patterns against an origin.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/sleep"
+
+	"github.com/grafov/m3u8"
+)
+
+// Config configures a bench run.
+type Config struct {
+	// URL is the playlist URL to load (master or media).
+	URL string
+	// Clients is the number of concurrent simulated players.
+	Clients int
+	// Duration is how long the run lasts.
+	Duration time.Duration
+	// RampUp spreads client start times evenly over this period.
+	RampUp time.Duration
+	// Mix is the relative weight of each persona (DefaultMix if nil).
+	Mix Mix
+	// Seed seeds the random source used for variant selection and seeking.
+	Seed int64
+	// HTTPClient is used for all requests (a default client if nil).
+	HTTPClient *http.Client
+	// SLOs are evaluated against the result once the run completes.
+	SLOs []SLO
+}
+
+// Validate checks the configuration and fills in defaults.
+func (c *Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("playlist URL is required")
+	}
+	if c.Clients < 1 {
+		return fmt.Errorf("clients must be at least 1")
+	}
+	if c.Duration <= 0 {
+		return fmt.Errorf("duration must be positive")
+	}
+	if c.RampUp < 0 {
+		return fmt.Errorf("ramp-up must not be negative")
+	}
+	if c.Mix == nil {
+		c.Mix = DefaultMix
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return nil
+}
+
+// RequestType classifies requests for latency and error accounting.
+type RequestType string
+
+const (
+	// RequestMaster is a master playlist fetch.
+	RequestMaster RequestType = "master"
+	// RequestMedia is a media playlist fetch or reload.
+	RequestMedia RequestType = "media"
+	// RequestSegment is a media segment download.
+	RequestSegment RequestType = "segment"
+)
+
+// RequestTypes lists all request types in a stable order.
+var RequestTypes = []RequestType{RequestMaster, RequestMedia, RequestSegment}
+
+// valid reports whether t is a known request type.
+func (t RequestType) valid() bool {
+	for _, rt := range RequestTypes {
+		if t == rt {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonaStats holds request counters for all clients of one persona.
+type PersonaStats struct {
+	Clients          int   `json:"clients"`
+	PlaylistRequests int64 `json:"playlist_requests"`
+	SegmentRequests  int64 `json:"segment_requests"`
+	Errors           int64 `json:"errors"`
+	Bytes            int64 `json:"bytes"`
+	Seeks            int64 `json:"seeks"`
+}
+
+// RequestStats holds counters and the time-to-first-byte latency
+// distribution for one request type.
+type RequestStats struct {
+	Requests int64      `json:"requests"`
+	Errors   int64      `json:"errors"`
+	Latency  *Histogram `json:"latency"`
+}
+
+// Result is the outcome of a bench run.
+type Result struct {
+	Elapsed  time.Duration                 `json:"elapsed"`
+	Mix      string                        `json:"mix"`
+	Personas map[Persona]*PersonaStats     `json:"personas"`
+	Requests map[RequestType]*RequestStats `json:"requests"`
+	SLOs     []SLOResult                   `json:"slos,omitempty"`
+	Pass     bool                          `json:"pass"`
+}
+
+// requestStats returns the stats for one request type, or all types merged
+// when t is empty.
+func (r *Result) requestStats(t RequestType) *RequestStats {
+	if t != "" {
+		if s, ok := r.Requests[t]; ok {
+			return s
+		}
+		return &RequestStats{Latency: NewHistogram()}
+	}
+
+	merged := &RequestStats{Latency: NewHistogram()}
+	for _, s := range r.Requests {
+		merged.Requests += s.Requests
+		merged.Errors += s.Errors
+		merged.Latency.merge(s.Latency)
+	}
+	return merged
+}
+
+// evaluate checks all SLOs and sets Pass accordingly.
+func (r *Result) evaluate(slos []SLO) {
+	r.Pass = true
+	r.SLOs = nil
+	for _, slo := range slos {
+		res := slo.Evaluate(r)
+		r.SLOs = append(r.SLOs, res)
+		if !res.Pass {
+			r.Pass = false
+		}
+	}
+}
+
+// WriteJSON writes the machine-readable report.
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable summary table.
+func (r *Result) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "elapsed %s, mix %s\n", r.Elapsed.Round(time.Millisecond), r.Mix)
+	fmt.Fprintln(tw, "PERSONA\tCLIENTS\tPLAYLISTS\tSEGMENTS\tERRORS\tBYTES\tSEEKS")
+
+	for _, p := range Personas {
+		s, ok := r.Personas[p]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			p, s.Clients, s.PlaylistRequests, s.SegmentRequests, s.Errors, s.Bytes, s.Seeks)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "REQUEST\tCOUNT\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, t := range RequestTypes {
+		s, ok := r.Requests[t]
+		if !ok {
+			continue
+		}
+		h := s.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			t, s.Requests, s.Errors, h.Quantile(0.5), h.Quantile(0.9), h.Quantile(0.99), h.max)
+	}
+
+	if len(r.SLOs) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "SLO\tACTUAL\tRESULT")
+		for _, s := range r.SLOs {
+			verdict := "PASS"
+			if !s.Pass {
+				verdict = "FAIL"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.SLO, s.Actual, verdict)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// Run executes a bench run and blocks until it completes or ctx is canceled.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) (*Result, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	assignment := cfg.Mix.Assign(cfg.Clients)
+	col := &collector{
+		personas: make(map[Persona]*PersonaStats),
+		requests: make(map[RequestType]*RequestStats),
+	}
+	for _, t := range RequestTypes {
+		col.requests[t] = &RequestStats{Latency: NewHistogram()}
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	clientIndex := 0
+	for _, p := range Personas {
+		n := assignment[p]
+		if n == 0 {
+			continue
+		}
+		col.personas[p] = &PersonaStats{Clients: n}
+
+		for i := 0; i < n; i++ {
+			c := &client{
+				persona: p,
+				profile: profiles[p],
+				http:    cfg.HTTPClient,
+				rng:     rand.New(rand.NewSource(rng.Int63())),
+				stats:   col,
+				logger:  logger.With("persona", p, "client", clientIndex),
+			}
+			delay := time.Duration(0)
+			if cfg.RampUp > 0 {
+				delay = cfg.RampUp * time.Duration(clientIndex) / time.Duration(cfg.Clients)
+			}
+			clientIndex++
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sleep.Sleep(ctx, delay) != nil {
+					return
+				}
+				c.run(ctx, cfg.URL)
+			}()
+		}
+	}
+
+	logger.Info("bench started", "clients", cfg.Clients, "duration", cfg.Duration, "mix", cfg.Mix.String())
+	wg.Wait()
+
+	result := &Result{
+		Elapsed:  time.Since(start),
+		Mix:      cfg.Mix.String(),
+		Personas: col.personas,
+		Requests: col.requests,
+	}
+	result.evaluate(cfg.SLOs)
+
+	return result, nil
+}
+
+// collector aggregates request outcomes from all clients.
+type collector struct {
+	mu       sync.Mutex
+	personas map[Persona]*PersonaStats
+	requests map[RequestType]*RequestStats
+}
+
+// client simulates a single player.
+type client struct {
+	persona Persona
+	profile profile
+	http    *http.Client
+	rng     *rand.Rand
+	stats   *collector
+	logger  *slog.Logger
+
+	// fetched records media sequence numbers already downloaded.
+	fetched map[uint64]bool
+}
+
+// run drives the player until ctx is done.
+func (c *client) run(ctx context.Context, playlistURL string) {
+	mediaURL, err := c.resolveMediaURL(ctx, playlistURL)
+	if err != nil {
+		c.logger.Debug("failed to resolve media playlist", "error", err)
+		return
+	}
+
+	c.fetched = make(map[uint64]bool)
+	var nextMSN uint64
+
+	for {
+		reloadURL := mediaURL
+		if c.profile.blockingReload && nextMSN > 0 {
+			reloadURL = withBlockingReload(mediaURL, nextMSN)
+		}
+
+		media, err := c.fetchMedia(ctx, reloadURL)
+		targetDuration := time.Second
+		if err == nil {
+			targetDuration = time.Duration(media.TargetDuration * float64(time.Second))
+			nextMSN = c.consume(ctx, mediaURL, media)
+		} else if ctx.Err() == nil {
+			c.logger.Debug("playlist reload failed", "error", err)
+		}
+
+		if sleep.Sleep(ctx, c.profile.reloadInterval(targetDuration)) != nil {
+			return
+		}
+	}
+}
+
+// resolveMediaURL fetches the entry playlist and picks a variant if it is a master.
+func (c *client) resolveMediaURL(ctx context.Context, playlistURL string) (string, error) {
+	res, err := c.get(ctx, playlistURL, 0)
+	if err != nil {
+		c.observe(ctx, RequestMaster, res, err)
+		return "", err
+	}
+
+	pl, listType, err := m3u8.Decode(*res.body, false)
+	if err != nil {
+		c.observe(ctx, RequestMaster, res, err)
+		return "", fmt.Errorf("decode playlist: %w", err)
+	}
+	if listType != m3u8.MASTER {
+		c.observe(ctx, RequestMedia, res, nil)
+		return playlistURL, nil
+	}
+	c.observe(ctx, RequestMaster, res, nil)
+
+	master := pl.(*m3u8.MasterPlaylist)
+	if len(master.Variants) == 0 {
+		return "", fmt.Errorf("master playlist has no variants")
+	}
+
+	v := master.Variants[c.rng.Intn(len(master.Variants))]
+	return resolve(playlistURL, v.URI)
+}
+
+// fetchMedia fetches and decodes a media playlist.
+func (c *client) fetchMedia(ctx context.Context, mediaURL string) (*m3u8.MediaPlaylist, error) {
+	res, err := c.get(ctx, mediaURL, 0)
+	if err == nil {
+		var pl m3u8.Playlist
+		var listType m3u8.ListType
+		pl, listType, err = m3u8.Decode(*res.body, false)
+		if err == nil && listType != m3u8.MEDIA {
+			err = fmt.Errorf("expected media playlist")
+		}
+		if err == nil {
+			c.observe(ctx, RequestMedia, res, nil)
+			return pl.(*m3u8.MediaPlaylist), nil
+		}
+	}
+	c.observe(ctx, RequestMedia, res, err)
+	return nil, err
+}
+
+// consume downloads the segments this persona wants from the current window
+// and returns the next expected media sequence number.
+func (c *client) consume(ctx context.Context, mediaURL string, media *m3u8.MediaPlaylist) uint64 {
+	var window []*m3u8.MediaSegment
+	for _, seg := range media.Segments {
+		if seg == nil {
+			break
+		}
+		window = append(window, seg)
+	}
+	if len(window) == 0 {
+		return media.SeqNo
+	}
+
+	// Forget segments that have left the window
+	for seq := range c.fetched {
+		if seq < media.SeqNo {
+			delete(c.fetched, seq)
+		}
+	}
+
+	first := 0
+	if c.profile.bufferSegments > 0 && len(window) > c.profile.bufferSegments {
+		first = len(window) - c.profile.bufferSegments
+	}
+	force := false
+
+	if c.profile.seekProbability > 0 && c.rng.Float64() < c.profile.seekProbability {
+		first = c.rng.Intn(len(window))
+		force = true
+		c.record(func(s *PersonaStats) { s.Seeks++ })
+	}
+
+	last := len(window)
+	if c.profile.bufferSegments > 0 && last-first > c.profile.bufferSegments {
+		last = first + c.profile.bufferSegments
+	}
+
+	for i := first; i < last; i++ {
+		seq := media.SeqNo + uint64(i)
+		if c.fetched[seq] && !force {
+			continue
+		}
+
+		segURL, err := resolve(mediaURL, window[i].URI)
+		if err != nil {
+			continue
+		}
+		res, err := c.get(ctx, segURL, c.profile.readRate)
+		c.observe(ctx, RequestSegment, res, err)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		c.fetched[seq] = true
+	}
+
+	return media.SeqNo + uint64(len(window))
+}
+
+// response is the outcome of a single GET request.
+type response struct {
+	body  *bytes.Buffer
+	ttfb  time.Duration
+	bytes int64
+}
+
+// get performs a GET request and reads the body, throttled to rate bytes per
+// second when rate is positive. The returned response is never nil.
+func (c *client) get(ctx context.Context, target string, rate int64) (*response, error) {
+	res := &response{body: &bytes.Buffer{}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return res, err
+	}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	res.ttfb = time.Since(start)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	res.bytes, err = throttledCopy(ctx, res.body, resp.Body, rate)
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return res, err
+}
+
+// observe records the outcome of a request. Requests cut short by the end of
+// the run are not counted.
+func (c *client) observe(ctx context.Context, kind RequestType, res *response, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	ps := c.stats.personas[c.persona]
+	if kind == RequestSegment {
+		ps.SegmentRequests++
+	} else {
+		ps.PlaylistRequests++
+	}
+	ps.Bytes += res.bytes
+
+	rs := c.stats.requests[kind]
+	rs.Requests++
+	rs.Latency.Observe(res.ttfb)
+
+	if err != nil {
+		ps.Errors++
+		rs.Errors++
+	}
+}
+
+// record applies fn to the persona stats under the shared lock.
+func (c *client) record(fn func(*PersonaStats)) {
+	c.stats.mu.Lock()
+	fn(c.stats.personas[c.persona])
+	c.stats.mu.Unlock()
+}
+
+// throttledCopy copies src to dst, limiting throughput to rate bytes per second
+// when rate is positive.
+func throttledCopy(ctx context.Context, dst io.Writer, src io.Reader, rate int64) (int64, error) {
+	if rate <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	start := time.Now()
+	buf := make([]byte, 4096)
+	var written int64
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+
+			expected := time.Duration(float64(written) / float64(rate) * float64(time.Second))
+			if sleep.Sleep(ctx, expected-time.Since(start)) != nil {
+				return written, ctx.Err()
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// withBlockingReload adds LL-HLS blocking playlist reload parameters.
+func withBlockingReload(mediaURL string, msn uint64) string {
+	u, err := url.Parse(mediaURL)
+	if err != nil {
+		return mediaURL
+	}
+	q := u.Query()
+	q.Set("_HLS_msn", strconv.FormatUint(msn, 10))
+	q.Set("_HLS_part", "0")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// resolve resolves ref against base.
+func resolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
@@ -0,0 +1,372 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	}))
+}
+
+// newTestOrigin serves a master playlist, one media playlist and small segments.
+// It records the request paths it receives.
+func newTestOrigin(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var paths []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\nmedia.m3u8\n")
+		case r.URL.Path == "/media.m3u8":
+			var b strings.Builder
+			fmt.Fprint(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n")
+			for i := 0; i < 6; i++ {
+				fmt.Fprintf(&b, "#EXTINF:1.000,\nseg%d.ts\n", i)
+			}
+			fmt.Fprint(w, b.String())
+		case strings.HasSuffix(r.URL.Path, ".ts"):
+			w.Write(make([]byte, 1024))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Mix
+		wantErr bool
+	}{
+		{name: "single persona", spec: "mobile=3", want: Mix{PersonaMobile: 3}},
+		{name: "implicit weight", spec: "aggressive,seeker", want: Mix{PersonaAggressive: 1, PersonaSeeker: 1}},
+		{name: "whitespace", spec: " llhls = 2 , mobile=1 ", want: Mix{PersonaLLHLS: 2, PersonaMobile: 1}},
+		{name: "unknown persona", spec: "binge=1", wantErr: true},
+		{name: "negative weight", spec: "mobile=-1", wantErr: true},
+		{name: "all zero", spec: "mobile=0", wantErr: true},
+		{name: "empty", spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMix(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMix(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.String() != tt.want.String() {
+				t.Errorf("ParseMix(%q) = %s, want %s", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMix_Assign(t *testing.T) {
+	tests := []struct {
+		name    string
+		mix     Mix
+		clients int
+		want    map[Persona]int
+	}{
+		{
+			name:    "even split",
+			mix:     Mix{PersonaAggressive: 1, PersonaMobile: 1},
+			clients: 10,
+			want:    map[Persona]int{PersonaAggressive: 5, PersonaMobile: 5},
+		},
+		{
+			name:    "weighted",
+			mix:     Mix{PersonaMobile: 8, PersonaSeeker: 2},
+			clients: 10,
+			want:    map[Persona]int{PersonaMobile: 8, PersonaSeeker: 2},
+		},
+		{
+			name:    "remainder goes to largest share",
+			mix:     Mix{PersonaAggressive: 1, PersonaMobile: 2},
+			clients: 4,
+			want:    map[Persona]int{PersonaAggressive: 1, PersonaMobile: 3},
+		},
+		{
+			name:    "fewer clients than personas",
+			mix:     DefaultMix,
+			clients: 2,
+			want:    map[Persona]int{PersonaAggressive: 1, PersonaLLHLS: 1, PersonaMobile: 0, PersonaSeeker: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.mix.Assign(tt.clients)
+			total := 0
+			for p, want := range tt.want {
+				if got[p] != want {
+					t.Errorf("persona %s: got %d clients, want %d", p, got[p], want)
+				}
+			}
+			for _, n := range got {
+				total += n
+			}
+			if total != tt.clients {
+				t.Errorf("assigned %d clients, want %d", total, tt.clients)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{name: "valid", cfg: Config{URL: "http://x/p.m3u8", Clients: 1, Duration: time.Second}},
+		{name: "missing url", cfg: Config{Clients: 1, Duration: time.Second}, wantErr: true},
+		{name: "zero clients", cfg: Config{URL: "http://x/p.m3u8", Duration: time.Second}, wantErr: true},
+		{name: "zero duration", cfg: Config{URL: "http://x/p.m3u8", Clients: 1}, wantErr: true},
+		{name: "negative ramp-up", cfg: Config{URL: "http://x/p.m3u8", Clients: 1, Duration: time.Second, RampUp: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.cfg.Mix == nil || tt.cfg.HTTPClient == nil) {
+				t.Error("Validate() did not fill in defaults")
+			}
+		})
+	}
+}
+
+func TestRun_Personas(t *testing.T) {
+	for _, p := range Personas {
+		t.Run(string(p), func(t *testing.T) {
+			srv, requests := newTestOrigin(t)
+
+			result, err := Run(context.Background(), Config{
+				URL:      srv.URL + "/master.m3u8",
+				Clients:  1,
+				Duration: 500 * time.Millisecond,
+				Mix:      Mix{p: 1},
+			}, createTestLogger())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			stats := result.Personas[p]
+			if stats == nil {
+				t.Fatalf("no stats for persona %s", p)
+			}
+			if stats.PlaylistRequests < 2 {
+				t.Errorf("expected master and media requests, got %d playlist requests", stats.PlaylistRequests)
+			}
+			if stats.SegmentRequests == 0 {
+				t.Error("expected segment requests")
+			}
+			if stats.Errors != 0 {
+				t.Errorf("expected no errors, got %d", stats.Errors)
+			}
+
+			var segmentRequests int
+			var blocking bool
+			for _, path := range requests() {
+				if strings.HasSuffix(path, ".ts") {
+					segmentRequests++
+				}
+				if strings.Contains(path, "_HLS_msn=") {
+					blocking = true
+				}
+			}
+
+			switch p {
+			case PersonaAggressive:
+				if segmentRequests < 6 {
+					t.Errorf("aggressive persona fetched %d segments, want whole window", segmentRequests)
+				}
+			case PersonaLLHLS:
+				if !blocking {
+					t.Error("llhls persona did not use blocking reload parameters")
+				}
+			case PersonaMobile:
+				if segmentRequests > 2 {
+					t.Errorf("mobile persona fetched %d segments, want at most its buffer", segmentRequests)
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	result, err := Run(context.Background(), Config{
+		URL:      srv.URL + "/missing.m3u8",
+		Clients:  2,
+		Duration: 100 * time.Millisecond,
+		Mix:      Mix{PersonaAggressive: 1},
+	}, createTestLogger())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := result.Personas[PersonaAggressive].Errors; got != 2 {
+		t.Errorf("expected 2 errors, got %d", got)
+	}
+}
+
+func TestResult_WriteText(t *testing.T) {
+	result := &Result{
+		Elapsed: time.Second,
+		Mix:     "mobile=1",
+		Personas: map[Persona]*PersonaStats{
+			PersonaMobile: {Clients: 1, PlaylistRequests: 3, SegmentRequests: 2, Bytes: 2048},
+		},
+	}
+
+	var b strings.Builder
+	if err := result.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+
+	out := b.String()
+	for _, want := range []string{"PERSONA", "mobile", "2048"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := NewHistogram()
+	if h.Quantile(0.5) != 0 || h.Mean() != 0 {
+		t.Error("empty histogram should report zero")
+	}
+
+	for i := 0; i < 90; i++ {
+		h.Observe(3 * time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		h.Observe(150 * time.Millisecond)
+	}
+	h.Observe(45 * time.Second)
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{q: 0.5, want: 5 * time.Millisecond},
+		{q: 0.9, want: 5 * time.Millisecond},
+		{q: 0.95, want: 200 * time.Millisecond},
+		{q: 0.99, want: 200 * time.Millisecond},
+		{q: 1, want: 45 * time.Second}, // overflow bucket reports the observed max
+	}
+	for _, tt := range tests {
+		if got := h.Quantile(tt.q); got != tt.want {
+			t.Errorf("Quantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+
+	if h.Count() != 100 {
+		t.Errorf("Count() = %d, want 100", h.Count())
+	}
+}
+
+func TestHistogram_QuantileCappedAtMax(t *testing.T) {
+	h := NewHistogram()
+	h.Observe(120 * time.Millisecond)
+
+	if got := h.Quantile(0.99); got != 120*time.Millisecond {
+		t.Errorf("Quantile(0.99) = %v, want observed max 120ms", got)
+	}
+}
+
+func TestRun_SLOReport(t *testing.T) {
+	srv, _ := newTestOrigin(t)
+
+	slos, err := ParseSLOs("media:p99<10s,segment:errors<1%,master:p50<1ns")
+	if err != nil {
+		t.Fatalf("ParseSLOs() error = %v", err)
+	}
+
+	result, err := Run(context.Background(), Config{
+		URL:      srv.URL + "/master.m3u8",
+		Clients:  2,
+		Duration: 300 * time.Millisecond,
+		Mix:      Mix{PersonaAggressive: 1},
+		SLOs:     slos,
+	}, createTestLogger())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := result.Requests[RequestMaster].Requests; got != 2 {
+		t.Errorf("master requests = %d, want 2", got)
+	}
+	if result.Requests[RequestMedia].Latency.Count() == 0 {
+		t.Error("expected media latency samples")
+	}
+	if result.Requests[RequestSegment].Requests == 0 {
+		t.Error("expected segment requests")
+	}
+
+	if len(result.SLOs) != 3 {
+		t.Fatalf("expected 3 SLO results, got %d", len(result.SLOs))
+	}
+	if !result.SLOs[0].Pass || !result.SLOs[1].Pass {
+		t.Errorf("expected first two SLOs to pass: %+v", result.SLOs)
+	}
+	if result.SLOs[2].Pass {
+		t.Error("expected impossible master latency SLO to fail")
+	}
+	if result.Pass {
+		t.Error("expected overall result to fail")
+	}
+
+	var b strings.Builder
+	if err := result.WriteJSON(&b); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	var report map[string]any
+	if err := json.Unmarshal([]byte(b.String()), &report); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	requests := report["requests"].(map[string]any)
+	media := requests["media"].(map[string]any)
+	latency := media["latency"].(map[string]any)
+	if _, ok := latency["p99_ms"]; !ok {
+		t.Error("report missing media p99_ms")
+	}
+	if report["pass"] != false {
+		t.Errorf("report pass = %v, want false", report["pass"])
+	}
+}
@@ -0,0 +1,158 @@
+package bench
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the histogram buckets. Samples above
+// the last bound fall into an overflow bucket.
+var latencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// Histogram records a latency distribution in fixed buckets.
+// It is not safe for concurrent use.
+type Histogram struct {
+	counts []int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// NewHistogram creates an empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, len(latencyBuckets)+1)}
+}
+
+// Observe records a single latency sample.
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return d <= latencyBuckets[i] })
+	h.counts[i]++
+
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Count returns the number of samples.
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Mean returns the average latency, or zero if there are no samples.
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Quantile estimates the q-th quantile (0 < q <= 1) as the upper bound of the
+// bucket containing it, capped at the observed maximum.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := int64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			if i < len(latencyBuckets) && latencyBuckets[i] < h.max {
+				return latencyBuckets[i]
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// histogramJSON is the report representation of a histogram.
+type histogramJSON struct {
+	Count   int64            `json:"count"`
+	MinMs   float64          `json:"min_ms"`
+	MeanMs  float64          `json:"mean_ms"`
+	P50Ms   float64          `json:"p50_ms"`
+	P90Ms   float64          `json:"p90_ms"`
+	P95Ms   float64          `json:"p95_ms"`
+	P99Ms   float64          `json:"p99_ms"`
+	MaxMs   float64          `json:"max_ms"`
+	Buckets map[string]int64 `json:"buckets"`
+}
+
+// MarshalJSON renders summary quantiles and non-empty bucket counts.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	out := histogramJSON{
+		Count:   h.count,
+		MinMs:   millis(h.min),
+		MeanMs:  millis(h.Mean()),
+		P50Ms:   millis(h.Quantile(0.5)),
+		P90Ms:   millis(h.Quantile(0.9)),
+		P95Ms:   millis(h.Quantile(0.95)),
+		P99Ms:   millis(h.Quantile(0.99)),
+		MaxMs:   millis(h.max),
+		Buckets: make(map[string]int64),
+	}
+
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+		label := "+Inf"
+		if i < len(latencyBuckets) {
+			label = latencyBuckets[i].String()
+		}
+		out.Buckets["le_"+label] = n
+	}
+
+	return json.Marshal(out)
+}
+
+// millis converts a duration to fractional milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// merge adds the samples of other into h.
+func (h *Histogram) merge(other *Histogram) {
+	if other.count == 0 {
+		return
+	}
+	for i, n := range other.counts {
+		h.counts[i] += n
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
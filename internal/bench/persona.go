@@ -0,0 +1,160 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Persona identifies a simulated player behavior.
+type Persona string
+
+const (
+	// PersonaAggressive reloads the playlist frequently and prefetches every
+	// segment in the window it has not fetched yet.
+	PersonaAggressive Persona = "aggressive"
+	// PersonaLLHLS reloads at part-target cadence using LL-HLS blocking reload
+	// query parameters and only fetches the newest segment.
+	PersonaLLHLS Persona = "llhls"
+	// PersonaMobile reloads once per target duration, keeps a small buffer and
+	// downloads segments over a throttled connection.
+	PersonaMobile Persona = "mobile"
+	// PersonaSeeker behaves like a normal player but periodically seeks to a
+	// random segment within the live window.
+	PersonaSeeker Persona = "seeker"
+)
+
+// Personas lists all supported personas in a stable order.
+var Personas = []Persona{PersonaAggressive, PersonaLLHLS, PersonaMobile, PersonaSeeker}
+
+// profile describes the request pattern of a persona.
+type profile struct {
+	// reloadFactor is the playlist reload interval as a fraction of the target duration.
+	reloadFactor float64
+	// bufferSegments is the number of newest segments the player keeps fetched
+	// (0 means the whole window).
+	bufferSegments int
+	// readRate limits segment download speed in bytes per second (0 means unlimited).
+	readRate int64
+	// seekProbability is the chance that a reload triggers a seek.
+	seekProbability float64
+	// blockingReload adds _HLS_msn/_HLS_part query parameters on reloads.
+	blockingReload bool
+}
+
+// profiles maps each persona to its request pattern.
+var profiles = map[Persona]profile{
+	PersonaAggressive: {reloadFactor: 0.25, bufferSegments: 0},
+	PersonaLLHLS:      {reloadFactor: 0.1, bufferSegments: 1, blockingReload: true},
+	PersonaMobile:     {reloadFactor: 1.0, bufferSegments: 2, readRate: 64 * 1024},
+	PersonaSeeker:     {reloadFactor: 0.5, bufferSegments: 3, seekProbability: 0.2},
+}
+
+// reloadInterval returns how long the persona waits between playlist reloads.
+func (p profile) reloadInterval(targetDuration time.Duration) time.Duration {
+	interval := time.Duration(float64(targetDuration) * p.reloadFactor)
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+// Mix is the relative weight of each persona in the simulated client population.
+type Mix map[Persona]int
+
+// DefaultMix is used when no mix is configured.
+var DefaultMix = Mix{PersonaAggressive: 1, PersonaLLHLS: 1, PersonaMobile: 1, PersonaSeeker: 1}
+
+// ParseMix parses a mix specification such as "aggressive=2,mobile=5".
+// Personas not listed get a weight of zero.
+func ParseMix(spec string) (Mix, error) {
+	mix := Mix{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, weightStr, ok := strings.Cut(part, "=")
+		if !ok {
+			weightStr = "1"
+		}
+
+		persona := Persona(strings.TrimSpace(name))
+		if _, known := profiles[persona]; !known {
+			return nil, fmt.Errorf("unknown persona %q", name)
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q for persona %s", weightStr, persona)
+		}
+		mix[persona] += weight
+	}
+
+	if mix.total() == 0 {
+		return nil, fmt.Errorf("mix must give at least one persona a positive weight")
+	}
+
+	return mix, nil
+}
+
+// total returns the sum of all weights.
+func (m Mix) total() int {
+	total := 0
+	for _, w := range m {
+		total += w
+	}
+	return total
+}
+
+// Assign distributes clients across personas proportionally to their weights.
+// Remainders go to personas with the largest fractional share, so the result
+// always sums to clients.
+func (m Mix) Assign(clients int) map[Persona]int {
+	total := m.total()
+	result := make(map[Persona]int)
+	if total == 0 || clients <= 0 {
+		return result
+	}
+
+	type share struct {
+		persona   Persona
+		remainder int
+	}
+	var shares []share
+	assigned := 0
+	for _, p := range Personas {
+		w := m[p]
+		if w == 0 {
+			continue
+		}
+		n := clients * w / total
+		result[p] = n
+		assigned += n
+		shares = append(shares, share{persona: p, remainder: clients * w % total})
+	}
+
+	sort.SliceStable(shares, func(i, j int) bool {
+		return shares[i].remainder > shares[j].remainder
+	})
+	for i := 0; assigned < clients; i++ {
+		result[shares[i%len(shares)].persona]++
+		assigned++
+	}
+
+	return result
+}
+
+// String formats the mix in the same syntax accepted by ParseMix.
+func (m Mix) String() string {
+	var parts []string
+	for _, p := range Personas {
+		if w := m[p]; w > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", p, w))
+		}
+	}
+	return strings.Join(parts, ",")
+}
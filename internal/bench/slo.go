@@ -0,0 +1,145 @@
+package bench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLO is a service level objective evaluated against a bench result.
+// It bounds either a latency quantile or the error rate of a request type.
+type SLO struct {
+	// RequestType restricts the objective to one request type ("" for all).
+	RequestType RequestType
+	// Quantile is the latency quantile to check (e.g., 0.99). Zero for error-rate objectives.
+	Quantile float64
+	// MaxLatency is the latency bound for quantile objectives.
+	MaxLatency time.Duration
+	// MaxErrorRate is the error ratio bound (0-1) for error-rate objectives.
+	MaxErrorRate float64
+	// spec is the original specification text.
+	spec string
+}
+
+// String returns the specification the SLO was parsed from.
+func (s SLO) String() string {
+	return s.spec
+}
+
+// ParseSLOs parses a comma-separated list of objectives. Supported forms are
+// "[type:]pNN<duration>" for latency quantiles and "[type:]errors<N%" for error
+// budgets, where type is master, media or segment. For example:
+// "media:p99<200ms,segment:p95<2s,errors<0.5%".
+func ParseSLOs(spec string) ([]SLO, error) {
+	var slos []SLO
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		slo, err := parseSLO(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SLO %q: %w", part, err)
+		}
+		slos = append(slos, slo)
+	}
+	return slos, nil
+}
+
+// parseSLO parses a single objective.
+func parseSLO(spec string) (SLO, error) {
+	slo := SLO{spec: spec}
+
+	body := spec
+	if kind, rest, ok := strings.Cut(spec, ":"); ok {
+		rt := RequestType(strings.TrimSpace(kind))
+		if !rt.valid() {
+			return SLO{}, fmt.Errorf("unknown request type %q", kind)
+		}
+		slo.RequestType = rt
+		body = rest
+	}
+
+	metric, bound, ok := strings.Cut(body, "<")
+	if !ok {
+		return SLO{}, fmt.Errorf("expected metric<bound")
+	}
+	metric = strings.TrimSpace(metric)
+	bound = strings.TrimSpace(bound)
+
+	if metric == "errors" {
+		pct := strings.TrimSuffix(bound, "%")
+		rate, err := strconv.ParseFloat(pct, 64)
+		if err != nil || rate < 0 {
+			return SLO{}, fmt.Errorf("invalid error rate %q", bound)
+		}
+		if strings.HasSuffix(bound, "%") {
+			rate /= 100
+		}
+		if rate > 1 {
+			return SLO{}, fmt.Errorf("error rate %q exceeds 100%%", bound)
+		}
+		slo.MaxErrorRate = rate
+		return slo, nil
+	}
+
+	if !strings.HasPrefix(metric, "p") {
+		return SLO{}, fmt.Errorf("unknown metric %q", metric)
+	}
+	pct, err := strconv.ParseFloat(metric[1:], 64)
+	if err != nil || pct <= 0 || pct > 100 {
+		return SLO{}, fmt.Errorf("invalid quantile %q", metric)
+	}
+	latency, err := time.ParseDuration(bound)
+	if err != nil || latency <= 0 {
+		return SLO{}, fmt.Errorf("invalid latency %q", bound)
+	}
+
+	slo.Quantile = pct / 100
+	slo.MaxLatency = latency
+	return slo, nil
+}
+
+// SLOResult is the outcome of evaluating one SLO.
+type SLOResult struct {
+	SLO    string `json:"slo"`
+	Pass   bool   `json:"pass"`
+	Actual string `json:"actual"`
+	// BudgetRemaining is the fraction of the error budget left (error-rate
+	// objectives only; negative when the budget is exhausted).
+	BudgetRemaining *float64 `json:"budget_remaining,omitempty"`
+}
+
+// Evaluate checks the SLO against the per-request-type stats in r.
+func (s SLO) Evaluate(r *Result) SLOResult {
+	stats := r.requestStats(s.RequestType)
+
+	if s.Quantile == 0 {
+		var rate float64
+		if stats.Requests > 0 {
+			rate = float64(stats.Errors) / float64(stats.Requests)
+		}
+
+		remaining := 1.0
+		if s.MaxErrorRate > 0 {
+			remaining = 1 - rate/s.MaxErrorRate
+		} else if rate > 0 {
+			remaining = -1
+		}
+
+		return SLOResult{
+			SLO:             s.spec,
+			Pass:            rate <= s.MaxErrorRate,
+			Actual:          fmt.Sprintf("%.3f%%", rate*100),
+			BudgetRemaining: &remaining,
+		}
+	}
+
+	actual := stats.Latency.Quantile(s.Quantile)
+	return SLOResult{
+		SLO:    s.spec,
+		Pass:   stats.Latency.Count() > 0 && actual <= s.MaxLatency,
+		Actual: actual.String(),
+	}
+}
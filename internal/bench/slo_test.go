@@ -0,0 +1,112 @@
+package bench
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSLOs(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []SLO
+		wantErr bool
+	}{
+		{
+			name: "latency quantile",
+			spec: "media:p99<200ms",
+			want: []SLO{{RequestType: RequestMedia, Quantile: 0.99, MaxLatency: 200 * time.Millisecond}},
+		},
+		{
+			name: "global error budget in percent",
+			spec: "errors<0.5%",
+			want: []SLO{{MaxErrorRate: 0.005}},
+		},
+		{
+			name: "typed error budget as ratio",
+			spec: "segment:errors<0.01",
+			want: []SLO{{RequestType: RequestSegment, MaxErrorRate: 0.01}},
+		},
+		{
+			name: "multiple",
+			spec: "p50<1s, segment:p95<2s",
+			want: []SLO{
+				{Quantile: 0.5, MaxLatency: time.Second},
+				{RequestType: RequestSegment, Quantile: 0.95, MaxLatency: 2 * time.Second},
+			},
+		},
+		{name: "empty", spec: ""},
+		{name: "unknown type", spec: "key:p99<1s", wantErr: true},
+		{name: "missing bound", spec: "p99", wantErr: true},
+		{name: "bad quantile", spec: "p101<1s", wantErr: true},
+		{name: "bad latency", spec: "p99<fast", wantErr: true},
+		{name: "unknown metric", spec: "throughput<1", wantErr: true},
+		{name: "error rate above 100%", spec: "errors<150%", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSLOs(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSLOs(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseSLOs(%q) returned %d SLOs, want %d", tt.spec, len(got), len(tt.want))
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.RequestType != w.RequestType || g.Quantile != w.Quantile ||
+					g.MaxLatency != w.MaxLatency || g.MaxErrorRate != w.MaxErrorRate {
+					t.Errorf("SLO %d = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestSLO_Evaluate(t *testing.T) {
+	media := NewHistogram()
+	for i := 0; i < 99; i++ {
+		media.Observe(10 * time.Millisecond)
+	}
+	media.Observe(800 * time.Millisecond)
+
+	result := &Result{
+		Requests: map[RequestType]*RequestStats{
+			RequestMedia:   {Requests: 100, Errors: 1, Latency: media},
+			RequestSegment: {Requests: 100, Errors: 0, Latency: NewHistogram()},
+		},
+	}
+
+	tests := []struct {
+		spec          string
+		wantPass      bool
+		wantRemaining float64
+	}{
+		{spec: "media:p50<20ms", wantPass: true},
+		{spec: "media:p99<20ms", wantPass: true},
+		{spec: "media:p100<20ms", wantPass: false},
+		{spec: "segment:p99<1s", wantPass: false}, // no samples never passes a latency SLO
+		{spec: "media:errors<2%", wantPass: true, wantRemaining: 0.5},
+		{spec: "media:errors<0.5%", wantPass: false, wantRemaining: -1},
+		{spec: "errors<1%", wantPass: true, wantRemaining: 0.5},
+		{spec: "segment:errors<0", wantPass: true, wantRemaining: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			slos, err := ParseSLOs(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSLOs() error = %v", err)
+			}
+
+			got := slos[0].Evaluate(result)
+			if got.Pass != tt.wantPass {
+				t.Errorf("Pass = %v, want %v (actual %s)", got.Pass, tt.wantPass, got.Actual)
+			}
+			if got.BudgetRemaining != nil && *got.BudgetRemaining != tt.wantRemaining {
+				t.Errorf("BudgetRemaining = %v, want %v", *got.BudgetRemaining, tt.wantRemaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package budget enforces the resource limits an encodersim imposes on
+// itself, so that a simulator sharing a host with the system under test
+// cannot starve it: a soft memory limit for the Go runtime (GOMEMLIMIT), a
+// cap on GOMAXPROCS, a bound on the bytes held by in-memory caches and a
+// bound on the channels of an embedded encodersim.Engine.
+//
+// A nil *Budget imposes no limits, so that callers need not check for one.
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+)
+
+// ErrExceeded is returned, wrapped, when a reservation would exceed a
+// limit.
+var ErrExceeded = errors.New("resource budget exceeded")
+
+// Resources are the bounded resources whose refused reservations are
+// counted, in reporting order.
+var Resources = []string{"cache", "channels"}
+
+// Limits are the resource limits of a Budget. A zero field means no limit.
+type Limits struct {
+	// Memory is the soft memory limit of the Go runtime in bytes, as set by
+	// GOMEMLIMIT, which it overrides. The garbage collector works harder as
+	// the process approaches it; it is not a hard cap.
+	Memory int64
+
+	// Procs caps the number of OS threads executing Go code (GOMAXPROCS),
+	// and so the CPU cores the simulator keeps busy.
+	Procs int
+
+	// CacheBytes bounds the bytes held by in-memory caches: pre-rendered
+	// windows and the memory: storage backend.
+	CacheBytes int64
+
+	// Channels bounds the channels an encodersim.Engine creates at once.
+	Channels int
+}
+
+// Validate reports the first limit that is negative.
+func (l Limits) Validate() error {
+	switch {
+	case l.Memory < 0:
+		return fmt.Errorf("memory limit must not be negative, got %d", l.Memory)
+	case l.Procs < 0:
+		return fmt.Errorf("procs limit must not be negative, got %d", l.Procs)
+	case l.CacheBytes < 0:
+		return fmt.Errorf("cache limit must not be negative, got %d", l.CacheBytes)
+	case l.Channels < 0:
+		return fmt.Errorf("channel limit must not be negative, got %d", l.Channels)
+	}
+	return nil
+}
+
+// Budget accounts for the bounded resources in use and refuses
+// reservations over the limits. It is safe for concurrent use.
+type Budget struct {
+	limits Limits
+
+	mu         sync.Mutex
+	cacheBytes int64
+	channels   int
+	refused    map[string]uint64 // Resources to count
+}
+
+// New returns a Budget with the given limits, or an error if one is
+// invalid.
+func New(limits Limits) (*Budget, error) {
+	if err := limits.Validate(); err != nil {
+		return nil, err
+	}
+	return &Budget{limits: limits, refused: make(map[string]uint64)}, nil
+}
+
+// Limits returns the limits of the budget.
+func (b *Budget) Limits() Limits {
+	if b == nil {
+		return Limits{}
+	}
+	return b.limits
+}
+
+// ApplyRuntime applies the Memory and Procs limits to the Go runtime. They
+// are process-wide, so only the binary applies them; an embedded Engine
+// leaves the runtime to its host.
+func (b *Budget) ApplyRuntime(logger *slog.Logger) {
+	if b == nil {
+		return
+	}
+	if b.limits.Memory > 0 {
+		previous := debug.SetMemoryLimit(b.limits.Memory)
+		logger.Info("set memory limit", "bytes", b.limits.Memory, "previous", previous)
+	}
+	if b.limits.Procs > 0 {
+		previous := runtime.GOMAXPROCS(b.limits.Procs)
+		logger.Info("set GOMAXPROCS", "procs", b.limits.Procs, "previous", previous)
+	}
+}
+
+// ReserveCache charges n bytes of cached data, described by what, to the
+// cache limit. It returns an error wrapping ErrExceeded, and charges
+// nothing, if they do not fit.
+func (b *Budget) ReserveCache(what string, n int64) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limit := b.limits.CacheBytes; limit > 0 && b.cacheBytes+n > limit {
+		b.refused["cache"]++
+		return fmt.Errorf("%w: caching %s (%d bytes) with %d bytes cached would exceed the cache limit of %d bytes",
+			ErrExceeded, what, n, b.cacheBytes, limit)
+	}
+	b.cacheBytes += n
+	return nil
+}
+
+// ReleaseCache returns n bytes reserved with ReserveCache.
+func (b *Budget) ReleaseCache(n int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cacheBytes -= n
+}
+
+// AcquireChannel takes a channel from the channel limit. It returns an
+// error wrapping ErrExceeded if none is left.
+func (b *Budget) AcquireChannel() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if limit := b.limits.Channels; limit > 0 && b.channels >= limit {
+		b.refused["channels"]++
+		return fmt.Errorf("%w: %d channels already running, the channel limit", ErrExceeded, b.channels)
+	}
+	b.channels++
+	return nil
+}
+
+// ReleaseChannel returns a channel taken with AcquireChannel.
+func (b *Budget) ReleaseChannel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.channels--
+}
+
+// Stats is the resource usage of a Budget, for /health and /metrics.
+type Stats struct {
+	// MemoryLimit is the soft memory limit of the runtime, whether set by
+	// Limits.Memory or GOMEMLIMIT; 0 if there is none.
+	MemoryLimit int64 `json:"memory_limit_bytes"`
+
+	// MemoryUsed is the memory the runtime counts against its limit: all
+	// memory mapped by the Go runtime, less what it returned to the OS.
+	MemoryUsed int64 `json:"memory_used_bytes"`
+
+	// Procs is the current GOMAXPROCS.
+	Procs int `json:"procs"`
+
+	// CacheLimit and CacheBytes are the cache limit (0 if unlimited) and
+	// the bytes reserved against it.
+	CacheLimit int64 `json:"cache_limit_bytes"`
+	CacheBytes int64 `json:"cache_bytes"`
+
+	// ChannelLimit and Channels are the channel limit (0 if unlimited) and
+	// the channels running.
+	ChannelLimit int `json:"channel_limit"`
+	Channels     int `json:"channels"`
+
+	// Refused counts the refused reservations by resource, with every
+	// resource of Resources present.
+	Refused map[string]uint64 `json:"refused"`
+}
+
+// Stats returns the current usage. The memory figures are those of the
+// whole process.
+func (b *Budget) Stats() Stats {
+	stats := Stats{
+		MemoryUsed: memoryUsed(),
+		Procs:      runtime.GOMAXPROCS(0),
+		Refused:    make(map[string]uint64, len(Resources)),
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		stats.MemoryLimit = limit
+	}
+	if b == nil {
+		for _, resource := range Resources {
+			stats.Refused[resource] = 0
+		}
+		return stats
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.CacheLimit = b.limits.CacheBytes
+	stats.CacheBytes = b.cacheBytes
+	stats.ChannelLimit = b.limits.Channels
+	stats.Channels = b.channels
+	for _, resource := range Resources {
+		stats.Refused[resource] = b.refused[resource]
+	}
+	return stats
+}
+
+// memoryUsed returns the memory the Go runtime counts against its soft
+// memory limit.
+func memoryUsed() int64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	var values [2]uint64
+	for i, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			values[i] = s.Value.Uint64()
+		}
+	}
+	return int64(values[0] - values[1])
+}
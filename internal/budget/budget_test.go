@@ -0,0 +1,87 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimits_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr bool
+	}{
+		{"unlimited", Limits{}, false},
+		{"all set", Limits{Memory: 1 << 30, Procs: 2, CacheBytes: 1 << 20, Channels: 4}, false},
+		{"negative memory", Limits{Memory: -1}, true},
+		{"negative procs", Limits{Procs: -1}, true},
+		{"negative cache", Limits{CacheBytes: -1}, true},
+		{"negative channels", Limits{Channels: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limits.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBudget_Cache(t *testing.T) {
+	b, err := New(Limits{CacheBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ReserveCache("a", 60); err != nil {
+		t.Fatalf("ReserveCache(60) error = %v", err)
+	}
+	if err := b.ReserveCache("b", 41); !errors.Is(err, ErrExceeded) {
+		t.Errorf("ReserveCache(41) error = %v, want ErrExceeded", err)
+	}
+	if err := b.ReserveCache("c", 40); err != nil {
+		t.Errorf("ReserveCache(40) error = %v", err)
+	}
+	b.ReleaseCache(60)
+
+	stats := b.Stats()
+	if stats.CacheBytes != 40 || stats.CacheLimit != 100 || stats.Refused["cache"] != 1 || stats.Refused["channels"] != 0 {
+		t.Errorf("Stats() = %+v, want 40 of 100 bytes and one cache refusal", stats)
+	}
+}
+
+func TestBudget_Channels(t *testing.T) {
+	b, err := New(Limits{Channels: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := b.AcquireChannel(); err != nil {
+			t.Fatalf("AcquireChannel() %d error = %v", i, err)
+		}
+	}
+	if err := b.AcquireChannel(); !errors.Is(err, ErrExceeded) {
+		t.Errorf("third AcquireChannel() error = %v, want ErrExceeded", err)
+	}
+	b.ReleaseChannel()
+	if err := b.AcquireChannel(); err != nil {
+		t.Errorf("AcquireChannel() after a release error = %v", err)
+	}
+	if stats := b.Stats(); stats.Channels != 2 || stats.Refused["channels"] != 1 {
+		t.Errorf("Stats() = %+v, want 2 channels and one refusal", stats)
+	}
+}
+
+func TestBudget_Nil(t *testing.T) {
+	var b *Budget
+	if err := b.ReserveCache("a", 1<<40); err != nil {
+		t.Errorf("ReserveCache() error = %v", err)
+	}
+	if err := b.AcquireChannel(); err != nil {
+		t.Errorf("AcquireChannel() error = %v", err)
+	}
+	b.ReleaseCache(1)
+	b.ReleaseChannel()
+	if stats := b.Stats(); stats.MemoryUsed <= 0 || stats.Procs <= 0 || len(stats.Refused) != len(Resources) {
+		t.Errorf("Stats() = %+v, want process usage and every resource", stats)
+	}
+}
@@ -0,0 +1,88 @@
+// Package buildinfo describes the running encodersim build, so that fleet
+// tooling can tell exactly which build is deployed where.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"github.com/agleyzer/encodersim/internal/features"
+)
+
+// Commit and Date identify the build. They are set at link time, as the
+// Makefile does:
+//
+//	go build -ldflags "-X github.com/agleyzer/encodersim/internal/buildinfo.Commit=abc1234 \
+//	  -X github.com/agleyzer/encodersim/internal/buildinfo.Date=2026-10-15T12:00:00Z"
+//
+// When unset, they fall back to the VCS information the Go toolchain embeds
+// when building inside a git checkout.
+var (
+	Commit string
+	Date   string
+)
+
+// Info describes a build and the features it runs with.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`     // "unknown" if not recorded
+	Date      string `json:"build_date"` // RFC 3339, or "unknown"
+	GoVersion string `json:"go_version"`
+
+	// Features lists the optional subsystems enabled on this instance, such
+	// as "dash" or "cluster".
+	Features []string `json:"features"`
+
+	// Experimental maps every experimental feature (--enable-feature) to
+	// whether it is enabled.
+	Experimental map[string]bool `json:"experimental"`
+}
+
+// Read returns the Info of the running binary with the given version,
+// features and experimental features.
+func Read(version string, enabled []string, experimental features.Set) Info {
+	info := Info{
+		Version:      version,
+		Commit:       Commit,
+		Date:         Date,
+		GoVersion:    runtime.Version(),
+		Features:     enabled,
+		Experimental: experimental.Status(),
+	}
+	if info.Features == nil {
+		info.Features = []string{}
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		var revision, modified, vcsTime string
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				revision = s.Value
+			case "vcs.modified":
+				modified = s.Value
+			case "vcs.time":
+				vcsTime = s.Value
+			}
+		}
+		if info.Commit == "" && revision != "" {
+			info.Commit = revision
+			if len(info.Commit) > 12 {
+				info.Commit = info.Commit[:12]
+			}
+			if modified == "true" {
+				info.Commit += "-dirty"
+			}
+		}
+		if info.Date == "" {
+			info.Date = vcsTime
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
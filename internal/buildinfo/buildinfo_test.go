@@ -0,0 +1,32 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/features"
+)
+
+func TestRead(t *testing.T) {
+	info := Read("1.2.3", nil, nil)
+	if info.Version != "1.2.3" || info.GoVersion != runtime.Version() {
+		t.Errorf("Read() = %+v", info)
+	}
+	// Test binaries carry no VCS information
+	if info.Commit != "unknown" || info.Date != "unknown" {
+		t.Errorf("Read() commit = %q, date = %q, want unknown", info.Commit, info.Date)
+	}
+	if info.Features == nil {
+		t.Error("Read() features = nil, want an empty list")
+	}
+	if on, ok := info.Experimental[features.LLHLS]; !ok || on {
+		t.Errorf("Read() experimental = %v, want ll-hls listed and disabled", info.Experimental)
+	}
+
+	Commit, Date = "abc1234", "2026-10-15T12:00:00Z"
+	defer func() { Commit, Date = "", "" }()
+	info = Read("1.2.3", []string{"dash"}, features.Set{features.LLHLS: true})
+	if info.Commit != "abc1234" || info.Date != "2026-10-15T12:00:00Z" || len(info.Features) != 1 || !info.Experimental[features.LLHLS] {
+		t.Errorf("Read() with link-time values = %+v", info)
+	}
+}
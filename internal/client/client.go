@@ -0,0 +1,504 @@
+// Package client is a Go client for the encodersim HTTP API, as described
+// by the OpenAPI document the server serves at /openapi.json. Every
+// operation of the document has a method of the same name on Client.
+//
+// Like every package of this CLI it is internal: tools outside this module
+// generate their own client from the document. Within the module it drives
+// a simulator end to end, for example to switch network profiles:
+//
+//	c, err := client.New("http://localhost:8080")
+//	if err != nil {
+//		return err
+//	}
+//	c.AdminToken = os.Getenv("ENCODERSIM_TOKEN")
+//	if _, err := c.SetNetworkProfile(ctx, "3g"); err != nil {
+//		return err
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the HTTP API of one encodersim instance. Set its fields
+// before the first call; it is then safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// APIKey, if set, is sent in the X-API-Key header of every request, for
+	// servers started with --api-keys.
+	APIKey string
+
+	// AdminToken, if set, is sent as a bearer token to the admin endpoints
+	// (cluster status, events and network profiles), for servers started
+	// with --admin-tokens.
+	AdminToken string
+}
+
+// New returns a Client for the server at baseURL, such as
+// "http://localhost:8080".
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: want http(s)://host[:port]", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &Client{baseURL: u}, nil
+}
+
+// Error is returned for responses with an unexpected status code.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Message is the body of the response, or the message of a JSON error
+	// response.
+	Message string
+
+	// Code is the error code of a JSON error response, such as
+	// "variant_out_of_range" or "not_ready", or empty.
+	Code string
+
+	// RetryAfter is the delay from the Retry-After header, sent with rate
+	// limited requests and during maintenance windows, or zero.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// Reason is an active reason of a health state.
+type Reason struct {
+	Code    string    `json:"code"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// BuildInfo describes the build and the enabled features of a server.
+type BuildInfo struct {
+	Version      string          `json:"version"`
+	Commit       string          `json:"commit"`
+	Date         string          `json:"build_date"`
+	GoVersion    string          `json:"go_version"`
+	Features     []string        `json:"features"`
+	Experimental map[string]bool `json:"experimental"`
+}
+
+// Health is the health state of a server.
+type Health struct {
+	// Status is "starting", "ready", "degraded" or "stopping".
+	Status  string    `json:"status"`
+	Since   time.Time `json:"since"`
+	Reasons []Reason  `json:"reasons"`
+
+	// Stats are the playlist statistics, such as "sequence_number".
+	Stats map[string]any `json:"stats"`
+	Build BuildInfo      `json:"build"`
+}
+
+// Version is the build of a server and how long it has been running.
+type Version struct {
+	BuildInfo
+	Started time.Time `json:"started"`
+	Uptime  float64   `json:"uptime_seconds"`
+}
+
+// ClusterStatus is the Raft state of a cluster node.
+type ClusterStatus struct {
+	ClusterEnabled bool   `json:"cluster_enabled"`
+	IsLeader       bool   `json:"is_leader"`
+	LeaderAddress  string `json:"leader_address"`
+	RaftState      string `json:"raft_state"`
+	ClockSkew      string `json:"clock_skew,omitempty"`
+	RaftDelay      string `json:"raft_delay,omitempty"`
+
+	// Nodes is the replication progress of every node, measured against
+	// the commit index of the server.
+	Nodes []NodeProgress `json:"nodes"`
+}
+
+// NodeProgress is how far a cluster node is in the replicated log.
+type NodeProgress struct {
+	ID                string           `json:"id"`
+	RaftState         string           `json:"raft_state,omitempty"`
+	AppliedIndex      uint64           `json:"applied_index"`
+	CommitIndex       uint64           `json:"commit_index"`
+	LastSnapshotIndex uint64           `json:"last_snapshot_index"`
+	Snapshot          SnapshotProgress `json:"snapshot"`
+	Lag               uint64           `json:"lag"`
+	CaughtUp          bool             `json:"caught_up"`
+	Error             string           `json:"error,omitempty"`
+}
+
+// SnapshotProgress describes the snapshots a node installed from the leader.
+type SnapshotProgress struct {
+	Installing bool   `json:"installing"`
+	Index      uint64 `json:"index,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Received   int64  `json:"received,omitempty"`
+	Installed  uint64 `json:"installed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Event is an event published by a server.
+type Event struct {
+	ID      uint64         `json:"id"`
+	Time    time.Time      `json:"time"`
+	Type    string         `json:"type"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Events are the events returned by a poll.
+type Events struct {
+	Events []Event `json:"events"`
+
+	// Last is the ID to pass as since on the next poll.
+	Last uint64 `json:"last"`
+}
+
+// NetworkProfiles are the loaded network profiles of a server.
+type NetworkProfiles struct {
+	// Active is the active profile, or "" under normal conditions.
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+// Connections are the client connections of a server.
+type Connections struct {
+	Open     int               `json:"open"`
+	States   map[string]int    `json:"states"`
+	Accepted uint64            `json:"accepted"`
+	Closed   uint64            `json:"closed"`
+	Errors   map[string]uint64 `json:"errors"`
+
+	// AcceptedPerSecond and ErrorsPerSecond are averaged over the last
+	// minute.
+	AcceptedPerSecond float64 `json:"accepted_per_second"`
+	ErrorsPerSecond   float64 `json:"errors_per_second"`
+
+	// ClientCount is the number of client IPs with open connections, of
+	// which Clients lists those with the most.
+	ClientCount int                 `json:"client_count"`
+	Clients     []ClientConnections `json:"clients"`
+
+	// Throttled counts the requests refused with 429 by the server's rate
+	// limits and connection cap, by reason.
+	Throttled map[string]uint64 `json:"throttled"`
+}
+
+// ClientConnections is the number of open connections of one client IP.
+type ClientConnections struct {
+	IP   string `json:"ip"`
+	Open int    `json:"open"`
+}
+
+// VariantQuery holds the LL-HLS parameters of a variant playlist request.
+type VariantQuery struct {
+	// MSN, if set, holds the request until the segment with this media
+	// sequence number is live (_HLS_msn).
+	MSN *uint64
+
+	// Skip requests a delta update (_HLS_skip=YES).
+	Skip bool
+}
+
+// Playlist returns the master playlist, or the media playlist of a
+// single-variant source.
+func (c *Client) Playlist(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/playlist.m3u8", nil)
+}
+
+// VariantPlaylist returns the media playlist of the variant at index.
+func (c *Client) VariantPlaylist(ctx context.Context, index int, q VariantQuery) ([]byte, error) {
+	query := url.Values{}
+	if q.MSN != nil {
+		query.Set("_HLS_msn", strconv.FormatUint(*q.MSN, 10))
+	}
+	if q.Skip {
+		query.Set("_HLS_skip", "YES")
+	}
+	return c.getBytes(ctx, fmt.Sprintf("/variant/%d/playlist.m3u8", index), query)
+}
+
+// VODPlaylist returns the master playlist of the source served as a VOD
+// asset.
+func (c *Client) VODPlaylist(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/vod/playlist.m3u8", nil)
+}
+
+// RenditionPlaylist returns the media playlist of the alternate rendition at
+// index.
+func (c *Client) RenditionPlaylist(ctx context.Context, index int) ([]byte, error) {
+	return c.getBytes(ctx, fmt.Sprintf("/rendition/%d/playlist.m3u8", index), nil)
+}
+
+// VODVariantPlaylist returns the VOD media playlist of the variant at index.
+func (c *Client) VODVariantPlaylist(ctx context.Context, index int) ([]byte, error) {
+	return c.getBytes(ctx, fmt.Sprintf("/vod/variant/%d/playlist.m3u8", index), nil)
+}
+
+// StartOverPlaylist returns the master playlist of the start-over
+// presentation from program date time from (--program-date-time).
+func (c *Client) StartOverPlaylist(ctx context.Context, from time.Time) ([]byte, error) {
+	return c.getBytes(ctx, "/startover/playlist.m3u8", url.Values{"from": {from.Format(time.RFC3339Nano)}})
+}
+
+// StartOverVariantPlaylist returns the start-over media playlist of the
+// variant at index from program date time from (--program-date-time).
+func (c *Client) StartOverVariantPlaylist(ctx context.Context, index int, from time.Time) ([]byte, error) {
+	return c.getBytes(ctx, fmt.Sprintf("/startover/variant/%d/playlist.m3u8", index), url.Values{"from": {from.Format(time.RFC3339Nano)}})
+}
+
+// Key returns the dummy key with the ID id that the EXT-X-KEY tags point
+// to (--encryption).
+func (c *Client) Key(ctx context.Context, id uint64) ([]byte, error) {
+	return c.getBytes(ctx, fmt.Sprintf("/keys/%d", id), nil)
+}
+
+// Manifest returns the live DASH manifest (--dash).
+func (c *Client) Manifest(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/manifest.mpd", nil)
+}
+
+// SmoothManifest returns the live Smooth Streaming manifest (--smooth).
+func (c *Client) SmoothManifest(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/smooth/Manifest", nil)
+}
+
+// SmoothFragment returns the segment URL that a Smooth Streaming fragment
+// redirects to (--smooth). start is in 100ns units.
+func (c *Client) SmoothFragment(ctx context.Context, bitrate int, start uint64) (string, error) {
+	path := fmt.Sprintf("/smooth/QualityLevels(%d)/Fragments(video=%d)", bitrate, start)
+	resp, err := c.do(ctx, http.MethodGet, path, nil, nil, false, http.StatusFound)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Location"), nil
+}
+
+// SubtitlePlaylist returns the debug subtitle playlist (--debug-subtitles).
+func (c *Client) SubtitlePlaylist(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/subtitles/playlist.m3u8", nil)
+}
+
+// SubtitleSegment returns the debug subtitle segment with the media
+// sequence number sequence (--debug-subtitles).
+func (c *Client) SubtitleSegment(ctx context.Context, sequence uint64) ([]byte, error) {
+	return c.getBytes(ctx, fmt.Sprintf("/subtitles/%d.vtt", sequence), nil)
+}
+
+// Preview returns the HTML page that plays the stream in a browser.
+func (c *Client) Preview(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/preview", nil)
+}
+
+// Health returns the health state of the server. A server that is starting
+// or stopping answers 503, which is reported in Status rather than as an
+// error.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.getJSON(ctx, "/health", nil, false, &h, http.StatusOK, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Version returns the build of the server and its uptime.
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var v Version
+	if err := c.getJSON(ctx, "/version", nil, false, &v, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Metrics returns the Prometheus metrics of the server, in text format.
+func (c *Client) Metrics(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/metrics", nil)
+}
+
+// OpenAPI returns the OpenAPI document of the server's HTTP API.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	return c.getBytes(ctx, "/openapi.json", nil)
+}
+
+// ClusterStatus returns the Raft state of the server (--cluster).
+func (c *Client) ClusterStatus(ctx context.Context) (*ClusterStatus, error) {
+	var cs ClusterStatus
+	if err := c.getJSON(ctx, "/cluster/status", nil, true, &cs, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &cs, nil
+}
+
+// Events returns the events published after the ID since, of type typ
+// only if not empty. Pass the returned Last as since to poll for newer
+// events.
+func (c *Client) Events(ctx context.Context, since uint64, typ string) (*Events, error) {
+	query := url.Values{}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	if typ != "" {
+		query.Set("type", typ)
+	}
+	var e Events
+	if err := c.getJSON(ctx, "/events", query, true, &e, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// NetworkProfiles returns the loaded network profiles and the active one
+// (--network-profiles).
+func (c *Client) NetworkProfiles(ctx context.Context) (*NetworkProfiles, error) {
+	var np NetworkProfiles
+	if err := c.getJSON(ctx, "/network-profile", nil, true, &np, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &np, nil
+}
+
+// SetNetworkProfile makes the named network profile active, or restores
+// normal conditions if name is empty, and returns the resulting profiles.
+func (c *Client) SetNetworkProfile(ctx context.Context, name string) (*NetworkProfiles, error) {
+	body, err := json.Marshal(map[string]string{"active": name})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, http.MethodPut, "/network-profile", nil, body, true, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var np NetworkProfiles
+	if err := json.NewDecoder(resp.Body).Decode(&np); err != nil {
+		return nil, fmt.Errorf("decode PUT /network-profile: %w", err)
+	}
+	return &np, nil
+}
+
+// Reload makes the server re-fetch its source and splice the new segments
+// in at the live edge (POST /admin/reload).
+func (c *Client) Reload(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "/admin/reload", nil, nil, true, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Connections returns the open client connections of the server and how
+// many it accepted and failed.
+func (c *Client) Connections(ctx context.Context) (*Connections, error) {
+	var conns Connections
+	if err := c.getJSON(ctx, "/connections", nil, true, &conns, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &conns, nil
+}
+
+// getBytes returns the body of a successful GET of path.
+func (c *Client) getBytes(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read GET %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// getJSON decodes the body of a GET of path answered with one of codes
+// into v.
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, admin bool, v any, codes ...int) error {
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, admin, codes...)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode GET %s: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request and returns its response if its status is one of
+// codes, or an *Error otherwise. Redirects are not followed. The admin
+// token is only sent to admin endpoints.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, admin bool, codes ...int) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+	if admin && c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+
+	hc := *http.DefaultClient
+	if c.HTTPClient != nil {
+		hc = *c.HTTPClient
+	}
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	var doc struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if resp.Header.Get("Content-Type") == "application/json" && json.Unmarshal(msg, &doc) == nil && doc.Code != "" {
+		apiErr.Code, apiErr.Message = doc.Code, doc.Message
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return nil, fmt.Errorf("%s %s: %w", method, path, apiErr)
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		wantErr bool
+	}{
+		{"http://localhost:8080", false},
+		{"https://sim.example.com/encodersim/", false},
+		{"localhost:8080", true},
+		{"ftp://localhost", true},
+		{"http://", true},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.baseURL); (err != nil) != tt.wantErr {
+			t.Errorf("New(%q) error = %v, want error %v", tt.baseURL, err, tt.wantErr)
+		}
+	}
+}
+
+// TestOperations checks that every operation of the OpenAPI document has a
+// method of the same name.
+func TestOperations(t *testing.T) {
+	data, err := os.ReadFile("../server/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	typ := reflect.TypeOf(&Client{})
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			name := strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+			if _, ok := typ.MethodByName(name); !ok {
+				t.Errorf("%s %s: Client has no method %s", strings.ToUpper(method), path, name)
+			}
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	var lastQuery, lastAuth, lastKey, lastBody string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sim/variant/1/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "#EXTM3U\n")
+	})
+	mux.HandleFunc("/sim/variant/7/playlist.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"code":"variant_out_of_range","message":"Failed to generate variant playlist: variant index out of range: 7 (0-1)"}`)
+	})
+	mux.HandleFunc("/sim/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, `{"status":"starting","reasons":[],"stats":{"sequence_number":0},"build":{"version":"1.0"}}`)
+	})
+	mux.HandleFunc("/sim/events", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"events":[{"id":8,"type":"audit","message":"alice: PUT /network-profile"}],"last":8}`)
+	})
+	mux.HandleFunc("/sim/network-profile", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lastBody = string(body)
+		io.WriteString(w, `{"active":"3g","profiles":["3g"]}`)
+	})
+	mux.HandleFunc("/sim/admin/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/sim/connections", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"open":2,"states":{"active":1,"idle":1,"new":0},"client_count":1,"clients":[{"ip":"10.0.0.7","open":2}],"throttled":{"client_rate":3,"connections":0,"rate":0}}`)
+	})
+	mux.HandleFunc("/sim/smooth/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://cdn.example.com/seg3.m4s", http.StatusFound)
+	})
+	mux.HandleFunc("/sim/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastQuery, lastAuth, lastKey = r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("X-API-Key")
+		mux.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c, err := New(ts.URL + "/sim/")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.APIKey = "key"
+	c.AdminToken = "token"
+	ctx := context.Background()
+
+	msn := uint64(42)
+	if got, err := c.VariantPlaylist(ctx, 1, VariantQuery{MSN: &msn, Skip: true}); err != nil || string(got) != "#EXTM3U\n" {
+		t.Errorf("VariantPlaylist() = %q, %v", got, err)
+	}
+	if lastQuery != "_HLS_msn=42&_HLS_skip=YES" || lastKey != "key" || lastAuth != "" {
+		t.Errorf("variant request: query %q, key %q, auth %q", lastQuery, lastKey, lastAuth)
+	}
+
+	// A server that is starting is reported, not an error
+	h, err := c.Health(ctx)
+	if err != nil || h.Status != "starting" || h.Build.Version != "1.0" {
+		t.Errorf("Health() = %+v, %v", h, err)
+	}
+
+	e, err := c.Events(ctx, 7, "audit")
+	if err != nil || e.Last != 8 || len(e.Events) != 1 || e.Events[0].Type != "audit" {
+		t.Errorf("Events() = %+v, %v", e, err)
+	}
+	if lastQuery != "since=7&type=audit" || lastAuth != "Bearer token" {
+		t.Errorf("events request: query %q, auth %q", lastQuery, lastAuth)
+	}
+
+	np, err := c.SetNetworkProfile(ctx, "3g")
+	if err != nil || np.Active != "3g" || lastBody != `{"active":"3g"}` {
+		t.Errorf("SetNetworkProfile() = %+v, %v (body %s)", np, err, lastBody)
+	}
+	if err := c.Reload(ctx); err != nil || lastAuth != "Bearer token" {
+		t.Errorf("Reload() = %v (auth %q)", err, lastAuth)
+	}
+	conns, err := c.Connections(ctx)
+	if err != nil || conns.Open != 2 || len(conns.Clients) != 1 || conns.Clients[0].IP != "10.0.0.7" || conns.Throttled["client_rate"] != 3 || lastAuth != "Bearer token" {
+		t.Errorf("Connections() = %+v, %v (auth %q)", conns, err, lastAuth)
+	}
+
+	// Redirects are returned rather than followed
+	if got, err := c.SmoothFragment(ctx, 2000000, 0); err != nil || got != "https://cdn.example.com/seg3.m4s" {
+		t.Errorf("SmoothFragment() = %q, %v", got, err)
+	}
+
+	_, err = c.VariantPlaylist(ctx, 7, VariantQuery{})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "variant_out_of_range" || !strings.HasPrefix(apiErr.Message, "Failed to generate") {
+		t.Errorf("VariantPlaylist(7) error = %#v", err)
+	}
+
+	_, err = c.Manifest(ctx)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "Rate limit exceeded" || apiErr.RetryAfter != 5*time.Second {
+		t.Errorf("Manifest() error = %#v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+
+	"github.com/hashicorp/raft"
+)
+
+// archiveTimeout bounds the writes that copy one snapshot to the archive.
+const archiveTimeout = 30 * time.Second
+
+// archivingSnapshotStore is a raft.SnapshotStore that also copies every
+// snapshot it completes to Config.SnapshotArchive, under
+// "<raft-id>/<snapshot-id>/meta.json" and ".../state.bin", the layout of
+// raft.FileSnapshotStore. The archive is only written: Raft restores from
+// the wrapped store, and archived snapshots are never pruned.
+type archivingSnapshotStore struct {
+	raft.SnapshotStore
+	archive storage.Storage
+	prefix  string
+	logger  *slog.Logger
+}
+
+// Create begins a snapshot in the wrapped store, keeping a copy of what is
+// written for the archive.
+func (s *archivingSnapshotStore) Create(version raft.SnapshotVersion, index, term uint64, configuration raft.Configuration, configurationIndex uint64, trans raft.Transport) (raft.SnapshotSink, error) {
+	sink, err := s.SnapshotStore.Create(version, index, term, configuration, configurationIndex, trans)
+	if err != nil {
+		return nil, err
+	}
+	return &archivingSink{
+		SnapshotSink: sink,
+		store:        s,
+		meta: raft.SnapshotMeta{
+			Version:            version,
+			ID:                 sink.ID(),
+			Index:              index,
+			Term:               term,
+			Configuration:      configuration,
+			ConfigurationIndex: configurationIndex,
+		},
+	}, nil
+}
+
+// archivingSink tees a snapshot into a buffer and archives it on Close.
+type archivingSink struct {
+	raft.SnapshotSink
+	store *archivingSnapshotStore
+	meta  raft.SnapshotMeta
+	state bytes.Buffer
+}
+
+// Write writes p to the wrapped sink and keeps a copy.
+func (s *archivingSink) Write(p []byte) (int, error) {
+	n, err := s.SnapshotSink.Write(p)
+	s.state.Write(p[:n])
+	return n, err
+}
+
+// Close completes the snapshot in the wrapped store, then archives it. A
+// failure to archive is logged rather than failing the snapshot, which
+// Raft already has.
+func (s *archivingSink) Close() error {
+	if err := s.SnapshotSink.Close(); err != nil {
+		return err
+	}
+	s.meta.Size = int64(s.state.Len())
+	if err := s.store.save(s.meta, s.state.Bytes()); err != nil {
+		s.store.logger.Warn("failed to archive Raft snapshot", "id", s.meta.ID, "archive", s.store.archive.String(), "error", err)
+	}
+	return nil
+}
+
+// save writes the state of a snapshot, then its metadata, so that an
+// archived meta.json always has its state.bin.
+func (s *archivingSnapshotStore) save(meta raft.SnapshotMeta, state []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveTimeout)
+	defer cancel()
+
+	dir := path.Join(s.prefix, meta.ID)
+	if err := s.archive.Put(ctx, path.Join(dir, "state.bin"), state); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return s.archive.Put(ctx, path.Join(dir, "meta.json"), data)
+}
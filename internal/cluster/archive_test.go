@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+
+	"github.com/hashicorp/raft"
+)
+
+// failingStorage refuses every Put.
+type failingStorage struct{ storage.Storage }
+
+func (failingStorage) Put(ctx context.Context, key string, data []byte) error {
+	return errors.New("bucket unavailable")
+}
+
+func TestArchivingSnapshotStore(t *testing.T) {
+	ctx := context.Background()
+	archive := storage.NewMemory()
+	var logs bytes.Buffer
+	store := &archivingSnapshotStore{
+		SnapshotStore: raft.NewInmemSnapshotStore(),
+		archive:       archive,
+		prefix:        "node1",
+		logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+	create := func() raft.SnapshotSink {
+		t.Helper()
+		sink, err := store.Create(raft.SnapshotVersionMax, 42, 3, raft.Configuration{}, 1, nil)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		return sink
+	}
+
+	sink := create()
+	io.WriteString(sink, `{"state":`)
+	io.WriteString(sink, `"fsm"}`)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// The wrapped store still serves the snapshot to Raft
+	metas, err := store.List()
+	if err != nil || len(metas) != 1 {
+		t.Fatalf("List() = %v, %v", metas, err)
+	}
+	state, err := archive.Get(ctx, "node1/"+sink.ID()+"/state.bin")
+	if err != nil || string(state) != `{"state":"fsm"}` {
+		t.Errorf("archived state = %q, %v", state, err)
+	}
+	data, err := archive.Get(ctx, "node1/"+sink.ID()+"/meta.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta raft.SnapshotMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.ID != sink.ID() || meta.Index != 42 || meta.Term != 3 || meta.Size != int64(len(state)) {
+		t.Errorf("archived metadata = %+v", meta)
+	}
+
+	// A cancelled snapshot is not archived
+	sink = create()
+	io.WriteString(sink, "partial")
+	sink.Cancel()
+	if keys, _ := archive.List(ctx, "node1/"+sink.ID()); len(keys) != 0 {
+		t.Errorf("cancelled snapshot archived as %v", keys)
+	}
+
+	// Failing to archive is logged, not returned to Raft
+	store.archive = failingStorage{archive}
+	sink = create()
+	io.WriteString(sink, "state")
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close() with a failing archive error = %v, want nil", err)
+	}
+	if !strings.Contains(logs.String(), "bucket unavailable") {
+		t.Errorf("logs = %q, want the archive error", logs.String())
+	}
+}
@@ -2,13 +2,19 @@ package cluster
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
 )
 
 // Manager manages a Raft cluster for distributed state synchronization.
@@ -16,10 +22,13 @@ type Manager struct {
 	config    Config
 	raft      *raft.Raft
 	fsm       *PlaylistFSM
-	transport *raft.NetworkTransport
+	transport *snapshotTransport
+	stream    *streamLayer
+	store     *raftboltdb.BoltStore // nil unless Config.DataDir is set
 	logger    *slog.Logger
 	mu        sync.RWMutex
 	shutdown  bool
+	forwarded atomic.Uint64 // commands forwarded to the leader
 }
 
 // NewManager creates a new cluster manager.
@@ -54,23 +63,28 @@ func (m *Manager) Start(ctx context.Context) error {
 	raftConfig.LeaderLeaseTimeout = m.config.HeartbeatTimeout
 	raftConfig.SnapshotInterval = m.config.SnapshotInterval
 	raftConfig.SnapshotThreshold = m.config.SnapshotThreshold
+	raftConfig.TrailingLogs = m.config.TrailingLogs
 
 	// Use a no-op logger to avoid excessive Raft logging
 	raftConfig.Logger = newNoOpHCLogger()
 
-	// Create in-memory stores
-	logStore := raft.NewInmemStore()
-	stableStore := raft.NewInmemStore()
-	snapshotStore := raft.NewInmemSnapshotStore()
-
-	// Create network transport
-	addr, err := net.ResolveTCPAddr("tcp", m.config.BindAddr)
+	logStore, stableStore, snapshotStore, err := m.newStores()
 	if err != nil {
-		return fmt.Errorf("resolve bind address: %w", err)
+		return fmt.Errorf("create stores: %w", err)
+	}
+	if m.config.SnapshotArchive != nil {
+		snapshotStore = &archivingSnapshotStore{
+			SnapshotStore: snapshotStore,
+			archive:       m.config.SnapshotArchive,
+			prefix:        m.config.RaftID,
+			logger:        m.logger,
+		}
 	}
 
-	transport, err := raft.NewTCPTransport(m.config.BindAddr, addr, 3, 10*time.Second, nil)
+	// Create network transport
+	transport, err := m.newTransport()
 	if err != nil {
+		m.closeStore()
 		return fmt.Errorf("create transport: %w", err)
 	}
 	m.transport = transport
@@ -79,6 +93,7 @@ func (m *Manager) Start(ctx context.Context) error {
 	r, err := raft.NewRaft(raftConfig, m.fsm, logStore, stableStore, snapshotStore, transport)
 	if err != nil {
 		transport.Close()
+		m.closeStore()
 		return fmt.Errorf("create raft: %w", err)
 	}
 	m.raft = r
@@ -113,40 +128,85 @@ func (m *Manager) Start(ctx context.Context) error {
 	return nil
 }
 
-// AdvanceWindow submits an AdvanceWindowCommand to the Raft cluster.
-func (m *Manager) AdvanceWindow() error {
-	m.mu.RLock()
-	if m.shutdown {
-		m.mu.RUnlock()
-		return fmt.Errorf("cluster is shut down")
+// snapshotsRetained is how many snapshots a node keeps in Config.DataDir.
+const snapshotsRetained = 2
+
+// newStores creates the Raft log, stable and snapshot stores: in memory, or
+// in Config.DataDir, where they survive restarts. The log and stable stores
+// share one BoltDB file, raft.db.
+func (m *Manager) newStores() (raft.LogStore, raft.StableStore, raft.SnapshotStore, error) {
+	if m.config.DataDir == "" {
+		return raft.NewInmemStore(), raft.NewInmemStore(), raft.NewInmemSnapshotStore(), nil
 	}
-	r := m.raft
-	m.mu.RUnlock()
 
-	if r == nil {
-		return fmt.Errorf("cluster not started")
+	if err := os.MkdirAll(m.config.DataDir, 0o755); err != nil {
+		return nil, nil, nil, err
 	}
+	store, err := raftboltdb.NewBoltStore(filepath.Join(m.config.DataDir, "raft.db"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStore(m.config.DataDir, snapshotsRetained, io.Discard)
+	if err != nil {
+		store.Close()
+		return nil, nil, nil, err
+	}
+	m.store = store
+	last, _ := store.LastIndex()
+	m.logger.Info("using persistent Raft storage", "dir", m.config.DataDir, "last_index", last)
+	return store, store, snapshots, nil
+}
 
-	cmd := Command{
-		Type: CommandAdvanceWindow,
-		Data: AdvanceWindowCommand{VariantIndex: -1},
+// closeStore closes the persistent store, if there is one.
+func (m *Manager) closeStore() {
+	if m.store == nil {
+		return
 	}
+	if err := m.store.Close(); err != nil {
+		m.logger.Error("failed to close Raft storage", "error", err)
+	}
+}
 
-	data, err := EncodeCommand(cmd)
+// newTransport creates the Raft transport, which also serves the commands
+// forwarded by followers and progress queries. With Config.TransportDelay,
+// every message this node sends is delayed.
+func (m *Manager) newTransport() (*snapshotTransport, error) {
+	ln, err := net.Listen("tcp", m.config.BindAddr)
 	if err != nil {
-		return fmt.Errorf("encode command: %w", err)
+		return nil, err
 	}
-
-	future := r.Apply(data, 5*time.Second)
-	if err := future.Error(); err != nil {
-		return fmt.Errorf("apply command: %w", err)
+	// Peers reach this node at its listen address
+	if addr, ok := ln.Addr().(*net.TCPAddr); !ok || addr.IP.IsUnspecified() {
+		ln.Close()
+		return nil, fmt.Errorf("bind address %s is not advertisable", ln.Addr())
+	}
+	var wrap func(net.Conn) net.Conn
+	if m.config.TransportDelay != nil {
+		delayer := newDelayer(m.config.TransportDelay)
+		wrap = func(conn net.Conn) net.Conn { return newDelayedConn(conn, delayer) }
+		m.logger.Info("delaying Raft messages", "delay", m.config.TransportDelay.String())
 	}
+	m.stream = newStreamLayer(ln, wrap, map[byte]func(net.Conn){
+		forwardMagic:  m.handleForward,
+		progressMagic: m.handleProgress,
+	})
+	return newSnapshotTransport(raft.NewNetworkTransport(m.stream, 3, 10*time.Second, nil)), nil
+}
 
-	return nil
+// currentRaft returns the Raft instance, or nil if the cluster is not
+// started or shut down.
+func (m *Manager) currentRaft() *raft.Raft {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.shutdown {
+		return nil
+	}
+	return m.raft
 }
 
-// Initialize sets the initial FSM state.
-func (m *Manager) Initialize(state ClusterState) error {
+// apply submits cmd to the Raft log. On a follower, the command is forwarded
+// to the leader if forward is set, and fails with raft.ErrNotLeader if not.
+func (m *Manager) apply(cmd Command, forward bool) error {
 	m.mu.RLock()
 	if m.shutdown {
 		m.mu.RUnlock()
@@ -159,17 +219,20 @@ func (m *Manager) Initialize(state ClusterState) error {
 		return fmt.Errorf("cluster not started")
 	}
 
-	cmd := Command{
-		Type: CommandInitialize,
-		Data: InitializeCommand{State: state},
-	}
-
 	data, err := EncodeCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("encode command: %w", err)
 	}
 
-	future := r.Apply(data, 5*time.Second)
+	if forward && r.State() != raft.Leader {
+		leader, _ := r.LeaderWithID()
+		if leader == "" {
+			return fmt.Errorf("no leader to forward to: %w", raft.ErrNotLeader)
+		}
+		return m.forward(string(leader), data)
+	}
+
+	future := r.Apply(data, applyTimeout)
 	if err := future.Error(); err != nil {
 		return fmt.Errorf("apply command: %w", err)
 	}
@@ -177,6 +240,64 @@ func (m *Manager) Initialize(state ClusterState) error {
 	return nil
 }
 
+// ForwardedCommands returns how many commands this node forwarded to the
+// leader.
+func (m *Manager) ForwardedCommands() uint64 {
+	return m.forwarded.Load()
+}
+
+// TransportDelay returns the spec of Config.TransportDelay, or "" if Raft
+// messages are not delayed.
+func (m *Manager) TransportDelay() string {
+	if m.config.TransportDelay == nil {
+		return ""
+	}
+	return m.config.TransportDelay.String()
+}
+
+// AdvanceWindow submits an AdvanceWindowCommand to the Raft cluster.
+func (m *Manager) AdvanceWindow() error {
+	return m.AdvanceWindowBy(1)
+}
+
+// AdvanceWindowBy submits an AdvanceWindowCommand that advances the window by
+// steps segments in a single log entry. It fails with raft.ErrNotLeader on a
+// follower, so that the leader's own schedule is never applied twice.
+func (m *Manager) AdvanceWindowBy(steps int) error {
+	return m.apply(Command{
+		Type: CommandAdvanceWindow,
+		Data: AdvanceWindowCommand{VariantIndex: -1, Steps: steps},
+	}, false)
+}
+
+// ForwardAdvanceWindowBy is AdvanceWindowBy for advances requested on any
+// node: a follower forwards the command to the leader.
+func (m *Manager) ForwardAdvanceWindowBy(steps int) error {
+	return m.apply(Command{
+		Type: CommandAdvanceWindow,
+		Data: AdvanceWindowCommand{VariantIndex: -1, Steps: steps},
+	}, true)
+}
+
+// LeadershipLost reports whether err from AdvanceWindow or AdvanceWindowBy
+// means this node is not, or stopped being, the leader. Such a command may
+// or may not have been committed, and the new leader is responsible for
+// advancing, so it must not be retried.
+func LeadershipLost(err error) bool {
+	return errors.Is(err, raft.ErrNotLeader) ||
+		errors.Is(err, raft.ErrLeadershipLost) ||
+		errors.Is(err, raft.ErrLeadershipTransferInProgress)
+}
+
+// Initialize sets the initial FSM state. A follower forwards the command to
+// the leader.
+func (m *Manager) Initialize(state ClusterState) error {
+	return m.apply(Command{
+		Type: CommandInitialize,
+		Data: InitializeCommand{State: state},
+	}, true)
+}
+
 // GetState returns the current FSM state.
 func (m *Manager) GetState() ClusterState {
 	return m.fsm.GetState()
@@ -267,11 +388,48 @@ func (m *Manager) Shutdown() error {
 			return fmt.Errorf("close transport: %w", err)
 		}
 	}
+	m.closeStore()
 
 	m.logger.Info("cluster shut down")
 	return nil
 }
 
+// Barrier blocks until the leader applied every entry committed before, such
+// as the log replayed from Config.DataDir after a restart, to the FSM.
+func (m *Manager) Barrier(timeout time.Duration) error {
+	r := m.currentRaft()
+	if r == nil {
+		return fmt.Errorf("cluster not started")
+	}
+	if err := r.Barrier(timeout).Error(); err != nil {
+		return fmt.Errorf("barrier: %w", err)
+	}
+	return nil
+}
+
+// DataDir returns Config.DataDir, or "" if the Raft state is kept in memory.
+func (m *Manager) DataDir() string {
+	return m.config.DataDir
+}
+
+// WaitForState blocks until the FSM state is initialized or ctx is done, and
+// returns it.
+func (m *Manager) WaitForState(ctx context.Context) (ClusterState, error) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if state := m.GetState(); len(state.Variants) > 0 {
+			return state, nil
+		}
+		select {
+		case <-ctx.Done():
+			return ClusterState{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // WaitForLeader blocks until a leader is elected or context is canceled.
 func (m *Manager) WaitForLeader(ctx context.Context) error {
 	ticker := time.NewTicker(100 * time.Millisecond)
@@ -3,10 +3,13 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/hashicorp/raft"
 )
 
 func TestManager_NewManager(t *testing.T) {
@@ -205,6 +208,28 @@ func TestManager_AdvanceWindow(t *testing.T) {
 	}
 }
 
+func TestLeadershipLost(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"not leader", fmt.Errorf("apply command: %w", raft.ErrNotLeader), true},
+		{"leadership lost", fmt.Errorf("apply command: %w", raft.ErrLeadershipLost), true},
+		{"leadership transfer", fmt.Errorf("apply command: %w", raft.ErrLeadershipTransferInProgress), true},
+		{"enqueue timeout", fmt.Errorf("apply command: %w", raft.ErrEnqueueTimeout), false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LeadershipLost(tt.err); got != tt.want {
+				t.Errorf("LeadershipLost(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
 // createTestCluster creates a test cluster with the specified number of nodes.
 func createTestCluster(t *testing.T, logger *slog.Logger, nodeCount int) []*Manager {
 	t.Helper()
@@ -243,3 +268,67 @@ func createTestCluster(t *testing.T, logger *slog.Logger, nodeCount int) []*Mana
 
 	return managers
 }
+
+func TestManager_DataDir(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	addr := "127.0.0.1:20400"
+	start := func() *Manager {
+		t.Helper()
+		manager, err := NewManager(Config{
+			RaftID:           addr,
+			BindAddr:         addr,
+			Peers:            []string{addr},
+			HeartbeatTimeout: 100 * time.Millisecond,
+			ElectionTimeout:  100 * time.Millisecond,
+			DataDir:          dir,
+		}, logger)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if err := manager.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for !manager.IsLeader() && ctx.Err() == nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if !manager.IsLeader() {
+			t.Fatal("single node did not become leader")
+		}
+		return manager
+	}
+
+	manager := start()
+	if err := manager.Initialize(ClusterState{Variants: []VariantState{{TotalSegments: 5}}}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if err := manager.AdvanceWindowBy(3); err != nil {
+		t.Fatalf("AdvanceWindowBy() error = %v", err)
+	}
+	// Part of the state comes from a snapshot, the rest from the log
+	if err := manager.raft.Snapshot().Error(); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := manager.AdvanceWindowBy(4); err != nil {
+		t.Fatalf("AdvanceWindowBy() error = %v", err)
+	}
+	if err := manager.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	restarted := start()
+	defer restarted.Shutdown()
+	if err := restarted.Barrier(5 * time.Second); err != nil {
+		t.Fatalf("Barrier() error = %v", err)
+	}
+	state := restarted.GetState()
+	if len(state.Variants) != 1 || state.Variants[0].SequenceNumber != 7 || state.Variants[0].CurrentPosition != 2 {
+		t.Errorf("restarted state = %+v, want sequence 7 at position 2", state)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"net"
 	"time"
+
+	"github.com/agleyzer/encodersim/internal/faults"
+	"github.com/agleyzer/encodersim/internal/storage"
 )
 
 // Config holds the configuration for a cluster node.
@@ -22,6 +25,20 @@ type Config struct {
 	SnapshotInterval time.Duration
 	// SnapshotThreshold is the number of logs before taking a snapshot.
 	SnapshotThreshold uint64
+	// TrailingLogs is the number of logs kept after a snapshot. A follower
+	// further behind than that is sent a snapshot.
+	TrailingLogs uint64
+	// TransportDelay, if set, delays every message this node sends to its
+	// peers, to simulate cross-region links. The round trip between two
+	// nodes is the sum of their delays.
+	TransportDelay faults.Distribution
+	// DataDir, if set, is the directory where the Raft log, stable state
+	// and snapshots are kept, so that they survive restarts. By default they
+	// are kept in memory.
+	DataDir string
+	// SnapshotArchive, if set, receives a copy of every snapshot this node
+	// completes, for inspection or disaster recovery. Raft never reads it.
+	SnapshotArchive storage.Storage
 }
 
 // Validate checks if the configuration is valid.
@@ -61,6 +78,9 @@ func (c *Config) Validate() error {
 	if c.SnapshotThreshold == 0 {
 		c.SnapshotThreshold = 8192
 	}
+	if c.TrailingLogs == 0 {
+		c.TrailingLogs = 10240
+	}
 
 	return nil
 }
@@ -0,0 +1,211 @@
+package cluster
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/faults"
+	"github.com/agleyzer/encodersim/internal/sleep"
+)
+
+// delayQueueLen is how many writes a delayed connection holds in flight
+// before Write blocks.
+const delayQueueLen = 64
+
+// closeDrainTimeout bounds how long a closed delayed connection keeps
+// delivering the writes in flight. The underlying connection is closed when
+// it expires, interrupting reads and writes blocked on a peer that stopped
+// responding.
+var closeDrainTimeout = 2 * time.Second
+
+// delayer samples transport delays. It is safe for concurrent use.
+type delayer struct {
+	dist faults.Distribution
+	mu   sync.Mutex
+	rng  *rand.Rand
+}
+
+func newDelayer(dist faults.Distribution) *delayer {
+	return &delayer{dist: dist, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (d *delayer) sample() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dist.Sample(d.rng)
+}
+
+// delayedConn delivers everything written to it after a sampled delay,
+// without holding up the writer, as a long network path would. Writes keep
+// their order, so a short delay never overtakes a long one. A write that
+// would be delivered after the write deadline in effect when it was made
+// fails with a timeout, reported by the writes that follow it.
+type delayedConn struct {
+	net.Conn
+	delayer      *delayer
+	queue        chan delayedWrite
+	closed       chan struct{} // closed by Close
+	once         sync.Once
+	drainTimeout time.Duration   // closeDrainTimeout
+	drain        context.Context // done once drainTimeout after Close expires
+	abort        context.CancelFunc
+
+	mu       sync.Mutex
+	last     time.Time // delivery time of the latest write
+	deadline time.Time // write deadline, zero for none
+	err      error     // first error of the underlying connection
+}
+
+// delayedWrite is a write waiting for its delivery time.
+type delayedWrite struct {
+	data     []byte
+	at       time.Time
+	deadline time.Time // write deadline when it was made, zero for none
+}
+
+func newDelayedConn(conn net.Conn, delayer *delayer) *delayedConn {
+	c := &delayedConn{
+		Conn:    conn,
+		delayer: delayer,
+		queue:   make(chan delayedWrite, delayQueueLen),
+		closed:  make(chan struct{}),
+
+		drainTimeout: closeDrainTimeout,
+	}
+	c.drain, c.abort = context.WithCancel(context.Background())
+	go c.deliver()
+	return c
+}
+
+// Write queues b for delivery. Errors of the underlying connection are
+// reported by the writes that follow them.
+func (c *delayedConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return 0, c.err
+	}
+	now := time.Now()
+	deadline := c.deadline
+	if !deadline.IsZero() && !now.Before(deadline) {
+		c.mu.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	}
+	at := now.Add(c.delayer.sample())
+	if at.Before(c.last) {
+		at = c.last
+	}
+	c.last = at
+	c.mu.Unlock()
+
+	select {
+	case c.queue <- delayedWrite{data: append([]byte(nil), b...), at: at, deadline: deadline}:
+		return len(b), nil
+	case <-c.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// Read reads from the connection, failing once it is closed.
+func (c *delayedConn) Read(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return c.Conn.Read(b)
+}
+
+// SetDeadline sets the read deadline of the underlying connection and the
+// write deadline of the delayed writes.
+func (c *delayedConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline by which the writes that follow must be
+// delivered. Writes are queued without blocking, so it is checked when they
+// are delivered rather than passed to the underlying connection.
+func (c *delayedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return nil
+}
+
+// Close stops accepting writes and closes the connection once the writes in
+// flight are delivered, as a network path would still deliver them, or
+// after the drain timeout at the latest.
+func (c *delayedConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		time.AfterFunc(c.drainTimeout, func() {
+			c.abort()
+			c.Conn.Close()
+		})
+	})
+	return nil
+}
+
+// deliver writes queued data to the underlying connection when it is due,
+// and closes it after Close once the queue is empty. Writes due after the
+// drain timeout are dropped.
+func (c *delayedConn) deliver() {
+	defer c.Conn.Close()
+	for {
+		select {
+		case w := <-c.queue:
+			if !c.write(w) {
+				return
+			}
+		case <-c.closed:
+			drainBy := time.Now().Add(c.drainTimeout)
+			for {
+				select {
+				case w := <-c.queue:
+					if w.at.After(drainBy) || !c.write(w) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes w to the underlying connection when it is due, and reports
+// whether it succeeded. A write due after its deadline fails at the
+// deadline.
+func (c *delayedConn) write(w delayedWrite) bool {
+	if !w.deadline.IsZero() && w.at.After(w.deadline) {
+		if sleep.Sleep(c.drain, time.Until(w.deadline)) == nil {
+			c.mu.Lock()
+			c.err = os.ErrDeadlineExceeded
+			c.mu.Unlock()
+		}
+		return false
+	}
+	if sleep.Sleep(c.drain, time.Until(w.at)) != nil {
+		return false
+	}
+	if _, err := c.Conn.Write(w.data); err != nil {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		return false
+	}
+	return true
+}
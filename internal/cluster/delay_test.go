@@ -0,0 +1,211 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/faults"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestDelayedConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+
+	// Each write gets its own delay, but the writes arrive in order
+	dist, err := faults.ParseDistribution("uniform:50ms:150ms")
+	if err != nil {
+		t.Fatalf("ParseDistribution() error = %v", err)
+	}
+	stream := newStreamLayer(ln, func(conn net.Conn) net.Conn { return newDelayedConn(conn, newDelayer(dist)) }, nil)
+	defer stream.Close()
+
+	conn, err := stream.Dial(raft.ServerAddress(ln.Addr().String()), time.Second)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	want := "0123456789"
+	for i := range want {
+		if _, err := conn.Write([]byte(want[i : i+1])); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("Write() blocked for %s", elapsed)
+	}
+
+	peer, err := stream.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error = %v", err)
+	}
+	defer peer.Close()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(peer, got); err != nil {
+		t.Fatalf("ReadFull() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("received after %s, want at least 50ms", elapsed)
+	}
+
+	// Writes after Close fail instead of blocking
+	conn.Close()
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Error("Write() after Close() should fail")
+	}
+}
+
+func TestDelayedConn_WriteDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	dist, err := faults.ParseDistribution("fixed:100ms")
+	if err != nil {
+		t.Fatalf("ParseDistribution() error = %v", err)
+	}
+	conn := newDelayedConn(client, newDelayer(dist))
+	defer conn.Close()
+
+	// The write is queued, but would arrive after its deadline
+	conn.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	conn.SetWriteDeadline(time.Time{})
+	time.Sleep(50 * time.Millisecond)
+	if _, err := conn.Write([]byte("y")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() after a late write error = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(-time.Second))
+	if _, err := conn.Write([]byte("z")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Write() past the deadline error = %v, want os.ErrDeadlineExceeded", err)
+	}
+}
+
+func TestDelayedConn_CloseTimeout(t *testing.T) {
+	defer func(d time.Duration) { closeDrainTimeout = d }(closeDrainTimeout)
+	closeDrainTimeout = 50 * time.Millisecond
+
+	// The peer never reads or writes, so the delivery of the write blocks
+	client, server := net.Pipe()
+	defer server.Close()
+	dist, err := faults.ParseDistribution("fixed:1ms")
+	if err != nil {
+		t.Fatalf("ParseDistribution() error = %v", err)
+	}
+	conn := newDelayedConn(client, newDelayer(dist))
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := client.Read(make([]byte, 1))
+		read <- err
+	}()
+	start := time.Now()
+	conn.Close()
+	select {
+	case err := <-read:
+		if err == nil {
+			t.Error("Read() succeeded, want an error once the connection is closed")
+		}
+		if elapsed := time.Since(start); elapsed < closeDrainTimeout {
+			t.Errorf("connection closed after %s, before the drain timeout", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a blocked Read() was not interrupted after the drain timeout")
+	}
+}
+
+func TestManager_TransportDelay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	delay, err := faults.ParseDistribution("fixed:25ms")
+	if err != nil {
+		t.Fatalf("ParseDistribution() error = %v", err)
+	}
+
+	peers := make([]string, 3)
+	for i := range peers {
+		peers[i] = fmt.Sprintf("127.0.0.1:%d", 20100+i)
+	}
+	managers := make([]*Manager, len(peers))
+	for i := range peers {
+		manager, err := NewManager(Config{
+			RaftID:           peers[i],
+			BindAddr:         peers[i],
+			Peers:            peers,
+			HeartbeatTimeout: 500 * time.Millisecond,
+			ElectionTimeout:  500 * time.Millisecond,
+			TransportDelay:   delay,
+		}, logger)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if err := manager.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		defer manager.Shutdown()
+		managers[i] = manager
+	}
+	if got := managers[0].TransportDelay(); got != "fixed:25ms" {
+		t.Errorf("TransportDelay() = %q, want fixed:25ms", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var leader *Manager
+	for leader == nil && ctx.Err() == nil {
+		for _, m := range managers {
+			if m.IsLeader() {
+				leader = m
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if leader == nil {
+		t.Fatal("no leader elected with delayed transport")
+	}
+
+	// A commit needs a round trip to a follower: at least 50ms
+	if err := leader.Initialize(ClusterState{TotalSegments: 5}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	start := time.Now()
+	if err := leader.AdvanceWindowBy(2); err != nil {
+		t.Fatalf("AdvanceWindowBy() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("advance committed after %s, want at least 50ms", elapsed)
+	}
+
+	for _, m := range managers {
+		for m.GetState().SequenceNumber != 2 && ctx.Err() == nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if state := m.GetState(); state.SequenceNumber != 2 {
+			t.Errorf("node %s at sequence %d, want 2", m.config.BindAddr, state.SequenceNumber)
+		}
+	}
+}
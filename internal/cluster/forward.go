@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Only the leader can apply commands to the Raft log, so a follower forwards
+// the commands submitted to it to the leader over a small RPC on the Raft
+// port: the follower connects, sends forwardMagic and a gob-encoded
+// forwardRequest, and the leader applies the command and answers with a
+// forwardResponse. Each connection carries one command.
+
+// forwardMagic marks a forwarding connection. Raft's RPC type bytes are
+// small integers.
+const forwardMagic = 'F'
+
+// forwardTimeout bounds a forwarded command, including the leader's apply.
+const forwardTimeout = 10 * time.Second
+
+// applyTimeout bounds the Raft apply of a command.
+const applyTimeout = 5 * time.Second
+
+// forwardRequest carries an encoded Command to the leader.
+type forwardRequest struct {
+	Command []byte
+}
+
+// forwardResponse is the leader's answer to a forwardRequest.
+type forwardResponse struct {
+	Error     string
+	NotLeader bool // the receiver was not the leader
+}
+
+// forward sends an encoded command to the leader at addr.
+func (m *Manager) forward(addr string, data []byte) error {
+	conn, err := m.stream.Dial(raft.ServerAddress(addr), forwardTimeout)
+	if err != nil {
+		return fmt.Errorf("forward to leader %s: %w", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	if _, err := conn.Write([]byte{forwardMagic}); err != nil {
+		return fmt.Errorf("forward to leader %s: %w", addr, err)
+	}
+	if err := gob.NewEncoder(conn).Encode(forwardRequest{Command: data}); err != nil {
+		return fmt.Errorf("forward to leader %s: %w", addr, err)
+	}
+	var resp forwardResponse
+	if err := gob.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("forward to leader %s: %w", addr, err)
+	}
+
+	m.forwarded.Add(1)
+	if resp.NotLeader {
+		return fmt.Errorf("forward to %s: %w", addr, raft.ErrNotLeader)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("forward to leader %s: %s", addr, resp.Error)
+	}
+	return nil
+}
+
+// handleForward applies a command forwarded by a follower.
+func (m *Manager) handleForward(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+
+	var magic [1]byte
+	if _, err := conn.Read(magic[:]); err != nil {
+		return
+	}
+	var req forwardRequest
+	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
+		m.logger.Warn("invalid forwarded command", "remote", conn.RemoteAddr().String(), "error", err)
+		return
+	}
+
+	var resp forwardResponse
+	if err := m.applyForwarded(req.Command); err != nil {
+		resp.Error = err.Error()
+		resp.NotLeader = LeadershipLost(err)
+	}
+	if err := gob.NewEncoder(conn).Encode(resp); err != nil {
+		m.logger.Warn("failed to answer forwarded command", "remote", conn.RemoteAddr().String(), "error", err)
+	}
+}
+
+// applyForwarded applies a forwarded command if it is one that followers
+// may submit.
+func (m *Manager) applyForwarded(data []byte) error {
+	cmd, err := DecodeCommand(data)
+	if err != nil {
+		return err
+	}
+	if cmd.Type != CommandAdvanceWindow && cmd.Type != CommandInitialize {
+		return fmt.Errorf("command type %d cannot be forwarded", cmd.Type)
+	}
+
+	r := m.currentRaft()
+	if r == nil {
+		return fmt.Errorf("cluster not started")
+	}
+	if r.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	if err := r.Apply(data, applyTimeout).Error(); err != nil {
+		return fmt.Errorf("apply command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+func TestStreamLayer_Route(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	handled := make(chan string, 1)
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		handled <- string(data)
+	}
+	stream := newStreamLayer(ln, nil, map[byte]func(net.Conn){forwardMagic: handle, progressMagic: handle})
+	defer stream.Close()
+	addr := raft.ServerAddress(ln.Addr().String())
+
+	tests := []struct {
+		name    string
+		data    string
+		handled bool
+	}{
+		{"raft", "\x00raft", false},
+		{"forward", "Fcommand", true},
+		{"progress", "Pquery", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := stream.Dial(addr, time.Second)
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			conn.Write([]byte(tt.data))
+			conn.Close()
+
+			if tt.handled {
+				if got := <-handled; got != tt.data {
+					t.Errorf("handler read %q, want %q", got, tt.data)
+				}
+				return
+			}
+			peer, err := stream.Accept()
+			if err != nil {
+				t.Fatalf("Accept() error = %v", err)
+			}
+			defer peer.Close()
+			if got, _ := io.ReadAll(peer); string(got) != tt.data {
+				t.Errorf("Raft connection read %q, want %q", got, tt.data)
+			}
+		})
+	}
+
+	stream.Close()
+	if _, err := stream.Accept(); err == nil {
+		t.Error("Accept() after Close() should fail")
+	}
+}
+
+func TestManager_Forward(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	peers := make([]string, 3)
+	for i := range peers {
+		peers[i] = fmt.Sprintf("127.0.0.1:%d", 20200+i)
+	}
+	managers := make([]*Manager, len(peers))
+	for i := range peers {
+		manager, err := NewManager(Config{
+			RaftID:           peers[i],
+			BindAddr:         peers[i],
+			Peers:            peers,
+			HeartbeatTimeout: 100 * time.Millisecond,
+			ElectionTimeout:  100 * time.Millisecond,
+		}, logger)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if err := manager.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+		defer manager.Shutdown()
+		managers[i] = manager
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, m := range managers {
+		if err := m.WaitForLeader(ctx); err != nil {
+			t.Fatalf("WaitForLeader() error = %v", err)
+		}
+	}
+	var follower *Manager
+	for _, m := range managers {
+		if !m.IsLeader() {
+			follower = m
+			break
+		}
+	}
+
+	// Commands submitted to a follower are applied through the leader
+	if err := follower.Initialize(ClusterState{TotalSegments: 5}); err != nil {
+		t.Fatalf("Initialize() on a follower error = %v", err)
+	}
+	if err := follower.ForwardAdvanceWindowBy(2); err != nil {
+		t.Fatalf("ForwardAdvanceWindowBy() on a follower error = %v", err)
+	}
+	if got := follower.ForwardedCommands(); got != 2 {
+		t.Errorf("ForwardedCommands() = %d, want 2", got)
+	}
+
+	// The leader's own advances are never forwarded
+	if err := follower.AdvanceWindowBy(1); !LeadershipLost(err) {
+		t.Errorf("AdvanceWindowBy() on a follower error = %v, want a leadership error", err)
+	}
+
+	for _, m := range managers {
+		for m.GetState().SequenceNumber != 2 && ctx.Err() == nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if state := m.GetState(); state.SequenceNumber != 2 || state.CurrentPosition != 2 {
+			t.Errorf("node %s at position %d sequence %d, want 2 and 2", m.config.BindAddr, state.CurrentPosition, state.SequenceNumber)
+		}
+	}
+}
+
+func TestManager_ApplyForwarded(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := NewManager(Config{
+		RaftID:   "node1",
+		BindAddr: "127.0.0.1:0",
+		Peers:    []string{"127.0.0.1:0"},
+	}, logger)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data func() []byte
+	}{
+		{"garbage", func() []byte { return []byte("garbage") }},
+		{"unknown command", func() []byte {
+			data, _ := EncodeCommand(Command{Type: 99, Data: AdvanceWindowCommand{}})
+			return data
+		}},
+		{"not started", func() []byte {
+			data, _ := EncodeCommand(Command{Type: CommandAdvanceWindow, Data: AdvanceWindowCommand{Steps: 1}})
+			return data
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := manager.applyForwarded(tt.data()); err == nil {
+				t.Error("applyForwarded() should fail")
+			}
+		})
+	}
+}
@@ -40,6 +40,9 @@ type VariantState struct {
 	SequenceNumber uint64
 	// TotalSegments is the total number of segments for this variant.
 	TotalSegments int
+	// Source is the playlist URL of the source variant served at Index, so
+	// that every node serves the same rendition at each index.
+	Source string
 }
 
 // CommandType identifies the type of Raft command.
@@ -62,6 +65,9 @@ type Command struct {
 type AdvanceWindowCommand struct {
 	// VariantIndex specifies which variant to advance (-1 for all variants).
 	VariantIndex int
+	// Steps is how many segments to advance by, for catching up on advances
+	// that could not be applied earlier. Zero (as sent by older nodes) means 1.
+	Steps int
 }
 
 // InitializeCommand sets the initial state.
@@ -117,12 +123,14 @@ func (f *PlaylistFSM) applyAdvanceWindow(data any) any {
 		return fmt.Errorf("invalid advance window command data")
 	}
 
+	steps := max(advCmd.Steps, 1)
+
 	if len(f.state.Variants) == 0 {
 		// Single media playlist mode
 		if f.state.TotalSegments > 0 {
-			f.state.CurrentPosition = (f.state.CurrentPosition + 1) % f.state.TotalSegments
+			f.state.CurrentPosition = (f.state.CurrentPosition + steps) % f.state.TotalSegments
 		}
-		f.state.SequenceNumber++
+		f.state.SequenceNumber += uint64(steps)
 		f.logger.Debug("advanced window", "position", f.state.CurrentPosition, "sequence", f.state.SequenceNumber)
 	} else {
 		// Multi-variant mode
@@ -130,9 +138,9 @@ func (f *PlaylistFSM) applyAdvanceWindow(data any) any {
 			// Advance all variants
 			for i := range f.state.Variants {
 				if f.state.Variants[i].TotalSegments > 0 {
-					f.state.Variants[i].CurrentPosition = (f.state.Variants[i].CurrentPosition + 1) % f.state.Variants[i].TotalSegments
+					f.state.Variants[i].CurrentPosition = (f.state.Variants[i].CurrentPosition + steps) % f.state.Variants[i].TotalSegments
 				}
-				f.state.Variants[i].SequenceNumber++
+				f.state.Variants[i].SequenceNumber += uint64(steps)
 			}
 			f.logger.Debug("advanced all variants")
 		} else {
@@ -140,9 +148,9 @@ func (f *PlaylistFSM) applyAdvanceWindow(data any) any {
 			if advCmd.VariantIndex >= 0 && advCmd.VariantIndex < len(f.state.Variants) {
 				v := &f.state.Variants[advCmd.VariantIndex]
 				if v.TotalSegments > 0 {
-					v.CurrentPosition = (v.CurrentPosition + 1) % v.TotalSegments
+					v.CurrentPosition = (v.CurrentPosition + steps) % v.TotalSegments
 				}
-				v.SequenceNumber++
+				v.SequenceNumber += uint64(steps)
 				f.logger.Debug("advanced variant", "index", advCmd.VariantIndex, "position", v.CurrentPosition, "sequence", v.SequenceNumber)
 			}
 		}
@@ -246,3 +254,12 @@ func EncodeCommand(cmd Command) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// DecodeCommand decodes a command encoded by EncodeCommand.
+func DecodeCommand(data []byte) (Command, error) {
+	var cmd Command
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cmd); err != nil {
+		return Command{}, fmt.Errorf("decode command: %w", err)
+	}
+	return cmd, nil
+}
@@ -262,3 +262,52 @@ func (m *mockSnapshotSink) ID() string {
 func (m *mockSnapshotSink) Cancel() error {
 	return nil
 }
+
+func TestPlaylistFSM_Apply_AdvanceWindow_Steps(t *testing.T) {
+	tests := []struct {
+		name         string
+		steps        int
+		wantPosition int
+		wantSequence uint64
+	}{
+		{"zero means one", 0, 3, 11},
+		{"single step", 1, 3, 11},
+		{"catch up", 3, 0, 13},
+		{"wrap past end", 6, 3, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(bytes.NewBuffer(nil), nil))
+			fsm := NewPlaylistFSM(logger)
+
+			initData, err := EncodeCommand(Command{
+				Type: CommandInitialize,
+				Data: InitializeCommand{
+					State: ClusterState{CurrentPosition: 2, SequenceNumber: 10, TotalSegments: 5},
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to encode init command: %v", err)
+			}
+			fsm.Apply(&raft.Log{Data: initData})
+
+			advData, err := EncodeCommand(Command{
+				Type: CommandAdvanceWindow,
+				Data: AdvanceWindowCommand{VariantIndex: -1, Steps: tt.steps},
+			})
+			if err != nil {
+				t.Fatalf("failed to encode advance command: %v", err)
+			}
+			fsm.Apply(&raft.Log{Data: advData})
+
+			state := fsm.GetState()
+			if state.CurrentPosition != tt.wantPosition {
+				t.Errorf("CurrentPosition = %d, want %d", state.CurrentPosition, tt.wantPosition)
+			}
+			if state.SequenceNumber != tt.wantSequence {
+				t.Errorf("SequenceNumber = %d, want %d", state.SequenceNumber, tt.wantSequence)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package cluster
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Any node can report how far every node is in the replicated log, so that
+// operators can tell when a newly joined node has caught up and can take
+// traffic. A node answers a connection that starts with progressMagic on the
+// Raft port with its gob-encoded NodeProgress.
+
+// progressMagic marks a progress query connection.
+const progressMagic = 'P'
+
+// progressTimeout bounds the progress query of a peer.
+const progressTimeout = 2 * time.Second
+
+// caughtUpLag is how many committed entries a node may not have applied yet
+// and still count as caught up: a follower learns about a commit with the
+// leader's next message.
+const caughtUpLag = 1
+
+// SnapshotProgress describes the snapshots a node installed from the leader.
+type SnapshotProgress struct {
+	// Installing is set while a snapshot is received and restored.
+	Installing bool `json:"installing"`
+	// Index is the last log index covered by the latest snapshot install.
+	Index uint64 `json:"index,omitempty"`
+	// Size is the size of the latest snapshot in bytes, and Received how
+	// many of them arrived.
+	Size     int64 `json:"size,omitempty"`
+	Received int64 `json:"received,omitempty"`
+	// Installed counts the completed installs.
+	Installed uint64 `json:"installed"`
+	// Error is why the latest install failed, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// NodeProgress is how far a node is in the replicated log.
+type NodeProgress struct {
+	ID                string           `json:"id"`
+	RaftState         string           `json:"raft_state,omitempty"`
+	AppliedIndex      uint64           `json:"applied_index"`
+	CommitIndex       uint64           `json:"commit_index"`
+	LastSnapshotIndex uint64           `json:"last_snapshot_index"`
+	Snapshot          SnapshotProgress `json:"snapshot"`
+	// Lag is how many of the entries committed on the reporting node this
+	// node has not applied. On the leader, that is the whole log.
+	Lag uint64 `json:"lag"`
+	// CaughtUp is set if the node is reachable, not installing a snapshot
+	// and at most caughtUpLag entries behind.
+	CaughtUp bool `json:"caught_up"`
+	// Error is why the node could not be queried.
+	Error string `json:"error,omitempty"`
+}
+
+// Progress returns how far this node is in the replicated log. Lag and
+// CaughtUp are left for ClusterProgress.
+func (m *Manager) Progress() NodeProgress {
+	p := NodeProgress{ID: m.config.BindAddr, RaftState: m.State()}
+	r := m.currentRaft()
+	if r == nil {
+		return p
+	}
+	stats := r.Stats()
+	p.AppliedIndex, _ = strconv.ParseUint(stats["applied_index"], 10, 64)
+	p.CommitIndex, _ = strconv.ParseUint(stats["commit_index"], 10, 64)
+	p.LastSnapshotIndex, _ = strconv.ParseUint(stats["last_snapshot_index"], 10, 64)
+	if m.transport != nil {
+		p.Snapshot = m.transport.snapshotProgress()
+	}
+	return p
+}
+
+// ClusterProgress returns the progress of every peer, in the order of
+// Config.Peers, measured against this node's commit index. Peers that cannot
+// be queried are reported with an Error.
+func (m *Manager) ClusterProgress(ctx context.Context) []NodeProgress {
+	local := m.Progress()
+	nodes := make([]NodeProgress, len(m.config.Peers))
+	var wg sync.WaitGroup
+	for i, peer := range m.config.Peers {
+		if peer == m.config.BindAddr {
+			nodes[i] = local
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := m.queryProgress(ctx, peer)
+			if err != nil {
+				p = NodeProgress{ID: peer, Error: err.Error()}
+			}
+			nodes[i] = p
+		}()
+	}
+	wg.Wait()
+
+	for i := range nodes {
+		p := &nodes[i]
+		if local.CommitIndex > p.AppliedIndex {
+			p.Lag = local.CommitIndex - p.AppliedIndex
+		}
+		p.CaughtUp = p.Error == "" && !p.Snapshot.Installing && p.Lag <= caughtUpLag
+	}
+	return nodes
+}
+
+// queryProgress asks the peer at addr for its progress.
+func (m *Manager) queryProgress(ctx context.Context, addr string) (NodeProgress, error) {
+	var p NodeProgress
+	if m.stream == nil {
+		return p, fmt.Errorf("cluster not started")
+	}
+	conn, err := m.stream.Dial(raft.ServerAddress(addr), progressTimeout)
+	if err != nil {
+		return p, fmt.Errorf("query %s: %w", addr, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(progressTimeout))
+
+	if _, err := conn.Write([]byte{progressMagic}); err != nil {
+		return p, fmt.Errorf("query %s: %w", addr, err)
+	}
+	if err := gob.NewDecoder(conn).Decode(&p); err != nil {
+		return p, fmt.Errorf("query %s: %w", addr, err)
+	}
+	return p, nil
+}
+
+// handleProgress answers a progress query.
+func (m *Manager) handleProgress(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(progressTimeout))
+
+	var magic [1]byte
+	if _, err := conn.Read(magic[:]); err != nil {
+		return
+	}
+	if err := gob.NewEncoder(conn).Encode(m.Progress()); err != nil {
+		m.logger.Warn("failed to answer progress query", "remote", conn.RemoteAddr().String(), "error", err)
+	}
+}
+
+// snapshotTransport is a raft.NetworkTransport that tracks the snapshots
+// installed through it, which Raft does not report, by relaying the RPCs it
+// consumes.
+type snapshotTransport struct {
+	*raft.NetworkTransport
+	consumer  chan raft.RPC
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	progress SnapshotProgress // Received is kept in received
+	received atomic.Int64
+}
+
+func newSnapshotTransport(trans *raft.NetworkTransport) *snapshotTransport {
+	t := &snapshotTransport{
+		NetworkTransport: trans,
+		consumer:         make(chan raft.RPC),
+		closed:           make(chan struct{}),
+	}
+	go t.relay()
+	return t
+}
+
+// Consumer returns the channel of the RPCs received.
+func (t *snapshotTransport) Consumer() <-chan raft.RPC {
+	return t.consumer
+}
+
+// Close closes the transport.
+func (t *snapshotTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return t.NetworkTransport.Close()
+}
+
+// snapshotProgress returns the progress of the latest snapshot install.
+func (t *snapshotTransport) snapshotProgress() SnapshotProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.progress
+	p.Received = t.received.Load()
+	return p
+}
+
+// relay passes the RPCs received on to Raft, tracking snapshot installs.
+func (t *snapshotTransport) relay() {
+	for {
+		var rpc raft.RPC
+		select {
+		case rpc = <-t.NetworkTransport.Consumer():
+		case <-t.closed:
+			return
+		}
+		if req, ok := rpc.Command.(*raft.InstallSnapshotRequest); ok {
+			t.track(&rpc, req)
+		}
+		select {
+		case t.consumer <- rpc:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// track counts the bytes of the snapshot install rpc as Raft reads them and
+// records its outcome when Raft responds.
+func (t *snapshotTransport) track(rpc *raft.RPC, req *raft.InstallSnapshotRequest) {
+	t.mu.Lock()
+	t.progress = SnapshotProgress{
+		Installing: true,
+		Index:      req.LastLogIndex,
+		Size:       req.Size,
+		Installed:  t.progress.Installed,
+	}
+	t.received.Store(0)
+	t.mu.Unlock()
+
+	rpc.Reader = &countingReader{r: rpc.Reader, n: &t.received}
+	respCh := rpc.RespChan
+	tracked := make(chan raft.RPCResponse, 1)
+	rpc.RespChan = tracked
+	go func() {
+		var resp raft.RPCResponse
+		select {
+		case resp = <-tracked:
+		case <-t.closed:
+			return
+		}
+		t.mu.Lock()
+		t.progress.Installing = false
+		switch r, _ := resp.Response.(*raft.InstallSnapshotResponse); {
+		case resp.Error != nil:
+			t.progress.Error = resp.Error.Error()
+		case r == nil || !r.Success:
+			t.progress.Error = "rejected"
+		default:
+			t.progress.Installed++
+		}
+		t.mu.Unlock()
+		respCh <- resp
+	}()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestManager_ClusterProgress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	peers := make([]string, 3)
+	for i := range peers {
+		peers[i] = fmt.Sprintf("127.0.0.1:%d", 20300+i)
+	}
+	managers := make([]*Manager, len(peers))
+	for i := range peers {
+		manager, err := NewManager(Config{
+			RaftID:           peers[i],
+			BindAddr:         peers[i],
+			Peers:            peers,
+			HeartbeatTimeout: 100 * time.Millisecond,
+			ElectionTimeout:  100 * time.Millisecond,
+			TrailingLogs:     2,
+		}, logger)
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		defer manager.Shutdown()
+		managers[i] = manager
+	}
+
+	// Two nodes make a quorum; the third joins later
+	for _, m := range managers[:2] {
+		if err := m.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	var leader *Manager
+	for leader == nil && ctx.Err() == nil {
+		for _, m := range managers[:2] {
+			if m.IsLeader() {
+				leader = m
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if leader == nil {
+		t.Fatal("no leader elected")
+	}
+
+	// Compact the log so that the late node needs a snapshot
+	if err := leader.Initialize(ClusterState{TotalSegments: 5}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	for range 10 {
+		if err := leader.AdvanceWindowBy(1); err != nil {
+			t.Fatalf("AdvanceWindowBy() error = %v", err)
+		}
+	}
+	if err := leader.raft.Snapshot().Error(); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+
+	nodes := leader.ClusterProgress(ctx)
+	if len(nodes) != 3 {
+		t.Fatalf("ClusterProgress() returned %d nodes, want 3", len(nodes))
+	}
+	if late := nodes[2]; late.Error == "" || late.CaughtUp {
+		t.Errorf("unstarted node progress = %+v, want an error and not caught up", late)
+	}
+
+	if err := managers[2].Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	caughtUp := func() bool {
+		for _, p := range leader.ClusterProgress(ctx) {
+			if !p.CaughtUp {
+				return false
+			}
+		}
+		return true
+	}
+	for !caughtUp() && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("nodes not caught up: %+v", leader.ClusterProgress(context.Background()))
+	}
+
+	snapshot := managers[2].Progress().Snapshot
+	if snapshot.Installed != 1 || snapshot.Installing || snapshot.Size == 0 || snapshot.Received != snapshot.Size {
+		t.Errorf("late node snapshot progress = %+v, want one complete install", snapshot)
+	}
+	if state := managers[2].GetState(); state.SequenceNumber != 10 {
+		t.Errorf("late node at sequence %d, want 10", state.SequenceNumber)
+	}
+}
@@ -0,0 +1,117 @@
+package cluster
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// streamLayer is a raft.StreamLayer over TCP that shares its port with the
+// cluster's own RPCs: forwarding (see forward.go) and progress queries (see
+// progress.go). Connections whose first byte has a handler go to it, all
+// others to Raft, whose own RPC type bytes are small integers that never
+// collide with forwardMagic or progressMagic. Every connection can be
+// wrapped, for example to delay it.
+type streamLayer struct {
+	net.Listener
+	wrap     func(net.Conn) net.Conn
+	handlers map[byte]func(net.Conn)
+
+	raftConns chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// routeTimeout bounds how long an accepted connection may take to send its
+// first byte.
+const routeTimeout = 10 * time.Second
+
+// newStreamLayer starts routing the connections accepted by ln, by first
+// byte to handlers. A nil wrap leaves connections as they are.
+func newStreamLayer(ln net.Listener, wrap func(net.Conn) net.Conn, handlers map[byte]func(net.Conn)) *streamLayer {
+	if wrap == nil {
+		wrap = func(conn net.Conn) net.Conn { return conn }
+	}
+	l := &streamLayer{
+		Listener:  ln,
+		wrap:      wrap,
+		handlers:  handlers,
+		raftConns: make(chan net.Conn),
+		closed:    make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// Dial opens a connection to a peer.
+func (l *streamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", string(address), timeout)
+	if err != nil {
+		return nil, err
+	}
+	return l.wrap(conn), nil
+}
+
+// Accept waits for the next Raft connection.
+func (l *streamLayer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.raftConns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections.
+func (l *streamLayer) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts connections until the listener is closed.
+func (l *streamLayer) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.Close()
+			return
+		}
+		go l.route(l.wrap(conn))
+	}
+}
+
+// route hands conn to Raft or to a handler by its first byte.
+func (l *streamLayer) route(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(routeTimeout))
+	first, err := r.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	buffered := &bufferedConn{Conn: conn, r: r}
+	if handle, ok := l.handlers[first[0]]; ok {
+		handle(buffered)
+		return
+	}
+	select {
+	case l.raftConns <- buffered:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// bufferedConn reads through the reader that peeked at its first byte.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
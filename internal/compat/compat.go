@@ -0,0 +1,230 @@
+// Package compat defines the origin profiles served by the "compat"
+// subcommand, which lets player teams run compatibility suites against
+// several playlist flavors at once.
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// Profile is a predefined origin: synthetic variants exercising one set of
+// playlist features, served with its own window size.
+type Profile struct {
+	// Name identifies the profile on the command line and in the manifest.
+	Name string
+
+	// Description says what the profile exercises.
+	Description string
+
+	// Features lists the playlist features a player must handle, such as
+	// the tags the profile emits.
+	Features []string
+
+	// WindowSize is the number of segments in the sliding window.
+	WindowSize int
+
+	// build creates the profile's variants with segment URLs under base.
+	build func(base string) []variant.Variant
+}
+
+// Variants returns the profile's variants. Segment URLs point below
+// mediaBase + "/" + Name, where the player team hosts matching test media.
+func (p Profile) Variants(mediaBase string) []variant.Variant {
+	return p.build(strings.TrimSuffix(mediaBase, "/") + "/" + p.Name)
+}
+
+// Rendition ladder shared by the profiles.
+var ladder = []struct {
+	name       string
+	bandwidth  int
+	resolution string
+}{
+	{"720p", 3_000_000, "1280x720"},
+	{"360p", 800_000, "640x360"},
+}
+
+const (
+	segmentDuration = 6  // seconds
+	loopSegments    = 20 // two minutes of content
+	dvrSegments     = 1200
+	dvrWindow       = 600 // one hour at segmentDuration
+)
+
+// Profiles lists the predefined profiles in serving order. Low-latency HLS is
+// not included: the playlist generator does not produce partial segments.
+var Profiles = []Profile{
+	{
+		Name:        "hls-v3",
+		Description: "Plain HLS version 3 with MPEG-TS segments",
+		Features:    []string{"EXT-X-VERSION:3", "MPEG-TS"},
+		WindowSize:  6,
+		build: func(base string) []variant.Variant {
+			return buildLadder(base, loopSegments, "avc1.4d401f,mp4a.40.2", func(v string, i int) segment.Segment {
+				return segment.Segment{URL: fmt.Sprintf("%s/%s/segment%d.ts", base, v, i)}
+			})
+		},
+	},
+	{
+		Name:        "fmp4",
+		Description: "Fragmented MP4 segments with an EXT-X-MAP initialization section",
+		Features:    []string{"EXT-X-VERSION:6", "EXT-X-MAP", "fMP4"},
+		WindowSize:  6,
+		build: func(base string) []variant.Variant {
+			return buildLadder(base, loopSegments, "avc1.64001f,mp4a.40.2", func(v string, i int) segment.Segment {
+				return segment.Segment{
+					URL:     fmt.Sprintf("%s/%s/segment%d.m4s", base, v, i),
+					InitURL: fmt.Sprintf("%s/%s/init.mp4", base, v),
+				}
+			})
+		},
+	},
+	{
+		Name:        "dvr",
+		Description: "One-hour sliding window over a two-hour loop, for seeking within a long live window",
+		Features:    []string{"EXT-X-VERSION:3", "MPEG-TS", "long window"},
+		WindowSize:  dvrWindow,
+		build: func(base string) []variant.Variant {
+			return buildLadder(base, dvrSegments, "avc1.4d401f,mp4a.40.2", func(v string, i int) segment.Segment {
+				return segment.Segment{URL: fmt.Sprintf("%s/%s/segment%d.ts", base, v, i%loopSegments)}
+			})
+		},
+	},
+	{
+		Name:        "ad-markers",
+		Description: "A 30-second ad break marked with EXT-X-CUE-OUT/EXT-X-CUE-IN in every loop",
+		Features:    []string{"EXT-X-VERSION:3", "MPEG-TS", "EXT-X-CUE-OUT", "EXT-X-CUE-IN"},
+		WindowSize:  6,
+		build: func(base string) []variant.Variant {
+			const adStart, adSegments = 8, 5
+			return buildLadder(base, loopSegments, "avc1.4d401f,mp4a.40.2", func(v string, i int) segment.Segment {
+				seg := segment.Segment{URL: fmt.Sprintf("%s/%s/segment%d.ts", base, v, i)}
+				switch {
+				case i == adStart:
+					seg.URL = fmt.Sprintf("%s/%s/ad%d.ts", base, v, i-adStart)
+					seg.Tags = fmt.Sprintf("#EXT-X-CUE-OUT:%d\n", adSegments*segmentDuration)
+				case i > adStart && i < adStart+adSegments:
+					seg.URL = fmt.Sprintf("%s/%s/ad%d.ts", base, v, i-adStart)
+				case i == adStart+adSegments:
+					seg.Tags = "#EXT-X-CUE-IN\n"
+				}
+				return seg
+			})
+		},
+	},
+}
+
+// buildLadder creates one variant per ladder rung with count segments each.
+// newSegment returns the segment at index i of the named rendition; buildLadder
+// fills in its duration and indices.
+func buildLadder(base string, count int, codecs string, newSegment func(rendition string, i int) segment.Segment) []variant.Variant {
+	variants := make([]variant.Variant, len(ladder))
+	for vi, rung := range ladder {
+		segments := make([]segment.Segment, count)
+		for i := range segments {
+			seg := newSegment(rung.name, i)
+			seg.Duration = segmentDuration
+			seg.Sequence = i
+			seg.VariantIndex = vi
+			segments[i] = seg
+		}
+		variants[vi] = variant.Variant{
+			Bandwidth:      rung.bandwidth,
+			Resolution:     rung.resolution,
+			Codecs:         codecs,
+			PlaylistURL:    fmt.Sprintf("%s/%s/playlist.m3u8", base, rung.name),
+			Segments:       segments,
+			TargetDuration: segmentDuration,
+		}
+	}
+	return variants
+}
+
+// Select returns the profiles with the given names, in the order given, or
+// all profiles if names is empty.
+func Select(names []string) ([]Profile, error) {
+	if len(names) == 0 {
+		return Profiles, nil
+	}
+
+	selected := make([]Profile, 0, len(names))
+	for _, name := range names {
+		i := indexOf(name)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		selected = append(selected, Profiles[i])
+	}
+	return selected, nil
+}
+
+// Names returns the names of all profiles.
+func Names() []string {
+	names := make([]string, len(Profiles))
+	for i, p := range Profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func indexOf(name string) int {
+	for i, p := range Profiles {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Endpoint describes where one profile is served.
+type Endpoint struct {
+	Profile     string   `json:"profile"`
+	Description string   `json:"description"`
+	Features    []string `json:"features"`
+	Port        int      `json:"port"`
+	MasterURL   string   `json:"master_url"`
+	VariantURLs []string `json:"variant_urls"`
+	HealthURL   string   `json:"health_url"`
+}
+
+// Manifest lists the endpoints of a compat run.
+type Manifest struct {
+	MediaBase string     `json:"media_base"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// NewManifest describes profiles served on successive ports starting at
+// basePort, with URLs using host.
+func NewManifest(profiles []Profile, host string, basePort int, mediaBase string) Manifest {
+	m := Manifest{MediaBase: mediaBase, Endpoints: make([]Endpoint, len(profiles))}
+	for i, p := range profiles {
+		port := basePort + i
+		origin := fmt.Sprintf("http://%s:%d", host, port)
+		variantURLs := make([]string, len(ladder))
+		for v := range ladder {
+			variantURLs[v] = fmt.Sprintf("%s/variant/%d/playlist.m3u8", origin, v)
+		}
+		m.Endpoints[i] = Endpoint{
+			Profile:     p.Name,
+			Description: p.Description,
+			Features:    p.Features,
+			Port:        port,
+			MasterURL:   origin + "/playlist.m3u8",
+			VariantURLs: variantURLs,
+			HealthURL:   origin + "/health",
+		}
+	}
+	return m
+}
+
+// WriteJSON writes the manifest as indented JSON.
+func (m Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
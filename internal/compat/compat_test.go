@@ -0,0 +1,115 @@
+package compat
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/playlist"
+)
+
+func TestProfiles_Serve(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		profile string
+		advance int      // advances before rendering
+		want    []string // lines expected in variant 0's playlist
+	}{
+		{"hls-v3", 0, []string{"#EXT-X-VERSION:3", "https://media.test/hls-v3/720p/segment0.ts"}},
+		{"fmp4", 0, []string{"#EXT-X-VERSION:6", `#EXT-X-MAP:URI="https://media.test/fmp4/720p/init.mp4"`, "https://media.test/fmp4/720p/segment0.m4s"}},
+		{"dvr", 0, []string{"#EXT-X-VERSION:3", "https://media.test/dvr/720p/segment19.ts"}},
+		{"ad-markers", 6, []string{"#EXT-X-CUE-OUT:30", "https://media.test/ad-markers/720p/ad0.ts"}},
+		{"ad-markers", 12, []string{"#EXT-X-CUE-IN", "https://media.test/ad-markers/720p/segment13.ts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			profiles, err := Select([]string{tt.profile})
+			if err != nil {
+				t.Fatalf("Select() error = %v", err)
+			}
+			p := profiles[0]
+
+			lp, err := playlist.New(p.Variants("https://media.test/"), p.WindowSize, nil, logger)
+			if err != nil {
+				t.Fatalf("playlist.New() error = %v", err)
+			}
+			for range tt.advance {
+				lp.Advance()
+			}
+			out, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+
+			lines := strings.Split(out, "\n")
+			for _, want := range tt.want {
+				if !containsLine(lines, want) {
+					t.Errorf("playlist missing %q:\n%s", want, out)
+				}
+			}
+			if got := strings.Count(out, "#EXTINF:"); got != p.WindowSize {
+				t.Errorf("window has %d segments, want %d", got, p.WindowSize)
+			}
+		})
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSelect(t *testing.T) {
+	all, err := Select(nil)
+	if err != nil || len(all) != len(Profiles) {
+		t.Fatalf("Select(nil) = %d profiles, %v; want all %d", len(all), err, len(Profiles))
+	}
+
+	got, err := Select([]string{"fmp4", "hls-v3"})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "fmp4" || got[1].Name != "hls-v3" {
+		t.Errorf("Select() returned %v, want fmp4 then hls-v3", got)
+	}
+
+	if _, err := Select([]string{"llhls"}); err == nil {
+		t.Error("Select() with an unknown profile: expected error")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	profiles, err := Select([]string{"hls-v3", "dvr"})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewManifest(profiles, "origin.test", 9000, "https://media.test").WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON() error = %v", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+	if len(m.Endpoints) != 2 {
+		t.Fatalf("manifest has %d endpoints, want 2", len(m.Endpoints))
+	}
+	dvr := m.Endpoints[1]
+	if dvr.Profile != "dvr" || dvr.Port != 9001 || dvr.MasterURL != "http://origin.test:9001/playlist.m3u8" {
+		t.Errorf("dvr endpoint = %+v", dvr)
+	}
+	if len(dvr.VariantURLs) != 2 || dvr.VariantURLs[1] != "http://origin.test:9001/variant/1/playlist.m3u8" {
+		t.Errorf("dvr variant URLs = %v", dvr.VariantURLs)
+	}
+}
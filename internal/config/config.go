@@ -0,0 +1,273 @@
+// Package config loads encodersim settings from a YAML or JSON file
+// (--config), as an alternative to long command lines:
+//
+//	source: https://example.com/master.m3u8
+//	port: 8080
+//	window-size: 6
+//	loop-after: 10m
+//	variants: [0, 2]
+//	cluster:
+//	  raft-id: node1
+//	  raft-bind: 10.0.0.1:9000
+//	  peers: [10.0.0.1:9000, 10.0.0.2:9000, 10.0.0.3:9000]
+//	flags:
+//	  prerender: true
+//
+// Keys are named after the command-line flags. Settings without a key of
+// their own go under flags, by flag name. Flags given on the command line
+// take precedence over the file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/faults"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the contents of a configuration file. Zero values are unset and
+// leave the corresponding flag at its default.
+type Config struct {
+	// Source is the playlist URL or local path, used when the command line
+	// has none.
+	Source string `yaml:"source" json:"source"`
+
+	Port         int    `yaml:"port" json:"port"`
+	WindowSize   int    `yaml:"window-size" json:"window-size"`
+	WindowPolicy string `yaml:"window-policy" json:"window-policy"`
+	Master       bool   `yaml:"master" json:"master"`
+	Variants     []int  `yaml:"variants" json:"variants"`
+	LoopAfter    string `yaml:"loop-after" json:"loop-after"` // duration such as "1m30s"
+	LoopSegments int    `yaml:"loop-segments" json:"loop-segments"`
+	Verbose      bool   `yaml:"verbose" json:"verbose"`
+
+	// Cluster, if set, enables cluster mode.
+	Cluster *Cluster `yaml:"cluster" json:"cluster"`
+
+	// Flags sets any other command-line flag by name, such as
+	// "prerender: true" or "latency: variant=fixed:200ms".
+	Flags map[string]any `yaml:"flags" json:"flags"`
+}
+
+// Cluster holds the cluster mode settings.
+type Cluster struct {
+	RaftID    string   `yaml:"raft-id" json:"raft-id"`
+	RaftBind  string   `yaml:"raft-bind" json:"raft-bind"`
+	Peers     []string `yaml:"peers" json:"peers"`
+	ClockSkew string   `yaml:"clock-skew" json:"clock-skew"` // duration such as "90s"
+	RaftDelay string   `yaml:"raft-delay" json:"raft-delay"` // distribution such as "fixed:40ms"
+	RaftDir   string   `yaml:"raft-dir" json:"raft-dir"`
+	// SnapshotArchive is a storage location such as "s3://bucket/prefix".
+	SnapshotArchive string `yaml:"raft-snapshot-archive" json:"raft-snapshot-archive"`
+}
+
+// Load reads and validates a configuration file. Files ending in .json are
+// parsed as JSON, anything else as YAML.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parse := ParseYAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		parse = ParseJSON
+	}
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseYAML parses and validates a YAML configuration. Unknown keys are
+// rejected so that typos do not go unnoticed.
+func ParseYAML(data []byte) (*Config, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("configuration is empty")
+		}
+		return nil, fmt.Errorf("parse configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ParseJSON parses and validates a JSON configuration. Unknown keys are
+// rejected so that typos do not go unnoticed.
+func ParseJSON(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("configuration is empty")
+		}
+		return nil, fmt.Errorf("parse configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks the settings that can be checked without the rest of the
+// command line. Values under Flags are checked when they are applied.
+func (c *Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if c.WindowSize < 0 {
+		return fmt.Errorf("window-size must be at least 1")
+	}
+	for _, v := range c.Variants {
+		if v < 0 {
+			return fmt.Errorf("variants: index %d must not be negative", v)
+		}
+	}
+	if c.LoopAfter != "" {
+		if d, err := time.ParseDuration(c.LoopAfter); err != nil || d <= 0 {
+			return fmt.Errorf("loop-after: %q is not a positive duration", c.LoopAfter)
+		}
+	}
+	if c.LoopSegments < 0 {
+		return fmt.Errorf("loop-segments must not be negative")
+	}
+
+	if c.Cluster != nil {
+		if c.Cluster.RaftID == "" {
+			return fmt.Errorf("cluster: raft-id is required")
+		}
+		if _, _, err := net.SplitHostPort(c.Cluster.RaftBind); err != nil {
+			return fmt.Errorf("cluster: raft-bind must be host:port: %w", err)
+		}
+		if len(c.Cluster.Peers) == 0 {
+			return fmt.Errorf("cluster: peers is required")
+		}
+		for _, peer := range c.Cluster.Peers {
+			if _, _, err := net.SplitHostPort(peer); err != nil {
+				return fmt.Errorf("cluster: peer %q must be host:port: %w", peer, err)
+			}
+		}
+		if c.Cluster.ClockSkew != "" {
+			if _, err := time.ParseDuration(c.Cluster.ClockSkew); err != nil {
+				return fmt.Errorf("cluster: clock-skew: %w", err)
+			}
+		}
+		if c.Cluster.RaftDelay != "" {
+			if _, err := faults.ParseDistribution(c.Cluster.RaftDelay); err != nil {
+				return fmt.Errorf("cluster: raft-delay: %w", err)
+			}
+		}
+	}
+
+	for name := range c.Flags {
+		if _, ok := c.structured()[name]; ok || name == "cluster" {
+			return fmt.Errorf("flags: set %s at the top level", name)
+		}
+		if name == "config" {
+			return fmt.Errorf("flags: a configuration file cannot load another one")
+		}
+	}
+	return nil
+}
+
+// FlagValues returns the value of every flag the configuration sets, keyed
+// by flag name, as it would be given on the command line.
+func (c *Config) FlagValues() map[string]string {
+	values := make(map[string]string)
+	for name, value := range c.structured() {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	if c.Cluster != nil {
+		values["cluster"] = "true"
+		values["raft-id"] = c.Cluster.RaftID
+		values["raft-bind"] = c.Cluster.RaftBind
+		values["peers"] = strings.Join(c.Cluster.Peers, ",")
+		if c.Cluster.ClockSkew != "" {
+			values["clock-skew"] = c.Cluster.ClockSkew
+		}
+		if c.Cluster.RaftDelay != "" {
+			values["raft-delay"] = c.Cluster.RaftDelay
+		}
+		if c.Cluster.RaftDir != "" {
+			values["raft-dir"] = c.Cluster.RaftDir
+		}
+		if c.Cluster.SnapshotArchive != "" {
+			values["raft-snapshot-archive"] = c.Cluster.SnapshotArchive
+		}
+	}
+	for name, value := range c.Flags {
+		values[name] = fmt.Sprint(value)
+	}
+	return values
+}
+
+// FlagNames returns the names of the flags the configuration sets, sorted.
+func (c *Config) FlagNames() []string {
+	values := c.FlagValues()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// structured returns the top-level settings by flag name, with "" for
+// unset ones.
+func (c *Config) structured() map[string]string {
+	values := map[string]string{
+		"port":          "",
+		"window-size":   "",
+		"window-policy": c.WindowPolicy,
+		"master":        "",
+		"variants":      "",
+		"loop-after":    c.LoopAfter,
+		"loop-segments": "",
+		"verbose":       "",
+	}
+	if c.Port != 0 {
+		values["port"] = strconv.Itoa(c.Port)
+	}
+	if c.WindowSize != 0 {
+		values["window-size"] = strconv.Itoa(c.WindowSize)
+	}
+	if c.Master {
+		values["master"] = "true"
+	}
+	if len(c.Variants) > 0 {
+		indices := make([]string, len(c.Variants))
+		for i, v := range c.Variants {
+			indices[i] = strconv.Itoa(v)
+		}
+		values["variants"] = strings.Join(indices, ",")
+	}
+	if c.LoopSegments != 0 {
+		values["loop-segments"] = strconv.Itoa(c.LoopSegments)
+	}
+	if c.Verbose {
+		values["verbose"] = "true"
+	}
+	return values
+}
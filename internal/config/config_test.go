@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	cfg, err := ParseYAML([]byte(`
+source: https://example.com/master.m3u8
+port: 9090
+window-size: 4
+loop-after: 1m30s
+variants: [0, 2]
+cluster:
+  raft-id: node1
+  raft-bind: 10.0.0.1:9000
+  peers: [10.0.0.1:9000, 10.0.0.2:9000]
+  raft-delay: fixed:40ms
+  raft-dir: /var/lib/encodersim/raft
+  raft-snapshot-archive: s3://backups/raft
+flags:
+  prerender: true
+  latency: variant=fixed:200ms
+`))
+	if err != nil {
+		t.Fatalf("ParseYAML() error = %v", err)
+	}
+	if cfg.Source != "https://example.com/master.m3u8" {
+		t.Errorf("Source = %q", cfg.Source)
+	}
+
+	want := map[string]string{
+		"port":                  "9090",
+		"window-size":           "4",
+		"loop-after":            "1m30s",
+		"variants":              "0,2",
+		"cluster":               "true",
+		"raft-id":               "node1",
+		"raft-bind":             "10.0.0.1:9000",
+		"peers":                 "10.0.0.1:9000,10.0.0.2:9000",
+		"raft-delay":            "fixed:40ms",
+		"raft-dir":              "/var/lib/encodersim/raft",
+		"raft-snapshot-archive": "s3://backups/raft",
+		"prerender":             "true",
+		"latency":               "variant=fixed:200ms",
+	}
+	if got := cfg.FlagValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FlagValues() = %v, want %v", got, want)
+	}
+	if names := cfg.FlagNames(); len(names) != len(want) || names[0] != "cluster" {
+		t.Errorf("FlagNames() = %v", names)
+	}
+}
+
+func TestParseYAML_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "", "empty"},
+		{"unknown key", "window: 6\n", "window"},
+		{"bad port", "port: 70000\n", "port"},
+		{"negative window", "window-size: -1\n", "window-size"},
+		{"bad loop-after", "loop-after: 10\n", "loop-after"},
+		{"negative variant", "variants: [-1]\n", "variants"},
+		{"cluster without id", "cluster:\n  raft-bind: a:1\n  peers: [a:1]\n", "raft-id"},
+		{"bad bind", "cluster:\n  raft-id: n\n  raft-bind: a\n  peers: [a:1]\n", "raft-bind"},
+		{"no peers", "cluster:\n  raft-id: n\n  raft-bind: a:1\n", "peers"},
+		{"bad raft-delay", "cluster:\n  raft-id: n\n  raft-bind: a:1\n  peers: [a:1]\n  raft-delay: 40ms\n", "raft-delay"},
+		{"structured flag", "flags:\n  port: 80\n", "top level"},
+		{"nested config", "flags:\n  config: other.yaml\n", "another"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseYAML([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseYAML() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "encodersim.json")
+	// Tab-indented JSON is not valid YAML
+	os.WriteFile(jsonFile, []byte("{\n\t\"port\": 9090,\n\t\"flags\": {\"prerender\": true}\n}\n"), 0o644)
+	cfg, err := Load(jsonFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.FlagValues(); got["port"] != "9090" || got["prerender"] != "true" {
+		t.Errorf("FlagValues() = %v", got)
+	}
+
+	os.WriteFile(jsonFile, []byte(`{"window": 6}`), 0o644)
+	if _, err := Load(jsonFile); err == nil || !strings.Contains(err.Error(), jsonFile) {
+		t.Errorf("Load() error = %v, want one naming the file", err)
+	}
+}
@@ -0,0 +1,280 @@
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// Representation is one variant of a manifest, with the Periods of its
+// current window.
+type Representation struct {
+	ID        string
+	Bandwidth int
+	Width     int // 0 if unknown
+	Height    int // 0 if unknown
+	Codecs    string
+	Periods   []Period
+}
+
+// Manifest holds what a live MPD is rendered from.
+type Manifest struct {
+	// AvailabilityStartTime is the wall clock time of the start of the
+	// stream timeline. It must not change while the stream is live.
+	AvailabilityStartTime time.Time
+
+	// PublishTime is when this version of the manifest was generated.
+	PublishTime time.Time
+
+	// TargetDuration bounds the segment durations; it also sets how often
+	// clients reload the manifest.
+	TargetDuration time.Duration
+
+	// Representations must have the same Periods, segment for segment.
+	Representations []Representation
+}
+
+// CheckAligned returns an error unless the variants' segment lists can share
+// one timeline: CMAF (fMP4) segments with a single initialization section
+// per variant, and the same number and durations of segments in every
+// variant.
+func CheckAligned(variants [][]segment.Segment) error {
+	if len(variants) == 0 {
+		return fmt.Errorf("no variants")
+	}
+	first := variants[0]
+	for i, segments := range variants {
+		if len(segments) == 0 {
+			return fmt.Errorf("variant %d has no segments", i)
+		}
+		if len(segments) != len(first) {
+			return fmt.Errorf("variant %d has %d segments, variant 0 has %d", i, len(segments), len(first))
+		}
+		for j, seg := range segments {
+			if seg.InitURL == "" {
+				return fmt.Errorf("variant %d segment %d is not fMP4 (no EXT-X-MAP)", i, j)
+			}
+			if seg.InitURL != segments[0].InitURL || seg.InitByteRange != segments[0].InitByteRange {
+				return fmt.Errorf("variant %d changes its initialization section at segment %d", i, j)
+			}
+			if math.Abs(seg.Duration-first[j].Duration) > 0.5/Timescale {
+				return fmt.Errorf("variant %d segment %d lasts %.3fs, variant 0 segment %d lasts %.3fs",
+					i, j, seg.Duration, j, first[j].Duration)
+			}
+		}
+	}
+	return nil
+}
+
+// LiveEdge returns the position on the stream timeline of the end of the
+// last segment of periods.
+func LiveEdge(periods []Period) time.Duration {
+	if len(periods) == 0 {
+		return 0
+	}
+	last := periods[len(periods)-1]
+	end := last.Start
+	if n := len(last.Segments); n > 0 {
+		end += last.Segments[n-1].Time + last.Segments[n-1].Duration
+	}
+	return ticks(end)
+}
+
+// Write renders m as a dynamic MPD. All representations go into a single
+// AdaptationSet per Period, so players can switch between them.
+func Write(w io.Writer, m Manifest) error {
+	if len(m.Representations) == 0 {
+		return fmt.Errorf("manifest has no representations")
+	}
+	periods := m.Representations[0].Periods
+	for _, r := range m.Representations[1:] {
+		if !samePeriods(r.Periods, periods) {
+			return fmt.Errorf("representation %s is not aligned with representation %s", r.ID, m.Representations[0].ID)
+		}
+	}
+
+	var window uint64
+	for _, p := range periods {
+		for _, seg := range p.Segments {
+			window += seg.Duration
+		}
+	}
+
+	doc := mpd{
+		XMLNS:                      "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                   "urn:mpeg:dash:profile:isoff-main:2011",
+		Type:                       "dynamic",
+		AvailabilityStartTime:      m.AvailabilityStartTime.UTC().Format(time.RFC3339Nano),
+		PublishTime:                m.PublishTime.UTC().Format(time.RFC3339Nano),
+		MinimumUpdatePeriod:        duration(m.TargetDuration),
+		MinBufferTime:              duration(m.TargetDuration),
+		MaxSegmentDuration:         duration(m.TargetDuration),
+		TimeShiftBufferDepth:       duration(ticks(window)),
+		SuggestedPresentationDelay: duration(3 * m.TargetDuration),
+	}
+	for i, p := range periods {
+		out := mpdPeriod{
+			ID:    p.ID,
+			Start: duration(ticks(p.Start)),
+			AdaptationSet: adaptationSet{
+				MimeType:         "video/mp4",
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+			},
+		}
+		for _, r := range m.Representations {
+			out.AdaptationSet.Representations = append(out.AdaptationSet.Representations, representation(r, r.Periods[i]))
+		}
+		doc.Periods = append(doc.Periods, out)
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// samePeriods reports whether a and b split the window identically.
+func samePeriods(a, b []Period) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Start != b[i].Start || len(a[i].Segments) != len(b[i].Segments) {
+			return false
+		}
+	}
+	return true
+}
+
+// representation renders r's part of period p.
+func representation(r Representation, p Period) mpdRepresentation {
+	list := &segmentList{
+		Timescale:              Timescale,
+		PresentationTimeOffset: p.PresentationTimeOffset,
+		Timeline:               &segmentTimeline{},
+	}
+	if len(p.Segments) > 0 {
+		first := p.Segments[0]
+		list.Initialization = &initialization{SourceURL: first.InitURL, Range: mediaRange(first.InitByteRange)}
+	}
+	for _, seg := range p.Segments {
+		list.Timeline.S = append(list.Timeline.S, timelineEntry{T: seg.Time, D: seg.Duration})
+		list.SegmentURLs = append(list.SegmentURLs, segmentURL{Media: seg.URL, MediaRange: mediaRange(seg.ByteRange)})
+	}
+	return mpdRepresentation{
+		ID:          r.ID,
+		Bandwidth:   r.Bandwidth,
+		Width:       r.Width,
+		Height:      r.Height,
+		Codecs:      r.Codecs,
+		SegmentList: list,
+	}
+}
+
+// mediaRange converts an HLS "length@offset" byte range to a DASH
+// "first-last" range, or returns "" for none.
+func mediaRange(byteRange string) string {
+	if byteRange == "" {
+		return ""
+	}
+	length, offset, err := segment.ParseByteRange(byteRange)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)
+}
+
+// ticks converts Timescale ticks to a duration.
+func ticks(n uint64) time.Duration {
+	return time.Duration(n) * (time.Second / Timescale)
+}
+
+// duration formats d as an xs:duration in seconds, such as "PT6S" or
+// "PT4.5S".
+func duration(d time.Duration) string {
+	s := strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return "PT" + s + "S"
+}
+
+// The MPD document, as far as encodersim uses it.
+type (
+	mpd struct {
+		XMLName                    xml.Name    `xml:"MPD"`
+		XMLNS                      string      `xml:"xmlns,attr"`
+		Profiles                   string      `xml:"profiles,attr"`
+		Type                       string      `xml:"type,attr"`
+		AvailabilityStartTime      string      `xml:"availabilityStartTime,attr"`
+		PublishTime                string      `xml:"publishTime,attr"`
+		MinimumUpdatePeriod        string      `xml:"minimumUpdatePeriod,attr"`
+		MinBufferTime              string      `xml:"minBufferTime,attr"`
+		MaxSegmentDuration         string      `xml:"maxSegmentDuration,attr"`
+		TimeShiftBufferDepth       string      `xml:"timeShiftBufferDepth,attr"`
+		SuggestedPresentationDelay string      `xml:"suggestedPresentationDelay,attr"`
+		Periods                    []mpdPeriod `xml:"Period"`
+	}
+
+	mpdPeriod struct {
+		ID            string        `xml:"id,attr"`
+		Start         string        `xml:"start,attr"`
+		AdaptationSet adaptationSet `xml:"AdaptationSet"`
+	}
+
+	adaptationSet struct {
+		MimeType         string              `xml:"mimeType,attr"`
+		SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+		StartWithSAP     int                 `xml:"startWithSAP,attr"`
+		Representations  []mpdRepresentation `xml:"Representation"`
+	}
+
+	mpdRepresentation struct {
+		ID          string       `xml:"id,attr"`
+		Bandwidth   int          `xml:"bandwidth,attr"`
+		Width       int          `xml:"width,attr,omitempty"`
+		Height      int          `xml:"height,attr,omitempty"`
+		Codecs      string       `xml:"codecs,attr,omitempty"`
+		SegmentList *segmentList `xml:"SegmentList"`
+	}
+
+	segmentList struct {
+		Timescale              int              `xml:"timescale,attr"`
+		PresentationTimeOffset uint64           `xml:"presentationTimeOffset,attr"`
+		Initialization         *initialization  `xml:"Initialization"`
+		Timeline               *segmentTimeline `xml:"SegmentTimeline"`
+		SegmentURLs            []segmentURL     `xml:"SegmentURL"`
+	}
+
+	initialization struct {
+		SourceURL string `xml:"sourceURL,attr"`
+		Range     string `xml:"range,attr,omitempty"`
+	}
+
+	segmentTimeline struct {
+		S []timelineEntry `xml:"S"`
+	}
+
+	timelineEntry struct {
+		T uint64 `xml:"t,attr"`
+		D uint64 `xml:"d,attr"`
+	}
+
+	segmentURL struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr,omitempty"`
+	}
+)
@@ -0,0 +1,109 @@
+package dash
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func cmaf(durations ...float64) []segment.Segment {
+	segments := loop(durations...)
+	for i := range segments {
+		segments[i].InitURL = "init.mp4"
+	}
+	return segments
+}
+
+func TestCheckAligned(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants [][]segment.Segment
+		wantErr  string
+	}{
+		{"aligned", [][]segment.Segment{cmaf(2, 2), cmaf(2, 2)}, ""},
+		{"no variants", nil, "no variants"},
+		{"not fmp4", [][]segment.Segment{loop(2, 2)}, "not fMP4"},
+		{"segment count", [][]segment.Segment{cmaf(2, 2), cmaf(2, 2, 2)}, "has 3 segments"},
+		{"durations", [][]segment.Segment{cmaf(2, 2), cmaf(2, 2.5)}, "lasts 2.500s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckAligned(tt.variants)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckAligned() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckAligned() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	segments := cmaf(2, 2, 2)
+	segments[1].ByteRange = "1000@500"
+	periods, err := Periods(Window{Segments: segments, Position: 2, Size: 3, FirstSequence: 5})
+	if err != nil {
+		t.Fatalf("Periods() error = %v", err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	err = Write(&b, Manifest{
+		AvailabilityStartTime: start,
+		PublishTime:           start.Add(time.Minute),
+		TargetDuration:        2 * time.Second,
+		Representations: []Representation{
+			{ID: "0", Bandwidth: 800000, Width: 640, Height: 360, Codecs: "avc1.64001e", Periods: periods},
+			{ID: "1", Bandwidth: 2400000, Periods: periods},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var doc mpd
+	if err := xml.Unmarshal([]byte(b.String()), &doc); err != nil {
+		t.Fatalf("manifest is not valid XML: %v\n%s", err, b.String())
+	}
+	if doc.Type != "dynamic" || doc.AvailabilityStartTime != "2026-01-01T00:00:00Z" || doc.TimeShiftBufferDepth != "PT6S" {
+		t.Errorf("MPD attributes = %+v", doc)
+	}
+	if len(doc.Periods) != 2 {
+		t.Fatalf("got %d periods, want 2:\n%s", len(doc.Periods), b.String())
+	}
+	if p := doc.Periods[1]; p.ID != "p6" || p.Start != "PT12S" || len(p.AdaptationSet.Representations) != 2 {
+		t.Errorf("second period = %+v", p)
+	}
+
+	list := doc.Periods[1].AdaptationSet.Representations[0].SegmentList
+	if list.Initialization.SourceURL != "init.mp4" || len(list.SegmentURLs) != 2 {
+		t.Fatalf("segment list = %+v", list)
+	}
+	if got := list.SegmentURLs[1]; got.Media != "b.mp4" || got.MediaRange != "500-1499" {
+		t.Errorf("second segment URL = %+v", got)
+	}
+	if got := list.Timeline.S[1]; got.T != 2000 || got.D != 2000 {
+		t.Errorf("second timeline entry = %+v", got)
+	}
+
+	if edge := LiveEdge(periods); edge != 16*time.Second {
+		t.Errorf("LiveEdge() = %v, want 16s", edge)
+	}
+}
+
+func TestWrite_Misaligned(t *testing.T) {
+	a, _ := Periods(Window{Segments: cmaf(2, 2), Position: 0, Size: 2, FirstSequence: 0})
+	b, _ := Periods(Window{Segments: cmaf(2, 2), Position: 1, Size: 2, FirstSequence: 1})
+	err := Write(&strings.Builder{}, Manifest{Representations: []Representation{{ID: "0", Periods: a}, {ID: "1", Periods: b}}})
+	if err == nil {
+		t.Error("Write() with misaligned representations: expected error")
+	}
+}
@@ -0,0 +1,121 @@
+// Package dash maps the looping segment window onto MPEG-DASH Periods.
+//
+// A single Period cannot represent a loop: media timestamps jump back to the
+// start of the content at every loop point, which dash.js and ExoPlayer
+// report as timeline errors. Instead, every pass through the loop is its own
+// Period, in the same places where the HLS playlists insert
+// EXT-X-DISCONTINUITY, and each Period restarts its SegmentTimeline at the
+// content's first presentation time.
+package dash
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// Timescale is the number of SegmentTimeline ticks per second.
+const Timescale = 1000
+
+// Window is the state of one variant's sliding window.
+type Window struct {
+	// Segments is the looped content, in loop order.
+	Segments []segment.Segment
+
+	// Position is the index in Segments of the window's first segment.
+	Position int
+
+	// Size is the number of segments in the window.
+	Size int
+
+	// FirstSequence is the media sequence number of the window's first
+	// segment.
+	FirstSequence uint64
+}
+
+// Period is one pass through the loop within a window.
+type Period struct {
+	// ID names the pass by the media sequence number of its first segment,
+	// so it stays the same while the pass slides through the window.
+	ID string
+
+	// Start is the Period@start offset from the beginning of the stream
+	// timeline, in Timescale ticks.
+	Start uint64
+
+	// PresentationTimeOffset is the media time, in Timescale ticks, that
+	// plays at Start. Media timestamps are assumed to start at zero in
+	// every pass, so it is always zero.
+	PresentationTimeOffset uint64
+
+	// Segments are the pass's segments that are in the window.
+	Segments []TimelineSegment
+}
+
+// TimelineSegment is a segment placed on a Period's SegmentTimeline.
+type TimelineSegment struct {
+	segment.Segment
+
+	// Sequence is the segment's media sequence number.
+	Sequence uint64
+
+	// Time and Duration are the S@t and S@d values, in Timescale ticks.
+	// Boundaries are rounded from the cumulative durations, so they do
+	// not drift from the content.
+	Time     uint64
+	Duration uint64
+}
+
+// Periods splits the window at its loop points into one Period per pass.
+//
+// The stream timeline places the pass that starts at media sequence number
+// P at P times the mean segment duration: consecutive passes then follow
+// each other exactly, and every node that agrees on the window agrees on
+// the timeline, with no state kept between calls. A pass's Start may lie
+// before the window when its first segments have already left it.
+func Periods(w Window) ([]Period, error) {
+	n := len(w.Segments)
+	if n == 0 {
+		return nil, fmt.Errorf("window has no segments")
+	}
+	if w.Position < 0 || w.Position >= n {
+		return nil, fmt.Errorf("window position %d out of range (0-%d)", w.Position, n-1)
+	}
+	if uint64(w.Position) > w.FirstSequence {
+		return nil, fmt.Errorf("window position %d is ahead of media sequence %d", w.Position, w.FirstSequence)
+	}
+
+	// offsets[i] is the start of segment i within a pass, and offsets[n]
+	// the duration of the pass
+	offsets := make([]uint64, n+1)
+	var elapsed float64
+	for i, seg := range w.Segments {
+		elapsed += seg.Duration
+		offsets[i+1] = uint64(math.Round(elapsed * Timescale))
+	}
+
+	var periods []Period
+	passStart := w.FirstSequence - uint64(w.Position)
+	for i := 0; i < w.Size; i++ {
+		pos := (w.Position + i) % n
+		if i == 0 || pos == 0 {
+			if i > 0 {
+				passStart = w.FirstSequence + uint64(i)
+			}
+			periods = append(periods, Period{
+				ID:    fmt.Sprintf("p%d", passStart),
+				Start: passStart * offsets[n] / uint64(n),
+			})
+		}
+
+		p := &periods[len(periods)-1]
+		p.Segments = append(p.Segments, TimelineSegment{
+			Segment:  w.Segments[pos],
+			Sequence: w.FirstSequence + uint64(i),
+			Time:     offsets[pos],
+			Duration: offsets[pos+1] - offsets[pos],
+		})
+	}
+	return periods, nil
+}
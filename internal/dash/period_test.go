@@ -0,0 +1,109 @@
+package dash
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func loop(durations ...float64) []segment.Segment {
+	segments := make([]segment.Segment, len(durations))
+	for i, d := range durations {
+		segments[i] = segment.Segment{URL: string(rune('a'+i)) + ".mp4", Duration: d, Sequence: i}
+	}
+	return segments
+}
+
+// summary lists a period's ID, start and segments as URL@time+duration in
+// ticks.
+type summary struct {
+	ID       string
+	Start    uint64
+	Segments []string
+}
+
+func summarize(periods []Period) []summary {
+	var out []summary
+	for _, p := range periods {
+		s := summary{ID: p.ID, Start: p.Start}
+		for _, seg := range p.Segments {
+			s.Segments = append(s.Segments, fmt.Sprintf("%s@%d+%d", seg.URL, seg.Time, seg.Duration))
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestPeriods(t *testing.T) {
+	tests := []struct {
+		name   string
+		window Window
+		want   []summary
+	}{
+		{
+			name:   "single pass",
+			window: Window{Segments: loop(2, 2, 2), Position: 0, Size: 2, FirstSequence: 0},
+			want:   []summary{{"p0", 0, []string{"a.mp4@0+2000", "b.mp4@2000+2000"}}},
+		},
+		{
+			name:   "pass already partly out of the window",
+			window: Window{Segments: loop(2, 2, 2), Position: 1, Size: 2, FirstSequence: 4},
+			want:   []summary{{"p3", 6000, []string{"b.mp4@2000+2000", "c.mp4@4000+2000"}}},
+		},
+		{
+			name:   "loop point starts a new period",
+			window: Window{Segments: loop(2, 2, 2), Position: 2, Size: 3, FirstSequence: 5},
+			want: []summary{
+				{"p3", 6000, []string{"c.mp4@4000+2000"}},
+				{"p6", 12000, []string{"a.mp4@0+2000", "b.mp4@2000+2000"}},
+			},
+		},
+		{
+			name:   "uneven durations",
+			window: Window{Segments: loop(1.5, 3, 1.5), Position: 2, Size: 2, FirstSequence: 2},
+			want: []summary{
+				{"p0", 0, []string{"c.mp4@4500+1500"}},
+				{"p3", 6000, []string{"a.mp4@0+1500"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			periods, err := Periods(tt.window)
+			if err != nil {
+				t.Fatalf("Periods() error = %v", err)
+			}
+			if got := summarize(periods); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Periods() = %+v, want %+v", got, tt.want)
+			}
+
+			// Each pass must end where the next one starts
+			for i := 1; i < len(periods); i++ {
+				prev := periods[i-1]
+				last := prev.Segments[len(prev.Segments)-1]
+				if end := prev.Start + last.Time + last.Duration; end != periods[i].Start {
+					t.Errorf("period %s ends at %d, next starts at %d", prev.ID, end, periods[i].Start)
+				}
+			}
+		})
+	}
+}
+
+func TestPeriods_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		window Window
+	}{
+		{"no segments", Window{Size: 1}},
+		{"position out of range", Window{Segments: loop(2), Position: 1, Size: 1, FirstSequence: 5}},
+		{"position ahead of sequence", Window{Segments: loop(2, 2), Position: 1, Size: 1}},
+	}
+	for _, tt := range tests {
+		if _, err := Periods(tt.window); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
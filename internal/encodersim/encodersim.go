@@ -0,0 +1,215 @@
+// Package encodersim runs the looping live simulator inside a Go process,
+// for test harnesses that would otherwise start the binary and poll it over
+// HTTP. An Engine parses sources and creates a Channel per source; each
+// channel serves the same endpoints as the binary through an http.Handler
+// and advances its window on demand or on the media clock:
+//
+//	engine := encodersim.New(encodersim.Options{WindowSize: 3})
+//	info, err := engine.Parse("testdata/master.m3u8")
+//	if err != nil {
+//		return err
+//	}
+//	ch, err := engine.NewChannel(info, "testdata/master.m3u8")
+//	if err != nil {
+//		return err
+//	}
+//	ts := httptest.NewServer(ch.Handler())
+//	defer ts.Close()
+//	ch.Advance() // or go ch.Run(ctx)
+//
+// Like every package of this CLI it is internal (see CLAUDE.md): the API is
+// stable for the harnesses within this module, such as test/integration,
+// and tools outside it run the binary.
+package encodersim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/parser"
+	"github.com/agleyzer/encodersim/internal/playlist"
+	"github.com/agleyzer/encodersim/internal/server"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// DefaultWindowSize is the window size used when Options.WindowSize is 0,
+// the default of --window-size.
+const DefaultWindowSize = 6
+
+// Options configures an Engine and the channels it creates.
+type Options struct {
+	// WindowSize is the number of segments in the sliding window. It
+	// overrides Playlist.WindowSize; DefaultWindowSize if both are 0.
+	WindowSize int
+
+	// Playlist configures the live playlists of the channels, as the
+	// playlist flags of the binary do. Renditions are taken from the
+	// parsed source.
+	Playlist playlist.Options
+
+	// Server configures the endpoints of the channels. Port, TLS and
+	// RedirectPort are ignored, since the caller serves Channel.Handler.
+	Server server.Options
+
+	// Parser configures how sources are fetched and parsed.
+	Parser parser.Options
+
+	// Budget, if set, bounds the channels the engine runs at once and the
+	// caches of their playlists; it overrides Playlist.Budget and
+	// Server.Budget. Its memory and procs limits are left to the host
+	// process to apply.
+	Budget *budget.Budget
+
+	// Logger receives the logs of the engine and its channels. If nil,
+	// they are discarded.
+	Logger *slog.Logger
+}
+
+// Engine parses sources and creates channels that loop them.
+type Engine struct {
+	opts   Options
+	parser *parser.Parser
+	logger *slog.Logger
+}
+
+// New returns an Engine with the given options.
+func New(opts Options) *Engine {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	if opts.WindowSize == 0 {
+		opts.WindowSize = opts.Playlist.WindowSize
+	}
+	if opts.WindowSize == 0 {
+		opts.WindowSize = DefaultWindowSize
+	}
+	return &Engine{
+		opts:   opts,
+		parser: parser.New(opts.Parser),
+		logger: logger,
+	}
+}
+
+// Parse fetches and parses a source playlist from a URL or local file path.
+func (e *Engine) Parse(source string) (*parser.PlaylistInfo, error) {
+	return e.parser.Parse(source)
+}
+
+// ParseReader parses a source playlist from r, resolving its relative URIs
+// against baseURL.
+func (e *Engine) ParseReader(r io.Reader, baseURL string) (*parser.PlaylistInfo, error) {
+	return e.parser.ParseReader(r, baseURL)
+}
+
+// NewChannel creates a channel that loops the parsed source info. A media
+// playlist is served as variant 0 of a master playlist, as the binary
+// does; source is its URL, reported as the variant's source. The window
+// does not move until Advance or Run is called. With a channel limit in
+// Options.Budget, it fails with an error wrapping budget.ErrExceeded while
+// the limit's worth of channels are open; Close releases one.
+func (e *Engine) NewChannel(info *parser.PlaylistInfo, source string) (*Channel, error) {
+	if err := e.opts.Budget.AcquireChannel(); err != nil {
+		return nil, err
+	}
+
+	variants := sourceVariants(info, source)
+	opts := e.opts.Playlist
+	opts.WindowSize = e.opts.WindowSize
+	opts.Renditions = variant.Referenced(info.Renditions, variants)
+	if e.opts.Budget != nil {
+		opts.Budget = e.opts.Budget
+	}
+
+	lp, err := playlist.NewWithOptions(variants, opts, nil, e.logger)
+	if err != nil {
+		e.opts.Budget.ReleaseChannel()
+		return nil, fmt.Errorf("failed to create playlist: %w", err)
+	}
+
+	srvOpts := e.opts.Server
+	srvOpts.Port, srvOpts.TLS, srvOpts.RedirectPort = 0, nil, 0
+	if e.opts.Budget != nil {
+		srvOpts.Budget = e.opts.Budget
+	}
+	srv := server.NewWithOptions(lp, srvOpts, e.logger)
+	return &Channel{
+		playlist: lp,
+		server:   srv,
+		handler:  srv.Handler(),
+		budget:   e.opts.Budget,
+	}, nil
+}
+
+// sourceVariants returns the variants of a master playlist, or a media
+// playlist wrapped as a single variant.
+func sourceVariants(info *parser.PlaylistInfo, source string) []variant.Variant {
+	if info.IsMaster {
+		return info.Variants
+	}
+	return []variant.Variant{{
+		PlaylistURL:    source,
+		Segments:       info.Segments,
+		TargetDuration: info.TargetDuration,
+		MediaSequence:  info.MediaSequence,
+		Version:        info.Version,
+		HeaderTags:     info.HeaderTags,
+	}}
+}
+
+// Channel is one looping live stream and its endpoints.
+type Channel struct {
+	playlist *playlist.Playlist
+	server   *server.Server
+	handler  http.Handler
+
+	budget *budget.Budget
+	closed sync.Once
+}
+
+// Handler returns the handler of the channel's endpoints, at the same paths
+// as the binary serves them (/playlist.m3u8, /variant/0/playlist.m3u8,
+// /health, ...).
+func (c *Channel) Handler() http.Handler {
+	return c.handler
+}
+
+// Advance moves the window of every variant forward by one segment.
+func (c *Channel) Advance() {
+	c.playlist.Advance()
+}
+
+// Run advances the window as fast as the media plays, like the binary,
+// until ctx is done.
+func (c *Channel) Run(ctx context.Context) {
+	c.playlist.StartAutoAdvance(ctx)
+}
+
+// MediaSequence returns the current EXT-X-MEDIA-SEQUENCE of the first
+// variant.
+func (c *Channel) MediaSequence() uint64 {
+	return c.playlist.MediaSequence()
+}
+
+// Playlist returns the live playlist of the channel, for controls that
+// Channel does not wrap, such as PauseAdvance or Splice.
+func (c *Channel) Playlist() *playlist.Playlist {
+	return c.playlist
+}
+
+// Close returns the channel to the engine's channel limit. The channel's
+// handler keeps serving; stop calling it and cancel Run first.
+func (c *Channel) Close() {
+	c.closed.Do(c.budget.ReleaseChannel)
+}
+
+// Server returns the server of the channel's endpoints, for controls that
+// Channel does not wrap, such as StartMaintenance or FailVariant.
+func (c *Channel) Server() *server.Server {
+	return c.server
+}
@@ -0,0 +1,165 @@
+package encodersim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/playlist"
+)
+
+const mediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:1
+#EXTINF:1.0,
+segment0.ts
+#EXTINF:1.0,
+segment1.ts
+#EXTINF:1.0,
+segment2.ts
+#EXTINF:1.0,
+segment3.ts
+#EXT-X-ENDLIST
+`
+
+// newChannel returns a channel looping mediaPlaylist with a window of 2.
+func newChannel(t *testing.T, opts Options) *Channel {
+	t.Helper()
+	engine := New(opts)
+	info, err := engine.ParseReader(strings.NewReader(mediaPlaylist), "http://origin.example.com/live/index.m3u8")
+	if err != nil {
+		t.Fatalf("ParseReader() error = %v", err)
+	}
+	ch, err := engine.NewChannel(info, "http://origin.example.com/live/index.m3u8")
+	if err != nil {
+		t.Fatalf("NewChannel() error = %v", err)
+	}
+	return ch
+}
+
+// get returns the body of a GET of path from ts.
+func get(t *testing.T, ts *httptest.Server, path string) string {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", path, resp.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestChannel_Advance(t *testing.T) {
+	ch := newChannel(t, Options{WindowSize: 2})
+	ts := httptest.NewServer(ch.Handler())
+	defer ts.Close()
+
+	if master := get(t, ts, "/playlist.m3u8"); !strings.Contains(master, "variant/0/playlist.m3u8") {
+		t.Errorf("master playlist does not list variant 0:\n%s", master)
+	}
+
+	tests := []struct {
+		sequence string
+		segments []string
+	}{
+		{"0", []string{"segment0.ts", "segment1.ts"}},
+		{"1", []string{"segment1.ts", "segment2.ts"}},
+		{"2", []string{"segment2.ts", "segment3.ts"}},
+		{"3", []string{"segment3.ts", "segment0.ts"}},
+	}
+	for i, tt := range tests {
+		if i > 0 {
+			ch.Advance()
+		}
+		body := get(t, ts, "/variant/0/playlist.m3u8")
+		if !strings.Contains(body, "#EXT-X-MEDIA-SEQUENCE:"+tt.sequence+"\n") {
+			t.Errorf("advance %d: want media sequence %s, got:\n%s", i, tt.sequence, body)
+		}
+		for _, seg := range tt.segments {
+			if !strings.Contains(body, "http://origin.example.com/live/"+seg) {
+				t.Errorf("advance %d: want %s in the window, got:\n%s", i, seg, body)
+			}
+		}
+		if got := ch.MediaSequence(); got != uint64(i) {
+			t.Errorf("advance %d: MediaSequence() = %d", i, got)
+		}
+	}
+}
+
+func TestChannel_Run(t *testing.T) {
+	ch := newChannel(t, Options{WindowSize: 2})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ch.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ch.MediaSequence() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ch.MediaSequence() == 0 {
+		t.Error("Run() did not advance the window")
+	}
+	cancel()
+	<-done
+}
+
+func TestEngine_ChannelLimit(t *testing.T) {
+	b, err := budget.New(budget.Limits{Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(Options{WindowSize: 2, Budget: b})
+	info, err := engine.ParseReader(strings.NewReader(mediaPlaylist), "http://origin.example.com/live/index.m3u8")
+	if err != nil {
+		t.Fatalf("ParseReader() error = %v", err)
+	}
+
+	ch, err := engine.NewChannel(info, "http://origin.example.com/live/index.m3u8")
+	if err != nil {
+		t.Fatalf("NewChannel() error = %v", err)
+	}
+	if _, err := engine.NewChannel(info, "http://origin.example.com/live/index.m3u8"); !errors.Is(err, budget.ErrExceeded) {
+		t.Errorf("second NewChannel() error = %v, want ErrExceeded", err)
+	}
+
+	// Closing twice releases one channel
+	ch.Close()
+	ch.Close()
+	if _, err := engine.NewChannel(info, "http://origin.example.com/live/index.m3u8"); err != nil {
+		t.Errorf("NewChannel() after Close() error = %v", err)
+	}
+	if stats := b.Stats(); stats.Channels != 1 || stats.Refused["channels"] != 1 {
+		t.Errorf("budget stats = %+v, want 1 channel and one refusal", stats)
+	}
+}
+
+func TestNew_WindowSize(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want int
+	}{
+		{"default", Options{}, DefaultWindowSize},
+		{"from playlist options", Options{Playlist: playlist.Options{WindowSize: 3}}, 3},
+		{"override", Options{WindowSize: 2, Playlist: playlist.Options{WindowSize: 3}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.opts).opts.WindowSize; got != tt.want {
+				t.Errorf("window size = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
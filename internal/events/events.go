@@ -0,0 +1,72 @@
+// Package events keeps a bounded log of notable runtime events, such as
+// scenario progress, served by the /events endpoint.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is the number of events a Log created with NewLog(0)
+// retains.
+const DefaultCapacity = 1000
+
+// Event is one entry of the log.
+type Event struct {
+	// ID increases by one for every published event, starting at 1.
+	ID uint64 `json:"id"`
+
+	Time    time.Time      `json:"time"`
+	Type    string         `json:"type"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Log retains the most recent events. It is safe for concurrent use.
+type Log struct {
+	capacity int
+
+	mu     sync.Mutex
+	events []Event // oldest first
+	lastID uint64
+}
+
+// NewLog creates a Log that retains up to capacity events, or
+// DefaultCapacity if capacity is not positive.
+func NewLog(capacity int) *Log {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Log{capacity: capacity}
+}
+
+// Publish appends an event, evicting the oldest one if the log is full, and
+// returns it.
+func (l *Log) Publish(typ, message string, fields map[string]any) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	e := Event{ID: l.lastID, Time: time.Now(), Type: typ, Message: message, Fields: fields}
+	if len(l.events) == l.capacity {
+		l.events = append(l.events[:0], l.events[1:]...)
+	}
+	l.events = append(l.events, e)
+	return e
+}
+
+// Since returns the retained events with an ID greater than id, oldest
+// first, and the ID of the last published event, which callers pass as id
+// on their next call.
+func (l *Log) Since(id uint64) ([]Event, uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []Event
+	for _, e := range l.events {
+		if e.ID > id {
+			out = append(out, e)
+		}
+	}
+	return out, l.lastID
+}
@@ -0,0 +1,51 @@
+package events
+
+import "testing"
+
+func TestLog_Since(t *testing.T) {
+	log := NewLog(3)
+	for _, typ := range []string{"a", "b", "c", "d"} {
+		log.Publish(typ, "event "+typ, nil)
+	}
+
+	tests := []struct {
+		name  string
+		since uint64
+		want  []string
+	}{
+		{"all retained", 0, []string{"b", "c", "d"}},
+		{"after id", 2, []string{"c", "d"}},
+		{"up to date", 4, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, last := log.Since(tt.since)
+			if last != 4 {
+				t.Errorf("last = %d, want 4", last)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if e.Type != tt.want[i] {
+					t.Errorf("event %d type = %q, want %q", i, e.Type, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewLog_DefaultCapacity(t *testing.T) {
+	log := NewLog(0)
+	for range DefaultCapacity + 1 {
+		log.Publish("tick", "", nil)
+	}
+	got, _ := log.Since(0)
+	if len(got) != DefaultCapacity {
+		t.Errorf("retained %d events, want %d", len(got), DefaultCapacity)
+	}
+	if got[0].ID != 2 {
+		t.Errorf("oldest retained ID = %d, want 2", got[0].ID)
+	}
+}
@@ -0,0 +1,140 @@
+package faults
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDN describes the simulated CDN in front of encodersim.
+type CDN struct {
+	// HitRate is the fraction of responses, between 0 and 1, reported as
+	// cache hits. Ignored if Pattern is set.
+	HitRate float64
+
+	// Pattern, if set, is cycled through instead of sampling HitRate: true
+	// for a hit, false for a miss.
+	Pattern []bool
+
+	// Age, if set, is the distribution of the Age of hits. Misses always
+	// have an Age of 0.
+	Age Distribution
+
+	// Via, if set, is the Via header of every response.
+	Via string
+}
+
+// CacheStatus is the simulated cache status of one response.
+type CacheStatus struct {
+	Hit bool
+	Age time.Duration
+}
+
+// ParseCDN parses a comma-separated CDN header spec, such as
+//
+//	hit=80%,age=uniform:0s:30s,via=1.1 edge-sim
+//
+// made of:
+//
+//	hit=RATE               report a fraction RATE (such as 80% or 0.8) of
+//	                       responses as hits (default 0)
+//	pattern=HIT:MISS:...   cycle through HIT and MISS instead of sampling
+//	age=DISTRIBUTION       the Age of hits, see ParseDistribution (default 0)
+//	via=VALUE              the Via header (default none); VALUE may contain
+//	                       spaces but not commas
+func ParseCDN(spec string) (CDN, error) {
+	var c CDN
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || value == "" {
+			return CDN{}, fmt.Errorf("invalid CDN header option %q (want KEY=VALUE)", item)
+		}
+		if seen[key] {
+			return CDN{}, fmt.Errorf("CDN header option %q given twice", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "hit":
+			rate, err := parseRate(value)
+			if err != nil {
+				return CDN{}, fmt.Errorf("invalid hit rate %q (want a fraction such as 0.8 or a percentage such as 80%%)", value)
+			}
+			c.HitRate = rate
+		case "pattern":
+			for _, status := range strings.Split(value, ":") {
+				switch strings.ToUpper(status) {
+				case "HIT":
+					c.Pattern = append(c.Pattern, true)
+				case "MISS":
+					c.Pattern = append(c.Pattern, false)
+				default:
+					return CDN{}, fmt.Errorf("invalid cache status %q in pattern (want HIT or MISS)", status)
+				}
+			}
+		case "age":
+			d, err := ParseDistribution(value)
+			if err != nil {
+				return CDN{}, fmt.Errorf("age: %w", err)
+			}
+			c.Age = d
+		case "via":
+			c.Via = value
+		default:
+			return CDN{}, fmt.Errorf("unknown CDN header option %q (want hit, pattern, age or via)", key)
+		}
+	}
+	if seen["hit"] && seen["pattern"] {
+		return CDN{}, fmt.Errorf("hit and pattern are mutually exclusive")
+	}
+	return c, nil
+}
+
+// CDNHeaders samples the X-Cache, Age and Via headers of responses from a
+// simulated CDN. It is safe for concurrent use.
+type CDNHeaders struct {
+	cdn CDN
+
+	mu   sync.Mutex
+	rng  *rand.Rand
+	next int // index into cdn.Pattern
+}
+
+// NewCDNHeaders creates a CDNHeaders simulating cdn, drawing from a random
+// source seeded with seed.
+func NewCDNHeaders(cdn CDN, seed int64) *CDNHeaders {
+	return &CDNHeaders{cdn: cdn, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Via returns the Via header of every response, or "" for none.
+func (h *CDNHeaders) Via() string {
+	if h == nil {
+		return ""
+	}
+	return h.cdn.Via
+}
+
+// Sample draws the cache status of the next response. A nil CDNHeaders
+// always reports a miss.
+func (h *CDNHeaders) Sample() CacheStatus {
+	if h == nil {
+		return CacheStatus{}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var s CacheStatus
+	if pattern := h.cdn.Pattern; len(pattern) > 0 {
+		s.Hit = pattern[h.next]
+		h.next = (h.next + 1) % len(pattern)
+	} else {
+		s.Hit = h.rng.Float64() < h.cdn.HitRate
+	}
+	if s.Hit && h.cdn.Age != nil {
+		s.Age = h.cdn.Age.Sample(h.rng)
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+package faults
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCDN(t *testing.T) {
+	cdn, err := ParseCDN("hit=80%, age=fixed:12s, via=1.1 edge-sim")
+	if err != nil {
+		t.Fatalf("ParseCDN() error = %v", err)
+	}
+	if cdn.HitRate != 0.8 || cdn.Age.String() != "fixed:12s" || cdn.Via != "1.1 edge-sim" || cdn.Pattern != nil {
+		t.Errorf("ParseCDN() = %+v", cdn)
+	}
+
+	cdn, err = ParseCDN("pattern=HIT:hit:MISS")
+	if err != nil {
+		t.Fatalf("ParseCDN() error = %v", err)
+	}
+	if !reflect.DeepEqual(cdn.Pattern, []bool{true, true, false}) {
+		t.Errorf("Pattern = %v", cdn.Pattern)
+	}
+
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"", "want KEY=VALUE"},
+		{"hit", "want KEY=VALUE"},
+		{"hit=often", "invalid hit rate"},
+		{"hit=120%", "invalid hit rate"},
+		{"pattern=HIT:STALE", "invalid cache status"},
+		{"age=slow", "unknown distribution"},
+		{"via=a,via=b", "given twice"},
+		{"hit=50%,pattern=HIT:MISS", "mutually exclusive"},
+		{"status=HIT", "unknown CDN header option"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseCDN(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseCDN() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCDNHeaders_Sample(t *testing.T) {
+	age, _ := ParseDistribution("fixed:30s")
+	h := NewCDNHeaders(CDN{Pattern: []bool{true, false, false}, Age: age}, 1)
+	var got []CacheStatus
+	for i := 0; i < 4; i++ {
+		got = append(got, h.Sample())
+	}
+	want := []CacheStatus{{true, 30 * time.Second}, {}, {}, {true, 30 * time.Second}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Sample() = %v, want %v", got, want)
+	}
+
+	// About half of the responses are hits
+	h = NewCDNHeaders(CDN{HitRate: 0.5}, 1)
+	hits := 0
+	for i := 0; i < 1000; i++ {
+		if h.Sample().Hit {
+			hits++
+		}
+	}
+	if hits < 400 || hits > 600 {
+		t.Errorf("%d hits out of 1000 at a 50%% hit rate", hits)
+	}
+
+	var nilHeaders *CDNHeaders
+	if nilHeaders.Sample().Hit || nilHeaders.Via() != "" {
+		t.Error("A nil CDNHeaders should report misses and no Via")
+	}
+}
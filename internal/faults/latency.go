@@ -0,0 +1,193 @@
+// Package faults simulates a misbehaving origin or network by delaying,
+// failing and throttling the responses encodersim serves.
+package faults
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxDelay caps sampled delays, so that heavy-tailed distributions cannot
+// hold a request indefinitely.
+const MaxDelay = time.Minute
+
+// Distribution is a random distribution of delays.
+type Distribution interface {
+	// Sample draws a delay using rng. The result is between 0 and MaxDelay.
+	Sample(rng *rand.Rand) time.Duration
+
+	// String returns the spec the distribution was parsed from.
+	String() string
+}
+
+// ParseDistribution parses a distribution spec:
+//
+//	fixed:DELAY            always DELAY
+//	uniform:MIN:MAX        uniformly between MIN and MAX
+//	normal:MEAN:STDDEV     normally distributed, truncated at 0
+//	pareto:SCALE:SHAPE     Pareto (heavy-tailed) with minimum SCALE and
+//	                       shape parameter SHAPE (smaller is heavier)
+//
+// Delays are Go durations such as "200ms".
+func ParseDistribution(spec string) (Distribution, error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	args := strings.Split(params, ":")
+	want := map[string]int{"fixed": 1, "uniform": 2, "normal": 2, "pareto": 2}
+	n, ok := want[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown distribution %q (want fixed, uniform, normal or pareto)", kind)
+	}
+	if params == "" || len(args) != n {
+		return nil, fmt.Errorf("%s distribution needs %d parameter(s), got %q", kind, n, spec)
+	}
+
+	first, err := parseDelay(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s distribution: %w", kind, err)
+	}
+	switch kind {
+	case "fixed":
+		return fixed{spec, first}, nil
+	case "pareto":
+		shape, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || shape <= 0 || math.IsInf(shape, 0) {
+			return nil, fmt.Errorf("pareto distribution: invalid shape %q (want a positive number)", args[1])
+		}
+		if first <= 0 {
+			return nil, fmt.Errorf("pareto distribution: scale must be positive")
+		}
+		return pareto{spec, first, shape}, nil
+	}
+
+	second, err := parseDelay(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s distribution: %w", kind, err)
+	}
+	if kind == "uniform" {
+		if second < first {
+			return nil, fmt.Errorf("uniform distribution: max %s is less than min %s", second, first)
+		}
+		return uniform{spec, first, second}, nil
+	}
+	return normal{spec, first, second}, nil
+}
+
+// parseDelay parses a non-negative duration.
+func parseDelay(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid delay %q: %w", s, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("delay %q must not be negative", s)
+	}
+	return d, nil
+}
+
+// clamp limits d to [0, MaxDelay].
+func clamp(d float64) time.Duration {
+	if d <= 0 || math.IsNaN(d) {
+		return 0
+	}
+	if d >= float64(MaxDelay) {
+		return MaxDelay
+	}
+	return time.Duration(d)
+}
+
+type fixed struct {
+	spec  string
+	delay time.Duration
+}
+
+func (f fixed) Sample(*rand.Rand) time.Duration { return clamp(float64(f.delay)) }
+func (f fixed) String() string                  { return f.spec }
+
+type uniform struct {
+	spec     string
+	min, max time.Duration
+}
+
+func (u uniform) Sample(rng *rand.Rand) time.Duration {
+	return clamp(float64(u.min) + rng.Float64()*float64(u.max-u.min))
+}
+func (u uniform) String() string { return u.spec }
+
+type normal struct {
+	spec         string
+	mean, stddev time.Duration
+}
+
+func (n normal) Sample(rng *rand.Rand) time.Duration {
+	return clamp(float64(n.mean) + rng.NormFloat64()*float64(n.stddev))
+}
+func (n normal) String() string { return n.spec }
+
+type pareto struct {
+	spec  string
+	scale time.Duration
+	shape float64
+}
+
+func (p pareto) Sample(rng *rand.Rand) time.Duration {
+	// Inverse transform sampling; 1-Float64 is in (0, 1]
+	return clamp(float64(p.scale) / math.Pow(1-rng.Float64(), 1/p.shape))
+}
+func (p pareto) String() string { return p.spec }
+
+// ParseLatency parses a comma-separated list of CLASS=DISTRIBUTION pairs,
+// such as "variant=normal:200ms:50ms,playlist=fixed:300ms", into a
+// distribution per endpoint class.
+func ParseLatency(spec string) (map[string]Distribution, error) {
+	classes := make(map[string]Distribution)
+	for _, entry := range strings.Split(spec, ",") {
+		class, dist, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || class == "" {
+			return nil, fmt.Errorf("invalid latency %q (want CLASS=DISTRIBUTION)", entry)
+		}
+		if _, dup := classes[class]; dup {
+			return nil, fmt.Errorf("latency for %q given twice", class)
+		}
+		d, err := ParseDistribution(dist)
+		if err != nil {
+			return nil, fmt.Errorf("latency for %q: %w", class, err)
+		}
+		classes[class] = d
+	}
+	return classes, nil
+}
+
+// Latency samples the first-byte delay of responses by endpoint class. It
+// is safe for concurrent use.
+type Latency struct {
+	classes map[string]Distribution
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewLatency creates a Latency that delays responses of the given endpoint
+// classes, drawing from a random source seeded with seed.
+func NewLatency(classes map[string]Distribution, seed int64) *Latency {
+	return &Latency{classes: classes, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Delay samples the delay for a response of class, or returns 0 if the
+// class has no distribution. A nil Latency never delays.
+func (l *Latency) Delay(class string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	dist, ok := l.classes[class]
+	if !ok {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return dist.Sample(l.rng)
+}
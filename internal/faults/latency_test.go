@@ -0,0 +1,135 @@
+package faults
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"fixed:300ms", ""},
+		{"uniform:100ms:200ms", ""},
+		{"normal:200ms:50ms", ""},
+		{"pareto:20ms:1.5", ""},
+		{"fixed:0s", ""},
+		{"gamma:1s:2s", "unknown distribution"},
+		{"fixed", "needs 1 parameter"},
+		{"normal:200ms", "needs 2 parameter"},
+		{"fixed:1s:2s", "needs 1 parameter"},
+		{"fixed:fast", "invalid delay"},
+		{"fixed:-1s", "must not be negative"},
+		{"uniform:2s:1s", "less than min"},
+		{"pareto:20ms:0", "invalid shape"},
+		{"pareto:0s:1.5", "scale must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			d, err := ParseDistribution(tt.spec)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseDistribution() error = %v", err)
+				}
+				if d.String() != tt.spec {
+					t.Errorf("String() = %q, want %q", d.String(), tt.spec)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseDistribution() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDistributionSample(t *testing.T) {
+	tests := []struct {
+		spec     string
+		min, max time.Duration
+		mean     time.Duration // checked within 10% if non-zero
+	}{
+		{"fixed:300ms", 300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		{"uniform:100ms:200ms", 100 * time.Millisecond, 200 * time.Millisecond, 150 * time.Millisecond},
+		{"normal:200ms:50ms", 0, MaxDelay, 200 * time.Millisecond},
+		// Truncated at zero
+		{"normal:0s:1s", 0, MaxDelay, 0},
+		// Mean of Pareto is scale*shape/(shape-1)
+		{"pareto:20ms:3", 20 * time.Millisecond, MaxDelay, 30 * time.Millisecond},
+		{"fixed:2h", MaxDelay, MaxDelay, MaxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			d, err := ParseDistribution(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseDistribution() error = %v", err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			const n = 20000
+			var sum time.Duration
+			for i := 0; i < n; i++ {
+				s := d.Sample(rng)
+				if s < tt.min || s > tt.max {
+					t.Fatalf("Sample() = %s, want between %s and %s", s, tt.min, tt.max)
+				}
+				sum += s
+			}
+			if tt.mean == 0 {
+				return
+			}
+			mean := sum / n
+			if diff := mean - tt.mean; diff > tt.mean/10 || diff < -tt.mean/10 {
+				t.Errorf("mean of samples = %s, want about %s", mean, tt.mean)
+			}
+		})
+	}
+}
+
+func TestParseLatency(t *testing.T) {
+	classes, err := ParseLatency("variant=normal:200ms:50ms, playlist=fixed:300ms")
+	if err != nil {
+		t.Fatalf("ParseLatency() error = %v", err)
+	}
+	if len(classes) != 2 || classes["variant"].String() != "normal:200ms:50ms" || classes["playlist"].String() != "fixed:300ms" {
+		t.Errorf("ParseLatency() = %v", classes)
+	}
+
+	for _, spec := range []string{"", "variant", "=fixed:1s", "variant=fixed:1s,variant=fixed:2s", "variant=slow"} {
+		if _, err := ParseLatency(spec); err == nil {
+			t.Errorf("ParseLatency(%q) error = nil, want an error", spec)
+		}
+	}
+}
+
+func TestLatency_Delay(t *testing.T) {
+	classes, err := ParseLatency("variant=fixed:250ms,playlist=uniform:1s:2s")
+	if err != nil {
+		t.Fatalf("ParseLatency() error = %v", err)
+	}
+	l := NewLatency(classes, 1)
+
+	if got := l.Delay("variant"); got != 250*time.Millisecond {
+		t.Errorf("Delay(variant) = %s, want 250ms", got)
+	}
+	if got := l.Delay("health"); got != 0 {
+		t.Errorf("Delay(health) = %s, want 0", got)
+	}
+
+	// Same seed, same delays
+	a, b := NewLatency(classes, 7), NewLatency(classes, 7)
+	for i := 0; i < 10; i++ {
+		if da, db := a.Delay("playlist"), b.Delay("playlist"); da != db {
+			t.Fatalf("delay %d differs with the same seed: %s vs %s", i, da, db)
+		}
+	}
+
+	var none *Latency
+	if got := none.Delay("variant"); got != 0 {
+		t.Errorf("nil Latency Delay() = %s, want 0", got)
+	}
+}
@@ -0,0 +1,314 @@
+package faults
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownProfile is returned by Shaper.Activate for a profile name that
+// was not loaded.
+var ErrUnknownProfile = errors.New("unknown network profile")
+
+// Profile is a named set of network conditions applied to responses.
+type Profile struct {
+	Name string
+
+	// Latency, if set, is the distribution of the first-byte delay.
+	Latency Distribution
+
+	// Jitter adds a uniformly distributed delay between 0 and Jitter.
+	Jitter time.Duration
+
+	// ErrorRate is the fraction of responses, between 0 and 1, replaced by
+	// an ErrorStatus response, simulating lost requests.
+	ErrorRate float64
+
+	// ErrorStatus is the status code of simulated errors.
+	ErrorStatus int
+
+	// Throughput caps the rate at which response bodies are sent, in bits
+	// per second. 0 means unlimited.
+	Throughput int64
+
+	// Endpoints are the endpoint classes the profile applies to. Empty
+	// means every endpoint.
+	Endpoints []string
+}
+
+// profileFile is the YAML form of a profiles file.
+type profileFile struct {
+	Profiles []struct {
+		Name        string        `yaml:"name"`
+		Latency     string        `yaml:"latency"`
+		Jitter      time.Duration `yaml:"jitter"`
+		ErrorRate   float64       `yaml:"error-rate"`
+		ErrorStatus int           `yaml:"error-status"`
+		Throughput  string        `yaml:"throughput"`
+		Endpoints   []string      `yaml:"endpoints"`
+	} `yaml:"profiles"`
+}
+
+// LoadProfiles reads and parses a profiles file.
+func LoadProfiles(path string) ([]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// ParseProfiles parses YAML network profiles:
+//
+//	profiles:
+//	  - name: 3g
+//	    latency: normal:300ms:80ms   # a distribution, see ParseDistribution
+//	    jitter: 100ms
+//	    error-rate: 0.02
+//	    error-status: 503            # the default
+//	    throughput: 1.5Mbps
+//	    endpoints: [variant]         # every endpoint if omitted
+//
+// Every field but name is optional. Unknown fields are rejected so that
+// typos do not silently change a profile.
+func ParseProfiles(data []byte) ([]Profile, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var file profileFile
+	if err := dec.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("profiles file is empty")
+		}
+		return nil, fmt.Errorf("parse profiles: %w", err)
+	}
+	if len(file.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles defined")
+	}
+
+	seen := make(map[string]bool)
+	profiles := make([]Profile, 0, len(file.Profiles))
+	for i, f := range file.Profiles {
+		if f.Name == "" {
+			return nil, fmt.Errorf("profile %d: name is required", i+1)
+		}
+		if seen[f.Name] {
+			return nil, fmt.Errorf("profile %q defined twice", f.Name)
+		}
+		seen[f.Name] = true
+
+		p := Profile{
+			Name:        f.Name,
+			Jitter:      f.Jitter,
+			ErrorRate:   f.ErrorRate,
+			ErrorStatus: f.ErrorStatus,
+			Endpoints:   f.Endpoints,
+		}
+		if f.Latency != "" {
+			d, err := ParseDistribution(f.Latency)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: latency: %w", f.Name, err)
+			}
+			p.Latency = d
+		}
+		if p.Jitter < 0 {
+			return nil, fmt.Errorf("profile %q: jitter must not be negative", f.Name)
+		}
+		if p.ErrorRate < 0 || p.ErrorRate > 1 {
+			return nil, fmt.Errorf("profile %q: error-rate must be between 0 and 1, got %g", f.Name, p.ErrorRate)
+		}
+		if p.ErrorStatus == 0 {
+			p.ErrorStatus = 503
+		}
+		if p.ErrorStatus < 400 || p.ErrorStatus > 599 {
+			return nil, fmt.Errorf("profile %q: error-status must be a 4xx or 5xx code, got %d", f.Name, p.ErrorStatus)
+		}
+		if f.Throughput != "" {
+			bps, err := ParseThroughput(f.Throughput)
+			if err != nil {
+				return nil, fmt.Errorf("profile %q: %w", f.Name, err)
+			}
+			p.Throughput = bps
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// ParseThroughput parses a positive rate in bits per second with a bps,
+// kbps, Mbps or Gbps suffix, such as "1.5Mbps". Prefixes are decimal.
+func ParseThroughput(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   float64
+	}{{"Gbps", 1e9}, {"Mbps", 1e6}, {"kbps", 1e3}, {"bps", 1}}
+	for _, u := range units {
+		num, ok := strings.CutSuffix(s, u.suffix)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil || n <= 0 || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("invalid throughput %q (want a positive rate such as 1.5Mbps)", s)
+		}
+		bps := n * u.mult
+		if bps < 1 || bps > math.MaxInt64/2 {
+			return 0, fmt.Errorf("throughput %q is out of range", s)
+		}
+		return int64(bps), nil
+	}
+	return 0, fmt.Errorf("invalid throughput %q (want a bps, kbps, Mbps or Gbps suffix)", s)
+}
+
+// Conditions are the network conditions sampled for one response.
+type Conditions struct {
+	// Delay is how long to wait before handling the request.
+	Delay time.Duration
+
+	// Status, if not 0, is the status code to answer with instead of
+	// handling the request.
+	Status int
+
+	// Throughput caps the response body rate in bits per second; 0 means
+	// unlimited.
+	Throughput int64
+
+	// Stale, if not 0, is how many advances behind the live window a
+	// variant playlist is served.
+	Stale int
+
+	// Stall, if not 0, is how long the response pauses halfway through its
+	// body.
+	Stall time.Duration
+
+	// Truncate cuts the response body off halfway.
+	Truncate bool
+}
+
+// Shaper applies the active one of a set of network profiles. It is safe
+// for concurrent use.
+type Shaper struct {
+	profiles []Profile
+
+	mu     sync.Mutex
+	active *Profile
+	rng    *rand.Rand
+}
+
+// NewShaper creates a Shaper with no active profile, drawing from a random
+// source seeded with seed.
+func NewShaper(profiles []Profile, seed int64) *Shaper {
+	return &Shaper{profiles: profiles, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Profiles returns the names of the loaded profiles, in file order. A nil
+// Shaper has none.
+func (s *Shaper) Profiles() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, len(s.profiles))
+	for i, p := range s.profiles {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Active returns the name of the active profile, or "" if none is.
+func (s *Shaper) Active() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return ""
+	}
+	return s.active.Name
+}
+
+// Activate makes the named profile active. The empty name deactivates the
+// active profile, restoring normal conditions.
+func (s *Shaper) Activate(name string) error {
+	if s == nil {
+		return fmt.Errorf("no network profiles loaded")
+	}
+	var active *Profile
+	if name != "" {
+		for i := range s.profiles {
+			if s.profiles[i].Name == name {
+				active = &s.profiles[i]
+				break
+			}
+		}
+		if active == nil {
+			return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active = active
+	return nil
+}
+
+// Conditions samples the conditions for a response of class under the
+// active profile. They are zero if no profile is active, the profile does
+// not apply to class, or s is nil.
+func (s *Shaper) Conditions(class string) Conditions {
+	if s == nil {
+		return Conditions{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.active
+	if p == nil || (len(p.Endpoints) > 0 && !slices.Contains(p.Endpoints, class)) {
+		return Conditions{}
+	}
+
+	c := Conditions{Throughput: p.Throughput}
+	if p.Latency != nil {
+		c.Delay = p.Latency.Sample(s.rng)
+	}
+	if p.Jitter > 0 {
+		c.Delay = clamp(float64(c.Delay) + s.rng.Float64()*float64(p.Jitter))
+	}
+	if p.ErrorRate > 0 && s.rng.Float64() < p.ErrorRate {
+		c.Status = p.ErrorStatus
+	}
+	return c
+}
+
+// Pacer paces a stream of bytes to a throughput cap.
+type Pacer struct {
+	bitsPerSecond int64
+	start         time.Time
+	sent          int64
+}
+
+// NewPacer creates a Pacer for a stream starting now.
+func NewPacer(bitsPerSecond int64) *Pacer {
+	return &Pacer{bitsPerSecond: bitsPerSecond, start: time.Now()}
+}
+
+// Reserve accounts for n more bytes and returns how long to wait before
+// sending them to stay within the cap.
+func (p *Pacer) Reserve(n int) time.Duration {
+	p.sent += int64(n)
+	due := p.start.Add(time.Duration(float64(p.sent*8) / float64(p.bitsPerSecond) * float64(time.Second)))
+	return time.Until(due)
+}
@@ -0,0 +1,164 @@
+package faults
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProfiles = `
+profiles:
+  - name: 3g
+    latency: fixed:300ms
+    jitter: 100ms
+    error-rate: 0.5
+    throughput: 1.5Mbps
+    endpoints: [variant]
+  - name: outage
+    error-rate: 1
+    error-status: 504
+`
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := ParseProfiles([]byte(testProfiles))
+	if err != nil {
+		t.Fatalf("ParseProfiles() error = %v", err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("ParseProfiles() returned %d profiles, want 2", len(profiles))
+	}
+	p := profiles[0]
+	if p.Name != "3g" || p.Latency.String() != "fixed:300ms" || p.Jitter != 100*time.Millisecond ||
+		p.ErrorRate != 0.5 || p.ErrorStatus != 503 || p.Throughput != 1_500_000 || len(p.Endpoints) != 1 {
+		t.Errorf("profile 3g = %+v", p)
+	}
+	if p := profiles[1]; p.Latency != nil || p.ErrorStatus != 504 || p.Throughput != 0 {
+		t.Errorf("profile outage = %+v", p)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "", "empty"},
+		{"no profiles", "profiles: []\n", "no profiles"},
+		{"missing name", "profiles:\n  - jitter: 1s\n", "name is required"},
+		{"duplicate", "profiles:\n  - name: a\n  - name: a\n", "defined twice"},
+		{"unknown field", "profiles:\n  - name: a\n    latancy: fixed:1s\n", "latancy"},
+		{"bad latency", "profiles:\n  - name: a\n    latency: slow\n", "unknown distribution"},
+		{"negative jitter", "profiles:\n  - name: a\n    jitter: -1s\n", "jitter"},
+		{"error rate", "profiles:\n  - name: a\n    error-rate: 1.5\n", "between 0 and 1"},
+		{"error status", "profiles:\n  - name: a\n    error-status: 200\n", "4xx or 5xx"},
+		{"throughput", "profiles:\n  - name: a\n    throughput: fast\n", "invalid throughput"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProfiles([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseProfiles() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseThroughput(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"800bps", 800, false},
+		{"256kbps", 256_000, false},
+		{"1.5Mbps", 1_500_000, false},
+		{"1Gbps", 1_000_000_000, false},
+		{"0Mbps", 0, true},
+		{"-1kbps", 0, true},
+		{"1MBps", 0, true},
+		{"1000", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseThroughput(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseThroughput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseThroughput() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShaper(t *testing.T) {
+	profiles, err := ParseProfiles([]byte(testProfiles))
+	if err != nil {
+		t.Fatalf("ParseProfiles() error = %v", err)
+	}
+	s := NewShaper(profiles, 1)
+
+	if got := s.Conditions("variant"); got != (Conditions{}) {
+		t.Errorf("Conditions() with no active profile = %+v", got)
+	}
+	if err := s.Activate("edge"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Activate(edge) error = %v, want ErrUnknownProfile", err)
+	}
+
+	if err := s.Activate("3g"); err != nil {
+		t.Fatalf("Activate(3g) error = %v", err)
+	}
+	if s.Active() != "3g" {
+		t.Errorf("Active() = %q, want 3g", s.Active())
+	}
+	var failed int
+	const n = 1000
+	for i := 0; i < n; i++ {
+		c := s.Conditions("variant")
+		if c.Delay < 300*time.Millisecond || c.Delay > 400*time.Millisecond {
+			t.Fatalf("Delay = %s, want between 300ms and 400ms", c.Delay)
+		}
+		if c.Throughput != 1_500_000 {
+			t.Fatalf("Throughput = %d, want 1500000", c.Throughput)
+		}
+		if c.Status != 0 {
+			failed++
+		}
+	}
+	if failed < n/3 || failed > 2*n/3 {
+		t.Errorf("%d of %d responses failed, want about half", failed, n)
+	}
+	// 3g only applies to variant playlists
+	if got := s.Conditions("playlist"); got != (Conditions{}) {
+		t.Errorf("Conditions(playlist) = %+v, want none", got)
+	}
+
+	if err := s.Activate("outage"); err != nil {
+		t.Fatalf("Activate(outage) error = %v", err)
+	}
+	if got := s.Conditions("health"); got.Status != 504 {
+		t.Errorf("Conditions(health) = %+v, want status 504", got)
+	}
+
+	if err := s.Activate(""); err != nil {
+		t.Fatalf("Activate(\"\") error = %v", err)
+	}
+	if s.Active() != "" || s.Conditions("variant") != (Conditions{}) {
+		t.Errorf("Expected normal conditions after deactivating")
+	}
+
+	var none *Shaper
+	if none.Conditions("variant") != (Conditions{}) || none.Active() != "" || none.Activate("3g") == nil {
+		t.Error("Expected a nil Shaper to apply no conditions and reject profiles")
+	}
+}
+
+func TestPacer(t *testing.T) {
+	p := NewPacer(8000) // 1000 bytes per second
+	if wait := p.Reserve(100); wait < 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("Reserve(100) = %s, want about 100ms", wait)
+	}
+	if wait := p.Reserve(400); wait < 490*time.Millisecond || wait > 500*time.Millisecond {
+		t.Errorf("Reserve(400) = %s, want about 500ms", wait)
+	}
+}
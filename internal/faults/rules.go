@@ -0,0 +1,280 @@
+package faults
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule injects faults into the responses to paths matching a regular
+// expression.
+type Rule struct {
+	// Path is matched against the request path, unanchored.
+	Path *regexp.Regexp
+
+	// Latency, if set, is the distribution of the delay added to matching
+	// responses.
+	Latency Distribution
+
+	// ErrorStatus, if not 0, is the status code that replaces a fraction
+	// ErrorRate of matching responses.
+	ErrorStatus int
+	ErrorRate   float64
+
+	// Throughput, if not 0, caps the body rate of matching responses in
+	// bits per second.
+	Throughput int64
+
+	// Stale, if not 0, is how many advances behind the live window a
+	// fraction StaleRate of matching variant playlists are, served with
+	// 200 OK like a misconfigured CDN cache.
+	Stale     int
+	StaleRate float64
+
+	// Stall, if not 0, is how long a fraction StallRate of matching
+	// responses pause halfway through their body.
+	Stall     time.Duration
+	StallRate float64
+
+	// TruncateRate is the fraction of matching responses whose body is cut
+	// off halfway, dropping the connection.
+	TruncateRate float64
+
+	// OutageEvery, if not 0, schedules an outage window every OutageEvery
+	// since the start, lasting OutageFor, during which matching responses
+	// are 503 Service Unavailable.
+	OutageEvery time.Duration
+	OutageFor   time.Duration
+}
+
+// ParseRules parses fault rules separated by semicolons. Each rule is a path
+// regular expression and a fault spec separated by whitespace, such as
+//
+//	^/variant/1/ error=404:5%; ^/playlist\.m3u8$ latency=fixed:300ms
+//
+// A fault spec is a comma-separated list of:
+//
+//	latency=DISTRIBUTION   add a delay, see ParseDistribution
+//	error=STATUS[:RATE]    answer with STATUS, for a fraction RATE (such as
+//	                       5% or 0.05) of responses or all of them
+//	throughput=RATE        cap the body rate, see ParseThroughput
+//	stale=N[:RATE]         serve variant playlists N advances behind the
+//	                       live window, for a fraction RATE of responses or
+//	                       all of them
+//	stall=DURATION[:RATE]  pause for DURATION halfway through the body, for
+//	                       a fraction RATE of responses or all of them
+//	truncate=RATE          cut the body off halfway for a fraction RATE of
+//	                       responses
+//	outage=EVERY/FOR       answer 503 for FOR every EVERY since the start,
+//	                       such as 10m/30s
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Fields(entry)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid fault rule %q (want PATH_REGEX FAULTS)", entry)
+		}
+		re, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("fault rule %q: invalid path regex: %w", entry, err)
+		}
+		rule := Rule{Path: re}
+		if err := rule.parseFaults(fields[1]); err != nil {
+			return nil, fmt.Errorf("fault rule %q: %w", entry, err)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no fault rules")
+	}
+	return rules, nil
+}
+
+// parseFaults parses a rule's fault spec into r.
+func (r *Rule) parseFaults(spec string) error {
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("invalid fault %q (want KEY=VALUE)", item)
+		}
+		if seen[key] {
+			return fmt.Errorf("fault %q given twice", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "latency":
+			d, err := ParseDistribution(value)
+			if err != nil {
+				return fmt.Errorf("latency: %w", err)
+			}
+			r.Latency = d
+		case "error":
+			status, rate, hasRate := strings.Cut(value, ":")
+			code, err := strconv.Atoi(status)
+			if err != nil || code < 400 || code > 599 {
+				return fmt.Errorf("error status must be a 4xx or 5xx code, got %q", status)
+			}
+			r.ErrorStatus, r.ErrorRate = code, 1
+			if hasRate {
+				if r.ErrorRate, err = parseRate(rate); err != nil {
+					return err
+				}
+			}
+		case "throughput":
+			bps, err := ParseThroughput(value)
+			if err != nil {
+				return err
+			}
+			r.Throughput = bps
+		case "stale":
+			advances, rate, hasRate := strings.Cut(value, ":")
+			n, err := strconv.Atoi(advances)
+			if err != nil || n < 1 {
+				return fmt.Errorf("stale advances must be a positive number, got %q", advances)
+			}
+			r.Stale, r.StaleRate = n, 1
+			if hasRate {
+				if r.StaleRate, err = parseRate(rate); err != nil {
+					return err
+				}
+			}
+		case "stall":
+			delay, rate, hasRate := strings.Cut(value, ":")
+			d, err := parseDelay(delay)
+			if err != nil || d == 0 {
+				return fmt.Errorf("stall must be a positive duration, got %q", delay)
+			}
+			r.Stall, r.StallRate = d, 1
+			if hasRate {
+				if r.StallRate, err = parseRate(rate); err != nil {
+					return err
+				}
+			}
+		case "truncate":
+			rate, err := parseRate(value)
+			if err != nil {
+				return err
+			}
+			r.TruncateRate = rate
+		case "outage":
+			every, length, ok := strings.Cut(value, "/")
+			e, err := time.ParseDuration(every)
+			if !ok || err != nil || e <= 0 {
+				return fmt.Errorf("outage must be EVERY/FOR such as 10m/30s, got %q", value)
+			}
+			l, err := time.ParseDuration(length)
+			if err != nil || l <= 0 || l >= e {
+				return fmt.Errorf("outage length %q must be positive and shorter than the period %s", length, every)
+			}
+			r.OutageEvery, r.OutageFor = e, l
+		default:
+			return fmt.Errorf("unknown fault %q (want latency, error, throughput, stale, stall, truncate or outage)", key)
+		}
+	}
+	return nil
+}
+
+// parseRate parses a fraction between 0 and 1, given either as a number or
+// as a percentage such as "5%".
+func parseRate(s string) (float64, error) {
+	num, percent := strings.CutSuffix(s, "%")
+	rate, err := strconv.ParseFloat(num, 64)
+	if percent {
+		rate /= 100
+	}
+	if err != nil || rate < 0 || rate > 1 || math.IsNaN(rate) {
+		return 0, fmt.Errorf("invalid error rate %q (want a fraction such as 0.05 or a percentage such as 5%%)", s)
+	}
+	return rate, nil
+}
+
+// PathFaults applies fault rules to requests by path. It is safe for
+// concurrent use.
+type PathFaults struct {
+	rules []Rule
+	start time.Time // of the outage windows
+	now   func() time.Time
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewPathFaults creates a PathFaults applying rules, drawing from a random
+// source seeded with seed. Outage windows are scheduled from now.
+func NewPathFaults(rules []Rule, seed int64) *PathFaults {
+	return &PathFaults{
+		rules: rules,
+		start: time.Now(),
+		now:   time.Now,
+		rng:   rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Conditions samples the conditions for a response to path. Every matching
+// rule applies: their delays add up, the first error to strike wins, the
+// lowest throughput cap holds and the stalest playlist and longest stall win.
+// A nil PathFaults applies none.
+func (f *PathFaults) Conditions(path string) Conditions {
+	if f == nil {
+		return Conditions{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	elapsed := f.now().Sub(f.start)
+	var c Conditions
+	for _, r := range f.rules {
+		if !r.Path.MatchString(path) {
+			continue
+		}
+		var rc Conditions
+		if r.Latency != nil {
+			rc.Delay = r.Latency.Sample(f.rng)
+		}
+		if r.OutageEvery != 0 && elapsed >= r.OutageEvery && elapsed%r.OutageEvery < r.OutageFor {
+			rc.Status = http.StatusServiceUnavailable
+		} else if r.ErrorStatus != 0 && f.rng.Float64() < r.ErrorRate {
+			rc.Status = r.ErrorStatus
+		}
+		rc.Throughput = r.Throughput
+		if r.Stale != 0 && f.rng.Float64() < r.StaleRate {
+			rc.Stale = r.Stale
+		}
+		if r.Stall != 0 && f.rng.Float64() < r.StallRate {
+			rc.Stall = r.Stall
+		}
+		rc.Truncate = r.TruncateRate > 0 && f.rng.Float64() < r.TruncateRate
+		c = c.Add(rc)
+	}
+	return c
+}
+
+// Add combines two sets of conditions applying to the same response: the
+// delays add up, c's error takes precedence over o's, the lower throughput
+// cap holds, the staler playlist and longer stall win and a truncated body
+// stays truncated.
+func (c Conditions) Add(o Conditions) Conditions {
+	c.Delay = clamp(float64(c.Delay + o.Delay))
+	if c.Status == 0 {
+		c.Status = o.Status
+	}
+	if c.Throughput == 0 || (o.Throughput != 0 && o.Throughput < c.Throughput) {
+		c.Throughput = o.Throughput
+	}
+	c.Stale = max(c.Stale, o.Stale)
+	c.Stall = max(c.Stall, o.Stall)
+	c.Truncate = c.Truncate || o.Truncate
+	return c
+}
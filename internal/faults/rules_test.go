@@ -0,0 +1,170 @@
+package faults
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`^/variant/1/ error=404:5%; ^/playlist\.m3u8$ latency=fixed:300ms,throughput=1Mbps;`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("ParseRules() returned %d rules, want 2", len(rules))
+	}
+	if r := rules[0]; r.Path.String() != "^/variant/1/" || r.ErrorStatus != 404 || r.ErrorRate != 0.05 || r.Latency != nil {
+		t.Errorf("rule 1 = %+v", r)
+	}
+	if r := rules[1]; r.Latency.String() != "fixed:300ms" || r.Throughput != 1_000_000 || r.ErrorStatus != 0 {
+		t.Errorf("rule 2 = %+v", r)
+	}
+
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"", "no fault rules"},
+		{"^/variant/", "want PATH_REGEX FAULTS"},
+		{"^/variant/ error=404 extra", "want PATH_REGEX FAULTS"},
+		{"^/variant/( error=404", "invalid path regex"},
+		{"^/variant/ error", "want KEY=VALUE"},
+		{"^/variant/ error=200", "4xx or 5xx"},
+		{"^/variant/ error=503:150%", "invalid error rate"},
+		{"^/variant/ error=503:often", "invalid error rate"},
+		{"^/variant/ latency=slow", "unknown distribution"},
+		{"^/variant/ throughput=fast", "invalid throughput"},
+		{"^/variant/ error=503,error=404", "given twice"},
+		{"^/variant/ stale=0", "positive number"},
+		{"^/variant/ stale=2:sometimes", "invalid error rate"},
+		{"^/variant/ stall=0s", "positive duration"},
+		{"^/variant/ stall=1s:2", "invalid error rate"},
+		{"^/variant/ truncate=often", "invalid error rate"},
+		{"^/variant/ outage=10m", "EVERY/FOR"},
+		{"^/variant/ outage=30s/1m", "shorter than the period"},
+		{"^/variant/ drop=1", "unknown fault"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseRules(tt.spec)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseRules() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPathFaults_Conditions(t *testing.T) {
+	rules, err := ParseRules(`^/variant/ latency=fixed:100ms,throughput=2Mbps; ^/variant/1/ error=404:0.5,latency=fixed:50ms,throughput=1Mbps; ^/health$ error=503`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	f := NewPathFaults(rules, 1)
+
+	// Only the first rule matches variant 0
+	if got := f.Conditions("/variant/0/playlist.m3u8"); got != (Conditions{Delay: 100 * time.Millisecond, Throughput: 2_000_000}) {
+		t.Errorf("Conditions(variant 0) = %+v", got)
+	}
+	if got := f.Conditions("/playlist.m3u8"); got != (Conditions{}) {
+		t.Errorf("Conditions(master) = %+v, want none", got)
+	}
+	if got := f.Conditions("/health"); got.Status != 503 {
+		t.Errorf("Conditions(health) = %+v, want status 503", got)
+	}
+
+	// Both rules match variant 1: delays add up, the lower cap holds
+	var failed int
+	const n = 1000
+	for i := 0; i < n; i++ {
+		c := f.Conditions("/variant/1/playlist.m3u8")
+		if c.Delay != 150*time.Millisecond || c.Throughput != 1_000_000 {
+			t.Fatalf("Conditions(variant 1) = %+v", c)
+		}
+		switch c.Status {
+		case 404:
+			failed++
+		case 0:
+		default:
+			t.Fatalf("Status = %d, want 404 or 0", c.Status)
+		}
+	}
+	if failed < n/3 || failed > 2*n/3 {
+		t.Errorf("%d of %d responses failed, want about half", failed, n)
+	}
+
+	// The stalest matching playlist wins
+	rules, err = ParseRules(`^/variant/ stale=2; ^/variant/1/ stale=5:25%`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	if r := rules[1]; r.Stale != 5 || r.StaleRate != 0.25 {
+		t.Errorf("rule 2 = %+v", r)
+	}
+	f = NewPathFaults(rules, 1)
+	stale := map[int]int{}
+	for i := 0; i < n; i++ {
+		stale[f.Conditions("/variant/1/playlist.m3u8").Stale]++
+	}
+	if len(stale) != 2 || stale[5] < n/8 || stale[5] > 3*n/8 {
+		t.Errorf("stale advances of %d responses = %v, want 2 or 5 (about a quarter)", n, stale)
+	}
+
+	// Body faults: the longest stall wins, truncation sticks
+	rules, err = ParseRules(`^/variant/ stall=1s,truncate=50%; ^/variant/1/ stall=3s:0.5`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	f = NewPathFaults(rules, 1)
+	stalls := map[time.Duration]int{}
+	var truncated int
+	for i := 0; i < n; i++ {
+		c := f.Conditions("/variant/1/playlist.m3u8")
+		stalls[c.Stall]++
+		if c.Truncate {
+			truncated++
+		}
+	}
+	if len(stalls) != 2 || stalls[3*time.Second] < n/3 || stalls[3*time.Second] > 2*n/3 {
+		t.Errorf("stalls of %d responses = %v, want 1s or 3s (about half)", n, stalls)
+	}
+	if truncated < n/3 || truncated > 2*n/3 {
+		t.Errorf("%d of %d responses truncated, want about half", truncated, n)
+	}
+
+	var none *PathFaults
+	if got := none.Conditions("/health"); got != (Conditions{}) {
+		t.Errorf("nil PathFaults Conditions() = %+v", got)
+	}
+}
+
+func TestPathFaults_Outage(t *testing.T) {
+	rules, err := ParseRules(`^/variant/ outage=10m/30s`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	f := NewPathFaults(rules, 1)
+	var elapsed time.Duration
+	f.now = func() time.Time { return f.start.Add(elapsed) }
+
+	tests := []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 0},
+		{9*time.Minute + 59*time.Second, 0},
+		{10 * time.Minute, 503},
+		{10*time.Minute + 29*time.Second, 503},
+		{10*time.Minute + 30*time.Second, 0},
+		{20*time.Minute + 10*time.Second, 503},
+	}
+	for _, tt := range tests {
+		elapsed = tt.elapsed
+		if got := f.Conditions("/variant/0/playlist.m3u8").Status; got != tt.want {
+			t.Errorf("status after %s = %d, want %d", tt.elapsed, got, tt.want)
+		}
+	}
+	if got := f.Conditions("/playlist.m3u8").Status; got != 0 {
+		t.Errorf("status of an unmatched path during an outage = %d, want 0", got)
+	}
+}
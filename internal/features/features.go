@@ -0,0 +1,98 @@
+// Package features gates experimental subsystems behind --enable-feature, so
+// that risky behavior can ship dark in every build and be turned on per
+// environment.
+package features
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Experimental feature names.
+const (
+	// LLHLS enables the Low-Latency HLS server features that do not need
+	// partial segments: blocking playlist reload (_HLS_msn), advertised with
+	// EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES.
+	LLHLS = "ll-hls"
+
+	// DeltaUpdates enables playlist delta updates (_HLS_skip=YES), advertised
+	// with EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL.
+	DeltaUpdates = "delta-updates"
+)
+
+// Flag describes an experimental feature.
+type Flag struct {
+	Name        string
+	Description string
+}
+
+// Flags lists every experimental feature.
+var Flags = []Flag{
+	{LLHLS, "LL-HLS blocking playlist reload on variant playlists"},
+	{DeltaUpdates, "playlist delta updates with EXT-X-SKIP"},
+}
+
+// Set holds the enabled experimental features. The zero value enables none.
+type Set map[string]bool
+
+// Parse parses a comma-separated list of feature names, such as
+// "ll-hls,delta-updates". An empty list enables nothing.
+func Parse(list string) (Set, error) {
+	set := Set{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !known(name) {
+			return nil, fmt.Errorf("unknown feature %q (want one of %s)", name, strings.Join(names(), ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// Enabled reports whether the named feature is enabled.
+func (s Set) Enabled(name string) bool {
+	return s[name]
+}
+
+// Names returns the enabled features in sorted order.
+func (s Set) Names() []string {
+	enabled := []string{}
+	for name, on := range s {
+		if on {
+			enabled = append(enabled, name)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+
+// Status maps every experimental feature to whether it is enabled, so that
+// /version also shows the features that could be turned on.
+func (s Set) Status() map[string]bool {
+	status := make(map[string]bool, len(Flags))
+	for _, f := range Flags {
+		status[f.Name] = s.Enabled(f.Name)
+	}
+	return status
+}
+
+func known(name string) bool {
+	for _, f := range Flags {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func names() []string {
+	all := make([]string, len(Flags))
+	for i, f := range Flags {
+		all[i] = f.Name
+	}
+	return all
+}
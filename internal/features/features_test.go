@@ -0,0 +1,46 @@
+package features
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", []string{}, false},
+		{"one", "ll-hls", []string{LLHLS}, false},
+		{"several with spaces", " delta-updates , ll-hls,", []string{DeltaUpdates, LLHLS}, false},
+		{"repeated", "ll-hls,ll-hls", []string{LLHLS}, false},
+		{"unknown", "ll-hls,turbo", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Parse(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.list, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := set.Names(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q).Names() = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet_Status(t *testing.T) {
+	var none Set
+	if none.Enabled(LLHLS) {
+		t.Error("zero Set enables ll-hls")
+	}
+	want := map[string]bool{LLHLS: false, DeltaUpdates: true}
+	if got := (Set{DeltaUpdates: true}).Status(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Status() = %v, want %v", got, want)
+	}
+}
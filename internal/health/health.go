@@ -0,0 +1,217 @@
+// Package health tracks the service state reported by the /health endpoint.
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the overall service state.
+type State string
+
+// Service states. A service is starting until MarkReady is called, then ready
+// or degraded depending on whether any Reason is active, and stopping once
+// MarkStopping is called; stopping is final.
+const (
+	StateStarting State = "starting"
+	StateReady    State = "ready"
+	StateDegraded State = "degraded"
+	StateStopping State = "stopping"
+)
+
+// ReasonCode identifies a failure mode that degrades the service.
+type ReasonCode string
+
+// Reason codes reported by EncoderSim.
+const (
+	// ReasonSourceUnreachable means the source playlist can no longer be
+	// fetched. The loaded segments keep being served.
+	ReasonSourceUnreachable ReasonCode = "source_unreachable"
+
+	// ReasonQuorumLost means the Raft cluster has no leader, so the window
+	// cannot advance on any node.
+	ReasonQuorumLost ReasonCode = "quorum_lost"
+
+	// ReasonAdvanceStalled means the media sequence has not changed for more
+	// than twice the target duration.
+	ReasonAdvanceStalled ReasonCode = "advance_stalled"
+
+	// ReasonAdvanceLoopStuck means the local advance loop has not completed an
+	// advance within the advance watchdog's limit.
+	ReasonAdvanceLoopStuck ReasonCode = "advance_loop_stuck"
+
+	// ReasonMaintenance means a simulated maintenance window is in progress
+	// and the streams are answered with 503.
+	ReasonMaintenance ReasonCode = "maintenance"
+)
+
+// Reason is an active failure condition.
+type Reason struct {
+	Code    ReasonCode `json:"code"`
+	Message string     `json:"message"`
+	Since   time.Time  `json:"since"`
+}
+
+// Status is a snapshot of the service state.
+type Status struct {
+	State   State     `json:"state"`
+	Since   time.Time `json:"since"`
+	Reasons []Reason  `json:"reasons,omitempty"`
+}
+
+// Tracker holds the service state and its active reasons. It is safe for
+// concurrent use.
+type Tracker struct {
+	logger *slog.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	ready    bool
+	stopping bool
+	reasons  map[ReasonCode]Reason
+	state    State
+	since    time.Time
+}
+
+// NewTracker creates a Tracker in the starting state.
+func NewTracker(logger *slog.Logger) *Tracker {
+	return newTracker(logger, time.Now)
+}
+
+func newTracker(logger *slog.Logger, now func() time.Time) *Tracker {
+	return &Tracker{
+		logger:  logger,
+		now:     now,
+		reasons: make(map[ReasonCode]Reason),
+		state:   StateStarting,
+		since:   now(),
+	}
+}
+
+// MarkReady ends the starting state once the service is serving playlists.
+func (t *Tracker) MarkReady() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ready = true
+	t.update()
+}
+
+// MarkStopping moves the service to the stopping state for good.
+func (t *Tracker) MarkStopping() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopping = true
+	t.update()
+}
+
+// Set activates the reason code with the given message. A reason that is
+// already active keeps its original Since time.
+func (t *Tracker) Set(code ReasonCode, message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reason, ok := t.reasons[code]
+	if !ok {
+		reason = Reason{Code: code, Since: t.now()}
+		t.logger.Warn("health condition raised", "reason", code, "message", message)
+	}
+	reason.Message = message
+	t.reasons[code] = reason
+	t.update()
+}
+
+// Clear deactivates the reason code if it is active.
+func (t *Tracker) Clear(code ReasonCode) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.reasons[code]; !ok {
+		return
+	}
+	delete(t.reasons, code)
+	t.logger.Info("health condition cleared", "reason", code)
+	t.update()
+}
+
+// Status returns the current state and its active reasons, ordered by code.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := Status{State: t.state, Since: t.since}
+	for _, reason := range t.reasons {
+		status.Reasons = append(status.Reasons, reason)
+	}
+	sort.Slice(status.Reasons, func(i, j int) bool {
+		return status.Reasons[i].Code < status.Reasons[j].Code
+	})
+	return status
+}
+
+// update recomputes the state; t.mu must be held.
+func (t *Tracker) update() {
+	var next State
+	switch {
+	case t.stopping:
+		next = StateStopping
+	case !t.ready:
+		next = StateStarting
+	case len(t.reasons) > 0:
+		next = StateDegraded
+	default:
+		next = StateReady
+	}
+
+	if next == t.state {
+		return
+	}
+	t.logger.Info("health state changed", "from", t.state, "to", next)
+	t.state = next
+	t.since = t.now()
+}
+
+// Watch runs check every interval until ctx is cancelled, setting code with
+// the error message while check fails and clearing it once check succeeds.
+func (t *Tracker) Watch(ctx context.Context, code ReasonCode, interval time.Duration, check func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := check(); err != nil {
+			t.Set(code, err.Error())
+		} else {
+			t.Clear(code)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StallCheck returns a check for Watch that fails once sequence has not
+// changed for more than twice interval, the expected time between advances.
+func StallCheck(sequence func() uint64, interval time.Duration) func() error {
+	return stallCheck(sequence, interval, time.Now)
+}
+
+func stallCheck(sequence func() uint64, interval time.Duration, now func() time.Time) func() error {
+	last := sequence()
+	changed := now()
+	return func() error {
+		if current := sequence(); current != last {
+			last, changed = current, now()
+			return nil
+		}
+		if stalled := now().Sub(changed); stalled > 2*interval {
+			return fmt.Errorf("media sequence stuck at %d for %s (advance interval %s)", last, stalled.Round(time.Second), interval)
+		}
+		return nil
+	}
+}
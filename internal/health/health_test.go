@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced time source.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestTracker() (*Tracker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return newTracker(slog.New(slog.NewTextHandler(io.Discard, nil)), clock.now), clock
+}
+
+func TestTracker_Transitions(t *testing.T) {
+	tr, clock := newTestTracker()
+
+	steps := []struct {
+		name string
+		do   func()
+		want State
+	}{
+		{"initial", func() {}, StateStarting},
+		{"reason while starting", func() { tr.Set(ReasonSourceUnreachable, "timeout") }, StateStarting},
+		{"ready with reason", func() { tr.MarkReady() }, StateDegraded},
+		{"reason cleared", func() { tr.Clear(ReasonSourceUnreachable) }, StateReady},
+		{"clearing inactive reason", func() { tr.Clear(ReasonQuorumLost) }, StateReady},
+		{"quorum lost", func() { tr.Set(ReasonQuorumLost, "no leader") }, StateDegraded},
+		{"stopping", func() { tr.MarkStopping() }, StateStopping},
+		{"stopping is final", func() { tr.Clear(ReasonQuorumLost); tr.MarkReady() }, StateStopping},
+	}
+
+	for _, step := range steps {
+		clock.advance(time.Second)
+		step.do()
+		if got := tr.Status().State; got != step.want {
+			t.Errorf("%s: state = %s, want %s", step.name, got, step.want)
+		}
+	}
+}
+
+func TestTracker_Reasons(t *testing.T) {
+	tr, clock := newTestTracker()
+	tr.MarkReady()
+	readySince := tr.Status().Since
+
+	clock.advance(time.Minute)
+	tr.Set(ReasonQuorumLost, "no leader")
+	raised := clock.t
+	clock.advance(time.Minute)
+	tr.Set(ReasonAdvanceStalled, "stuck")
+	tr.Set(ReasonQuorumLost, "still no leader")
+
+	status := tr.Status()
+	if status.State != StateDegraded || !status.Since.Equal(raised) || status.Since.Equal(readySince) {
+		t.Errorf("status = %s since %v, want degraded since %v", status.State, status.Since, raised)
+	}
+	if len(status.Reasons) != 2 {
+		t.Fatalf("Expected 2 reasons, got %+v", status.Reasons)
+	}
+	// Ordered by code; a re-raised reason keeps its start time
+	if status.Reasons[0].Code != ReasonAdvanceStalled || status.Reasons[1].Code != ReasonQuorumLost {
+		t.Errorf("reasons out of order: %+v", status.Reasons)
+	}
+	if r := status.Reasons[1]; r.Message != "still no leader" || !r.Since.Equal(raised) {
+		t.Errorf("re-raised reason = %+v, want updated message and since %v", r, raised)
+	}
+}
+
+func TestTracker_Watch(t *testing.T) {
+	tr, _ := newTestTracker()
+	tr.MarkReady()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.Watch(ctx, ReasonSourceUnreachable, time.Millisecond, func() error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	waitFor(t, func() bool { return tr.Status().State == StateDegraded })
+	if msg := tr.Status().Reasons[0].Message; msg != "connection refused" {
+		t.Errorf("reason message = %q", msg)
+	}
+	failing.Store(false)
+	waitFor(t, func() bool { return tr.Status().State == StateReady })
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStallCheck(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var sequence uint64
+	check := stallCheck(func() uint64 { return sequence }, 6*time.Second, clock.now)
+
+	clock.advance(12 * time.Second)
+	if err := check(); err != nil {
+		t.Errorf("Expected no stall at exactly 2x the interval, got %v", err)
+	}
+
+	clock.advance(time.Second)
+	err := check()
+	if err == nil || !strings.Contains(err.Error(), "stuck at 0 for 13s") {
+		t.Errorf("Expected stall error, got %v", err)
+	}
+
+	sequence++
+	if err := check(); err != nil {
+		t.Errorf("Expected advance to clear the stall, got %v", err)
+	}
+	clock.advance(10 * time.Second)
+	if err := check(); err != nil {
+		t.Errorf("Expected no stall 10s after an advance, got %v", err)
+	}
+}
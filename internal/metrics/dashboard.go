@@ -0,0 +1,192 @@
+package metrics
+
+import "encoding/json"
+
+// DashboardUID is the Grafana UID of the generated dashboard, fixed so that
+// re-importing a newer dump replaces the previous one.
+const DashboardUID = "encodersim"
+
+// panel is the subset of a Grafana panel definition the dashboard uses.
+type panel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	Datasource  map[string]string `json:"datasource"`
+	GridPos     gridPos           `json:"gridPos"`
+	Targets     []target          `json:"targets"`
+	FieldConfig map[string]any    `json:"fieldConfig"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type target struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// datasource refers to the Prometheus data source chosen at import time.
+var datasource = map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+
+// sel is the label selector shared by every query, driven by the instance
+// dashboard variable.
+const sel = `{instance=~"$instance"}`
+
+// Dashboard returns a Grafana dashboard, in the JSON format accepted by
+// Grafana's "Import dashboard" page, that charts the metrics in All. The
+// Prometheus data source is chosen at import time.
+func Dashboard() ([]byte, error) {
+	panels := []panel{
+		newPanel("stat", "Instances", "Running EncoderSim instances by version and metrics schema.",
+			"short", gridPos{H: 4, W: 8, X: 0, Y: 0},
+			target{Expr: "count by (version, metrics_version) (" + BuildInfo.Name + sel + ")", LegendFormat: "v{{version}} (metrics v{{metrics_version}})"}),
+		newPanel("stat", "Uptime", "Time since each instance started.",
+			"s", gridPos{H: 4, W: 4, X: 8, Y: 0},
+			target{Expr: "time() - " + StartTime.Name + sel, LegendFormat: "{{instance}}"}),
+		newPanel("stat", "Cluster leader", "Raft leadership per instance (cluster mode only).",
+			"bool_yes_no", gridPos{H: 4, W: 4, X: 12, Y: 0},
+			target{Expr: ClusterLeader.Name + sel, LegendFormat: "{{instance}}"}),
+		newPanel("stat", "Target duration", "Largest EXT-X-TARGETDURATION; the window advances this often.",
+			"s", gridPos{H: 4, W: 4, X: 16, Y: 0},
+			target{Expr: "max(" + TargetDuration.Name + sel + ")"}),
+		newPanel("stat", "Window size", "Segments in each generated media playlist.",
+			"short", gridPos{H: 4, W: 4, X: 20, Y: 0},
+			target{Expr: "max(" + WindowSegments.Name + sel + ")"}),
+
+		newPanel("timeseries", "Request rate", "Requests per second by handler.",
+			"reqps", gridPos{H: 8, W: 12, X: 0, Y: 4},
+			target{Expr: "sum by (handler) (rate(" + HTTPRequests.Name + sel + "[$__rate_interval]))", LegendFormat: "{{handler}}"}),
+		newPanel("timeseries", "Error rate", "Requests per second answered with a 4xx or 5xx status, and documents that failed to generate by error code.",
+			"reqps", gridPos{H: 8, W: 12, X: 12, Y: 4},
+			target{Expr: `sum by (handler, code) (rate(` + HTTPRequests.Name + `{instance=~"$instance",code=~"[45].."}[$__rate_interval]))`, LegendFormat: "{{handler}} {{code}}"},
+			target{Expr: "sum by (error) (rate(" + GenerationErrors.Name + sel + "[$__rate_interval]))", LegendFormat: "generation {{error}}"}),
+		newPanel("timeseries", "Average request duration", "Mean time spent serving a request, by handler.",
+			"s", gridPos{H: 8, W: 12, X: 0, Y: 12},
+			target{
+				Expr: "sum by (handler) (rate(" + HTTPRequestDuration.Name + "_sum" + sel + "[$__rate_interval]))" +
+					" / sum by (handler) (rate(" + HTTPRequestDuration.Name + "_count" + sel + "[$__rate_interval]))",
+				LegendFormat: "{{handler}}",
+			}),
+		newPanel("timeseries", "Media sequence", "EXT-X-MEDIA-SEQUENCE per instance. A flat line means the window stopped advancing; instances of a cluster should overlap.",
+			"short", gridPos{H: 8, W: 12, X: 12, Y: 12},
+			target{Expr: MediaSequence.Name + sel, LegendFormat: "{{instance}}"}),
+		newPanel("timeseries", "Loop progress", "How far each variant's window is through its loop.",
+			"percentunit", gridPos{H: 8, W: 12, X: 0, Y: 20},
+			target{Expr: VariantPosition.Name + sel + " / " + VariantSegments.Name + sel, LegendFormat: "{{instance}} variant {{variant}}"}),
+		newPanel("timeseries", "Variant bandwidth", "BANDWIDTH advertised per variant.",
+			"bps", gridPos{H: 8, W: 12, X: 12, Y: 20},
+			target{Expr: "max by (variant) (" + VariantBandwidth.Name + sel + ")", LegendFormat: "variant {{variant}}"}),
+		newPanel("timeseries", "Time since last advance", "Should stay below the target duration; the watchdog flags the loop once it exceeds its limit.",
+			"s", gridPos{H: 8, W: 12, X: 0, Y: 28},
+			target{Expr: "time() - " + LastAdvanceTime.Name + sel, LegendFormat: "{{instance}}"}),
+		newPanel("timeseries", "Advance watchdog", "Stalled advance loops, stall detections and loop restarts.",
+			"short", gridPos{H: 8, W: 12, X: 12, Y: 28},
+			target{Expr: AdvanceStalled.Name + sel, LegendFormat: "{{instance}} stalled"},
+			target{Expr: "increase(" + AdvanceStalls.Name + sel + "[$__rate_interval])", LegendFormat: "{{instance}} stalls"},
+			target{Expr: "increase(" + AdvanceRestarts.Name + sel + "[$__rate_interval])", LegendFormat: "{{instance}} restarts"}),
+		newPanel("timeseries", "Cluster advance applies", "Failed Raft applies of window advances, advances owed for catch-up, and advances caught up or dropped (cluster mode only).",
+			"short", gridPos{H: 8, W: 24, X: 0, Y: 36},
+			target{Expr: "increase(" + AdvanceApplyErrors.Name + sel + "[$__rate_interval])", LegendFormat: "{{instance}} apply errors"},
+			target{Expr: AdvanceOwed.Name + sel, LegendFormat: "{{instance}} owed"},
+			target{Expr: "increase(" + AdvanceCaughtUp.Name + sel + "[$__rate_interval])", LegendFormat: "{{instance}} caught up"},
+			target{Expr: "increase(" + AdvanceDropped.Name + sel + "[$__rate_interval])", LegendFormat: "{{instance}} dropped"}),
+		newPanel("timeseries", "Player probe anomalies", "Anomalies seen by the built-in player probe, by kind, and its playlist fetch rate (--player-probe only).",
+			"short", gridPos{H: 8, W: 24, X: 0, Y: 44},
+			target{Expr: "sum by (kind) (increase(" + PlayerAnomalies.Name + sel + "[$__rate_interval]))", LegendFormat: "{{kind}}"},
+			target{Expr: "sum(rate(" + PlayerPlaylistFetches.Name + sel + "[$__rate_interval]))", LegendFormat: "fetches/s"}),
+		newPanel("timeseries", "Tenant requests", "Requests per second by API key tenant and status code; 429s mean the tenant hit its rate limit (--api-keys only).",
+			"reqps", gridPos{H: 8, W: 24, X: 0, Y: 52},
+			target{Expr: "sum by (tenant, code) (rate(" + TenantRequests.Name + sel + "[$__rate_interval]))", LegendFormat: "{{tenant}} {{code}}"}),
+		newPanel("timeseries", "Connections", "Open connections by state and client IPs holding them, connections accepted and closed per second, connection errors per second by kind, and requests refused per second by --max-conns, --rate-limit and --client-rate-limit. Accepts dropping to zero with no errors means players stopped connecting; errors or piling connections mean the server stopped accepting them.",
+			"short", gridPos{H: 8, W: 24, X: 0, Y: 60},
+			target{Expr: "sum by (state) (" + ConnectionsOpen.Name + sel + ")", LegendFormat: "open {{state}}"},
+			target{Expr: "sum(rate(" + ConnectionsAccepted.Name + sel + "[$__rate_interval]))", LegendFormat: "accepted/s"},
+			target{Expr: "sum(rate(" + ConnectionsClosed.Name + sel + "[$__rate_interval]))", LegendFormat: "closed/s"},
+			target{Expr: "sum(" + ConnectionClients.Name + sel + ")", LegendFormat: "client IPs"},
+			target{Expr: "sum by (kind) (rate(" + ConnectionErrors.Name + sel + "[$__rate_interval]))", LegendFormat: "{{kind}} errors/s"},
+			target{Expr: "sum by (reason) (rate(" + HTTPThrottled.Name + sel + "[$__rate_interval]))", LegendFormat: "{{reason}} throttled/s"}),
+		newPanel("timeseries", "CDN fill latency", "Mean time to fetch each new live edge segment through the CDN edge, and failed fetches per second, by media playlist (--prime-cdn only). Rising latency or errors mean the CDN is slow to fill from the origin.",
+			"s", gridPos{H: 8, W: 24, X: 0, Y: 68},
+			target{
+				Expr: "sum by (playlist) (rate(" + CDNPrimeDuration.Name + "_sum" + sel + "[$__rate_interval]))" +
+					" / sum by (playlist) (rate(" + CDNPrimeDuration.Name + "_count" + sel + "[$__rate_interval]))",
+				LegendFormat: "{{playlist}}",
+			},
+			target{Expr: "sum by (playlist) (rate(" + CDNPrimeErrors.Name + sel + "[$__rate_interval]))", LegendFormat: "{{playlist}} errors/s"}),
+		newPanel("timeseries", "Memory budget", "Memory in use against the soft memory limit, and the headroom left (resource budget flags only). Headroom near zero means the garbage collector is working hard to stay under the limit.",
+			"bytes", gridPos{H: 8, W: 12, X: 0, Y: 76},
+			target{Expr: MemoryUsed.Name + sel, LegendFormat: "{{instance}} used"},
+			target{Expr: MemoryLimit.Name + sel, LegendFormat: "{{instance}} limit"},
+			target{Expr: MemoryHeadroom.Name + sel, LegendFormat: "{{instance}} headroom"}),
+		newPanel("timeseries", "Cache budget", "Bytes held by in-memory caches against --max-cache-bytes, the headroom left, and reservations refused per second by resource (resource budget flags only).",
+			"bytes", gridPos{H: 8, W: 12, X: 12, Y: 76},
+			target{Expr: CacheBytes.Name + sel, LegendFormat: "{{instance}} cached"},
+			target{Expr: CacheLimit.Name + sel, LegendFormat: "{{instance}} limit"},
+			target{Expr: CacheHeadroom.Name + sel, LegendFormat: "{{instance}} headroom"},
+			target{Expr: "sum by (resource) (rate(" + BudgetRefused.Name + sel + "[$__rate_interval]))", LegendFormat: "{{resource}} refused/s"}),
+	}
+
+	for i := range panels {
+		panels[i].ID = i + 1
+	}
+
+	dashboard := map[string]any{
+		"__inputs": []map[string]string{{
+			"name":     "DS_PROMETHEUS",
+			"label":    "Prometheus",
+			"type":     "datasource",
+			"pluginId": "prometheus",
+		}},
+		"uid":           DashboardUID,
+		"title":         "EncoderSim",
+		"description":   "EncoderSim HLS simulator (metrics schema v" + SchemaVersion + ")",
+		"tags":          []string{"encodersim", "hls"},
+		"schemaVersion": 39,
+		"editable":      true,
+		"refresh":       "10s",
+		"time":          map[string]string{"from": "now-1h", "to": "now"},
+		"templating": map[string]any{
+			"list": []map[string]any{{
+				"name":       "instance",
+				"label":      "Instance",
+				"type":       "query",
+				"datasource": datasource,
+				"query":      "label_values(" + BuildInfo.Name + ", instance)",
+				"refresh":    2,
+				"multi":      true,
+				"includeAll": true,
+				"allValue":   ".*",
+				"current":    map[string]any{"text": "All", "value": "$__all"},
+			}},
+		},
+		"panels": panels,
+	}
+
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+// newPanel builds a panel with the given queries against the import-time
+// data source.
+func newPanel(typ, title, description, unit string, pos gridPos, targets ...target) panel {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	return panel{
+		Type:        typ,
+		Title:       title,
+		Description: description,
+		Datasource:  datasource,
+		GridPos:     pos,
+		Targets:     targets,
+		FieldConfig: map[string]any{
+			"defaults":  map[string]any{"unit": unit},
+			"overrides": []any{},
+		},
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	data, err := Dashboard()
+	if err != nil {
+		t.Fatalf("Dashboard() error = %v", err)
+	}
+
+	var dashboard struct {
+		UID    string `json:"uid"`
+		Inputs []struct {
+			Name string `json:"name"`
+		} `json:"__inputs"`
+		Panels []struct {
+			ID      int    `json:"id"`
+			Title   string `json:"title"`
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		t.Fatalf("Dashboard() is not valid JSON: %v", err)
+	}
+
+	if dashboard.UID != DashboardUID {
+		t.Errorf("uid = %q, want %q", dashboard.UID, DashboardUID)
+	}
+	if len(dashboard.Inputs) != 1 || dashboard.Inputs[0].Name != "DS_PROMETHEUS" {
+		t.Errorf("Expected a DS_PROMETHEUS import input, got %+v", dashboard.Inputs)
+	}
+	if len(dashboard.Panels) == 0 {
+		t.Fatal("Expected panels")
+	}
+
+	// Every query must use only exported metric names
+	known := make(map[string]bool)
+	for _, desc := range All {
+		known[desc.Name] = true
+		if desc.Type == Summary {
+			known[desc.Name+"_sum"] = true
+			known[desc.Name+"_count"] = true
+		}
+	}
+	used := make(map[string]bool)
+	ids := make(map[int]bool)
+	name := regexp.MustCompile(`encodersim_[a-z_]+`)
+	for _, p := range dashboard.Panels {
+		if ids[p.ID] {
+			t.Errorf("duplicate panel id %d", p.ID)
+		}
+		ids[p.ID] = true
+		for _, target := range p.Targets {
+			if !strings.Contains(target.Expr, `instance=~"$instance"`) {
+				t.Errorf("panel %q ignores the instance variable: %s", p.Title, target.Expr)
+			}
+			for _, m := range name.FindAllString(target.Expr, -1) {
+				if !known[m] {
+					t.Errorf("panel %q uses unknown metric %s", p.Title, m)
+				}
+				used[strings.TrimSuffix(strings.TrimSuffix(m, "_sum"), "_count")] = true
+			}
+		}
+	}
+	for _, desc := range All {
+		if !used[desc.Name] {
+			t.Errorf("metric %s is not charted", desc.Name)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+// Package metrics defines the Prometheus metrics exported by EncoderSim and
+// renders them in the Prometheus text exposition format.
+//
+// Metric names are a stable interface that dashboards and alerts are built
+// on. Every name starts with "encodersim_", uses base units (seconds, bits
+// per second) spelled out as a suffix, and counters end in "_total". Within a
+// SchemaVersion a metric is never renamed, relabeled or given a different
+// meaning; breaking changes bump SchemaVersion, which every instance reports
+// as the metrics_version label of encodersim_build_info.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaVersion identifies the current set of metric names and labels.
+// Adding a metric does not change it.
+const SchemaVersion = "1"
+
+// Type is a Prometheus metric type.
+type Type string
+
+// Metric types used by EncoderSim.
+const (
+	Counter Type = "counter"
+	Gauge   Type = "gauge"
+	Summary Type = "summary" // exported as _sum and _count only
+)
+
+// Desc describes one metric.
+type Desc struct {
+	Name   string
+	Type   Type
+	Help   string
+	Labels []string
+}
+
+// The metrics exported by EncoderSim.
+var (
+	BuildInfo = Desc{
+		Name:   "encodersim_build_info",
+		Type:   Gauge,
+		Help:   "Always 1; the labels identify the running version and metrics schema.",
+		Labels: []string{"version", "metrics_version"},
+	}
+	StartTime = Desc{
+		Name: "encodersim_start_time_seconds",
+		Type: Gauge,
+		Help: "Unix time at which the process started.",
+	}
+	HTTPRequests = Desc{
+		Name:   "encodersim_http_requests_total",
+		Type:   Counter,
+		Help:   "HTTP requests served, by handler and status code.",
+		Labels: []string{"handler", "code"},
+	}
+	HTTPRequestDuration = Desc{
+		Name:   "encodersim_http_request_duration_seconds",
+		Type:   Summary,
+		Help:   "Time spent serving HTTP requests, by handler.",
+		Labels: []string{"handler"},
+	}
+	TenantRequests = Desc{
+		Name:   "encodersim_tenant_requests_total",
+		Type:   Counter,
+		Help:   "HTTP requests by API key tenant, handler and status code (--api-keys only).",
+		Labels: []string{"tenant", "handler", "code"},
+	}
+	HTTPThrottled = Desc{
+		Name:   "encodersim_http_throttled_total",
+		Type:   Counter,
+		Help:   "HTTP requests refused with 429 by the server's limits, by reason (rate, client_rate or connections).",
+		Labels: []string{"reason"},
+	}
+	GenerationErrors = Desc{
+		Name:   "encodersim_generation_errors_total",
+		Type:   Counter,
+		Help:   "Documents that failed to generate, by error code of the response.",
+		Labels: []string{"error"},
+	}
+	ConnectionsOpen = Desc{
+		Name:   "encodersim_connections_open",
+		Type:   Gauge,
+		Help:   "Open client connections, by state (new, active or idle).",
+		Labels: []string{"state"},
+	}
+	ConnectionsAccepted = Desc{
+		Name: "encodersim_connections_accepted_total",
+		Type: Counter,
+		Help: "Client connections accepted.",
+	}
+	ConnectionsClosed = Desc{
+		Name: "encodersim_connections_closed_total",
+		Type: Counter,
+		Help: "Client connections closed or hijacked.",
+	}
+	ConnectionClients = Desc{
+		Name: "encodersim_connection_clients",
+		Type: Gauge,
+		Help: "Distinct client IPs with open connections.",
+	}
+	ConnectionErrors = Desc{
+		Name:   "encodersim_connection_errors_total",
+		Type:   Counter,
+		Help:   "Errors logged by the HTTP server, by kind (accept, tls_handshake or other).",
+		Labels: []string{"kind"},
+	}
+	MediaSequence = Desc{
+		Name: "encodersim_media_sequence",
+		Type: Gauge,
+		Help: "Current EXT-X-MEDIA-SEQUENCE of the generated playlists.",
+	}
+	WindowSegments = Desc{
+		Name: "encodersim_window_segments",
+		Type: Gauge,
+		Help: "Configured number of segments in the sliding window.",
+	}
+	TargetDuration = Desc{
+		Name: "encodersim_target_duration_seconds",
+		Type: Gauge,
+		Help: "Largest EXT-X-TARGETDURATION across variants; the window advances this often.",
+	}
+	VariantSegments = Desc{
+		Name:   "encodersim_variant_segments",
+		Type:   Gauge,
+		Help:   "Number of segments in each variant's loop.",
+		Labels: []string{"variant"},
+	}
+	VariantPosition = Desc{
+		Name:   "encodersim_variant_position",
+		Type:   Gauge,
+		Help:   "Index of the first segment of each variant's current window within its loop.",
+		Labels: []string{"variant"},
+	}
+	VariantBandwidth = Desc{
+		Name:   "encodersim_variant_bandwidth_bits_per_second",
+		Type:   Gauge,
+		Help:   "BANDWIDTH advertised for each variant in the master playlist.",
+		Labels: []string{"variant"},
+	}
+	ClusterLeader = Desc{
+		Name: "encodersim_cluster_leader",
+		Type: Gauge,
+		Help: "1 if this node is the Raft leader, 0 otherwise; absent outside cluster mode.",
+	}
+	LastAdvanceTime = Desc{
+		Name: "encodersim_last_advance_time_seconds",
+		Type: Gauge,
+		Help: "Unix time at which the advance loop last completed an advance.",
+	}
+	AdvanceStalled = Desc{
+		Name: "encodersim_advance_stalled",
+		Type: Gauge,
+		Help: "1 while the advance watchdog considers the advance loop stalled, 0 otherwise.",
+	}
+	AdvanceStalls = Desc{
+		Name: "encodersim_advance_stalls_total",
+		Type: Counter,
+		Help: "Times the advance watchdog detected a stalled advance loop.",
+	}
+	AdvanceRestarts = Desc{
+		Name: "encodersim_advance_restarts_total",
+		Type: Counter,
+		Help: "Times the advance watchdog restarted the advance loop.",
+	}
+	AdvanceApplyErrors = Desc{
+		Name: "encodersim_advance_apply_errors_total",
+		Type: Counter,
+		Help: "Failed Raft applies of a window advance, including retried ones (cluster mode only).",
+	}
+	AdvanceOwed = Desc{
+		Name: "encodersim_advance_owed",
+		Type: Gauge,
+		Help: "Window advances that failed to apply and will be caught up on the next advance (cluster mode only).",
+	}
+	AdvanceDropped = Desc{
+		Name: "encodersim_advance_dropped_total",
+		Type: Counter,
+		Help: "Window advances given up after losing Raft leadership (cluster mode only).",
+	}
+	AdvanceCaughtUp = Desc{
+		Name: "encodersim_advance_caught_up_total",
+		Type: Counter,
+		Help: "Window advances applied late as part of a catch-up (cluster mode only).",
+	}
+	PlayerPlaylistFetches = Desc{
+		Name: "encodersim_player_playlist_fetches_total",
+		Type: Counter,
+		Help: "Media playlist fetches by the built-in player probe (--player-probe only).",
+	}
+	PlayerAnomalies = Desc{
+		Name:   "encodersim_player_anomalies_total",
+		Type:   Counter,
+		Help:   "Anomalies seen by the built-in player probe, by kind (--player-probe only).",
+		Labels: []string{"kind"},
+	}
+	CDNPrimeDuration = Desc{
+		Name:   "encodersim_cdn_prime_duration_seconds",
+		Type:   Summary,
+		Help:   "Time to fetch each segment that reached the live edge through the CDN edge, by media playlist (--prime-cdn only).",
+		Labels: []string{"playlist"},
+	}
+	CDNPrimeErrors = Desc{
+		Name:   "encodersim_cdn_prime_errors_total",
+		Type:   Counter,
+		Help:   "Segment fetches through the CDN edge that failed, by media playlist (--prime-cdn only).",
+		Labels: []string{"playlist"},
+	}
+	MemoryUsed = Desc{
+		Name: "encodersim_memory_used_bytes",
+		Type: Gauge,
+		Help: "Memory the Go runtime counts against its soft memory limit (resource budget flags only).",
+	}
+	MemoryLimit = Desc{
+		Name: "encodersim_memory_limit_bytes",
+		Type: Gauge,
+		Help: "Soft memory limit of the Go runtime, from --memory-limit or GOMEMLIMIT (resource budget flags only).",
+	}
+	MemoryHeadroom = Desc{
+		Name: "encodersim_memory_headroom_bytes",
+		Type: Gauge,
+		Help: "Memory left below the soft memory limit; the garbage collector works harder as it nears zero (resource budget flags only).",
+	}
+	CacheBytes = Desc{
+		Name: "encodersim_cache_bytes",
+		Type: Gauge,
+		Help: "Bytes held by in-memory caches: pre-rendered windows and the memory: storage backend (resource budget flags only).",
+	}
+	CacheLimit = Desc{
+		Name: "encodersim_cache_limit_bytes",
+		Type: Gauge,
+		Help: "Bound on the bytes held by in-memory caches (--max-cache-bytes only).",
+	}
+	CacheHeadroom = Desc{
+		Name: "encodersim_cache_headroom_bytes",
+		Type: Gauge,
+		Help: "Bytes left below the cache bound (--max-cache-bytes only).",
+	}
+	BudgetRefused = Desc{
+		Name:   "encodersim_budget_refused_total",
+		Type:   Counter,
+		Help:   "Reservations refused for exceeding a resource limit, by resource (resource budget flags only).",
+		Labels: []string{"resource"},
+	}
+)
+
+// All lists every exported metric in exposition order.
+var All = []Desc{
+	BuildInfo,
+	StartTime,
+	HTTPRequests,
+	HTTPRequestDuration,
+	TenantRequests,
+	HTTPThrottled,
+	GenerationErrors,
+	ConnectionsOpen,
+	ConnectionsAccepted,
+	ConnectionsClosed,
+	ConnectionClients,
+	ConnectionErrors,
+	MediaSequence,
+	WindowSegments,
+	TargetDuration,
+	VariantSegments,
+	VariantPosition,
+	VariantBandwidth,
+	ClusterLeader,
+	LastAdvanceTime,
+	AdvanceStalled,
+	AdvanceStalls,
+	AdvanceRestarts,
+	AdvanceApplyErrors,
+	AdvanceOwed,
+	AdvanceDropped,
+	AdvanceCaughtUp,
+	PlayerPlaylistFetches,
+	PlayerAnomalies,
+	CDNPrimeDuration,
+	CDNPrimeErrors,
+	MemoryUsed,
+	MemoryLimit,
+	MemoryHeadroom,
+	CacheBytes,
+	CacheLimit,
+	CacheHeadroom,
+	BudgetRefused,
+}
+
+// Sample is one value of a metric. LabelValues match the Desc's Labels in
+// order. Summaries are sampled as two values, with Suffix "_sum" and
+// "_count".
+type Sample struct {
+	Desc        Desc
+	Suffix      string
+	LabelValues []string
+	Value       float64
+}
+
+// requestKey identifies an HTTP request counter.
+type requestKey struct {
+	handler string
+	code    int
+}
+
+// tenantKey identifies a tenant request counter.
+type tenantKey struct {
+	tenant string
+	requestKey
+}
+
+// durationSum accumulates a summary without quantiles.
+type durationSum struct {
+	sum   float64
+	count uint64
+}
+
+// Registry tracks the process-wide metrics and writes them together with
+// samples collected at scrape time. It is safe for concurrent use.
+type Registry struct {
+	version string
+	start   time.Time
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*durationSum
+	tenants   map[tenantKey]uint64
+	errors    map[string]uint64
+}
+
+// NewRegistry creates a Registry reporting the given application version.
+func NewRegistry(version string) *Registry {
+	return &Registry{
+		version:   version,
+		start:     time.Now(),
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[string]*durationSum),
+		tenants:   make(map[tenantKey]uint64),
+		errors:    make(map[string]uint64),
+	}
+}
+
+// ObserveRequest records a served HTTP request. handler must come from a
+// small fixed set of names to keep the number of series bounded.
+func (r *Registry) ObserveRequest(handler string, code int, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests[requestKey{handler: handler, code: code}]++
+	ds := r.durations[handler]
+	if ds == nil {
+		ds = &durationSum{}
+		r.durations[handler] = ds
+	}
+	ds.sum += d.Seconds()
+	ds.count++
+}
+
+// ObserveTenantRequest records a request served to an API key tenant.
+// tenant must come from the configured tenants, handler as for
+// ObserveRequest.
+func (r *Registry) ObserveTenantRequest(tenant, handler string, code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tenants[tenantKey{tenant: tenant, requestKey: requestKey{handler: handler, code: code}}]++
+}
+
+// ObserveGenerationError records a document that failed to generate. code
+// must come from the small fixed set of error codes of the server.
+func (r *Registry) ObserveGenerationError(code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors[code]++
+}
+
+// Write renders the registry's metrics and the given samples in the
+// Prometheus text exposition format (version 0.0.4), grouped by metric in
+// the order of All.
+func (r *Registry) Write(w io.Writer, samples []Sample) error {
+	lines := make(map[string][]string)
+	add := func(desc Desc, suffix string, labelValues []string, value string) {
+		lines[desc.Name] = append(lines[desc.Name],
+			desc.Name+suffix+formatLabels(desc.Labels, labelValues)+" "+value)
+	}
+
+	add(BuildInfo, "", []string{r.version, SchemaVersion}, "1")
+	add(StartTime, "", nil, formatValue(float64(r.start.UnixNano())/1e9))
+
+	r.mu.Lock()
+	keys := make([]requestKey, 0, len(r.requests))
+	for k := range r.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, k := range keys {
+		add(HTTPRequests, "", []string{k.handler, strconv.Itoa(k.code)}, strconv.FormatUint(r.requests[k], 10))
+	}
+
+	handlers := make([]string, 0, len(r.durations))
+	for h := range r.durations {
+		handlers = append(handlers, h)
+	}
+	sort.Strings(handlers)
+	for _, h := range handlers {
+		ds := r.durations[h]
+		add(HTTPRequestDuration, "_sum", []string{h}, formatValue(ds.sum))
+		add(HTTPRequestDuration, "_count", []string{h}, strconv.FormatUint(ds.count, 10))
+	}
+
+	tenantKeys := make([]tenantKey, 0, len(r.tenants))
+	for k := range r.tenants {
+		tenantKeys = append(tenantKeys, k)
+	}
+	sort.Slice(tenantKeys, func(i, j int) bool {
+		a, b := tenantKeys[i], tenantKeys[j]
+		if a.tenant != b.tenant {
+			return a.tenant < b.tenant
+		}
+		if a.handler != b.handler {
+			return a.handler < b.handler
+		}
+		return a.code < b.code
+	})
+	for _, k := range tenantKeys {
+		add(TenantRequests, "", []string{k.tenant, k.handler, strconv.Itoa(k.code)}, strconv.FormatUint(r.tenants[k], 10))
+	}
+
+	codes := make([]string, 0, len(r.errors))
+	for code := range r.errors {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		add(GenerationErrors, "", []string{code}, strconv.FormatUint(r.errors[code], 10))
+	}
+	r.mu.Unlock()
+
+	for _, s := range samples {
+		add(s.Desc, s.Suffix, s.LabelValues, formatValue(s.Value))
+	}
+
+	var b strings.Builder
+	for _, desc := range All {
+		if len(lines[desc.Name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n", desc.Name, desc.Help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", desc.Name, desc.Type)
+		for _, line := range lines[desc.Name] {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatLabels renders a label set such as {handler="health",code="200"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		var value string
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as the exposition format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatValue renders a sample value in its shortest exact form.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMetricNamesStable guards the metric schema: renaming or relabeling a
+// metric breaks dashboards and alerts, so it requires bumping SchemaVersion
+// and updating this list together. New metrics are only added to the list.
+func TestMetricNamesStable(t *testing.T) {
+	want := map[string][]string{
+		"encodersim_build_info":                        {"version", "metrics_version"},
+		"encodersim_start_time_seconds":                nil,
+		"encodersim_http_requests_total":               {"handler", "code"},
+		"encodersim_http_request_duration_seconds":     {"handler"},
+		"encodersim_tenant_requests_total":             {"tenant", "handler", "code"},
+		"encodersim_generation_errors_total":           {"error"},
+		"encodersim_http_throttled_total":              {"reason"},
+		"encodersim_connections_open":                  {"state"},
+		"encodersim_connections_accepted_total":        nil,
+		"encodersim_connections_closed_total":          nil,
+		"encodersim_connection_clients":                nil,
+		"encodersim_connection_errors_total":           {"kind"},
+		"encodersim_media_sequence":                    nil,
+		"encodersim_window_segments":                   nil,
+		"encodersim_target_duration_seconds":           nil,
+		"encodersim_variant_segments":                  {"variant"},
+		"encodersim_variant_position":                  {"variant"},
+		"encodersim_variant_bandwidth_bits_per_second": {"variant"},
+		"encodersim_cluster_leader":                    nil,
+		"encodersim_last_advance_time_seconds":         nil,
+		"encodersim_advance_stalled":                   nil,
+		"encodersim_advance_stalls_total":              nil,
+		"encodersim_advance_restarts_total":            nil,
+		"encodersim_advance_apply_errors_total":        nil,
+		"encodersim_advance_owed":                      nil,
+		"encodersim_advance_dropped_total":             nil,
+		"encodersim_advance_caught_up_total":           nil,
+		"encodersim_player_playlist_fetches_total":     nil,
+		"encodersim_player_anomalies_total":            {"kind"},
+		"encodersim_cdn_prime_duration_seconds":        {"playlist"},
+		"encodersim_cdn_prime_errors_total":            {"playlist"},
+		"encodersim_memory_used_bytes":                 nil,
+		"encodersim_memory_limit_bytes":                nil,
+		"encodersim_memory_headroom_bytes":             nil,
+		"encodersim_cache_bytes":                       nil,
+		"encodersim_cache_limit_bytes":                 nil,
+		"encodersim_cache_headroom_bytes":              nil,
+		"encodersim_budget_refused_total":              {"resource"},
+	}
+
+	if SchemaVersion != "1" {
+		t.Fatalf("SchemaVersion = %q; update this test with the new schema", SchemaVersion)
+	}
+	if len(All) != len(want) {
+		t.Errorf("len(All) = %d, want %d", len(All), len(want))
+	}
+	for _, desc := range All {
+		labels, ok := want[desc.Name]
+		if !ok {
+			t.Errorf("unexpected metric %s", desc.Name)
+			continue
+		}
+		if !slices.Equal(desc.Labels, labels) {
+			t.Errorf("%s labels = %v, want %v", desc.Name, desc.Labels, labels)
+		}
+		if !strings.HasPrefix(desc.Name, "encodersim_") {
+			t.Errorf("%s lacks the encodersim_ prefix", desc.Name)
+		}
+		if (desc.Type == Counter) != strings.HasSuffix(desc.Name, "_total") {
+			t.Errorf("%s: only counters may end in _total", desc.Name)
+		}
+	}
+}
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry("1.2.3")
+	r.ObserveRequest("playlist", 200, 20*time.Millisecond)
+	r.ObserveRequest("playlist", 200, 30*time.Millisecond)
+	r.ObserveRequest("variant", 404, time.Millisecond)
+	r.ObserveTenantRequest("team-b", "playlist", 200)
+	r.ObserveTenantRequest("team-a", "playlist", 429)
+	r.ObserveTenantRequest("team-a", "playlist", 429)
+	r.ObserveGenerationError("variant_out_of_range")
+	r.ObserveGenerationError("not_ready")
+	r.ObserveGenerationError("variant_out_of_range")
+
+	var b strings.Builder
+	err := r.Write(&b, []Sample{
+		{Desc: MediaSequence, Value: 42},
+		{Desc: VariantBandwidth, LabelValues: []string{"0"}, Value: 1.5e6},
+		{Desc: VariantBandwidth, LabelValues: []string{`we"ird`}, Value: 0},
+		{Desc: CDNPrimeDuration, Suffix: "_sum", LabelValues: []string{"variant/0"}, Value: 0.25},
+		{Desc: CDNPrimeDuration, Suffix: "_count", LabelValues: []string{"variant/0"}, Value: 2},
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	out := b.String()
+
+	wantLines := []string{
+		"# TYPE encodersim_build_info gauge",
+		`encodersim_build_info{version="1.2.3",metrics_version="1"} 1`,
+		"# TYPE encodersim_http_requests_total counter",
+		`encodersim_http_requests_total{handler="playlist",code="200"} 2`,
+		`encodersim_http_requests_total{handler="variant",code="404"} 1`,
+		"# TYPE encodersim_http_request_duration_seconds summary",
+		`encodersim_http_request_duration_seconds_sum{handler="playlist"} 0.05`,
+		`encodersim_http_request_duration_seconds_count{handler="playlist"} 2`,
+		`encodersim_tenant_requests_total{tenant="team-a",handler="playlist",code="429"} 2`,
+		`encodersim_tenant_requests_total{tenant="team-b",handler="playlist",code="200"} 1`,
+		`encodersim_generation_errors_total{error="not_ready"} 1`,
+		`encodersim_generation_errors_total{error="variant_out_of_range"} 2`,
+		"# HELP encodersim_media_sequence Current EXT-X-MEDIA-SEQUENCE of the generated playlists.",
+		"encodersim_media_sequence 42",
+		`encodersim_variant_bandwidth_bits_per_second{variant="0"} 1.5e+06`,
+		`encodersim_variant_bandwidth_bits_per_second{variant="we\"ird"} 0`,
+		"# TYPE encodersim_cdn_prime_duration_seconds summary",
+		`encodersim_cdn_prime_duration_seconds_sum{playlist="variant/0"} 0.25`,
+		`encodersim_cdn_prime_duration_seconds_count{playlist="variant/0"} 2`,
+	}
+	rest := out
+	for _, want := range wantLines {
+		idx := strings.Index(rest, want+"\n")
+		if idx < 0 {
+			t.Fatalf("Expected line %q in order, got:\n%s", want, out)
+		}
+		rest = rest[idx+len(want):]
+	}
+
+	// Metrics without samples are omitted entirely
+	if strings.Contains(out, "encodersim_cluster_leader") {
+		t.Errorf("Expected no cluster metric without a sample, got:\n%s", out)
+	}
+	if n := strings.Count(out, "# TYPE encodersim_variant_bandwidth_bits_per_second"); n != 1 {
+		t.Errorf("Expected one TYPE line per metric, got %d", n)
+	}
+}
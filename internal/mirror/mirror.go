@@ -0,0 +1,121 @@
+// Package mirror saves every response encodersim serves to a Storage, so that
+// a failing test run leaves a complete artifact of what players received.
+//
+// Responses are stored under keys per request path, such as
+//
+//	variant/0/playlist.m3u8/000042-20261015T120000.123Z.body
+//	variant/0/playlist.m3u8/000042-20261015T120000.123Z.json
+//
+// where the number orders responses across paths. requests.jsonl indexes
+// them, one Entry per line in the order they completed.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// IndexFile is the key of the index in the mirror's Storage.
+const IndexFile = "requests.jsonl"
+
+// Entry describes one mirrored response.
+type Entry struct {
+	Seq       uint64        `json:"seq"`
+	Time      time.Time     `json:"time"` // when the request arrived
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Query     string        `json:"query,omitempty"`
+	Remote    string        `json:"remote,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+	Status    int           `json:"status"`
+	Header    http.Header   `json:"header"`
+	Bytes     int           `json:"bytes"`
+	Duration  time.Duration `json:"duration_ns"`
+
+	// File is the key of the body in the mirror's Storage, without the
+	// .body or .json extension.
+	File string `json:"file"`
+}
+
+// Mirror writes responses to a Storage. It is safe for concurrent use.
+type Mirror struct {
+	store storage.Storage
+
+	mu    sync.Mutex
+	seq   uint64
+	index []byte // the whole index, for a store that cannot append
+}
+
+// New returns a Mirror that writes to store. Mirroring into a store used
+// before adds to its index, numbering on from 1.
+func New(ctx context.Context, store storage.Storage) (*Mirror, error) {
+	m := &Mirror{store: store}
+	if _, ok := store.(storage.Appender); ok {
+		return m, nil
+	}
+	index, err := store.Get(ctx, IndexFile)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("read mirror index: %w", err)
+	}
+	m.index = index
+	return m, nil
+}
+
+// Save writes body and e's metadata, filling in e.Seq and e.File, and
+// adds e to the index.
+func (m *Mirror) Save(ctx context.Context, e Entry, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seq++
+	e.Seq = m.seq
+	e.Bytes = len(body)
+	e.File = path.Join(pathDir(e.Path), fmt.Sprintf("%06d-%s", e.Seq, e.Time.UTC().Format("20060102T150405.000Z")))
+
+	if err := m.store.Put(ctx, e.File+".body", body); err != nil {
+		return fmt.Errorf("mirror %s: %w", e.Path, err)
+	}
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("mirror %s: %w", e.Path, err)
+	}
+	if err := m.store.Put(ctx, e.File+".json", meta); err != nil {
+		return fmt.Errorf("mirror %s: %w", e.Path, err)
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("mirror %s: %w", e.Path, err)
+	}
+	line = append(line, '\n')
+	if appender, ok := m.store.(storage.Appender); ok {
+		err = appender.Append(ctx, IndexFile, line)
+	} else {
+		index := append(m.index[:len(m.index):len(m.index)], line...)
+		if err = m.store.Put(ctx, IndexFile, index); err == nil {
+			m.index = index
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("mirror %s: write index: %w", e.Path, err)
+	}
+	return nil
+}
+
+// pathDir maps a request path to the slash-separated key prefix its
+// responses are stored under, keeping it a valid relative key.
+func pathDir(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return "_root"
+	}
+	return p
+}
@@ -0,0 +1,114 @@
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+func TestMirror_Save(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(context.Background(), storage.NewDisk(dir))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	at := time.Date(2026, 10, 15, 12, 0, 0, 123e6, time.UTC)
+	entries := []struct {
+		path     string
+		body     string
+		wantFile string
+	}{
+		{"/variant/0/playlist.m3u8", "#EXTM3U\n", "variant/0/playlist.m3u8/000001-20261015T120000.123Z"},
+		{"/playlist.m3u8", "#EXTM3U\n#EXT-X-STREAM-INF\n", "playlist.m3u8/000002-20261015T120000.123Z"},
+		{"/", "", "_root/000003-20261015T120000.123Z"},
+		{"/../../etc/passwd", "x", "etc/passwd/000004-20261015T120000.123Z"},
+	}
+	for _, e := range entries {
+		err := m.Save(context.Background(), Entry{Time: at, Method: "GET", Path: e.path, Status: http.StatusOK, Header: http.Header{"Content-Type": {"text/plain"}}}, []byte(e.body))
+		if err != nil {
+			t.Fatalf("Save(%s) error = %v", e.path, err)
+		}
+	}
+	for _, e := range entries {
+		name := filepath.Join(dir, filepath.FromSlash(e.wantFile))
+		body, err := os.ReadFile(name + ".body")
+		if err != nil {
+			t.Fatalf("%s: %v", e.path, err)
+		}
+		if string(body) != e.body {
+			t.Errorf("%s: body = %q, want %q", e.path, body, e.body)
+		}
+		meta, err := os.ReadFile(name + ".json")
+		if err != nil {
+			t.Fatalf("%s: %v", e.path, err)
+		}
+		var got Entry
+		if err := json.Unmarshal(meta, &got); err != nil {
+			t.Fatalf("%s: %v", e.path, err)
+		}
+		if got.Path != e.path || got.Bytes != len(e.body) || got.File != e.wantFile || !got.Time.Equal(at) {
+			t.Errorf("%s: metadata = %+v", e.path, got)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var seqs []uint64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("index line %q: %v", scanner.Text(), err)
+		}
+		seqs = append(seqs, e.Seq)
+	}
+	if len(seqs) != len(entries) || seqs[0] != 1 || seqs[len(seqs)-1] != uint64(len(entries)) {
+		t.Errorf("index sequence numbers = %v", seqs)
+	}
+}
+
+// A store that cannot append, such as S3, gets the whole index on every
+// Save, including what an earlier run left in it.
+type putOnly struct{ storage.Storage }
+
+func TestMirror_SavePutOnly(t *testing.T) {
+	ctx := context.Background()
+	store := putOnly{storage.NewMemory()}
+	if err := store.Put(ctx, IndexFile, []byte("{\"seq\":1}\n")); err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(ctx, store)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, p := range []string{"/playlist.m3u8", "/variant/0/playlist.m3u8"} {
+		if err := m.Save(ctx, Entry{Time: time.Now(), Method: "GET", Path: p, Status: http.StatusOK}, []byte("#EXTM3U\n")); err != nil {
+			t.Fatalf("Save(%s) error = %v", p, err)
+		}
+	}
+
+	index, err := store.Get(ctx, IndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(index)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], `"path":"/variant/0/playlist.m3u8"`) {
+		t.Errorf("index = %q, want the earlier line and both saves", index)
+	}
+	keys, err := store.List(ctx, "variant/0/playlist.m3u8/000002-")
+	if err != nil || len(keys) != 2 {
+		t.Errorf("keys of the second save = %v, %v, want .body and .json", keys, err)
+	}
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// cacheFormat is mixed into every cache key so that entries written by an
+// incompatible version are ignored rather than misread.
+const cacheFormat = "v3"
+
+// Cache stores parsed sources in a storage.Storage so that restarts (for example repeated
+// CI runs) can skip refetching every variant of a large master playlist. An
+// entry is keyed by the playlist URL and revalidated against the origin with
+// the ETag or Last-Modified it was stored with; only when the origin answers
+// 304 Not Modified is the cached result used.
+//
+// Only the top-level playlist is revalidated: if variant playlists change
+// while the master does not, the cache must be refreshed explicitly.
+type Cache struct {
+	store storage.Storage
+}
+
+// NewCache creates a Cache that stores entries in store, one key per
+// entry.
+func NewCache(store storage.Storage) *Cache {
+	return &Cache{store: store}
+}
+
+// DefaultCacheDir returns the per-user cache directory for source snapshots.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "encodersim", "sources"), nil
+}
+
+// cacheEntry is the on-disk form of a cached source.
+type cacheEntry struct {
+	URL          string       `json:"url"`
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"last_modified,omitempty"`
+	Playlist     string       `json:"playlist"`
+	Info         PlaylistInfo `json:"info"`
+}
+
+// key derives the cache key for playlistURL under the given parser
+// settings, which change the parsed result.
+func (c *Cache) key(playlistURL string, mode Mode, passthrough TagAllowlist) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", cacheFormat, playlistURL, mode, strings.Join(passthrough, ","))
+	return hex.EncodeToString(h.Sum(nil)) + ".json"
+}
+
+// load returns the entry stored under key, or nil if there is none or it
+// cannot be read.
+func (c *Cache) load(key string) *cacheEntry {
+	data, err := c.store.Get(context.Background(), key)
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// save writes entry under key, replacing any previous entry atomically.
+func (c *Cache) save(key string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(context.Background(), key, data)
+}
+
+// conditionalHeaders sets the revalidation headers for a cached entry.
+func (e *cacheEntry) conditionalHeaders(h http.Header) {
+	if e.ETag != "" {
+		h.Set("If-None-Match", e.ETag)
+	}
+	if e.LastModified != "" {
+		h.Set("If-Modified-Since", e.LastModified)
+	}
+}
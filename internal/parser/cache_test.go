@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// cacheTestOrigin serves a master playlist with one variant, honoring
+// If-None-Match for the master, and counts requests per path.
+type cacheTestOrigin struct {
+	mu       sync.Mutex
+	etag     string
+	requests map[string]int
+}
+
+func (o *cacheTestOrigin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	o.requests[r.URL.Path]++
+	etag := o.etag
+	o.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/master.m3u8":
+		if etag != "" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		}
+		w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\nlow.m3u8\n"))
+	case "/low.m3u8":
+		w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nseg0.ts\n#EXTINF:6.0,\nseg1.ts\n#EXT-X-ENDLIST\n"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (o *cacheTestOrigin) count(path string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.requests[path]
+}
+
+func TestParser_CacheRevalidation(t *testing.T) {
+	origin := &cacheTestOrigin{etag: `"v1"`, requests: make(map[string]int)}
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	cache := NewCache(storage.NewMemory())
+	masterURL := server.URL + "/master.m3u8"
+
+	first, err := New(Options{Cache: cache}).Parse(masterURL)
+	if err != nil {
+		t.Fatalf("first Parse() error = %v", err)
+	}
+	if first.FromCache {
+		t.Error("Expected first parse not to come from the cache")
+	}
+
+	// Unchanged origin: only the master is revalidated
+	second, err := New(Options{Cache: cache}).Parse(masterURL)
+	if err != nil {
+		t.Fatalf("second Parse() error = %v", err)
+	}
+	if !second.FromCache {
+		t.Error("Expected second parse to come from the cache")
+	}
+	if got := origin.count("/low.m3u8"); got != 1 {
+		t.Errorf("Expected variant fetched once, got %d", got)
+	}
+	if len(second.Variants) != 1 || len(second.Variants[0].Segments) != 2 ||
+		second.Variants[0].Segments[1].URL != server.URL+"/seg1.ts" {
+		t.Errorf("Cached result differs: %+v", second.Variants)
+	}
+
+	// Refresh ignores the entry
+	if _, err := New(Options{Cache: cache, RefreshCache: true}).Parse(masterURL); err != nil {
+		t.Fatalf("refresh Parse() error = %v", err)
+	}
+	if got := origin.count("/low.m3u8"); got != 2 {
+		t.Errorf("Expected refresh to refetch the variant, got %d fetches", got)
+	}
+
+	// A new ETag invalidates the entry
+	origin.mu.Lock()
+	origin.etag = `"v2"`
+	origin.mu.Unlock()
+	third, err := New(Options{Cache: cache}).Parse(masterURL)
+	if err != nil {
+		t.Fatalf("third Parse() error = %v", err)
+	}
+	if third.FromCache || origin.count("/low.m3u8") != 3 {
+		t.Error("Expected a changed ETag to refetch the source")
+	}
+
+	// Different parse settings do not share entries
+	strict, err := New(Options{Cache: cache, Mode: ModeStrict}).Parse(masterURL)
+	if err != nil {
+		t.Fatalf("strict Parse() error = %v", err)
+	}
+	if strict.FromCache {
+		t.Error("Expected a different parse mode to miss the cache")
+	}
+}
+
+func TestParser_CacheSkipped(t *testing.T) {
+	origin := &cacheTestOrigin{requests: make(map[string]int)}
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	dir := t.TempDir()
+	cache := NewCache(storage.NewDisk(dir))
+
+	// Without validators nothing is stored
+	if _, err := New(Options{Cache: cache}).Parse(server.URL + "/master.m3u8"); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no cache entries without ETag or Last-Modified, got %d", len(entries))
+	}
+
+	// Templates bypass the cache entirely
+	origin.mu.Lock()
+	origin.etag = `"v1"`
+	origin.mu.Unlock()
+	p := New(Options{Cache: cache, Template: Template{Mode: TemplateEnv}})
+	if _, err := p.Parse(server.URL + "/master.m3u8"); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	entries, _ = os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected templated sources not to be cached, got %d entries", len(entries))
+	}
+}
+
+func TestParser_CacheWriteError(t *testing.T) {
+	origin := &cacheTestOrigin{etag: `"v1"`, requests: make(map[string]int)}
+	server := httptest.NewServer(origin)
+	defer server.Close()
+
+	b, err := budget.New(budget.Limits{CacheBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewMemory()
+	store.SetQuota(b)
+
+	info, err := New(Options{Cache: NewCache(store)}).Parse(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !errors.Is(info.CacheErr, budget.ErrExceeded) {
+		t.Errorf("CacheErr = %v, want budget.ErrExceeded", info.CacheErr)
+	}
+	if len(info.Variants) != 1 {
+		t.Errorf("Expected the parse to succeed despite the cache, got %d variants", len(info.Variants))
+	}
+}
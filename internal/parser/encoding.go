@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding is sent with playlist requests. Setting it explicitly
+// disables the transport's transparent gzip handling, so decodeBody must
+// handle every encoding listed here.
+const acceptEncoding = "gzip, br"
+
+// decodeBody returns a reader for the decoded body of resp according to its
+// Content-Encoding header. Some CDNs gzip playlists without declaring it, so
+// an undeclared body starting with the gzip magic number is also decoded.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gzip body: %w", err)
+		}
+		return zr, nil
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	case "", "identity":
+		br := bufio.NewReader(resp.Body)
+		if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+			zr, err := gzip.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode gzip body: %w", err)
+			}
+			return zr, nil
+		}
+		return br, nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+const compressedTestPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+segment001.ts
+#EXTINF:10.0,
+segment002.ts
+#EXT-X-ENDLIST
+`
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func brotliBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	bw := brotli.NewWriter(&b)
+	bw.Write([]byte(s))
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestParsePlaylist_CompressedResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		wantErr  bool
+	}{
+		{name: "gzip", encoding: "gzip", body: gzipBytes(t, compressedTestPlaylist)},
+		{name: "brotli", encoding: "br", body: brotliBytes(t, compressedTestPlaylist)},
+		{name: "undeclared gzip", body: gzipBytes(t, compressedTestPlaylist)},
+		{name: "identity", encoding: "identity", body: []byte(compressedTestPlaylist)},
+		{name: "unsupported encoding", encoding: "zstd", body: []byte("garbage"), wantErr: true},
+		{name: "corrupt gzip", encoding: "gzip", body: []byte("not gzip"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAccept string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAccept = r.Header.Get("Accept-Encoding")
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			info, err := ParsePlaylist(server.URL + "/playlist.m3u8")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlaylist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotAccept != acceptEncoding {
+				t.Errorf("Accept-Encoding = %q, want %q", gotAccept, acceptEncoding)
+			}
+			if err == nil && len(info.Segments) != 2 {
+				t.Errorf("Expected 2 segments, got %d", len(info.Segments))
+			}
+		})
+	}
+}
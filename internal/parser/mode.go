@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/grafov/m3u8"
+)
+
+// Mode controls how tolerant the parser is of malformed or unusual sources.
+type Mode string
+
+const (
+	// ModeLenient accepts playlists with syntax errors, unknown tags,
+	// duplicate header tags and missing EXT-X-ENDLIST, reporting each as a
+	// Warning in PlaylistInfo.
+	ModeLenient Mode = "lenient"
+
+	// ModeStrict rejects playlists with any of the issues ModeLenient
+	// tolerates.
+	ModeStrict Mode = "strict"
+)
+
+// ParseMode parses a mode name. An empty name selects ModeLenient.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeLenient:
+		return ModeLenient, nil
+	case ModeStrict:
+		return ModeStrict, nil
+	default:
+		return "", fmt.Errorf("unknown parse mode %q (expected strict or lenient)", s)
+	}
+}
+
+// Issue identifies a kind of problem found in a source playlist.
+type Issue string
+
+const (
+	// IssueSyntax is a line the m3u8 decoder could not parse.
+	IssueSyntax Issue = "syntax"
+	// IssueMissingEndlist is a media playlist without EXT-X-ENDLIST.
+	IssueMissingEndlist Issue = "missing-endlist"
+	// IssueUnknownTag is an #EXT tag not defined by the HLS specification.
+	IssueUnknownTag Issue = "unknown-tag"
+	// IssueDuplicateTag is a tag that may appear only once but was repeated.
+	IssueDuplicateTag Issue = "duplicate-tag"
+)
+
+// Warning describes an issue tolerated while parsing in lenient mode.
+type Warning struct {
+	// URL is the playlist the issue was found in.
+	URL string
+	// Line is the 1-based line number, or 0 if the issue is not tied to a line.
+	Line int
+	// Issue is the kind of problem.
+	Issue Issue
+	// Detail describes the problem, such as the offending tag.
+	Detail string
+}
+
+// String formats the warning for logs and error messages.
+func (w Warning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", w.URL, w.Line, w.Issue, w.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", w.URL, w.Issue, w.Detail)
+}
+
+// knownTags lists the tags defined by RFC 8216 and its low-latency extensions.
+var knownTags = map[string]bool{
+	"#EXTM3U":                       true,
+	"#EXTINF":                       true,
+	"#EXT-X-VERSION":                true,
+	"#EXT-X-TARGETDURATION":         true,
+	"#EXT-X-MEDIA-SEQUENCE":         true,
+	"#EXT-X-DISCONTINUITY-SEQUENCE": true,
+	"#EXT-X-DISCONTINUITY":          true,
+	"#EXT-X-ENDLIST":                true,
+	"#EXT-X-PLAYLIST-TYPE":          true,
+	"#EXT-X-I-FRAMES-ONLY":          true,
+	"#EXT-X-INDEPENDENT-SEGMENTS":   true,
+	"#EXT-X-START":                  true,
+	"#EXT-X-DEFINE":                 true,
+	"#EXT-X-BYTERANGE":              true,
+	"#EXT-X-KEY":                    true,
+	"#EXT-X-MAP":                    true,
+	"#EXT-X-PROGRAM-DATE-TIME":      true,
+	"#EXT-X-DATERANGE":              true,
+	"#EXT-X-GAP":                    true,
+	"#EXT-X-BITRATE":                true,
+	"#EXT-X-PART":                   true,
+	"#EXT-X-PART-INF":               true,
+	"#EXT-X-SERVER-CONTROL":         true,
+	"#EXT-X-PRELOAD-HINT":           true,
+	"#EXT-X-RENDITION-REPORT":       true,
+	"#EXT-X-SKIP":                   true,
+	"#EXT-X-MEDIA":                  true,
+	"#EXT-X-STREAM-INF":             true,
+	"#EXT-X-I-FRAME-STREAM-INF":     true,
+	"#EXT-X-SESSION-DATA":           true,
+	"#EXT-X-SESSION-KEY":            true,
+	"#EXT-X-CONTENT-STEERING":       true,
+	"#EXT-X-ALLOW-CACHE":            true, // removed in protocol version 7 but still common
+	"#EXT-X-CUE-OUT":                true, // SCTE-35 markers understood by the decoder
+	"#EXT-X-CUE-OUT-CONT":           true,
+	"#EXT-X-CUE-IN":                 true,
+	"#EXT-X-SCTE35":                 true,
+	"#EXT-OATCLS-SCTE35":            true,
+}
+
+// singletonTags may appear at most once per playlist.
+var singletonTags = map[string]bool{
+	"#EXTM3U":                       true,
+	"#EXT-X-VERSION":                true,
+	"#EXT-X-TARGETDURATION":         true,
+	"#EXT-X-MEDIA-SEQUENCE":         true,
+	"#EXT-X-DISCONTINUITY-SEQUENCE": true,
+	"#EXT-X-ENDLIST":                true,
+	"#EXT-X-PLAYLIST-TYPE":          true,
+	"#EXT-X-I-FRAMES-ONLY":          true,
+	"#EXT-X-INDEPENDENT-SEGMENTS":   true,
+	"#EXT-X-START":                  true,
+	"#EXT-X-PART-INF":               true,
+	"#EXT-X-SERVER-CONTROL":         true,
+}
+
+// tagName returns the tag portion of an #EXT line, without attributes.
+func tagName(line string) string {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+// inspect scans raw playlist text for unknown and duplicated tags. Tags
+// selected for passthrough are expected and not reported.
+func inspect(playlistURL string, data []byte, allow TagAllowlist) []Warning {
+	var warnings []Warning
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#EXT") {
+			continue
+		}
+
+		tag := tagName(line)
+		if !knownTags[tag] {
+			if allow.allows(tag) {
+				continue
+			}
+			warnings = append(warnings, Warning{URL: playlistURL, Line: lineNum, Issue: IssueUnknownTag, Detail: tag})
+			continue
+		}
+		if singletonTags[tag] {
+			if first, ok := seen[tag]; ok {
+				warnings = append(warnings, Warning{
+					URL:    playlistURL,
+					Line:   lineNum,
+					Issue:  IssueDuplicateTag,
+					Detail: fmt.Sprintf("%s (first on line %d)", tag, first),
+				})
+				continue
+			}
+			seen[tag] = lineNum
+		}
+	}
+
+	return warnings
+}
+
+// decode parses raw playlist text according to the parser's mode. Issues
+// tolerated in lenient mode are appended to warnings; in strict mode any
+// issue is an error.
+func (p *Parser) decode(playlistURL string, data []byte, warnings *[]Warning) (m3u8.Playlist, m3u8.ListType, error) {
+	issues := inspect(playlistURL, data, p.passthrough)
+
+	playlist, listType, err := m3u8.Decode(*bytes.NewBuffer(data), true)
+	if err != nil {
+		if p.mode == ModeStrict {
+			return nil, 0, fmt.Errorf("failed to parse playlist: %w", err)
+		}
+		issues = append(issues, Warning{URL: playlistURL, Issue: IssueSyntax, Detail: err.Error()})
+
+		playlist, listType, err = m3u8.Decode(*bytes.NewBuffer(data), false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse playlist: %w", err)
+		}
+	}
+
+	if media, ok := playlist.(*m3u8.MediaPlaylist); ok && listType == m3u8.MEDIA && !media.Closed {
+		issues = append(issues, Warning{URL: playlistURL, Issue: IssueMissingEndlist, Detail: "no #EXT-X-ENDLIST tag"})
+	}
+
+	if len(issues) > 0 && p.mode == ModeStrict {
+		details := make([]string, len(issues))
+		for i, issue := range issues {
+			details[i] = issue.String()
+		}
+		return nil, 0, fmt.Errorf("playlist rejected in strict mode: %s", strings.Join(details, "; "))
+	}
+
+	*warnings = append(*warnings, issues...)
+	return playlist, listType, nil
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Mode
+		wantErr bool
+	}{
+		{in: "", want: ModeLenient},
+		{in: "lenient", want: ModeLenient},
+		{in: "STRICT", want: ModeStrict},
+		{in: "pedantic", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Modes(t *testing.T) {
+	tests := []struct {
+		name         string
+		playlist     string
+		wantIssues   []Issue
+		strictReject bool
+	}{
+		{
+			name: "clean",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-ENDLIST
+`,
+		},
+		{
+			name: "missing endlist",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+seg0.ts
+`,
+			wantIssues:   []Issue{IssueMissingEndlist},
+			strictReject: true,
+		},
+		{
+			name: "unknown tag",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-CUSTOM-AD:id=42
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-ENDLIST
+`,
+			wantIssues:   []Issue{IssueUnknownTag},
+			strictReject: true,
+		},
+		{
+			name: "duplicate header",
+			playlist: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-ENDLIST
+`,
+			wantIssues:   []Issue{IssueDuplicateTag},
+			strictReject: true,
+		},
+		{
+			name: "syntax error",
+			playlist: `#EXTM3U
+#EXT-X-TARGETDURATION:ten
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-ENDLIST
+`,
+			wantIssues:   []Issue{IssueSyntax},
+			strictReject: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.playlist))
+			}))
+			defer server.Close()
+
+			info, err := New(Options{Mode: ModeLenient}).Parse(server.URL)
+			if err != nil {
+				t.Fatalf("lenient Parse() error = %v", err)
+			}
+			if len(info.Warnings) != len(tt.wantIssues) {
+				t.Fatalf("lenient Parse() warnings = %v, want issues %v", info.Warnings, tt.wantIssues)
+			}
+			for i, w := range info.Warnings {
+				if w.Issue != tt.wantIssues[i] {
+					t.Errorf("warning %d issue = %q, want %q", i, w.Issue, tt.wantIssues[i])
+				}
+				if w.URL != server.URL {
+					t.Errorf("warning %d URL = %q, want %q", i, w.URL, server.URL)
+				}
+			}
+
+			_, err = New(Options{Mode: ModeStrict}).Parse(server.URL)
+			if (err != nil) != tt.strictReject {
+				t.Errorf("strict Parse() error = %v, want rejection %v", err, tt.strictReject)
+			}
+		})
+	}
+}
+
+func TestInspect_LineNumbers(t *testing.T) {
+	data := []byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-FOO\n#EXT-X-VERSION:4\n")
+
+	warnings := inspect("http://origin/x.m3u8", data, nil)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	if warnings[0].Line != 3 || warnings[0].Detail != "#EXT-X-FOO" {
+		t.Errorf("warnings[0] = %+v, want unknown #EXT-X-FOO on line 3", warnings[0])
+	}
+	if warnings[1].Line != 4 || warnings[1].Issue != IssueDuplicateTag {
+		t.Errorf("warnings[1] = %+v, want duplicate on line 4", warnings[1])
+	}
+	if got := warnings[0].String(); got != "http://origin/x.m3u8:3: unknown-tag: #EXT-X-FOO" {
+		t.Errorf("String() = %q", got)
+	}
+}
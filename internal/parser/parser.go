@@ -2,13 +2,18 @@
 package parser
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"time"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/upstream"
 	"github.com/agleyzer/encodersim/internal/variant"
 	"github.com/grafov/m3u8"
 )
@@ -22,6 +27,11 @@ type PlaylistInfo struct {
 	// Variants contains the variant streams (only populated for master playlists)
 	Variants []variant.Variant
 
+	// Renditions contains the alternate audio and subtitle renditions
+	// (EXT-X-MEDIA) that the variants reference, in playlist order (only
+	// populated for master playlists)
+	Renditions []variant.Rendition
+
 	// Segments contains segments for a single media playlist (only populated for media playlists)
 	// Kept for backward compatibility with single media playlist mode
 	Segments []segment.Segment
@@ -29,186 +39,437 @@ type PlaylistInfo struct {
 	// TargetDuration is the maximum segment duration in seconds
 	// For master playlists, this is the max across all variants
 	TargetDuration int
+
+	// MediaSequence is the EXT-X-MEDIA-SEQUENCE of the source playlist
+	// (only populated for media playlists)
+	MediaSequence uint64
+
+	// Version is the EXT-X-VERSION of the source playlist, 3 if it does not
+	// declare one (only populated for media playlists)
+	Version int
+
+	// HeaderTags holds passed-through custom tags from the media playlist
+	// header (only populated for media playlists)
+	HeaderTags []string
+
+	// Warnings lists issues tolerated while parsing in lenient mode,
+	// across the master playlist and all variants
+	Warnings []Warning
+
+	// FromCache reports that the result was loaded from the snapshot cache
+	// after the origin confirmed the playlist is unchanged
+	FromCache bool `json:"-"`
+
+	// CacheErr is why the parsed result could not be written to the
+	// snapshot cache, such as a full disk or an exceeded cache budget. The
+	// parse itself succeeded; callers should report it.
+	CacheErr error `json:"-"`
 }
 
-// ParsePlaylist fetches and parses an HLS playlist from a URL.
+// Options configures a Parser.
+type Options struct {
+	// Client fetches playlists. If nil, the shared upstream default client
+	// is used.
+	Client *http.Client
+
+	// Mode selects strict or lenient parsing. Defaults to ModeLenient.
+	Mode Mode
+
+	// PassthroughTags selects custom tags from media playlists to preserve
+	// on segments and variants. Empty passes nothing through.
+	PassthroughTags TagAllowlist
+
+	// Template expands every fetched playlist (master and variants) before
+	// it is parsed. The zero value leaves playlists unchanged.
+	Template Template
+
+	// Cache, if set, stores parsed HTTP sources on disk and reuses them
+	// while the origin reports the top-level playlist unchanged. It is not
+	// used when a Template is set, since expansion may depend on the
+	// environment.
+	Cache *Cache
+
+	// RefreshCache ignores existing cache entries but still stores the
+	// freshly parsed result.
+	RefreshCache bool
+}
+
+// Parser fetches and parses HLS playlists over a shared HTTP client, so that
+// fetching a master playlist and all of its variants reuses connections.
+type Parser struct {
+	client      *http.Client
+	mode        Mode
+	passthrough TagAllowlist
+	template    Template
+	cache       *Cache
+	refresh     bool
+}
+
+// New creates a Parser with the given options.
+func New(opts Options) *Parser {
+	if opts.Client == nil {
+		opts.Client = upstream.DefaultClient()
+	}
+	if opts.Mode == "" {
+		opts.Mode = ModeLenient
+	}
+	return &Parser{
+		client:      opts.Client,
+		mode:        opts.Mode,
+		passthrough: opts.PassthroughTags,
+		template:    opts.Template,
+		cache:       opts.Cache,
+		refresh:     opts.RefreshCache,
+	}
+}
+
+// ParsePlaylist fetches and parses an HLS playlist from a URL or local file
+// path using the shared upstream default client and lenient parsing.
 func ParsePlaylist(playlistURL string) (*PlaylistInfo, error) {
-	// Fetch the playlist
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	return New(Options{}).Parse(playlistURL)
+}
+
+// Parse fetches and parses an HLS playlist from a URL or local file path
+// (see SourceURL).
+func (p *Parser) Parse(playlistURL string) (*PlaylistInfo, error) {
+	playlistURL, err := SourceURL(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	if p.cacheable(playlistURL) {
+		return p.parseCached(playlistURL)
 	}
 
-	resp, err := client.Get(playlistURL)
+	data, err := p.fetchData(playlistURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return p.parseData(data, playlistURL, playlistURL)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch playlist: HTTP %d", resp.StatusCode)
+// cacheable reports whether results for playlistURL go through the cache.
+func (p *Parser) cacheable(playlistURL string) bool {
+	if p.cache == nil || (p.template.Mode != "" && p.template.Mode != TemplateNone) {
+		return false
 	}
+	_, local := LocalPath(playlistURL)
+	return !local
+}
 
-	// Parse the playlist
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
+// parseCached parses playlistURL, revalidating a cached result with the
+// origin first. Failing to write the cache does not fail the parse; the
+// error is returned in PlaylistInfo.CacheErr.
+func (p *Parser) parseCached(playlistURL string) (*PlaylistInfo, error) {
+	key := p.cache.key(playlistURL, p.mode, p.passthrough)
+
+	var cached *cacheEntry
+	if !p.refresh {
+		cached = p.cache.load(key)
+	}
+
+	req, err := p.newRequest(playlistURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse playlist: %w", err)
+		return nil, err
+	}
+	if cached != nil {
+		cached.conditionalHeaders(req.Header)
 	}
 
-	// Detect playlist type and handle accordingly
-	if listType == m3u8.MASTER {
-		return parseMasterPlaylist(playlist, playlistURL)
+	body, header, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil && cached != nil {
+		info := cached.Info
+		info.FromCache = true
+		return &info, nil
+	}
+	if body == nil {
+		return nil, fmt.Errorf("failed to fetch playlist: unexpected HTTP %d", http.StatusNotModified)
 	}
 
-	// Handle media playlist
-	mediaPlaylist, ok := playlist.(*m3u8.MediaPlaylist)
-	if !ok {
-		return nil, fmt.Errorf("unexpected playlist type")
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
 	}
 
-	// Extract segments
-	var segments []segment.Segment
-	for i, seg := range mediaPlaylist.Segments {
-		if seg == nil {
-			break
-		}
+	info, err := p.parseData(data, playlistURL, playlistURL)
+	if err != nil {
+		return nil, err
+	}
 
-		// Resolve segment URL to absolute
-		segmentURL, err := resolveURL(playlistURL, seg.URI)
-		if err != nil {
-			return nil, fmt.Errorf("failed to resolve segment URL: %w", err)
+	entry := &cacheEntry{
+		URL:          playlistURL,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Playlist:     string(data),
+		Info:         *info,
+	}
+	if entry.ETag != "" || entry.LastModified != "" {
+		if err := p.cache.save(key, entry); err != nil {
+			info.CacheErr = fmt.Errorf("failed to cache %s: %w", playlistURL, err)
 		}
+	}
+	return info, nil
+}
 
-		segments = append(segments, segment.Segment{
-			URL:      segmentURL,
-			Duration: seg.Duration,
-			Sequence: i,
-		})
+// ParseReader parses an HLS playlist read from r, for example stdin.
+// Relative URIs are resolved against baseURL; if baseURL is empty, every URI
+// in the playlist must be absolute. Variant playlists referenced by a master
+// playlist are still fetched over the network.
+func (p *Parser) ParseReader(r io.Reader, baseURL string) (*PlaylistInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
 	}
 
-	if len(segments) == 0 {
-		return nil, fmt.Errorf("playlist contains no segments")
+	name := baseURL
+	if name == "" {
+		name = "-"
 	}
+	return p.parseData(data, name, baseURL)
+}
 
-	targetDuration := int(mediaPlaylist.TargetDuration)
-	if targetDuration == 0 {
-		// If target duration is not set, use the max segment duration
-		maxDuration := 0.0
-		for _, seg := range segments {
-			if seg.Duration > maxDuration {
-				maxDuration = seg.Duration
-			}
-		}
-		targetDuration = int(maxDuration) + 1
+// parseData expands and decodes playlist text and builds the PlaylistInfo. name
+// identifies the playlist in warnings; baseURL resolves relative URIs.
+func (p *Parser) parseData(data []byte, name, baseURL string) (*PlaylistInfo, error) {
+	data, err := p.template.expand(name, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []Warning
+	playlist, listType, err := p.decode(name, data, &warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Detect playlist type and handle accordingly
+	if listType == m3u8.MASTER {
+		return p.parseMasterPlaylist(playlist, baseURL, warnings)
+	}
+
+	// Handle media playlist
+	media, err := p.parseMediaPlaylist(playlist, data, baseURL, 0)
+	if err != nil {
+		return nil, err
 	}
 
 	return &PlaylistInfo{
 		IsMaster:       false,
-		Segments:       segments,
-		TargetDuration: targetDuration,
+		Segments:       media.Segments,
+		TargetDuration: media.TargetDuration,
+		MediaSequence:  media.MediaSequence,
+		Version:        media.Version,
+		HeaderTags:     media.HeaderTags,
+		Warnings:       warnings,
 	}, nil
 }
 
+// maxMasterDepth bounds how deeply master playlists may reference other
+// master playlists, which also guards against reference cycles.
+const maxMasterDepth = 4
+
 // parseMasterPlaylist parses a master playlist and extracts variant information.
-func parseMasterPlaylist(playlist m3u8.Playlist, masterURL string) (*PlaylistInfo, error) {
+// Variants that point to further master playlists are flattened into a single
+// list.
+func (p *Parser) parseMasterPlaylist(playlist m3u8.Playlist, masterURL string, warnings []Warning) (*PlaylistInfo, error) {
+	var master masterContent
+	if err := p.collectVariants(playlist, masterURL, 1, &master, &warnings); err != nil {
+		return nil, err
+	}
+	variants := master.variants
+
+	// Track maximum target duration across all variants and renditions
+	maxTargetDuration := 0
+	for _, v := range variants {
+		if v.TargetDuration > maxTargetDuration {
+			maxTargetDuration = v.TargetDuration
+		}
+	}
+	for _, r := range master.renditions {
+		maxTargetDuration = max(maxTargetDuration, r.Media.TargetDuration)
+	}
+
+	return &PlaylistInfo{
+		IsMaster:       true,
+		Variants:       variants,
+		Renditions:     master.renditions,
+		TargetDuration: maxTargetDuration,
+		Warnings:       warnings,
+	}, nil
+}
+
+// masterContent accumulates the variants and renditions of a master playlist
+// and the master playlists nested in it.
+type masterContent struct {
+	variants   []variant.Variant
+	renditions []variant.Rendition
+	seen       map[*m3u8.Alternative]bool // Renditions already collected
+}
+
+// collectVariants fetches the media playlist of every variant in a master
+// playlist, and of the audio and subtitle renditions they reference, and
+// appends the results to content, descending into nested master playlists.
+// depth is the nesting level of masterURL, starting at 1.
+func (p *Parser) collectVariants(playlist m3u8.Playlist, masterURL string, depth int, content *masterContent, warnings *[]Warning) error {
 	masterPlaylist, ok := playlist.(*m3u8.MasterPlaylist)
 	if !ok {
-		return nil, fmt.Errorf("unexpected playlist type")
+		return fmt.Errorf("unexpected playlist type")
 	}
 
 	if len(masterPlaylist.Variants) == 0 {
-		return nil, fmt.Errorf("master playlist contains no variants")
+		return fmt.Errorf("master playlist contains no variants")
 	}
 
 	// Extract variant information and fetch each variant's media playlist
-	var variants []variant.Variant
-	maxTargetDuration := 0
-
-	for variantIndex, v := range masterPlaylist.Variants {
+	for _, v := range masterPlaylist.Variants {
 		if v == nil {
 			continue
 		}
+		variantIndex := len(content.variants)
 
 		// Resolve variant playlist URL to absolute
 		variantURL, err := resolveURL(masterURL, v.URI)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve variant URL: %w", err)
+			return fmt.Errorf("failed to resolve variant URL: %w", err)
 		}
 
-		// Extract resolution if available
-		resolution := ""
-		if v.Resolution != "" {
-			resolution = v.Resolution
+		// Fetch and parse the variant's playlist
+		child, listType, data, err := p.fetchAndDecode(variantURL, warnings)
+		if err != nil {
+			return fmt.Errorf("failed to parse variant %d media playlist: %w", variantIndex, err)
 		}
 
-		// Extract codecs if available
-		codecs := ""
-		if v.Codecs != "" {
-			codecs = v.Codecs
+		// Flatten nested master playlists
+		if listType == m3u8.MASTER {
+			if depth >= maxMasterDepth {
+				return fmt.Errorf("master playlist %s nested more than %d levels deep", variantURL, maxMasterDepth)
+			}
+			if err := p.collectVariants(child, variantURL, depth+1, content, warnings); err != nil {
+				return fmt.Errorf("failed to parse nested master playlist %s: %w", variantURL, err)
+			}
+			continue
 		}
 
-		// Fetch and parse the variant's media playlist
-		segments, targetDuration, err := parseMediaPlaylistFromURL(variantURL, variantIndex)
+		media, err := p.parseMediaPlaylist(child, data, variantURL, variantIndex)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse variant %d media playlist: %w", variantIndex, err)
+			return fmt.Errorf("failed to parse variant %d media playlist: %w", variantIndex, err)
 		}
 
-		// Track maximum target duration across all variants
-		if targetDuration > maxTargetDuration {
-			maxTargetDuration = targetDuration
+		media.Bandwidth = int(v.Bandwidth)
+		media.Resolution = v.Resolution
+		media.Codecs = v.Codecs
+		if err := p.collectRenditions(v, masterURL, content, warnings); err != nil {
+			return err
 		}
-
-		variants = append(variants, variant.Variant{
-			Bandwidth:      int(v.Bandwidth),
-			Resolution:     resolution,
-			Codecs:         codecs,
-			PlaylistURL:    variantURL,
-			Segments:       segments,
-			TargetDuration: targetDuration,
-		})
+		for _, alt := range v.Alternatives {
+			switch {
+			case alt.Type == variant.RenditionAudio && alt.GroupId == v.Audio:
+				media.Audio = v.Audio
+			case alt.Type == variant.RenditionSubtitles && alt.GroupId == v.Subtitles:
+				media.Subtitles = v.Subtitles
+			}
+		}
+		content.variants = append(content.variants, media)
 	}
 
-	return &PlaylistInfo{
-		IsMaster:       true,
-		Variants:       variants,
-		TargetDuration: maxTargetDuration,
-	}, nil
+	return nil
 }
 
-// parseMediaPlaylistFromURL fetches and parses a media playlist from a URL.
-func parseMediaPlaylistFromURL(playlistURL string, variantIndex int) ([]segment.Segment, int, error) {
-	// Fetch the playlist
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := client.Get(playlistURL)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to fetch playlist: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, 0, fmt.Errorf("failed to fetch playlist: HTTP %d", resp.StatusCode)
-	}
+// collectRenditions fetches the media playlists of the audio and subtitle
+// renditions that v references and has not been collected yet, and appends
+// them to content. Renditions without a URI are collected without a media
+// playlist; other rendition types are not supported and are dropped.
+func (p *Parser) collectRenditions(v *m3u8.Variant, masterURL string, content *masterContent, warnings *[]Warning) error {
+	for _, alt := range v.Alternatives {
+		if alt == nil || content.seen[alt] {
+			continue
+		}
+		if content.seen == nil {
+			content.seen = make(map[*m3u8.Alternative]bool)
+		}
+		content.seen[alt] = true
+		if alt.Type != variant.RenditionAudio && alt.Type != variant.RenditionSubtitles {
+			continue
+		}
 
-	// Parse the playlist
-	playlist, listType, err := m3u8.DecodeFrom(resp.Body, true)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to parse playlist: %w", err)
+		renditionIndex := len(content.renditions)
+		r := variant.Rendition{
+			Type:            alt.Type,
+			GroupID:         alt.GroupId,
+			Name:            alt.Name,
+			Language:        alt.Language,
+			Default:         alt.Default,
+			Autoselect:      strings.EqualFold(alt.Autoselect, "YES"),
+			Forced:          strings.EqualFold(alt.Forced, "YES"),
+			Characteristics: alt.Characteristics,
+		}
+		if alt.URI != "" {
+			renditionURL, err := resolveURL(masterURL, alt.URI)
+			if err != nil {
+				return fmt.Errorf("failed to resolve rendition URL: %w", err)
+			}
+			child, listType, data, err := p.fetchAndDecode(renditionURL, warnings)
+			if err != nil {
+				return fmt.Errorf("failed to parse rendition %d media playlist: %w", renditionIndex, err)
+			}
+			if listType != m3u8.MEDIA {
+				return fmt.Errorf("rendition %d URI %s is not a media playlist", renditionIndex, renditionURL)
+			}
+			r.Media, err = p.parseMediaPlaylist(child, data, renditionURL, renditionIndex)
+			if err != nil {
+				return fmt.Errorf("failed to parse rendition %d media playlist: %w", renditionIndex, err)
+			}
+		}
+		content.renditions = append(content.renditions, r)
 	}
+	return nil
+}
 
-	// Ensure it's a media playlist
-	if listType != m3u8.MEDIA {
-		return nil, 0, fmt.Errorf("expected media playlist, got master playlist")
+// explicitOffsets reports, for each segment of a media playlist in order,
+// whether its EXT-X-BYTERANGE gives an offset.
+func explicitOffsets(data []byte) []bool {
+	var (
+		offsets  []bool
+		explicit bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			explicit = strings.Contains(line, "@")
+		case strings.HasPrefix(line, "#"):
+		default:
+			offsets = append(offsets, explicit)
+			explicit = false
+		}
 	}
+	return offsets
+}
 
+// parseMediaPlaylist extracts segments from a decoded media playlist.
+// It returns a variant with the playlist URL and media playlist fields set;
+// attributes from the master playlist are left for the caller to fill in.
+func (p *Parser) parseMediaPlaylist(playlist m3u8.Playlist, data []byte, playlistURL string, variantIndex int) (variant.Variant, error) {
 	mediaPlaylist, ok := playlist.(*m3u8.MediaPlaylist)
 	if !ok {
-		return nil, 0, fmt.Errorf("unexpected playlist type")
+		return variant.Variant{}, fmt.Errorf("unexpected playlist type")
 	}
 
 	// Extract segments
-	var segments []segment.Segment
+	var (
+		segments  []segment.Segment
+		initURL   string
+		initRange string
+		rangeURI  string // resource of the previous byte-range segment
+		rangeEnd  int64  // end offset of the previous byte-range segment
+		explicit  = explicitOffsets(data)
+	)
 	for i, seg := range mediaPlaylist.Segments {
 		if seg == nil {
 			break
@@ -217,19 +478,53 @@ func parseMediaPlaylistFromURL(playlistURL string, variantIndex int) ([]segment.
 		// Resolve segment URL to absolute
 		segmentURL, err := resolveURL(playlistURL, seg.URI)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to resolve segment URL: %w", err)
+			return variant.Variant{}, fmt.Errorf("failed to resolve segment URL: %w", err)
+		}
+
+		// EXT-X-MAP applies to every following segment until the next one
+		if seg.Map != nil {
+			initURL, err = resolveURL(playlistURL, seg.Map.URI)
+			if err != nil {
+				return variant.Variant{}, fmt.Errorf("failed to resolve EXT-X-MAP URL: %w", err)
+			}
+			initRange = ""
+			if seg.Map.Limit > 0 {
+				initRange = fmt.Sprintf("%d@%d", seg.Map.Limit, seg.Map.Offset)
+			}
+		}
+
+		// EXT-X-BYTERANGE without an offset continues the previous sub-range
+		// of the same resource; the decoder reports such offsets as 0, so
+		// the source lines tell them from an explicit @0
+		byteRange := ""
+		if seg.Limit > 0 {
+			offset := seg.Offset
+			if offset == 0 && seg.URI == rangeURI && (i >= len(explicit) || !explicit[i]) {
+				offset = rangeEnd
+			}
+			byteRange = fmt.Sprintf("%d@%d", seg.Limit, offset)
+			rangeURI, rangeEnd = seg.URI, offset+seg.Limit
+		} else {
+			rangeURI, rangeEnd = "", 0
 		}
 
 		segments = append(segments, segment.Segment{
-			URL:          segmentURL,
-			Duration:     seg.Duration,
-			Sequence:     i,
-			VariantIndex: variantIndex,
+			URL:            segmentURL,
+			Duration:       seg.Duration,
+			Sequence:       i,
+			SourceSequence: mediaPlaylist.SeqNo + uint64(i),
+			VariantIndex:   variantIndex,
+			ByteRange:      byteRange,
+			InitURL:        initURL,
+			InitByteRange:  initRange,
 		})
 	}
 
+	tags := extractTags(data, p.passthrough)
+	applySegmentTags(segments, tags.segments)
+
 	if len(segments) == 0 {
-		return nil, 0, fmt.Errorf("playlist contains no segments")
+		return variant.Variant{}, fmt.Errorf("playlist contains no segments")
 	}
 
 	targetDuration := int(mediaPlaylist.TargetDuration)
@@ -244,11 +539,160 @@ func parseMediaPlaylistFromURL(playlistURL string, variantIndex int) ([]segment.
 		targetDuration = int(maxDuration) + 1
 	}
 
-	return segments, targetDuration, nil
+	return variant.Variant{
+		PlaylistURL:    playlistURL,
+		Segments:       segments,
+		TargetDuration: targetDuration,
+		MediaSequence:  mediaPlaylist.SeqNo,
+		Version:        int(mediaPlaylist.Version()),
+		HeaderTags:     tags.header,
+	}, nil
+}
+
+// fetchAndDecode fetches playlistURL, expands its template and decodes it
+// according to the parser's mode, appending tolerated issues to warnings. It
+// also returns the expanded playlist text.
+func (p *Parser) fetchAndDecode(playlistURL string, warnings *[]Warning) (m3u8.Playlist, m3u8.ListType, []byte, error) {
+	data, err := p.fetchData(playlistURL)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	data, err = p.template.expand(playlistURL, data)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	playlist, listType, err := p.decode(playlistURL, data, warnings)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return playlist, listType, data, nil
+}
+
+// fetchData fetches playlistURL and returns the full playlist text.
+func (p *Parser) fetchData(playlistURL string) ([]byte, error) {
+	body, err := p.fetch(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return data, nil
+}
+
+// fetch issues a GET for playlistURL and returns the decoded response body if
+// it succeeded. file:// URLs are read from the local filesystem. The caller
+// must close the returned body.
+func (p *Parser) fetch(playlistURL string) (io.ReadCloser, error) {
+	if path, ok := LocalPath(playlistURL); ok {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read playlist: %w", err)
+		}
+		return f, nil
+	}
+
+	req, err := p.newRequest(playlistURL)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := p.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, fmt.Errorf("failed to fetch playlist: unexpected HTTP %d", http.StatusNotModified)
+	}
+	return body, nil
+}
+
+// newRequest builds a GET request for playlistURL.
+func (p *Parser) newRequest(playlistURL string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, playlistURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	return req, nil
+}
+
+// do sends req and returns the decoded body and headers of a 200 response.
+// A 304 Not Modified response returns a nil body and no error. The caller
+// must close a non-nil body.
+func (p *Parser) do(req *http.Request) (io.ReadCloser, http.Header, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch playlist: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, resp.Header, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("failed to fetch playlist: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}, resp.Header, nil
+}
+
+// SourceURL returns the URL of a playlist source: source itself if it is a
+// URL, or else the file:// URL of the local path source. Relative URIs in a
+// local playlist then resolve to sibling files.
+func SourceURL(source string) (string, error) {
+	if strings.Contains(source, "://") {
+		return source, nil
+	}
+	return FileURL(source)
+}
+
+// FileURL converts a local filesystem path to an absolute file:// URL.
+func FileURL(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid playlist path: %w", err)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+// LocalPath returns the filesystem path of a file:// URL, and whether
+// playlistURL is one.
+func LocalPath(playlistURL string) (string, bool) {
+	u, err := url.Parse(playlistURL)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
 }
 
-// resolveURL resolves a possibly relative URL against a base URL.
+// resolveURL resolves a possibly relative URL against a base URL. An empty
+// base URL only accepts absolute URLs.
 func resolveURL(baseURL, relativeURL string) (string, error) {
+	if baseURL == "" {
+		u, err := url.Parse(relativeURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid relative URL: %w", err)
+		}
+		if !u.IsAbs() {
+			return "", fmt.Errorf("cannot resolve relative URL %q without a base URL", relativeURL)
+		}
+		return u.String(), nil
+	}
+
 	base, err := url.Parse(baseURL)
 	if err != nil {
 		return "", fmt.Errorf("invalid base URL: %w", err)
@@ -266,11 +710,7 @@ func resolveURL(baseURL, relativeURL string) (string, error) {
 
 // FetchContent fetches content from a URL (helper for testing).
 func FetchContent(url string) (io.ReadCloser, error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := client.Get(url)
+	resp, err := upstream.DefaultClient().Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -1,9 +1,18 @@
 package parser
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/agleyzer/encodersim/internal/upstream"
+	"github.com/agleyzer/encodersim/internal/variant"
 )
 
 func TestParsePlaylist_ValidPlaylist(t *testing.T) {
@@ -392,6 +401,19 @@ func TestResolveURL(t *testing.T) {
 			expected:    "http://example.com/segments/segment.ts",
 			shouldError: false,
 		},
+		{
+			name:        "absolute URL without base",
+			baseURL:     "",
+			relativeURL: "https://cdn.example.com/segment.ts",
+			expected:    "https://cdn.example.com/segment.ts",
+			shouldError: false,
+		},
+		{
+			name:        "relative path without base",
+			baseURL:     "",
+			relativeURL: "segment.ts",
+			shouldError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -409,3 +431,378 @@ func TestResolveURL(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_ReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	newConns := 0
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1280000\nlow.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2560000\nmid.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=5120000\nhigh.m3u8\n"))
+		default:
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nseg.ts\n#EXT-X-ENDLIST\n"))
+		}
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			newConns++
+			mu.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	p := New(Options{Client: upstream.NewClient(upstream.DefaultConfig())})
+	info, err := p.Parse(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(info.Variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(info.Variants))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if newConns != 1 {
+		t.Errorf("Expected 1 connection for master and variants, got %d", newConns)
+	}
+}
+
+func TestParsePlaylist_MediaSequenceOffset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:1000
+#EXTINF:10.0,
+seg1000.ts
+#EXTINF:10.0,
+seg1001.ts
+#EXT-X-ENDLIST
+`))
+	}))
+	defer server.Close()
+
+	info, err := ParsePlaylist(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if info.MediaSequence != 1000 {
+		t.Errorf("Expected media sequence 1000, got %d", info.MediaSequence)
+	}
+	for i, seg := range info.Segments {
+		if seg.Sequence != i {
+			t.Errorf("segment %d Sequence = %d, want %d", i, seg.Sequence, i)
+		}
+		if want := uint64(1000 + i); seg.SourceSequence != want {
+			t.Errorf("segment %d SourceSequence = %d, want %d", i, seg.SourceSequence, want)
+		}
+	}
+}
+
+func TestParsePlaylist_Version(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     int
+	}{
+		{"declared", "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nseg.ts\n#EXT-X-ENDLIST\n", 7},
+		{"undeclared", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\nseg.ts\n#EXT-X-ENDLIST\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := New(Options{}).ParseReader(strings.NewReader(tt.playlist), "https://example.com/")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if info.Version != tt.want {
+				t.Errorf("Version = %d, want %d", info.Version, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlaylist_NestedMasterPlaylists(t *testing.T) {
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nseg.ts\n#EXT-X-ENDLIST\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=500000\nlow.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=4000000\nhd/master.m3u8\n"))
+		case "/hd/master.m3u8":
+			w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720\n720.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=4000000,RESOLUTION=1920x1080\n1080.m3u8\n"))
+		case "/loop.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nloop.m3u8\n"))
+		default:
+			w.Write([]byte(media))
+		}
+	}))
+	defer server.Close()
+
+	info, err := ParsePlaylist(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(info.Variants) != 3 {
+		t.Fatalf("Expected 3 flattened variants, got %d", len(info.Variants))
+	}
+	wantURLs := []string{server.URL + "/low.m3u8", server.URL + "/hd/720.m3u8", server.URL + "/hd/1080.m3u8"}
+	for i, v := range info.Variants {
+		if v.PlaylistURL != wantURLs[i] {
+			t.Errorf("variant %d URL = %s, want %s", i, v.PlaylistURL, wantURLs[i])
+		}
+		if v.Segments[0].VariantIndex != i {
+			t.Errorf("variant %d segments have VariantIndex %d", i, v.Segments[0].VariantIndex)
+		}
+	}
+	if info.Variants[2].Resolution != "1920x1080" {
+		t.Errorf("Expected nested variant attributes to be kept, got %+v", info.Variants[2])
+	}
+
+	// A master that references itself must not recurse forever
+	if _, err := ParsePlaylist(server.URL + "/loop.m3u8"); err == nil {
+		t.Error("Expected error for self-referencing master playlist")
+	}
+}
+
+func TestParsePlaylist_Renditions(t *testing.T) {
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nseg.ts\n#EXT-X-ENDLIST\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte("#EXTM3U\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"English\",LANGUAGE=\"en\",DEFAULT=YES,AUTOSELECT=YES,URI=\"audio/en.m3u8\"\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"Main\",AUTOSELECT=NO\n" +
+				"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"Fran\u00e7ais\",LANGUAGE=\"fr\",FORCED=YES,URI=\"subs/fr.m3u8\"\n" +
+				"#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID=\"cc\",NAME=\"CC1\",INSTREAM-ID=\"CC1\"\n" +
+				"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"unused\",NAME=\"Unused\",URI=\"audio/unused.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=500000,AUDIO=\"aac\",SUBTITLES=\"subs\",CLOSED-CAPTIONS=\"cc\"\nlow.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000000,AUDIO=\"aac\"\nhigh.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=2000000,AUDIO=\"missing\"\nhd.m3u8\n"))
+		case "/audio/unused.m3u8":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(media))
+		}
+	}))
+	defer server.Close()
+
+	info, err := ParsePlaylist(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []variant.Rendition{
+		{Type: "AUDIO", GroupID: "aac", Name: "English", Language: "en", Default: true, Autoselect: true},
+		{Type: "AUDIO", GroupID: "aac", Name: "Main"},
+		{Type: "SUBTITLES", GroupID: "subs", Name: "Fran\u00e7ais", Language: "fr", Forced: true},
+	}
+	wantURLs := []string{server.URL + "/audio/en.m3u8", "", server.URL + "/subs/fr.m3u8"}
+	if len(info.Renditions) != len(want) {
+		t.Fatalf("Expected %d renditions, got %+v", len(want), info.Renditions)
+	}
+	for i, r := range info.Renditions {
+		if r.Media.PlaylistURL != wantURLs[i] {
+			t.Errorf("rendition %d URL = %q, want %q", i, r.Media.PlaylistURL, wantURLs[i])
+		}
+		if r.HasMedia() && len(r.Media.Segments) != 1 {
+			t.Errorf("rendition %d has %d segments, want 1", i, len(r.Media.Segments))
+		}
+		r.Media = variant.Variant{}
+		if !reflect.DeepEqual(r, want[i]) {
+			t.Errorf("rendition %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	groups := [][2]string{{"aac", "subs"}, {"aac", ""}, {"", ""}}
+	for i, v := range info.Variants {
+		if got := [2]string{v.Audio, v.Subtitles}; got != groups[i] {
+			t.Errorf("variant %d groups = %v, want %v", i, got, groups[i])
+		}
+	}
+}
+
+func TestParsePlaylist_MapChanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="init-a.mp4"
+#EXTINF:4.0,
+a1.m4s
+#EXTINF:4.0,
+a2.m4s
+#EXT-X-MAP:URI="combined.mp4",BYTERANGE="720@0"
+#EXTINF:4.0,
+b1.m4s
+#EXT-X-ENDLIST
+`))
+	}))
+	defer server.Close()
+
+	info, err := ParsePlaylist(server.URL + "/media.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := []struct{ url, byteRange string }{
+		{server.URL + "/init-a.mp4", ""},
+		{server.URL + "/init-a.mp4", ""},
+		{server.URL + "/combined.mp4", "720@0"},
+	}
+	for i, seg := range info.Segments {
+		if seg.InitURL != want[i].url || seg.InitByteRange != want[i].byteRange {
+			t.Errorf("segment %d init = %q %q, want %q %q", i, seg.InitURL, seg.InitByteRange, want[i].url, want[i].byteRange)
+		}
+	}
+}
+
+func TestParsePlaylist_ByteRanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.0,
+#EXT-X-BYTERANGE:1000@0
+main.ts
+#EXTINF:4.0,
+#EXT-X-BYTERANGE:1200
+main.ts
+#EXTINF:4.0,
+#EXT-X-BYTERANGE:800@5000
+main.ts
+#EXTINF:4.0,
+#EXT-X-BYTERANGE:500@0
+main.ts
+#EXTINF:4.0,
+#EXT-X-BYTERANGE:300
+main.ts
+#EXTINF:4.0,
+other.ts
+#EXT-X-ENDLIST
+`))
+	}))
+	defer server.Close()
+
+	info, err := ParsePlaylist(server.URL + "/media.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// An explicit @0 restarts the resource rather than continuing it
+	want := []string{"1000@0", "1200@1000", "800@5000", "500@0", "300@500", ""}
+	if len(info.Segments) != len(want) {
+		t.Fatalf("Expected %d segments, got %d", len(want), len(info.Segments))
+	}
+	for i, seg := range info.Segments {
+		if seg.ByteRange != want[i] {
+			t.Errorf("segment %d byte range = %q, want %q", i, seg.ByteRange, want[i])
+		}
+	}
+}
+
+func TestParser_ParseReader(t *testing.T) {
+	const body = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+segment0.ts
+#EXTINF:10.0,
+https://other.example.com/segment1.ts
+#EXT-X-ENDLIST
+`
+
+	info, err := New(Options{}).ParseReader(strings.NewReader(body), "https://cdn.example.com/vod/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(info.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(info.Segments))
+	}
+	if info.Segments[0].URL != "https://cdn.example.com/vod/segment0.ts" {
+		t.Errorf("Expected relative URL resolved against base, got %s", info.Segments[0].URL)
+	}
+	if info.Segments[1].URL != "https://other.example.com/segment1.ts" {
+		t.Errorf("Expected absolute URL kept, got %s", info.Segments[1].URL)
+	}
+
+	// Without a base URL, relative segments cannot be resolved
+	if _, err := New(Options{}).ParseReader(strings.NewReader(body), ""); err == nil {
+		t.Error("Expected error for relative URIs without a base URL")
+	}
+}
+
+func TestSourceURL(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"https://example.com/master.m3u8", "https://example.com/master.m3u8"},
+		{"file:///fixtures/master.m3u8", "file:///fixtures/master.m3u8"},
+		{"/fixtures/master.m3u8", "file:///fixtures/master.m3u8"},
+		{"fixtures/master.m3u8", "file://" + filepath.ToSlash(filepath.Join(wd, "fixtures", "master.m3u8"))},
+	}
+	for _, tt := range tests {
+		if got, err := SourceURL(tt.source); err != nil || got != tt.want {
+			t.Errorf("SourceURL(%q) = %q, %v, want %q", tt.source, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePlaylist_LocalFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("master.m3u8", "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\nlow.m3u8\n")
+	writeFile("low.m3u8", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nhttps://cdn.example.com/seg.ts\n#EXT-X-ENDLIST\n")
+
+	masterURL, err := FileURL(filepath.Join(dir, "master.m3u8"))
+	if err != nil {
+		t.Fatalf("FileURL() error = %v", err)
+	}
+	if path, ok := LocalPath(masterURL); !ok || path != filepath.Join(dir, "master.m3u8") {
+		t.Errorf("LocalPath(%q) = %q, %v", masterURL, path, ok)
+	}
+
+	// Relative variant URIs resolve to sibling files
+	info, err := ParsePlaylist(masterURL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(info.Variants) != 1 || info.Variants[0].Segments[0].URL != "https://cdn.example.com/seg.ts" {
+		t.Errorf("Unexpected variants: %+v", info.Variants)
+	}
+
+	if _, err := ParsePlaylist(masterURL + ".missing"); err == nil {
+		t.Error("Expected error for missing file")
+	}
+
+	// Plain paths work too, and relative segments resolve to sibling files
+	writeFile("fixture.m3u8", "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nsegments/seg0.ts\n#EXT-X-ENDLIST\n")
+	info, err = ParsePlaylist(filepath.Join(dir, "fixture.m3u8"))
+	if err != nil {
+		t.Fatalf("ParsePlaylist() of a path error = %v", err)
+	}
+	want, _ := FileURL(filepath.Join(dir, "segments", "seg0.ts"))
+	if len(info.Segments) != 1 || info.Segments[0].URL != want {
+		t.Errorf("Segments = %+v, want %s", info.Segments, want)
+	}
+	if _, ok := LocalPath("https://example.com/playlist.m3u8"); ok {
+		t.Error("Expected HTTP URL not to be local")
+	}
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// TagAllowlist selects custom tags to pass through from the source to the
+// generated playlists. Entries are tag names such as "EXT-X-CUSTOM" (the
+// leading '#' is optional); an entry ending in '*' matches by prefix, and "*"
+// alone matches every tag not defined by the HLS specification.
+type TagAllowlist []string
+
+// ParseTagAllowlist parses a comma-separated allowlist.
+func ParseTagAllowlist(s string) (TagAllowlist, error) {
+	var list TagAllowlist
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), "#")
+		if entry == "" {
+			continue
+		}
+		if entry != "*" && !strings.HasPrefix(entry, "EXT") {
+			return nil, fmt.Errorf("invalid tag %q: tags must start with EXT", entry)
+		}
+		list = append(list, "#"+entry)
+	}
+	return list, nil
+}
+
+// allows reports whether tag (including the leading '#') is passed through.
+// Tags defined by the HLS specification are never passed through because the
+// generator writes its own.
+func (a TagAllowlist) allows(tag string) bool {
+	if knownTags[tag] {
+		return false
+	}
+	for _, entry := range a {
+		if entry == "#*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(tag, prefix) {
+				return true
+			}
+		} else if tag == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// passthroughTags holds the allowed custom tags found in a media playlist.
+type passthroughTags struct {
+	// header holds tag lines that appear before the first segment.
+	header []string
+	// segments holds, for each segment in order, the newline-terminated tag
+	// lines that precede its URI.
+	segments []string
+}
+
+// extractTags finds allowed custom tags in raw media playlist text. Tags that
+// appear before any segment's #EXTINF belong to the header; later tags are
+// attached to the next segment. Tags after the last segment are dropped.
+func extractTags(data []byte, allow TagAllowlist) passthroughTags {
+	var (
+		result  passthroughTags
+		pending strings.Builder
+		inBody  bool
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF"):
+			inBody = true
+		case strings.HasPrefix(line, "#EXT"):
+			if !allow.allows(tagName(line)) {
+				continue
+			}
+			if inBody {
+				pending.WriteString(line)
+				pending.WriteByte('\n')
+			} else {
+				result.header = append(result.header, line)
+			}
+		case strings.HasPrefix(line, "#"):
+			// Comment
+		default:
+			// Segment URI
+			result.segments = append(result.segments, pending.String())
+			pending.Reset()
+			inBody = true
+		}
+	}
+
+	return result
+}
+
+// applySegmentTags attaches passed-through tags to segments in order.
+func applySegmentTags(segments []segment.Segment, tags []string) {
+	for i := range segments {
+		if i < len(tags) {
+			segments[i].Tags = tags[i]
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTagAllowlist(t *testing.T) {
+	tests := []struct {
+		spec    string
+		tag     string
+		want    bool
+		wantErr bool
+	}{
+		{spec: "EXT-X-CUSTOM", tag: "#EXT-X-CUSTOM", want: true},
+		{spec: "#EXT-X-CUSTOM", tag: "#EXT-X-CUSTOM", want: true},
+		{spec: "EXT-X-CUSTOM", tag: "#EXT-X-CUSTOM-2", want: false},
+		{spec: "EXT-X-AD-*", tag: "#EXT-X-AD-START", want: true},
+		{spec: "*", tag: "#EXT-X-ANYTHING", want: true},
+		{spec: "*", tag: "#EXTINF", want: false},
+		{spec: "EXT-X-KEY", tag: "#EXT-X-KEY", want: false},
+		{spec: "", tag: "#EXT-X-CUSTOM", want: false},
+		{spec: "CUSTOM", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+"/"+tt.tag, func(t *testing.T) {
+			allow, err := ParseTagAllowlist(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTagAllowlist(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && allow.allows(tt.tag) != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.tag, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_PassthroughTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-CUSTOM-CHANNEL:news
+#EXT-X-PRIVATE:dropped
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-CUSTOM-AD:id=42
+#EXT-X-CUSTOM-AD:id=43
+#EXTINF:10.0,
+seg1.ts
+#EXTINF:10.0,
+seg2.ts
+#EXT-X-ENDLIST
+`))
+	}))
+	defer server.Close()
+
+	info, err := New(Options{
+		Mode:            ModeStrict,
+		PassthroughTags: TagAllowlist{"#EXT-X-CUSTOM-*", "#EXT-X-PRIVATE"},
+	}).Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(info.HeaderTags) != 2 || info.HeaderTags[0] != "#EXT-X-CUSTOM-CHANNEL:news" {
+		t.Errorf("HeaderTags = %q, want custom channel and private tags", info.HeaderTags)
+	}
+
+	wantTags := []string{"", "#EXT-X-CUSTOM-AD:id=42\n#EXT-X-CUSTOM-AD:id=43\n", ""}
+	for i, seg := range info.Segments {
+		if seg.Tags != wantTags[i] {
+			t.Errorf("segment %d Tags = %q, want %q", i, seg.Tags, wantTags[i])
+		}
+	}
+
+	// Without an allowlist the same source is rejected in strict mode
+	if _, err := New(Options{Mode: ModeStrict}).Parse(server.URL); err == nil {
+		t.Error("Expected strict mode to reject unknown tags without an allowlist")
+	}
+}
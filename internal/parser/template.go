@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateMode selects how playlist text is expanded before it is parsed.
+type TemplateMode string
+
+const (
+	// TemplateNone parses playlist text as fetched.
+	TemplateNone TemplateMode = "none"
+
+	// TemplateEnv substitutes ${NAME} references with template variables,
+	// falling back to environment variables. Bare $NAME is left alone so
+	// that dollar signs in URLs are not mangled.
+	TemplateEnv TemplateMode = "env"
+
+	// TemplateGo executes the playlist text as a Go text/template. Template
+	// variables are available as {{.NAME}} and environment variables
+	// through {{env "NAME"}}.
+	TemplateGo TemplateMode = "go"
+)
+
+// ParseTemplateMode parses a template mode name. An empty name selects
+// TemplateNone.
+func ParseTemplateMode(s string) (TemplateMode, error) {
+	switch TemplateMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", TemplateNone:
+		return TemplateNone, nil
+	case TemplateEnv:
+		return TemplateEnv, nil
+	case TemplateGo:
+		return TemplateGo, nil
+	default:
+		return "", fmt.Errorf("unknown template mode %q (expected none, env or go)", s)
+	}
+}
+
+// ParseTemplateVars parses comma-separated NAME=VALUE pairs.
+func ParseTemplateVars(s string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !templateVarName.MatchString(name) {
+			return nil, fmt.Errorf("invalid template variable %q (expected NAME=VALUE)", pair)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// Template expands playlist text before parsing, so one parameterized fixture
+// can serve several environments. The zero value leaves text unchanged.
+type Template struct {
+	// Mode selects the expansion syntax.
+	Mode TemplateMode
+
+	// Vars holds template variables. They take precedence over environment
+	// variables of the same name.
+	Vars map[string]string
+}
+
+var (
+	templateVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envReference    = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// expand applies the template to the playlist text fetched from name.
+// References to undefined variables are errors, so typos fail loudly instead
+// of producing broken URLs.
+func (t Template) expand(name string, data []byte) ([]byte, error) {
+	switch t.Mode {
+	case "", TemplateNone:
+		return data, nil
+	case TemplateEnv:
+		return t.expandEnv(name, data)
+	case TemplateGo:
+		return t.expandGo(name, data)
+	default:
+		return nil, fmt.Errorf("unknown template mode %q", t.Mode)
+	}
+}
+
+// lookup resolves a variable from Vars, then the environment.
+func (t Template) lookup(key string) (string, bool) {
+	if v, ok := t.Vars[key]; ok {
+		return v, true
+	}
+	return os.LookupEnv(key)
+}
+
+func (t Template) expandEnv(name string, data []byte) ([]byte, error) {
+	missing := make(map[string]bool)
+	out := envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		key := string(ref[2 : len(ref)-1])
+		v, ok := t.lookup(key)
+		if !ok {
+			missing[key] = true
+			return ref
+		}
+		return []byte(v)
+	})
+
+	if len(missing) > 0 {
+		keys := make([]string, 0, len(missing))
+		for k := range missing {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("template %s: undefined variables: %s", name, strings.Join(keys, ", "))
+	}
+	return out, nil
+}
+
+func (t Template) expandGo(name string, data []byte) ([]byte, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"env": func(key string) (string, error) {
+				if v, ok := os.LookupEnv(key); ok {
+					return v, nil
+				}
+				return "", fmt.Errorf("environment variable %s is not set", key)
+			},
+		}).
+		Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+
+	vars := t.Vars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTemplateVars(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "HOST=cdn.example.com, TOKEN=a=b", want: map[string]string{"HOST": "cdn.example.com", "TOKEN": "a=b"}},
+		{in: "EMPTY=", want: map[string]string{"EMPTY": ""}},
+		{in: "HOST", wantErr: true},
+		{in: "1HOST=x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTemplateVars(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTemplateVars(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseTemplateVars(%q) = %v, want %v", tt.in, got, tt.want)
+			continue
+		}
+		for k, v := range tt.want {
+			if got[k] != v {
+				t.Errorf("ParseTemplateVars(%q)[%s] = %q, want %q", tt.in, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestTemplate_Expand(t *testing.T) {
+	t.Setenv("ENCODERSIM_TEST_HOST", "env.example.com")
+
+	vars := map[string]string{"TOKEN": "abc", "ENCODERSIM_TEST_HOST": "vars.example.com"}
+	tests := []struct {
+		name    string
+		tmpl    Template
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "none", tmpl: Template{}, in: "https://${HOST}/a.ts", want: "https://${HOST}/a.ts"},
+		{name: "env from environment", tmpl: Template{Mode: TemplateEnv}, in: "https://${ENCODERSIM_TEST_HOST}/a.ts", want: "https://env.example.com/a.ts"},
+		{name: "env vars take precedence", tmpl: Template{Mode: TemplateEnv, Vars: vars}, in: "https://${ENCODERSIM_TEST_HOST}/a.ts?t=${TOKEN}", want: "https://vars.example.com/a.ts?t=abc"},
+		{name: "env leaves bare dollar", tmpl: Template{Mode: TemplateEnv}, in: "a.ts?sig=$TOKEN", want: "a.ts?sig=$TOKEN"},
+		{name: "env undefined", tmpl: Template{Mode: TemplateEnv}, in: "${ENCODERSIM_TEST_UNDEFINED}", wantErr: true},
+		{name: "go vars", tmpl: Template{Mode: TemplateGo, Vars: vars}, in: "a.ts?t={{.TOKEN}}", want: "a.ts?t=abc"},
+		{name: "go env", tmpl: Template{Mode: TemplateGo}, in: `https://{{env "ENCODERSIM_TEST_HOST"}}/a.ts`, want: "https://env.example.com/a.ts"},
+		{name: "go missing var", tmpl: Template{Mode: TemplateGo}, in: "{{.TOKEN}}", wantErr: true},
+		{name: "go syntax error", tmpl: Template{Mode: TemplateGo}, in: "{{.TOKEN", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.tmpl.expand("test.m3u8", []byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_TemplateAppliesToVariants(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\n${VARIANT}.m3u8\n"))
+		case "/low.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6.0,\nhttps://${CDN}/seg.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p := New(Options{Template: Template{
+		Mode: TemplateEnv,
+		Vars: map[string]string{"VARIANT": "low", "CDN": "cdn.example.com"},
+	}})
+	info, err := p.Parse(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if got := info.Variants[0].Segments[0].URL; got != "https://cdn.example.com/seg.ts" {
+		t.Errorf("Expected templated segment URL, got %s", got)
+	}
+}
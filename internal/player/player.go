@@ -0,0 +1,391 @@
+// Package player implements a headless HLS client that plays encodersim's
+// own output the way a player would and reports anomalies: playlists that
+// stop updating, media sequences that move backwards, segments whose URI
+// changes under the same sequence number, unavailable segments and
+// EXT-X-PROGRAM-DATE-TIME values that do not follow the segment durations.
+// It gives a self-monitoring signal even when no external player is
+// attached.
+package player
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/events"
+)
+
+// UserAgent identifies the probe's requests, so the server can tell them
+// apart from real players.
+const UserAgent = "encodersim-player-probe"
+
+// Anomaly kinds, reported as the kind label of
+// encodersim_player_anomalies_total.
+const (
+	KindPlaylistError      = "playlist_error"
+	KindStalePlaylist      = "stale_playlist"
+	KindSequenceRegressed  = "sequence_regressed"
+	KindSegmentChanged     = "segment_changed"
+	KindSegmentUnavailable = "segment_unavailable"
+	KindPDTMismatch        = "pdt_mismatch"
+)
+
+// Kinds lists every anomaly kind.
+var Kinds = []string{
+	KindPlaylistError,
+	KindStalePlaylist,
+	KindSequenceRegressed,
+	KindSegmentChanged,
+	KindSegmentUnavailable,
+	KindPDTMismatch,
+}
+
+// EventAnomaly is the type of the events published for anomalies.
+const EventAnomaly = "player_anomaly"
+
+const (
+	// staleFactor is how many target durations a playlist's media sequence
+	// may stay unchanged before it is reported stale.
+	staleFactor = 1.5
+
+	// pdtTolerance is how far an EXT-X-PROGRAM-DATE-TIME may deviate from
+	// the previous segment's date plus its duration.
+	pdtTolerance = 50 * time.Millisecond
+
+	// initialInterval is the reload interval until a playlist's target
+	// duration is known.
+	initialInterval = time.Second
+)
+
+// Options configures a Probe.
+type Options struct {
+	// URLs are the media playlists to play, typically one per variant.
+	URLs []string
+
+	// Client fetches playlists. If nil, a client with a 5-second timeout
+	// is used.
+	Client *http.Client
+
+	// CheckSegments sends a HEAD request for every segment that enters a
+	// window, using SegmentClient (Client if nil). Segments that are not
+	// served over HTTP are skipped.
+	CheckSegments bool
+	SegmentClient *http.Client
+
+	// Events, if set, receives an EventAnomaly event for every anomaly.
+	Events *events.Log
+}
+
+// Probe plays media playlists and counts the anomalies it sees. It is safe
+// for concurrent use.
+type Probe struct {
+	opts   Options
+	logger *slog.Logger
+
+	mu            sync.Mutex
+	fetches       uint64
+	segmentChecks uint64
+	anomalies     map[string]uint64
+}
+
+// New creates a Probe.
+func New(opts Options, logger *slog.Logger) *Probe {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	if opts.SegmentClient == nil {
+		opts.SegmentClient = opts.Client
+	}
+	return &Probe{
+		opts:      opts,
+		logger:    logger,
+		anomalies: make(map[string]uint64),
+	}
+}
+
+// Run plays every URL until ctx is cancelled.
+func (p *Probe) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, u := range p.opts.URLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.play(ctx, &session{index: i, url: u})
+		}()
+	}
+	wg.Wait()
+}
+
+// Stats returns the number of playlist fetches, segment checks and
+// anomalies by kind.
+func (p *Probe) Stats() map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	anomalies := make(map[string]uint64, len(Kinds))
+	for _, kind := range Kinds {
+		anomalies[kind] = p.anomalies[kind]
+	}
+	return map[string]any{
+		"playlists_fetched": p.fetches,
+		"segments_checked":  p.segmentChecks,
+		"anomalies":         anomalies,
+	}
+}
+
+// session is the playback state of one playlist.
+type session struct {
+	index int
+	url   string
+
+	started       bool
+	sequence      uint64            // media sequence of the last fetch
+	changed       time.Time         // when the media sequence last changed
+	staleReported bool              // the current stall was reported
+	uris          map[uint64]string // segment URIs of the last fetch
+	next          uint64            // first sequence not yet checked
+}
+
+// play reloads the session's playlist, like a player, until ctx is
+// cancelled. It reloads every half target duration, which a player does
+// when the playlist has not changed.
+func (p *Probe) play(ctx context.Context, s *session) {
+	interval := initialInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		pl, err := p.fetchPlaylist(ctx, s.url)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.report(s, KindPlaylistError, err.Error())
+		} else {
+			p.check(ctx, s, pl, time.Now())
+			if pl.targetDuration > 0 {
+				interval = pl.targetDuration / 2
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// check compares a fetched playlist with the previous fetch and checks the
+// segments that are new since then.
+func (p *Probe) check(ctx context.Context, s *session, pl *mediaPlaylist, now time.Time) {
+	switch {
+	case !s.started:
+		s.started = true
+		s.changed = now
+	case pl.sequence < s.sequence:
+		p.report(s, KindSequenceRegressed, fmt.Sprintf("media sequence went from %d to %d", s.sequence, pl.sequence))
+		s.changed = now
+		s.uris = nil
+		s.next = 0
+	case pl.sequence == s.sequence:
+		limit := time.Duration(staleFactor * float64(pl.targetDuration))
+		if stale := now.Sub(s.changed); limit > 0 && stale > limit && !s.staleReported {
+			p.report(s, KindStalePlaylist, fmt.Sprintf("media sequence %d unchanged for %s", pl.sequence, stale.Round(time.Millisecond)))
+			s.staleReported = true
+		}
+	default:
+		s.changed = now
+		s.staleReported = false
+	}
+	s.sequence = pl.sequence
+
+	uris := make(map[uint64]string, len(pl.segments))
+	for i, seg := range pl.segments {
+		uris[seg.sequence] = seg.uri
+		if prev, ok := s.uris[seg.sequence]; ok && prev != seg.uri {
+			p.report(s, KindSegmentChanged, fmt.Sprintf("segment %d changed from %s to %s", seg.sequence, prev, seg.uri))
+		}
+		if seg.sequence < s.next {
+			continue
+		}
+
+		if i > 0 && !seg.discontinuity {
+			prev := pl.segments[i-1]
+			if !prev.pdt.IsZero() && !seg.pdt.IsZero() {
+				want := prev.pdt.Add(prev.duration)
+				if diff := seg.pdt.Sub(want); diff > pdtTolerance || diff < -pdtTolerance {
+					p.report(s, KindPDTMismatch, fmt.Sprintf("segment %d starts at %s, want %s", seg.sequence,
+						seg.pdt.Format(time.RFC3339Nano), want.Format(time.RFC3339Nano)))
+				}
+			}
+		}
+		if p.opts.CheckSegments {
+			p.checkSegment(ctx, s, seg)
+		}
+	}
+	s.uris = uris
+	if n := len(pl.segments); n > 0 {
+		s.next = pl.segments[n-1].sequence + 1
+	}
+}
+
+// checkSegment sends a HEAD request for an HTTP segment.
+func (p *Probe) checkSegment(ctx context.Context, s *session, seg segmentInfo) {
+	if !strings.HasPrefix(seg.uri, "http://") && !strings.HasPrefix(seg.uri, "https://") {
+		return
+	}
+
+	p.mu.Lock()
+	p.segmentChecks++
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, seg.uri, nil)
+	if err != nil {
+		p.report(s, KindSegmentUnavailable, err.Error())
+		return
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := p.opts.SegmentClient.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.report(s, KindSegmentUnavailable, fmt.Sprintf("segment %d: %v", seg.sequence, err))
+		}
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		p.report(s, KindSegmentUnavailable, fmt.Sprintf("segment %d: %s returned status %d", seg.sequence, seg.uri, resp.StatusCode))
+	}
+}
+
+// report counts an anomaly, logs it and publishes it as an event.
+func (p *Probe) report(s *session, kind, detail string) {
+	p.mu.Lock()
+	p.anomalies[kind]++
+	p.mu.Unlock()
+
+	p.logger.Warn("player probe anomaly", "variant", s.index, "kind", kind, "detail", detail)
+	if p.opts.Events != nil {
+		p.opts.Events.Publish(EventAnomaly, detail, map[string]any{
+			"variant": s.index,
+			"kind":    kind,
+			"url":     s.url,
+		})
+	}
+}
+
+// fetchPlaylist fetches and parses a media playlist.
+func (p *Probe) fetchPlaylist(ctx context.Context, rawURL string) (*mediaPlaylist, error) {
+	p.mu.Lock()
+	p.fetches++
+	p.mu.Unlock()
+
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("playlist returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read playlist: %w", err)
+	}
+	return parseMediaPlaylist(body, base)
+}
+
+// mediaPlaylist is the part of a media playlist the probe checks.
+type mediaPlaylist struct {
+	targetDuration time.Duration
+	sequence       uint64
+	segments       []segmentInfo
+}
+
+// segmentInfo is one segment of a mediaPlaylist.
+type segmentInfo struct {
+	sequence      uint64
+	uri           string // resolved against the playlist URL
+	duration      time.Duration
+	discontinuity bool      // preceded by EXT-X-DISCONTINUITY
+	pdt           time.Time // zero without EXT-X-PROGRAM-DATE-TIME
+}
+
+// parseMediaPlaylist parses a media playlist, resolving segment URIs
+// against base.
+func parseMediaPlaylist(data []byte, base *url.URL) (*mediaPlaylist, error) {
+	if !bytes.HasPrefix(data, []byte("#EXTM3U")) {
+		return nil, fmt.Errorf("playlist does not start with #EXTM3U")
+	}
+
+	pl := &mediaPlaylist{}
+	var next segmentInfo
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		tag, value, _ := strings.Cut(line, ":")
+		switch {
+		case line == "":
+		case tag == "#EXT-X-TARGETDURATION":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid target duration %q", value)
+			}
+			pl.targetDuration = time.Duration(n) * time.Second
+		case tag == "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid media sequence %q", value)
+			}
+			pl.sequence = n
+		case tag == "#EXTINF":
+			secs, _, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(secs, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q", secs)
+			}
+			next.duration = time.Duration(d * float64(time.Second))
+		case line == "#EXT-X-DISCONTINUITY":
+			next.discontinuity = true
+		case tag == "#EXT-X-PROGRAM-DATE-TIME":
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid program date time %q", value)
+			}
+			next.pdt = t
+		case strings.HasPrefix(line, "#"):
+		default:
+			ref, err := url.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment URI %q", line)
+			}
+			next.uri = base.ResolveReference(ref).String()
+			next.sequence = pl.sequence + uint64(len(pl.segments))
+			pl.segments = append(pl.segments, next)
+			next = segmentInfo{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
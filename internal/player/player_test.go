@@ -0,0 +1,179 @@
+package player
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/events"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// playlistText renders a media playlist with a 6-second target duration.
+// Segment lines are given as "uri" or "tag\nuri".
+func playlistText(sequence int, segments ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:%d\n", sequence)
+	for _, seg := range segments {
+		tags, uri, ok := strings.Cut(seg, "\n")
+		if !ok {
+			tags, uri = "", seg
+		}
+		if tags != "" {
+			b.WriteString(tags + "\n")
+		}
+		b.WriteString("#EXTINF:6.000,\n" + uri + "\n")
+	}
+	return b.String()
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	base, _ := url.Parse("http://origin.test/live/playlist.m3u8")
+	pl, err := parseMediaPlaylist([]byte(playlistText(7,
+		"seg7.ts",
+		"#EXT-X-DISCONTINUITY\n#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:00.000Z\nhttps://cdn.test/seg0.ts",
+	)), base)
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist() error = %v", err)
+	}
+	if pl.targetDuration != 6*time.Second || pl.sequence != 7 || len(pl.segments) != 2 {
+		t.Fatalf("parseMediaPlaylist() = %+v", pl)
+	}
+	if got := pl.segments[0]; got.uri != "http://origin.test/live/seg7.ts" || got.sequence != 7 || got.duration != 6*time.Second {
+		t.Errorf("segment 0 = %+v", got)
+	}
+	if got := pl.segments[1]; !got.discontinuity || got.pdt.IsZero() || got.sequence != 8 {
+		t.Errorf("segment 1 = %+v", got)
+	}
+
+	if _, err := parseMediaPlaylist([]byte("<html>"), base); err == nil {
+		t.Error("parseMediaPlaylist() of a non-playlist: expected error")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	pdt := func(s string) string { return "#EXT-X-PROGRAM-DATE-TIME:2026-01-01T00:00:" + s + "Z" }
+
+	tests := []struct {
+		name      string
+		playlists []string      // fetched in order
+		gap       time.Duration // between fetches
+		want      map[string]uint64
+	}{
+		{
+			name:      "advancing",
+			playlists: []string{playlistText(0, "a.ts", "b.ts"), playlistText(1, "b.ts", "c.ts")},
+			gap:       3 * time.Second,
+			want:      map[string]uint64{},
+		},
+		{
+			name:      "stale",
+			playlists: []string{playlistText(0, "a.ts"), playlistText(0, "a.ts"), playlistText(0, "a.ts"), playlistText(0, "a.ts"), playlistText(0, "a.ts")},
+			gap:       3 * time.Second,
+			want:      map[string]uint64{KindStalePlaylist: 1},
+		},
+		{
+			name:      "regressed",
+			playlists: []string{playlistText(5, "a.ts"), playlistText(2, "b.ts")},
+			gap:       3 * time.Second,
+			want:      map[string]uint64{KindSequenceRegressed: 1},
+		},
+		{
+			name:      "segment changed",
+			playlists: []string{playlistText(0, "a.ts", "b.ts"), playlistText(1, "x.ts", "c.ts")},
+			gap:       3 * time.Second,
+			want:      map[string]uint64{KindSegmentChanged: 1},
+		},
+		{
+			name:      "pdt continuous",
+			playlists: []string{playlistText(0, pdt("00.000")+"\na.ts", pdt("06.000")+"\nb.ts")},
+			want:      map[string]uint64{},
+		},
+		{
+			name:      "pdt reset at discontinuity",
+			playlists: []string{playlistText(0, pdt("30.000")+"\na.ts", "#EXT-X-DISCONTINUITY\n"+pdt("00.000")+"\nb.ts")},
+			want:      map[string]uint64{},
+		},
+		{
+			name: "pdt jump reported once",
+			playlists: []string{
+				playlistText(0, pdt("00.000")+"\na.ts", pdt("09.000")+"\nb.ts"),
+				playlistText(1, pdt("09.000")+"\nb.ts", pdt("15.000")+"\nc.ts"),
+			},
+			gap:  3 * time.Second,
+			want: map[string]uint64{KindPDTMismatch: 1},
+		},
+	}
+
+	base, _ := url.Parse("http://origin.test/playlist.m3u8")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(Options{}, testLogger())
+			s := &session{url: base.String()}
+			now := time.Unix(1000, 0)
+			for _, text := range tt.playlists {
+				pl, err := parseMediaPlaylist([]byte(text), base)
+				if err != nil {
+					t.Fatalf("parseMediaPlaylist() error = %v", err)
+				}
+				p.check(context.Background(), s, pl, now)
+				now = now.Add(tt.gap)
+			}
+
+			got := p.Stats()["anomalies"].(map[string]uint64)
+			for _, kind := range Kinds {
+				if got[kind] != tt.want[kind] {
+					t.Errorf("%s anomalies = %d, want %d", kind, got[kind], tt.want[kind])
+				}
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	var sequence atomic.Int64
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.ts" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != UserAgent {
+			t.Errorf("User-Agent = %q, want %q", r.UserAgent(), UserAgent)
+		}
+		n := sequence.Add(1)
+		io.WriteString(w, playlistText(int(n), origin.URL+"/ok.ts", origin.URL+"/missing.ts"))
+	}))
+	defer live.Close()
+
+	log := events.NewLog(0)
+	p := New(Options{URLs: []string{live.URL}, CheckSegments: true, Events: log}, testLogger())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+
+	stats := p.Stats()
+	if fetched := stats["playlists_fetched"].(uint64); fetched == 0 {
+		t.Fatal("probe fetched no playlists")
+	}
+	if got := stats["anomalies"].(map[string]uint64)[KindSegmentUnavailable]; got == 0 {
+		t.Error("missing segment was not reported")
+	}
+	list, _ := log.Since(0)
+	if len(list) == 0 || list[0].Type != EventAnomaly || list[0].Fields["kind"] != KindSegmentUnavailable {
+		t.Errorf("events = %+v, want a %s anomaly", list, KindSegmentUnavailable)
+	}
+}
@@ -0,0 +1,134 @@
+package playlist
+
+import (
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/cluster"
+)
+
+// Retry policy for the Raft apply of a window advance. The retries finish
+// well within one advance interval.
+const (
+	advanceApplyAttempts = 3
+	advanceRetryBackoff  = 100 * time.Millisecond // doubled after each attempt
+)
+
+// windowAdvancer is the part of cluster.Manager used to advance the window.
+type windowAdvancer interface {
+	IsLeader() bool
+	AdvanceWindowBy(steps int) error
+	ForwardAdvanceWindowBy(steps int) error
+}
+
+// clusterAdvance tracks how cluster window advances fared, so the cluster
+// timeline does not silently fall behind real time.
+type clusterAdvance struct {
+	applying sync.Mutex // serializes advances, including their retries
+
+	mu          sync.Mutex // guards the fields below
+	owed        int        // failed advances to apply with the next one
+	applyErrors uint64     // failed apply attempts, including retried ones
+	dropped     uint64     // advances given up after losing leadership
+	caughtUp    uint64     // advances applied late as part of a catch-up
+	forwarded   uint64     // advances requested on a follower and forwarded
+}
+
+// advanceCluster advances the cluster window through mgr. Only the leader
+// runs the advance ticker, so an advance on a follower was requested
+// explicitly and is forwarded to the leader, once. Failed applies are
+// retried with backoff. Advances that still fail are owed and applied
+// together with the next advance, in a single log entry, so the window
+// catches up once Raft recovers. When leadership is
+// lost, owed advances are dropped instead: the new leader advances on its own
+// schedule, and a command that failed with a leadership error may already
+// have been committed.
+func (p *Playlist) advanceCluster(mgr windowAdvancer) {
+	ca := &p.clusterAdvance
+	ca.applying.Lock()
+	defer ca.applying.Unlock()
+
+	ca.mu.Lock()
+	owed := ca.owed
+	ca.mu.Unlock()
+
+	if !mgr.IsLeader() {
+		if owed > 0 {
+			p.logger.Warn("dropping owed window advances, no longer leader", "advances", owed)
+			ca.settle(0, uint64(owed), 0)
+		}
+		if err := mgr.ForwardAdvanceWindowBy(1); err != nil {
+			p.logger.Warn("failed to forward window advance to the leader", "error", err)
+			ca.mu.Lock()
+			ca.applyErrors++
+			ca.mu.Unlock()
+			return
+		}
+		ca.mu.Lock()
+		ca.forwarded++
+		ca.mu.Unlock()
+		p.watchdog.advanced()
+		return
+	}
+
+	steps := owed + 1
+	backoff := advanceRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := mgr.AdvanceWindowBy(steps)
+		if err == nil {
+			if steps > 1 {
+				p.logger.Info("caught up on missed window advances", "advances", steps-1)
+			}
+			ca.settle(0, 0, uint64(steps-1))
+			p.watchdog.advanced()
+			return
+		}
+
+		ca.mu.Lock()
+		ca.applyErrors++
+		ca.mu.Unlock()
+
+		if cluster.LeadershipLost(err) {
+			p.logger.Warn("dropped window advance after losing leadership", "advances", steps, "error", err)
+			ca.settle(0, uint64(steps), 0)
+			return
+		}
+		if attempt == advanceApplyAttempts {
+			p.logger.Error("failed to advance window, will catch up on the next advance",
+				"attempts", attempt,
+				"owed", steps,
+				"error", err,
+			)
+			ca.settle(steps, 0, 0)
+			return
+		}
+
+		p.logger.Warn("failed to advance window, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// settle records the outcome of an advance: the advances now owed and how
+// many were dropped or applied late.
+func (ca *clusterAdvance) settle(owed int, dropped, caughtUp uint64) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	ca.owed = owed
+	ca.dropped += dropped
+	ca.caughtUp += caughtUp
+}
+
+// clusterAdvanceStats returns the cluster advance counters for GetStats.
+func (p *Playlist) clusterAdvanceStats() map[string]any {
+	ca := &p.clusterAdvance
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return map[string]any{
+		"owed":         ca.owed,
+		"apply_errors": ca.applyErrors,
+		"dropped":      ca.dropped,
+		"caught_up":    ca.caughtUp,
+		"forwarded":    ca.forwarded,
+	}
+}
@@ -0,0 +1,152 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/variant"
+	"github.com/hashicorp/raft"
+)
+
+// fakeAdvancer is a windowAdvancer whose applies fail with the queued errors.
+type fakeAdvancer struct {
+	leader    bool
+	errs      []error // returned by successive applies, then nil
+	applied   []int   // steps of each successful apply
+	forwarded []int   // steps of each successful forward
+}
+
+func (f *fakeAdvancer) IsLeader() bool { return f.leader }
+
+func (f *fakeAdvancer) AdvanceWindowBy(steps int) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.applied = append(f.applied, steps)
+	return nil
+}
+
+func (f *fakeAdvancer) ForwardAdvanceWindowBy(steps int) error {
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.forwarded = append(f.forwarded, steps)
+	return nil
+}
+
+func TestAdvanceCluster(t *testing.T) {
+	transient := errors.New("apply command: timed out enqueuing operation")
+	notLeader := fmt.Errorf("apply command: %w", raft.ErrNotLeader)
+
+	tests := []struct {
+		name          string
+		leader        bool
+		errs          []error
+		advances      int
+		wantApplied   []int
+		wantForwarded []int
+		wantStats     map[string]any
+	}{
+		{
+			name:          "follower forwards",
+			advances:      2,
+			wantApplied:   nil,
+			wantForwarded: []int{1, 1},
+			wantStats:     map[string]any{"owed": 0, "apply_errors": uint64(0), "dropped": uint64(0), "caught_up": uint64(0), "forwarded": uint64(2)},
+		},
+		{
+			name:          "failed forward is not retried",
+			errs:          []error{notLeader},
+			advances:      1,
+			wantApplied:   nil,
+			wantForwarded: nil,
+			wantStats:     map[string]any{"owed": 0, "apply_errors": uint64(1), "dropped": uint64(0), "forwarded": uint64(0)},
+		},
+		{
+			name:        "transient error is retried",
+			leader:      true,
+			errs:        []error{transient},
+			advances:    1,
+			wantApplied: []int{1},
+			wantStats:   map[string]any{"owed": 0, "apply_errors": uint64(1), "dropped": uint64(0), "caught_up": uint64(0)},
+		},
+		{
+			name:        "exhausted retries are caught up",
+			leader:      true,
+			errs:        []error{transient, transient, transient},
+			advances:    2,
+			wantApplied: []int{2},
+			wantStats:   map[string]any{"owed": 0, "apply_errors": uint64(3), "dropped": uint64(0), "caught_up": uint64(1)},
+		},
+		{
+			name:        "lost leadership drops the advance",
+			leader:      true,
+			errs:        []error{notLeader},
+			advances:    2,
+			wantApplied: []int{1},
+			wantStats:   map[string]any{"owed": 0, "apply_errors": uint64(1), "dropped": uint64(1), "caught_up": uint64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variants := []variant.Variant{{Segments: createTestSegments(5), TargetDuration: 1}}
+			lp, err := New(variants, 3, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			mgr := &fakeAdvancer{leader: tt.leader, errs: tt.errs}
+			for range tt.advances {
+				lp.advanceCluster(mgr)
+			}
+
+			if fmt.Sprint(mgr.applied) != fmt.Sprint(tt.wantApplied) {
+				t.Errorf("Expected applies %v, got %v", tt.wantApplied, mgr.applied)
+			}
+			if fmt.Sprint(mgr.forwarded) != fmt.Sprint(tt.wantForwarded) {
+				t.Errorf("Expected forwards %v, got %v", tt.wantForwarded, mgr.forwarded)
+			}
+			stats := lp.clusterAdvanceStats()
+			for key, want := range tt.wantStats {
+				if stats[key] != want {
+					t.Errorf("Expected %s = %v, got %v", key, want, stats[key])
+				}
+			}
+			if _, since := lp.AdvanceStalled(); since > time.Second {
+				t.Errorf("Expected the watchdog to record the advance, last was %v ago", since)
+			}
+		})
+	}
+}
+
+func TestAdvanceCluster_OwedDroppedOnFollower(t *testing.T) {
+	variants := []variant.Variant{{Segments: createTestSegments(5), TargetDuration: 1}}
+	lp, err := New(variants, 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	transient := errors.New("apply command: timed out enqueuing operation")
+	mgr := &fakeAdvancer{leader: true, errs: []error{transient, transient, transient}}
+	lp.advanceCluster(mgr)
+	if owed := lp.clusterAdvanceStats()["owed"]; owed != 1 {
+		t.Fatalf("Expected 1 owed advance, got %v", owed)
+	}
+
+	mgr.leader = false
+	lp.advanceCluster(mgr)
+	stats := lp.clusterAdvanceStats()
+	if stats["owed"] != 0 || stats["dropped"] != uint64(1) {
+		t.Errorf("Expected the owed advance to be dropped, got %v", stats)
+	}
+	if len(mgr.applied) != 0 {
+		t.Errorf("Expected no applies, got %v", mgr.applied)
+	}
+}
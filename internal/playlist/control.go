@@ -0,0 +1,91 @@
+package playlist
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// PauseAdvance stops the window from advancing until ResumeAdvance is
+// called, simulating a stalled encoder. In cluster mode, pausing the leader
+// stalls the whole cluster; pausing a follower has no visible effect.
+func (p *Playlist) PauseAdvance() {
+	if !p.paused.Swap(true) {
+		p.logger.Info("window advance paused")
+	}
+}
+
+// ResumeAdvance undoes PauseAdvance. Advances missed while paused are not
+// made up.
+func (p *Playlist) ResumeAdvance() {
+	if p.paused.Swap(false) {
+		p.logger.Info("window advance resumed")
+	}
+}
+
+// AdvancePaused reports whether PauseAdvance is in effect.
+func (p *Playlist) AdvancePaused() bool {
+	return p.paused.Load()
+}
+
+// InsertAdBreak marks an ad break of duration d that starts at the next
+// segment to enter each variant's window: that segment is preceded by
+// EXT-X-CUE-OUT, and the first segment after the break (rounded up to whole
+// target durations) by EXT-X-CUE-IN. The markers are local to this node.
+func (p *Playlist) InsertAdBreak(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("ad break duration must be positive, got %s", d)
+	}
+
+	clusterSequences := p.clusterSequences()
+	for i, mp := range p.variantPlaylists {
+		mp.mu.Lock()
+		current := mp.sequenceNumber
+		if i < len(clusterSequences) {
+			current = clusterSequences[i]
+		}
+		start := current + uint64(mp.windowSize)
+		length := uint64(max(1, math.Ceil(d.Seconds()/float64(mp.targetDuration))))
+
+		cues := activeCues(mp.cues, current)
+		if cues == nil {
+			cues = make(map[uint64]string, 2)
+		}
+		cues[start] += fmt.Sprintf("#EXT-X-CUE-OUT:%g\n", d.Seconds())
+		cues[start+length] += "#EXT-X-CUE-IN\n"
+		mp.cues = cues
+		mp.mu.Unlock()
+	}
+
+	p.logger.Info("inserted ad break", "duration", d)
+	return nil
+}
+
+// clusterSequences returns the media sequence number of each variant in the
+// cluster state, which a follower's own window may lag, or nil outside
+// cluster mode.
+func (p *Playlist) clusterSequences() []uint64 {
+	if p.clusterMgr == nil {
+		return nil
+	}
+	var sequences []uint64
+	for _, v := range p.clusterMgr.GetState().Variants {
+		sequences = append(sequences, v.SequenceNumber)
+	}
+	return sequences
+}
+
+// activeCues returns a copy of cues without the markers of segments before
+// sequence, which have left the window, or nil if none remain.
+func activeCues(cues map[uint64]string, sequence uint64) map[uint64]string {
+	var active map[uint64]string
+	for seq, tags := range cues {
+		if seq >= sequence {
+			if active == nil {
+				active = make(map[uint64]string, len(cues))
+			}
+			active[seq] = tags
+		}
+	}
+	return active
+}
@@ -0,0 +1,68 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func TestPauseAdvance(t *testing.T) {
+	variants := []variant.Variant{{Segments: createTestSegments(5), TargetDuration: 10}}
+	lp, err := New(variants, 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lp.PauseAdvance()
+	lp.Advance()
+	if !lp.AdvancePaused() || lp.MediaSequence() != 0 {
+		t.Errorf("Expected a paused window at sequence 0, got paused=%v sequence=%d", lp.AdvancePaused(), lp.MediaSequence())
+	}
+
+	lp.ResumeAdvance()
+	lp.Advance()
+	if lp.AdvancePaused() || lp.MediaSequence() != 1 {
+		t.Errorf("Expected a resumed window at sequence 1, got paused=%v sequence=%d", lp.AdvancePaused(), lp.MediaSequence())
+	}
+}
+
+func TestInsertAdBreak(t *testing.T) {
+	for _, preRender := range []bool{false, true} {
+		variants := []variant.Variant{{Segments: createTestSegments(10), TargetDuration: 10}}
+		lp, err := NewWithOptions(variants, Options{WindowSize: 3, PreRender: preRender}, nil, createTestLogger())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := lp.InsertAdBreak(0); err == nil {
+			t.Error("Expected an error for a zero-length ad break")
+		}
+
+		// The break starts at sequence 3, the next segment to enter the
+		// window, and lasts two target durations
+		if err := lp.InsertAdBreak(15 * time.Second); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		wantBefore := map[uint64]string{3: "#EXT-X-CUE-OUT:15", 5: "#EXT-X-CUE-IN"}
+		for seq := uint64(0); seq < 8; seq++ {
+			out, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			// The newest segment of the window has sequence seq+2
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			edge := seq + 2
+			if tag, ok := wantBefore[edge]; ok {
+				if got := lines[len(lines)-3]; got != tag {
+					t.Errorf("prerender=%v sequence %d: expected %q before the newest segment, got %q", preRender, edge, tag, got)
+				}
+			}
+			if strings.Contains(out, "CUE") && edge > 7 {
+				t.Errorf("prerender=%v: expected markers to leave the window, got:\n%s", preRender, out)
+			}
+			lp.Advance()
+		}
+	}
+}
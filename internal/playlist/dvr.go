@@ -0,0 +1,85 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// A DVR window lets a player seek further back than the live window without
+// changing --window-size for every session: the DVR playlist of a depth is
+// the live playlist extended backward through the loop history until it
+// spans that depth, or reaches the start of the stream. A session asks for a
+// depth on the master playlist, whose variant URLs carry it along, so
+// players with different DVR depths can share one instance.
+
+// MaxDVRDepth is the deepest DVR window served.
+const MaxDVRDepth = 24 * time.Hour
+
+// ErrDVRUnavailable is returned by the DVR writers when the playlist type is
+// not live: EVENT and VOD playlists already hold the whole stream.
+var ErrDVRUnavailable = errors.New("DVR windows require a live playlist")
+
+// DVREnabled reports whether DVR windows are served.
+func (p *Playlist) DVREnabled() bool {
+	return p.playlistType == TypeLive
+}
+
+// WriteDVRMaster writes the master playlist of a DVR window of depth, whose
+// variants are at /variant/N/playlist.m3u8?dvr=<depth>.
+func (p *Playlist) WriteDVRMaster(w io.Writer, depth time.Duration) error {
+	if err := p.checkDVRDepth(depth); err != nil {
+		return err
+	}
+	sw := &stickyWriter{w: w}
+	p.writeMaster(sw, "", "?dvr="+url.QueryEscape(depth.String()))
+	return sw.err
+}
+
+// WriteDVRVariant writes the media playlist of a variant with a DVR window
+// of depth to w. Errors are returned before anything is written.
+func (p *Playlist) WriteDVRVariant(w io.Writer, variantIndex int, depth time.Duration) error {
+	if err := p.checkDVRDepth(depth); err != nil {
+		return err
+	}
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	if err := p.syncClusterState(variantIndex); err != nil {
+		return err
+	}
+	return p.variantPlaylists[variantIndex].write(w, false, 0, depth)
+}
+
+// checkDVRDepth returns an error if p does not serve DVR windows of depth.
+func (p *Playlist) checkDVRDepth(depth time.Duration) error {
+	if !p.DVREnabled() {
+		return ErrDVRUnavailable
+	}
+	if depth <= 0 || depth > MaxDVRDepth {
+		return fmt.Errorf("DVR depth %s out of range (up to %s)", depth, MaxDVRDepth)
+	}
+	return nil
+}
+
+// dvrExtension returns how many segments to add before the window of
+// windowSize segments at position for the window to span depth, going back
+// at most available segments.
+func dvrExtension(segments []segment.Segment, position, windowSize int, available uint64, depth time.Duration) int {
+	totalSegments := len(segments)
+	var span time.Duration
+	for i := range windowSize {
+		span += segmentDuration(segments[(position+i)%totalSegments])
+	}
+	extra := 0
+	for span < depth && uint64(extra) < available {
+		position = (position - 1 + totalSegments) % totalSegments
+		span += segmentDuration(segments[position])
+		extra++
+	}
+	return extra
+}
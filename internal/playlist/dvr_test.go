@@ -0,0 +1,110 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestWriteDVRVariant(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 4, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+		{URL: "seg3.ts", Duration: 4, Sequence: 3},
+	}
+	lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 2, ProgramDateTime: PDTReset, PreRender: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	for range 6 {
+		lp.Advance()
+	}
+
+	// The live window is seg2.ts and seg3.ts with media sequence numbers 6
+	// and 7, spanning 10s
+	live, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("GenerateVariant() error = %v", err)
+	}
+	liveDates, _ := playlistDates(t, live)
+
+	tests := []struct {
+		name      string
+		depth     time.Duration
+		wantFirst string
+		wantURLs  string
+	}{
+		{"within the live window", 10 * time.Second, "#EXT-X-MEDIA-SEQUENCE:6\n", "seg2.ts seg3.ts"},
+		{"part of a loop", 15 * time.Second, "#EXT-X-MEDIA-SEQUENCE:4\n", "seg0.ts seg1.ts seg2.ts seg3.ts"},
+		{"across a loop point", 30 * time.Second, "#EXT-X-MEDIA-SEQUENCE:2\n", "seg2.ts seg3.ts seg0.ts seg1.ts seg2.ts seg3.ts"},
+		{"start of the stream", time.Hour, "#EXT-X-MEDIA-SEQUENCE:0\n", "seg0.ts seg1.ts seg2.ts seg3.ts seg0.ts seg1.ts seg2.ts seg3.ts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := lp.WriteDVRVariant(&b, 0, tt.depth); err != nil {
+				t.Fatalf("WriteDVRVariant() error = %v", err)
+			}
+			playlist := b.String()
+			if !strings.Contains(playlist, tt.wantFirst) || strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE") || strings.Contains(playlist, "#EXT-X-ENDLIST") {
+				t.Errorf("Expected a live playlist with %q:\n%s", strings.TrimSpace(tt.wantFirst), playlist)
+			}
+			if got := strings.Join(playlistURLs(playlist), " "); got != tt.wantURLs {
+				t.Errorf("segments %s, want %s", got, tt.wantURLs)
+			}
+
+			// The live window keeps its dates, and the segments before it
+			// are dated continuously back from it
+			dates, durations := playlistDates(t, playlist)
+			extra := len(dates) - len(liveDates)
+			for i, date := range liveDates {
+				if !dates[extra+i].Equal(date) {
+					t.Errorf("live segment %d dated %v, want %v", i, dates[extra+i], date)
+				}
+			}
+			for i := 0; i < extra; i++ {
+				if !dates[i].Add(durations[i]).Equal(dates[i+1]) {
+					t.Errorf("segment %d dated %v+%v, next dated %v", i, dates[i], durations[i], dates[i+1])
+				}
+			}
+		})
+	}
+
+	if err := lp.WriteDVRVariant(&strings.Builder{}, 0, MaxDVRDepth+time.Second); err == nil {
+		t.Error("WriteDVRVariant() deeper than MaxDVRDepth succeeded")
+	}
+	if err := lp.WriteDVRVariant(&strings.Builder{}, 1, time.Minute); err == nil {
+		t.Error("WriteDVRVariant() with an invalid variant index succeeded")
+	}
+
+	// The live playlist is unaffected
+	if again, _ := lp.GenerateVariant(0); again != live {
+		t.Errorf("live playlist changed after DVR requests:\n%s", again)
+	}
+}
+
+func TestWriteDVRMaster(t *testing.T) {
+	event, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, Type: TypeEvent}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if err := event.WriteDVRMaster(&strings.Builder{}, time.Minute); !errors.Is(err, ErrDVRUnavailable) {
+		t.Errorf("WriteDVRMaster() of an EVENT playlist error = %v, want ErrDVRUnavailable", err)
+	}
+
+	lp, err := New(createTestVariants(2, 5), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	var b strings.Builder
+	if err := lp.WriteDVRMaster(&b, 30*time.Minute); err != nil {
+		t.Fatalf("WriteDVRMaster() error = %v", err)
+	}
+	if want := "\n/variant/1/playlist.m3u8?dvr=30m0s\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("Expected %q in DVR master playlist:\n%s", strings.TrimSpace(want), b.String())
+	}
+}
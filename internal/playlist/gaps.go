@@ -0,0 +1,69 @@
+package playlist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Gaps simulates an encoder that loses segments: every Every-th media
+// sequence number of the variant playlists is lost, counting from 0, so that
+// the same segments are lost on every request, on every cluster node and
+// across restarts. Only the HLS media playlists of the live presentation show
+// the loss; the VOD and start-over presentations, DASH and Smooth Streaming
+// do not.
+type Gaps struct {
+	// Mode is how a lost segment shows (GapTag if empty).
+	Mode GapMode
+
+	// Every is how often a segment is lost; 0 loses none.
+	Every uint64
+}
+
+// GapMode selects how a lost segment shows in the media playlists.
+type GapMode string
+
+const (
+	// GapTag keeps a lost segment in the playlist, marked with EXT-X-GAP.
+	GapTag GapMode = "gap"
+
+	// GapSkip leaves a lost segment out of the playlist. The media sequence
+	// numbers stay contiguous, so the timeline jumps by the lost segment's
+	// duration.
+	GapSkip GapMode = "skip"
+)
+
+// ParseGaps parses a gap spec of the form MODE:N, such as "gap:50", which
+// loses every Nth segment.
+func ParseGaps(spec string) (Gaps, error) {
+	mode, every, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok {
+		return Gaps{}, fmt.Errorf("invalid gap spec %q (expected MODE:N, such as gap:50)", spec)
+	}
+	g := Gaps{Mode: GapMode(strings.ToLower(mode))}
+	if g.Mode != GapTag && g.Mode != GapSkip {
+		return Gaps{}, fmt.Errorf("unknown gap mode %q (expected gap or skip)", mode)
+	}
+	n, err := strconv.ParseUint(every, 10, 64)
+	if err != nil || n < 2 {
+		return Gaps{}, fmt.Errorf("gap frequency must be a number of segments of at least 2, got %q", every)
+	}
+	g.Every = n
+	return g, nil
+}
+
+// lost reports whether the segment with media sequence number sequence is
+// lost.
+func (g Gaps) lost(sequence uint64) bool {
+	return g.Every != 0 && sequence%g.Every == g.Every-1
+}
+
+// renumber returns the media sequence number that the segment with sequence
+// number sequence is served with: in GapSkip mode the lost segments before it
+// take no number.
+func (g Gaps) renumber(sequence uint64) uint64 {
+	if g.Every == 0 || g.Mode != GapSkip {
+		return sequence
+	}
+	return sequence - sequence/g.Every
+}
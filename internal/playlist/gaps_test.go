@@ -0,0 +1,115 @@
+package playlist
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestParseGaps(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Gaps
+		wantErr bool
+	}{
+		{"gap:50", Gaps{Mode: GapTag, Every: 50}, false},
+		{"SKIP:3", Gaps{Mode: GapSkip, Every: 3}, false},
+		{"gap", Gaps{}, true},
+		{"drop:5", Gaps{}, true},
+		{"gap:1", Gaps{}, true},
+		{"gap:often", Gaps{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGaps(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseGaps(%q) = %+v, %v, want %+v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteVariant_Gaps(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 6, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+		{URL: "seg3.ts", Duration: 6, Sequence: 3},
+		{URL: "seg4.ts", Duration: 6, Sequence: 4},
+	}
+
+	tests := []struct {
+		name      string
+		gaps      Gaps
+		advances  int
+		wantFirst string
+		wantURLs  string
+		wantGaps  int
+	}{
+		{"gap tags", Gaps{Mode: GapTag, Every: 3}, 1, "#EXT-X-MEDIA-SEQUENCE:1\n", "seg1.ts seg2.ts seg3.ts seg4.ts", 1},
+		{"gap tags across the loop", Gaps{Mode: GapTag, Every: 3}, 4, "#EXT-X-MEDIA-SEQUENCE:4\n", "seg4.ts seg0.ts seg1.ts seg2.ts", 1},
+		// Sequence numbers 2 and 5 are lost: 6 is served as 4
+		{"skipped", Gaps{Mode: GapSkip, Every: 3}, 1, "#EXT-X-MEDIA-SEQUENCE:1\n", "seg1.ts seg3.ts seg4.ts", 0},
+		{"skipped first", Gaps{Mode: GapSkip, Every: 3}, 5, "#EXT-X-MEDIA-SEQUENCE:4\n", "seg1.ts seg2.ts", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 4, PreRender: true, Gaps: tt.gaps}, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			for range tt.advances {
+				lp.Advance()
+			}
+			playlist, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+			if !strings.Contains(playlist, tt.wantFirst) {
+				t.Errorf("Expected %q:\n%s", strings.TrimSpace(tt.wantFirst), playlist)
+			}
+			if got := strings.Join(playlistURLs(playlist), " "); got != tt.wantURLs {
+				t.Errorf("segments %s, want %s", got, tt.wantURLs)
+			}
+			if got := strings.Count(playlist, "#EXT-X-GAP\n"); got != tt.wantGaps {
+				t.Errorf("%d EXT-X-GAP tags, want %d:\n%s", got, tt.wantGaps, playlist)
+			}
+		})
+	}
+}
+
+func TestWriteVariant_SkippedSequence(t *testing.T) {
+	// Across advances, a segment keeps the media sequence number it is
+	// served with
+	lp, err := NewWithOptions(createTestVariants(1, 7), Options{WindowSize: 3, Gaps: Gaps{Mode: GapSkip, Every: 4}}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	urls := make(map[int]string)
+	for range 20 {
+		playlist, err := lp.GenerateVariant(0)
+		if err != nil {
+			t.Fatalf("GenerateVariant() error = %v", err)
+		}
+		header, _, _ := strings.Cut(strings.SplitAfter(playlist, "#EXT-X-MEDIA-SEQUENCE:")[1], "\n")
+		first, err := strconv.Atoi(header)
+		if err != nil {
+			t.Fatalf("invalid media sequence %q", header)
+		}
+		for i, url := range playlistURLs(playlist) {
+			if prev, ok := urls[first+i]; ok && prev != url {
+				t.Fatalf("media sequence number %d served as %s, then %s", first+i, prev, url)
+			}
+			urls[first+i] = url
+		}
+		lp.Advance()
+	}
+	// Segments 0-21 were in a window; 3, 7, 11, 15 and 19 are lost
+	if len(urls) != 17 {
+		t.Errorf("%d media sequence numbers served over 20 advances, want 17", len(urls))
+	}
+
+	if _, err := NewWithOptions(createTestVariants(1, 7), Options{WindowSize: 3, DeltaUpdates: true, Gaps: Gaps{Mode: GapSkip, Every: 4}}, nil, createTestLogger()); err == nil {
+		t.Error("NewWithOptions() with skipped segments and delta updates succeeded")
+	}
+}
@@ -3,31 +3,210 @@ package playlist
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/budget"
 	"github.com/agleyzer/encodersim/internal/cluster"
 	"github.com/agleyzer/encodersim/internal/segment"
 	"github.com/agleyzer/encodersim/internal/variant"
 )
 
+// maxPreRenderLines bounds the number of segment entries kept in memory when
+// pre-rendering (segments × window size, summed over variants).
+const maxPreRenderLines = 1_000_000
+
+// Errors that keep a playlist from being generated, for callers to tell
+// apart with errors.Is.
+var (
+	// ErrVariantOutOfRange is returned for a variant index the playlist
+	// does not have.
+	ErrVariantOutOfRange = errors.New("variant index out of range")
+
+	// ErrNotReady is returned in cluster mode until the cluster state holds
+	// the windows of the variants.
+	ErrNotReady = errors.New("playlist not ready")
+)
+
+// Options configures a Playlist.
+type Options struct {
+	// WindowSize is the number of segments in the sliding window.
+	WindowSize int
+
+	// WindowPolicy decides how windows are clamped when WindowSize exceeds
+	// a variant's segment count (WindowPerVariant if empty).
+	WindowPolicy WindowPolicy
+
+	// PreRender renders every possible window once at startup and serves
+	// requests from the cache, substituting only the media sequence number.
+	// Ignored (with a warning) if the cache would exceed maxPreRenderLines
+	// or the cache limit of Budget.
+	PreRender bool
+
+	// Budget, if set, is charged with the pre-rendered windows.
+	Budget *budget.Budget
+
+	// PreserveMediaSequence starts each variant's EXT-X-MEDIA-SEQUENCE at the
+	// source playlist's value instead of rebasing it to 0.
+	PreserveMediaSequence bool
+
+	// StartPosition is the segment index in the loop at which the first
+	// window starts, so that players join mid-content. It must be below
+	// the segment count of every variant and rendition.
+	StartPosition int
+
+	// StartSequence is the EXT-X-MEDIA-SEQUENCE of the first window, as if
+	// the stream had been running for a while. Not allowed with
+	// PreserveMediaSequence. A position resumed from StateFile or from the
+	// cluster takes precedence over StartPosition and StartSequence.
+	StartSequence uint64
+
+	// SegmentStore, if set, deduplicates segment lists so that playlists built
+	// from the same source share one copy of their segments.
+	SegmentStore *segment.Store
+
+	// StateFile, if set, is where the window position is saved after every
+	// advance. A position saved for the same content is resumed at startup;
+	// one saved for different content is ignored.
+	StateFile string
+
+	// CatchUp moves a position resumed from StateFile forward by the advance
+	// intervals that elapsed while the process was stopped, keeping the live
+	// edge aligned with the wall clock.
+	CatchUp bool
+
+	// ClockSkew offsets this playlist's perceived clock, to test how a cluster
+	// handles nodes whose clocks disagree. Window advances are driven by Raft
+	// log entries and timers that measure intervals, so the skew only shifts
+	// the timestamps the node saves and reports.
+	ClockSkew time.Duration
+
+	// DASH enables WriteMPD. The variants must be CMAF (fMP4) with the same
+	// segment count and durations, so that one timeline fits them all.
+	DASH bool
+
+	// Smooth enables WriteSmooth and SmoothFragmentURL, on the same
+	// timeline as DASH and with the same requirements. The variants must
+	// also have distinct bandwidths and no byte-range segments.
+	Smooth bool
+
+	// DebugSubtitles adds a WebVTT subtitle rendition to the master playlist
+	// whose cues show the origin state of each segment (WriteDebugSubtitles).
+	DebugSubtitles bool
+
+	// BlockingReload advertises LL-HLS blocking playlist reload in the
+	// variant playlists (EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES); the
+	// server holds the reloads with LastMediaSequence.
+	BlockingReload bool
+
+	// DeltaUpdates advertises playlist delta updates in the variant
+	// playlists (EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL) and enables
+	// WriteVariantDelta.
+	DeltaUpdates bool
+
+	// ProgramDateTime stamps every segment of the variant playlists with
+	// EXT-X-PROGRAM-DATE-TIME (PDTOff if empty). Not supported in cluster
+	// mode, and playlists are not pre-rendered when enabled.
+	ProgramDateTime ProgramDateTime
+
+	// Type selects a live, EVENT or VOD presentation of the variant
+	// playlists (TypeLive if empty). EVENT and VOD playlists are not
+	// pre-rendered and support neither program date time nor debug
+	// subtitles.
+	Type PlaylistType
+
+	// Loops ends an EVENT playlist after that many loops of the source, and
+	// sets how many loops a VOD playlist holds (one if 0). Not allowed with
+	// TypeLive.
+	Loops int
+
+	// Gaps loses segments of the variant playlists, to test how players
+	// handle encoder segment loss. GapSkip is not supported with
+	// BlockingReload or DeltaUpdates, which address segments by their
+	// unaltered positions.
+	Gaps Gaps
+
+	// PDTAnomalies injects anomalies into the program date times. It
+	// requires ProgramDateTime.
+	PDTAnomalies PDTAnomalies
+
+	// PDTFormat is how the program date times are written (UTC with
+	// milliseconds if zero). It requires ProgramDateTime.
+	PDTFormat PDTFormat
+
+	// Encryption declares the segments of the variant playlists encrypted
+	// with EXT-X-KEY tags, and enables WriteKey.
+	Encryption Encryption
+
+	// Renditions are the alternate audio and subtitle renditions of the
+	// live master playlist. Those with a media playlist loop with the
+	// variants and are served by WriteRendition. Not supported with DASH,
+	// Smooth or Replace, nor with DebugSubtitles if any is a subtitle
+	// rendition.
+	Renditions []variant.Rendition
+
+	// TimeScale advances the window TimeScale times faster than real time
+	// (1 if 0), so that long loops, discontinuity sequence rollovers and
+	// large media sequence numbers are reached in minutes. With
+	// DurationsReal, DASH and Smooth are not supported.
+	TimeScale float64
+
+	// TimeScaleDurations selects whether the advertised durations are
+	// scaled with TimeScale (DurationsScaled if empty).
+	TimeScaleDurations DurationMode
+}
+
 // Playlist manages a multi-variant HLS playlist with sliding window support.
 // It generates both the master playlist (with variant links) and individual variant
 // media playlists. For single media playlists, wrap them in a single-variant structure.
 type Playlist struct {
 	variants         []variant.Variant // Metadata for master playlist generation
-	variantPlaylists []*mediaPlaylist  // One mediaPlaylist per variant
+	variantPlaylists []*mediaPlaylist  // One mediaPlaylist per variant, then per rendition with media
+	renditions       []rendition       // Options.Renditions
 	clusterMgr       *cluster.Manager  // Optional: nil for non-clustered mode
 	logger           *slog.Logger
+	masterCache      string          // Pre-rendered master playlist (empty if not pre-rendering)
+	segmentStore     *segment.Store  // Optional: shared segment storage
+	windowSize       int             // Requested window size, before per-variant clamping
+	windowPolicy     WindowPolicy    // How windowSize is clamped, see effectiveWindows
+	watchdog         watchdog        // Advance progress, see RunAutoAdvance
+	clusterAdvance   clusterAdvance  // Raft apply outcomes (cluster mode only)
+	stateFile        string          // Optional: where the position is saved
+	clockSkew        time.Duration   // Offset of the perceived clock, see now
+	timeScale        float64         // Options.TimeScale, 1 if unset
+	scaleDurations   bool            // Scale replacement segments by timeScale
+	advanceRate      float64         // Advances per advertised segment duration, see advanceTime
+	paused           atomic.Bool     // Set by PauseAdvance
+	standby          atomic.Bool     // Set by SetStandby
+	dashStart        time.Time       // DASH availabilityStartTime (zero unless Options.DASH or Options.Smooth)
+	dash             bool            // Options.DASH
+	smooth           bool            // Options.Smooth
+	debugSubtitles   bool            // Options.DebugSubtitles
+	blockingReload   bool            // Options.BlockingReload
+	deltaUpdates     bool            // Options.DeltaUpdates
+	programDateTime  ProgramDateTime // Options.ProgramDateTime
+	encryption       Encryption      // Options.Encryption
+	playlistType     PlaylistType    // Options.Type
+	loops            int             // Options.Loops
 }
 
 // New creates a new multi-variant playlist.
 // For single media playlists, wrap them in a variant.Variant slice first.
 // Use clusterMgr=nil for non-clustered mode.
 func New(variants []variant.Variant, windowSize int, clusterMgr *cluster.Manager, logger *slog.Logger) (*Playlist, error) {
+	return NewWithOptions(variants, Options{WindowSize: windowSize}, clusterMgr, logger)
+}
+
+// NewWithOptions creates a new multi-variant playlist with the given options.
+// Use clusterMgr=nil for non-clustered mode.
+func NewWithOptions(variants []variant.Variant, opts Options, clusterMgr *cluster.Manager, logger *slog.Logger) (*Playlist, error) {
+	windowSize := opts.WindowSize
 	if len(variants) == 0 {
 		return nil, fmt.Errorf("cannot create playlist with zero variants")
 	}
@@ -36,139 +215,475 @@ func New(variants []variant.Variant, windowSize int, clusterMgr *cluster.Manager
 		return nil, fmt.Errorf("window size must be positive")
 	}
 
-	// Create one mediaPlaylist per variant
-	variantPlaylists := make([]*mediaPlaylist, len(variants))
-	variantStates := make([]cluster.VariantState, len(variants))
+	if opts.ProgramDateTime != PDTOff && clusterMgr != nil {
+		return nil, fmt.Errorf("program date time is not supported in cluster mode")
+	}
+
+	if opts.Loops < 0 {
+		return nil, fmt.Errorf("loops must not be negative")
+	}
+	if opts.Type == TypeLive && opts.Loops > 0 {
+		return nil, fmt.Errorf("loops require an EVENT or VOD playlist")
+	}
+	if opts.Type != TypeLive && opts.ProgramDateTime != PDTOff {
+		return nil, fmt.Errorf("program date time is not supported with %s playlists", strings.ToUpper(string(opts.Type)))
+	}
+	if opts.Type != TypeLive && opts.DebugSubtitles {
+		return nil, fmt.Errorf("debug subtitles are not supported with %s playlists", strings.ToUpper(string(opts.Type)))
+	}
+	if opts.PDTAnomalies.Enabled() && opts.ProgramDateTime == PDTOff {
+		return nil, fmt.Errorf("program date time anomalies require program date time")
+	}
+	if (opts.PDTFormat.Zone != nil || opts.PDTFormat.Offset || opts.PDTFormat.Precision != 0) && opts.ProgramDateTime == PDTOff {
+		return nil, fmt.Errorf("program date time format requires program date time")
+	}
+	if err := opts.PDTFormat.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Encryption.Method == EncryptionNone && (opts.Encryption.URI != "" || opts.Encryption.Rotation != 0) {
+		return nil, fmt.Errorf("key URI and rotation require an encryption method")
+	}
+	if strings.ContainsAny(opts.Encryption.URI, "\"\r\n") {
+		return nil, fmt.Errorf("key URI %q must not contain quotes or line breaks", opts.Encryption.URI)
+	}
+	if err := checkRenditions(opts); err != nil {
+		return nil, err
+	}
+	if opts.StartPosition < 0 {
+		return nil, fmt.Errorf("start position must not be negative")
+	}
+	if opts.StartSequence != 0 && opts.PreserveMediaSequence {
+		return nil, fmt.Errorf("a start sequence cannot be combined with preserving the source media sequence")
+	}
+	timeScale, err := checkTimeScale(opts)
+	if err != nil {
+		return nil, err
+	}
+	scaleDurations := opts.TimeScaleDurations == DurationsScaled
+	advanceRate := 1.0
+	if !scaleDurations {
+		advanceRate = timeScale
+	}
+	if opts.Gaps.Every != 0 && opts.Gaps.Mode == "" {
+		opts.Gaps.Mode = GapTag
+	}
+	if opts.Gaps.Mode == GapSkip && opts.Gaps.Every != 0 && (opts.BlockingReload || opts.DeltaUpdates) {
+		return nil, fmt.Errorf("skipped segments are not supported with blocking reload or delta updates")
+	}
 
 	for i, v := range variants {
 		if len(v.Segments) == 0 {
 			return nil, fmt.Errorf("variant %d has zero segments", i)
 		}
+	}
+
+	// The media playlists of the renditions loop like the variants, after
+	// them in variantPlaylists
+	renditions, media := renditionPlaylists(variants, opts.Renditions)
+	if scaleDurations {
+		media = scaleVariants(media, timeScale)
+	}
+	for i, v := range media {
+		if opts.StartPosition >= len(v.Segments) {
+			kind, index := "variant", i
+			if i >= len(variants) {
+				kind, index = "rendition", i-len(variants)
+			}
+			return nil, fmt.Errorf("start position %d is beyond the %d segments of %s %d", opts.StartPosition, len(v.Segments), kind, index)
+		}
+	}
+
+	// Share segment storage with other playlists built from the same source
+	if opts.SegmentStore != nil {
+		shared := make([]variant.Variant, len(media))
+		for i, v := range media {
+			shared[i] = v
+			shared[i].Segments = opts.SegmentStore.Intern(v.Segments)
+		}
+		media = shared
+	}
+
+	segmentCounts := make([]int, len(media))
+	for i, v := range media {
+		segmentCounts[i] = len(v.Segments)
+	}
+
+	// Clamp the window of short variants according to the policy
+	if opts.WindowPolicy == "" {
+		opts.WindowPolicy = WindowPerVariant
+	}
+	windows, err := effectiveWindows(windowSize, opts.WindowPolicy, segmentCounts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create one mediaPlaylist per variant and rendition
+	variantPlaylists := make([]*mediaPlaylist, len(media))
+	variantStates := make([]cluster.VariantState, len(media))
 
-		// Adjust window size if needed
-		effectiveWindowSize := windowSize
-		if windowSize > len(v.Segments) {
-			effectiveWindowSize = len(v.Segments)
+	for i, v := range media {
+		effectiveWindowSize := windows[i]
+		if effectiveWindowSize < windowSize {
 			logger.Warn("window size larger than variant segment count",
 				"variant", i,
 				"windowSize", windowSize,
 				"segmentCount", len(v.Segments),
+				"effectiveWindowSize", effectiveWindowSize,
+				"policy", opts.WindowPolicy,
 			)
 		}
 
-		// Create mediaPlaylist for this variant
+		if v.Version > maxSourceVersion {
+			logger.Info("source EXT-X-VERSION is higher than the generated playlists need",
+				"variant", i,
+				"sourceVersion", v.Version,
+				"version", playlistVersion(v.Segments, v.Version),
+			)
+		}
+
+		startSequence := opts.StartSequence
+		if opts.PreserveMediaSequence {
+			startSequence = v.MediaSequence
+		}
+
+		// Create mediaPlaylist for this variant. Renditions are served
+		// without LL-HLS, see WriteRendition.
+		isVariant := i < len(variants)
 		mp := &mediaPlaylist{
 			segments:        v.Segments,
 			windowSize:      effectiveWindowSize,
-			currentPosition: 0,
-			sequenceNumber:  0,
+			currentPosition: opts.StartPosition,
+			sequenceNumber:  startSequence,
+			startSequence:   startSequence,
+			startPosition:   opts.StartPosition,
 			targetDuration:  v.TargetDuration,
+			version:         playlistVersion(v.Segments, v.Version),
+			headerTags:      v.HeaderTags,
+			blockingReload:  opts.BlockingReload && isVariant,
+			deltaUpdates:    opts.DeltaUpdates && isVariant,
+			pdtMode:         opts.ProgramDateTime,
+			playlistType:    opts.Type,
+			loops:           opts.Loops,
+			budget:          opts.Budget,
 			logger:          logger,
+			simulation: simulation{
+				gaps:       opts.Gaps,
+				anomalies:  opts.PDTAnomalies,
+				encryption: opts.Encryption,
+				pdtFormat:  opts.PDTFormat,
+			},
 		}
 		variantPlaylists[i] = mp
 
 		// Initialize variant state for cluster mode
 		variantStates[i] = cluster.VariantState{
 			Index:           i,
-			CurrentPosition: 0,
-			SequenceNumber:  0,
+			CurrentPosition: opts.StartPosition,
+			SequenceNumber:  startSequence,
 			TotalSegments:   len(v.Segments),
+			Source:          v.PlaylistURL,
 		}
 	}
 
-	// Initialize cluster state if in cluster mode
-	if clusterMgr != nil && clusterMgr.IsLeader() {
-		initState := cluster.ClusterState{
-			Variants: variantStates,
+	// Resume the position saved by a previous run
+	if opts.StateFile != "" {
+		saved, err := loadState(opts.StateFile)
+		if err != nil {
+			logger.Warn("ignoring unreadable window state", "path", opts.StateFile, "error", err)
+		} else if saved != nil {
+			restoreState(saved, variantPlaylists, variantStates, opts.CatchUp, advanceRate, time.Now().Add(opts.ClockSkew), logger)
 		}
-		if err := clusterMgr.Initialize(initState); err != nil {
-			return nil, fmt.Errorf("initialize cluster state: %w", err)
+	}
+
+	if opts.ProgramDateTime != PDTOff {
+		now := time.Now().Add(opts.ClockSkew)
+		for _, mp := range variantPlaylists {
+			mp.initDates(now)
+		}
+	}
+
+	// Initialize cluster state if in cluster mode, unless the cluster already
+	// serves these variants, as after a restart with persistent Raft storage
+	if clusterMgr != nil && clusterMgr.IsLeader() {
+		if existing := clusterMgr.GetState(); sameVariants(existing.Variants, variantStates) {
+			for i, vs := range existing.Variants {
+				variantPlaylists[i].currentPosition = vs.CurrentPosition
+				variantPlaylists[i].sequenceNumber = vs.SequenceNumber
+			}
+			logger.Info("resumed cluster state", "variants", len(existing.Variants), "sequence", existing.Variants[0].SequenceNumber)
+		} else {
+			initState := cluster.ClusterState{
+				Variants: variantStates,
+			}
+			if err := clusterMgr.Initialize(initState); err != nil {
+				return nil, fmt.Errorf("initialize cluster state: %w", err)
+			}
+			logger.Info("initialized cluster state", "variants", len(variantStates))
 		}
-		logger.Info("initialized cluster state", "variants", len(variantStates))
 	} else if clusterMgr != nil {
 		logger.Info("skipping cluster state initialization (not leader)")
 	}
 
-	return &Playlist{
-		variants:         variants,
+	p := &Playlist{
+		variants:         media[:len(variants)],
 		variantPlaylists: variantPlaylists,
+		renditions:       renditions,
 		clusterMgr:       clusterMgr,
 		logger:           logger,
-	}, nil
+		segmentStore:     opts.SegmentStore,
+		windowSize:       windowSize,
+		windowPolicy:     opts.WindowPolicy,
+		stateFile:        opts.StateFile,
+		clockSkew:        opts.ClockSkew,
+		timeScale:        timeScale,
+		scaleDurations:   scaleDurations,
+		advanceRate:      advanceRate,
+		dash:             opts.DASH,
+		smooth:           opts.Smooth,
+		debugSubtitles:   opts.DebugSubtitles,
+		blockingReload:   opts.BlockingReload,
+		deltaUpdates:     opts.DeltaUpdates,
+		programDateTime:  opts.ProgramDateTime,
+		encryption:       opts.Encryption,
+		playlistType:     opts.Type,
+		loops:            opts.Loops,
+	}
+
+	p.watchdog.advanced()
+
+	if opts.DASH || opts.Smooth {
+		if err := p.initDASH(); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.PreRender && opts.ProgramDateTime != PDTOff {
+		logger.Warn("pre-rendering is not available with program date time, rendering per request")
+	} else if opts.PreRender && opts.Type != TypeLive {
+		logger.Warn("pre-rendering is only available for live playlists, rendering per request", "type", opts.Type)
+	} else if opts.PreRender {
+		p.preRender()
+	}
+
+	return p, nil
+}
+
+// preRender caches the master playlist and every window of every variant,
+// unless the cache would be too large.
+func (p *Playlist) preRender() {
+	lines := 0
+	for _, mp := range p.variantPlaylists {
+		lines += len(mp.segments) * mp.windowSize
+	}
+	if lines > maxPreRenderLines {
+		p.logger.Warn("source too large to pre-render, rendering per request",
+			"segmentLines", lines,
+			"limit", maxPreRenderLines,
+		)
+		return
+	}
+
+	var bytes int64
+	for _, mp := range p.variantPlaylists {
+		if err := mp.preRender(); err != nil {
+			for _, mp := range p.variantPlaylists {
+				mp.dropWindows()
+			}
+			p.logger.Warn("pre-rendered windows do not fit the cache budget, rendering per request", "error", err)
+			return
+		}
+		bytes += mp.windowBytes
+	}
+	p.masterCache = p.renderMaster()
+
+	p.logger.Info("pre-rendered all window positions", "segmentLines", lines, "bytes", bytes)
 }
 
 // Generate creates an HLS master playlist with variant streams.
 func (p *Playlist) Generate() (string, error) {
+	if p.masterCache != "" {
+		return p.masterCache, nil
+	}
+
 	var b strings.Builder
+	if err := p.WriteMaster(&b); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// PreRendered reports whether playlists are served from the windows
+// rendered at startup (Options.PreRender).
+func (p *Playlist) PreRendered() bool {
+	return p.masterCache != ""
+}
 
+// WriteMaster writes the HLS master playlist to w.
+func (p *Playlist) WriteMaster(w io.Writer) error {
+	if p.masterCache != "" {
+		_, err := io.WriteString(w, p.masterCache)
+		return err
+	}
+
+	sw := &stickyWriter{w: w}
+	p.writeMaster(sw, "", "")
+	return sw.err
+}
+
+// renderMaster renders the master playlist to a string.
+func (p *Playlist) renderMaster() string {
+	var b strings.Builder
+	p.writeMaster(&b, "", "")
+	return b.String()
+}
+
+// writeMaster writes the master playlist. The variant playlist URLs start
+// with prefix and end with query, which select another presentation than the
+// live one, such as VOD (see WriteVODMaster); only the live one has debug
+// subtitles and alternate renditions. Write errors are the caller's concern.
+func (p *Playlist) writeMaster(w io.Writer, prefix, query string) {
 	// HLS master playlist header
-	fmt.Fprintln(&b, "#EXTM3U")
-	fmt.Fprintln(&b, "#EXT-X-VERSION:3")
+	fmt.Fprintln(w, "#EXTM3U")
+	fmt.Fprintln(w, "#EXT-X-VERSION:3")
+	subtitles := p.debugSubtitles && prefix == ""
+	if subtitles {
+		writeDebugSubtitlesMedia(w)
+	}
+	renditions := prefix == ""
+	if renditions {
+		p.writeRenditionsMedia(w)
+	}
 
 	// Write variant streams
 	for i, v := range p.variants {
 		// Build #EXT-X-STREAM-INF attributes
-		fmt.Fprint(&b, "#EXT-X-STREAM-INF:")
-		fmt.Fprintf(&b, "BANDWIDTH=%d", v.Bandwidth)
+		fmt.Fprint(w, "#EXT-X-STREAM-INF:")
+		fmt.Fprintf(w, "BANDWIDTH=%d", v.Bandwidth)
 
 		if v.Resolution != "" {
-			fmt.Fprintf(&b, ",RESOLUTION=%s", v.Resolution)
+			fmt.Fprintf(w, ",RESOLUTION=%s", v.Resolution)
 		}
 
 		if v.Codecs != "" {
-			fmt.Fprintf(&b, ",CODECS=\"%s\"", v.Codecs)
+			fmt.Fprintf(w, ",CODECS=\"%s\"", v.Codecs)
+		}
+
+		if renditions && v.Audio != "" {
+			fmt.Fprintf(w, ",AUDIO=\"%s\"", v.Audio)
 		}
 
-		fmt.Fprintln(&b)
+		if subtitles {
+			fmt.Fprintf(w, ",SUBTITLES=\"%s\"", debugSubtitlesGroup)
+		} else if renditions && v.Subtitles != "" {
+			fmt.Fprintf(w, ",SUBTITLES=\"%s\"", v.Subtitles)
+		}
+
+		fmt.Fprintln(w)
 
 		// Write variant playlist URL
-		fmt.Fprintf(&b, "/variant/%d/playlist.m3u8\n", i)
+		fmt.Fprintf(w, "%s/variant/%d/playlist.m3u8%s\n", prefix, i, query)
 	}
-
-	return b.String(), nil
 }
 
 // GenerateVariant creates an HLS media playlist for a specific variant.
 func (p *Playlist) GenerateVariant(variantIndex int) (string, error) {
-	if variantIndex < 0 || variantIndex >= len(p.variantPlaylists) {
-		return "", fmt.Errorf("variant index %d out of range (0-%d)", variantIndex, len(p.variantPlaylists)-1)
+	var b strings.Builder
+	if err := p.WriteVariant(&b, variantIndex); err != nil {
+		return "", err
 	}
+	return b.String(), nil
+}
 
-	// If in cluster mode, sync state from cluster
-	if p.clusterMgr != nil {
-		state := p.clusterMgr.GetState()
-		if len(state.Variants) == 0 || variantIndex >= len(state.Variants) {
-			return "", fmt.Errorf("cluster state not initialized for variant %d", variantIndex)
-		}
+// WriteVariant writes the HLS media playlist for a specific variant to w.
+// Validation errors are returned before anything is written, so callers may
+// still report them to the client.
+func (p *Playlist) WriteVariant(w io.Writer, variantIndex int) error {
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
 
-		// Update variant playlist with cluster state
-		mp := p.variantPlaylists[variantIndex]
-		mp.mu.Lock()
-		mp.currentPosition = state.Variants[variantIndex].CurrentPosition
-		mp.sequenceNumber = state.Variants[variantIndex].SequenceNumber
-		mp.mu.Unlock()
+	if err := p.syncClusterState(variantIndex); err != nil {
+		return err
 	}
 
 	// Delegate to the variant's mediaPlaylist
-	return p.variantPlaylists[variantIndex].generate()
+	return p.variantPlaylists[variantIndex].write(w, false, 0, 0)
+}
+
+// WriteStaleVariant writes the media playlist of a variant as it was
+// behind advances ago, like a CDN serving an outdated cached copy. It cannot
+// go back further than the start of the stream, and dates the segments as
+// they are dated now. Validation errors are returned before anything is
+// written.
+func (p *Playlist) WriteStaleVariant(w io.Writer, variantIndex, behind int) error {
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	if err := p.syncClusterState(variantIndex); err != nil {
+		return err
+	}
+	return p.variantPlaylists[variantIndex].write(w, false, behind, 0)
+}
+
+// sameVariants reports whether the cluster state existing was initialized
+// for the variants of states: the same loop lengths and, if recorded, the same
+// sources.
+func sameVariants(existing, states []cluster.VariantState) bool {
+	if len(existing) == 0 || len(existing) != len(states) {
+		return false
+	}
+	for i, vs := range existing {
+		if vs.TotalSegments != states[i].TotalSegments || (vs.Source != "" && vs.Source != states[i].Source) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncClusterState updates a variant's window from the cluster state in
+// cluster mode, and does nothing otherwise.
+func (p *Playlist) syncClusterState(variantIndex int) error {
+	if p.clusterMgr == nil {
+		return nil
+	}
+
+	state := p.clusterMgr.GetState()
+	if len(state.Variants) == 0 || variantIndex >= len(state.Variants) {
+		return fmt.Errorf("%w: cluster state not initialized for variant %d", ErrNotReady, variantIndex)
+	}
+
+	// Update variant playlist with cluster state
+	mp := p.variantPlaylists[variantIndex]
+	mp.mu.Lock()
+	mp.currentPosition = state.Variants[variantIndex].CurrentPosition
+	mp.sequenceNumber = state.Variants[variantIndex].SequenceNumber
+	mp.mu.Unlock()
+	return nil
 }
 
 // Advance moves the sliding window forward by one segment for all variants.
 func (p *Playlist) Advance() {
+	if p.paused.Load() {
+		p.logger.Debug("window advance paused")
+		return
+	}
+	if p.standby.Load() {
+		// The primary of the standby pair advances, see Follow
+		p.watchdog.advanced()
+		return
+	}
+	defer p.saveState()
+
 	// In cluster mode, only the leader advances
 	if p.clusterMgr != nil {
-		if !p.clusterMgr.IsLeader() {
-			return
-		}
-		if err := p.clusterMgr.AdvanceWindow(); err != nil {
-			p.logger.Error("failed to advance window", "error", err)
-		}
+		p.advanceCluster(p.clusterMgr)
 		return
 	}
 
 	// Non-cluster mode: advance each variant independently
+	now := p.now()
 	for i, mp := range p.variantPlaylists {
-		mp.advance()
+		mp.advance(now)
 		if i == 0 {
 			// Only log for first variant to avoid spam
 			p.logger.Debug("advanced all variant windows",
@@ -176,45 +691,243 @@ func (p *Playlist) Advance() {
 			)
 		}
 	}
+	p.watchdog.advanced()
 }
 
-// StartAutoAdvance starts a goroutine that automatically advances the window
-// based on the target duration.
-func (p *Playlist) StartAutoAdvance(ctx context.Context) {
-	// Use maximum target duration across all variants
+// Replace schedules new segment lists for every variant, for example after a
+// local source file was edited. Each variant switches to its new segments the
+// next time its window loops back to the start, so the current pass through
+// the old content is never cut short. Master playlist attributes and the
+// advance interval are not changed. Replace is not supported in cluster mode,
+// and variants must match the current variants one to one.
+func (p *Playlist) Replace(variants []variant.Variant) error {
+	sources, err := p.replacements(variants)
+	if err != nil {
+		return err
+	}
+	for i, mp := range p.variantPlaylists {
+		mp.schedule(sources[i])
+	}
+
+	p.logger.Info("scheduled segment replacement at next loop boundary", "variants", len(variants))
+	return nil
+}
+
+// replacements checks that variants can replace the current variants and
+// returns their content, one per variant.
+func (p *Playlist) replacements(variants []variant.Variant) ([]*pendingSource, error) {
+	if p.clusterMgr != nil {
+		return nil, fmt.Errorf("replacing segments is not supported in cluster mode")
+	}
+	if p.playlistType != TypeLive {
+		return nil, fmt.Errorf("replacing segments is not supported with %s playlists", strings.ToUpper(string(p.playlistType)))
+	}
+	if len(p.renditions) > 0 {
+		return nil, fmt.Errorf("replacing segments is not supported with alternate renditions")
+	}
+	if len(variants) != len(p.variants) {
+		return nil, fmt.Errorf("variant count changed from %d to %d", len(p.variants), len(variants))
+	}
+	for i, v := range variants {
+		if len(v.Segments) == 0 {
+			return nil, fmt.Errorf("variant %d has zero segments", i)
+		}
+	}
+	if err := p.checkTimeline(variants); err != nil {
+		return nil, err
+	}
+	if p.scaleDurations {
+		variants = scaleVariants(variants, p.timeScale)
+	}
+	segmentCounts := make([]int, len(variants))
+	for i, v := range variants {
+		segmentCounts[i] = len(v.Segments)
+	}
+	windows, err := effectiveWindows(p.windowSize, p.windowPolicy, segmentCounts)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]*pendingSource, len(variants))
+	for i, v := range variants {
+		segments := v.Segments
+		if p.segmentStore != nil {
+			segments = p.segmentStore.Intern(segments)
+		}
+		sources[i] = &pendingSource{
+			segments:       segments,
+			windowSize:     windows[i],
+			targetDuration: v.TargetDuration,
+			version:        playlistVersion(segments, v.Version),
+			headerTags:     v.HeaderTags,
+		}
+	}
+	return sources, nil
+}
+
+// now returns the current time as perceived by this node, including any
+// configured clock skew.
+func (p *Playlist) now() time.Time {
+	return time.Now().Add(p.clockSkew)
+}
+
+// AdvanceInterval returns how often the window advances: the maximum target
+// duration across all variants, in wall clock time (see advanceTime).
+func (p *Playlist) AdvanceInterval() time.Duration {
+	return p.advanceTime(p.targetInterval())
+}
+
+// targetInterval returns the maximum target duration across all variants.
+func (p *Playlist) targetInterval() time.Duration {
 	maxTargetDuration := 0
 	for _, mp := range p.variantPlaylists {
-		if mp.targetDuration > maxTargetDuration {
-			maxTargetDuration = mp.targetDuration
+		mp.mu.RLock()
+		maxTargetDuration = max(maxTargetDuration, mp.targetDuration)
+		mp.mu.RUnlock()
+	}
+	return time.Duration(maxTargetDuration) * time.Second
+}
+
+// MediaSequence returns the current media sequence number of the first
+// variant. In cluster mode it is read from the replicated cluster state.
+func (p *Playlist) MediaSequence() uint64 {
+	if p.clusterMgr != nil {
+		if state := p.clusterMgr.GetState(); len(state.Variants) > 0 {
+			return state.Variants[0].SequenceNumber
 		}
 	}
 
-	interval := time.Duration(maxTargetDuration) * time.Second
+	mp := p.variantPlaylists[0]
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.sequenceNumber
+}
 
-	if p.clusterMgr != nil {
-		p.logger.Info("starting cluster-aware auto-advance",
-			"interval", interval,
-			"variantCount", len(p.variants),
-		)
-	} else {
+// extinfAllowance is how much longer than the target duration a segment may
+// be: HLS requires EXTINF durations to round to at most the target duration.
+const extinfAllowance = 500 * time.Millisecond
+
+// leaderPollInterval is how often a cluster follower checks whether it
+// became the leader and should start advancing.
+const leaderPollInterval = 100 * time.Millisecond
+
+// StartAutoAdvance starts a goroutine that automatically advances the window
+// as fast as the media plays: each advance is due the duration of the
+// segment that leaves the window after the previous one (see advanceDelay).
+// Advances are scheduled from the start of the loop rather than from the
+// previous advance, so timer latency never accumulates into drift. In
+// cluster mode only the leader advances; followers render the replicated
+// state and start advancing when they are elected.
+func (p *Playlist) StartAutoAdvance(ctx context.Context) {
+	// Use maximum target duration across all variants
+	interval := p.AdvanceInterval()
+
+	if p.clusterMgr == nil {
 		p.logger.Info("starting auto-advance for all variants",
 			"interval", interval,
 			"variantCount", len(p.variants),
 		)
+		p.tick(ctx, nil)
+		p.logger.Info("stopping auto-advance")
+		return
 	}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	p.logger.Info("starting cluster-aware auto-advance",
+		"interval", interval,
+		"variantCount", len(p.variants),
+	)
+	for p.awaitLeadership(ctx) {
+		p.logger.Info("advancing the window as cluster leader")
+		p.tick(ctx, p.clusterMgr.IsLeader)
+		if ctx.Err() == nil {
+			p.logger.Info("no longer cluster leader, following the replicated window")
+		}
+	}
+	p.logger.Info("stopping auto-advance")
+}
+
+// tick advances the window on schedule until ctx is done or, if leading is
+// set, until it returns false.
+func (p *Playlist) tick(ctx context.Context, leading func() bool) {
+	interval := p.AdvanceInterval()
+	next := time.Now().Add(p.advanceDelay())
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			p.logger.Info("stopping auto-advance")
 			return
+		case <-timer.C:
+		}
+		if leading != nil && !leading() {
+			return
+		}
+		p.Advance()
+
+		next = next.Add(p.advanceDelay())
+		// Catching up after a suspended process or a slow advance would
+		// fire a burst of advances; start over from now instead
+		if behind := time.Since(next); behind > interval {
+			p.logger.Warn("auto-advance fell behind, rescheduling", "behind", behind.Round(time.Millisecond))
+			next = time.Now()
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// awaitLeadership waits until this node is the cluster leader and reports
+// whether it is, or false once ctx is done. Meanwhile, the advances are the
+// leader's responsibility, so the watchdog counts them as completed as long
+// as there is a leader.
+func (p *Playlist) awaitLeadership(ctx context.Context) bool {
+	ticker := time.NewTicker(leaderPollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		if p.clusterMgr.IsLeader() {
+			return true
+		}
+		if p.clusterMgr.LeaderAddr() != "" {
+			p.watchdog.advanced()
+		}
+		select {
+		case <-ctx.Done():
 		case <-ticker.C:
-			p.Advance()
 		}
 	}
+	return false
+}
+
+// advanceDelay returns how long after an advance the next one is due: the
+// longest duration, across variants, of the segment at the start of the
+// window, which the next advance drops. Durations that no valid playlist
+// has fall back to AdvanceInterval or are capped at it plus extinfAllowance.
+// With DurationsReal, the delay is shortened by the time scale.
+func (p *Playlist) advanceDelay() time.Duration {
+	interval := p.targetInterval()
+	var delay time.Duration
+	for i, mp := range p.variantPlaylists {
+		if err := p.syncClusterState(i); err != nil {
+			return p.advanceTime(interval)
+		}
+		mp.mu.RLock()
+		d := time.Duration(mp.segments[mp.currentPosition].Duration * float64(time.Second))
+		mp.mu.RUnlock()
+		delay = max(delay, d)
+	}
+	if delay <= 0 {
+		return p.advanceTime(interval)
+	}
+	return p.advanceTime(min(delay, interval+extinfAllowance))
+}
+
+// ClusterProgress returns how far each cluster node is in the replicated
+// log, querying the peers, or nil outside cluster mode.
+func (p *Playlist) ClusterProgress(ctx context.Context) []cluster.NodeProgress {
+	if p.clusterMgr == nil {
+		return nil
+	}
+	return p.clusterMgr.ClusterProgress(ctx)
 }
 
 // GetStats returns current statistics about the playlist.
@@ -235,6 +948,15 @@ func (p *Playlist) GetStats() map[string]any {
 			"resolution":     v.Resolution,
 			"total_segments": mpStats["total_segments"],
 			"position":       mpStats["current_position"],
+			"window_size":    mpStats["window_size"],
+			"window_clamped": mpStats["window_size"].(int) < p.windowSize,
+		}
+		if v.MediaSequence > 0 {
+			variantStats[i]["source_media_sequence"] = v.MediaSequence
+		}
+		if v.MeasuredBandwidth > 0 {
+			variantStats[i]["measured_bandwidth"] = v.MeasuredBandwidth
+			variantStats[i]["measured_average_bandwidth"] = v.MeasuredAverageBandwidth
 		}
 	}
 
@@ -248,21 +970,56 @@ func (p *Playlist) GetStats() map[string]any {
 	}
 
 	stats := map[string]any{
-		"is_master":       true,
-		"window_size":     p.variantPlaylists[0].windowSize,
-		"sequence_number": p.variantPlaylists[0].sequenceNumber,
-		"target_duration": maxTargetDuration,
-		"variants":        variantStats,
-		"variant_count":   len(p.variants),
+		"is_master":        true,
+		"window_size":      p.variantPlaylists[0].windowSize,
+		"window_requested": p.windowSize,
+		"window_policy":    p.windowPolicy,
+		"sequence_number":  p.variantPlaylists[0].sequenceNumber,
+		"target_duration":  maxTargetDuration,
+		"variants":         variantStats,
+		"variant_count":    len(p.variants),
+		"prerendered":      p.PreRendered(),
+	}
+	if len(p.renditions) > 0 {
+		stats["rendition_count"] = len(p.renditions)
+	}
+
+	if p.segmentStore != nil {
+		stats["segment_store"] = p.segmentStore.Stats()
+	}
+	stats["watchdog"] = p.watchdogStats()
+	if p.clockSkew != 0 {
+		stats["clock_skew"] = p.clockSkew.String()
+	}
+	if p.timeScale != 1 {
+		stats["time_scale"] = p.timeScale
+		stats["scaled_durations"] = p.scaleDurations
+	}
+	if p.programDateTime != PDTOff {
+		stats["program_date_time"] = p.programDateTime
+	}
+	if p.standby.Load() {
+		stats["standby"] = true
+	}
+	if p.playlistType != TypeLive {
+		stats["playlist_type"] = p.playlistType
+		if p.loops > 0 {
+			stats["playlist_loops"] = p.loops
+		}
 	}
 
 	// Add cluster information if in cluster mode
 	if p.clusterMgr != nil {
 		state := p.clusterMgr.GetState()
 		stats["cluster_mode"] = true
+		stats["cluster_advance"] = p.clusterAdvanceStats()
 		stats["is_leader"] = p.clusterMgr.IsLeader()
 		stats["leader_address"] = p.clusterMgr.LeaderAddr()
 		stats["raft_state"] = p.clusterMgr.State()
+		stats["forwarded_commands"] = p.clusterMgr.ForwardedCommands()
+		if delay := p.clusterMgr.TransportDelay(); delay != "" {
+			stats["raft_delay"] = delay
+		}
 
 		// Update variant stats with cluster state
 		if len(state.Variants) > 0 {
@@ -286,52 +1043,338 @@ type mediaPlaylist struct {
 	windowSize      int
 	currentPosition int
 	sequenceNumber  uint64
+	startSequence   uint64 // sequenceNumber of the first pass, before any resume, or of the last splice
+	startPosition   int    // currentPosition at startSequence (Options.StartPosition)
 	targetDuration  int
+	version         int      // EXT-X-VERSION, raised for features such as EXT-X-MAP
+	headerTags      []string // Custom source header tags passed through verbatim
+	blockingReload  bool     // Advertise CAN-BLOCK-RELOAD (Options.BlockingReload)
+	deltaUpdates    bool     // Advertise CAN-SKIP-UNTIL (Options.DeltaUpdates)
 	logger          *slog.Logger
+
+	// Program date time (Options.ProgramDateTime): the date of the first
+	// segment of the window and, with PDTReset, of the first segment of the
+	// newest pass. See advanceDates.
+	pdtMode ProgramDateTime
+	pdt     time.Time
+	loopPDT time.Time
+
+	// playlistType and loops are Options.Type and Options.Loops; see span.
+	playlistType PlaylistType
+	loops        int
+
+	// simulation alters the entries of the live presentation
+	simulation simulation
+
+	// windows caches the rendered segment lines for each window position
+	// (nil unless pre-rendering is enabled); windowBytes of them are
+	// charged to budget
+	windows     []string
+	windowBytes int64
+	budget      *budget.Budget
+
+	// pending holds replacement content swapped in at the next loop
+	// boundary (nil if none is scheduled)
+	pending *pendingSource
+
+	// spliced holds the content installed once the window has moved past
+	// the segments published before a splice (nil unless splicing, see
+	// splice)
+	spliced *pendingSource
+
+	// cues holds tags inserted at runtime, such as ad break markers, keyed
+	// by the media sequence number of the segment they precede. The map is
+	// replaced, never modified, so write can use it without the lock.
+	cues map[uint64]string
+
+	// keyRotations holds the media sequence numbers at which RotateKeys
+	// started a new key period, ascending. Like cues, it is replaced, never
+	// modified.
+	keyRotations []uint64
+}
+
+// simulation holds the encoder behaviors simulated in the entries of the
+// live media playlists: Options.Gaps, PDTAnomalies and Encryption, and the
+// PDTFormat its dates are written in.
+type simulation struct {
+	gaps       Gaps
+	anomalies  PDTAnomalies
+	encryption Encryption
+	pdtFormat  PDTFormat
+}
+
+// enabled reports whether sim alters any entry.
+func (sim simulation) enabled() bool {
+	return sim.gaps.Every != 0 || sim.anomalies.Enabled() || sim.encryption.Method != EncryptionNone
+}
+
+// pendingSource is replacement content for a mediaPlaylist.
+type pendingSource struct {
+	segments       []segment.Segment
+	windowSize     int
+	targetDuration int
+	version        int
+	headerTags     []string
 }
 
-// generate creates an HLS media playlist for the current window.
-func (mp *mediaPlaylist) generate() (string, error) {
+// write writes an HLS media playlist for the current window to w, or a
+// playlist delta update (see WriteVariantDelta) if delta is set. With behind,
+// the window of that many advances ago is written instead. With depth, the
+// window of a live playlist is extended backward to span it (see
+// WriteDVRVariant).
+// State is snapshotted under the read lock and rendered without holding it,
+// so slow clients never delay window advancement.
+func (mp *mediaPlaylist) write(w io.Writer, delta bool, behind int, depth time.Duration) error {
 	mp.mu.RLock()
-	defer mp.mu.RUnlock()
+	var (
+		segments       = mp.segments
+		windowSize     = mp.windowSize
+		position       = mp.currentPosition
+		sequenceNumber = mp.sequenceNumber
+		targetDuration = mp.targetDuration
+		version        = mp.version
+		headerTags     = mp.headerTags
+		windows        = mp.windows
+		cues           = mp.cues
+		first          = mp.pdt
+		sim            = mp.simulation
+	)
+	sim.encryption.rotations = mp.keyRotations
+	if behind > 0 {
+		behind = int(min(uint64(behind), sequenceNumber-mp.startSequence))
+		for i := 0; i < behind; i++ {
+			position = (position - 1 + len(segments)) % len(segments)
+			first = first.Add(-segmentDuration(segments[position]))
+		}
+		sequenceNumber -= uint64(behind)
+	}
+	dates := programDates(segments, position, windowSize, mp.pdtMode, first, mp.loopPDT)
+	extra := 0
+	if depth > 0 && mp.playlistType == TypeLive {
+		extra = dvrExtension(segments, position, windowSize, sequenceNumber-mp.startSequence, depth)
+		for i := 0; i < extra; i++ {
+			position = (position - 1 + len(segments)) % len(segments)
+			first = first.Add(-segmentDuration(segments[position]))
+		}
+		sequenceNumber -= uint64(extra)
+		windowSize += extra
+		if dates != nil {
+			// Earlier passes are dated continuously, as for start-over
+			dates = append(programDates(segments, position, extra, PDTContinuous, first, time.Time{}), dates...)
+		}
+	}
+	start, sequenceNumber, count, ended := mp.span(position, sequenceNumber, windowSize)
+	mp.mu.RUnlock()
 
-	var b strings.Builder
+	skipped := 0
+	if delta {
+		skipped = skippedSegments(segments, start, count, skipBoundary(targetDuration))
+		if skipped > 0 {
+			version = max(version, deltaUpdateVersion)
+		}
+	}
+	if sim.encryption.Method == EncryptionSampleAES {
+		version = max(version, sampleAESVersion)
+	}
+
+	sw := &stickyWriter{w: w}
 
 	// HLS playlist header
-	fmt.Fprintln(&b, "#EXTM3U")
-	fmt.Fprintln(&b, "#EXT-X-VERSION:3")
-	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", mp.targetDuration)
-	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", mp.sequenceNumber)
+	fmt.Fprintln(sw, "#EXTM3U")
+	fmt.Fprintf(sw, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(sw, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(sw, "#EXT-X-MEDIA-SEQUENCE:%d\n", sim.gaps.renumber(sequenceNumber))
+	if mp.playlistType != TypeLive {
+		fmt.Fprintf(sw, "#EXT-X-PLAYLIST-TYPE:%s\n", strings.ToUpper(string(mp.playlistType)))
+	}
+	writeServerControl(sw, mp.blockingReload, mp.deltaUpdates, targetDuration)
+	for _, tag := range headerTags {
+		fmt.Fprintln(sw, tag)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(sw, "#EXT-X-SKIP:SKIPPED-SEGMENTS=%d\n", skipped)
+	}
 
-	// Get current window of segments
-	windowSegments := mp.getCurrentWindow()
+	if windows != nil && len(cues) == 0 && skipped == 0 && dates == nil && extra == 0 && !sim.enabled() {
+		io.WriteString(sw, windows[position])
+	} else {
+		writeSegments(sw, segments, start, count, skipped, sequenceNumber, cues, dates, sim)
+	}
 
-	// Write segments with discontinuity detection
-	for i, seg := range windowSegments {
-		// Check for discontinuity (loop point)
-		// If this segment's sequence is less than the previous segment's,
-		// we've wrapped around to the beginning
-		if i > 0 && seg.Sequence < windowSegments[i-1].Sequence {
-			fmt.Fprintln(&b, "#EXT-X-DISCONTINUITY")
+	// Live playlists never end; EVENT playlists end after Options.Loops
+	if ended {
+		fmt.Fprintln(sw, "#EXT-X-ENDLIST")
+	}
+
+	return sw.err
+}
+
+// preRender renders the segment lines of every window position.
+func (mp *mediaPlaylist) preRender() error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return mp.cacheWindows()
+}
+
+// cacheWindows renders every window into the cache, charging it to the
+// budget. Caller must hold the write lock.
+func (mp *mediaPlaylist) cacheWindows() error {
+	windows := renderWindows(mp.segments, mp.windowSize)
+	var n int64
+	for _, w := range windows {
+		n += int64(len(w))
+	}
+	if err := mp.budget.ReserveCache("pre-rendered windows", n); err != nil {
+		return err
+	}
+	mp.windows, mp.windowBytes = windows, n
+	return nil
+}
+
+// dropWindows empties the cache and returns its bytes to the budget.
+func (mp *mediaPlaylist) dropWindows() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	mp.releaseWindows()
+}
+
+// releaseWindows is dropWindows for callers that hold the write lock.
+func (mp *mediaPlaylist) releaseWindows() {
+	mp.budget.ReleaseCache(mp.windowBytes)
+	mp.windows, mp.windowBytes = nil, 0
+}
+
+// renderWindows renders the segment lines of every window position.
+func renderWindows(segments []segment.Segment, windowSize int) []string {
+	windows := make([]string, len(segments))
+	for pos := range segments {
+		var b strings.Builder
+		writeSegments(&b, segments, pos, windowSize, 0, 0, nil, nil, simulation{})
+		windows[pos] = b.String()
+	}
+	return windows
+}
+
+// writeSegments writes the entries of the window of windowSize segments
+// starting at position, inserting a discontinuity tag at the loop point and
+// at splice points.
+// The first skip entries are left out (see EXT-X-SKIP). firstSequence is the
+// media sequence number of the first entry; cues holds tags inserted before
+// the entry with a given media sequence number. dates, if not nil, holds the
+// EXT-X-PROGRAM-DATE-TIME of each entry. sim alters the entries.
+func writeSegments(w io.Writer, segments []segment.Segment, position, windowSize, skip int, firstSequence uint64, cues map[uint64]string, dates []time.Time, sim simulation) {
+	totalSegments := len(segments)
+	for i := skip; i < windowSize; i++ {
+		seg := segments[(position+i)%totalSegments]
+
+		// Check for discontinuity (loop or splice point)
+		// If this segment's sequence is not greater than the previous
+		// segment's, we've wrapped around to the beginning of a source
+		discontinuity := false
+		if i > 0 && seg.Sequence <= segments[(position+i-1)%totalSegments].Sequence {
+			fmt.Fprintln(w, "#EXT-X-DISCONTINUITY")
+			discontinuity = true
+		}
+
+		// Declare the key at the start of the window and of every key period
+		if enc := sim.encryption; enc.Method != EncryptionNone {
+			period := enc.period(firstSequence + uint64(i))
+			if i == skip || period != enc.period(firstSequence+uint64(i)-1) {
+				io.WriteString(w, enc.tag(period))
+			}
 		}
 
-		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", seg.Duration)
-		fmt.Fprintln(&b, seg.URL)
+		// Declare the initialization section at the start of the window,
+		// after a loop point, and wherever the source changed it
+		if seg.InitURL != "" {
+			prev := segments[(position+i-1+totalSegments)%totalSegments]
+			if i == skip || discontinuity || seg.InitURL != prev.InitURL || seg.InitByteRange != prev.InitByteRange {
+				writeMap(w, seg)
+			}
+		}
+
+		io.WriteString(w, seg.Tags)
+		io.WriteString(w, cues[firstSequence+uint64(i)])
+		if sim.gaps.lost(firstSequence + uint64(i)) {
+			// The tags above carry over to the next segment
+			if sim.gaps.Mode == GapSkip {
+				continue
+			}
+			fmt.Fprintln(w, "#EXT-X-GAP")
+		}
+		if dates != nil {
+			fmt.Fprintf(w, "#EXT-X-PROGRAM-DATE-TIME:%s\n", sim.anomalies.stamp(firstSequence+uint64(i), dates[i], sim.pdtFormat))
+		}
+		fmt.Fprintf(w, "#EXTINF:%.3f,\n", seg.Duration)
+		if seg.ByteRange != "" {
+			fmt.Fprintf(w, "#EXT-X-BYTERANGE:%s\n", seg.ByteRange)
+		}
+		fmt.Fprintln(w, seg.URL)
+	}
+}
+
+// writeMap writes the EXT-X-MAP tag for a segment's initialization section.
+func writeMap(w io.Writer, seg segment.Segment) {
+	if seg.InitByteRange != "" {
+		fmt.Fprintf(w, "#EXT-X-MAP:URI=\"%s\",BYTERANGE=\"%s\"\n", seg.InitURL, seg.InitByteRange)
+		return
 	}
+	fmt.Fprintf(w, "#EXT-X-MAP:URI=\"%s\"\n", seg.InitURL)
+}
 
-	// NOTE: We do NOT include #EXT-X-ENDLIST because this is a live stream
+// maxSourceVersion is the highest source EXT-X-VERSION carried over to the
+// generated media playlists. Later versions add variable substitution and
+// LL-HLS tags, none of which the generator copies from the source.
+const maxSourceVersion = 7
 
-	return b.String(), nil
+// playlistVersion returns the EXT-X-VERSION of a media playlist of segments
+// whose source declared sourceVersion: the source version, capped at
+// maxSourceVersion, unless the segments need a higher one (6 if any segment
+// has an initialization section (EXT-X-MAP), 4 if any segment is a byte
+// range, otherwise 3).
+func playlistVersion(segments []segment.Segment, sourceVersion int) int {
+	version := 3
+	for _, seg := range segments {
+		if seg.InitURL != "" {
+			version = 6
+			break
+		}
+		if seg.ByteRange != "" {
+			version = 4
+		}
+	}
+	return max(version, min(sourceVersion, maxSourceVersion))
 }
 
-// advance moves the sliding window forward by one segment.
-func (mp *mediaPlaylist) advance() {
+// advance moves the sliding window forward by one segment at now.
+func (mp *mediaPlaylist) advance(now time.Time) {
 	mp.mu.Lock()
 	defer mp.mu.Unlock()
 
+	// Ended playlists no longer change
+	if _, _, _, ended := mp.span(mp.currentPosition, mp.sequenceNumber, mp.windowSize); ended {
+		return
+	}
+
+	if mp.pdtMode != PDTOff {
+		mp.advanceDates(now)
+	}
+
 	totalSegments := len(mp.segments)
 	mp.currentPosition = (mp.currentPosition + 1) % totalSegments
 	mp.sequenceNumber++
+	if len(mp.cues) > 0 {
+		mp.cues = activeCues(mp.cues, mp.sequenceNumber)
+	}
+
+	if mp.currentPosition == 0 && mp.pending != nil {
+		mp.swap()
+	}
+	if mp.spliced != nil && mp.currentPosition == mp.windowSize {
+		mp.finishSplice()
+	}
 
 	mp.logger.Debug("advanced window",
 		"position", mp.currentPosition,
@@ -339,6 +1382,45 @@ func (mp *mediaPlaylist) advance() {
 	)
 }
 
+// schedule stores replacement content to swap in at the next loop boundary,
+// superseding any replacement scheduled earlier.
+func (mp *mediaPlaylist) schedule(next *pendingSource) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.pending = next
+}
+
+// swap installs the pending content. Caller must hold the write lock.
+func (mp *mediaPlaylist) swap() {
+	next := mp.pending
+	mp.pending = nil
+	mp.install(next)
+
+	mp.logger.Info("swapped in replacement segments",
+		"segments", len(mp.segments),
+		"sequence", mp.sequenceNumber,
+	)
+}
+
+// install replaces the content of the playlist with next, keeping the
+// window position. Caller must hold the write lock.
+func (mp *mediaPlaylist) install(next *pendingSource) {
+	mp.segments = next.segments
+	mp.windowSize = next.windowSize
+	mp.targetDuration = next.targetDuration
+	mp.version = next.version
+	mp.headerTags = next.headerTags
+	if mp.windows != nil {
+		// Keep the per-variant share of the pre-render budget
+		mp.releaseWindows()
+		if len(mp.segments)*mp.windowSize <= maxPreRenderLines {
+			if err := mp.cacheWindows(); err != nil {
+				mp.logger.Warn("replacement windows do not fit the cache budget, rendering per request", "error", err)
+			}
+		}
+	}
+}
+
 // getStats returns current statistics about the playlist.
 func (mp *mediaPlaylist) getStats() map[string]any {
 	mp.mu.RLock()
@@ -353,6 +1435,22 @@ func (mp *mediaPlaylist) getStats() map[string]any {
 	}
 }
 
+// stickyWriter wraps an io.Writer and remembers the first write error, so
+// rendering code can write unconditionally and check once at the end.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (sw *stickyWriter) Write(b []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(b)
+	sw.err = err
+	return n, err
+}
+
 // getCurrentWindow returns the current window of segments.
 // Caller must hold at least a read lock.
 func (mp *mediaPlaylist) getCurrentWindow() []segment.Segment {
@@ -0,0 +1,180 @@
+package playlist
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// benchWindowSizes covers typical live windows up to very large DVR windows.
+var benchWindowSizes = []int{6, 60, 600, 6000}
+
+// benchVariantCounts covers single-rendition sources up to large ladders.
+var benchVariantCounts = []int{1, 4, 12}
+
+// newBenchPlaylist creates a playlist with the given ladder size whose variants
+// each hold twice windowSize segments, advanced into a wrapped position so
+// discontinuity detection is exercised.
+func newBenchPlaylist(b *testing.B, variantCount, windowSize int) *Playlist {
+	b.Helper()
+
+	segmentCount := windowSize * 2
+	variants := make([]variant.Variant, variantCount)
+	for i := range variants {
+		segments := make([]segment.Segment, segmentCount)
+		for j := range segments {
+			segments[j] = segment.Segment{
+				URL:          fmt.Sprintf("https://cdn.example.com/v%d/segment%05d.ts", i, j),
+				Duration:     6.006,
+				Sequence:     j,
+				VariantIndex: i,
+			}
+		}
+		variants[i] = variant.Variant{
+			Bandwidth:      800000 * (i + 1),
+			Resolution:     "1280x720",
+			Codecs:         "avc1.4d401f,mp4a.40.2",
+			PlaylistURL:    fmt.Sprintf("https://cdn.example.com/v%d/playlist.m3u8", i),
+			Segments:       segments,
+			TargetDuration: 7,
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := New(variants, windowSize, nil, logger)
+	if err != nil {
+		b.Fatalf("failed to create playlist: %v", err)
+	}
+
+	// Position the window across the loop point
+	for i := 0; i < segmentCount-windowSize/2; i++ {
+		p.Advance()
+	}
+
+	return p
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	for _, variantCount := range benchVariantCounts {
+		b.Run(fmt.Sprintf("variants=%d", variantCount), func(b *testing.B) {
+			p := newBenchPlaylist(b, variantCount, 6)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Generate(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateVariant(b *testing.B) {
+	for _, windowSize := range benchWindowSizes {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			p := newBenchPlaylist(b, 1, windowSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.GenerateVariant(0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWriteVariant measures streaming a rendition without building the
+// whole playlist in memory first.
+func BenchmarkWriteVariant(b *testing.B) {
+	for _, windowSize := range benchWindowSizes {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			p := newBenchPlaylist(b, 1, windowSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := p.WriteVariant(io.Discard, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGenerateAllVariants measures rendering every rendition of a ladder,
+// which is what a full player session fetch costs the origin.
+func BenchmarkGenerateAllVariants(b *testing.B) {
+	for _, variantCount := range benchVariantCounts {
+		for _, windowSize := range benchWindowSizes {
+			b.Run(fmt.Sprintf("variants=%d/window=%d", variantCount, windowSize), func(b *testing.B) {
+				p := newBenchPlaylist(b, variantCount, windowSize)
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					for v := 0; v < variantCount; v++ {
+						if _, err := p.GenerateVariant(v); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGenerateVariantParallel(b *testing.B) {
+	for _, windowSize := range benchWindowSizes {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			p := newBenchPlaylist(b, 1, windowSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := p.GenerateVariant(0); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkAdvance(b *testing.B) {
+	for _, variantCount := range benchVariantCounts {
+		b.Run(fmt.Sprintf("variants=%d", variantCount), func(b *testing.B) {
+			p := newBenchPlaylist(b, variantCount, 6)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				p.Advance()
+			}
+		})
+	}
+}
+
+func BenchmarkGenerateVariantPreRendered(b *testing.B) {
+	for _, windowSize := range benchWindowSizes[:3] {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			p := newBenchPlaylist(b, 1, windowSize)
+			p.preRender()
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := p.GenerateVariant(0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,12 +2,16 @@ package playlist
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/cluster"
 	"github.com/agleyzer/encodersim/internal/segment"
 	"github.com/agleyzer/encodersim/internal/variant"
 )
@@ -319,6 +323,51 @@ func TestAdvance_Looping(t *testing.T) {
 	}
 }
 
+func TestReplace_SwapsAtLoopBoundary(t *testing.T) {
+	logger := createTestLogger()
+	lp, err := New(createSingleVariant(createTestSegments(3), 10), 2, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replacement := createTestSegments(5)
+	for i := range replacement {
+		replacement[i].URL = strings.Replace(replacement[i].URL, "segment", "edited", 1)
+	}
+	lp.Advance()
+	if err := lp.Replace(createSingleVariant(replacement, 10)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	// The old content keeps playing until the window loops
+	lp.Advance()
+	playlist, _ := lp.GenerateVariant(0)
+	if strings.Contains(playlist, "edited") {
+		t.Fatalf("Expected old segments before the loop boundary, got:\n%s", playlist)
+	}
+
+	lp.Advance()
+	playlist, _ = lp.GenerateVariant(0)
+	if !strings.Contains(playlist, "edited0.ts") || strings.Contains(playlist, "segment") {
+		t.Errorf("Expected replacement segments after the loop boundary, got:\n%s", playlist)
+	}
+	if !strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:3\n") {
+		t.Errorf("Expected media sequence to keep counting across the swap, got:\n%s", playlist)
+	}
+
+	variantStats := lp.GetStats()["variants"].([]map[string]any)
+	if variantStats[0]["total_segments"] != 5 {
+		t.Errorf("Expected 5 total segments after swap, got %v", variantStats[0]["total_segments"])
+	}
+}
+
+func TestReplace_VariantCountMismatch(t *testing.T) {
+	lp, _ := New(createTestVariants(2, 3), 2, nil, createTestLogger())
+	if err := lp.Replace(createTestVariants(3, 3)); err == nil {
+		t.Error("Expected error when the variant count changes")
+	}
+}
+
 func TestGetStats(t *testing.T) {
 	logger := createTestLogger()
 	variants := createTestVariants(3, 10)
@@ -399,12 +448,274 @@ func TestGenerateVariant_DiscontinuityTag(t *testing.T) {
 	}
 }
 
+func TestGenerateVariant_PassthroughTags(t *testing.T) {
+	logger := createTestLogger()
+	segments := createTestSegments(4)
+	segments[1].Tags = "#EXT-X-CUSTOM-AD:id=42\n"
+	variants := createSingleVariant(segments, 10)
+	variants[0].HeaderTags = []string{"#EXT-X-CUSTOM-CHANNEL:news"}
+
+	for _, preRender := range []bool{false, true} {
+		lp, err := NewWithOptions(variants, Options{WindowSize: 3, PreRender: preRender}, nil, logger)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		playlist, _ := lp.GenerateVariant(0)
+
+		if !strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-CUSTOM-CHANNEL:news\n") {
+			t.Errorf("Expected header tag after media sequence (prerender=%v), got:\n%s", preRender, playlist)
+		}
+		if !strings.Contains(playlist, "#EXT-X-CUSTOM-AD:id=42\n#EXTINF:10.000,\nhttps://example.com/segment1.ts") {
+			t.Errorf("Expected segment tag before its #EXTINF (prerender=%v), got:\n%s", preRender, playlist)
+		}
+	}
+}
+
+func TestNewWithOptions_PreserveMediaSequence(t *testing.T) {
+	logger := createTestLogger()
+	variants := createSingleVariant(createTestSegments(5), 10)
+	variants[0].MediaSequence = 1000
+
+	tests := []struct {
+		preserve bool
+		want     string
+	}{
+		{preserve: false, want: "#EXT-X-MEDIA-SEQUENCE:1\n"},
+		{preserve: true, want: "#EXT-X-MEDIA-SEQUENCE:1001\n"},
+	}
+
+	for _, tt := range tests {
+		lp, err := NewWithOptions(variants, Options{WindowSize: 3, PreserveMediaSequence: tt.preserve}, nil, logger)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		lp.Advance()
+
+		playlist, _ := lp.GenerateVariant(0)
+		if !strings.Contains(playlist, tt.want) {
+			t.Errorf("preserve=%v: expected %q in playlist, got:\n%s", tt.preserve, tt.want, playlist)
+		}
+	}
+}
+
+func TestNewWithOptions_StartPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string // windows after 0 and 1 advances
+		wantErr bool
+	}{
+		{
+			name: "mid content",
+			opts: Options{StartPosition: 3, StartSequence: 1000},
+			want: []string{
+				"#EXT-X-MEDIA-SEQUENCE:1000\n#EXTINF:10.000,\nhttps://example.com/segment3.ts\n#EXTINF:10.000,\nhttps://example.com/segment4.ts\n#EXT-X-DISCONTINUITY\n",
+				"#EXT-X-MEDIA-SEQUENCE:1001\n#EXTINF:10.000,\nhttps://example.com/segment4.ts\n#EXT-X-DISCONTINUITY\n",
+			},
+		},
+		{
+			name: "sequence only",
+			opts: Options{StartSequence: 42},
+			want: []string{
+				"#EXT-X-MEDIA-SEQUENCE:42\n#EXTINF:10.000,\nhttps://example.com/segment0.ts\n",
+				"#EXT-X-MEDIA-SEQUENCE:43\n#EXTINF:10.000,\nhttps://example.com/segment1.ts\n",
+			},
+		},
+		{name: "negative position", opts: Options{StartPosition: -1}, wantErr: true},
+		{name: "position beyond the loop", opts: Options{StartPosition: 5}, wantErr: true},
+		{name: "sequence with preserved sequence", opts: Options{StartSequence: 1, PreserveMediaSequence: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.WindowSize = 3
+			lp, err := NewWithOptions(createSingleVariant(createTestSegments(5), 10), tt.opts, nil, createTestLogger())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for i, want := range tt.want {
+				if i > 0 {
+					lp.Advance()
+				}
+				if playlist, _ := lp.GenerateVariant(0); !strings.Contains(playlist, want) {
+					t.Errorf("advance %d: expected %q in playlist, got:\n%s", i, want, playlist)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateVariant_MapTags(t *testing.T) {
+	logger := createTestLogger()
+	segments := createTestSegments(4)
+	for i := range segments {
+		segments[i].InitURL = "https://example.com/init-a.mp4"
+	}
+	segments[2].InitURL = "https://example.com/init-b.mp4"
+	segments[3].InitURL = "https://example.com/init-b.mp4"
+	segments[3].InitByteRange = "720@0"
+
+	lp, err := New(createSingleVariant(segments, 10), 3, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Window at position 2 covers segments 2, 3 and (after looping) 0
+	lp.Advance()
+	lp.Advance()
+	playlist, _ := lp.GenerateVariant(0)
+
+	if !strings.Contains(playlist, "#EXT-X-VERSION:6\n") {
+		t.Error("Expected version 6 for playlists with EXT-X-MAP")
+	}
+	wantOrder := []string{
+		`#EXT-X-MAP:URI="https://example.com/init-b.mp4"`,
+		"segment2.ts",
+		`#EXT-X-MAP:URI="https://example.com/init-b.mp4",BYTERANGE="720@0"`,
+		"segment3.ts",
+		"#EXT-X-DISCONTINUITY",
+		`#EXT-X-MAP:URI="https://example.com/init-a.mp4"`,
+		"segment0.ts",
+	}
+	rest := playlist
+	for _, want := range wantOrder {
+		idx := strings.Index(rest, want)
+		if idx < 0 {
+			t.Fatalf("Expected %q in order, got:\n%s", want, playlist)
+		}
+		rest = rest[idx+len(want):]
+	}
+	if n := strings.Count(playlist, "#EXT-X-MAP"); n != 3 {
+		t.Errorf("Expected 3 EXT-X-MAP tags, got %d", n)
+	}
+}
+
+func TestPlaylistVersion(t *testing.T) {
+	plain := createTestSegments(2)
+	byteRange := createTestSegments(2)
+	byteRange[1].ByteRange = "1000@0"
+	fmp4 := createTestSegments(2)
+	fmp4[0].InitURL = "https://example.com/init.mp4"
+
+	tests := []struct {
+		name          string
+		segments      []segment.Segment
+		sourceVersion int
+		want          int
+	}{
+		{"undeclared", plain, 0, 3},
+		{"source below minimum", plain, 2, 3},
+		{"source version honored", plain, 5, 5},
+		{"byte ranges raise source", byteRange, 3, 4},
+		{"source above byte ranges", byteRange, 7, 7},
+		{"init sections raise source", fmp4, 4, 6},
+		{"capped", fmp4, 9, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := playlistVersion(tt.segments, tt.sourceVersion); got != tt.want {
+				t.Errorf("playlistVersion() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// The source version reaches the generated playlist
+	variants := createSingleVariant(plain, 10)
+	variants[0].Version = 5
+	lp, err := New(variants, 2, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if playlist, _ := lp.GenerateVariant(0); !strings.Contains(playlist, "#EXT-X-VERSION:5\n") {
+		t.Errorf("Expected the source version 5, got:\n%s", playlist)
+	}
+}
+
+func TestGenerateVariant_ByteRangeTags(t *testing.T) {
+	logger := createTestLogger()
+	segments := createTestSegments(2)
+	segments[0].ByteRange = "1000@0"
+
+	lp, err := New(createSingleVariant(segments, 10), 2, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	playlist, _ := lp.GenerateVariant(0)
+
+	if !strings.Contains(playlist, "#EXT-X-VERSION:4\n") {
+		t.Error("Expected version 4 for playlists with EXT-X-BYTERANGE")
+	}
+	if !strings.Contains(playlist, "#EXTINF:10.000,\n#EXT-X-BYTERANGE:1000@0\nhttps://example.com/segment0.ts\n") {
+		t.Errorf("Expected byte range between EXTINF and URI, got:\n%s", playlist)
+	}
+	if n := strings.Count(playlist, "#EXT-X-BYTERANGE"); n != 1 {
+		t.Errorf("Expected 1 EXT-X-BYTERANGE tag, got %d", n)
+	}
+}
+
+func TestGenerateVariant_ByteRangesAcrossLoop(t *testing.T) {
+	logger := createTestLogger()
+	segments := []segment.Segment{
+		{URL: "https://example.com/main.mp4", Duration: 4, Sequence: 0, ByteRange: "1000@0"},
+		{URL: "https://example.com/main.mp4", Duration: 4, Sequence: 1, ByteRange: "1200@1000"},
+		{URL: "https://example.com/main.mp4", Duration: 4, Sequence: 2, ByteRange: "800@2200"},
+	}
+
+	lp, err := NewWithOptions(createSingleVariant(segments, 4), Options{WindowSize: 3, PreRender: true}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lp.Advance()
+	lp.Advance()
+	playlist, _ := lp.GenerateVariant(0)
+
+	// Every range keeps its offset, so the first range after the loop point
+	// does not continue the last range before it
+	want := "#EXTINF:4.000,\n#EXT-X-BYTERANGE:800@2200\nhttps://example.com/main.mp4\n" +
+		"#EXT-X-DISCONTINUITY\n" +
+		"#EXTINF:4.000,\n#EXT-X-BYTERANGE:1000@0\nhttps://example.com/main.mp4\n" +
+		"#EXTINF:4.000,\n#EXT-X-BYTERANGE:1200@1000\nhttps://example.com/main.mp4\n"
+	if !strings.Contains(playlist, want) {
+		t.Errorf("Expected explicit ranges across the loop point, got:\n%s", playlist)
+	}
+}
+
+func TestMediaSequenceAndAdvanceInterval(t *testing.T) {
+	logger := createTestLogger()
+	variants := []variant.Variant{
+		{Segments: createTestSegments(5), TargetDuration: 4},
+		{Segments: createTestSegments(5), TargetDuration: 6},
+	}
+	lp, err := New(variants, 3, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if got := lp.AdvanceInterval(); got != 6*time.Second {
+		t.Errorf("AdvanceInterval() = %v, want 6s", got)
+	}
+	if got := lp.MediaSequence(); got != 0 {
+		t.Errorf("MediaSequence() = %d, want 0", got)
+	}
+	lp.Advance()
+	lp.Advance()
+	if got := lp.MediaSequence(); got != 2 {
+		t.Errorf("MediaSequence() after two advances = %d, want 2", got)
+	}
+}
+
 func TestStartAutoAdvance(t *testing.T) {
 	logger := createTestLogger()
-	// Create variants with 1 second target duration for faster testing
+	// Create variants with 1 second segments for faster testing
 	variants := createTestVariants(3, 10)
 	for i := range variants {
 		variants[i].TargetDuration = 1
+		for j := range variants[i].Segments {
+			variants[i].Segments[j].Duration = 1
+		}
 	}
 	lp, _ := New(variants, 3, nil, logger)
 
@@ -434,6 +745,64 @@ func TestStartAutoAdvance(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 }
 
+func TestAdvanceDelay(t *testing.T) {
+	durations := func(d ...float64) []segment.Segment {
+		segments := make([]segment.Segment, len(d))
+		for i := range d {
+			segments[i] = segment.Segment{URL: fmt.Sprintf("seg%d.ts", i), Duration: d[i], Sequence: i}
+		}
+		return segments
+	}
+	tests := []struct {
+		name     string
+		variants [][]segment.Segment
+		want     []time.Duration // after 0, 1, 2... advances
+	}{
+		{"segment leaving the window", [][]segment.Segment{durations(9.9, 10.1, 10)}, []time.Duration{9900 * time.Millisecond, 10100 * time.Millisecond, 10 * time.Second, 9900 * time.Millisecond}},
+		{"longest across variants", [][]segment.Segment{durations(6, 4), durations(4, 6)}, []time.Duration{6 * time.Second, 6 * time.Second}},
+		{"missing duration", [][]segment.Segment{durations(0, 10)}, []time.Duration{10 * time.Second, 10 * time.Second}},
+		{"longer than the target duration", [][]segment.Segment{durations(30, 10)}, []time.Duration{10500 * time.Millisecond, 10 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variants := make([]variant.Variant, len(tt.variants))
+			for i, segments := range tt.variants {
+				variants[i] = variant.Variant{Segments: segments, TargetDuration: 10}
+			}
+			lp, err := New(variants, 1, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for i, want := range tt.want {
+				if got := lp.advanceDelay(); got != want {
+					t.Errorf("advanceDelay() after %d advances = %v, want %v", i, got, want)
+				}
+				lp.Advance()
+			}
+		})
+	}
+}
+
+func TestStartAutoAdvance_SegmentDurations(t *testing.T) {
+	// Alternating 100ms and 300ms segments advance 10 times in 2s, where a
+	// fixed tick at the target duration would advance twice
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 0.1, Sequence: 0},
+		{URL: "seg1.ts", Duration: 0.3, Sequence: 1},
+	}
+	lp, err := New(createSingleVariant(segments, 1), 1, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2050*time.Millisecond)
+	defer cancel()
+	lp.StartAutoAdvance(ctx)
+
+	if got := lp.MediaSequence(); got < 9 || got > 10 {
+		t.Errorf("MediaSequence() after 2s = %d, want 10", got)
+	}
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	logger := createTestLogger()
 	variants := createTestVariants(3, 20)
@@ -467,3 +836,272 @@ func TestConcurrentAccess(t *testing.T) {
 
 	cancel()
 }
+
+func TestNewWithOptions_PreRenderMatchesDynamic(t *testing.T) {
+	logger := createTestLogger()
+	variants := createTestVariants(2, 7)
+
+	dynamic, err := NewWithOptions(variants, Options{WindowSize: 3}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cached, err := NewWithOptions(variants, Options{WindowSize: 3, PreRender: true}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !cached.GetStats()["prerendered"].(bool) {
+		t.Error("Expected prerendered to be true")
+	}
+	if dynamic.GetStats()["prerendered"].(bool) {
+		t.Error("Expected prerendered to be false without PreRender")
+	}
+
+	wantMaster, _ := dynamic.Generate()
+	gotMaster, _ := cached.Generate()
+	if gotMaster != wantMaster {
+		t.Errorf("Pre-rendered master differs:\ngot:\n%s\nwant:\n%s", gotMaster, wantMaster)
+	}
+
+	// Walk through more than one full loop so every position and the wrap are compared
+	for step := 0; step < 16; step++ {
+		for v := range variants {
+			want, err := dynamic.GenerateVariant(v)
+			if err != nil {
+				t.Fatalf("GenerateVariant(%d) error: %v", v, err)
+			}
+			got, err := cached.GenerateVariant(v)
+			if err != nil {
+				t.Fatalf("GenerateVariant(%d) error: %v", v, err)
+			}
+			if got != want {
+				t.Fatalf("Step %d variant %d: pre-rendered output differs:\ngot:\n%s\nwant:\n%s", step, v, got, want)
+			}
+		}
+		dynamic.Advance()
+		cached.Advance()
+	}
+}
+
+func TestNewWithOptions_PreRenderTooLarge(t *testing.T) {
+	logger := createTestLogger()
+	segments := createTestSegments(2000)
+	variants := createSingleVariant(segments, 10)
+
+	lp, err := NewWithOptions(variants, Options{WindowSize: 1000, PreRender: true}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if lp.GetStats()["prerendered"].(bool) {
+		t.Error("Expected pre-rendering to be skipped for oversized source")
+	}
+	if _, err := lp.GenerateVariant(0); err != nil {
+		t.Errorf("Expected dynamic rendering to work, got %v", err)
+	}
+}
+
+func TestNewWithOptions_PreRenderBudget(t *testing.T) {
+	logger := createTestLogger()
+	variants := createTestVariants(2, 5)
+
+	// Measure the size of the windows
+	unbounded, err := budget.New(budget.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithOptions(variants, Options{WindowSize: 3, PreRender: true, Budget: unbounded}, nil, logger); err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	size := unbounded.Stats().CacheBytes
+	if size == 0 {
+		t.Fatal("pre-rendered windows were not charged")
+	}
+
+	// One byte short: the first variant fits, the second does not
+	tight, err := budget.New(budget.Limits{CacheBytes: size - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lp, err := NewWithOptions(variants, Options{WindowSize: 3, PreRender: true, Budget: tight}, nil, logger)
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if lp.PreRendered() {
+		t.Error("pre-rendered over the cache budget")
+	}
+	if stats := tight.Stats(); stats.CacheBytes != 0 || stats.Refused["cache"] != 1 {
+		t.Errorf("budget stats = %+v, want the first variant's bytes returned and one refusal", stats)
+	}
+	if _, err := lp.GenerateVariant(1); err != nil {
+		t.Errorf("GenerateVariant() error = %v", err)
+	}
+}
+
+func TestNewWithOptions_SegmentStore(t *testing.T) {
+	logger := createTestLogger()
+	store := segment.NewStore()
+
+	// Two channels built from the same source
+	first, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, SegmentStore: store}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	second, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, SegmentStore: store}, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if &first.variantPlaylists[0].segments[0] != &second.variantPlaylists[0].segments[0] {
+		t.Error("Expected replicated playlists to share segment storage")
+	}
+	if &first.variants[1].Segments[0] != &first.variantPlaylists[1].segments[0] {
+		t.Error("Expected variant metadata to reference the shared segments")
+	}
+
+	stats := first.GetStats()["segment_store"].(segment.StoreStats)
+	if stats.UniqueLists != 2 || stats.References != 4 {
+		t.Errorf("Expected 2 unique lists and 4 references, got %+v", stats)
+	}
+
+	want, _ := first.GenerateVariant(1)
+	got, _ := second.GenerateVariant(1)
+	if got != want {
+		t.Error("Expected replicated playlists to render identically")
+	}
+}
+
+func TestWriteVariant_MatchesGenerateVariant(t *testing.T) {
+	logger := createTestLogger()
+	variants := createTestVariants(2, 10)
+
+	for _, opts := range []Options{{WindowSize: 3}, {WindowSize: 3, PreRender: true}} {
+		lp, err := NewWithOptions(variants, opts, nil, logger)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		lp.Advance()
+
+		for i := range variants {
+			want, _ := lp.GenerateVariant(i)
+			var b strings.Builder
+			if err := lp.WriteVariant(&b, i); err != nil {
+				t.Fatalf("WriteVariant(%d) error = %v", i, err)
+			}
+			if b.String() != want {
+				t.Errorf("WriteVariant(%d) (prerender=%v) differs from GenerateVariant", i, opts.PreRender)
+			}
+		}
+
+		want, _ := lp.Generate()
+		var b strings.Builder
+		if err := lp.WriteMaster(&b); err != nil {
+			t.Fatalf("WriteMaster() error = %v", err)
+		}
+		if b.String() != want {
+			t.Errorf("WriteMaster() (prerender=%v) differs from Generate", opts.PreRender)
+		}
+	}
+}
+
+// failingWriter accepts limit bytes and then fails every write.
+type failingWriter struct {
+	limit int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		n := f.limit
+		f.limit = 0
+		return n, errWriteFailed
+	}
+	f.limit -= len(p)
+	return len(p), nil
+}
+
+func TestWriteVariant_PropagatesWriteError(t *testing.T) {
+	logger := createTestLogger()
+	lp, _ := New(createTestVariants(2, 10), 3, nil, logger)
+
+	if err := lp.WriteVariant(&failingWriter{limit: 20}, 0); !errors.Is(err, errWriteFailed) {
+		t.Errorf("WriteVariant() error = %v, want %v", err, errWriteFailed)
+	}
+	if err := lp.WriteMaster(&failingWriter{limit: 20}); !errors.Is(err, errWriteFailed) {
+		t.Errorf("WriteMaster() error = %v, want %v", err, errWriteFailed)
+	}
+	if err := lp.WriteVariant(&failingWriter{}, 99); err == nil || errors.Is(err, errWriteFailed) {
+		t.Errorf("WriteVariant() with invalid index error = %v, want validation error", err)
+	}
+}
+
+func TestWriteStaleVariant(t *testing.T) {
+	for _, preRender := range []bool{false, true} {
+		lp, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, PreRender: preRender}, nil, createTestLogger())
+		if err != nil {
+			t.Fatalf("NewWithOptions() error = %v", err)
+		}
+
+		// Record the live playlists, then serve them stale
+		var live []string
+		for i := 0; i < 7; i++ {
+			playlist, _ := lp.GenerateVariant(1)
+			live = append(live, playlist)
+			lp.Advance()
+		}
+		tests := []struct {
+			behind int
+			want   string
+		}{
+			{0, ""}, // the live playlist
+			{2, live[5]},
+			{7, live[0]},
+			{100, live[0]}, // never before the start of the stream
+		}
+		for _, tt := range tests {
+			var b strings.Builder
+			if err := lp.WriteStaleVariant(&b, 1, tt.behind); err != nil {
+				t.Fatalf("WriteStaleVariant() error = %v", err)
+			}
+			want := tt.want
+			if want == "" {
+				want, _ = lp.GenerateVariant(1)
+			}
+			if b.String() != want {
+				t.Errorf("WriteStaleVariant(%d) with preRender=%v =\n%s\nwant\n%s", tt.behind, preRender, b.String(), want)
+			}
+		}
+	}
+
+	lp, _ := New(createTestVariants(1, 5), 3, nil, createTestLogger())
+	if err := lp.WriteStaleVariant(&strings.Builder{}, 1, 1); err == nil {
+		t.Error("WriteStaleVariant() with an invalid index: expected an error")
+	}
+}
+
+func TestSameVariants(t *testing.T) {
+	states := []cluster.VariantState{
+		{TotalSegments: 5, Source: "low.m3u8"},
+		{TotalSegments: 6, Source: "high.m3u8"},
+	}
+	tests := []struct {
+		name     string
+		existing []cluster.VariantState
+		want     bool
+	}{
+		{"not initialized", nil, false},
+		{"same", []cluster.VariantState{{TotalSegments: 5, Source: "low.m3u8", SequenceNumber: 9}, {TotalSegments: 6, Source: "high.m3u8"}}, true},
+		{"no sources recorded", []cluster.VariantState{{TotalSegments: 5}, {TotalSegments: 6}}, true},
+		{"other variant count", states[:1], false},
+		{"other loop length", []cluster.VariantState{{TotalSegments: 5, Source: "low.m3u8"}, {TotalSegments: 7, Source: "high.m3u8"}}, false},
+		{"swapped sources", []cluster.VariantState{{TotalSegments: 5, Source: "high.m3u8"}, {TotalSegments: 6, Source: "low.m3u8"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameVariants(tt.existing, states); got != tt.want {
+				t.Errorf("sameVariants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
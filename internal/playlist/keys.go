@@ -0,0 +1,143 @@
+package playlist
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The live media playlists can declare their segments encrypted with
+// EXT-X-KEY tags, to exercise the key fetching paths of players and DRM
+// clients. The segments themselves are the source's and are not encrypted
+// by encodersim, which never touches them. Keys rotate every Rotation media
+// sequence numbers: key period N uses the key with ID N, served by
+// WriteKey, and IV N, so that every request, cluster node and restart agrees
+// on them.
+
+// EncryptionMethod is the METHOD of the EXT-X-KEY tags.
+type EncryptionMethod string
+
+const (
+	// EncryptionNone declares no keys.
+	EncryptionNone EncryptionMethod = ""
+
+	// EncryptionAES128 declares whole segments encrypted with AES-128.
+	EncryptionAES128 EncryptionMethod = "AES-128"
+
+	// EncryptionSampleAES declares media samples encrypted with SAMPLE-AES,
+	// which needs protocol version 5.
+	EncryptionSampleAES EncryptionMethod = "SAMPLE-AES"
+)
+
+// sampleAESVersion is the protocol version SAMPLE-AES requires.
+const sampleAESVersion = 5
+
+// ParseEncryptionMethod parses an encryption method name, case-insensitively.
+// An empty name selects EncryptionNone.
+func ParseEncryptionMethod(s string) (EncryptionMethod, error) {
+	switch EncryptionMethod(strings.ToUpper(strings.TrimSpace(s))) {
+	case EncryptionNone, "NONE":
+		return EncryptionNone, nil
+	case EncryptionAES128, "AES128":
+		return EncryptionAES128, nil
+	case EncryptionSampleAES, "SAMPLEAES":
+		return EncryptionSampleAES, nil
+	default:
+		return "", fmt.Errorf("unknown encryption method %q (expected aes-128 or sample-aes)", s)
+	}
+}
+
+// DefaultKeyURI is the key URI of Encryption if none is set: the keys that
+// WriteKey serves.
+const DefaultKeyURI = "/keys/{id}"
+
+// Encryption declares the segments of the live media playlists encrypted.
+type Encryption struct {
+	// Method is the METHOD of the EXT-X-KEY tags; EncryptionNone disables
+	// them.
+	Method EncryptionMethod
+
+	// URI is the key URI, in which {id} is replaced by the key ID
+	// (DefaultKeyURI if empty).
+	URI string
+
+	// Rotation is how many media sequence numbers a key period lasts; 0
+	// never rotates.
+	Rotation uint64
+
+	// rotations holds the media sequence numbers at which RotateKeys
+	// started a new key period, ascending.
+	rotations []uint64
+}
+
+// period returns the key period of the segment with media sequence number
+// sequence: its period on the Rotation schedule, moved on by every
+// RotateKeys before it.
+func (e Encryption) period(sequence uint64) uint64 {
+	var period uint64
+	if e.Rotation != 0 {
+		period = sequence / e.Rotation
+	}
+	for _, start := range e.rotations {
+		if start > sequence {
+			break
+		}
+		period++
+	}
+	return period
+}
+
+// tag returns the EXT-X-KEY tag of key period period.
+func (e Encryption) tag(period uint64) string {
+	uri := e.URI
+	if uri == "" {
+		uri = DefaultKeyURI
+	}
+	uri = strings.ReplaceAll(uri, "{id}", strconv.FormatUint(period, 10))
+	return fmt.Sprintf("#EXT-X-KEY:METHOD=%s,URI=\"%s\",IV=0x%032x\n", e.Method, uri, period)
+}
+
+// EncryptionEnabled reports whether the live media playlists declare keys,
+// and WriteKey serves them.
+func (p *Playlist) EncryptionEnabled() bool {
+	return p.encryption.Method != EncryptionNone
+}
+
+// RotateKeys starts a new key period at the next segment to enter each
+// variant's window, ahead of the Rotation schedule, simulating an
+// unscheduled key rotation; the segments already in the windows keep their
+// keys. Like InsertAdBreak, the rotation is local to this node and is not
+// kept across restarts.
+func (p *Playlist) RotateKeys() error {
+	if !p.EncryptionEnabled() {
+		return fmt.Errorf("encryption is not enabled")
+	}
+
+	clusterSequences := p.clusterSequences()
+	for i, mp := range p.variantPlaylists {
+		mp.mu.Lock()
+		current := mp.sequenceNumber
+		if i < len(clusterSequences) {
+			current = clusterSequences[i]
+		}
+		mp.keyRotations = append(slices.Clip(mp.keyRotations), current+uint64(mp.windowSize))
+		mp.mu.Unlock()
+	}
+
+	p.logger.Info("rotated keys")
+	return nil
+}
+
+// WriteKey writes the 16-byte key with ID id to w. The keys are derived
+// from their IDs, so they are dummies that anyone can compute.
+func (p *Playlist) WriteKey(w io.Writer, id uint64) error {
+	if !p.EncryptionEnabled() {
+		return fmt.Errorf("encryption is not enabled")
+	}
+	sum := sha256.Sum256([]byte("encodersim key " + strconv.FormatUint(id, 10)))
+	_, err := w.Write(sum[:16])
+	return err
+}
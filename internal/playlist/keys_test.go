@@ -0,0 +1,206 @@
+package playlist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestParseEncryptionMethod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    EncryptionMethod
+		wantErr bool
+	}{
+		{"", EncryptionNone, false},
+		{"none", EncryptionNone, false},
+		{"aes-128", EncryptionAES128, false},
+		{"AES128", EncryptionAES128, false},
+		{"sample-aes", EncryptionSampleAES, false},
+		{"aes-256", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEncryptionMethod(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEncryptionMethod(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestWriteVariant_Encryption(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 6, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+		{URL: "seg3.ts", Duration: 6, Sequence: 3},
+		{URL: "seg4.ts", Duration: 6, Sequence: 4},
+	}
+
+	tests := []struct {
+		name        string
+		encryption  Encryption
+		advances    int
+		wantKeys    []string
+		wantVersion string
+	}{
+		{
+			name:        "single key",
+			encryption:  Encryption{Method: EncryptionAES128},
+			advances:    2,
+			wantKeys:    []string{`#EXT-X-KEY:METHOD=AES-128,URI="/keys/0",IV=0x00000000000000000000000000000000`},
+			wantVersion: "#EXT-X-VERSION:3\n",
+		},
+		{
+			name:       "rotation",
+			encryption: Encryption{Method: EncryptionAES128, URI: "https://keys.example.com/{id}.key", Rotation: 3},
+			advances:   2,
+			wantKeys: []string{
+				`#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/0.key",IV=0x00000000000000000000000000000000`,
+				`#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/1.key",IV=0x00000000000000000000000000000001`,
+			},
+			wantVersion: "#EXT-X-VERSION:3\n",
+		},
+		{
+			name:        "sample-aes",
+			encryption:  Encryption{Method: EncryptionSampleAES, Rotation: 3},
+			advances:    3,
+			wantKeys:    []string{`#EXT-X-KEY:METHOD=SAMPLE-AES,URI="/keys/1",IV=0x00000000000000000000000000000001`},
+			wantVersion: "#EXT-X-VERSION:5\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 3, Encryption: tt.encryption}, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			for range tt.advances {
+				lp.Advance()
+			}
+			playlist, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+			var keys []string
+			for _, line := range strings.Split(playlist, "\n") {
+				if strings.HasPrefix(line, "#EXT-X-KEY:") {
+					keys = append(keys, line)
+				}
+			}
+			if strings.Join(keys, "\n") != strings.Join(tt.wantKeys, "\n") {
+				t.Errorf("keys:\n%s\nwant:\n%s", strings.Join(keys, "\n"), strings.Join(tt.wantKeys, "\n"))
+			}
+			if !strings.Contains(playlist, tt.wantVersion) {
+				t.Errorf("Expected %q:\n%s", strings.TrimSpace(tt.wantVersion), playlist)
+			}
+		})
+	}
+}
+
+func TestNewWithOptions_EncryptionErrors(t *testing.T) {
+	segments := []segment.Segment{{URL: "seg0.ts", Duration: 6, Sequence: 0}}
+	tests := []struct {
+		name       string
+		encryption Encryption
+	}{
+		{"rotation without method", Encryption{Rotation: 3}},
+		{"uri without method", Encryption{URI: "/k/{id}"}},
+		{"quoted uri", Encryption{Method: EncryptionAES128, URI: `/k"{id}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 1, Encryption: tt.encryption}, nil, createTestLogger()); err == nil {
+				t.Error("NewWithOptions() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	segments := createTestSegments(10)
+	tests := []struct {
+		name       string
+		encryption Encryption
+		advances   int
+		wantKeys   []string
+	}{
+		{"window before the rotation", Encryption{Method: EncryptionAES128}, 0, []string{"/keys/0"}},
+		{"rotation enters the window", Encryption{Method: EncryptionAES128}, 1, []string{"/keys/0", "/keys/1"}},
+		{"rotation at the window start", Encryption{Method: EncryptionAES128}, 3, []string{"/keys/1"}},
+		{"on top of the schedule", Encryption{Method: EncryptionAES128, Rotation: 4}, 3, []string{"/keys/1", "/keys/2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewWithOptions(createSingleVariant(segments, 10), Options{WindowSize: 3, Encryption: tt.encryption}, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			// The new key period starts at sequence 3, the next segment to
+			// enter the window
+			if err := lp.RotateKeys(); err != nil {
+				t.Fatalf("RotateKeys() error = %v", err)
+			}
+			for range tt.advances {
+				lp.Advance()
+			}
+			playlist, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+			var keys []string
+			for _, line := range strings.Split(playlist, "\n") {
+				if uri, ok := strings.CutPrefix(line, `#EXT-X-KEY:METHOD=AES-128,URI="`); ok {
+					keys = append(keys, uri[:strings.IndexByte(uri, '"')])
+				}
+			}
+			if strings.Join(keys, " ") != strings.Join(tt.wantKeys, " ") {
+				t.Errorf("keys = %v, want %v:\n%s", keys, tt.wantKeys, playlist)
+			}
+		})
+	}
+
+	lp, err := New(createSingleVariant(segments, 10), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := lp.RotateKeys(); err == nil {
+		t.Error("RotateKeys() without encryption succeeded, want error")
+	}
+}
+
+func TestWriteKey(t *testing.T) {
+	segments := []segment.Segment{{URL: "seg0.ts", Duration: 6, Sequence: 0}}
+	lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 1, Encryption: Encryption{Method: EncryptionAES128}}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+
+	var k0, k0again, k1 bytes.Buffer
+	for _, w := range []struct {
+		buf *bytes.Buffer
+		id  uint64
+	}{{&k0, 0}, {&k0again, 0}, {&k1, 1}} {
+		if err := lp.WriteKey(w.buf, w.id); err != nil {
+			t.Fatalf("WriteKey(%d) error = %v", w.id, err)
+		}
+	}
+	if k0.Len() != 16 {
+		t.Errorf("key is %d bytes, want 16", k0.Len())
+	}
+	if !bytes.Equal(k0.Bytes(), k0again.Bytes()) {
+		t.Error("key 0 differs between calls")
+	}
+	if bytes.Equal(k0.Bytes(), k1.Bytes()) {
+		t.Error("keys 0 and 1 are equal")
+	}
+
+	plain, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 1}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if err := plain.WriteKey(&k0, 0); err == nil {
+		t.Error("WriteKey() without encryption error = nil, want error")
+	}
+}
@@ -0,0 +1,102 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// ErrDeltaUpdatesDisabled is returned by WriteVariantDelta when the playlist
+// was created without Options.DeltaUpdates.
+var ErrDeltaUpdatesDisabled = errors.New("playlist delta updates are not enabled")
+
+// deltaUpdateVersion is the EXT-X-VERSION required by EXT-X-SKIP.
+const deltaUpdateVersion = 9
+
+// BlockingReloadEnabled reports whether the variant playlists advertise
+// blocking playlist reload.
+func (p *Playlist) BlockingReloadEnabled() bool {
+	return p.blockingReload
+}
+
+// DeltaUpdatesEnabled reports whether WriteVariantDelta serves delta updates.
+func (p *Playlist) DeltaUpdatesEnabled() bool {
+	return p.deltaUpdates
+}
+
+// LastMediaSequence returns the media sequence number of the last segment in
+// a variant's current window, the live edge a blocking playlist reload
+// (_HLS_msn) waits for.
+func (p *Playlist) LastMediaSequence(variantIndex int) (uint64, error) {
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return 0, fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	if err := p.syncClusterState(variantIndex); err != nil {
+		return 0, err
+	}
+
+	mp := p.variantPlaylists[variantIndex]
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return mp.sequenceNumber + uint64(mp.windowSize) - 1, nil
+}
+
+// WriteVariantDelta writes a playlist delta update (_HLS_skip=YES) for a
+// specific variant to w: the media playlist with the segments older than the
+// skip boundary replaced by an EXT-X-SKIP tag. Validation errors are returned
+// before anything is written.
+func (p *Playlist) WriteVariantDelta(w io.Writer, variantIndex int) error {
+	if !p.DeltaUpdatesEnabled() {
+		return ErrDeltaUpdatesDisabled
+	}
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	if err := p.syncClusterState(variantIndex); err != nil {
+		return err
+	}
+	return p.variantPlaylists[variantIndex].write(w, true, 0, 0)
+}
+
+// writeServerControl writes the EXT-X-SERVER-CONTROL tag for the enabled
+// LL-HLS features, if any.
+func writeServerControl(w io.Writer, blockingReload, deltaUpdates bool, targetDuration int) {
+	if !blockingReload && !deltaUpdates {
+		return
+	}
+	io.WriteString(w, "#EXT-X-SERVER-CONTROL:")
+	if blockingReload {
+		io.WriteString(w, "CAN-BLOCK-RELOAD=YES")
+		if deltaUpdates {
+			io.WriteString(w, ",")
+		}
+	}
+	if deltaUpdates {
+		fmt.Fprintf(w, "CAN-SKIP-UNTIL=%.1f", skipBoundary(targetDuration))
+	}
+	fmt.Fprintln(w)
+}
+
+// skipBoundary returns CAN-SKIP-UNTIL in seconds: six target durations, the
+// minimum the HLS specification allows.
+func skipBoundary(targetDuration int) float64 {
+	return float64(6 * targetDuration)
+}
+
+// skippedSegments returns how many segments at the start of the window a
+// delta update skips: those that begin more than boundary seconds before the
+// end of the window.
+func skippedSegments(segments []segment.Segment, position, windowSize int, boundary float64) int {
+	remaining := 0.0 // from the start of the next segment to the end of the window
+	for i := 0; i < windowSize; i++ {
+		remaining += segments[(position+i)%len(segments)].Duration
+	}
+	skipped := 0
+	for skipped < windowSize && remaining > boundary {
+		remaining -= segments[(position+skipped)%len(segments)].Duration
+		skipped++
+	}
+	return skipped
+}
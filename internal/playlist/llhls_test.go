@@ -0,0 +1,102 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestServerControl(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"disabled", Options{WindowSize: 3}, ""},
+		{"blocking reload", Options{WindowSize: 3, BlockingReload: true}, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES\n"},
+		{"delta updates", Options{WindowSize: 3, DeltaUpdates: true}, "#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=60.0\n"},
+		{"both", Options{WindowSize: 3, BlockingReload: true, DeltaUpdates: true}, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,CAN-SKIP-UNTIL=60.0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewWithOptions(createTestVariants(1, 4), tt.opts, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			got, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+			if tt.want == "" && strings.Contains(got, "#EXT-X-SERVER-CONTROL") {
+				t.Errorf("Expected no EXT-X-SERVER-CONTROL:\n%s", got)
+			}
+			if tt.want != "" && !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:0\n"+tt.want) {
+				t.Errorf("Expected %q after the media sequence:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWriteVariantDelta(t *testing.T) {
+	for _, preRender := range []bool{false, true} {
+		lp, err := NewWithOptions(createTestVariants(1, 10), Options{WindowSize: 8, DeltaUpdates: true, PreRender: preRender}, nil, createTestLogger())
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		// Window [5..9 | 0 1 2]: the loop point is after the skip boundary
+		for i := 0; i < 5; i++ {
+			lp.Advance()
+		}
+
+		var b strings.Builder
+		if err := lp.WriteVariantDelta(&b, 0); err != nil {
+			t.Fatalf("WriteVariantDelta() error = %v", err)
+		}
+		// 80s window, 60s skip boundary: the segments starting 80s and 70s
+		// before the end are skipped
+		want := "#EXTM3U\n#EXT-X-VERSION:9\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n" +
+			"#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=60.0\n#EXT-X-SKIP:SKIPPED-SEGMENTS=2\n" +
+			"#EXTINF:10.000,\nhttps://example.com/v0_seg7.ts\n" +
+			"#EXTINF:10.000,\nhttps://example.com/v0_seg8.ts\n" +
+			"#EXTINF:10.000,\nhttps://example.com/v0_seg9.ts\n" +
+			"#EXT-X-DISCONTINUITY\n#EXTINF:10.000,\nhttps://example.com/v0_seg0.ts\n" +
+			"#EXTINF:10.000,\nhttps://example.com/v0_seg1.ts\n" +
+			"#EXTINF:10.000,\nhttps://example.com/v0_seg2.ts\n"
+		if b.String() != want {
+			t.Errorf("WriteVariantDelta() with preRender=%v =\n%s\nwant\n%s", preRender, b.String(), want)
+		}
+
+		last, err := lp.LastMediaSequence(0)
+		if err != nil || last != 12 {
+			t.Errorf("LastMediaSequence() = %d, %v, want 12", last, err)
+		}
+	}
+}
+
+func TestWriteVariantDelta_NothingToSkip(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3, DeltaUpdates: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var delta strings.Builder
+	if err := lp.WriteVariantDelta(&delta, 0); err != nil {
+		t.Fatalf("WriteVariantDelta() error = %v", err)
+	}
+	full, _ := lp.GenerateVariant(0)
+	if delta.String() != full {
+		t.Errorf("Expected a window within the skip boundary to be served whole:\n%s", delta.String())
+	}
+}
+
+func TestWriteVariantDelta_Disabled(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := lp.WriteVariantDelta(&strings.Builder{}, 0); !errors.Is(err, ErrDeltaUpdatesDisabled) {
+		t.Errorf("WriteVariantDelta() error = %v, want ErrDeltaUpdatesDisabled", err)
+	}
+	if _, err := lp.LastMediaSequence(3); err == nil {
+		t.Error("LastMediaSequence() with an invalid index: expected an error")
+	}
+}
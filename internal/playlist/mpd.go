@@ -0,0 +1,173 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/dash"
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// ErrDASHDisabled is returned by WriteMPD when the playlist was created
+// without Options.DASH.
+var ErrDASHDisabled = errors.New("DASH output is not enabled")
+
+// mpdSnapshotAttempts is how often WriteMPD retries when an advance lands
+// between the snapshots of two variants.
+const mpdSnapshotAttempts = 3
+
+// initDASH checks that the variants can be served as one DASH timeline and
+// anchors the timeline so that the current live edge is now.
+func (p *Playlist) initDASH() error {
+	if err := p.checkTimeline(p.variants); err != nil {
+		return err
+	}
+	periods, err := dash.Periods(p.variantPlaylists[0].dashWindow())
+	if err != nil {
+		return err
+	}
+	p.dashStart = p.now().Add(-dash.LiveEdge(periods))
+	return nil
+}
+
+// checkTimeline reports whether variants can be served by the enabled DASH
+// and Smooth Streaming outputs.
+func (p *Playlist) checkTimeline(variants []variant.Variant) error {
+	if !p.dash && !p.smooth {
+		return nil
+	}
+	if err := checkDASHAligned(variants); err != nil {
+		return err
+	}
+	if p.smooth {
+		return checkSmooth(variants)
+	}
+	return nil
+}
+
+// checkDASHAligned reports whether variants have the aligned CMAF segments
+// DASH output requires.
+func checkDASHAligned(variants []variant.Variant) error {
+	segments := make([][]segment.Segment, len(variants))
+	for i, v := range variants {
+		segments[i] = v.Segments
+	}
+	if err := dash.CheckAligned(segments); err != nil {
+		return fmt.Errorf("DASH and Smooth Streaming output need aligned CMAF variants: %w", err)
+	}
+	return nil
+}
+
+// DASHEnabled reports whether WriteMPD serves a manifest.
+func (p *Playlist) DASHEnabled() bool {
+	return p.dash
+}
+
+// WriteMPD writes a live DASH manifest of the current windows to w. It
+// references the same segments as the HLS playlists, with a new Period at
+// every loop point. Errors are returned before anything is written.
+func (p *Playlist) WriteMPD(w io.Writer) error {
+	if !p.DASHEnabled() {
+		return ErrDASHDisabled
+	}
+
+	windows, err := p.dashWindows()
+	if err != nil {
+		return err
+	}
+
+	reps := make([]dash.Representation, len(windows))
+	targetDuration := 0
+	for i, win := range windows {
+		periods, err := dash.Periods(win)
+		if err != nil {
+			return fmt.Errorf("variant %d: %w", i, err)
+		}
+
+		v := p.variants[i]
+		width, height := parseResolution(v.Resolution)
+		reps[i] = dash.Representation{
+			ID:        strconv.Itoa(i),
+			Bandwidth: v.Bandwidth,
+			Width:     width,
+			Height:    height,
+			Codecs:    v.Codecs,
+			Periods:   periods,
+		}
+		targetDuration = max(targetDuration, p.variantPlaylists[i].targetDuration)
+	}
+
+	return dash.Write(w, dash.Manifest{
+		AvailabilityStartTime: p.dashStart,
+		PublishTime:           p.now(),
+		TargetDuration:        time.Duration(targetDuration) * time.Second,
+		Representations:       reps,
+	})
+}
+
+// dashWindows returns a snapshot of every variant's window at the same
+// position, on variant 0's timeline.
+func (p *Playlist) dashWindows() ([]dash.Window, error) {
+	for i := range p.variantPlaylists {
+		if err := p.syncClusterState(i); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		windows []dash.Window
+		aligned bool
+	)
+	for attempt := 0; attempt < mpdSnapshotAttempts && !aligned; attempt++ {
+		windows = make([]dash.Window, len(p.variantPlaylists))
+		aligned = true
+		for i, mp := range p.variantPlaylists {
+			windows[i] = mp.dashWindow()
+			if windows[i].Position != windows[0].Position {
+				aligned = false
+			}
+		}
+	}
+	if !aligned {
+		return nil, fmt.Errorf("variant windows changed while rendering the manifest")
+	}
+
+	for i := range windows {
+		// Variants share variant 0's timeline; with preserved media
+		// sequence numbers their own numbers may differ
+		windows[i].FirstSequence = windows[0].FirstSequence
+	}
+	return windows, nil
+}
+
+// dashWindow returns the current window for DASH period mapping.
+func (mp *mediaPlaylist) dashWindow() dash.Window {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+	return dash.Window{
+		Segments:      mp.segments,
+		Position:      mp.currentPosition,
+		Size:          mp.windowSize,
+		FirstSequence: mp.sequenceNumber,
+	}
+}
+
+// parseResolution splits a "WIDTHxHEIGHT" resolution, returning zeros if it
+// is missing or malformed.
+func parseResolution(resolution string) (width, height int) {
+	w, h, ok := strings.Cut(resolution, "x")
+	if !ok {
+		return 0, 0
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil {
+		return 0, 0
+	}
+	return width, height
+}
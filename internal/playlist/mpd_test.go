@@ -0,0 +1,77 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// createCMAFVariants returns test variants with fMP4 segments.
+func createCMAFVariants(count, segmentsPerVariant int) []variant.Variant {
+	variants := createTestVariants(count, segmentsPerVariant)
+	for i := range variants {
+		for j := range variants[i].Segments {
+			variants[i].Segments[j].InitURL = "https://example.com/init.mp4"
+		}
+	}
+	return variants
+}
+
+func TestWriteMPD(t *testing.T) {
+	lp, err := NewWithOptions(createCMAFVariants(2, 4), Options{WindowSize: 3, DASH: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !lp.DASHEnabled() {
+		t.Fatal("Expected DASH to be enabled")
+	}
+
+	tests := []struct {
+		advances int
+		want     []string
+	}{
+		{0, []string{`<Period id="p0" start="PT0S">`, `<Representation id="1" bandwidth="2000000" width="1280" height="720"`, `media="https://example.com/v1_seg2.ts"`}},
+		// Window [2 3 | 0]: the loop point starts a second period
+		{2, []string{`<Period id="p0" start="PT0S">`, `<Period id="p4" start="PT40S">`, `<S t="0" d="10000"></S>`}},
+		{4, []string{`<Period id="p4" start="PT40S">`}},
+	}
+
+	advanced := 0
+	for _, tt := range tests {
+		for ; advanced < tt.advances; advanced++ {
+			lp.Advance()
+		}
+		var b strings.Builder
+		if err := lp.WriteMPD(&b); err != nil {
+			t.Fatalf("after %d advances: WriteMPD() error = %v", tt.advances, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("after %d advances: manifest missing %q:\n%s", tt.advances, want, b.String())
+			}
+		}
+	}
+}
+
+func TestWriteMPD_Errors(t *testing.T) {
+	lp, err := New(createCMAFVariants(1, 4), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := lp.WriteMPD(&strings.Builder{}); !errors.Is(err, ErrDASHDisabled) {
+		t.Errorf("Expected ErrDASHDisabled, got %v", err)
+	}
+
+	// MPEG-TS segments cannot be served as DASH
+	if _, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3, DASH: true}, nil, createTestLogger()); err == nil {
+		t.Error("Expected an error enabling DASH for MPEG-TS variants")
+	}
+
+	// Nor can variants with different segment counts
+	variants := append(createCMAFVariants(1, 4), createCMAFVariants(1, 5)...)
+	if _, err := NewWithOptions(variants, Options{WindowSize: 3, DASH: true}, nil, createTestLogger()); err == nil {
+		t.Error("Expected an error enabling DASH for misaligned variants")
+	}
+}
@@ -0,0 +1,108 @@
+package playlist
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// ProgramDateTime selects how segments are stamped with
+// EXT-X-PROGRAM-DATE-TIME.
+type ProgramDateTime string
+
+const (
+	// PDTOff stamps no dates.
+	PDTOff ProgramDateTime = ""
+
+	// PDTContinuous dates each segment at the end of the previous one, across
+	// loop points too, like an encoder whose clock never jumps. Segments
+	// shorter than the advance interval make the dates fall behind the wall
+	// clock over time.
+	PDTContinuous ProgramDateTime = "continuous"
+
+	// PDTReset dates segments like PDTContinuous within a pass, and
+	// re-anchors the first segment of every pass to the wall clock at the
+	// discontinuity.
+	PDTReset ProgramDateTime = "reset"
+)
+
+// pdtLayout is the default format of EXT-X-PROGRAM-DATE-TIME values (see
+// PDTFormat), also used for dates in errors.
+const pdtLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// ParseProgramDateTime parses a program date time mode. An empty name
+// selects PDTOff.
+func ParseProgramDateTime(s string) (ProgramDateTime, error) {
+	switch ProgramDateTime(strings.ToLower(strings.TrimSpace(s))) {
+	case PDTOff, "off":
+		return PDTOff, nil
+	case PDTContinuous:
+		return PDTContinuous, nil
+	case PDTReset:
+		return PDTReset, nil
+	default:
+		return "", fmt.Errorf("unknown program date time mode %q (expected continuous or reset)", s)
+	}
+}
+
+// segmentDuration returns the duration of seg.
+func segmentDuration(seg segment.Segment) time.Duration {
+	return time.Duration(seg.Duration * float64(time.Second))
+}
+
+// initDates anchors the dates so that the current window ends now. Caller
+// must hold the write lock, or own mp exclusively.
+func (mp *mediaPlaylist) initDates(now time.Time) {
+	totalSegments := len(mp.segments)
+	mp.pdt = now
+	for i := 0; i < mp.windowSize; i++ {
+		mp.pdt = mp.pdt.Add(-segmentDuration(mp.segments[(mp.currentPosition+i)%totalSegments]))
+	}
+	// Dates are continuous until the first reset
+	mp.loopPDT = mp.pdt
+	for _, seg := range mp.segments[mp.currentPosition:] {
+		mp.loopPDT = mp.loopPDT.Add(segmentDuration(seg))
+	}
+}
+
+// advanceDates moves the dates forward by one segment, before the window
+// itself advances at now. Caller must hold the write lock.
+func (mp *mediaPlaylist) advanceDates(now time.Time) {
+	totalSegments := len(mp.segments)
+	next := (mp.currentPosition + 1) % totalSegments
+	mp.pdt = mp.pdt.Add(segmentDuration(mp.segments[mp.currentPosition]))
+	if mp.pdtMode != PDTReset {
+		return
+	}
+	// The first segment of a pass is dated when it reaches the live edge
+	if (next+mp.windowSize-1)%totalSegments == 0 {
+		mp.loopPDT = now.Add(-segmentDuration(mp.segments[0]))
+	}
+	if next == 0 {
+		mp.pdt = mp.loopPDT
+	}
+}
+
+// programDates returns the date of each segment of the window of
+// windowSize segments starting at position, given the date of its first
+// segment and, with PDTReset, of the first segment after its loop point.
+// It returns nil with PDTOff.
+func programDates(segments []segment.Segment, position, windowSize int, mode ProgramDateTime, first, loop time.Time) []time.Time {
+	if mode == PDTOff {
+		return nil
+	}
+	totalSegments := len(segments)
+	dates := make([]time.Time, windowSize)
+	date := first
+	for i := range dates {
+		pos := (position + i) % totalSegments
+		if i > 0 && pos == 0 && mode == PDTReset {
+			date = loop
+		}
+		dates[i] = date
+		date = date.Add(segmentDuration(segments[pos]))
+	}
+	return dates
+}
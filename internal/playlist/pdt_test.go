@@ -0,0 +1,137 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestParseProgramDateTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ProgramDateTime
+		wantErr bool
+	}{
+		{"", PDTOff, false},
+		{"off", PDTOff, false},
+		{"Continuous", PDTContinuous, false},
+		{"reset", PDTReset, false},
+		{"wallclock", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseProgramDateTime(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseProgramDateTime(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// playlistDates returns the EXT-X-PROGRAM-DATE-TIME and EXTINF duration of
+// every segment of a media playlist.
+func playlistDates(t *testing.T, playlist string) ([]time.Time, []time.Duration) {
+	t.Helper()
+	var (
+		dates     []time.Time
+		durations []time.Duration
+	)
+	for _, line := range strings.Split(playlist, "\n") {
+		if v, ok := strings.CutPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"); ok {
+			date, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				t.Fatalf("invalid date %q: %v", v, err)
+			}
+			dates = append(dates, date)
+		}
+		if v, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			d, err := time.ParseDuration(strings.TrimSuffix(v, ",") + "s")
+			if err != nil {
+				t.Fatalf("invalid duration %q: %v", v, err)
+			}
+			durations = append(durations, d)
+		}
+	}
+	if len(dates) != len(durations) {
+		t.Fatalf("%d dates for %d segments:\n%s", len(dates), len(durations), playlist)
+	}
+	return dates, durations
+}
+
+func TestProgramDateTime(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 4, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+		{URL: "seg3.ts", Duration: 4, Sequence: 3},
+	}
+
+	for _, mode := range []ProgramDateTime{PDTContinuous, PDTReset} {
+		t.Run(string(mode), func(t *testing.T) {
+			lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 3, ProgramDateTime: mode, PreRender: true}, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			if lp.PreRendered() {
+				t.Error("Expected pre-rendering to be disabled with program date time")
+			}
+
+			// The window ends now
+			playlist, _ := lp.GenerateVariant(0)
+			dates, durations := playlistDates(t, playlist)
+			if edge := dates[2].Add(durations[2]); time.Since(edge).Abs() > time.Second {
+				t.Errorf("window ends at %s, want about now", edge)
+			}
+			first := dates[0]
+
+			// Window [3 | 0 1] straddles the loop point
+			for i := 0; i < 3; i++ {
+				lp.Advance()
+			}
+			playlist, _ = lp.GenerateVariant(0)
+			dates, durations = playlistDates(t, playlist)
+			if want := first.Add(16 * time.Second); !dates[0].Equal(want) {
+				t.Errorf("date of the first segment after 3 advances = %s, want %s", dates[0], want)
+			}
+			if got := dates[2].Sub(dates[1]); got != durations[1] {
+				t.Errorf("dates within a pass are %s apart, want %s", got, durations[1])
+			}
+
+			gap := dates[1].Sub(dates[0])
+			switch mode {
+			case PDTContinuous:
+				if gap != durations[0] {
+					t.Errorf("dates across the loop point are %s apart, want %s:\n%s", gap, durations[0], playlist)
+				}
+			case PDTReset:
+				// Segment 0 entered the window at the last advance
+				if time.Since(dates[1].Add(durations[1])).Abs() > time.Second {
+					t.Errorf("first segment of the pass dated %s, want it to end about now:\n%s", dates[1], playlist)
+				}
+			}
+
+			// Past the loop point, the reset date carries on
+			loopDate := dates[1]
+			lp.Advance()
+			playlist, _ = lp.GenerateVariant(0)
+			dates, _ = playlistDates(t, playlist)
+			if !dates[0].Equal(loopDate) {
+				t.Errorf("date of segment 0 changed from %s to %s", loopDate, dates[0])
+			}
+		})
+	}
+}
+
+func TestProgramDateTime_Off(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	playlist, _ := lp.GenerateVariant(0)
+	if strings.Contains(playlist, "#EXT-X-PROGRAM-DATE-TIME") {
+		t.Errorf("Expected no program date time:\n%s", playlist)
+	}
+	if _, ok := lp.GetStats()["program_date_time"]; ok {
+		t.Error("Expected no program_date_time stat")
+	}
+}
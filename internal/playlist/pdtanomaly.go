@@ -0,0 +1,114 @@
+package playlist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PDTAnomalies injects the timestamp anomalies of real encoder clocks into
+// the EXT-X-PROGRAM-DATE-TIME of the variant playlists, to test downstream
+// systems that do date arithmetic. Like Gaps, each anomaly strikes at every
+// Nth media sequence number, counting from 0, so that a segment is dated the
+// same on every request. Only the live presentation shows them.
+type PDTAnomalies struct {
+	// DSTEvery, if not 0, writes the dates in a zone whose clocks fall back
+	// an hour at every DSTEvery-th segment and spring forward at the next
+	// one, so that wall-clock hours repeat while the instants stay
+	// continuous.
+	DSTEvery uint64
+
+	// LeapEvery, if not 0, stamps every LeapEvery-th segment with second 60
+	// of its minute, the 61st second a clock inserting a leap second shows.
+	LeapEvery uint64
+
+	// BackwardEvery, if not 0, makes the dates jump back by Backward at
+	// every BackwardEvery-th segment, like a clock corrected by NTP. The
+	// jumps add up.
+	BackwardEvery uint64
+	Backward      time.Duration
+}
+
+// The zones of DSTEvery, on either side of a fall back.
+var (
+	dstDaylight = time.FixedZone("EDT", -4*60*60)
+	dstStandard = time.FixedZone("EST", -5*60*60)
+)
+
+// ParsePDTAnomalies parses a comma-separated list of anomalies, each
+// striking at every Nth segment:
+//
+//	dst:N                 fall back an hour, then spring forward
+//	leap:N                stamp second 60
+//	backward=DURATION:N   jump back by DURATION
+func ParsePDTAnomalies(spec string) (PDTAnomalies, error) {
+	var a PDTAnomalies
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		kind, every, ok := strings.Cut(item, ":")
+		if !ok {
+			return PDTAnomalies{}, fmt.Errorf("invalid anomaly %q (expected KIND:N, such as leap:50)", item)
+		}
+		kind, value, hasValue := strings.Cut(kind, "=")
+		if seen[kind] {
+			return PDTAnomalies{}, fmt.Errorf("anomaly %q given twice", kind)
+		}
+		seen[kind] = true
+		n, err := strconv.ParseUint(every, 10, 64)
+		if err != nil || n == 0 {
+			return PDTAnomalies{}, fmt.Errorf("anomaly %q: frequency must be a positive number of segments, got %q", kind, every)
+		}
+
+		switch {
+		case kind == "dst" && !hasValue:
+			a.DSTEvery = n
+		case kind == "leap" && !hasValue:
+			a.LeapEvery = n
+		case kind == "backward" && hasValue:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return PDTAnomalies{}, fmt.Errorf("anomaly %q: jump must be a positive duration, got %q", kind, value)
+			}
+			a.BackwardEvery, a.Backward = n, d
+		case kind == "backward":
+			return PDTAnomalies{}, fmt.Errorf("anomaly %q needs a jump, such as backward=2s:%s", kind, every)
+		default:
+			return PDTAnomalies{}, fmt.Errorf("unknown anomaly %q (expected dst, leap or backward=DURATION)", item)
+		}
+	}
+	return a, nil
+}
+
+// Enabled reports whether any anomaly is injected.
+func (a PDTAnomalies) Enabled() bool {
+	return a.DSTEvery != 0 || a.LeapEvery != 0 || a.BackwardEvery != 0
+}
+
+// stamp returns the EXT-X-PROGRAM-DATE-TIME value of the segment with media
+// sequence number sequence, dated date, written in format. The dst anomaly
+// overrides the zone of format.
+func (a PDTAnomalies) stamp(sequence uint64, date time.Time, format PDTFormat) string {
+	if a.BackwardEvery != 0 {
+		date = date.Add(-time.Duration(strikes(sequence, a.BackwardEvery)) * a.Backward)
+	}
+	if a.DSTEvery != 0 {
+		format.Zone = dstDaylight
+		if strikes(sequence, a.DSTEvery)%2 == 1 {
+			format.Zone = dstStandard
+		}
+	}
+	s := format.format(date)
+	if a.LeapEvery != 0 && sequence%a.LeapEvery == a.LeapEvery-1 {
+		// The seconds of every layout are at 17 and 18
+		s = s[:17] + "60" + s[19:]
+	}
+	return s
+}
+
+// strikes returns how many of the segments up to media sequence number
+// sequence an anomaly striking at every Nth segment struck.
+func strikes(sequence, every uint64) uint64 {
+	return (sequence + 1) / every
+}
@@ -0,0 +1,95 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePDTAnomalies(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PDTAnomalies
+		wantErr bool
+	}{
+		{"dst:100", PDTAnomalies{DSTEvery: 100}, false},
+		{"leap:50, backward=2s:30", PDTAnomalies{LeapEvery: 50, BackwardEvery: 30, Backward: 2 * time.Second}, false},
+		{"leap", PDTAnomalies{}, true},
+		{"leap:0", PDTAnomalies{}, true},
+		{"leap=1s:5", PDTAnomalies{}, true},
+		{"backward:5", PDTAnomalies{}, true},
+		{"backward=-1s:5", PDTAnomalies{}, true},
+		{"dst:5,dst:6", PDTAnomalies{}, true},
+		{"drift:5", PDTAnomalies{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDTAnomalies(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePDTAnomalies(%q) = %+v, %v, want %+v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPDTAnomalies_stamp(t *testing.T) {
+	date := time.Date(2026, 11, 1, 5, 30, 15, 250*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		name      string
+		anomalies PDTAnomalies
+		sequence  uint64
+		want      string
+	}{
+		{"none", PDTAnomalies{}, 7, "2026-11-01T05:30:15.250Z"},
+		{"before the fall back", PDTAnomalies{DSTEvery: 3}, 1, "2026-11-01T01:30:15.250-04:00"},
+		{"after the fall back", PDTAnomalies{DSTEvery: 3}, 2, "2026-11-01T00:30:15.250-05:00"},
+		{"sprung forward", PDTAnomalies{DSTEvery: 3}, 5, "2026-11-01T01:30:15.250-04:00"},
+		{"leap second", PDTAnomalies{LeapEvery: 4}, 3, "2026-11-01T05:30:60.250Z"},
+		{"no leap second", PDTAnomalies{LeapEvery: 4}, 2, "2026-11-01T05:30:15.250Z"},
+		{"before a jump", PDTAnomalies{BackwardEvery: 5, Backward: 2 * time.Second}, 3, "2026-11-01T05:30:15.250Z"},
+		{"jumped back", PDTAnomalies{BackwardEvery: 5, Backward: 2 * time.Second}, 4, "2026-11-01T05:30:13.250Z"},
+		{"jumped back twice", PDTAnomalies{BackwardEvery: 5, Backward: 2 * time.Second}, 9, "2026-11-01T05:30:11.250Z"},
+	}
+	for _, tt := range tests {
+		if got := tt.anomalies.stamp(tt.sequence, date, PDTFormat{}); got != tt.want {
+			t.Errorf("%s: stamp(%d) = %s, want %s", tt.name, tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestWriteVariant_PDTAnomalies(t *testing.T) {
+	anomalies := PDTAnomalies{DSTEvery: 2, LeapEvery: 3}
+	if _, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, PDTAnomalies: anomalies}, nil, createTestLogger()); err == nil {
+		t.Error("NewWithOptions() with anomalies and no program date time succeeded")
+	}
+
+	lp, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, ProgramDateTime: PDTContinuous, PDTAnomalies: anomalies}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	playlist, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("GenerateVariant() error = %v", err)
+	}
+	// Segments 0-2: 1 falls back, 2 is a leap second
+	var zones, seconds []string
+	for _, line := range strings.Split(playlist, "\n") {
+		if v, ok := strings.CutPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"); ok {
+			zones = append(zones, v[len(v)-6:])
+			seconds = append(seconds, v[17:19])
+		}
+	}
+	if got := strings.Join(zones, " "); got != "-04:00 -05:00 -05:00" {
+		t.Errorf("zones %s, want -04:00 -05:00 -05:00:\n%s", got, playlist)
+	}
+	if seconds[2] != "60" || seconds[1] == "60" {
+		t.Errorf("seconds %v, want 60 on the last segment only:\n%s", seconds, playlist)
+	}
+
+	// The start-over presentation is unaffected
+	var b strings.Builder
+	if err := lp.WriteStartOverVariant(&b, 0, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("WriteStartOverVariant() error = %v", err)
+	}
+	if strings.Contains(b.String(), "-05:00") || !strings.Contains(b.String(), "Z\n") {
+		t.Errorf("start-over playlist has anomalies:\n%s", b.String())
+	}
+}
@@ -0,0 +1,111 @@
+package playlist
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PDTFormat is how EXT-X-PROGRAM-DATE-TIME values are written, to
+// reproduce the formats of different encoders for downstream parsers that
+// only accept some of them. The zero value writes UTC dates with a Z
+// suffix and milliseconds, such as 2026-10-15T08:00:00.000Z.
+type PDTFormat struct {
+	// Zone is the time zone the dates are written in (UTC if nil).
+	Zone *time.Location
+
+	// Offset writes a zero UTC offset as +00:00 instead of Z.
+	Offset bool
+
+	// Precision is the fractional seconds written: time.Second for none,
+	// time.Millisecond (the default if 0), time.Microsecond or
+	// time.Nanosecond.
+	Precision time.Duration
+}
+
+// pdtOffset matches a numeric UTC offset, such as +05:30.
+var pdtOffset = regexp.MustCompile(`^([+-])(\d\d):(\d\d)$`)
+
+// ParsePDTZone parses a time zone for PDTFormat.Zone: "UTC" or "Z" (nil),
+// a numeric offset such as "+05:30", or an IANA name such as
+// "America/New_York", which needs the system time zone database.
+func ParsePDTZone(s string) (*time.Location, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToUpper(s) {
+	case "", "UTC", "Z":
+		return nil, nil
+	}
+	if m := pdtOffset.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("UTC offset %q out of range", s)
+		}
+		offset := (hours*60 + minutes) * 60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(s, offset), nil
+	}
+	zone, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", s, err)
+	}
+	return zone, nil
+}
+
+// ParsePDTPrecision parses a precision for PDTFormat.Precision: "s", "ms",
+// "us" or "ns". An empty name selects milliseconds.
+func ParsePDTPrecision(s string) (time.Duration, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "s":
+		return time.Second, nil
+	case "", "ms":
+		return time.Millisecond, nil
+	case "us", "µs":
+		return time.Microsecond, nil
+	case "ns":
+		return time.Nanosecond, nil
+	default:
+		return 0, fmt.Errorf("unknown precision %q (expected s, ms, us or ns)", s)
+	}
+}
+
+// validate reports whether the precision of f is supported.
+func (f PDTFormat) validate() error {
+	switch f.Precision {
+	case 0, time.Second, time.Millisecond, time.Microsecond, time.Nanosecond:
+		return nil
+	default:
+		return fmt.Errorf("unsupported program date time precision %v", f.Precision)
+	}
+}
+
+// layout returns the time layout of f. The seconds are always at 17 and 18.
+func (f PDTFormat) layout() string {
+	layout := "2006-01-02T15:04:05"
+	switch f.Precision {
+	case time.Second:
+	case time.Microsecond:
+		layout += ".000000"
+	case time.Nanosecond:
+		layout += ".000000000"
+	default:
+		layout += ".000"
+	}
+	if f.Offset {
+		return layout + "-07:00"
+	}
+	return layout + "Z07:00"
+}
+
+// format returns date written in f.
+func (f PDTFormat) format(date time.Time) string {
+	zone := f.Zone
+	if zone == nil {
+		zone = time.UTC
+	}
+	return date.In(zone).Format(f.layout())
+}
@@ -0,0 +1,136 @@
+package playlist
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePDTZone(t *testing.T) {
+	tests := []struct {
+		in         string
+		wantOffset int // seconds east of UTC, if not nil
+		wantNil    bool
+		wantErr    bool
+	}{
+		{"", 0, true, false},
+		{"utc", 0, true, false},
+		{"Z", 0, true, false},
+		{"+05:30", 5*3600 + 30*60, false, false},
+		{"-08:00", -8 * 3600, false, false},
+		{"+00:00", 0, false, false},
+		{"+15:00", 0, false, true},
+		{"+05:60", 0, false, true},
+		{"Mars/Olympus_Mons", 0, false, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDTZone(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePDTZone(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if (got == nil) != tt.wantNil {
+			t.Errorf("ParsePDTZone(%q) = %v, want nil %v", tt.in, got, tt.wantNil)
+			continue
+		}
+		if got != nil {
+			if _, offset := time.Date(2026, 1, 1, 0, 0, 0, 0, got).Zone(); offset != tt.wantOffset {
+				t.Errorf("ParsePDTZone(%q) offset = %d, want %d", tt.in, offset, tt.wantOffset)
+			}
+		}
+	}
+}
+
+func TestParsePDTPrecision(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", time.Millisecond, false},
+		{"s", time.Second, false},
+		{"MS", time.Millisecond, false},
+		{"us", time.Microsecond, false},
+		{"ns", time.Nanosecond, false},
+		{"cs", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDTPrecision(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePDTPrecision(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPDTFormat_format(t *testing.T) {
+	date := time.Date(2026, 10, 15, 8, 30, 5, 123456789, time.UTC)
+	tests := []struct {
+		name   string
+		format PDTFormat
+		want   string
+	}{
+		{"default", PDTFormat{}, "2026-10-15T08:30:05.123Z"},
+		{"offset", PDTFormat{Offset: true}, "2026-10-15T08:30:05.123+00:00"},
+		{"seconds", PDTFormat{Precision: time.Second}, "2026-10-15T08:30:05Z"},
+		{"microseconds", PDTFormat{Precision: time.Microsecond}, "2026-10-15T08:30:05.123456Z"},
+		{"nanoseconds", PDTFormat{Precision: time.Nanosecond}, "2026-10-15T08:30:05.123456789Z"},
+		{"zone", PDTFormat{Zone: time.FixedZone("", 5*3600+30*60)}, "2026-10-15T14:00:05.123+05:30"},
+		{"zone without offset", PDTFormat{Zone: time.FixedZone("", 0)}, "2026-10-15T08:30:05.123Z"},
+	}
+	for _, tt := range tests {
+		if got := tt.format.format(date); got != tt.want {
+			t.Errorf("%s: format() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteVariant_PDTFormat(t *testing.T) {
+	format := PDTFormat{Zone: time.FixedZone("", -3*3600), Precision: time.Second}
+	if _, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, PDTFormat: format}, nil, createTestLogger()); err == nil {
+		t.Error("NewWithOptions() with a format and no program date time succeeded")
+	}
+	if _, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, ProgramDateTime: PDTContinuous, PDTFormat: PDTFormat{Precision: time.Minute}}, nil, createTestLogger()); err == nil {
+		t.Error("NewWithOptions() with a precision of a minute succeeded")
+	}
+
+	lp, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, ProgramDateTime: PDTContinuous, PDTFormat: format, PDTAnomalies: PDTAnomalies{LeapEvery: 3}}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	want := regexp.MustCompile(`^#EXT-X-PROGRAM-DATE-TIME:\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d-03:00$`)
+	check := func(name, playlist string) {
+		t.Helper()
+		var n int
+		for _, line := range strings.Split(playlist, "\n") {
+			if strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:") {
+				n++
+				if !want.MatchString(line) {
+					t.Errorf("%s: unexpected format %q", name, line)
+				}
+			}
+		}
+		if n == 0 {
+			t.Errorf("%s: no program date times:\n%s", name, playlist)
+		}
+	}
+
+	playlist, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("GenerateVariant() error = %v", err)
+	}
+	check("live", playlist)
+	if !strings.Contains(playlist, ":60-03:00\n") {
+		t.Errorf("Expected a leap second:\n%s", playlist)
+	}
+
+	// The start-over presentation is written in the same format
+	var b strings.Builder
+	if err := lp.WriteStartOverVariant(&b, 0, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("WriteStartOverVariant() error = %v", err)
+	}
+	check("start-over", b.String())
+}
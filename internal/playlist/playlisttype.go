@@ -0,0 +1,63 @@
+package playlist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlaylistType selects how the variant playlists present the looped
+// content.
+type PlaylistType string
+
+const (
+	// TypeLive is a sliding window of the newest segments.
+	TypeLive PlaylistType = ""
+
+	// TypeEvent grows from the start of the stream and never drops a
+	// segment (EXT-X-PLAYLIST-TYPE:EVENT). With Options.Loops, it ends with
+	// EXT-X-ENDLIST once that many loops have been appended.
+	TypeEvent PlaylistType = "event"
+
+	// TypeVOD serves Options.Loops loops (one if unset) at once, complete
+	// with EXT-X-ENDLIST (EXT-X-PLAYLIST-TYPE:VOD).
+	TypeVOD PlaylistType = "vod"
+)
+
+// ParsePlaylistType parses a playlist type name, ignoring case. An empty
+// name selects TypeLive.
+func ParsePlaylistType(s string) (PlaylistType, error) {
+	switch PlaylistType(strings.ToLower(strings.TrimSpace(s))) {
+	case TypeLive, "live":
+		return TypeLive, nil
+	case TypeEvent:
+		return TypeEvent, nil
+	case TypeVOD:
+		return TypeVOD, nil
+	default:
+		return "", fmt.Errorf("unknown playlist type %q (expected live, event or vod)", s)
+	}
+}
+
+// span returns the entries of the playlist whose window starts at position
+// with media sequence number sequence: the position and media sequence
+// number of the first entry, the number of entries and whether the
+// playlist has ended. EVENT and VOD playlists start where the stream
+// started, so the entries are derived from the sequence number rather than
+// kept as history. Caller must hold at least a read lock.
+func (mp *mediaPlaylist) span(position int, sequence uint64, windowSize int) (start int, first uint64, count int, ended bool) {
+	if mp.playlistType == TypeLive {
+		return position, sequence, windowSize, false
+	}
+	totalSegments := len(mp.segments)
+	elapsed := sequence - mp.startSequence
+	start = (position - int(elapsed%uint64(totalSegments)) + totalSegments) % totalSegments
+	total := uint64(max(mp.loops, 1) * totalSegments)
+	if mp.playlistType == TypeVOD {
+		return start, mp.startSequence, int(total), true
+	}
+	length := uint64(windowSize) + elapsed
+	if mp.loops > 0 && length >= total {
+		return start, mp.startSequence, int(total), true
+	}
+	return start, mp.startSequence, int(length), false
+}
@@ -0,0 +1,161 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestParsePlaylistType(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PlaylistType
+		wantErr bool
+	}{
+		{"", TypeLive, false},
+		{"live", TypeLive, false},
+		{"EVENT", TypeEvent, false},
+		{"vod", TypeVOD, false},
+		{"dvr", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePlaylistType(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePlaylistType(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// playlistURLs returns the segment URLs of a media playlist.
+func playlistURLs(playlist string) []string {
+	var urls []string
+	for _, line := range strings.Split(playlist, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls
+}
+
+func TestEventPlaylist(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 6, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+	}
+	lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 2, Type: TypeEvent, Loops: 2, PreRender: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if lp.PreRendered() {
+		t.Error("Expected pre-rendering to be disabled for EVENT playlists")
+	}
+
+	tests := []struct {
+		advances int
+		wantURLs string
+		wantEnd  bool
+	}{
+		{0, "seg0.ts seg1.ts", false},
+		{1, "seg0.ts seg1.ts seg2.ts", false},
+		{2, "seg0.ts seg1.ts seg2.ts seg0.ts", false},
+		{3, "seg0.ts seg1.ts seg2.ts seg0.ts seg1.ts", false},
+		{4, "seg0.ts seg1.ts seg2.ts seg0.ts seg1.ts seg2.ts", true},
+		{10, "seg0.ts seg1.ts seg2.ts seg0.ts seg1.ts seg2.ts", true}, // ended playlists stop advancing
+	}
+	advanced := 0
+	for _, tt := range tests {
+		for ; advanced < tt.advances; advanced++ {
+			lp.Advance()
+		}
+		playlist, err := lp.GenerateVariant(0)
+		if err != nil {
+			t.Fatalf("GenerateVariant() error = %v", err)
+		}
+		if got := strings.Join(playlistURLs(playlist), " "); got != tt.wantURLs {
+			t.Errorf("after %d advances: segments %s, want %s", tt.advances, got, tt.wantURLs)
+		}
+		if !strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE:EVENT\n") || !strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:0\n") {
+			t.Errorf("after %d advances: Expected an EVENT playlist from sequence 0:\n%s", tt.advances, playlist)
+		}
+		if got := strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n"); got != tt.wantEnd {
+			t.Errorf("after %d advances: ended %v, want %v:\n%s", tt.advances, got, tt.wantEnd, playlist)
+		}
+		if tt.advances >= 2 && strings.Count(playlist, "#EXT-X-DISCONTINUITY\n") != 1 {
+			t.Errorf("after %d advances: Expected a discontinuity at the loop point:\n%s", tt.advances, playlist)
+		}
+	}
+	if got := lp.MediaSequence(); got != 4 {
+		t.Errorf("MediaSequence() = %d, want 4 (stopped at the end)", got)
+	}
+	if got := lp.GetStats()["playlist_type"]; got != TypeEvent {
+		t.Errorf("playlist_type stat = %v, want %v", got, TypeEvent)
+	}
+}
+
+func TestEventPlaylist_Stale(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 2, Type: TypeEvent}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		lp.Advance()
+	}
+	var b strings.Builder
+	if err := lp.WriteStaleVariant(&b, 0, 2); err != nil {
+		t.Fatalf("WriteStaleVariant() error = %v", err)
+	}
+	if got := len(playlistURLs(b.String())); got != 3 {
+		t.Errorf("stale EVENT playlist has %d segments, want 3:\n%s", got, b.String())
+	}
+}
+
+func TestVODPlaylist(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 3), Options{WindowSize: 2, Type: TypeVOD, Loops: 2}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	want, _ := lp.GenerateVariant(0)
+	if !strings.Contains(want, "#EXT-X-PLAYLIST-TYPE:VOD\n") || !strings.HasSuffix(want, "#EXT-X-ENDLIST\n") {
+		t.Errorf("Expected a complete VOD playlist:\n%s", want)
+	}
+	if got := len(playlistURLs(want)); got != 6 {
+		t.Errorf("VOD playlist has %d segments, want 2 loops of 3", got)
+	}
+
+	// VOD playlists never change
+	lp.Advance()
+	if got, _ := lp.GenerateVariant(0); got != want {
+		t.Errorf("VOD playlist changed after an advance:\n%s", got)
+	}
+}
+
+func TestPlaylistType_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{"negative loops", Options{WindowSize: 2, Type: TypeEvent, Loops: -1}, "must not be negative"},
+		{"live loops", Options{WindowSize: 2, Loops: 2}, "require an EVENT or VOD playlist"},
+		{"program date time", Options{WindowSize: 2, Type: TypeEvent, ProgramDateTime: PDTContinuous}, "not supported with EVENT playlists"},
+		{"debug subtitles", Options{WindowSize: 2, Type: TypeVOD, DebugSubtitles: true}, "not supported with VOD playlists"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWithOptions(createTestVariants(1, 3), tt.opts, nil, createTestLogger())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewWithOptions() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	lp, err := NewWithOptions(createTestVariants(1, 3), Options{WindowSize: 2, Type: TypeEvent}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	if err := lp.Replace(createTestVariants(1, 3)); err == nil {
+		t.Error("Replace() of an EVENT playlist succeeded")
+	}
+}
@@ -0,0 +1,56 @@
+package playlist
+
+import (
+	"strconv"
+
+	"github.com/agleyzer/encodersim/internal/cluster"
+	"github.com/agleyzer/encodersim/internal/prime"
+)
+
+// LiveEdge returns the newest segment of every media playlist, variants
+// first and then the renditions with a media playlist, for priming a CDN
+// (see prime.Primer). A segment that the playlist leaves out or marks as a
+// gap (Options.Gaps) is not returned, since players never fetch it.
+func (p *Playlist) LiveEdge() []prime.Segment {
+	var states []cluster.VariantState
+	if p.clusterMgr != nil {
+		states = p.clusterMgr.GetState().Variants
+	}
+
+	edge := make([]prime.Segment, 0, len(p.variantPlaylists))
+	for i, mp := range p.variantPlaylists {
+		mp.mu.RLock()
+		position, sequence := mp.currentPosition, mp.sequenceNumber
+		if i < len(states) {
+			position, sequence = states[i].CurrentPosition, states[i].SequenceNumber
+		}
+		last := mp.windowSize - 1
+		seg := mp.segments[(position+last)%len(mp.segments)]
+		lost := mp.simulation.gaps.lost(sequence + uint64(last))
+		mp.mu.RUnlock()
+
+		if lost {
+			continue
+		}
+		edge = append(edge, prime.Segment{
+			Playlist: p.mediaPath(i),
+			Sequence: sequence + uint64(last),
+			URL:      seg.URL,
+		})
+	}
+	return edge
+}
+
+// mediaPath returns the served path of variantPlaylists[i] without its
+// playlist.m3u8 suffix, such as "variant/0" or "rendition/1".
+func (p *Playlist) mediaPath(i int) string {
+	if i < len(p.variants) {
+		return "variant/" + strconv.Itoa(i)
+	}
+	for j, r := range p.renditions {
+		if r.playlist == i {
+			return "rendition/" + strconv.Itoa(j)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package playlist
+
+import (
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/prime"
+)
+
+func TestLiveEdge(t *testing.T) {
+	variants, renditions := createRenditionSource()
+	lp, err := NewWithOptions(variants, Options{WindowSize: 2, Renditions: renditions}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+
+	want := []prime.Segment{
+		{Playlist: "variant/0", Sequence: 1, URL: "low1.ts"},
+		{Playlist: "variant/1", Sequence: 1, URL: "high1.ts"},
+		{Playlist: "rendition/0", Sequence: 1, URL: "en1.ts"},
+		{Playlist: "rendition/2", Sequence: 1, URL: "fr1.ts"},
+	}
+	check := func(want []prime.Segment) {
+		t.Helper()
+		got := lp.LiveEdge()
+		if len(got) != len(want) {
+			t.Fatalf("LiveEdge() = %+v, want %+v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("LiveEdge()[%d] = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	}
+	check(want)
+
+	// The edge wraps around the loop with the window
+	lp.Advance()
+	lp.Advance()
+	for i := range want {
+		want[i].Sequence = 3
+		want[i].URL = want[i].URL[:len(want[i].URL)-4] + "0.ts"
+	}
+	check(want)
+}
+
+func TestLiveEdge_Gaps(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 5), Options{WindowSize: 3, Gaps: Gaps{Mode: GapTag, Every: 3}}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+
+	// Sequence 2 is lost, sequence 3 is not
+	if got := lp.LiveEdge(); len(got) != 0 {
+		t.Errorf("LiveEdge() = %+v, want no segments", got)
+	}
+	lp.Advance()
+	got := lp.LiveEdge()
+	if len(got) != 1 || got[0].Sequence != 3 || got[0].URL != "https://example.com/v0_seg3.ts" {
+		t.Errorf("LiveEdge() = %+v, want sequence 3", got)
+	}
+}
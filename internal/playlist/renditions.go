@@ -0,0 +1,128 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// ErrRenditionNotFound is returned by WriteRendition for a rendition index
+// the playlist does not have, or a rendition without a media playlist.
+var ErrRenditionNotFound = errors.New("rendition not found")
+
+// rendition is an alternate rendition of the live master playlist.
+type rendition struct {
+	variant.Rendition
+	playlist int // Index in variantPlaylists, -1 without a media playlist
+}
+
+// checkRenditions validates the renditions of opts.
+func checkRenditions(opts Options) error {
+	if len(opts.Renditions) == 0 {
+		return nil
+	}
+	if opts.DASH || opts.Smooth {
+		return fmt.Errorf("alternate renditions are not supported with DASH or Smooth Streaming")
+	}
+	for i, r := range opts.Renditions {
+		if r.Type != variant.RenditionAudio && r.Type != variant.RenditionSubtitles {
+			return fmt.Errorf("rendition %d has unsupported type %q", i, r.Type)
+		}
+		if r.Type == variant.RenditionSubtitles && opts.DebugSubtitles {
+			return fmt.Errorf("debug subtitles are not supported with subtitle renditions")
+		}
+		if strings.ContainsAny(r.GroupID+r.Name+r.Language+r.Characteristics, "\"\r\n") {
+			return fmt.Errorf("rendition %d attributes must not contain quotes or line breaks", i)
+		}
+		if r.HasMedia() && len(r.Media.Segments) == 0 {
+			return fmt.Errorf("rendition %d has zero segments", i)
+		}
+	}
+	return nil
+}
+
+// renditionPlaylists numbers the media playlists of renditions after the
+// variants. It returns the renditions and the media of the variants followed
+// by that of the renditions that have a media playlist.
+func renditionPlaylists(variants []variant.Variant, renditions []variant.Rendition) ([]rendition, []variant.Variant) {
+	if len(renditions) == 0 {
+		return nil, variants
+	}
+	media := append([]variant.Variant(nil), variants...)
+	numbered := make([]rendition, len(renditions))
+	for i, r := range renditions {
+		numbered[i] = rendition{Rendition: r, playlist: -1}
+		if r.HasMedia() {
+			numbered[i].playlist = len(media)
+			media = append(media, r.Media)
+		}
+	}
+	return numbered, media
+}
+
+// writeRenditionsMedia writes the master playlist entries of the alternate
+// renditions, with the media playlists at /rendition/N/playlist.m3u8.
+func (p *Playlist) writeRenditionsMedia(w io.Writer) {
+	for i, r := range p.renditions {
+		fmt.Fprintf(w, "#EXT-X-MEDIA:TYPE=%s,GROUP-ID=\"%s\",NAME=\"%s\"", r.Type, r.GroupID, r.Name)
+		if r.Language != "" {
+			fmt.Fprintf(w, ",LANGUAGE=\"%s\"", r.Language)
+		}
+		fmt.Fprintf(w, ",DEFAULT=%s,AUTOSELECT=%s", yesNo(r.Default), yesNo(r.Autoselect))
+		if r.Type == variant.RenditionSubtitles {
+			fmt.Fprintf(w, ",FORCED=%s", yesNo(r.Forced))
+		}
+		if r.Characteristics != "" {
+			fmt.Fprintf(w, ",CHARACTERISTICS=\"%s\"", r.Characteristics)
+		}
+		if r.playlist >= 0 {
+			fmt.Fprintf(w, ",URI=\"/rendition/%d/playlist.m3u8\"", i)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// yesNo formats b as an enumerated-string attribute value.
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
+
+// RenditionCount returns the number of alternate renditions in the master
+// playlist, with or without a media playlist.
+func (p *Playlist) RenditionCount() int {
+	return len(p.renditions)
+}
+
+// WriteRendition writes the media playlist of an alternate rendition to w.
+// It advances with the variants, but does not support the LL-HLS features,
+// stale copies or DVR windows of the variant playlists. Validation errors
+// are returned before anything is written.
+func (p *Playlist) WriteRendition(w io.Writer, renditionIndex int) error {
+	if renditionIndex < 0 || renditionIndex >= len(p.renditions) || p.renditions[renditionIndex].playlist < 0 {
+		return fmt.Errorf("%w: %d", ErrRenditionNotFound, renditionIndex)
+	}
+	index := p.renditions[renditionIndex].playlist
+	if err := p.syncClusterState(index); err != nil {
+		return err
+	}
+	return p.variantPlaylists[index].write(w, false, 0, 0)
+}
+
+// source returns the source playlist URL of variantPlaylists[i].
+func (p *Playlist) source(i int) string {
+	if i < len(p.variants) {
+		return p.variants[i].PlaylistURL
+	}
+	for _, r := range p.renditions {
+		if r.playlist == i {
+			return r.Media.PlaylistURL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package playlist
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// createRenditionSource returns two variants referencing an audio group with
+// a looped and a muxed rendition, and a subtitle group.
+func createRenditionSource() ([]variant.Variant, []variant.Rendition) {
+	media := func(name string) variant.Variant {
+		return variant.Variant{
+			PlaylistURL:    name + ".m3u8",
+			TargetDuration: 6,
+			Segments: []segment.Segment{
+				{URL: name + "0.ts", Duration: 6, Sequence: 0},
+				{URL: name + "1.ts", Duration: 6, Sequence: 1},
+				{URL: name + "2.ts", Duration: 6, Sequence: 2},
+			},
+		}
+	}
+	low, high := media("low"), media("high")
+	low.Bandwidth, low.Audio, low.Subtitles = 500000, "aac", "subs"
+	high.Bandwidth, high.Audio = 1000000, "aac"
+	return []variant.Variant{low, high}, []variant.Rendition{
+		{Type: variant.RenditionAudio, GroupID: "aac", Name: "English", Language: "en", Default: true, Autoselect: true, Media: media("en")},
+		{Type: variant.RenditionAudio, GroupID: "aac", Name: "Main"},
+		{Type: variant.RenditionSubtitles, GroupID: "subs", Name: "French", Language: "fr", Forced: true, Media: media("fr")},
+	}
+}
+
+func TestWriteMaster_Renditions(t *testing.T) {
+	variants, renditions := createRenditionSource()
+	lp, err := NewWithOptions(variants, Options{WindowSize: 2, Renditions: renditions}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+
+	master, err := lp.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="/rendition/0/playlist.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Main",DEFAULT=NO,AUTOSELECT=NO
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="French",LANGUAGE="fr",DEFAULT=NO,AUTOSELECT=NO,FORCED=YES,URI="/rendition/2/playlist.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=500000,AUDIO="aac",SUBTITLES="subs"
+/variant/0/playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,AUDIO="aac"
+/variant/1/playlist.m3u8
+`
+	if master != want {
+		t.Errorf("master playlist:\n%s\nwant:\n%s", master, want)
+	}
+
+	// Only the live master playlist has renditions
+	var vod strings.Builder
+	if err := lp.WriteVODMaster(&vod); err != nil {
+		t.Fatalf("WriteVODMaster() error = %v", err)
+	}
+	if strings.Contains(vod.String(), "EXT-X-MEDIA") || strings.Contains(vod.String(), "AUDIO=") {
+		t.Errorf("VOD master playlist has renditions:\n%s", vod.String())
+	}
+}
+
+func TestWriteRendition(t *testing.T) {
+	variants, renditions := createRenditionSource()
+	lp, err := NewWithOptions(variants, Options{WindowSize: 2, Renditions: renditions, StateFile: filepath.Join(t.TempDir(), "state.json")}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	lp.Advance()
+
+	tests := []struct {
+		index    int
+		wantSegs []string
+		wantErr  error
+	}{
+		{0, []string{"en1.ts", "en2.ts"}, nil},
+		{2, []string{"fr1.ts", "fr2.ts"}, nil},
+		{1, nil, ErrRenditionNotFound},
+		{3, nil, ErrRenditionNotFound},
+		{-1, nil, ErrRenditionNotFound},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		err := lp.WriteRendition(&b, tt.index)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("WriteRendition(%d) error = %v, want %v", tt.index, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(b.String(), "#EXT-X-MEDIA-SEQUENCE:1\n") {
+			t.Errorf("rendition %d did not advance with the variants:\n%s", tt.index, b.String())
+		}
+		for _, seg := range tt.wantSegs {
+			if !strings.Contains(b.String(), seg) {
+				t.Errorf("rendition %d playlist missing %s:\n%s", tt.index, seg, b.String())
+			}
+		}
+	}
+
+	// Renditions are not variants
+	if _, err := lp.GenerateVariant(2); !errors.Is(err, ErrVariantOutOfRange) {
+		t.Errorf("GenerateVariant(2) error = %v, want ErrVariantOutOfRange", err)
+	}
+	if err := lp.Replace(variants); err == nil {
+		t.Error("Replace() with renditions error = nil, want error")
+	}
+}
+
+func TestNewWithOptions_RenditionErrors(t *testing.T) {
+	variants, renditions := createRenditionSource()
+	empty := renditions[0]
+	empty.Media.Segments = nil
+
+	tests := []struct {
+		name       string
+		opts       Options
+		renditions []variant.Rendition
+	}{
+		{"dash", Options{DASH: true}, renditions},
+		{"debug subtitles", Options{DebugSubtitles: true}, renditions},
+		{"unsupported type", Options{}, []variant.Rendition{{Type: "CLOSED-CAPTIONS", GroupID: "cc", Name: "CC1"}}},
+		{"quoted name", Options{}, []variant.Rendition{{Type: variant.RenditionAudio, GroupID: "aac", Name: `"en"`}}},
+		{"zero segments", Options{}, []variant.Rendition{empty}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.WindowSize = 2
+			tt.opts.Renditions = tt.renditions
+			if _, err := NewWithOptions(variants, tt.opts, nil, createTestLogger()); err == nil {
+				t.Error("NewWithOptions() error = nil, want error")
+			}
+		})
+	}
+
+	// Debug subtitles still work with audio renditions only
+	if _, err := NewWithOptions(variants, Options{WindowSize: 2, DebugSubtitles: true, Renditions: renditions[:2]}, nil, createTestLogger()); err != nil {
+		t.Errorf("NewWithOptions() with audio renditions and debug subtitles error = %v", err)
+	}
+}
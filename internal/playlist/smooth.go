@@ -0,0 +1,110 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/agleyzer/encodersim/internal/dash"
+	"github.com/agleyzer/encodersim/internal/smooth"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+var (
+	// ErrSmoothDisabled is returned by WriteSmooth and SmoothFragmentURL
+	// when the playlist was created without Options.Smooth.
+	ErrSmoothDisabled = errors.New("smooth streaming output is not enabled")
+
+	// ErrFragmentNotFound is returned by SmoothFragmentURL for a fragment
+	// that is not in the current window.
+	ErrFragmentNotFound = errors.New("fragment not found")
+)
+
+// checkSmooth reports whether aligned CMAF variants can also be addressed
+// by Smooth Streaming fragment URLs.
+func checkSmooth(variants []variant.Variant) error {
+	bitrates := make(map[int]int)
+	for i, v := range variants {
+		if j, ok := bitrates[v.Bandwidth]; ok {
+			return fmt.Errorf("smooth streaming output needs distinct bandwidths: variants %d and %d have %d", j, i, v.Bandwidth)
+		}
+		bitrates[v.Bandwidth] = i
+		for j, seg := range v.Segments {
+			if seg.ByteRange != "" {
+				return fmt.Errorf("smooth streaming output cannot address byte-range segments: variant %d segment %d", i, j)
+			}
+		}
+	}
+	return nil
+}
+
+// SmoothEnabled reports whether WriteSmooth serves a manifest.
+func (p *Playlist) SmoothEnabled() bool {
+	return p.smooth
+}
+
+// WriteSmooth writes a live Smooth Streaming client manifest of the current
+// windows to w, on the same timeline as WriteMPD. Errors are returned
+// before anything is written.
+func (p *Playlist) WriteSmooth(w io.Writer) error {
+	if !p.smooth {
+		return ErrSmoothDisabled
+	}
+
+	windows, err := p.dashWindows()
+	if err != nil {
+		return err
+	}
+	periods, err := dash.Periods(windows[0])
+	if err != nil {
+		return err
+	}
+
+	levels := make([]smooth.QualityLevel, len(p.variants))
+	for i, v := range p.variants {
+		width, height := parseResolution(v.Resolution)
+		levels[i] = smooth.QualityLevel{Bitrate: v.Bandwidth, Width: width, Height: height, Codecs: v.Codecs}
+	}
+	return smooth.Write(w, smooth.Manifest{QualityLevels: levels, Chunks: smooth.Chunks(periods)})
+}
+
+// SmoothFragmentURL returns the URL of the segment of the variant with
+// bitrate that starts at start on the Smooth Streaming timeline, or
+// ErrFragmentNotFound if the current window has no such segment.
+func (p *Playlist) SmoothFragmentURL(bitrate int, start uint64) (string, error) {
+	if !p.smooth {
+		return "", ErrSmoothDisabled
+	}
+
+	index := -1
+	for i, v := range p.variants {
+		if v.Bandwidth == bitrate {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return "", fmt.Errorf("no variant with bitrate %d: %w", bitrate, ErrFragmentNotFound)
+	}
+
+	windows, err := p.dashWindows()
+	if err != nil {
+		return "", err
+	}
+	periods, err := dash.Periods(windows[index])
+	if err != nil {
+		return "", err
+	}
+	// Chunks lists the segments of periods in order
+	chunks := smooth.Chunks(periods)
+	i := 0
+	for _, period := range periods {
+		for _, seg := range period.Segments {
+			if chunks[i].Time == start {
+				return seg.URL, nil
+			}
+			i++
+		}
+	}
+	return "", fmt.Errorf("no fragment at %d: %w", start, ErrFragmentNotFound)
+}
@@ -0,0 +1,84 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteSmooth(t *testing.T) {
+	lp, err := NewWithOptions(createCMAFVariants(2, 4), Options{WindowSize: 3, Smooth: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !lp.SmoothEnabled() || lp.DASHEnabled() {
+		t.Fatal("Expected only Smooth Streaming to be enabled")
+	}
+
+	lp.Advance()
+	lp.Advance()
+
+	// Window [2 3 | 0] of 10s segments
+	var b strings.Builder
+	if err := lp.WriteSmooth(&b); err != nil {
+		t.Fatalf("WriteSmooth() error = %v", err)
+	}
+	for _, want := range []string{`Chunks="3" QualityLevels="2"`, `<c t="200000000" d="100000000"></c>`, `Bitrate="2000000"`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("manifest missing %q:\n%s", want, b.String())
+		}
+	}
+
+	tests := []struct {
+		name    string
+		bitrate int
+		start   uint64
+		want    string
+		wantErr error
+	}{
+		{"first", 1000000, 200_000_000, "https://example.com/v0_seg2.ts", nil},
+		{"after loop point", 2000000, 400_000_000, "https://example.com/v1_seg0.ts", nil},
+		{"left window", 1000000, 100_000_000, "", ErrFragmentNotFound},
+		{"between segments", 1000000, 250_000_000, "", ErrFragmentNotFound},
+		{"unknown bitrate", 5, 200_000_000, "", ErrFragmentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lp.SmoothFragmentURL(tt.bitrate, tt.start)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SmoothFragmentURL() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SmoothFragmentURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteSmooth_Errors(t *testing.T) {
+	lp, err := New(createCMAFVariants(1, 4), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := lp.WriteSmooth(&strings.Builder{}); !errors.Is(err, ErrSmoothDisabled) {
+		t.Errorf("Expected ErrSmoothDisabled, got %v", err)
+	}
+	if _, err := lp.SmoothFragmentURL(1000000, 0); !errors.Is(err, ErrSmoothDisabled) {
+		t.Errorf("Expected ErrSmoothDisabled, got %v", err)
+	}
+
+	// Fragment URLs select variants by bitrate
+	variants := createCMAFVariants(2, 4)
+	variants[1].Bandwidth = variants[0].Bandwidth
+	if _, err := NewWithOptions(variants, Options{WindowSize: 3, Smooth: true}, nil, createTestLogger()); err == nil {
+		t.Error("Expected an error enabling Smooth Streaming for variants with the same bandwidth")
+	}
+
+	// and redirect to whole segments
+	variants = createCMAFVariants(1, 4)
+	variants[0].Segments[1].ByteRange = "1000@0"
+	if _, err := NewWithOptions(variants, Options{WindowSize: 3, Smooth: true}, nil, createTestLogger()); err == nil {
+		t.Error("Expected an error enabling Smooth Streaming for byte-range segments")
+	}
+}
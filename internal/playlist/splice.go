@@ -0,0 +1,116 @@
+package playlist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// CanSplice reports why Splice is not supported by the playlist, or nil if
+// it is. Splicing needs a live playlist that is not clustered, has no
+// alternate renditions, and whose other outputs derive nothing from the
+// position in the loop: DASH and
+// Smooth Streaming periods, debug subtitle cues and program date times
+// that reset every pass.
+func (p *Playlist) CanSplice() error {
+	switch {
+	case p.clusterMgr != nil:
+		return fmt.Errorf("splicing is not supported in cluster mode")
+	case p.playlistType != TypeLive:
+		return fmt.Errorf("splicing is not supported with %s playlists", strings.ToUpper(string(p.playlistType)))
+	case len(p.renditions) > 0:
+		return fmt.Errorf("splicing is not supported with alternate renditions")
+	case p.dash || p.smooth:
+		return fmt.Errorf("splicing is not supported with DASH or Smooth Streaming output")
+	case p.debugSubtitles:
+		return fmt.Errorf("splicing is not supported with debug subtitles")
+	case p.programDateTime == PDTReset:
+		return fmt.Errorf("splicing is not supported with program date times that reset every loop")
+	}
+	return nil
+}
+
+// Splice switches every variant to new segment lists at the live edge, for
+// example after the source was re-fetched. Unlike Replace, the switch does
+// not wait for the loop boundary: the segments already in the windows keep
+// their media sequence numbers, and the new segments follow them from the
+// next advance, behind a discontinuity. Variants must match the current
+// variants one to one, and master playlist attributes and the advance
+// interval are not changed. See CanSplice for the playlists that do not
+// support it.
+func (p *Playlist) Splice(variants []variant.Variant) error {
+	if err := p.CanSplice(); err != nil {
+		return err
+	}
+	sources, err := p.replacements(variants)
+	if err != nil {
+		return err
+	}
+	for i, mp := range p.variantPlaylists {
+		mp.splice(sources[i])
+	}
+	p.saveState()
+
+	p.logger.Info("spliced in new segments at the live edge", "variants", len(variants))
+	return nil
+}
+
+// splice switches to next at the live edge. Until the window has moved past
+// the segments it holds now, the playlist plays a transition: the current
+// window followed by next, repeated so that the window never wraps back to
+// the old segments. The window then continues at the start of next (see
+// finishSplice). A replacement scheduled with Replace is dropped.
+func (mp *mediaPlaylist) splice(next *pendingSource) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	total := len(mp.segments)
+	transition := make([]segment.Segment, 0, mp.windowSize+max(len(next.segments), mp.windowSize))
+	for i := range mp.windowSize {
+		transition = append(transition, mp.segments[(mp.currentPosition+i)%total])
+	}
+	for len(transition) < 2*mp.windowSize {
+		transition = append(transition, next.segments...)
+	}
+
+	mp.install(&pendingSource{
+		segments:       transition,
+		windowSize:     mp.windowSize,
+		targetDuration: max(mp.targetDuration, next.targetDuration),
+		version:        max(mp.version, next.version),
+		headerTags:     next.headerTags,
+	})
+	mp.currentPosition = 0
+	mp.startSequence = mp.sequenceNumber
+	mp.startPosition = 0
+	mp.pending = nil
+	mp.spliced = next
+}
+
+// finishSplice installs the spliced content once the window starts with its
+// first segment. Caller must hold the write lock.
+func (mp *mediaPlaylist) finishSplice() {
+	next := mp.spliced
+	mp.spliced = nil
+	mp.install(next)
+	mp.currentPosition = 0
+	mp.startSequence = mp.sequenceNumber
+	mp.startPosition = 0
+
+	mp.logger.Info("finished splicing in new segments",
+		"segments", len(mp.segments),
+		"sequence", mp.sequenceNumber,
+	)
+}
+
+// loop returns the segments played in a loop and the header of the media
+// playlist, which are those of the spliced content during a splice.
+// Caller must hold the lock.
+func (mp *mediaPlaylist) loop() (segments []segment.Segment, targetDuration, version int, headerTags []string) {
+	if next := mp.spliced; next != nil {
+		return next.segments, next.targetDuration, next.version, next.headerTags
+	}
+	return mp.segments, mp.targetDuration, mp.version, mp.headerTags
+}
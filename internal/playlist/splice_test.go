@@ -0,0 +1,166 @@
+package playlist
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// createEditedSegments returns count test segments named editedN.ts.
+func createEditedSegments(count int) []segment.Segment {
+	segments := createTestSegments(count)
+	for i := range segments {
+		segments[i].URL = strings.Replace(segments[i].URL, "segment", "edited", 1)
+	}
+	return segments
+}
+
+// windowEntries returns the media sequence number of a media playlist and
+// its entries: segment file names and "DISC" for discontinuities.
+func windowEntries(playlist string) (string, []string) {
+	var sequence string
+	var entries []string
+	for _, line := range strings.Split(playlist, "\n") {
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence = strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:")
+		case line == "#EXT-X-DISCONTINUITY":
+			entries = append(entries, "DISC")
+		case line != "" && !strings.HasPrefix(line, "#"):
+			entries = append(entries, filepath.Base(line))
+		}
+	}
+	return sequence, entries
+}
+
+func TestSplice(t *testing.T) {
+	type window struct {
+		sequence string
+		entries  []string
+	}
+	tests := []struct {
+		name     string
+		segments int
+		advances int
+		spliced  int
+		want     []window
+	}{
+		{
+			name:     "shorter content",
+			segments: 5, advances: 2, spliced: 2,
+			want: []window{
+				{"2", []string{"segment2.ts", "segment3.ts", "segment4.ts"}},
+				{"3", []string{"segment3.ts", "segment4.ts", "DISC", "edited0.ts"}},
+				{"4", []string{"segment4.ts", "DISC", "edited0.ts", "edited1.ts"}},
+				{"5", []string{"edited0.ts", "edited1.ts"}},
+				{"6", []string{"edited1.ts", "DISC", "edited0.ts"}},
+			},
+		},
+		{
+			name:     "live edge at loop point",
+			segments: 3, advances: 2, spliced: 4,
+			want: []window{
+				{"2", []string{"segment2.ts", "DISC", "segment0.ts"}},
+				{"3", []string{"segment0.ts", "DISC", "edited0.ts"}},
+				{"4", []string{"edited0.ts", "edited1.ts"}},
+				{"5", []string{"edited1.ts", "edited2.ts"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windowSize := min(3, tt.segments-1)
+			lp, err := New(createSingleVariant(createTestSegments(tt.segments), 10), windowSize, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for range tt.advances {
+				lp.Advance()
+			}
+			if err := lp.Splice(createSingleVariant(createEditedSegments(tt.spliced), 10)); err != nil {
+				t.Fatalf("Splice() error = %v", err)
+			}
+
+			for i, want := range tt.want {
+				if i > 0 {
+					lp.Advance()
+				}
+				playlist, err := lp.GenerateVariant(0)
+				if err != nil {
+					t.Fatalf("GenerateVariant() error = %v", err)
+				}
+				sequence, entries := windowEntries(playlist)
+				if sequence != want.sequence || !slices.Equal(entries, want.entries) {
+					t.Errorf("advance %d: sequence %s %v, want %s %v", i, sequence, entries, want.sequence, want.entries)
+				}
+			}
+		})
+	}
+}
+
+func TestSplice_ResumesSplicedContent(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	lp, err := NewWithOptions(createSingleVariant(createTestSegments(5), 10), Options{WindowSize: 3, StateFile: stateFile}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	lp.Advance()
+	spliced := createSingleVariant(createEditedSegments(4), 10)
+	if err := lp.Splice(spliced); err != nil {
+		t.Fatalf("Splice() error = %v", err)
+	}
+	lp.Advance()
+
+	// The VOD presentation is the spliced content right away
+	var vod strings.Builder
+	if err := lp.WriteVODVariant(&vod, 0); err != nil {
+		t.Fatalf("WriteVODVariant() error = %v", err)
+	}
+	if _, entries := windowEntries(vod.String()); !slices.Equal(entries, []string{"edited0.ts", "edited1.ts", "edited2.ts", "edited3.ts"}) {
+		t.Errorf("VOD entries = %v, want the spliced segments", entries)
+	}
+
+	// A restart loads the spliced content and resumes where the splice
+	// ends, without going back in media sequence numbers
+	resumed, err := NewWithOptions(spliced, Options{WindowSize: 3, StateFile: stateFile}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	playlist, _ := resumed.GenerateVariant(0)
+	sequence, entries := windowEntries(playlist)
+	if sequence != "4" || !slices.Equal(entries, []string{"edited0.ts", "edited1.ts", "edited2.ts"}) {
+		t.Errorf("resumed window = %s %v, want 4 [edited0.ts edited1.ts edited2.ts]", sequence, entries)
+	}
+}
+
+func TestCanSplice(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"live", Options{}, false},
+		{"continuous program date time", Options{ProgramDateTime: PDTContinuous}, false},
+		{"event", Options{Type: TypeEvent}, true},
+		{"debug subtitles", Options{DebugSubtitles: true}, true},
+		{"program date time reset", Options{ProgramDateTime: PDTReset}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.WindowSize = 2
+			lp, err := NewWithOptions(createTestVariants(2, 3), tt.opts, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			if err := lp.CanSplice(); (err != nil) != tt.wantErr {
+				t.Errorf("CanSplice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err := lp.Splice(createTestVariants(2, 4)); (err != nil) != tt.wantErr {
+				t.Errorf("Splice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
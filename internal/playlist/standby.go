@@ -0,0 +1,92 @@
+package playlist
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/standby"
+)
+
+// SetStandby stops the window from advancing on its own while on is set, so
+// that it only moves when Follow applies the primary's position.
+func (p *Playlist) SetStandby(on bool) {
+	if p.standby.Swap(on) != on {
+		p.logger.Info("standby mode changed", "standby", on)
+	}
+}
+
+// Standby reports whether SetStandby is in effect.
+func (p *Playlist) Standby() bool {
+	return p.standby.Load()
+}
+
+// Position returns the window position of every variant, as streamed to a
+// standby.
+func (p *Playlist) Position() standby.State {
+	state := standby.State{Variants: make([]standby.Position, len(p.variantPlaylists))}
+	for i, mp := range p.variantPlaylists {
+		mp.mu.RLock()
+		state.Variants[i] = standby.Position{
+			Position: mp.currentPosition,
+			Sequence: mp.sequenceNumber,
+		}
+		mp.mu.RUnlock()
+	}
+	return state
+}
+
+// Follow moves every variant to the position received from the primary of a
+// standby pair. The position is saved to the state file if it changed.
+func (p *Playlist) Follow(state standby.State) error {
+	if p.clusterMgr != nil {
+		return fmt.Errorf("following a primary is not supported in cluster mode")
+	}
+	if len(state.Variants) != len(p.variantPlaylists) {
+		return fmt.Errorf("primary has %d variants, this node has %d", len(state.Variants), len(p.variantPlaylists))
+	}
+	for i, mp := range p.variantPlaylists {
+		mp.mu.RLock()
+		total := len(mp.segments)
+		mp.mu.RUnlock()
+		if pos := state.Variants[i].Position; pos < 0 || pos >= total {
+			return fmt.Errorf("primary position %d of variant %d is outside its %d segments", pos, i, total)
+		}
+	}
+
+	now := p.now()
+	changed := false
+	for i, mp := range p.variantPlaylists {
+		if mp.follow(state.Variants[i], now) {
+			changed = true
+		}
+	}
+	if changed {
+		p.saveState()
+	}
+	return nil
+}
+
+// follow moves the window to pos and reports whether it moved. Gaps of up to
+// one loop are stepped through, so that program date times, cues and
+// scheduled replacements advance as they do on the primary; anything else
+// jumps straight to pos.
+func (mp *mediaPlaylist) follow(pos standby.Position, now time.Time) bool {
+	mp.mu.RLock()
+	sequence, position, total := mp.sequenceNumber, mp.currentPosition, len(mp.segments)
+	mp.mu.RUnlock()
+	if sequence == pos.Sequence && position == pos.Position {
+		return false
+	}
+
+	if pos.Sequence > sequence && pos.Sequence-sequence <= uint64(total) {
+		for range pos.Sequence - sequence {
+			mp.advance(now)
+		}
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.currentPosition = pos.Position % len(mp.segments)
+	mp.sequenceNumber = pos.Sequence
+	return true
+}
@@ -0,0 +1,72 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/standby"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func TestStandby(t *testing.T) {
+	variants := []variant.Variant{
+		{Segments: createTestSegments(5), TargetDuration: 10},
+		{Segments: createTestSegments(5), TargetDuration: 10},
+	}
+	lp, err := New(variants, 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	lp.SetStandby(true)
+	lp.Advance()
+	if !lp.Standby() || lp.MediaSequence() != 0 {
+		t.Errorf("Expected a standby window at sequence 0, got standby=%v sequence=%d", lp.Standby(), lp.MediaSequence())
+	}
+
+	tests := []struct {
+		name  string
+		state standby.State
+		want  standby.Position
+	}{
+		{"step", standby.State{Variants: []standby.Position{{Position: 2, Sequence: 2}, {Position: 2, Sequence: 2}}}, standby.Position{Position: 2, Sequence: 2}},
+		{"loop", standby.State{Variants: []standby.Position{{Position: 1, Sequence: 6}, {Position: 1, Sequence: 6}}}, standby.Position{Position: 1, Sequence: 6}},
+		{"jump", standby.State{Variants: []standby.Position{{Position: 3, Sequence: 1003}, {Position: 3, Sequence: 1003}}}, standby.Position{Position: 3, Sequence: 1003}},
+		{"backwards", standby.State{Variants: []standby.Position{{Position: 0, Sequence: 0}, {Position: 0, Sequence: 0}}}, standby.Position{Position: 0, Sequence: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := lp.Follow(tt.state); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for i, got := range lp.Position().Variants {
+				if got != tt.want {
+					t.Errorf("variant %d: expected %+v, got %+v", i, tt.want, got)
+				}
+			}
+		})
+	}
+
+	invalid := []standby.State{
+		{Variants: []standby.Position{{Position: 1, Sequence: 1}}},
+		{Variants: []standby.Position{{Position: 5, Sequence: 5}, {Position: 0, Sequence: 5}}},
+	}
+	for _, state := range invalid {
+		if err := lp.Follow(state); err == nil {
+			t.Errorf("Expected an error following %+v", state)
+		}
+	}
+
+	lp.SetStandby(false)
+	lp.Advance()
+	if lp.MediaSequence() != 1 {
+		t.Errorf("Expected an active window at sequence 1, got %d", lp.MediaSequence())
+	}
+	out, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(out, "#EXT-X-MEDIA-SEQUENCE:1\n") {
+		t.Errorf("Expected media sequence 1 in the variant playlist, got:\n%s", out)
+	}
+}
@@ -0,0 +1,136 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+// Start-over TV lets a viewer who tuned in late watch the loop from an
+// earlier point: the start-over playlist of a date is an EVENT playlist that
+// begins with the segment that aired at that date, by the program date time
+// of the live playlists, and grows with the live edge. Once it holds a whole
+// loop of the source, that loop has aired in full and the playlist ends with
+// EXT-X-ENDLIST, as a catch-up recording would.
+//
+// Segments behind the window are dated back from the live edge. PDTReset
+// re-anchors a pass only when it reaches the live edge, so the dates of
+// earlier passes are continuous with the current one.
+
+// startOverPrefix is the path prefix of the start-over presentation.
+const startOverPrefix = "/startover"
+
+// ErrStartOverDisabled is returned by the start-over writers when the
+// playlist was created without Options.ProgramDateTime.
+var ErrStartOverDisabled = errors.New("start-over requires program date time")
+
+// StartOverEnabled reports whether start-over playlists are served, which
+// needs the segments to be dated.
+func (p *Playlist) StartOverEnabled() bool {
+	return p.programDateTime != PDTOff
+}
+
+// WriteStartOverMaster writes the master playlist of the start-over
+// presentation from date from, whose variants are at
+// /startover/variant/N/playlist.m3u8?from=<from>.
+func (p *Playlist) WriteStartOverMaster(w io.Writer, from time.Time) error {
+	if !p.StartOverEnabled() {
+		return ErrStartOverDisabled
+	}
+	sw := &stickyWriter{w: w}
+	p.writeMaster(sw, startOverPrefix, "?from="+url.QueryEscape(from.Format(time.RFC3339Nano)))
+	return sw.err
+}
+
+// WriteStartOverVariant writes the start-over media playlist of a variant
+// from date from to w. It fails if from is after the live edge or before the
+// start of the stream. Errors are returned before anything is written.
+func (p *Playlist) WriteStartOverVariant(w io.Writer, variantIndex int, from time.Time) error {
+	if !p.StartOverEnabled() {
+		return ErrStartOverDisabled
+	}
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	return p.variantPlaylists[variantIndex].writeStartOver(w, from)
+}
+
+// writeStartOver writes the start-over playlist from date from to w.
+func (mp *mediaPlaylist) writeStartOver(w io.Writer, from time.Time) error {
+	mp.mu.RLock()
+	var (
+		segments       = mp.segments
+		windowSize     = mp.windowSize
+		position       = mp.currentPosition
+		sequenceNumber = mp.sequenceNumber
+		startSequence  = mp.startSequence
+		targetDuration = mp.targetDuration
+		version        = mp.version
+		headerTags     = mp.headerTags
+		cues           = mp.cues
+	)
+	dates := programDates(segments, position, windowSize, mp.pdtMode, mp.pdt, mp.loopPDT)
+	mp.mu.RUnlock()
+
+	totalSegments := len(segments)
+	edge := (position + windowSize - 1) % totalSegments
+	edgeSequence := sequenceNumber + uint64(windowSize) - 1
+	start, first, date, err := airedAt(segments, edge, edgeSequence, startSequence, dates[windowSize-1], from)
+	if err != nil {
+		return err
+	}
+	count := int(min(edgeSequence-first+1, uint64(totalSegments)))
+
+	sw := &stickyWriter{w: w}
+	fmt.Fprintln(sw, "#EXTM3U")
+	fmt.Fprintf(sw, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(sw, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(sw, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	fmt.Fprintf(sw, "#EXT-X-PLAYLIST-TYPE:%s\n", strings.ToUpper(string(TypeEvent)))
+	for _, tag := range headerTags {
+		fmt.Fprintln(sw, tag)
+	}
+	writeSegments(sw, segments, start, count, 0, first, cues,
+		programDates(segments, start, count, PDTContinuous, date, time.Time{}), simulation{pdtFormat: mp.simulation.pdtFormat})
+	if count == totalSegments {
+		fmt.Fprintln(sw, "#EXT-X-ENDLIST")
+	}
+	return sw.err
+}
+
+// airedAt returns the position, media sequence number and date of the
+// segment that aired at from, walking back from the segment at position
+// with media sequence number sequence and date date, at the live edge. It
+// does not go back past media sequence number startSequence.
+func airedAt(segments []segment.Segment, position int, sequence, startSequence uint64, date, from time.Time) (int, uint64, time.Time, error) {
+	if !from.Before(date.Add(segmentDuration(segments[position]))) {
+		return 0, 0, time.Time{}, fmt.Errorf("%s is after the live edge", from.UTC().Format(pdtLayout))
+	}
+
+	// Skip whole loops, which end where they started
+	totalSegments := len(segments)
+	var loop time.Duration
+	for _, seg := range segments {
+		loop += segmentDuration(seg)
+	}
+	if loop > 0 && date.After(from) {
+		loops := min(uint64(date.Sub(from)/loop), (sequence-startSequence)/uint64(totalSegments))
+		sequence -= loops * uint64(totalSegments)
+		date = date.Add(-time.Duration(loops) * loop)
+	}
+
+	for date.After(from) {
+		if sequence == startSequence {
+			return 0, 0, time.Time{}, fmt.Errorf("%s is before the start of the stream", from.UTC().Format(pdtLayout))
+		}
+		position = (position - 1 + totalSegments) % totalSegments
+		sequence--
+		date = date.Add(-segmentDuration(segments[position]))
+	}
+	return position, sequence, date, nil
+}
@@ -0,0 +1,109 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestWriteStartOverVariant(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 4, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+		{URL: "seg3.ts", Duration: 4, Sequence: 3},
+	}
+	lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 2, ProgramDateTime: PDTContinuous}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	for range 6 {
+		lp.Advance()
+	}
+
+	// The live edge is seg3.ts with media sequence number 7
+	live, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("GenerateVariant() error = %v", err)
+	}
+	dates, _ := playlistDates(t, live)
+	edge := dates[len(dates)-1]
+
+	tests := []struct {
+		name      string
+		from      time.Duration // relative to the date of the live edge, which is rounded to milliseconds
+		wantFirst string
+		wantURLs  string
+		wantEnd   bool
+		wantErr   bool
+	}{
+		{"live edge", time.Second, "#EXT-X-MEDIA-SEQUENCE:7\n", "seg3.ts", false, false},
+		{"within a segment", -9 * time.Second, "#EXT-X-MEDIA-SEQUENCE:5\n", "seg1.ts seg2.ts seg3.ts", false, false},
+		{"whole loop aired", -25 * time.Second, "#EXT-X-MEDIA-SEQUENCE:2\n", "seg2.ts seg3.ts seg0.ts seg1.ts", true, false},
+		{"start of the stream", -35 * time.Second, "#EXT-X-MEDIA-SEQUENCE:0\n", "seg0.ts seg1.ts seg2.ts seg3.ts", true, false},
+		{"before the stream", -37 * time.Second, "", "", false, true},
+		{"after the live edge", 5 * time.Second, "", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := lp.WriteStartOverVariant(&b, 0, edge.Add(tt.from))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteStartOverVariant() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if b.Len() != 0 {
+					t.Errorf("Expected nothing written on error, got:\n%s", b.String())
+				}
+				return
+			}
+			playlist := b.String()
+			if !strings.Contains(playlist, tt.wantFirst) || !strings.Contains(playlist, "#EXT-X-PLAYLIST-TYPE:EVENT\n") {
+				t.Errorf("Expected an EVENT playlist with %q:\n%s", strings.TrimSpace(tt.wantFirst), playlist)
+			}
+			if got := strings.Join(playlistURLs(playlist), " "); got != tt.wantURLs {
+				t.Errorf("segments %s, want %s", got, tt.wantURLs)
+			}
+			if got := strings.Contains(playlist, "#EXT-X-ENDLIST"); got != tt.wantEnd {
+				t.Errorf("ENDLIST = %v, want %v", got, tt.wantEnd)
+			}
+
+			// The segments are dated as in the live playlist
+			got, durations := playlistDates(t, playlist)
+			last := len(got) - 1
+			if !tt.wantEnd && !got[last].Equal(edge) {
+				t.Errorf("last segment dated %v, want %v", got[last], edge)
+			}
+			if from := edge.Add(tt.from); got[0].After(from) || !got[0].Add(durations[0]).After(from) {
+				t.Errorf("first segment %v+%v does not contain %v", got[0], durations[0], from)
+			}
+		})
+	}
+}
+
+func TestWriteStartOverMaster(t *testing.T) {
+	from := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	off, err := New(createTestVariants(2, 5), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := off.WriteStartOverMaster(&strings.Builder{}, from); !errors.Is(err, ErrStartOverDisabled) {
+		t.Errorf("WriteStartOverMaster() without program date time error = %v, want ErrStartOverDisabled", err)
+	}
+
+	lp, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, ProgramDateTime: PDTReset}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	var b strings.Builder
+	if err := lp.WriteStartOverMaster(&b, from); err != nil {
+		t.Fatalf("WriteStartOverMaster() error = %v", err)
+	}
+	if want := "\n/startover/variant/1/playlist.m3u8?from=2026-01-02T03%3A04%3A05Z\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("Expected %q in start-over master playlist:\n%s", strings.TrimSpace(want), b.String())
+	}
+}
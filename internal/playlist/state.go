@@ -0,0 +1,190 @@
+package playlist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/cluster"
+)
+
+// savedState is the window position written to Options.StateFile after every
+// advance.
+type savedState struct {
+	SavedAt  time.Time      `json:"saved_at"`
+	Variants []savedVariant `json:"variants"`
+}
+
+// savedVariant is the window position of one variant. Segments records the
+// loop length, so a state saved for different content is not resumed, and
+// Source the source variant served at this index (see LoadSources).
+type savedVariant struct {
+	Position int    `json:"position"`
+	Sequence uint64 `json:"sequence"`
+	Segments int    `json:"segments"`
+	Source   string `json:"source,omitempty"`
+}
+
+// loadState reads a state file. It returns nil without an error if the file
+// does not exist.
+func loadState(path string) (*savedState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// LoadSources returns the playlist URLs of the source variants in the order
+// they were served when the state file at path was saved, or nil if there is
+// no saved state or it predates the mapping.
+func LoadSources(path string) ([]string, error) {
+	state, err := loadState(path)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	sources := make([]string, len(state.Variants))
+	for i, sv := range state.Variants {
+		if sv.Source == "" {
+			return nil, nil
+		}
+		sources[i] = sv.Source
+	}
+	return sources, nil
+}
+
+// storeState writes a state file, replacing the previous one atomically.
+func storeState(path string, state *savedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// restoreState applies a saved position to the new playlists and their
+// cluster state. With catchUp, the position is moved forward by the advance
+// intervals that elapsed between the save and now, as if the process had kept
+// running; advanceRate shortens the intervals as for advanceTime. It returns
+// the number of advances caught up, or -1 if saved does not match the
+// playlists and was ignored.
+func restoreState(saved *savedState, playlists []*mediaPlaylist, states []cluster.VariantState, catchUp bool, advanceRate float64, now time.Time, logger *slog.Logger) int {
+	// states carry the sources of the playlists
+	if len(saved.Variants) != len(playlists) {
+		logger.Warn("saved window state does not match the source, starting from the beginning",
+			"savedVariants", len(saved.Variants),
+			"variants", len(playlists),
+		)
+		return -1
+	}
+	interval := 0
+	for i, mp := range playlists {
+		if source := saved.Variants[i].Source; source != "" && source != states[i].Source {
+			logger.Warn("saved window state is for other variants, starting from the beginning",
+				"variant", i,
+				"savedSource", source,
+				"source", states[i].Source,
+			)
+			return -1
+		}
+		if saved.Variants[i].Segments != len(mp.segments) {
+			logger.Warn("saved window state does not match the source, starting from the beginning",
+				"variant", i,
+				"savedSegments", saved.Variants[i].Segments,
+				"segments", len(mp.segments),
+			)
+			return -1
+		}
+		interval = max(interval, mp.targetDuration)
+	}
+
+	steps := 0
+	downtime := time.Duration(float64(now.Sub(saved.SavedAt)) * advanceRate)
+	if catchUp && interval > 0 && downtime > 0 {
+		steps = int(downtime / (time.Duration(interval) * time.Second))
+	}
+
+	for i, mp := range playlists {
+		sv := saved.Variants[i]
+		mp.currentPosition = (sv.Position + steps) % len(mp.segments)
+		mp.sequenceNumber = sv.Sequence + uint64(steps)
+		states[i].CurrentPosition = mp.currentPosition
+		states[i].SequenceNumber = mp.sequenceNumber
+	}
+
+	logger.Info("resumed window position from state file",
+		"savedAt", saved.SavedAt,
+		"sequence", playlists[0].sequenceNumber,
+		"caughtUp", steps,
+	)
+	return steps
+}
+
+// saveState writes the current position to the state file, if one is
+// configured. In cluster mode the replicated state is saved.
+func (p *Playlist) saveState() {
+	if p.stateFile == "" {
+		return
+	}
+
+	state := &savedState{
+		SavedAt:  p.now(),
+		Variants: make([]savedVariant, len(p.variantPlaylists)),
+	}
+	var clusterState cluster.ClusterState
+	if p.clusterMgr != nil {
+		clusterState = p.clusterMgr.GetState()
+	}
+	for i, mp := range p.variantPlaylists {
+		mp.mu.RLock()
+		sv := savedVariant{
+			Position: mp.currentPosition,
+			Sequence: mp.sequenceNumber,
+			Segments: len(mp.segments),
+			Source:   p.source(i),
+		}
+		if mp.spliced != nil {
+			// Resume at the start of the spliced content, which is what a
+			// restart loads
+			sv.Position = 0
+			sv.Sequence += uint64(mp.windowSize - mp.currentPosition)
+			sv.Segments = len(mp.spliced.segments)
+		}
+		mp.mu.RUnlock()
+		if i < len(clusterState.Variants) {
+			sv.Position = clusterState.Variants[i].CurrentPosition
+			sv.Sequence = clusterState.Variants[i].SequenceNumber
+		}
+		state.Variants[i] = sv
+	}
+
+	if err := storeState(p.stateFile, state); err != nil {
+		p.logger.Warn("failed to save window state", "path", p.stateFile, "error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package playlist
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/cluster"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func TestStateFile_SaveAndResume(t *testing.T) {
+	logger := createTestLogger()
+	path := filepath.Join(t.TempDir(), "state.json")
+	variants := []variant.Variant{{Segments: createTestSegments(5), TargetDuration: 10}}
+	opts := Options{WindowSize: 3, StateFile: path}
+
+	lp, err := NewWithOptions(variants, opts, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected no state file before the first advance, got %v", err)
+	}
+	for range 7 {
+		lp.Advance()
+	}
+
+	resumed, err := NewWithOptions(variants, opts, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := resumed.MediaSequence(); got != 7 {
+		t.Errorf("Expected resumed sequence 7, got %d", got)
+	}
+	if got := resumed.GetStats()["variants"].([]map[string]any)[0]["position"]; got != 2 {
+		t.Errorf("Expected resumed position 2, got %v", got)
+	}
+
+	// Different content starts from the beginning
+	other := []variant.Variant{{Segments: createTestSegments(4), TargetDuration: 10}}
+	fresh, err := NewWithOptions(other, opts, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := fresh.MediaSequence(); got != 0 {
+		t.Errorf("Expected sequence 0 for mismatched content, got %d", got)
+	}
+}
+
+func TestStateFile_VariantSources(t *testing.T) {
+	logger := createTestLogger()
+	path := filepath.Join(t.TempDir(), "state.json")
+	if sources, err := LoadSources(path); err != nil || sources != nil {
+		t.Fatalf("Expected no sources without a state file, got %v and %v", sources, err)
+	}
+
+	low := variant.Variant{PlaylistURL: "https://example.com/low.m3u8", Segments: createTestSegments(5), TargetDuration: 10}
+	high := variant.Variant{PlaylistURL: "https://example.com/high.m3u8", Segments: createTestSegments(5), TargetDuration: 10}
+	opts := Options{WindowSize: 3, StateFile: path}
+	lp, err := NewWithOptions([]variant.Variant{high, low}, opts, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lp.Advance()
+
+	sources, err := LoadSources(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if want := []string{high.PlaylistURL, low.PlaylistURL}; !slices.Equal(sources, want) {
+		t.Errorf("Expected sources %v, got %v", want, sources)
+	}
+
+	// A state saved for other variants at an index is not resumed
+	swapped, err := NewWithOptions([]variant.Variant{low, high}, opts, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := swapped.MediaSequence(); got != 0 {
+		t.Errorf("Expected sequence 0 for swapped variants, got %d", got)
+	}
+}
+
+func TestRestoreState(t *testing.T) {
+	savedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	saved := &savedState{
+		SavedAt: savedAt,
+		Variants: []savedVariant{
+			{Position: 3, Sequence: 103, Segments: 5},
+			{Position: 3, Sequence: 103, Segments: 5},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		segments     int
+		catchUp      bool
+		downtime     time.Duration
+		wantSteps    int
+		wantPosition int
+		wantSequence uint64
+	}{
+		{"resume without catch-up", 5, false, time.Hour, 0, 3, 103},
+		{"catch up missed intervals", 5, true, 25 * time.Second, 4, 2, 107},
+		{"partial interval is not caught up", 5, true, 5 * time.Second, 0, 3, 103},
+		{"clock went backwards", 5, true, -time.Minute, 0, 3, 103},
+		{"mismatched content", 6, true, time.Minute, -1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlists := make([]*mediaPlaylist, 2)
+			states := make([]cluster.VariantState, 2)
+			for i := range playlists {
+				playlists[i] = &mediaPlaylist{segments: createTestSegments(tt.segments), targetDuration: 5}
+			}
+			// The longest target duration sets the advance interval
+			playlists[1].targetDuration = 6
+
+			got := restoreState(saved, playlists, states, tt.catchUp, 1, savedAt.Add(tt.downtime), createTestLogger())
+			if got != tt.wantSteps {
+				t.Errorf("Expected %d steps, got %d", tt.wantSteps, got)
+			}
+			for i, mp := range playlists {
+				if mp.currentPosition != tt.wantPosition || mp.sequenceNumber != tt.wantSequence {
+					t.Errorf("Variant %d: expected position %d sequence %d, got %d and %d",
+						i, tt.wantPosition, tt.wantSequence, mp.currentPosition, mp.sequenceNumber)
+				}
+				if states[i].CurrentPosition != mp.currentPosition || states[i].SequenceNumber != mp.sequenceNumber {
+					t.Errorf("Variant %d: cluster state %+v does not match the playlist", i, states[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStateFile_ClockSkew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	variants := []variant.Variant{{Segments: createTestSegments(5), TargetDuration: 10}}
+	lp, err := NewWithOptions(variants, Options{WindowSize: 3, StateFile: path, ClockSkew: time.Hour}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lp.Advance()
+
+	saved, err := loadState(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if ahead := time.Until(saved.SavedAt); ahead < 59*time.Minute || ahead > time.Hour {
+		t.Errorf("Expected the save time an hour ahead, got %v", ahead)
+	}
+	if got := lp.GetStats()["clock_skew"]; got != "1h0m0s" {
+		t.Errorf("Expected clock_skew 1h0m0s, got %v", got)
+	}
+}
@@ -0,0 +1,138 @@
+package playlist
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// debugSubtitlesGroup is the GROUP-ID of the debug subtitle rendition.
+const debugSubtitlesGroup = "encodersim-debug"
+
+var (
+	// ErrDebugSubtitlesDisabled is returned by WriteDebugSubtitles and
+	// WriteDebugCue when the playlist was created without
+	// Options.DebugSubtitles.
+	ErrDebugSubtitlesDisabled = errors.New("debug subtitles are not enabled")
+
+	// ErrCueNotFound is returned by WriteDebugCue for a media sequence
+	// number outside the current window.
+	ErrCueNotFound = errors.New("cue not found")
+)
+
+// writeDebugSubtitlesMedia writes the master playlist entry of the debug
+// subtitle rendition. It is never selected unless the viewer asks for it.
+func writeDebugSubtitlesMedia(w io.Writer) {
+	fmt.Fprintf(w, "#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"encodersim debug\",LANGUAGE=\"zxx\",DEFAULT=NO,AUTOSELECT=NO,FORCED=NO,URI=\"/subtitles/playlist.m3u8\"\n",
+		debugSubtitlesGroup)
+}
+
+// DebugSubtitlesEnabled reports whether the master playlist has a debug
+// subtitle rendition.
+func (p *Playlist) DebugSubtitlesEnabled() bool {
+	return p.debugSubtitles
+}
+
+// WriteDebugSubtitles writes the media playlist of the debug subtitle
+// rendition to w. It follows variant 0's window, with one WebVTT segment
+// per media segment, and is rendered without the EXT-X-MAP and tags of the
+// media segments. Errors are returned before anything is written.
+func (p *Playlist) WriteDebugSubtitles(w io.Writer) error {
+	if !p.debugSubtitles {
+		return ErrDebugSubtitlesDisabled
+	}
+	if err := p.syncClusterState(0); err != nil {
+		return err
+	}
+
+	mp := p.variantPlaylists[0]
+	mp.mu.RLock()
+	var (
+		segments       = mp.segments
+		windowSize     = mp.windowSize
+		position       = mp.currentPosition
+		sequenceNumber = mp.sequenceNumber
+		targetDuration = mp.targetDuration
+	)
+	mp.mu.RUnlock()
+
+	sw := &stickyWriter{w: w}
+	fmt.Fprintln(sw, "#EXTM3U")
+	fmt.Fprintln(sw, "#EXT-X-VERSION:3")
+	fmt.Fprintf(sw, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(sw, "#EXT-X-MEDIA-SEQUENCE:%d\n", sequenceNumber)
+
+	totalSegments := len(segments)
+	for i := 0; i < windowSize; i++ {
+		seg := segments[(position+i)%totalSegments]
+		if i > 0 && seg.Sequence < segments[(position+i-1)%totalSegments].Sequence {
+			fmt.Fprintln(sw, "#EXT-X-DISCONTINUITY")
+		}
+		fmt.Fprintf(sw, "#EXTINF:%.3f,\n", seg.Duration)
+		fmt.Fprintf(sw, "/subtitles/%d.vtt\n", sequenceNumber+uint64(i))
+	}
+	return sw.err
+}
+
+// WriteDebugCue writes the WebVTT segment of the debug subtitle rendition
+// for the segment with media sequence number seq to w. Its cue shows the
+// sequence number, the segment's position in the loop, the number of
+// completed passes through the loop and the wall clock time it was served.
+// Segments that left the window less than a window ago are still found, so
+// that slow players do not miss them.
+//
+// The cue is placed at the segment's presentation time assuming, as DASH
+// output does, that the media timestamps of every pass start at zero.
+func (p *Playlist) WriteDebugCue(w io.Writer, seq uint64) error {
+	if !p.debugSubtitles {
+		return ErrDebugSubtitlesDisabled
+	}
+	if err := p.syncClusterState(0); err != nil {
+		return err
+	}
+
+	mp := p.variantPlaylists[0]
+	mp.mu.RLock()
+	var (
+		segments       = mp.segments
+		windowSize     = mp.windowSize
+		position       = mp.currentPosition
+		sequenceNumber = mp.sequenceNumber
+		startSequence  = mp.startSequence
+		startPosition  = mp.startPosition
+	)
+	mp.mu.RUnlock()
+
+	offset := int64(seq) - int64(sequenceNumber)
+	if offset < -int64(windowSize) || offset >= int64(windowSize) {
+		return fmt.Errorf("no segment %d in window starting at %d: %w", seq, sequenceNumber, ErrCueNotFound)
+	}
+	totalSegments := len(segments)
+	pos := int((int64(position)+offset)%int64(totalSegments)+int64(totalSegments)) % totalSegments
+
+	var start float64
+	for _, seg := range segments[:pos] {
+		start += seg.Duration
+	}
+	var loops uint64
+	if passStart := int64(seq) - int64(pos) - int64(startSequence) + int64(startPosition); passStart > 0 {
+		loops = uint64(passStart) / uint64(totalSegments)
+	}
+
+	sw := &stickyWriter{w: w}
+	fmt.Fprintln(sw, "WEBVTT")
+	// MPEG-TS timestamps are 33-bit values of a 90kHz clock
+	fmt.Fprintf(sw, "X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000\n\n", uint64(math.Round(start*90000))%(1<<33))
+	fmt.Fprintf(sw, "00:00:00.000 --> %s line:0 position:0%% align:start\n", vttTimestamp(segments[pos].Duration))
+	fmt.Fprintf(sw, "seq %d | segment %d/%d | loop %d\n", seq, pos+1, totalSegments, loops)
+	fmt.Fprintln(sw, p.now().UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	return sw.err
+}
+
+// vttTimestamp formats seconds as a WebVTT timestamp, such as
+// "00:00:06.000".
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, ms%1000)
+}
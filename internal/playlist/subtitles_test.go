@@ -0,0 +1,152 @@
+package playlist
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugSubtitles_Master(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(2, 4), Options{WindowSize: 3, DebugSubtitles: true, PreRender: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	master, err := lp.Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if !strings.Contains(master, `#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="encodersim-debug"`) {
+		t.Errorf("Expected the debug subtitle rendition in the master playlist:\n%s", master)
+	}
+	if n := strings.Count(master, `SUBTITLES="encodersim-debug"`); n != 2 {
+		t.Errorf("Expected both variants to reference the subtitles, got %d:\n%s", n, master)
+	}
+}
+
+func TestWriteDebugSubtitles(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3, DebugSubtitles: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	lp.Advance()
+	lp.Advance()
+
+	var b strings.Builder
+	if err := lp.WriteDebugSubtitles(&b); err != nil {
+		t.Fatalf("WriteDebugSubtitles() error = %v", err)
+	}
+	// Window [2 3 | 0] mirrors variant 0, loop point included
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:2\n" +
+		"#EXTINF:10.000,\n/subtitles/2.vtt\n" +
+		"#EXTINF:10.000,\n/subtitles/3.vtt\n" +
+		"#EXT-X-DISCONTINUITY\n#EXTINF:10.000,\n/subtitles/4.vtt\n"
+	if b.String() != want {
+		t.Errorf("WriteDebugSubtitles() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteDebugCue(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3, DebugSubtitles: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Six advances: window [2 3 | 0] of the second pass
+	for i := 0; i < 6; i++ {
+		lp.Advance()
+	}
+
+	tests := []struct {
+		name    string
+		seq     uint64
+		want    []string
+		wantErr error
+	}{
+		{"in window", 7, []string{"X-TIMESTAMP-MAP=MPEGTS:2700000,LOCAL:00:00:00.000", "00:00:00.000 --> 00:00:10.000", "seq 7 | segment 4/4 | loop 1"}, nil},
+		{"after loop point", 8, []string{"MPEGTS:0,", "seq 8 | segment 1/4 | loop 2"}, nil},
+		{"just left window", 4, []string{"seq 4 | segment 1/4 | loop 1"}, nil},
+		{"too old", 2, nil, ErrCueNotFound},
+		{"not yet live", 9, nil, ErrCueNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			err := lp.WriteDebugCue(&b, tt.seq)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WriteDebugCue() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.HasPrefix(b.String(), "WEBVTT\n") {
+				t.Errorf("Expected a WebVTT document, got:\n%s", b.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("cue missing %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDebugCue_StartPosition(t *testing.T) {
+	opts := Options{WindowSize: 3, DebugSubtitles: true, StartPosition: 2, StartSequence: 100}
+	lp, err := NewWithOptions(createTestVariants(1, 4), opts, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Window [2 3 | 0]: the first pass started mid-content
+	for seq, want := range map[uint64]string{
+		100: "seq 100 | segment 3/4 | loop 0",
+		102: "seq 102 | segment 1/4 | loop 1",
+	} {
+		var b strings.Builder
+		if err := lp.WriteDebugCue(&b, seq); err != nil {
+			t.Fatalf("WriteDebugCue(%d) error = %v", seq, err)
+		}
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("cue missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriteDebugCue_WallClock(t *testing.T) {
+	skew := time.Hour
+	lp, err := NewWithOptions(createTestVariants(1, 4), Options{WindowSize: 3, DebugSubtitles: true, ClockSkew: skew}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	before := time.Now().Add(skew).UTC().Format("2006-01-02T15:04")
+	var b strings.Builder
+	if err := lp.WriteDebugCue(&b, 0); err != nil {
+		t.Fatalf("WriteDebugCue() error = %v", err)
+	}
+	after := time.Now().Add(skew).UTC().Format("2006-01-02T15:04")
+
+	// The cue shows the node's perceived clock
+	if !strings.Contains(b.String(), before) && !strings.Contains(b.String(), after) {
+		t.Errorf("Expected the skewed wall clock %s in the cue:\n%s", before, b.String())
+	}
+}
+
+func TestDebugSubtitles_Disabled(t *testing.T) {
+	lp, err := New(createTestVariants(1, 4), 3, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := lp.WriteDebugSubtitles(&strings.Builder{}); !errors.Is(err, ErrDebugSubtitlesDisabled) {
+		t.Errorf("Expected ErrDebugSubtitlesDisabled, got %v", err)
+	}
+	if err := lp.WriteDebugCue(&strings.Builder{}, 0); !errors.Is(err, ErrDebugSubtitlesDisabled) {
+		t.Errorf("Expected ErrDebugSubtitlesDisabled, got %v", err)
+	}
+	master, _ := lp.Generate()
+	if strings.Contains(master, "SUBTITLES") {
+		t.Errorf("Expected no subtitle rendition without DebugSubtitles:\n%s", master)
+	}
+}
@@ -0,0 +1,86 @@
+package playlist
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// DurationMode selects what the playlists advertise when Options.TimeScale
+// compresses time.
+type DurationMode string
+
+const (
+	// DurationsScaled divides every EXTINF and EXT-X-TARGETDURATION by the
+	// time scale, so that the playlists stay consistent with the faster
+	// clock: a player sees a normal live stream of short segments.
+	DurationsScaled DurationMode = ""
+
+	// DurationsReal keeps the source durations, so that every reload finds
+	// time scale times more new segments than a real encoder would add.
+	DurationsReal DurationMode = "real"
+)
+
+// ParseDurationMode parses a duration mode name, ignoring case. An empty
+// name selects DurationsScaled.
+func ParseDurationMode(s string) (DurationMode, error) {
+	switch DurationMode(strings.ToLower(strings.TrimSpace(s))) {
+	case DurationsScaled, "scaled":
+		return DurationsScaled, nil
+	case DurationsReal:
+		return DurationsReal, nil
+	default:
+		return "", fmt.Errorf("unknown duration mode %q (expected scaled or real)", s)
+	}
+}
+
+// checkTimeScale validates the time scale options and returns the scale,
+// 1 if unset.
+func checkTimeScale(opts Options) (float64, error) {
+	scale := opts.TimeScale
+	if scale == 0 {
+		scale = 1
+	}
+	if scale < 0 || math.IsInf(scale, 0) || math.IsNaN(scale) {
+		return 0, fmt.Errorf("time scale must be a positive number, got %v", opts.TimeScale)
+	}
+	if scale != 1 && opts.TimeScaleDurations == DurationsReal && (opts.DASH || opts.Smooth) {
+		return 0, fmt.Errorf("DASH and Smooth Streaming output need scaled durations with a time scale, since players derive their timeline from the wall clock")
+	}
+	return scale, nil
+}
+
+// scaleVariants returns copies of variants whose segment and target
+// durations are divided by scale. The target durations are rounded up, and
+// raised where needed so that every EXTINF still rounds to at most the
+// target duration.
+func scaleVariants(variants []variant.Variant, scale float64) []variant.Variant {
+	if scale == 1 {
+		return variants
+	}
+	scaled := make([]variant.Variant, len(variants))
+	for i, v := range variants {
+		target := max(1, int(math.Ceil(float64(v.TargetDuration)/scale)))
+		segments := make([]segment.Segment, len(v.Segments))
+		for j, seg := range v.Segments {
+			seg.Duration /= scale
+			target = max(target, int(math.Round(seg.Duration)))
+			segments[j] = seg
+		}
+		scaled[i] = v
+		scaled[i].Segments = segments
+		scaled[i].TargetDuration = target
+	}
+	return scaled
+}
+
+// advanceTime converts a duration of the advertised media timeline into the
+// wall clock time it takes with DurationsReal, where the window advances
+// faster than the durations say.
+func (p *Playlist) advanceTime(d time.Duration) time.Duration {
+	return time.Duration(float64(d) / p.advanceRate)
+}
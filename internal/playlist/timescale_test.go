@@ -0,0 +1,163 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func TestParseDurationMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DurationMode
+		wantErr bool
+	}{
+		{"", DurationsScaled, false},
+		{"Scaled", DurationsScaled, false},
+		{"real", DurationsReal, false},
+		{"wall", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDurationMode(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDurationMode(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestScaleVariants(t *testing.T) {
+	tests := []struct {
+		name       string
+		durations  []float64
+		target     int
+		scale      float64
+		want       []float64
+		wantTarget int
+	}{
+		{"compressed", []float64{6.006, 6.006, 4}, 6, 4, []float64{1.5015, 1.5015, 1}, 2},
+		{"target at least one second", []float64{2, 2}, 2, 10, []float64{0.2, 0.2}, 1},
+		{"slowed down, target raised to the longest segment", []float64{10.4, 9}, 10, 0.5, []float64{20.8, 18}, 21},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := make([]segment.Segment, len(tt.durations))
+			for i, d := range tt.durations {
+				segments[i] = segment.Segment{URL: "seg.ts", Duration: d, Sequence: i}
+			}
+			variants := createSingleVariant(segments, tt.target)
+
+			scaled := scaleVariants(variants, tt.scale)
+			if scaled[0].TargetDuration != tt.wantTarget {
+				t.Errorf("TargetDuration = %d, want %d", scaled[0].TargetDuration, tt.wantTarget)
+			}
+			for i, seg := range scaled[0].Segments {
+				if diff := seg.Duration - tt.want[i]; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("segment %d Duration = %v, want %v", i, seg.Duration, tt.want[i])
+				}
+			}
+			if variants[0].Segments[0].Duration != tt.durations[0] || variants[0].TargetDuration != tt.target {
+				t.Error("scaleVariants() modified its input")
+			}
+		})
+	}
+}
+
+func TestTimeScale(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 4, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+	}
+	tests := []struct {
+		name         string
+		durations    DurationMode
+		wantInterval time.Duration
+		wantDelay    time.Duration
+		wantTags     []string
+	}{
+		{
+			name:         "scaled",
+			durations:    DurationsScaled,
+			wantInterval: 2 * time.Second,
+			wantDelay:    1500 * time.Millisecond,
+			wantTags:     []string{"#EXT-X-TARGETDURATION:2\n", "#EXTINF:1.500,\nseg0.ts", "#EXTINF:1.000,\nseg1.ts"},
+		},
+		{
+			name:         "real",
+			durations:    DurationsReal,
+			wantInterval: 1500 * time.Millisecond,
+			wantDelay:    1500 * time.Millisecond,
+			wantTags:     []string{"#EXT-X-TARGETDURATION:6\n", "#EXTINF:6.000,\nseg0.ts", "#EXTINF:4.000,\nseg1.ts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 2, TimeScale: 4, TimeScaleDurations: tt.durations}, nil, createTestLogger())
+			if err != nil {
+				t.Fatalf("NewWithOptions() error = %v", err)
+			}
+			if got := lp.AdvanceInterval(); got != tt.wantInterval {
+				t.Errorf("AdvanceInterval() = %v, want %v", got, tt.wantInterval)
+			}
+			if got := lp.advanceDelay(); got != tt.wantDelay {
+				t.Errorf("advanceDelay() = %v, want %v", got, tt.wantDelay)
+			}
+			playlist, err := lp.GenerateVariant(0)
+			if err != nil {
+				t.Fatalf("GenerateVariant() error = %v", err)
+			}
+			for _, tag := range tt.wantTags {
+				if !strings.Contains(playlist, tag) {
+					t.Errorf("playlist lacks %q:\n%s", tag, playlist)
+				}
+			}
+			if stats := lp.GetStats(); stats["time_scale"] != 4.0 || stats["scaled_durations"] != (tt.durations == DurationsScaled) {
+				t.Errorf("stats time_scale = %v, scaled_durations = %v", stats["time_scale"], stats["scaled_durations"])
+			}
+		})
+	}
+}
+
+func TestTimeScale_Replace(t *testing.T) {
+	segments := createTestSegments(3)
+	lp, err := NewWithOptions(createSingleVariant(segments, 10), Options{WindowSize: 2, TimeScale: 2}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	replacement := []segment.Segment{{URL: "new0.ts", Duration: 8, Sequence: 0}, {URL: "new1.ts", Duration: 8, Sequence: 1}}
+	if err := lp.Replace(createSingleVariant(replacement, 8)); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	for range 3 {
+		lp.Advance()
+	}
+	playlist, err := lp.GenerateVariant(0)
+	if err != nil {
+		t.Fatalf("GenerateVariant() error = %v", err)
+	}
+	if !strings.Contains(playlist, "#EXTINF:4.000,\nnew0.ts") {
+		t.Errorf("replacement segments are not scaled:\n%s", playlist)
+	}
+}
+
+func TestTimeScale_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"negative", Options{TimeScale: -2}},
+		{"real durations with DASH", Options{TimeScale: 4, TimeScaleDurations: DurationsReal, DASH: true}},
+		{"real durations with Smooth", Options{TimeScale: 4, TimeScaleDurations: DurationsReal, Smooth: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.WindowSize = 2
+			if _, err := NewWithOptions([]variant.Variant{createTestVariants(1, 3)[0]}, tt.opts, nil, createTestLogger()); err == nil {
+				t.Error("NewWithOptions() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package playlist
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The source is also served as it is, once and complete with EXT-X-ENDLIST,
+// so that one instance can back both live and VOD test cases of the same
+// asset. Unlike Options.Type, the VOD presentation does not replace the live
+// one, and it never changes as the live window advances. Its segment URLs
+// are those of the live playlists: segments are still served by the source
+// origin.
+
+// vodPrefix is the path prefix of the VOD presentation.
+const vodPrefix = "/vod"
+
+// WriteVODMaster writes the master playlist of the VOD presentation, whose
+// variants are at /vod/variant/N/playlist.m3u8 in the order of the live
+// master playlist.
+func (p *Playlist) WriteVODMaster(w io.Writer) error {
+	sw := &stickyWriter{w: w}
+	p.writeMaster(sw, vodPrefix, "")
+	return sw.err
+}
+
+// WriteVODVariant writes the VOD media playlist of a variant to w: every
+// segment of the source in order, from media sequence number 0. Validation
+// errors are returned before anything is written.
+func (p *Playlist) WriteVODVariant(w io.Writer, variantIndex int) error {
+	if variantIndex < 0 || variantIndex >= len(p.variants) {
+		return fmt.Errorf("%w: %d (0-%d)", ErrVariantOutOfRange, variantIndex, len(p.variants)-1)
+	}
+	return p.variantPlaylists[variantIndex].writeVOD(w)
+}
+
+// writeVOD writes the source as a VOD media playlist to w.
+func (mp *mediaPlaylist) writeVOD(w io.Writer) error {
+	mp.mu.RLock()
+	segments, targetDuration, version, headerTags := mp.loop()
+	mp.mu.RUnlock()
+
+	sw := &stickyWriter{w: w}
+	fmt.Fprintln(sw, "#EXTM3U")
+	fmt.Fprintf(sw, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(sw, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintln(sw, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintf(sw, "#EXT-X-PLAYLIST-TYPE:%s\n", strings.ToUpper(string(TypeVOD)))
+	for _, tag := range headerTags {
+		fmt.Fprintln(sw, tag)
+	}
+	writeSegments(sw, segments, 0, len(segments), 0, 0, nil, nil, simulation{})
+	fmt.Fprintln(sw, "#EXT-X-ENDLIST")
+	return sw.err
+}
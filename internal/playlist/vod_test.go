@@ -0,0 +1,65 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestWriteVODVariant(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 6, Sequence: 0},
+		{URL: "seg1.ts", Duration: 6, Sequence: 1},
+		{URL: "seg2.ts", Duration: 6, Sequence: 2},
+	}
+	lp, err := NewWithOptions(createSingleVariant(segments, 6), Options{WindowSize: 2, PreRender: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+
+	// The VOD playlist does not follow the live window
+	for range 4 {
+		lp.Advance()
+	}
+	var b strings.Builder
+	if err := lp.WriteVODVariant(&b, 0); err != nil {
+		t.Fatalf("WriteVODVariant() error = %v", err)
+	}
+	playlist := b.String()
+	if got := strings.Join(playlistURLs(playlist), " "); got != "seg0.ts seg1.ts seg2.ts" {
+		t.Errorf("segments %s, want seg0.ts seg1.ts seg2.ts", got)
+	}
+	for _, tag := range []string{"#EXT-X-MEDIA-SEQUENCE:0\n", "#EXT-X-PLAYLIST-TYPE:VOD\n", "#EXT-X-ENDLIST\n"} {
+		if !strings.Contains(playlist, tag) {
+			t.Errorf("Expected %q in VOD playlist:\n%s", tag, playlist)
+		}
+	}
+	if strings.Contains(playlist, "#EXT-X-DISCONTINUITY") {
+		t.Errorf("Expected no loop point in VOD playlist:\n%s", playlist)
+	}
+
+	if err := lp.WriteVODVariant(&b, 1); err == nil {
+		t.Error("Expected an error for an unknown variant")
+	}
+}
+
+func TestWriteVODMaster(t *testing.T) {
+	lp, err := NewWithOptions(createTestVariants(2, 5), Options{WindowSize: 3, DebugSubtitles: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	var b strings.Builder
+	if err := lp.WriteVODMaster(&b); err != nil {
+		t.Fatalf("WriteVODMaster() error = %v", err)
+	}
+	master := b.String()
+	for _, uri := range []string{"\n/vod/variant/0/playlist.m3u8\n", "\n/vod/variant/1/playlist.m3u8\n"} {
+		if !strings.Contains(master, uri) {
+			t.Errorf("Expected %q in VOD master playlist:\n%s", strings.TrimSpace(uri), master)
+		}
+	}
+	if strings.Contains(master, "SUBTITLES") {
+		t.Errorf("Expected no debug subtitles in VOD master playlist:\n%s", master)
+	}
+}
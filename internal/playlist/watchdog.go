@@ -0,0 +1,126 @@
+package playlist
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WatchdogOptions configures the advance watchdog of RunAutoAdvance.
+type WatchdogOptions struct {
+	// Multiplier is how many advance intervals may pass without a completed
+	// advance before the advance loop counts as stalled. Zero disables the
+	// watchdog.
+	Multiplier int
+
+	// Restart restarts the advance loop when it stalls, at most once per
+	// Multiplier intervals. A loop stuck inside a call cannot be interrupted
+	// and is abandoned; a fresh one takes over.
+	Restart bool
+}
+
+// watchdog records advance progress and stall detections.
+type watchdog struct {
+	lastAdvance atomic.Int64 // Unix nanoseconds of the last completed advance
+
+	mu       sync.Mutex
+	stalled  bool
+	stalls   uint64
+	restarts uint64
+}
+
+// advanced records a completed advance. On a cluster follower, an advance
+// completes as soon as the leader is known to be responsible for it.
+func (w *watchdog) advanced() {
+	w.lastAdvance.Store(time.Now().UnixNano())
+}
+
+// sinceAdvance returns the time since the last completed advance.
+func (w *watchdog) sinceAdvance() time.Duration {
+	return time.Since(time.Unix(0, w.lastAdvance.Load()))
+}
+
+// RunAutoAdvance runs StartAutoAdvance until ctx is cancelled, watched by a
+// watchdog unless wd.Multiplier is 0. The watchdog flags the loop as stalled
+// when no advance has completed within wd.Multiplier advance intervals, which
+// catches a stuck goroutine as well as advances that keep failing (such as
+// rejected Raft applies), and restarts the loop if wd.Restart is set.
+func (p *Playlist) RunAutoAdvance(ctx context.Context, wd WatchdogOptions) {
+	if wd.Multiplier <= 0 {
+		p.StartAutoAdvance(ctx)
+		return
+	}
+
+	interval := p.AdvanceInterval()
+	limit := time.Duration(wd.Multiplier) * interval
+
+	p.watchdog.advanced()
+	loopCtx, stopLoop := context.WithCancel(ctx)
+	go p.StartAutoAdvance(loopCtx)
+	lastRestart := time.Now()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			stopLoop()
+			return
+		case <-ticker.C:
+		}
+
+		since := p.watchdog.sinceAdvance()
+		p.watchdog.mu.Lock()
+		if since <= limit {
+			if p.watchdog.stalled {
+				p.watchdog.stalled = false
+				p.logger.Info("advance loop recovered")
+			}
+			p.watchdog.mu.Unlock()
+			continue
+		}
+		if !p.watchdog.stalled {
+			p.watchdog.stalled = true
+			p.watchdog.stalls++
+			p.logger.Error("advance loop stalled",
+				"sinceLastAdvance", since.Round(time.Millisecond),
+				"limit", limit,
+			)
+		}
+		restart := wd.Restart && time.Since(lastRestart) > limit
+		if restart {
+			p.watchdog.restarts++
+		}
+		p.watchdog.mu.Unlock()
+
+		if restart {
+			p.logger.Warn("restarting advance loop")
+			stopLoop()
+			loopCtx, stopLoop = context.WithCancel(ctx)
+			go p.StartAutoAdvance(loopCtx)
+			lastRestart = time.Now()
+		}
+	}
+}
+
+// AdvanceStalled reports whether the watchdog currently considers the advance
+// loop stalled, and how long ago the last advance completed.
+func (p *Playlist) AdvanceStalled() (bool, time.Duration) {
+	p.watchdog.mu.Lock()
+	defer p.watchdog.mu.Unlock()
+	return p.watchdog.stalled, p.watchdog.sinceAdvance()
+}
+
+// watchdogStats returns the watchdog counters for GetStats.
+func (p *Playlist) watchdogStats() map[string]any {
+	p.watchdog.mu.Lock()
+	defer p.watchdog.mu.Unlock()
+	return map[string]any{
+		"stalled":           p.watchdog.stalled,
+		"stalls":            p.watchdog.stalls,
+		"restarts":          p.watchdog.restarts,
+		"last_advance_unix": float64(p.watchdog.lastAdvance.Load()+p.clockSkew.Nanoseconds()) / 1e9,
+	}
+}
@@ -0,0 +1,92 @@
+package playlist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// shortSegments returns count one-second segments, which advance every
+// second.
+func shortSegments(count int) []segment.Segment {
+	segments := createTestSegments(count)
+	for i := range segments {
+		segments[i].Duration = 1
+	}
+	return segments
+}
+
+func TestRunAutoAdvance_WatchdogRestartsStalledLoop(t *testing.T) {
+	logger := createTestLogger()
+	variants := []variant.Variant{{Segments: shortSegments(5), TargetDuration: 1}}
+	lp, err := New(variants, 3, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lp.RunAutoAdvance(ctx, WatchdogOptions{Multiplier: 1, Restart: true})
+
+	// Holding the variant lock blocks the advance loop inside advance()
+	waitFor(t, 3*time.Second, func() bool { return lp.MediaSequence() > 0 })
+	mp := lp.variantPlaylists[0]
+	mp.mu.Lock()
+	waitFor(t, 5*time.Second, func() bool {
+		stalled, _ := lp.AdvanceStalled()
+		return stalled
+	})
+	waitFor(t, 5*time.Second, func() bool {
+		lp.watchdog.mu.Lock()
+		defer lp.watchdog.mu.Unlock()
+		return lp.watchdog.restarts > 0
+	})
+	mp.mu.Unlock()
+
+	waitFor(t, 5*time.Second, func() bool {
+		stalled, _ := lp.AdvanceStalled()
+		return !stalled
+	})
+
+	stats := lp.GetStats()["watchdog"].(map[string]any)
+	if stats["stalls"] != uint64(1) {
+		t.Errorf("Expected 1 stall, got %v", stats["stalls"])
+	}
+	if _, since := lp.AdvanceStalled(); since > 2*time.Second {
+		t.Errorf("Expected a recent advance after recovery, last was %v ago", since)
+	}
+}
+
+func TestRunAutoAdvance_WatchdogDisabled(t *testing.T) {
+	logger := createTestLogger()
+	lp, err := New(createSingleVariant(shortSegments(5), 1), 3, nil, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	lp.RunAutoAdvance(ctx, WatchdogOptions{})
+
+	if got := lp.MediaSequence(); got != 1 {
+		t.Errorf("Expected one advance without the watchdog, got sequence %d", got)
+	}
+	if stalled, _ := lp.AdvanceStalled(); stalled {
+		t.Error("Expected no stall without the watchdog")
+	}
+}
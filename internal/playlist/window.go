@@ -0,0 +1,60 @@
+package playlist
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WindowPolicy decides what happens when the window size exceeds the
+// segment count of some variants.
+type WindowPolicy string
+
+const (
+	// WindowPerVariant clamps each short variant's window to its own segment
+	// count, so renditions may serve windows of different lengths.
+	WindowPerVariant WindowPolicy = "per-variant"
+
+	// WindowClampMin clamps every variant's window to the segment count of
+	// the shortest variant, so all renditions serve the same window length.
+	WindowClampMin WindowPolicy = "clamp-min"
+
+	// WindowError rejects sources with a variant shorter than the window.
+	WindowError WindowPolicy = "error"
+)
+
+// ParseWindowPolicy parses a window policy name. An empty name selects
+// WindowPerVariant.
+func ParseWindowPolicy(s string) (WindowPolicy, error) {
+	switch WindowPolicy(strings.ToLower(strings.TrimSpace(s))) {
+	case "", WindowPerVariant:
+		return WindowPerVariant, nil
+	case WindowClampMin:
+		return WindowClampMin, nil
+	case WindowError:
+		return WindowError, nil
+	default:
+		return "", fmt.Errorf("unknown window policy %q (expected per-variant, clamp-min or error)", s)
+	}
+}
+
+// effectiveWindows returns the window size of each variant, given their
+// segment counts, when windowSize segments are requested.
+func effectiveWindows(windowSize int, policy WindowPolicy, segmentCounts []int) ([]int, error) {
+	shortest := windowSize
+	for i, n := range segmentCounts {
+		if n < windowSize && policy == WindowError {
+			return nil, fmt.Errorf("window size %d exceeds the %d segments of variant %d", windowSize, n, i)
+		}
+		shortest = min(shortest, n)
+	}
+
+	windows := make([]int, len(segmentCounts))
+	for i, n := range segmentCounts {
+		if policy == WindowClampMin {
+			windows[i] = shortest
+		} else {
+			windows[i] = min(windowSize, n)
+		}
+	}
+	return windows, nil
+}
@@ -0,0 +1,78 @@
+package playlist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWindowPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    WindowPolicy
+		wantErr bool
+	}{
+		{"", WindowPerVariant, false},
+		{"per-variant", WindowPerVariant, false},
+		{"Clamp-Min", WindowClampMin, false},
+		{"error", WindowError, false},
+		{"shortest", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWindowPolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWindowPolicy(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewWithOptions_WindowPolicy(t *testing.T) {
+	// Variants with 8, 4 and 6 segments and a window of 6
+	variants := createTestVariants(3, 8)
+	variants[1].Segments = variants[1].Segments[:4]
+	variants[2].Segments = variants[2].Segments[:6]
+
+	tests := []struct {
+		policy      WindowPolicy
+		wantWindows []int
+		wantErr     bool
+	}{
+		{"", []int{6, 4, 6}, false},
+		{WindowPerVariant, []int{6, 4, 6}, false},
+		{WindowClampMin, []int{4, 4, 4}, false},
+		{WindowError, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			lp, err := NewWithOptions(variants, Options{WindowSize: 6, WindowPolicy: tt.policy}, nil, createTestLogger())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), "variant 1") {
+					t.Errorf("Expected the error to name variant 1, got %v", err)
+				}
+				return
+			}
+
+			stats := lp.GetStats()
+			if stats["window_requested"] != 6 {
+				t.Errorf("Expected window_requested 6, got %v", stats["window_requested"])
+			}
+			var windows []int
+			for i, vs := range stats["variants"].([]map[string]any) {
+				windows = append(windows, vs["window_size"].(int))
+				if clamped := vs["window_clamped"].(bool); clamped != (windows[i] < 6) {
+					t.Errorf("variant %d: window_clamped = %v with window %d", i, clamped, windows[i])
+				}
+				playlist, _ := lp.GenerateVariant(i)
+				if n := strings.Count(playlist, "#EXTINF"); n != windows[i] {
+					t.Errorf("variant %d: %d segments served, want %d", i, n, windows[i])
+				}
+			}
+			if !reflect.DeepEqual(windows, tt.wantWindows) {
+				t.Errorf("window sizes = %v, want %v", windows, tt.wantWindows)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+// Package prime warms the cache of a CDN in front of the simulated stream:
+// every segment that reaches the live edge of a media playlist is fetched
+// once through a CDN edge, as the first player to reach it would, so that
+// the players behind that edge hit a filled cache. How long each fetch
+// takes is the edge's fill latency, which turns the simulator into a canary
+// for the CDN of a live workflow.
+//
+// Bodies are read to the end, since edges only cache complete responses,
+// and discarded: the simulator still never stores or serves media.
+package prime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserAgent identifies the primer's requests in the logs of the CDN and the
+// origin.
+const UserAgent = "encodersim-cdn-primer"
+
+const (
+	// DefaultInterval is how often the live edge is checked when
+	// Options.Interval is 0.
+	DefaultInterval = 250 * time.Millisecond
+
+	// defaultTimeout bounds each fetch of the default client.
+	defaultTimeout = 30 * time.Second
+)
+
+// Segment is the newest segment of one media playlist.
+type Segment struct {
+	// Playlist names the media playlist as its path is served, such as
+	// "variant/0" or "rendition/1".
+	Playlist string
+
+	// Sequence is the media sequence number of the segment.
+	Sequence uint64
+
+	// URL is the segment URL as published in the playlist.
+	URL string
+}
+
+// Window is the live stream whose edge is primed; *playlist.Playlist
+// implements it.
+type Window interface {
+	// LiveEdge returns the newest segment of every media playlist.
+	LiveEdge() []Segment
+}
+
+// Options configures a Primer.
+type Options struct {
+	// Edge is the CDN edge URL. The path of every segment URL is appended
+	// to its path, and the query of the segment URL replaces its query.
+	Edge *url.URL
+
+	// Client fetches segments through the edge. If nil, a client with a
+	// 30-second timeout is used.
+	Client *http.Client
+
+	// Interval is how often the live edge is checked for a new segment;
+	// DefaultInterval if 0.
+	Interval time.Duration
+}
+
+// Primer fetches every segment that reaches the live edge of a Window
+// through a CDN edge and records the fill latency. It is safe for
+// concurrent use.
+type Primer struct {
+	opts   Options
+	window Window
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	primed map[string]uint64 // playlist to the newest sequence fetched
+	fills  map[string]*Fill
+	order  []string // playlists in the order they were first primed
+}
+
+// Fill is the priming record of one media playlist.
+type Fill struct {
+	Playlist string  `json:"playlist"`
+	Fetches  uint64  `json:"fetches"`
+	Errors   uint64  `json:"errors"`
+	Seconds  float64 `json:"seconds"`      // total latency of successful fetches
+	Last     float64 `json:"last_seconds"` // latency of the last successful fetch
+}
+
+// ParseEdge parses the --prime-cdn edge URL, which must be an absolute
+// http or https URL without a query or fragment.
+func ParseEdge(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("edge URL must be http or https, got %q", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("edge URL %q has no host", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("edge URL %q must not have a query or fragment", s)
+	}
+	return u, nil
+}
+
+// EdgeURL returns the URL of segmentURL through edge: the segment's path
+// below the edge's path prefix, with the segment's query. It reports false
+// for segments that are not served over HTTP, which cannot be reached
+// through a CDN.
+func EdgeURL(edge *url.URL, segmentURL string) (string, bool) {
+	u, err := url.Parse(segmentURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	out := *edge
+	out.Path = strings.TrimSuffix(edge.Path, "/") + "/" + strings.TrimPrefix(u.Path, "/")
+	out.RawPath = ""
+	out.RawQuery = u.RawQuery
+	return out.String(), true
+}
+
+// New creates a Primer for window.
+func New(window Window, opts Options, logger *slog.Logger) *Primer {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultTimeout}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	return &Primer{
+		opts:   opts,
+		window: window,
+		logger: logger,
+		primed: make(map[string]uint64),
+		fills:  make(map[string]*Fill),
+	}
+}
+
+// Run checks the live edge every Interval and fetches each new segment
+// until ctx is cancelled. The segments at the edge when Run starts are
+// fetched too. Fetches run concurrently, so a slow edge does not delay the
+// next segment; Run returns once they have finished.
+func (p *Primer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		for _, seg := range p.newSegments(p.window.LiveEdge()) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.prime(ctx, seg)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newSegments returns the segments of edge that have not been fetched yet
+// and records them as fetched. Only the newest segment of a playlist is
+// fetched; segments that the edge skipped over between two checks, such as
+// after a catch-up, are not.
+func (p *Primer) newSegments(edge []Segment) []Segment {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var segments []Segment
+	for _, seg := range edge {
+		if last, ok := p.primed[seg.Playlist]; ok && last == seg.Sequence {
+			continue
+		}
+		p.primed[seg.Playlist] = seg.Sequence
+		if _, ok := EdgeURL(p.opts.Edge, seg.URL); ok {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// prime fetches one segment through the edge and records the fill latency,
+// the time until the whole body was read.
+func (p *Primer) prime(ctx context.Context, seg Segment) {
+	edgeURL, _ := EdgeURL(p.opts.Edge, seg.URL)
+	start := time.Now()
+	status, err := p.fetch(ctx, edgeURL)
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	fill := p.fills[seg.Playlist]
+	if fill == nil {
+		fill = &Fill{Playlist: seg.Playlist}
+		p.fills[seg.Playlist] = fill
+		p.order = append(p.order, seg.Playlist)
+	}
+	fill.Fetches++
+	if err != nil {
+		fill.Errors++
+	} else {
+		fill.Seconds += elapsed.Seconds()
+		fill.Last = elapsed.Seconds()
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		p.logger.Warn("CDN priming failed", "playlist", seg.Playlist, "sequence", seg.Sequence, "url", edgeURL, "error", err)
+		return
+	}
+	p.logger.Debug("CDN primed", "playlist", seg.Playlist, "sequence", seg.Sequence, "url", edgeURL,
+		"status", status, "latency", elapsed.Round(time.Millisecond))
+}
+
+// fetch GETs rawURL and discards the body.
+func (p *Primer) fetch(ctx context.Context, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, fmt.Errorf("read body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("edge returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Fills returns the priming record of every media playlist fetched so far,
+// in the order of their first fetch.
+func (p *Primer) Fills() []Fill {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fills := make([]Fill, len(p.order))
+	for i, playlist := range p.order {
+		fills[i] = *p.fills[playlist]
+	}
+	return fills
+}
+
+// Stats returns the edge and the totals of all playlists, for /health.
+func (p *Primer) Stats() map[string]any {
+	var fetches, errors uint64
+	var seconds float64
+	fills := p.Fills()
+	for _, fill := range fills {
+		fetches += fill.Fetches
+		errors += fill.Errors
+		seconds += fill.Seconds
+	}
+	var mean float64
+	if ok := fetches - errors; ok > 0 {
+		mean = seconds / float64(ok)
+	}
+	return map[string]any{
+		"edge":                 p.opts.Edge.String(),
+		"fetches":              fetches,
+		"errors":               errors,
+		"mean_latency_seconds": mean,
+		"playlists":            fills,
+	}
+}
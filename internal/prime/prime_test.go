@@ -0,0 +1,174 @@
+package prime
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestParseEdge(t *testing.T) {
+	tests := []struct {
+		in      string
+		wantErr bool
+	}{
+		{"https://edge.example.com/prefix", false},
+		{"http://edge.example.com:8080", false},
+		{"ftp://edge.example.com", true},
+		{"edge.example.com/prefix", true},
+		{"https:///prefix", true},
+		{"https://edge.example.com/prefix?token=1", true},
+		{"https://edge.example.com/#top", true},
+		{"%", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParseEdge(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseEdge(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEdgeURL(t *testing.T) {
+	tests := []struct {
+		edge    string
+		segment string
+		want    string
+		wantOK  bool
+	}{
+		{"https://edge.example.com/prefix", "https://origin.example.com/live/seg1.ts", "https://edge.example.com/prefix/live/seg1.ts", true},
+		{"https://edge.example.com/prefix/", "http://origin.example.com/seg1.ts?token=abc", "https://edge.example.com/prefix/seg1.ts?token=abc", true},
+		{"http://edge.example.com", "https://origin.example.com/a%20b/seg.ts", "http://edge.example.com/a%20b/seg.ts", true},
+		{"https://edge.example.com/prefix", "segments/seg1.ts", "", false},
+		{"https://edge.example.com/prefix", "file:///media/seg1.ts", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.segment, func(t *testing.T) {
+			edge, err := ParseEdge(tt.edge)
+			if err != nil {
+				t.Fatalf("ParseEdge(%q) error = %v", tt.edge, err)
+			}
+			got, ok := EdgeURL(edge, tt.segment)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("EdgeURL(%q, %q) = %q, %v, want %q, %v", tt.edge, tt.segment, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// fakeWindow is a Window whose edge the test sets.
+type fakeWindow struct {
+	mu   sync.Mutex
+	edge []Segment
+}
+
+func (w *fakeWindow) LiveEdge() []Segment {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Segment(nil), w.edge...)
+}
+
+func (w *fakeWindow) set(edge ...Segment) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.edge = edge
+}
+
+func TestPrimer(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	edgeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		mu.Unlock()
+		if r.UserAgent() != UserAgent {
+			t.Errorf("User-Agent = %q, want %q", r.UserAgent(), UserAgent)
+		}
+		if r.URL.Path == "/cdn/live/missing.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(make([]byte, 1024))
+	}))
+	defer edgeServer.Close()
+
+	edge, err := ParseEdge(edgeServer.URL + "/cdn")
+	if err != nil {
+		t.Fatalf("ParseEdge() error = %v", err)
+	}
+	window := &fakeWindow{}
+	window.set(
+		Segment{Playlist: "variant/0", Sequence: 10, URL: "https://origin.example.com/live/v0_10.ts"},
+		Segment{Playlist: "variant/1", Sequence: 10, URL: "local/v1_10.ts"},
+	)
+	p := New(window, Options{Edge: edge, Interval: 5 * time.Millisecond}, testLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	waitFetches := func(want uint64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if got := p.Stats()["fetches"].(uint64); got >= want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("fetches = %v, want %d", p.Stats()["fetches"], want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFetches(1)
+	window.set(
+		Segment{Playlist: "variant/0", Sequence: 11, URL: "https://origin.example.com/live/missing.ts"},
+		Segment{Playlist: "variant/1", Sequence: 10, URL: "local/v1_10.ts"},
+	)
+	waitFetches(2)
+	window.set(Segment{Playlist: "variant/0", Sequence: 12, URL: "https://origin.example.com/live/v0_12.ts?part=1"})
+	waitFetches(3)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	mu.Lock()
+	got := requests
+	mu.Unlock()
+	want := []string{"/cdn/live/v0_10.ts", "/cdn/live/missing.ts", "/cdn/live/v0_12.ts?part=1"}
+	if len(got) != len(want) {
+		t.Fatalf("edge requests = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("edge request %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	fills := p.Fills()
+	if len(fills) != 1 || fills[0].Playlist != "variant/0" || fills[0].Fetches != 3 || fills[0].Errors != 1 {
+		t.Fatalf("Fills() = %+v, want 3 fetches and 1 error of variant/0", fills)
+	}
+	if fills[0].Seconds <= 0 || fills[0].Last <= 0 {
+		t.Errorf("Fills() = %+v, want positive latencies", fills)
+	}
+	stats := p.Stats()
+	if stats["edge"] != edgeServer.URL+"/cdn" || stats["errors"] != uint64(1) || stats["mean_latency_seconds"].(float64) <= 0 {
+		t.Errorf("Stats() = %v", stats)
+	}
+}
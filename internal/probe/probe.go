@@ -0,0 +1,155 @@
+// Package probe enriches parsed segments with metadata from the origin by
+// issuing HEAD requests, and derives real bitrates from the measured sizes.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// Options configures a probe pass.
+type Options struct {
+	// Client issues the HEAD requests.
+	Client *http.Client
+
+	// Concurrency is the number of requests in flight at once.
+	Concurrency int
+}
+
+// Summary reports the outcome of a probe pass.
+type Summary struct {
+	// Probed is the number of segments that returned a size.
+	Probed int
+	// Failed is the number of segments whose HEAD request failed or
+	// returned no Content-Length.
+	Failed int
+}
+
+// Segments issues a HEAD request for every segment of every variant and
+// returns copies of the variants with Segment.Size and Segment.ContentType
+// filled in and MeasuredBandwidth and MeasuredAverageBandwidth computed.
+// Individual request failures are logged and counted in the Summary; an error
+// is returned only if ctx is cancelled.
+func Segments(ctx context.Context, variants []variant.Variant, opts Options, logger *slog.Logger) ([]variant.Variant, Summary, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	type job struct {
+		variant, segment int
+	}
+
+	result := make([]variant.Variant, len(variants))
+	jobs := make(chan job)
+	for i, v := range variants {
+		result[i] = v
+		result[i].Segments = segment.Clone(v.Segments)
+	}
+
+	var (
+		mu      sync.Mutex
+		summary Summary
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				seg := &result[j.variant].Segments[j.segment]
+				size, contentType, err := head(ctx, opts.Client, seg.URL)
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed++
+					logger.Warn("segment probe failed", "variant", j.variant, "url", seg.URL, "error", err)
+				} else {
+					summary.Probed++
+					seg.Size = size
+					seg.ContentType = contentType
+					// A byte-range segment is only part of the resource
+					if length, _, err := segment.ParseByteRange(seg.ByteRange); err == nil {
+						seg.Size = length
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for i := range result {
+		for j := range result[i].Segments {
+			select {
+			case jobs <- job{variant: i, segment: j}:
+			case <-ctx.Done():
+				break send
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, summary, err
+	}
+
+	for i := range result {
+		result[i].MeasuredBandwidth, result[i].MeasuredAverageBandwidth = Bitrates(result[i].Segments)
+	}
+
+	return result, summary, nil
+}
+
+// head issues a HEAD request and returns the Content-Length and Content-Type.
+func head(ctx context.Context, client *http.Client, url string) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength <= 0 {
+		return 0, "", fmt.Errorf("no Content-Length")
+	}
+
+	return resp.ContentLength, resp.Header.Get("Content-Type"), nil
+}
+
+// Bitrates computes the peak and average bitrate in bits per second of the
+// segments with a known size. Both are 0 if no segment has a size.
+func Bitrates(segments []segment.Segment) (peak, average int) {
+	var totalBits, totalSeconds float64
+	for _, seg := range segments {
+		if seg.Size <= 0 || seg.Duration <= 0 {
+			continue
+		}
+		bits := float64(seg.Size) * 8
+		if rate := int(bits / seg.Duration); rate > peak {
+			peak = rate
+		}
+		totalBits += bits
+		totalSeconds += seg.Duration
+	}
+	if totalSeconds > 0 {
+		average = int(totalBits / totalSeconds)
+	}
+	return peak, average
+}
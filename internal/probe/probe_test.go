@@ -0,0 +1,123 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func TestBitrates(t *testing.T) {
+	tests := []struct {
+		name        string
+		segments    []segment.Segment
+		wantPeak    int
+		wantAverage int
+	}{
+		{name: "no sizes", segments: []segment.Segment{{Duration: 10}}},
+		{
+			name: "uniform",
+			segments: []segment.Segment{
+				{Duration: 10, Size: 1_250_000},
+				{Duration: 10, Size: 1_250_000},
+			},
+			wantPeak:    1_000_000,
+			wantAverage: 1_000_000,
+		},
+		{
+			name: "peak differs from average",
+			segments: []segment.Segment{
+				{Duration: 4, Size: 1_000_000}, // 2 Mbps
+				{Duration: 6, Size: 750_000},   // 1 Mbps
+				{Duration: 6},                  // unknown size is ignored
+			},
+			wantPeak:    2_000_000,
+			wantAverage: 1_400_000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peak, average := Bitrates(tt.segments)
+			if peak != tt.wantPeak || average != tt.wantAverage {
+				t.Errorf("Bitrates() = %d, %d; want %d, %d", peak, average, tt.wantPeak, tt.wantAverage)
+			}
+		})
+	}
+}
+
+func TestSegments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected HEAD request, got %s", r.Method)
+		}
+		if strings.Contains(r.URL.Path, "missing") {
+			http.NotFound(w, r)
+			return
+		}
+		// Segment size in bytes is encoded in the path: /<size>.ts
+		size := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".ts")
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Content-Length", size)
+	}))
+	defer server.Close()
+
+	variants := []variant.Variant{
+		{
+			Bandwidth: 1,
+			Segments: []segment.Segment{
+				{URL: server.URL + "/1250000.ts", Duration: 10},
+				{URL: server.URL + "/2500000.ts", Duration: 10},
+				{URL: server.URL + "/missing.ts", Duration: 10},
+			},
+		},
+		{
+			Segments: []segment.Segment{{URL: server.URL + "/500000.ts", Duration: 4}},
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	got, summary, err := Segments(context.Background(), variants, Options{Client: server.Client(), Concurrency: 3}, logger)
+	if err != nil {
+		t.Fatalf("Segments() error = %v", err)
+	}
+
+	if summary.Probed != 3 || summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 3 probed and 1 failed", summary)
+	}
+	if variants[0].Segments[0].Size != 0 {
+		t.Error("Expected input variants to be left unmodified")
+	}
+
+	seg := got[0].Segments[1]
+	if seg.Size != 2_500_000 || seg.ContentType != "video/mp2t" {
+		t.Errorf("segment = %+v, want size 2500000 and type video/mp2t", seg)
+	}
+	if got[0].Segments[2].Size != 0 {
+		t.Errorf("Expected failed probe to leave size unknown, got %d", got[0].Segments[2].Size)
+	}
+	if got[0].MeasuredBandwidth != 2_000_000 || got[0].MeasuredAverageBandwidth != 1_500_000 {
+		t.Errorf("variant 0 measured = %d peak, %d average; want 2000000, 1500000",
+			got[0].MeasuredBandwidth, got[0].MeasuredAverageBandwidth)
+	}
+	if want := 500_000 * 8 / 4; got[1].MeasuredBandwidth != want {
+		t.Errorf("variant 1 measured = %d, want %d", got[1].MeasuredBandwidth, want)
+	}
+}
+
+func TestSegments_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	variants := []variant.Variant{{Segments: []segment.Segment{{URL: "http://127.0.0.1:1/a.ts", Duration: 1}}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, _, err := Segments(ctx, variants, Options{}, logger); err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+}
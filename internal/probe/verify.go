@@ -0,0 +1,255 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+// VerifyOptions configures a source verification pass.
+type VerifyOptions struct {
+	// Client downloads the segments.
+	Client *http.Client
+
+	// Concurrency is the number of downloads in flight at once.
+	Concurrency int
+
+	// Sample limits verification to this many evenly spaced segments per
+	// variant. Zero verifies every segment.
+	Sample int
+
+	// CheckFormat validates MPEG-TS sync bytes or fMP4 box headers at the
+	// start of each segment.
+	CheckFormat bool
+}
+
+// SegmentResult is the verification outcome for one segment.
+type SegmentResult struct {
+	Variant   int    `json:"variant"`
+	Index     int    `json:"index"`
+	URL       string `json:"url"`
+	ByteRange string `json:"byte_range,omitempty"`
+	Bytes     int64  `json:"bytes"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report lists the outcome of every verified segment.
+type Report struct {
+	Results []SegmentResult `json:"results"`
+}
+
+// Failed returns the results of segments that failed verification.
+func (r *Report) Failed() []SegmentResult {
+	var failed []SegmentResult
+	for _, res := range r.Results {
+		if res.Error != "" {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// WriteText writes a human-readable summary listing every failed segment.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	failed := r.Failed()
+	fmt.Fprintf(&b, "verified %d segments: %d ok, %d failed\n", len(r.Results), len(r.Results)-len(failed), len(failed))
+	for _, res := range failed {
+		fmt.Fprintf(&b, "  variant %d segment %d: %s: %s\n", res.Variant, res.Index, res.URL, res.Error)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Verify downloads the segments of every variant (or a sample of them) and
+// checks that each is reachable and non-empty, and optionally that it looks
+// like MPEG-TS or fMP4. Results are in variant and segment order. An error is
+// returned only if ctx is cancelled.
+func Verify(ctx context.Context, variants []variant.Variant, opts VerifyOptions) (*Report, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+
+	report := &Report{}
+	for vi, v := range variants {
+		for _, si := range sampleIndexes(len(v.Segments), opts.Sample) {
+			report.Results = append(report.Results, SegmentResult{
+				Variant:   vi,
+				Index:     si,
+				URL:       v.Segments[si].URL,
+				ByteRange: v.Segments[si].ByteRange,
+			})
+		}
+	}
+
+	jobs := make(chan *SegmentResult)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for res := range jobs {
+				n, err := download(ctx, opts.Client, res.URL, res.ByteRange, opts.CheckFormat)
+				res.Bytes = n
+				if err != nil {
+					res.Error = err.Error()
+				}
+			}
+		}()
+	}
+
+send:
+	for i := range report.Results {
+		select {
+		case jobs <- &report.Results[i]:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// sampleIndexes returns up to sample evenly spaced indexes in [0, n),
+// or all of them if sample is zero or at least n.
+func sampleIndexes(n, sample int) []int {
+	if sample <= 0 || sample >= n {
+		sample = n
+	}
+	indexes := make([]int, sample)
+	for i := range indexes {
+		indexes[i] = i * n / sample
+	}
+	return indexes
+}
+
+// formatCheckBytes is how much of each segment is kept for format checks:
+// enough for two MPEG-TS packets or an fMP4 box header.
+const formatCheckBytes = 2 * tsPacketSize
+
+// download fetches url, or only byteRange ("length@offset") of it if set,
+// returning the number of bytes read.
+func download(ctx context.Context, client *http.Client, url, byteRange string, checkFormat bool) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	wantStatus := http.StatusOK
+	if byteRange != "" {
+		length, offset, err := segment.ParseByteRange(byteRange)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		wantStatus = http.StatusPartialContent
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	head := make([]byte, formatCheckBytes)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return int64(n), fmt.Errorf("read body: %w", err)
+	}
+	head = head[:n]
+
+	rest, err := io.Copy(io.Discard, resp.Body)
+	total := int64(n) + rest
+	if err != nil {
+		return total, fmt.Errorf("read body: %w", err)
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("empty body")
+	}
+
+	if checkFormat {
+		if err := checkSegmentFormat(url, head); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+)
+
+// fmp4BoxTypes are the box types a CMAF/fMP4 media or init segment may start with.
+var fmp4BoxTypes = map[string]bool{
+	"ftyp": true, "styp": true, "moof": true, "moov": true,
+	"sidx": true, "emsg": true, "prft": true, "free": true,
+}
+
+// checkSegmentFormat validates the start of a segment. The container is chosen
+// from the URL extension; unknown extensions accept any recognized container.
+func checkSegmentFormat(url string, head []byte) error {
+	ext := strings.ToLower(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	switch ext {
+	case ".ts":
+		return checkTS(head)
+	case ".m4s", ".mp4", ".m4v", ".m4a", ".cmfv", ".cmfa":
+		return checkFMP4(head)
+	}
+
+	if checkTS(head) == nil || checkFMP4(head) == nil ||
+		bytes.HasPrefix(head, []byte("ID3")) || bytes.HasPrefix(head, []byte("WEBVTT")) {
+		return nil
+	}
+	return fmt.Errorf("unrecognized segment format")
+}
+
+// checkTS verifies the MPEG-TS sync byte at the start of each complete packet.
+func checkTS(head []byte) error {
+	if len(head) < tsPacketSize {
+		return fmt.Errorf("MPEG-TS segment shorter than one packet (%d bytes)", len(head))
+	}
+	for off := 0; off+tsPacketSize <= len(head); off += tsPacketSize {
+		if head[off] != tsSyncByte {
+			return fmt.Errorf("missing MPEG-TS sync byte at offset %d", off)
+		}
+	}
+	return nil
+}
+
+// checkFMP4 verifies that the segment starts with a plausible ISO BMFF box.
+func checkFMP4(head []byte) error {
+	if len(head) < 8 {
+		return fmt.Errorf("fMP4 segment shorter than a box header (%d bytes)", len(head))
+	}
+	size := binary.BigEndian.Uint32(head[:4])
+	boxType := string(head[4:8])
+	if !fmp4BoxTypes[boxType] {
+		return fmt.Errorf("unexpected fMP4 box type %q", boxType)
+	}
+	if size != 1 && size < 8 {
+		return fmt.Errorf("invalid fMP4 box size %d", size)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/variant"
+)
+
+func tsPackets(n int) []byte {
+	b := make([]byte, n*tsPacketSize)
+	for i := 0; i < n; i++ {
+		b[i*tsPacketSize] = tsSyncByte
+	}
+	return b
+}
+
+func TestCheckSegmentFormat(t *testing.T) {
+	moof := append([]byte{0, 0, 0, 24}, []byte("moof")...)
+
+	tests := []struct {
+		name    string
+		url     string
+		head    []byte
+		wantErr bool
+	}{
+		{name: "ts", url: "seg.ts", head: tsPackets(2)},
+		{name: "ts with query", url: "seg.ts?token=x", head: tsPackets(2)},
+		{name: "ts bad second sync", url: "seg.ts", head: append(tsPackets(1), make([]byte, tsPacketSize)...), wantErr: true},
+		{name: "ts too short", url: "seg.ts", head: []byte{tsSyncByte}, wantErr: true},
+		{name: "html error page as ts", url: "seg.ts", head: []byte(strings.Repeat("<html>", 64)), wantErr: true},
+		{name: "fmp4", url: "seg.m4s", head: moof},
+		{name: "fmp4 bad box", url: "seg.m4s", head: append([]byte{0, 0, 0, 24}, []byte("junk")...), wantErr: true},
+		{name: "unknown extension sniffs ts", url: "seg", head: tsPackets(2)},
+		{name: "unknown extension sniffs fmp4", url: "seg.bin", head: moof},
+		{name: "packed audio", url: "seg.aac", head: []byte("ID3\x04\x00")},
+		{name: "unknown content", url: "seg.bin", head: []byte("hello world"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSegmentFormat(tt.url, tt.head)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkSegmentFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSampleIndexes(t *testing.T) {
+	tests := []struct {
+		n, sample int
+		want      []int
+	}{
+		{n: 4, sample: 0, want: []int{0, 1, 2, 3}},
+		{n: 4, sample: 10, want: []int{0, 1, 2, 3}},
+		{n: 10, sample: 3, want: []int{0, 3, 6}},
+		{n: 0, sample: 3, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		got := sampleIndexes(tt.n, tt.sample)
+		if len(got) != len(tt.want) {
+			t.Errorf("sampleIndexes(%d, %d) = %v, want %v", tt.n, tt.sample, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("sampleIndexes(%d, %d) = %v, want %v", tt.n, tt.sample, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good.ts":
+			w.Write(tsPackets(10))
+		case "/empty.ts":
+		case "/corrupt.ts":
+			w.Write([]byte("<html>gateway error</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	variants := []variant.Variant{{
+		Segments: []segment.Segment{
+			{URL: server.URL + "/good.ts"},
+			{URL: server.URL + "/empty.ts"},
+			{URL: server.URL + "/corrupt.ts"},
+			{URL: server.URL + "/missing.ts"},
+		},
+	}}
+
+	report, err := Verify(context.Background(), variants, VerifyOptions{Client: server.Client(), Concurrency: 2, CheckFormat: true})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	if len(report.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(report.Results))
+	}
+	if r := report.Results[0]; r.Error != "" || r.Bytes != 10*tsPacketSize {
+		t.Errorf("good segment result = %+v", r)
+	}
+
+	failed := report.Failed()
+	if len(failed) != 3 {
+		t.Fatalf("Expected 3 failures, got %+v", failed)
+	}
+	for i, want := range []string{"empty body", "MPEG-TS", "HTTP 404"} {
+		if !strings.Contains(failed[i].Error, want) {
+			t.Errorf("failure %d = %q, want it to mention %q", i, failed[i].Error, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "4 segments: 1 ok, 3 failed") || !strings.Contains(buf.String(), "/missing.ts") {
+		t.Errorf("unexpected report text:\n%s", buf.String())
+	}
+}
+
+func TestVerify_ByteRange(t *testing.T) {
+	packed := tsPackets(4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "packed.ts", time.Time{}, bytes.NewReader(packed))
+	}))
+	defer server.Close()
+
+	variants := []variant.Variant{{
+		Segments: []segment.Segment{
+			{URL: server.URL + "/packed.ts", ByteRange: "376@0"},
+			{URL: server.URL + "/packed.ts", ByteRange: "376@376"},
+			{URL: server.URL + "/packed.ts", ByteRange: "376@752"}, // past the end
+		},
+	}}
+
+	report, err := Verify(context.Background(), variants, VerifyOptions{Client: server.Client(), CheckFormat: true})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	for i, r := range report.Results[:2] {
+		if r.Error != "" || r.Bytes != 2*tsPacketSize {
+			t.Errorf("sub-range %d result = %+v, want %d bytes", i, r, 2*tsPacketSize)
+		}
+	}
+	if r := report.Results[2]; r.Error == "" {
+		t.Errorf("expected unsatisfiable range to fail, got %+v", r)
+	}
+}
@@ -0,0 +1,57 @@
+// Package ratelimit provides the token bucket behind the server's request
+// rate limits (--rate-limit, --client-rate-limit) and the per-tenant limits
+// of API keys (--api-keys).
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Bucket is a token bucket: it allows rate events per second, in bursts of
+// up to its burst size. A Bucket is not safe for concurrent use; callers
+// guard it with their own lock.
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket of rate tokens per second. A zero burst
+// allows one second of events, and at least one. A zero rate never limits.
+func NewBucket(rate float64, burst int) *Bucket {
+	b := float64(burst)
+	if b == 0 {
+		b = max(1, math.Ceil(rate))
+	}
+	return &Bucket{rate: rate, burst: b, tokens: b}
+}
+
+// Take takes one token at now, or returns how long until one is available.
+func (b *Bucket) Take(now time.Time) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Full reports whether the bucket is back at a full burst at now, so that
+// a new bucket would behave the same.
+func (b *Bucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens earned since the last call.
+func (b *Bucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
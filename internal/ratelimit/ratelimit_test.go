@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_Take(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   int
+		offsets []time.Duration
+		want    []time.Duration // wait of each take, 0 if allowed
+	}{
+		{
+			name:    "unlimited",
+			offsets: []time.Duration{0, 0, 0},
+			want:    []time.Duration{0, 0, 0},
+		},
+		{
+			name:    "default burst of one second",
+			rate:    2,
+			offsets: []time.Duration{0, 0, 0},
+			want:    []time.Duration{0, 0, 500 * time.Millisecond},
+		},
+		{
+			name:    "refill",
+			rate:    1,
+			burst:   1,
+			offsets: []time.Duration{0, 250 * time.Millisecond, time.Second},
+			want:    []time.Duration{0, 750 * time.Millisecond, 0},
+		},
+		{
+			name:    "fractional rate",
+			rate:    0.5,
+			offsets: []time.Duration{0, 0},
+			want:    []time.Duration{0, 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBucket(tt.rate, tt.burst)
+			for i, offset := range tt.offsets {
+				if got := b.Take(start.Add(offset)); got != tt.want[i] {
+					t.Errorf("take %d: wait = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBucket_Full(t *testing.T) {
+	start := time.Now()
+	b := NewBucket(1, 2)
+	b.Take(start)
+	if b.Full(start) {
+		t.Error("Full() right after a take")
+	}
+	if !b.Full(start.Add(time.Second)) {
+		t.Error("not Full() once the token is back")
+	}
+}
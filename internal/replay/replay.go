@@ -0,0 +1,255 @@
+// Package replay re-sends the requests mirrored by a previous run (see
+// package mirror) to another origin with their original timing, to compare
+// the origins under identical load.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/bench"
+	"github.com/agleyzer/encodersim/internal/mirror"
+	"github.com/agleyzer/encodersim/internal/sleep"
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// Load reads the mirror index name, either an index file or the storage
+// location a mirror was written to (see storage.Open), and returns the
+// entries whose request path matches filter (all of them if filter is nil)
+// in the order the requests arrived.
+func Load(ctx context.Context, name string, filter *regexp.Regexp) ([]mirror.Entry, error) {
+	var index []byte
+	if info, err := os.Stat(name); err == nil && !info.IsDir() {
+		if index, err = os.ReadFile(name); err != nil {
+			return nil, err
+		}
+	} else {
+		store, err := storage.Open(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		if index, err = store.Get(ctx, mirror.IndexFile); err != nil {
+			return nil, fmt.Errorf("%s: %w", store, err)
+		}
+		name = strings.TrimSuffix(store.String(), "/") + "/" + mirror.IndexFile
+	}
+
+	var entries []mirror.Entry
+	scanner := bufio.NewScanner(bytes.NewReader(index))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e mirror.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		if filter == nil || filter.MatchString(e.Path) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// Config configures a replay.
+type Config struct {
+	// Target is the base URL of the origin to replay against, such as
+	// "http://localhost:9090". Request paths and queries are appended.
+	Target string
+
+	// Entries are the requests to replay, in arrival order.
+	Entries []mirror.Entry
+
+	// Speed scales the replay: 2 replays twice as fast. 1 if zero.
+	Speed float64
+
+	// HTTPClient is used for all requests (a default client if nil).
+	HTTPClient *http.Client
+}
+
+// Stats compares the original and the replayed responses of a group of
+// requests.
+type Stats struct {
+	Requests int64 `json:"requests"`
+
+	// Errors are requests that got no response at all.
+	Errors int64 `json:"errors"`
+
+	// Mismatches are responses whose status differs from the original.
+	Mismatches int64 `json:"status_mismatches"`
+
+	Original *bench.Histogram `json:"original_latency"`
+	Replayed *bench.Histogram `json:"replayed_latency"`
+}
+
+func newStats() *Stats {
+	return &Stats{Original: bench.NewHistogram(), Replayed: bench.NewHistogram()}
+}
+
+// Result is the outcome of a replay.
+type Result struct {
+	Target  string            `json:"target"`
+	Elapsed time.Duration     `json:"elapsed"`
+	Total   *Stats            `json:"total"`
+	Groups  map[string]*Stats `json:"groups"`
+}
+
+// Group returns the group a request path is reported in: the directory of
+// the path, such as "/variant/0/", or the path itself for top-level
+// documents such as "/playlist.m3u8".
+func Group(p string) string {
+	dir := path.Dir(p)
+	if dir == "/" || dir == "." {
+		return p
+	}
+	return dir + "/"
+}
+
+// Run replays cfg.Entries against cfg.Target, sending each request at its
+// original offset from the first one, and blocks until every response is in
+// or ctx is cancelled.
+func Run(ctx context.Context, cfg Config, logger *slog.Logger) (*Result, error) {
+	if cfg.Target == "" {
+		return nil, fmt.Errorf("target URL is required")
+	}
+	if len(cfg.Entries) == 0 {
+		return nil, fmt.Errorf("no requests to replay")
+	}
+	if cfg.Speed < 0 {
+		return nil, fmt.Errorf("speed must be positive")
+	}
+	if cfg.Speed == 0 {
+		cfg.Speed = 1
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	target := strings.TrimSuffix(cfg.Target, "/")
+
+	result := &Result{Target: cfg.Target, Total: newStats(), Groups: make(map[string]*Stats)}
+	var mu sync.Mutex
+	record := func(e mirror.Entry, status int, latency time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		group := result.Groups[Group(e.Path)]
+		if group == nil {
+			group = newStats()
+			result.Groups[Group(e.Path)] = group
+		}
+		for _, s := range []*Stats{result.Total, group} {
+			s.Requests++
+			s.Original.Observe(e.Duration)
+			if err != nil {
+				s.Errors++
+				continue
+			}
+			if status != e.Status {
+				s.Mismatches++
+			}
+			s.Replayed.Observe(latency)
+		}
+	}
+
+	start := time.Now()
+	first := cfg.Entries[0].Time
+	var wg sync.WaitGroup
+	for _, e := range cfg.Entries {
+		offset := time.Duration(float64(e.Time.Sub(first)) / cfg.Speed)
+		if sleep.Sleep(ctx, time.Until(start.Add(offset))) != nil {
+			break
+		}
+		wg.Add(1)
+		go func(e mirror.Entry) {
+			defer wg.Done()
+			status, latency, err := send(ctx, client, target, e)
+			if err != nil {
+				logger.Debug("replayed request failed", "path", e.Path, "error", err)
+			}
+			record(e, status, latency, err)
+		}(e)
+	}
+	wg.Wait()
+	result.Elapsed = time.Since(start)
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// send replays one request and returns its status and the time until the
+// body was read.
+func send(ctx context.Context, client *http.Client, target string, e mirror.Entry) (int, time.Duration, error) {
+	url := target + e.Path
+	if e.Query != "" {
+		url += "?" + e.Query
+	}
+	req, err := http.NewRequestWithContext(ctx, e.Method, url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if e.UserAgent != "" {
+		req.Header.Set("User-Agent", e.UserAgent)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, 0, err
+	}
+	return resp.StatusCode, time.Since(start), nil
+}
+
+// WriteJSON writes the machine-readable report.
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable summary table, one row per group and
+// one for all requests.
+func (r *Result) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "replayed against %s in %s\n", r.Target, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintln(tw, "GROUP\tREQUESTS\tERRORS\tMISMATCHES\tORIG P50\tORIG P99\tREPLAY P50\tREPLAY P99")
+
+	groups := make([]string, 0, len(r.Groups))
+	for g := range r.Groups {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	row := func(name string, s *Stats) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", name, s.Requests, s.Errors, s.Mismatches,
+			s.Original.Quantile(0.5), s.Original.Quantile(0.99), s.Replayed.Quantile(0.5), s.Replayed.Quantile(0.99))
+	}
+	for _, g := range groups {
+		row(g, r.Groups[g])
+	}
+	row("total", r.Total)
+	return tw.Flush()
+}
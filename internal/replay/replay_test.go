@@ -0,0 +1,150 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/mirror"
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// writeMirror mirrors one response per path, 50ms apart.
+func writeMirror(t *testing.T, paths ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	m, err := mirror.New(context.Background(), storage.NewDisk(dir))
+	if err != nil {
+		t.Fatalf("mirror.New() error = %v", err)
+	}
+	start := time.Now()
+	for i, p := range paths {
+		e := mirror.Entry{
+			Time:      start.Add(time.Duration(i) * 50 * time.Millisecond),
+			Method:    "GET",
+			Path:      p,
+			UserAgent: "test-player",
+			Status:    http.StatusOK,
+			Duration:  time.Millisecond,
+		}
+		if err := m.Save(context.Background(), e, []byte("#EXTM3U\n")); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeMirror(t, "/playlist.m3u8", "/variant/0/playlist.m3u8", "/variant/1/playlist.m3u8")
+
+	entries, err := Load(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 3 || entries[0].Path != "/playlist.m3u8" {
+		t.Errorf("Load() = %+v", entries)
+	}
+
+	entries, err = Load(context.Background(), filepath.Join(dir, mirror.IndexFile), regexp.MustCompile(`^/variant/1/`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/variant/1/playlist.m3u8" {
+		t.Errorf("Load() with filter = %+v", entries)
+	}
+
+	os.WriteFile(filepath.Join(dir, mirror.IndexFile), []byte("not json\n"), 0o644)
+	if _, err := Load(context.Background(), dir, nil); err == nil || !strings.Contains(err.Error(), ":1:") {
+		t.Errorf("Load() error = %v, want the failing line", err)
+	}
+	if _, err := Load(context.Background(), filepath.Join(dir, "missing"), nil); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Load() of a missing mirror error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	tests := map[string]string{
+		"/playlist.m3u8":             "/playlist.m3u8",
+		"/variant/0/playlist.m3u8":   "/variant/0/",
+		"/subtitles/12.vtt":          "/subtitles/",
+		"/smooth/QualityLevels(1)/x": "/smooth/QualityLevels(1)/",
+		"/":                          "/",
+	}
+	for p, want := range tests {
+		if got := Group(p); got != want {
+			t.Errorf("Group(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.URL.Path+" "+r.UserAgent())
+		mu.Unlock()
+		if r.URL.Path == "/variant/1/playlist.m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "#EXTM3U\n")
+	}))
+	defer target.Close()
+
+	dir := writeMirror(t, "/playlist.m3u8", "/variant/0/playlist.m3u8", "/variant/1/playlist.m3u8", "/variant/0/playlist.m3u8")
+	entries, err := Load(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	start := time.Now()
+	result, err := Run(context.Background(), Config{Target: target.URL + "/", Entries: entries, Speed: 2},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// The last request is sent 150ms after the first, at twice the speed
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("replay took %s, want the original timing at twice the speed", elapsed)
+	}
+
+	if len(received) != 4 || received[0] != "/playlist.m3u8 test-player" {
+		t.Errorf("target received %v", received)
+	}
+	if result.Total.Requests != 4 || result.Total.Mismatches != 1 || result.Total.Errors != 0 {
+		t.Errorf("total = %+v", result.Total)
+	}
+	if g := result.Groups["/variant/0/"]; g == nil || g.Requests != 2 || g.Mismatches != 0 {
+		t.Errorf("group /variant/0/ = %+v", g)
+	}
+	if g := result.Groups["/variant/1/"]; g == nil || g.Mismatches != 1 {
+		t.Errorf("group /variant/1/ = %+v", g)
+	}
+
+	var b strings.Builder
+	if err := result.WriteText(&b); err != nil {
+		t.Fatalf("WriteText() error = %v", err)
+	}
+	for _, want := range []string{"/variant/1/", "total"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteText() missing %q:\n%s", want, b.String())
+		}
+	}
+
+	if _, err := Run(context.Background(), Config{Target: target.URL}, nil); err == nil {
+		t.Error("Run() with no entries: expected an error")
+	}
+}
@@ -0,0 +1,471 @@
+// Package scenario runs scripted timelines of simulated failures and events,
+// such as stalls, ad breaks and failing variants, against a running
+// simulator. Scenarios are written in YAML:
+//
+//	name: stall-then-fail
+//	steps:
+//	  - action: advance
+//	    duration: 2m
+//	  - action: stall
+//	    duration: 30s
+//	  - action: fail-variant
+//	    variant: 1
+//	  - action: recover
+//	  - action: expect-discontinuity
+//	    duration: 10s
+//
+// Steps whose action starts with "expect-" are assertions: they wait up to
+// Duration for a condition and fail the scenario if it does not hold, so a
+// scenario run can serve as a self-contained test.
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/audit"
+	"github.com/agleyzer/encodersim/internal/events"
+	"github.com/agleyzer/encodersim/internal/sleep"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is the kind of a scenario step.
+type Action string
+
+// Scenario actions.
+const (
+	// ActionAdvance lets the window advance normally for Duration.
+	ActionAdvance Action = "advance"
+
+	// ActionStall stops the window from advancing for Duration, then
+	// resumes it.
+	ActionStall Action = "stall"
+
+	// ActionAdBreak marks an ad break of Duration starting at the live edge
+	// and continues immediately; the break plays out while later steps run.
+	ActionAdBreak Action = "ad-break"
+
+	// ActionFailVariant makes requests for Variant's media playlist fail
+	// with Status (503 if unset) until a recover step.
+	ActionFailVariant Action = "fail-variant"
+
+	// ActionMaintenance takes the origin down for Duration, answering the
+	// streams with 503 and Retry-After, then brings it back up.
+	ActionMaintenance Action = "maintenance"
+
+	// ActionRecover ends variant failures and any stall.
+	ActionRecover Action = "recover"
+
+	// ActionRotateKeys starts a new key period at the next segment to enter
+	// each variant's window, ahead of the key rotation schedule. It needs
+	// encrypted playlists.
+	ActionRotateKeys Action = "rotate-keys"
+
+	// ActionNetworkProfile makes the network profile named Profile active,
+	// or restores normal conditions if Profile is empty.
+	ActionNetworkProfile Action = "network-profile"
+
+	// ActionExpectDiscontinuity asserts that Variant's media playlist (the
+	// first variant if unset) contains EXT-X-DISCONTINUITY within Duration.
+	ActionExpectDiscontinuity Action = "expect-discontinuity"
+
+	// ActionExpectRequests asserts that at least Min media playlist requests
+	// for Variant (any variant if unset) arrive within Duration.
+	ActionExpectRequests Action = "expect-requests"
+
+	// ActionExpectIdenticalPlaylists asserts that the playlists at URLs,
+	// typically the same playlist on each cluster node, become
+	// byte-for-byte identical within Duration.
+	ActionExpectIdenticalPlaylists Action = "expect-identical-playlists"
+)
+
+// ErrAssertionFailed is wrapped by the error Run returns when an assertion
+// step fails.
+var ErrAssertionFailed = errors.New("assertion failed")
+
+// pollInterval is how often assertion steps check their condition.
+var pollInterval = 200 * time.Millisecond
+
+// Step is one entry of a scenario's timeline.
+type Step struct {
+	Action   Action        `yaml:"action"`
+	Duration time.Duration `yaml:"duration,omitempty"`
+	Variant  *int          `yaml:"variant,omitempty"`
+	Status   int           `yaml:"status,omitempty"`
+	Min      int           `yaml:"min,omitempty"`
+	URLs     []string      `yaml:"urls,omitempty"`
+	Profile  string        `yaml:"profile,omitempty"`
+}
+
+// Scenario is a named timeline of steps, executed in order.
+type Scenario struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Load reads and parses a scenario file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// Parse parses a YAML scenario. Unknown fields are rejected so that typos do
+// not silently change a scenario.
+func Parse(data []byte) (*Scenario, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var sc Scenario
+	if err := dec.Decode(&sc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("scenario is empty")
+		}
+		return nil, fmt.Errorf("parse scenario: %w", err)
+	}
+	if len(sc.Steps) == 0 {
+		return nil, fmt.Errorf("scenario has no steps")
+	}
+	for i, step := range sc.Steps {
+		if err := step.validate(); err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, step.Action, err)
+		}
+	}
+	return &sc, nil
+}
+
+// validate checks that the step has the fields its action needs.
+func (s Step) validate() error {
+	switch s.Action {
+	case ActionAdvance, ActionStall, ActionAdBreak, ActionMaintenance:
+		if s.Duration <= 0 {
+			return fmt.Errorf("duration must be positive")
+		}
+	case ActionFailVariant:
+		if s.Variant == nil || *s.Variant < 0 {
+			return fmt.Errorf("variant must be set to a variant index")
+		}
+		if s.Status != 0 && (s.Status < 400 || s.Status > 599) {
+			return fmt.Errorf("status must be a 4xx or 5xx code, got %d", s.Status)
+		}
+	case ActionRecover, ActionRotateKeys, ActionNetworkProfile:
+	case ActionExpectDiscontinuity, ActionExpectRequests, ActionExpectIdenticalPlaylists:
+		if s.Duration <= 0 {
+			return fmt.Errorf("duration must be positive")
+		}
+		if s.Variant != nil && *s.Variant < 0 {
+			return fmt.Errorf("variant must not be negative")
+		}
+		if s.Action == ActionExpectRequests && s.Min <= 0 {
+			return fmt.Errorf("min must be positive")
+		}
+		if s.Action == ActionExpectIdenticalPlaylists && len(s.URLs) < 2 {
+			return fmt.Errorf("urls must list at least two playlists")
+		}
+	case "":
+		return fmt.Errorf("action is required")
+	default:
+		return fmt.Errorf("unknown action (supported: %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)",
+			ActionAdvance, ActionStall, ActionAdBreak, ActionFailVariant, ActionMaintenance, ActionRecover, ActionRotateKeys, ActionNetworkProfile,
+			ActionExpectDiscontinuity, ActionExpectRequests, ActionExpectIdenticalPlaylists)
+	}
+	return nil
+}
+
+// Uses reports whether any step of the scenario performs action.
+func (sc *Scenario) Uses(action Action) bool {
+	for _, step := range sc.Steps {
+		if step.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the scenario against a simulator serving the given number
+// of variants.
+func (sc *Scenario) Validate(variants int) error {
+	for i, step := range sc.Steps {
+		if step.Variant != nil && *step.Variant >= variants {
+			return fmt.Errorf("step %d (%s): variant %d out of range (0-%d)", i+1, step.Action, *step.Variant, variants-1)
+		}
+	}
+	return nil
+}
+
+// Target is the simulator a scenario acts on.
+type Target interface {
+	PauseAdvance()
+	ResumeAdvance()
+	InsertAdBreak(d time.Duration) error
+	RotateKeys() error
+	FailVariant(index, status int)
+	ClearFailures()
+	StartMaintenance(until time.Time)
+	EndMaintenance()
+	SetNetworkProfile(name string) error
+
+	// GenerateVariant and VariantRequests are read by assertion steps.
+	GenerateVariant(index int) (string, error)
+	VariantRequests() map[int]uint64
+}
+
+// Event types published while a scenario runs.
+const (
+	EventStarted       = "scenario_started"
+	EventStepStarted   = "scenario_step_started"
+	EventStepCompleted = "scenario_step_completed"
+	EventCompleted     = "scenario_completed"
+	EventFailed        = "scenario_failed" // an assertion failed
+	EventAborted       = "scenario_aborted"
+)
+
+// Run executes the scenario's steps in order against target, publishing its
+// progress to log and recording the steps that change the simulator in
+// auditLog, which may be nil. It returns when the last step completes, a step fails or
+// ctx is cancelled; a stall in progress is ended in every case. A failed
+// assertion stops the scenario with an error wrapping ErrAssertionFailed.
+func Run(ctx context.Context, sc *Scenario, target Target, log *events.Log, auditLog *audit.Log, logger *slog.Logger) error {
+	defer target.ResumeAdvance()
+
+	log.Publish(EventStarted, "scenario "+sc.Name+" started", map[string]any{
+		"scenario": sc.Name,
+		"steps":    len(sc.Steps),
+	})
+	logger.Info("scenario started", "scenario", sc.Name, "steps", len(sc.Steps))
+
+	for i, step := range sc.Steps {
+		fields := map[string]any{"scenario": sc.Name, "step": i + 1, "action": step.Action}
+		if step.Duration > 0 {
+			fields["duration"] = step.Duration.String()
+		}
+		log.Publish(EventStepStarted, fmt.Sprintf("step %d: %s", i+1, step.Action), fields)
+		logger.Info("scenario step started", "step", i+1, "action", step.Action)
+		if step.changesTarget() {
+			if err := auditLog.Record(audit.Entry{
+				Actor:  sc.Name,
+				Source: audit.SourceScenario,
+				Action: string(step.Action),
+				Params: step.auditParams(i + 1),
+			}); err != nil {
+				logger.Warn("failed to audit scenario step", "step", i+1, "error", err)
+			}
+		}
+
+		if err := runStep(ctx, step, target); err != nil {
+			typ := EventAborted
+			if errors.Is(err, ErrAssertionFailed) {
+				typ = EventFailed
+			}
+			log.Publish(typ, fmt.Sprintf("step %d: %s: %v", i+1, step.Action, err), fields)
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Action, err)
+		}
+		log.Publish(EventStepCompleted, fmt.Sprintf("step %d: %s", i+1, step.Action), fields)
+	}
+
+	log.Publish(EventCompleted, "scenario "+sc.Name+" completed", map[string]any{"scenario": sc.Name})
+	logger.Info("scenario completed", "scenario", sc.Name)
+	return nil
+}
+
+// changesTarget reports whether the step acts on the simulator, as opposed
+// to waiting or asserting.
+func (s Step) changesTarget() bool {
+	return s.Action != ActionAdvance && !strings.HasPrefix(string(s.Action), "expect-")
+}
+
+// auditParams returns the parameters of the step, the index-th of its
+// scenario, to audit.
+func (s Step) auditParams(index int) map[string]any {
+	params := map[string]any{"step": index}
+	if s.Duration > 0 {
+		params["duration"] = s.Duration.String()
+	}
+	if s.Variant != nil {
+		params["variant"] = *s.Variant
+	}
+	if s.Status != 0 {
+		params["status"] = s.Status
+	}
+	if s.Action == ActionNetworkProfile {
+		params["profile"] = s.Profile
+	}
+	return params
+}
+
+// runStep performs one step.
+func runStep(ctx context.Context, step Step, target Target) error {
+	switch step.Action {
+	case ActionAdvance:
+		return sleep.Sleep(ctx, step.Duration)
+	case ActionStall:
+		target.PauseAdvance()
+		err := sleep.Sleep(ctx, step.Duration)
+		target.ResumeAdvance()
+		return err
+	case ActionAdBreak:
+		return target.InsertAdBreak(step.Duration)
+	case ActionFailVariant:
+		status := step.Status
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		target.FailVariant(*step.Variant, status)
+	case ActionMaintenance:
+		target.StartMaintenance(time.Now().Add(step.Duration))
+		err := sleep.Sleep(ctx, step.Duration)
+		target.EndMaintenance()
+		return err
+	case ActionRecover:
+		target.ClearFailures()
+		target.ResumeAdvance()
+	case ActionRotateKeys:
+		return target.RotateKeys()
+	case ActionNetworkProfile:
+		return target.SetNetworkProfile(step.Profile)
+	case ActionExpectDiscontinuity:
+		return expectDiscontinuity(ctx, step, target)
+	case ActionExpectRequests:
+		return expectRequests(ctx, step, target)
+	case ActionExpectIdenticalPlaylists:
+		return expectIdenticalPlaylists(ctx, step)
+	}
+	return nil
+}
+
+// expectDiscontinuity waits for the step's variant to contain a
+// discontinuity tag.
+func expectDiscontinuity(ctx context.Context, step Step, target Target) error {
+	index := 0
+	if step.Variant != nil {
+		index = *step.Variant
+	}
+
+	var lastErr error
+	ok, err := poll(ctx, step.Duration, func() bool {
+		out, err := target.GenerateVariant(index)
+		lastErr = err
+		return err == nil && strings.Contains(out, "#EXT-X-DISCONTINUITY\n")
+	})
+	if err != nil || ok {
+		return err
+	}
+	if lastErr != nil {
+		return fmt.Errorf("%w: variant %d: %v", ErrAssertionFailed, index, lastErr)
+	}
+	return fmt.Errorf("%w: no discontinuity in variant %d within %s", ErrAssertionFailed, index, step.Duration)
+}
+
+// expectRequests waits for the step's minimum number of media playlist
+// requests, counted from the start of the step.
+func expectRequests(ctx context.Context, step Step, target Target) error {
+	count := func() uint64 {
+		counts := target.VariantRequests()
+		if step.Variant != nil {
+			return counts[*step.Variant]
+		}
+		var total uint64
+		for _, n := range counts {
+			total += n
+		}
+		return total
+	}
+
+	start := count()
+	var got uint64
+	ok, err := poll(ctx, step.Duration, func() bool {
+		got = count() - start
+		return got >= uint64(step.Min)
+	})
+	if err != nil || ok {
+		return err
+	}
+	return fmt.Errorf("%w: %d playlist requests within %s, want at least %d", ErrAssertionFailed, got, step.Duration, step.Min)
+}
+
+// expectIdenticalPlaylists waits for one round of fetches in which every URL
+// returns the same playlist. Rounds are retried because a node can render
+// its window just before or after an advance.
+func expectIdenticalPlaylists(ctx context.Context, step Step) error {
+	var mismatch string
+	ok, err := poll(ctx, step.Duration, func() bool {
+		var first [sha256.Size]byte
+		for i, url := range step.URLs {
+			body, err := fetch(ctx, url)
+			if err != nil {
+				mismatch = err.Error()
+				return false
+			}
+			sum := sha256.Sum256(body)
+			if i == 0 {
+				first = sum
+			} else if sum != first {
+				mismatch = fmt.Sprintf("%s differs from %s", url, step.URLs[0])
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil || ok {
+		return err
+	}
+	return fmt.Errorf("%w: playlists not identical within %s: %s", ErrAssertionFailed, step.Duration, mismatch)
+}
+
+// httpClient fetches playlists for expect-identical-playlists.
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+// fetch returns the body of a successful GET of url.
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// poll calls check every pollInterval, starting immediately, until it
+// returns true or d elapses. It reports whether check passed, or returns
+// ctx's error if ctx is cancelled first.
+func poll(ctx context.Context, d time.Duration, check func() bool) (bool, error) {
+	deadline := time.Now().Add(d)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if check() {
+			return true, nil
+		}
+		if !time.Now().Before(deadline) {
+			return false, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/audit"
+	"github.com/agleyzer/encodersim/internal/events"
+)
+
+func TestParse(t *testing.T) {
+	sc, err := Parse([]byte(`
+name: demo
+steps:
+  - action: advance
+    duration: 2m
+  - action: stall
+    duration: 30s
+  - action: ad-break
+    duration: 30s
+  - action: fail-variant
+    variant: 2
+    status: 500
+  - action: recover
+  - action: rotate-keys
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if sc.Name != "demo" || len(sc.Steps) != 6 || !sc.Uses(ActionRotateKeys) || sc.Uses(ActionMaintenance) {
+		t.Fatalf("Parse() = %+v", sc)
+	}
+	if sc.Steps[0].Duration != 2*time.Minute {
+		t.Errorf("advance duration = %v, want 2m", sc.Steps[0].Duration)
+	}
+	if *sc.Steps[3].Variant != 2 || sc.Steps[3].Status != 500 {
+		t.Errorf("fail-variant step = %+v", sc.Steps[3])
+	}
+	if err := sc.Validate(3); err != nil {
+		t.Errorf("Validate(3) error = %v", err)
+	}
+	if err := sc.Validate(2); err == nil {
+		t.Error("Validate(2): expected variant out of range error")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "", "empty"},
+		{"no steps", "name: x\n", "no steps"},
+		{"unknown field", "steps:\n  - action: advance\n    duraton: 1s\n", "duraton"},
+		{"unknown action", "steps:\n  - action: explode\n", "unknown action"},
+		{"missing action", "steps:\n  - duration: 1s\n", "action is required"},
+		{"missing duration", "steps:\n  - action: stall\n", "duration must be positive"},
+		{"missing variant", "steps:\n  - action: fail-variant\n", "variant must be set"},
+		{"bad status", "steps:\n  - action: fail-variant\n    variant: 0\n    status: 200\n", "4xx or 5xx"},
+		{"bad duration", "steps:\n  - action: advance\n    duration: soon\n", "parse scenario"},
+		{"missing min", "steps:\n  - action: expect-requests\n    duration: 1s\n", "min must be positive"},
+		{"one url", "steps:\n  - action: expect-identical-playlists\n    duration: 1s\n    urls: [http://a]\n", "at least two"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeTarget records the actions applied to it.
+type fakeTarget struct {
+	calls    []string
+	playlist string
+	requests map[int]uint64
+}
+
+func (f *fakeTarget) PauseAdvance()  { f.calls = append(f.calls, "pause") }
+func (f *fakeTarget) ResumeAdvance() { f.calls = append(f.calls, "resume") }
+func (f *fakeTarget) ClearFailures() { f.calls = append(f.calls, "clear") }
+
+func (f *fakeTarget) InsertAdBreak(d time.Duration) error {
+	f.calls = append(f.calls, "ad "+d.String())
+	return nil
+}
+
+func (f *fakeTarget) RotateKeys() error {
+	f.calls = append(f.calls, "rotate")
+	return nil
+}
+
+func (f *fakeTarget) FailVariant(index, status int) {
+	f.calls = append(f.calls, fmt.Sprintf("fail %d %d", index, status))
+}
+
+func (f *fakeTarget) StartMaintenance(until time.Time) {
+	f.calls = append(f.calls, "maintenance")
+}
+
+func (f *fakeTarget) EndMaintenance() { f.calls = append(f.calls, "up") }
+
+func (f *fakeTarget) SetNetworkProfile(name string) error {
+	f.calls = append(f.calls, "profile "+name)
+	return nil
+}
+
+func (f *fakeTarget) GenerateVariant(index int) (string, error) {
+	return f.playlist, nil
+}
+
+// VariantRequests reports one more request for variant 0 on every call, like
+// a player polling its playlist.
+func (f *fakeTarget) VariantRequests() map[int]uint64 {
+	if f.requests == nil {
+		f.requests = make(map[int]uint64)
+	}
+	f.requests[0]++
+	counts := make(map[int]uint64)
+	for index, n := range f.requests {
+		counts[index] = n
+	}
+	return counts
+}
+
+func TestRun(t *testing.T) {
+	variant := 1
+	sc := &Scenario{Name: "demo", Steps: []Step{
+		{Action: ActionAdvance, Duration: 10 * time.Millisecond},
+		{Action: ActionStall, Duration: 10 * time.Millisecond},
+		{Action: ActionAdBreak, Duration: 30 * time.Second},
+		{Action: ActionFailVariant, Variant: &variant},
+		{Action: ActionNetworkProfile, Profile: "3g"},
+		{Action: ActionMaintenance, Duration: 10 * time.Millisecond},
+		{Action: ActionRecover},
+		{Action: ActionRotateKeys},
+		{Action: ActionNetworkProfile},
+	}}
+	target := &fakeTarget{}
+	log := events.NewLog(0)
+	auditEvents := events.NewLog(0)
+	auditLog, err := audit.New("", auditEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(context.Background(), sc, target, log, auditLog, slog.New(slog.NewTextHandler(io.Discard, nil))); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := "pause resume ad 30s fail 1 503 profile 3g maintenance up clear resume rotate profile  resume"
+	if got := strings.Join(target.calls, " "); got != want {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+
+	list, _ := log.Since(0)
+	if len(list) != 2+2*len(sc.Steps) {
+		t.Fatalf("published %d events, want %d", len(list), 2+2*len(sc.Steps))
+	}
+	if list[0].Type != EventStarted || list[len(list)-1].Type != EventCompleted {
+		t.Errorf("events run from %s to %s", list[0].Type, list[len(list)-1].Type)
+	}
+
+	// Every step but the advance changes the simulator
+	audited, _ := auditEvents.Since(0)
+	var actions []string
+	for _, e := range audited {
+		actions = append(actions, e.Fields["action"].(string))
+	}
+	wantActions := "stall ad-break fail-variant network-profile maintenance recover rotate-keys network-profile"
+	if got := strings.Join(actions, " "); got != wantActions {
+		t.Errorf("audited actions = %q, want %q", got, wantActions)
+	}
+	if params := audited[2].Fields["params"].(map[string]any); audited[2].Fields["actor"] != "demo" || params["variant"] != 1 || params["step"] != 4 {
+		t.Errorf("fail-variant audit event = %+v", audited[2].Fields)
+	}
+}
+
+func TestRun_Cancelled(t *testing.T) {
+	sc := &Scenario{Name: "demo", Steps: []Step{{Action: ActionStall, Duration: time.Hour}}}
+	target := &fakeTarget{}
+	log := events.NewLog(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Run(ctx, sc, target, log, nil, slog.New(slog.NewTextHandler(io.Discard, nil))); err == nil {
+		t.Fatal("Run() expected an error after cancellation")
+	}
+
+	if last := target.calls[len(target.calls)-1]; last != "resume" {
+		t.Errorf("last call = %q, want resume", last)
+	}
+	list, _ := log.Since(0)
+	if list[len(list)-1].Type != EventAborted {
+		t.Errorf("last event = %s, want %s", list[len(list)-1].Type, EventAborted)
+	}
+}
+
+func TestRun_Assertions(t *testing.T) {
+	pollInterval = time.Millisecond
+	defer func() { pollInterval = 200 * time.Millisecond }()
+
+	playlist := "#EXTM3U\n#EXTINF:6,\nseg.ts\n"
+	serve := func(body string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	same1, same2, other := serve(playlist), serve(playlist), serve(playlist+"seg2.ts\n")
+	variant := 1
+
+	tests := []struct {
+		name     string
+		step     Step
+		playlist string
+		wantErr  bool
+	}{
+		{"discontinuity present", Step{Action: ActionExpectDiscontinuity, Duration: 10 * time.Millisecond}, "#EXT-X-DISCONTINUITY\n", false},
+		{"discontinuity missing", Step{Action: ActionExpectDiscontinuity, Duration: 10 * time.Millisecond}, playlist, true},
+		{"enough requests", Step{Action: ActionExpectRequests, Duration: time.Second, Min: 3}, "", false},
+		{"requests for another variant", Step{Action: ActionExpectRequests, Duration: 10 * time.Millisecond, Min: 1, Variant: &variant}, "", true},
+		{"identical playlists", Step{Action: ActionExpectIdenticalPlaylists, Duration: 10 * time.Millisecond, URLs: []string{same1, same2}}, "", false},
+		{"different playlists", Step{Action: ActionExpectIdenticalPlaylists, Duration: 10 * time.Millisecond, URLs: []string{same1, other}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &Scenario{Name: "demo", Steps: []Step{tt.step}}
+			log := events.NewLog(0)
+			err := Run(context.Background(), sc, &fakeTarget{playlist: tt.playlist}, log, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			if !errors.Is(err, ErrAssertionFailed) {
+				t.Errorf("Run() error = %v, want it to wrap ErrAssertionFailed", err)
+			}
+			list, _ := log.Since(0)
+			if last := list[len(list)-1].Type; last != EventFailed {
+				t.Errorf("last event = %s, want %s", last, EventFailed)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 // Package segment defines data structures for HLS video segments.
 package segment
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // Segment represents a single HLS video segment.
 type Segment struct {
 	// URL is the original segment URL (kept as-is from the source playlist)
@@ -12,8 +18,56 @@ type Segment struct {
 	// Sequence is the position in the original playlist
 	Sequence int
 
+	// SourceSequence is the segment's media sequence number in the source
+	// playlist (EXT-X-MEDIA-SEQUENCE plus its position)
+	SourceSequence uint64
+
 	// VariantIndex indicates which variant this segment belongs to
 	// Only used when serving master playlists with multiple variants
 	// Set to 0 for single media playlists (non-master mode)
 	VariantIndex int
+
+	// ByteRange is the EXT-X-BYTERANGE ("length@offset") of the segment
+	// within the resource at URL, or empty for the whole resource. The
+	// offset is always explicit so the segment can be served out of order.
+	ByteRange string
+
+	// InitURL is the media initialization section (EXT-X-MAP URI) that
+	// applies to this segment, or empty if there is none
+	InitURL string
+
+	// InitByteRange is the EXT-X-MAP BYTERANGE ("length@offset") of the
+	// initialization section, or empty for the whole resource
+	InitByteRange string
+
+	// Size is the segment size in bytes as reported by the origin
+	// (0 if unknown; populated by the probe package)
+	Size int64
+
+	// ContentType is the segment MIME type as reported by the origin
+	// (empty if unknown; populated by the probe package)
+	ContentType string
+
+	// Tags holds custom source tag lines passed through verbatim before this
+	// segment, each terminated by a newline. Empty if there are none.
+	// Stored as a single string so that Segment remains comparable.
+	Tags string
+}
+
+// ParseByteRange parses a "length@offset" byte range as stored in
+// Segment.ByteRange and Segment.InitByteRange.
+func ParseByteRange(s string) (length, offset int64, err error) {
+	l, o, ok := strings.Cut(s, "@")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid byte range %q: expected length@offset", s)
+	}
+	length, err = strconv.ParseInt(l, 10, 64)
+	if err != nil || length <= 0 {
+		return 0, 0, fmt.Errorf("invalid byte range %q: bad length", s)
+	}
+	offset, err = strconv.ParseInt(o, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("invalid byte range %q: bad offset", s)
+	}
+	return length, offset, nil
 }
@@ -0,0 +1,147 @@
+package segment
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// Store deduplicates segment lists so that identical lists (for example the
+// same source replicated into several channels) share a single backing array,
+// and identical URL strings share a single allocation.
+//
+// Lists returned by Intern are shared and must be treated as read-only.
+// Their capacity equals their length, so append always copies; callers that
+// need to modify elements in place must Clone the list first.
+type Store struct {
+	mu    sync.Mutex
+	lists map[uint64][][]Segment
+	urls  map[string]string
+	refs  int
+}
+
+// StoreStats describes how much sharing a Store achieved.
+type StoreStats struct {
+	// UniqueLists is the number of distinct segment lists held.
+	UniqueLists int `json:"unique_lists"`
+	// References is the number of Intern calls served.
+	References int `json:"references"`
+	// UniqueSegments is the total number of segments held across distinct lists.
+	UniqueSegments int `json:"unique_segments"`
+	// UniqueURLs is the number of distinct segment URLs held.
+	UniqueURLs int `json:"unique_urls"`
+}
+
+// NewStore creates an empty Store.
+func NewStore() *Store {
+	return &Store{
+		lists: make(map[uint64][][]Segment),
+		urls:  make(map[string]string),
+	}
+}
+
+// Intern returns a shared list equal to segments. The first list with given
+// contents is copied into the store; later identical lists return that copy.
+func (s *Store) Intern(segments []Segment) []Segment {
+	if len(segments) == 0 {
+		return segments
+	}
+
+	key := hashList(segments)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs++
+	for _, existing := range s.lists[key] {
+		if equalLists(existing, segments) {
+			return existing
+		}
+	}
+
+	shared := make([]Segment, len(segments))
+	for i, seg := range segments {
+		seg.URL = s.internURL(seg.URL)
+		shared[i] = seg
+	}
+	shared = shared[:len(shared):len(shared)]
+	s.lists[key] = append(s.lists[key], shared)
+
+	return shared
+}
+
+// Stats returns the current sharing statistics.
+func (s *Store) Stats() StoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := StoreStats{
+		References: s.refs,
+		UniqueURLs: len(s.urls),
+	}
+	for _, bucket := range s.lists {
+		stats.UniqueLists += len(bucket)
+		for _, list := range bucket {
+			stats.UniqueSegments += len(list)
+		}
+	}
+	return stats
+}
+
+// internURL returns the canonical copy of url. Caller must hold s.mu.
+func (s *Store) internURL(url string) string {
+	if canonical, ok := s.urls[url]; ok {
+		return canonical
+	}
+	s.urls[url] = url
+	return url
+}
+
+// Clone returns a private copy of segments that may be modified freely.
+func Clone(segments []Segment) []Segment {
+	if segments == nil {
+		return nil
+	}
+	out := make([]Segment, len(segments))
+	copy(out, segments)
+	return out
+}
+
+// hashList computes a content hash of a segment list.
+func hashList(segments []Segment) uint64 {
+	h := fnv.New64a()
+	var buf []byte
+	for _, seg := range segments {
+		buf = buf[:0]
+		buf = append(buf, seg.URL...)
+		buf = append(buf, 0)
+		buf = strconv.AppendUint(buf, math.Float64bits(seg.Duration), 16)
+		buf = append(buf, 0)
+		buf = strconv.AppendInt(buf, int64(seg.Sequence), 10)
+		buf = append(buf, 0)
+		buf = strconv.AppendInt(buf, int64(seg.VariantIndex), 10)
+		buf = append(buf, 0)
+		buf = append(buf, seg.ByteRange...)
+		buf = append(buf, 0)
+		buf = append(buf, seg.Tags...)
+		buf = append(buf, 0)
+		buf = append(buf, seg.InitURL...)
+		buf = append(buf, '\n')
+		h.Write(buf)
+	}
+	return h.Sum64()
+}
+
+// equalLists reports whether two segment lists have identical contents.
+func equalLists(a, b []Segment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package segment
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func testSegments(prefix string, count int) []Segment {
+	segments := make([]Segment, count)
+	for i := range segments {
+		segments[i] = Segment{
+			URL:      prefix + string(rune('a'+i)) + ".ts",
+			Duration: 6.0,
+			Sequence: i,
+		}
+	}
+	return segments
+}
+
+func TestStore_InternSharesIdenticalLists(t *testing.T) {
+	store := NewStore()
+
+	a := store.Intern(testSegments("https://cdn/x/", 5))
+	b := store.Intern(testSegments("https://cdn/x/", 5))
+
+	if &a[0] != &b[0] {
+		t.Error("Expected identical lists to share a backing array")
+	}
+
+	stats := store.Stats()
+	if stats.UniqueLists != 1 {
+		t.Errorf("Expected 1 unique list, got %d", stats.UniqueLists)
+	}
+	if stats.References != 2 {
+		t.Errorf("Expected 2 references, got %d", stats.References)
+	}
+	if stats.UniqueSegments != 5 {
+		t.Errorf("Expected 5 unique segments, got %d", stats.UniqueSegments)
+	}
+}
+
+func TestStore_InternKeepsDistinctLists(t *testing.T) {
+	store := NewStore()
+
+	a := store.Intern(testSegments("https://cdn/x/", 3))
+	different := testSegments("https://cdn/x/", 3)
+	different[2].Duration = 5.5
+	b := store.Intern(different)
+
+	if &a[0] == &b[0] {
+		t.Error("Expected lists with different contents not to be shared")
+	}
+	if b[2].Duration != 5.5 {
+		t.Errorf("Expected interned list to keep its contents, got duration %v", b[2].Duration)
+	}
+
+	stats := store.Stats()
+	if stats.UniqueLists != 2 {
+		t.Errorf("Expected 2 unique lists, got %d", stats.UniqueLists)
+	}
+	// URLs are identical across both lists and should be stored once
+	if stats.UniqueURLs != 3 {
+		t.Errorf("Expected 3 unique URLs, got %d", stats.UniqueURLs)
+	}
+	if unsafe.StringData(a[0].URL) != unsafe.StringData(b[0].URL) {
+		t.Error("Expected identical URLs to share storage")
+	}
+}
+
+func TestStore_InternDoesNotAliasInput(t *testing.T) {
+	store := NewStore()
+
+	input := testSegments("https://cdn/x/", 3)
+	shared := store.Intern(input)
+	input[0].URL = "mutated"
+
+	if shared[0].URL == "mutated" {
+		t.Error("Expected interned list to be independent of the caller's slice")
+	}
+}
+
+func TestStore_AppendCopies(t *testing.T) {
+	store := NewStore()
+
+	a := store.Intern(testSegments("https://cdn/x/", 3))
+	b := store.Intern(testSegments("https://cdn/x/", 3))
+
+	grown := append(a, Segment{URL: "extra.ts"})
+	if &grown[0] == &a[0] {
+		t.Error("Expected append to a shared list to copy")
+	}
+	if len(b) != 3 {
+		t.Errorf("Expected other references to be unaffected, got length %d", len(b))
+	}
+}
+
+func TestStore_InternEmpty(t *testing.T) {
+	store := NewStore()
+
+	if got := store.Intern(nil); got != nil {
+		t.Errorf("Expected nil for nil input, got %v", got)
+	}
+	if stats := store.Stats(); stats.References != 0 {
+		t.Errorf("Expected empty lists not to be counted, got %d references", stats.References)
+	}
+}
+
+func TestClone(t *testing.T) {
+	original := testSegments("https://cdn/x/", 2)
+	clone := Clone(original)
+	clone[0].URL = "changed"
+
+	if original[0].URL == "changed" {
+		t.Error("Expected Clone to return an independent copy")
+	}
+	if Clone(nil) != nil {
+		t.Error("Expected Clone(nil) to return nil")
+	}
+}
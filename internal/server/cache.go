@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCacheControl is the Cache-Control header of every live document
+// unless CacheControl overrides it.
+const DefaultCacheControl = "no-cache, no-store, must-revalidate"
+
+// CacheControl sets the Cache-Control header by kind of document, to match
+// the caching strategy of a real origin. Empty values keep
+// DefaultCacheControl.
+//
+// Values may contain {target} and {half-target}, replaced with the target
+// duration and half of it in whole seconds (at least 1), such as
+// "max-age={half-target}".
+type CacheControl struct {
+	// Master applies to the master playlists at /playlist.m3u8,
+	// /vod/playlist.m3u8 and /startover/playlist.m3u8.
+	Master string
+
+	// Media applies to the media playlists and the other live manifests:
+	// the variant, rendition, VOD, start-over and subtitle playlists,
+	// /manifest.mpd and the Smooth Streaming manifest.
+	Media string
+
+	// Segment applies to the segments the server answers for: the debug
+	// subtitle cues, the keys and the Smooth Streaming fragment redirects. Media
+	// segments are served by the source origin and keep its headers.
+	Segment string
+}
+
+// cacheControlPlaceholders are the placeholders CacheControl values may use.
+var cacheControlPlaceholders = []string{"{target}", "{half-target}"}
+
+// ParseCacheControl validates a Cache-Control value for CacheControl.
+func ParseCacheControl(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("cache control %q must be a single line", value)
+	}
+	rest := value
+	for _, p := range cacheControlPlaceholders {
+		rest = strings.ReplaceAll(rest, p, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return "", fmt.Errorf("cache control %q: unknown placeholder (expected {target} or {half-target})", value)
+	}
+	return value, nil
+}
+
+// expandCacheControl returns value with its placeholders replaced for the
+// target duration, or DefaultCacheControl if value is empty.
+func expandCacheControl(value string, target time.Duration) string {
+	if value == "" {
+		return DefaultCacheControl
+	}
+	seconds := max(int(target/time.Second), 1)
+	return strings.NewReplacer(
+		"{target}", strconv.Itoa(seconds),
+		"{half-target}", strconv.Itoa(max(seconds/2, 1)),
+	).Replace(value)
+}
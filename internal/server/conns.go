@@ -0,0 +1,284 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connErrorKinds are the kinds of errors that the HTTP server logs while
+// accepting and serving connections: failed accepts, failed TLS handshakes,
+// and anything else, such as handler panics.
+var connErrorKinds = []string{"accept", "tls_handshake", "other"}
+
+// connStates are the states of open connections, as reported by
+// http.Server.ConnState.
+var connStates = []string{"new", "active", "idle"}
+
+// connRateWindow is how many seconds the accept and error rates of
+// /connections are averaged over.
+const connRateWindow = 60
+
+// maxConnClients caps the clients listed by /connections.
+const maxConnClients = 100
+
+// connStats tracks the connections of the HTTP servers through their
+// ConnState hooks and error logs. It tells players that stopped requesting
+// (no new connections) apart from a server that stopped accepting them
+// (accept errors, or connections piling up).
+type connStats struct {
+	maxConns int // Limits.MaxConns
+
+	mu       sync.Mutex
+	open     map[net.Conn]openConn
+	clients  map[string]int // client IP to open connections
+	accepted uint64
+	closed   uint64
+	errors   map[string]uint64 // connErrorKinds to count
+	rates    [connRateWindow]connRate
+}
+
+// openConn is an open connection and its current state.
+type openConn struct {
+	ip      string
+	state   http.ConnState
+	overCap bool // accepted while maxConns were open
+}
+
+// connRate counts the connections accepted and the errors logged in one
+// second.
+type connRate struct {
+	second   int64
+	accepted uint64
+	errors   uint64
+}
+
+// newConnStats returns an empty connStats that flags the connections
+// accepted while maxConns are open (0 for no cap).
+func newConnStats(maxConns int) *connStats {
+	return &connStats{
+		maxConns: maxConns,
+		open:     make(map[net.Conn]openConn),
+		clients:  make(map[string]int),
+		errors:   make(map[string]uint64),
+	}
+}
+
+// track is the ConnState hook of the HTTP servers. Hijacked connections are
+// counted as closed, since the server no longer manages them.
+func (c *connStats) track(conn net.Conn, state http.ConnState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch state {
+	case http.StateNew:
+		ip := remoteIP(conn.RemoteAddr())
+		overCap := c.maxConns > 0 && len(c.open) >= c.maxConns
+		c.open[conn] = openConn{ip: ip, state: state, overCap: overCap}
+		c.clients[ip]++
+		c.accepted++
+		c.rate(time.Now()).accepted++
+	case http.StateActive, http.StateIdle:
+		if oc, ok := c.open[conn]; ok {
+			oc.state = state
+			c.open[conn] = oc
+		}
+	case http.StateClosed, http.StateHijacked:
+		oc, ok := c.open[conn]
+		if !ok {
+			return
+		}
+		delete(c.open, conn)
+		if c.clients[oc.ip]--; c.clients[oc.ip] <= 0 {
+			delete(c.clients, oc.ip)
+		}
+		c.closed++
+	}
+}
+
+// connKey is the context key of the connection a request arrived on.
+type connKey struct{}
+
+// connContext is the ConnContext hook of the HTTP server, which lets
+// overCap find the connection of a request.
+func (c *connStats) connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// overCap reports whether r arrived on a connection accepted while maxConns
+// were open. Requests served without connContext, such as through
+// Server.Handler, never are.
+func (c *connStats) overCap(r *http.Request) bool {
+	if c.maxConns == 0 {
+		return false
+	}
+	conn, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.open[conn].overCap
+}
+
+// recordError counts an error of kind, one of connErrorKinds.
+func (c *connStats) recordError(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[kind]++
+	c.rate(time.Now()).errors++
+}
+
+// rate returns the bucket of the second of now, reset if it last counted
+// an older second. Caller must hold the lock.
+func (c *connStats) rate(now time.Time) *connRate {
+	second := now.Unix()
+	r := &c.rates[second%connRateWindow]
+	if r.second != second {
+		*r = connRate{second: second}
+	}
+	return r
+}
+
+// clientConns is the number of open connections of one client IP.
+type clientConns struct {
+	IP   string `json:"ip"`
+	Open int    `json:"open"`
+}
+
+// connSnapshot is the body of /connections.
+type connSnapshot struct {
+	Open              int               `json:"open"`
+	States            map[string]int    `json:"states"`
+	Accepted          uint64            `json:"accepted"`
+	Closed            uint64            `json:"closed"`
+	Errors            map[string]uint64 `json:"errors"`
+	AcceptedPerSecond float64           `json:"accepted_per_second"`
+	ErrorsPerSecond   float64           `json:"errors_per_second"`
+	ClientCount       int               `json:"client_count"`
+	Clients           []clientConns     `json:"clients"`
+	Throttled         map[string]uint64 `json:"throttled"`
+}
+
+// snapshot returns the current statistics, with the clients that hold the
+// most connections first, up to maxClients of them.
+func (c *connStats) snapshot(maxClients int) connSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snap := connSnapshot{
+		Open:        len(c.open),
+		States:      make(map[string]int, len(connStates)),
+		Accepted:    c.accepted,
+		Closed:      c.closed,
+		Errors:      make(map[string]uint64, len(connErrorKinds)),
+		ClientCount: len(c.clients),
+		Clients:     make([]clientConns, 0, len(c.clients)),
+	}
+	for _, state := range connStates {
+		snap.States[state] = 0
+	}
+	for _, oc := range c.open {
+		snap.States[oc.state.String()]++
+	}
+	for _, kind := range connErrorKinds {
+		snap.Errors[kind] = c.errors[kind]
+	}
+
+	now := time.Now().Unix()
+	for _, r := range c.rates {
+		if now-r.second < connRateWindow {
+			snap.AcceptedPerSecond += float64(r.accepted)
+			snap.ErrorsPerSecond += float64(r.errors)
+		}
+	}
+	snap.AcceptedPerSecond /= connRateWindow
+	snap.ErrorsPerSecond /= connRateWindow
+
+	for ip, n := range c.clients {
+		snap.Clients = append(snap.Clients, clientConns{IP: ip, Open: n})
+	}
+	slices.SortFunc(snap.Clients, func(a, b clientConns) int {
+		if n := cmp.Compare(b.Open, a.Open); n != 0 {
+			return n
+		}
+		return strings.Compare(a.IP, b.IP)
+	})
+	if len(snap.Clients) > maxClients {
+		snap.Clients = snap.Clients[:maxClients]
+	}
+	return snap
+}
+
+// summary returns the totals reported in the /health stats.
+func (c *connStats) summary() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errors uint64
+	for _, n := range c.errors {
+		errors += n
+	}
+	return map[string]any{
+		"open":     len(c.open),
+		"clients":  len(c.clients),
+		"accepted": c.accepted,
+		"errors":   errors,
+	}
+}
+
+// remoteIP returns the IP of addr without the port.
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// errorLog returns the ErrorLog of the HTTP servers, which counts their
+// errors and logs them with logger instead of printing them to stderr.
+func (c *connStats) errorLog(logger *slog.Logger) *log.Logger {
+	return log.New(&connErrorWriter{conns: c, logger: logger}, "", 0)
+}
+
+// connErrorWriter classifies the messages of an http.Server ErrorLog.
+type connErrorWriter struct {
+	conns  *connStats
+	logger *slog.Logger
+}
+
+func (w *connErrorWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	kind := "other"
+	switch {
+	case strings.HasPrefix(msg, "http: Accept error"):
+		kind = "accept"
+	case strings.HasPrefix(msg, "http: TLS handshake error"):
+		kind = "tls_handshake"
+	}
+	w.conns.recordError(kind)
+	w.logger.Warn("HTTP connection error", "kind", kind, "error", msg)
+	return len(p), nil
+}
+
+// handleConnections serves the open connections of the server, per state
+// and per client IP, how many were accepted and failed, and how many
+// requests the server's limits refused.
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	snap := s.conns.snapshot(maxConnClients)
+	snap.Throttled = s.throttle.counts()
+	json.NewEncoder(w).Encode(snap)
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnStats(t *testing.T) {
+	srv := NewWithOptions(createTestPlaylist(t), Options{}, createTestLogger())
+	ts := httptest.NewUnstartedServer(srv.routes())
+	ts.Config.ConnState = srv.conns.track
+	ts.Config.ErrorLog = srv.conns.errorLog(srv.logger)
+	ts.StartTLS()
+	defer ts.Close()
+
+	// Two keep-alive connections from the same client
+	for range 2 {
+		client := &http.Client{Transport: ts.Client().Transport.(*http.Transport).Clone()}
+		resp, err := client.Get(ts.URL + "/health")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	// A scanner that does not speak TLS
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	io.WriteString(conn, "SSH-2.0-scanner\r\n")
+	io.Copy(io.Discard, conn)
+	conn.Close()
+
+	var snap connSnapshot
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		snap = srv.conns.snapshot(maxConnClients)
+		if snap.Errors["tls_handshake"] == 1 && snap.States["idle"] == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if snap.Open != 2 || snap.States["idle"] != 2 {
+		t.Errorf("open = %d %v, want 2 idle", snap.Open, snap.States)
+	}
+	if snap.Accepted != 3 || snap.Closed != 1 {
+		t.Errorf("accepted %d, closed %d, want 3 and 1", snap.Accepted, snap.Closed)
+	}
+	if snap.Errors["tls_handshake"] != 1 || snap.Errors["accept"] != 0 {
+		t.Errorf("errors = %v, want one TLS handshake error", snap.Errors)
+	}
+	if snap.AcceptedPerSecond != 3.0/connRateWindow || snap.ErrorsPerSecond != 1.0/connRateWindow {
+		t.Errorf("rates = %v accepted/s, %v errors/s", snap.AcceptedPerSecond, snap.ErrorsPerSecond)
+	}
+	if snap.ClientCount != 1 || len(snap.Clients) != 1 || snap.Clients[0].Open != 2 {
+		t.Errorf("clients = %d %+v, want one client with 2 connections", snap.ClientCount, snap.Clients)
+	}
+
+	// The endpoint and the metrics report the same
+	w := httptest.NewRecorder()
+	srv.handleConnections(w, httptest.NewRequest("GET", "/connections", nil))
+	var body map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body["open"] != 2.0 || body["client_count"] != 1.0 {
+		t.Errorf("GET /connections = %v, %v", body, err)
+	}
+	w = httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`encodersim_connections_open{state="idle"} 2`,
+		"encodersim_connections_accepted_total 3\n",
+		"encodersim_connection_clients 1\n",
+		`encodersim_connection_errors_total{kind="tls_handshake"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, w.Body.String())
+		}
+	}
+}
+
+func TestConnStats_ClientsCapped(t *testing.T) {
+	conns := newConnStats(0)
+	var opened []net.Conn
+	for _, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.2:2", "10.0.0.3:1"} {
+		conn := &addrConn{remote: addr}
+		opened = append(opened, conn)
+		conns.track(conn, http.StateNew)
+	}
+	snap := conns.snapshot(2)
+	if snap.ClientCount != 3 || len(snap.Clients) != 2 || snap.Clients[0] != (clientConns{"10.0.0.2", 2}) || snap.Clients[1].IP != "10.0.0.1" {
+		t.Errorf("clients = %d %+v, want 10.0.0.2 then 10.0.0.1 of 3", snap.ClientCount, snap.Clients)
+	}
+
+	for _, conn := range opened {
+		conns.track(conn, http.StateHijacked)
+	}
+	if snap := conns.snapshot(2); snap.Open != 0 || snap.ClientCount != 0 || snap.Closed != 4 {
+		t.Errorf("after closing: open %d, clients %d, closed %d", snap.Open, snap.ClientCount, snap.Closed)
+	}
+}
+
+// addrConn is a net.Conn with only a remote address.
+type addrConn struct {
+	net.Conn
+	remote string
+}
+
+func (c *addrConn) RemoteAddr() net.Addr {
+	addr, _ := net.ResolveTCPAddr("tcp", c.remote)
+	return addr
+}
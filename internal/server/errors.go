@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/agleyzer/encodersim/internal/playlist"
+)
+
+// Error codes of the JSON error responses to failed documents. They are a
+// stable interface that clients branch on: a code is never renamed or
+// given a different meaning.
+const (
+	// ErrorInvalidVariant is for a variant index that is not a number.
+	ErrorInvalidVariant = "invalid_variant_index"
+
+	// ErrorVariantOutOfRange is for a variant index the stream does not
+	// have.
+	ErrorVariantOutOfRange = "variant_out_of_range"
+
+	// ErrorNotReady is for a document that cannot be generated yet, such as
+	// before a cluster node has the replicated state. Retry later.
+	ErrorNotReady = "not_ready"
+
+	// ErrorNotFound is for other documents that do not exist, such as a
+	// start-over playlist from before the start of the stream.
+	ErrorNotFound = "not_found"
+
+	// ErrorGenerationFailed is for any other failure.
+	ErrorGenerationFailed = "generation_failed"
+)
+
+// errorResponse is the body of a JSON error response.
+type errorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// documentError returns the status code and error code of a document that
+// failed with err. Errors the playlist does not classify keep status.
+func documentError(err error, status int) (int, string) {
+	switch {
+	case errors.Is(err, playlist.ErrVariantOutOfRange):
+		return http.StatusNotFound, ErrorVariantOutOfRange
+	case errors.Is(err, playlist.ErrNotReady):
+		return http.StatusServiceUnavailable, ErrorNotReady
+	case status == http.StatusNotFound:
+		return status, ErrorNotFound
+	default:
+		return status, ErrorGenerationFailed
+	}
+}
+
+// writeError writes a JSON error response with error code code. Errors are
+// never cached, and not_ready ones ask to retry after a second.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", DefaultCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if code == ErrorNotReady {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
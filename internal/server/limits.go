@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Limits bounds what a client connection may hold on to, so that scanners
+// and slow clients cannot accumulate hung connections on long-running
+// instances, and how many requests and connections clients may make. A
+// zero duration, size, rate or count disables the corresponding limit.
+type Limits struct {
+	// ReadHeaderTimeout is how long a client may take to send the request
+	// headers. It is the slow loris protection: a connection that trickles
+	// its headers in is closed once it expires.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is how long a client may take to send the whole request,
+	// including the body.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is how long writing a response may take, from the end of
+	// the request headers. Blocking playlist reloads and throttled network
+	// profiles hold responses for a while, so keep it well above the
+	// target duration.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is how long an idle keep-alive connection is kept open.
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes is the maximum size of the request line and headers.
+	MaxHeaderBytes int
+
+	// MaxBodyBytes is the maximum size of a request body. Larger requests
+	// are answered with 413 Request Entity Too Large.
+	MaxBodyBytes int64
+
+	// RequestRate limits the requests per second of all clients together,
+	// with bursts of up to RequestBurst requests (one second of requests if
+	// zero). Requests over the limit are answered with 429 Too Many
+	// Requests and a Retry-After header.
+	RequestRate  float64
+	RequestBurst int
+
+	// ClientRequestRate limits the requests per second of each client IP
+	// like RequestRate, with bursts of up to ClientRequestBurst requests.
+	ClientRequestRate  float64
+	ClientRequestBurst int
+
+	// MaxConns caps the open client connections. Requests on connections
+	// accepted while MaxConns were open are answered with 429 and the
+	// connection is closed.
+	MaxConns int
+}
+
+// DefaultLimits returns the limits used when none are specified.
+func DefaultLimits() Limits {
+	return Limits{
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		MaxBodyBytes:      1 << 20,
+	}
+}
+
+// Validate checks that the limits are usable.
+func (l Limits) Validate() error {
+	if l.ReadHeaderTimeout < 0 || l.ReadTimeout < 0 || l.WriteTimeout < 0 || l.IdleTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if l.MaxHeaderBytes < 0 || l.MaxBodyBytes < 0 {
+		return fmt.Errorf("size limits must not be negative")
+	}
+	for _, rate := range []float64{l.RequestRate, l.ClientRequestRate} {
+		if rate < 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return fmt.Errorf("request rates must be finite and not negative")
+		}
+	}
+	if l.RequestBurst < 0 || l.ClientRequestBurst < 0 || l.MaxConns < 0 {
+		return fmt.Errorf("bursts and connection caps must not be negative")
+	}
+	return nil
+}
+
+// apply sets the limits of srv. A zero MaxHeaderBytes keeps the
+// net/http default of 1 MB, since the header size cannot be unlimited.
+func (l Limits) apply(srv *http.Server) {
+	srv.ReadHeaderTimeout = l.ReadHeaderTimeout
+	srv.ReadTimeout = l.ReadTimeout
+	srv.WriteTimeout = l.WriteTimeout
+	srv.IdleTimeout = l.IdleTimeout
+	srv.MaxHeaderBytes = l.MaxHeaderBytes
+}
+
+// limitBody answers requests whose declared body exceeds MaxBodyBytes with
+// 413, and cuts off bodies that turn out larger while they are read.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	if s.limits.MaxBodyBytes == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > s.limits.MaxBodyBytes {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.limits.MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
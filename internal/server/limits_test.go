@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr bool
+	}{
+		{"defaults", DefaultLimits(), false},
+		{"disabled", Limits{}, false},
+		{"negative timeout", Limits{IdleTimeout: -time.Second}, true},
+		{"negative header size", Limits{MaxHeaderBytes: -1}, true},
+		{"negative body size", Limits{MaxBodyBytes: -1}, true},
+		{"rates", Limits{RequestRate: 100, RequestBurst: 200, ClientRequestRate: 0.5, MaxConns: 10}, false},
+		{"negative rate", Limits{ClientRequestRate: -1}, true},
+		{"infinite rate", Limits{RequestRate: math.Inf(1)}, true},
+		{"negative burst", Limits{RequestRate: 1, RequestBurst: -1}, true},
+		{"negative connection cap", Limits{MaxConns: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limits.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	srv := NewWithOptions(createTestPlaylist(t), Options{Limits: Limits{MaxBodyBytes: 8}}, createTestLogger())
+	handler := srv.limitBody(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantCode      int
+	}{
+		{"small", "12345678", 8, http.StatusNoContent},
+		{"declared too large", "123456789", 9, http.StatusRequestEntityTooLarge},
+		{"streamed too large", "123456789", -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/network-profile", strings.NewReader(tt.body))
+			req.ContentLength = tt.contentLength
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestLimits_SlowHeaders(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	Limits{ReadHeaderTimeout: 100 * time.Millisecond}.apply(ts.Config)
+	ts.Start()
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// A slow loris client never finishes its headers
+	if _, err := io.WriteString(conn, "GET /playlist.m3u8 HTTP/1.1\r\nHost: localhost\r\n"); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestTimeout {
+			t.Fatalf("status = %d, want the connection closed", resp.StatusCode)
+		}
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("connection with incomplete headers was not closed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("connection closed after %s, want about 100ms", elapsed)
+	}
+}
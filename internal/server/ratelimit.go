@@ -0,0 +1,144 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/ratelimit"
+)
+
+// throttleReasons are why the server's own limits (see Limits) answer a
+// request with 429 Too Many Requests: the global request rate, the request
+// rate of the client IP, or a connection accepted over MaxConns.
+var throttleReasons = []string{"rate", "client_rate", "connections"}
+
+// clientSweepInterval is how often the rate limits of clients that have
+// been quiet long enough to be back at a full burst are dropped.
+const clientSweepInterval = time.Minute
+
+// throttle applies the request rate limits of Limits and counts the
+// requests it refuses, including those refused for MaxConns. It is safe for
+// concurrent use.
+type throttle struct {
+	clientRate  float64
+	clientBurst int
+
+	mu        sync.Mutex
+	global    *ratelimit.Bucket // nil without RequestRate
+	clients   map[string]*ratelimit.Bucket
+	lastSweep time.Time
+	refused   map[string]uint64 // throttleReasons to count
+}
+
+// newThrottle returns the throttle of limits.
+func newThrottle(limits Limits) *throttle {
+	t := &throttle{
+		clientRate:  limits.ClientRequestRate,
+		clientBurst: limits.ClientRequestBurst,
+		clients:     make(map[string]*ratelimit.Bucket),
+		refused:     make(map[string]uint64),
+	}
+	if limits.RequestRate > 0 {
+		t.global = ratelimit.NewBucket(limits.RequestRate, limits.RequestBurst)
+	}
+	return t
+}
+
+// take takes a request of client ip from the rate limits. If one of them
+// is exhausted, it returns the reason and how long until the request would
+// be allowed. The global limit is only charged for requests the client
+// limit lets through.
+func (t *throttle) take(ip string, now time.Time) (string, time.Duration) {
+	if t.global == nil && t.clientRate == 0 {
+		return "", 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.clientRate > 0 {
+		t.sweep(now)
+		b, ok := t.clients[ip]
+		if !ok {
+			b = ratelimit.NewBucket(t.clientRate, t.clientBurst)
+			t.clients[ip] = b
+		}
+		if wait := b.Take(now); wait > 0 {
+			t.refused["client_rate"]++
+			return "client_rate", wait
+		}
+	}
+	if t.global != nil {
+		if wait := t.global.Take(now); wait > 0 {
+			t.refused["rate"]++
+			return "rate", wait
+		}
+	}
+	return "", 0
+}
+
+// sweep drops the buckets of clients that are back at a full burst, which
+// a new bucket would have too, so that the map does not grow with every
+// client ever seen. Caller must hold the lock.
+func (t *throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < clientSweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for ip, b := range t.clients {
+		if b.Full(now) {
+			delete(t.clients, ip)
+		}
+	}
+}
+
+// refuse counts a request refused for reason, one of throttleReasons.
+func (t *throttle) refuse(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refused[reason]++
+}
+
+// counts returns the refused requests by reason, with every reason present.
+func (t *throttle) counts() map[string]uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]uint64, len(throttleReasons))
+	for _, reason := range throttleReasons {
+		counts[reason] = t.refused[reason]
+	}
+	return counts
+}
+
+// limitRequest answers r with 429 Too Many Requests and a Retry-After header
+// if it arrived on a connection over MaxConns or exceeds a request rate
+// limit, and reports whether to serve it. Requests to openClasses and
+// adminClasses are never limited, so that health checks, scrapes and
+// operators get through to an overloaded instance.
+func (s *Server) limitRequest(w http.ResponseWriter, r *http.Request, class string) bool {
+	if slices.Contains(openClasses, class) || slices.Contains(adminClasses, class) {
+		return true
+	}
+	if s.conns.overCap(r) {
+		s.throttle.refuse("connections")
+		w.Header().Set("Connection", "close")
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many connections", http.StatusTooManyRequests)
+		return false
+	}
+
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if _, wait := s.throttle.take(ip, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestThrottle_Take(t *testing.T) {
+	type call struct {
+		ip     string
+		offset time.Duration
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		limits Limits
+		calls  []call
+		want   []string // reason of each call, "" if allowed
+	}{
+		{
+			name:   "unlimited",
+			limits: Limits{},
+			calls:  []call{{"10.0.0.1", 0}, {"10.0.0.1", 0}, {"10.0.0.1", 0}},
+			want:   []string{"", "", ""},
+		},
+		{
+			name:   "client burst then refill",
+			limits: Limits{ClientRequestRate: 2, ClientRequestBurst: 2},
+			calls:  []call{{"10.0.0.1", 0}, {"10.0.0.1", 0}, {"10.0.0.1", 0}, {"10.0.0.2", 0}, {"10.0.0.1", 500 * time.Millisecond}},
+			want:   []string{"", "", "client_rate", "", ""},
+		},
+		{
+			name:   "global across clients",
+			limits: Limits{RequestRate: 1},
+			calls:  []call{{"10.0.0.1", 0}, {"10.0.0.2", 0}, {"10.0.0.2", time.Second}},
+			want:   []string{"", "rate", ""},
+		},
+		{
+			name:   "client refusals do not charge the global limit",
+			limits: Limits{RequestRate: 2, ClientRequestRate: 1},
+			calls:  []call{{"10.0.0.1", 0}, {"10.0.0.1", 0}, {"10.0.0.1", 0}, {"10.0.0.2", 0}, {"10.0.0.3", 0}},
+			want:   []string{"", "client_rate", "client_rate", "", "rate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newThrottle(tt.limits)
+			for i, call := range tt.calls {
+				reason, wait := th.take(call.ip, start.Add(call.offset))
+				if reason != tt.want[i] {
+					t.Errorf("call %d: reason = %q, want %q", i, reason, tt.want[i])
+				}
+				if (wait > 0) != (reason != "") {
+					t.Errorf("call %d: wait = %v with reason %q", i, wait, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottle_Sweep(t *testing.T) {
+	th := newThrottle(Limits{ClientRequestRate: 0.05})
+	start := time.Now()
+	th.take("10.0.0.1", start)
+	th.take("10.0.0.2", start.Add(clientSweepInterval-time.Second))
+
+	// The first client is back at a full burst, the second is not yet
+	th.take("10.0.0.3", start.Add(clientSweepInterval+time.Second-time.Millisecond))
+	if _, ok := th.clients["10.0.0.1"]; ok {
+		t.Error("full bucket of 10.0.0.1 kept")
+	}
+	if _, ok := th.clients["10.0.0.2"]; !ok {
+		t.Error("bucket of 10.0.0.2 dropped")
+	}
+}
+
+func TestLimitRequest(t *testing.T) {
+	srv := NewWithOptions(createTestPlaylist(t), Options{Limits: Limits{ClientRequestRate: 0.5, ClientRequestBurst: 1}}, createTestLogger())
+	handler := srv.Handler()
+
+	get := func(path, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/playlist.m3u8", "10.0.0.1:1000"); w.Code != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", w.Code)
+	}
+	w := get("/playlist.m3u8", "10.0.0.1:1001")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request status = %d, Retry-After %q, want 429 after 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("/playlist.m3u8", "10.0.0.2:1000"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want 200", w.Code)
+	}
+	for _, path := range []string{"/health", "/metrics", "/connections"} {
+		if w := get(path, "10.0.0.1:1002"); w.Code == http.StatusTooManyRequests {
+			t.Errorf("%s was throttled", path)
+		}
+	}
+
+	if counts := srv.throttle.counts(); counts["client_rate"] != 1 || counts["rate"] != 0 || counts["connections"] != 0 {
+		t.Errorf("counts = %v, want one client_rate", counts)
+	}
+}
+
+func TestLimitRequest_MaxConns(t *testing.T) {
+	srv := NewWithOptions(createTestPlaylist(t), Options{Limits: Limits{MaxConns: 1}}, createTestLogger())
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.Config.ConnState = srv.conns.track
+	ts.Config.ConnContext = srv.conns.connContext
+	ts.Start()
+	defer ts.Close()
+
+	get := func(client *http.Client) *http.Response {
+		t.Helper()
+		resp, err := client.Get(ts.URL + "/playlist.m3u8")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// The first client keeps its connection open
+	first := &http.Client{Transport: &http.Transport{}}
+	defer first.CloseIdleConnections()
+	if resp := get(first); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first client status = %d, want 200", resp.StatusCode)
+	}
+
+	second := &http.Client{Transport: &http.Transport{}}
+	defer second.CloseIdleConnections()
+	resp := get(second)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" || !resp.Close {
+		t.Errorf("second client status = %d, Retry-After %q, close %v, want 429 after 1 and close",
+			resp.StatusCode, resp.Header.Get("Retry-After"), resp.Close)
+	}
+
+	// Once the first connection is gone, new ones are served again
+	first.CloseIdleConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.conns.snapshot(0).Open > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp := get(second); resp.StatusCode != http.StatusOK {
+		t.Errorf("after the first client left: status = %d, want 200", resp.StatusCode)
+	}
+	if counts := srv.throttle.counts(); counts["connections"] != 1 {
+		t.Errorf("counts = %v, want one connections", counts)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Reloader re-fetches and re-parses the source and splices it into the
+// live playlist, returning how the source was loaded.
+type Reloader func(ctx context.Context) (OriginFetch, error)
+
+// ErrReloadDisabled is returned by Reload when the server was created
+// without Options.Reload.
+var ErrReloadDisabled = errors.New("reloading the source is not enabled")
+
+// EventSourceReloaded is the type of the event published when the source is
+// reloaded.
+const EventSourceReloaded = "source_reloaded"
+
+// Reload reloads the source with Options.Reload, from POST /admin/reload or
+// a SIGHUP. Reloads run one at a time; if one fails, the current segments
+// keep playing.
+func (s *Server) Reload(ctx context.Context) error {
+	if s.reload == nil {
+		return ErrReloadDisabled
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	fetch, err := s.reload(ctx)
+	if err != nil {
+		return err
+	}
+	s.SetOriginFetch(fetch)
+	s.logger.Info("source reloaded", "duration", fetch.Duration, "fromCache", fetch.FromCache)
+	if s.events != nil {
+		s.events.Publish(EventSourceReloaded, "source reloaded and spliced at the live edge", map[string]any{
+			"duration_ms": fetch.Duration.Milliseconds(),
+			"from_cache":  fetch.FromCache,
+		})
+	}
+	return nil
+}
+
+// handleReload reloads the source on POST and answers 204 once the new
+// segments are spliced in, or 502 if the source could not be reloaded.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		http.Error(w, "Reloading the source is not enabled", http.StatusNotImplemented)
+		return
+	}
+	if err := s.Reload(r.Context()); err != nil {
+		s.logger.Error("failed to reload source, keeping current segments", "error", err)
+		http.Error(w, "Failed to reload source: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package server
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ReusePortSupported reports whether Options.ReusePort works on this
+// platform.
+const ReusePortSupported = true
+
+// reusePort is the Control function of net.ListenConfig that sets
+// SO_REUSEPORT on a listening socket before it is bound, so that other
+// processes that set it too can bind the same port.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
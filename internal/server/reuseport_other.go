@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package server
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// ReusePortSupported reports whether Options.ReusePort works on this
+// platform.
+const ReusePortSupported = false
+
+// reusePort fails: SO_REUSEPORT is not available on this platform.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("SO_REUSEPORT is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStart_ReusePort(t *testing.T) {
+	if !ReusePortSupported {
+		t.Skip("SO_REUSEPORT is not supported on this platform")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Find a free port, held with SO_REUSEPORT until both servers are up
+	probe, err := NewWithOptions(createTestPlaylist(t), Options{ReusePort: true}, createTestLogger()).listen(ctx, 0)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	port := probe.Addr().(*net.TCPAddr).Port
+
+	// Without SO_REUSEPORT the port is taken
+	plain := NewWithOptions(createTestPlaylist(t), Options{Port: port}, createTestLogger())
+	if err := plain.Start(ctx); err == nil || !strings.Contains(err.Error(), "listen on port") {
+		t.Errorf("Start() without ReusePort error = %v, want listen error", err)
+	}
+
+	errs := make(chan error, 2)
+	for range 2 {
+		srv := NewWithOptions(createTestPlaylist(t), Options{Port: port, ReusePort: true}, createTestLogger())
+		go func() { errs <- srv.Start(ctx) }()
+	}
+	time.Sleep(100 * time.Millisecond)
+	probe.Close()
+
+	for i := range 10 {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/playlist.m3u8", port))
+		if err != nil {
+			t.Fatalf("request %d error = %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("request %d status = %d, want 200", i, resp.StatusCode)
+		}
+	}
+
+	cancel()
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Errorf("Start() error = %v", err)
+		}
+	}
+}
@@ -2,61 +2,378 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/admin"
+	"github.com/agleyzer/encodersim/internal/audit"
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/buildinfo"
+	"github.com/agleyzer/encodersim/internal/events"
+	"github.com/agleyzer/encodersim/internal/faults"
+	"github.com/agleyzer/encodersim/internal/health"
+	"github.com/agleyzer/encodersim/internal/metrics"
+	"github.com/agleyzer/encodersim/internal/mirror"
+	"github.com/agleyzer/encodersim/internal/player"
 	"github.com/agleyzer/encodersim/internal/playlist"
+	"github.com/agleyzer/encodersim/internal/prime"
+	"github.com/agleyzer/encodersim/internal/sleep"
+	"github.com/agleyzer/encodersim/internal/smooth"
+	"github.com/agleyzer/encodersim/internal/tenant"
 )
 
+// Options configures a Server.
+type Options struct {
+	// Port is the HTTP server port.
+	Port int
+
+	// TLS, if set, serves HTTPS on Port instead of HTTP (see LoadTLSConfig).
+	TLS *tls.Config
+
+	// RedirectPort, if set with TLS, is a plain HTTP port that redirects
+	// every request to HTTPS on Port.
+	RedirectPort int
+
+	// ReusePort binds Port and RedirectPort with SO_REUSEPORT, so that
+	// several processes can listen on the same port and the kernel spreads
+	// new connections among them. Only where ReusePortSupported.
+	ReusePort bool
+
+	// Version is reported as the version label of encodersim_build_info.
+	Version string
+
+	// Build is served by /version and in /health. If unset, it is read from
+	// the binary with Version and no features.
+	Build buildinfo.Info
+
+	// Health supplies the state reported by /health. If nil, the server
+	// reports ready whenever it is running.
+	Health *health.Tracker
+
+	// Events, if set, is served by /events.
+	Events *events.Log
+
+	// Player, if set, is the built-in player probe whose counters are
+	// reported by /health and /metrics.
+	Player *player.Probe
+
+	// Primer, if set, primes a CDN edge with the live edge segments; its
+	// fill latencies are reported by /health and /metrics.
+	Primer *prime.Primer
+
+	// Budget, if set, is the resource budget whose usage and headroom are
+	// reported by /health and /metrics.
+	Budget *budget.Budget
+
+	// Latency, if set, delays responses by endpoint class (the handler
+	// label of the metrics, see EndpointClasses) before they are handled.
+	Latency *faults.Latency
+
+	// Shaper, if set, applies its active network profile to every endpoint
+	// but /network-profile, which switches the active profile.
+	Shaper *faults.Shaper
+
+	// Faults, if set, injects faults into the responses to the paths its
+	// rules match, in addition to Latency and the network profile.
+	Faults *faults.PathFaults
+
+	// Mirror, if set, saves every response served, including failed ones.
+	Mirror *mirror.Mirror
+
+	// CDN, if set, adds synthetic X-Cache, Age and Via headers to the
+	// documents and segments served (see streamClasses), as if a CDN were in
+	// front of the server.
+	CDN *faults.CDNHeaders
+
+	// CacheControl sets the Cache-Control header by kind of document.
+	CacheControl CacheControl
+
+	// Tenants, if set, requires an API key from a tenant for every request
+	// but those to openClasses and CORS preflights, and limits each tenant
+	// to its endpoints and request rate.
+	Tenants *tenant.Registry
+
+	// Admin, if set, requires a bearer token for adminClasses instead of a
+	// tenant's API key: any role may read them, and only RoleOperator may
+	// change the simulator through them.
+	Admin *admin.Tokens
+
+	// Audit, if set, records every call to adminClasses that is not a read,
+	// including refused ones, with the caller and the request body.
+	Audit *audit.Log
+
+	// Limits bounds the timeouts and request sizes of client connections.
+	// If zero, DefaultLimits are used.
+	Limits Limits
+
+	// Reload, if set, reloads the source on POST /admin/reload (see
+	// Server.Reload).
+	Reload Reloader
+}
+
 // Server serves the live HLS playlist.
 type Server struct {
 	playlist   *playlist.Playlist
 	port       int
+	tls        *tls.Config
+	redirect   int // Options.RedirectPort
+	reusePort  bool
 	logger     *slog.Logger
+	metrics    *metrics.Registry
+	health     *health.Tracker
+	events     *events.Log
+	player     *player.Probe
+	primer     *prime.Primer
+	budget     *budget.Budget
+	latency    *faults.Latency
+	shaper     *faults.Shaper
+	faults     *faults.PathFaults
+	mirror     *mirror.Mirror
+	cdn        *faults.CDNHeaders
+	cache      CacheControl
+	tenants    *tenant.Registry
+	admin      *admin.Tokens
+	audit      *audit.Log
+	limits     Limits
+	reload     Reloader
+	reloadMu   sync.Mutex // Serializes Reload
+	conns      *connStats
+	throttle   *throttle
+	build      buildinfo.Info
+	started    time.Time
 	httpServer *http.Server
+
+	originFetch atomic.Pointer[OriginFetch] // Reported in Server-Timing
+
+	mu               sync.Mutex
+	maintenanceUntil time.Time      // zero unless in a maintenance window
+	variantFailures  map[int]int    // variant index to simulated status code
+	variantRequests  map[int]uint64 // variant index to media playlist requests
+}
+
+// OriginFetch describes the most recent load of the source playlists.
+type OriginFetch struct {
+	// Duration is how long fetching and parsing the source took.
+	Duration time.Duration
+
+	// FromCache is set when the origin confirmed that the source snapshot
+	// cache was current (304 Not Modified).
+	FromCache bool
 }
 
 // New creates a new HTTP server.
 func New(lp *playlist.Playlist, port int, logger *slog.Logger) *Server {
+	return NewWithOptions(lp, Options{Port: port}, logger)
+}
+
+// NewWithOptions creates a new HTTP server with the given options.
+func NewWithOptions(lp *playlist.Playlist, opts Options, logger *slog.Logger) *Server {
+	tracker := opts.Health
+	if tracker == nil {
+		tracker = health.NewTracker(logger)
+		tracker.MarkReady()
+	}
+	build := opts.Build
+	if build.GoVersion == "" {
+		build = buildinfo.Read(opts.Version, nil, nil)
+	}
+	limits := opts.Limits
+	if limits == (Limits{}) {
+		limits = DefaultLimits()
+	}
 	return &Server{
-		playlist: lp,
-		port:     port,
-		logger:   logger,
+		playlist:  lp,
+		port:      opts.Port,
+		tls:       opts.TLS,
+		redirect:  opts.RedirectPort,
+		reusePort: opts.ReusePort,
+		logger:    logger,
+		metrics:   metrics.NewRegistry(opts.Version),
+		health:    tracker,
+		events:    opts.Events,
+		player:    opts.Player,
+		primer:    opts.Primer,
+		budget:    opts.Budget,
+		latency:   opts.Latency,
+		shaper:    opts.Shaper,
+		faults:    opts.Faults,
+		mirror:    opts.Mirror,
+		cdn:       opts.CDN,
+		cache:     opts.CacheControl,
+		tenants:   opts.Tenants,
+		admin:     opts.Admin,
+		audit:     opts.Audit,
+		limits:    limits,
+		reload:    opts.Reload,
+		conns:     newConnStats(limits.MaxConns),
+		throttle:  newThrottle(limits),
+		build:     build,
+		started:   time.Now(),
 	}
 }
 
-// Start starts the HTTP server.
-func (s *Server) Start(ctx context.Context) error {
+// readOnly are the methods of the endpoints that only serve documents.
+var readOnly = []string{http.MethodGet, http.MethodHead}
+
+// routes returns the handler of every endpoint, each restricted to the
+// methods it supports (see allowMethods).
+func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
 	// Register handlers
-	mux.HandleFunc("/playlist.m3u8", s.handlePlaylist)
-	mux.HandleFunc("/health", s.handleHealth)
-	mux.HandleFunc("/cluster/status", s.handleClusterStatus)
+	mux.HandleFunc("/playlist.m3u8", allowMethods(s.handlePlaylist, readOnly...))
+	mux.HandleFunc("/health", allowMethods(s.handleHealth, readOnly...))
+	mux.HandleFunc("/cluster/status", allowMethods(s.handleClusterStatus, readOnly...))
+	mux.HandleFunc("/metrics", allowMethods(s.handleMetrics, readOnly...))
+	mux.HandleFunc("/events", allowMethods(s.handleEvents, readOnly...))
+	mux.HandleFunc("/manifest.mpd", allowMethods(s.handleManifest, readOnly...))
+	mux.HandleFunc("/smooth/", allowMethods(s.handleSmooth, readOnly...))
+	mux.HandleFunc("/preview", allowMethods(s.handlePreview, readOnly...))
+	mux.HandleFunc("/subtitles/", allowMethods(s.handleSubtitles, readOnly...))
+	mux.HandleFunc("/network-profile", allowMethods(s.handleNetworkProfile, http.MethodGet, http.MethodHead, http.MethodPut))
+	mux.HandleFunc("/admin/reload", allowMethods(s.handleReload, http.MethodPost))
+	mux.HandleFunc("/connections", allowMethods(s.handleConnections, readOnly...))
+	mux.HandleFunc("/version", allowMethods(s.handleVersion, readOnly...))
+	mux.HandleFunc("/openapi.json", allowMethods(s.handleOpenAPI, readOnly...))
 
 	// Register variant-specific handler (for master playlists)
 	// This catches requests like /variant/0/playlist.m3u8, /variant/1/playlist.m3u8, etc.
-	mux.HandleFunc("/variant/", s.handleVariantPlaylist)
+	mux.HandleFunc("/variant/", allowMethods(s.handleVariantPlaylist, readOnly...))
+
+	// Media playlists of the alternate audio and subtitle renditions
+	mux.HandleFunc("/rendition/", allowMethods(s.handleRendition, readOnly...))
+
+	// The source as a VOD asset, next to the live loop
+	mux.HandleFunc("/vod/", allowMethods(s.handleVOD, readOnly...))
+
+	// Start-over TV: the loop from a program date time on
+	mux.HandleFunc("/startover/", allowMethods(s.handleStartOver, readOnly...))
+
+	// Dummy keys for the EXT-X-KEY tags of encrypted playlists
+	mux.HandleFunc("/keys/", allowMethods(s.handleKey, readOnly...))
+	return mux
+}
+
+// allowMethods restricts h to methods. OPTIONS is answered for every route
+// with the allowed methods, including CORS preflight requests from browser
+// players; any other method gets 405 Method Not Allowed.
+func allowMethods(h http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ") + ", " + http.MethodOptions
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", allow)
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !slices.Contains(methods, r.Method) {
+			w.Header().Set("Allow", allow)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Handler returns the handler of every endpoint, with the logging, metrics
+// and access control that Start serves them with, for serving the
+// simulator from another HTTP server.
+func (s *Server) Handler() http.Handler {
+	return s.loggingMiddleware(s.limitBody(s.routes()))
+}
+
+// listen opens the listening socket of port, with SO_REUSEPORT if
+// Options.ReusePort is set.
+func (s *Server) listen(ctx context.Context, port int) (net.Listener, error) {
+	var lc net.ListenConfig
+	if s.reusePort {
+		lc.Control = reusePort
+	}
+	ln, err := lc.Listen(ctx, "tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("listen on port %d: %w", port, err)
+	}
+	return ln, nil
+}
+
+// Start starts the HTTP server. It fails if a port cannot be bound.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := s.listen(ctx, s.port)
+	if err != nil {
+		return err
+	}
+	var redirectLn net.Listener
+	if s.tls != nil && s.redirect != 0 {
+		if redirectLn, err = s.listen(ctx, s.redirect); err != nil {
+			ln.Close()
+			return err
+		}
+	}
 
 	s.httpServer = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: s.loggingMiddleware(mux),
+		Addr:        fmt.Sprintf(":%d", s.port),
+		Handler:     s.Handler(),
+		TLSConfig:   s.tls,
+		ConnState:   s.conns.track,
+		ConnContext: s.conns.connContext,
+		ErrorLog:    s.conns.errorLog(s.logger),
 	}
+	s.limits.apply(s.httpServer)
 
 	// Start server in a goroutine
 	go func() {
-		s.logger.Info("starting HTTP server", "port", s.port)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		s.logger.Info("starting HTTP server", "port", s.port, "tls", s.tls != nil, "reuse_port", s.reusePort)
+		var err error
+		if s.tls != nil {
+			// The certificate is in TLSConfig
+			err = s.httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = s.httpServer.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Error("HTTP server error", "error", err)
 		}
 	}()
 
+	var redirectServer *http.Server
+	if redirectLn != nil {
+		redirectServer = &http.Server{
+			Addr:      fmt.Sprintf(":%d", s.redirect),
+			Handler:   http.HandlerFunc(s.redirectHTTPS),
+			ConnState: s.conns.track,
+			ErrorLog:  s.conns.errorLog(s.logger),
+		}
+		s.limits.apply(redirectServer)
+		go func() {
+			s.logger.Info("redirecting HTTP to HTTPS", "port", s.redirect)
+			if err := redirectServer.Serve(redirectLn); err != nil && err != http.ErrServerClosed {
+				s.logger.Error("HTTP redirect server error", "error", err)
+			}
+		}()
+	}
+
 	// Wait for context cancellation
 	<-ctx.Done()
 
@@ -65,28 +382,29 @@ func (s *Server) Start(ctx context.Context) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
 	return s.httpServer.Shutdown(shutdownCtx)
 }
 
 // handlePlaylist serves the current live playlist.
 // For media playlists, generates media playlist content.
 // For master playlists, generates master playlist content.
+// With a dvr query parameter, the variant URLs carry it along.
 func (s *Server) handlePlaylist(w http.ResponseWriter, r *http.Request) {
-	// Generate playlist (master or media depending on playlist type)
-	playlistContent, err := s.playlist.Generate()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate playlist: %v", err), http.StatusInternalServerError)
+	depth, ok := s.dvrDepth(w, r)
+	if !ok {
 		return
 	}
-
-	// Set HLS-specific headers
-	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Write the playlist
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(playlistContent))
+	if depth > 0 {
+		s.writeDocument(w, hlsContentType, s.cache.Master, "Failed to generate playlist", http.StatusInternalServerError, "", func(out io.Writer) error {
+			return s.playlist.WriteDVRMaster(out, depth)
+		})
+		return
+	}
+	// Stream playlist (master or media depending on playlist type)
+	s.writePlaylist(w, s.cache.Master, "Failed to generate playlist", http.StatusInternalServerError, s.playlist.WriteMaster)
 }
 
 // handleVariantPlaylist serves variant-specific media playlists.
@@ -106,39 +424,489 @@ func (s *Server) handleVariantPlaylist(w http.ResponseWriter, r *http.Request) {
 
 	variantIndex, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, "Invalid variant index", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrorInvalidVariant, "Invalid variant index")
 		return
 	}
 
-	// Generate variant-specific playlist
-	playlistContent, err := s.playlist.GenerateVariant(variantIndex)
+	if status, ok := s.recordVariantRequest(variantIndex, r.UserAgent() == player.UserAgent); ok {
+		http.Error(w, "Simulated variant failure", status)
+		return
+	}
+
+	// LL-HLS requests, each honored only when its feature is enabled
+	query := r.URL.Query()
+	if msn := query.Get("_HLS_msn"); msn != "" && s.playlist.BlockingReloadEnabled() {
+		if status, msg := s.awaitSequence(r.Context(), variantIndex, msn); status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+	}
+	write := s.playlist.WriteVariant
+	if skip := query.Get("_HLS_skip"); (skip == "YES" || skip == "v2") && s.playlist.DeltaUpdatesEnabled() {
+		write = s.playlist.WriteVariantDelta
+	}
+	depth, ok := s.dvrDepth(w, r)
+	if !ok {
+		return
+	}
+	if depth > 0 {
+		// DVR windows are always written in full
+		write = func(out io.Writer, index int) error {
+			return s.playlist.WriteDVRVariant(out, index, depth)
+		}
+	}
+	if behind, ok := r.Context().Value(staleKey{}).(int); ok {
+		// A stale cache serves its full copy whatever the request
+		write = func(out io.Writer, index int) error {
+			return s.playlist.WriteStaleVariant(out, index, behind)
+		}
+	}
+
+	// Stream variant-specific playlist
+	s.writePlaylist(w, s.cache.Media, "Failed to generate variant playlist", http.StatusNotFound, func(out io.Writer) error {
+		return write(out, variantIndex)
+	})
+}
+
+// handleRendition serves the media playlists of the alternate renditions
+// at /rendition/N/playlist.m3u8, which loop with the variants.
+func (s *Server) handleRendition(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/rendition/"), "/playlist.m3u8")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	renditionIndex, err := strconv.Atoi(path)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate variant playlist: %v", err), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrorNotFound, "Rendition not found")
 		return
 	}
+	s.writePlaylist(w, s.cache.Media, "Failed to generate rendition playlist", http.StatusNotFound, func(out io.Writer) error {
+		return s.playlist.WriteRendition(out, renditionIndex)
+	})
+}
 
-	// Set HLS-specific headers
-	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+// handleVOD serves the source as a VOD asset: the master playlist at
+// /vod/playlist.m3u8 and the media playlists at /vod/variant/N/playlist.m3u8.
+func (s *Server) handleVOD(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/vod/playlist.m3u8" {
+		s.writeDocument(w, hlsContentType, s.cache.Master, "Failed to generate VOD playlist", http.StatusInternalServerError, "", s.playlist.WriteVODMaster)
+		return
+	}
+
+	variantIndex, ok := variantPath(w, r, "/vod")
+	if !ok {
+		return
+	}
+	s.writeDocument(w, hlsContentType, s.cache.Media, "Failed to generate VOD variant playlist", http.StatusNotFound, "", func(out io.Writer) error {
+		return s.playlist.WriteVODVariant(out, variantIndex)
+	})
+}
+
+// handleStartOver serves the start-over playlists from the program date time
+// in the from query parameter (--program-date-time only): the master
+// playlist at /startover/playlist.m3u8 and the media playlists at
+// /startover/variant/N/playlist.m3u8.
+func (s *Server) handleStartOver(w http.ResponseWriter, r *http.Request) {
+	if !s.playlist.StartOverEnabled() {
+		http.Error(w, "Start-over requires --program-date-time", http.StatusNotFound)
+		return
+	}
+	from, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from: expected an RFC 3339 date", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Path == "/startover/playlist.m3u8" {
+		s.writeDocument(w, hlsContentType, s.cache.Master, "Failed to generate start-over playlist", http.StatusInternalServerError, "", func(out io.Writer) error {
+			return s.playlist.WriteStartOverMaster(out, from)
+		})
+		return
+	}
+	variantIndex, ok := variantPath(w, r, "/startover")
+	if !ok {
+		return
+	}
+	s.writeDocument(w, hlsContentType, s.cache.Media, "Failed to generate start-over variant playlist", http.StatusNotFound, "", func(out io.Writer) error {
+		return s.playlist.WriteStartOverVariant(out, variantIndex, from)
+	})
+}
+
+// dvrDepth returns the DVR window depth in the dvr query parameter of r, or
+// 0 if there is none. Invalid depths, and depths on playlists that are not
+// live, are answered with 400 and reported with ok unset.
+func (s *Server) dvrDepth(w http.ResponseWriter, r *http.Request) (depth time.Duration, ok bool) {
+	query := r.URL.Query()
+	if !query.Has("dvr") {
+		return 0, true
+	}
+	if !s.playlist.DVREnabled() {
+		http.Error(w, "DVR windows require --playlist-type live", http.StatusBadRequest)
+		return 0, false
+	}
+	depth, err := time.ParseDuration(query.Get("dvr"))
+	if err != nil || depth <= 0 || depth > playlist.MaxDVRDepth {
+		http.Error(w, fmt.Sprintf("Invalid dvr: expected a duration up to %s, such as 30m", playlist.MaxDVRDepth), http.StatusBadRequest)
+		return 0, false
+	}
+	return depth, true
+}
+
+// handleKey serves the dummy key with the ID in /keys/{id} that the
+// EXT-X-KEY tags of encrypted playlists point to (--encryption).
+func (s *Server) handleKey(w http.ResponseWriter, r *http.Request) {
+	if !s.playlist.EncryptionEnabled() {
+		http.Error(w, "Encryption is not enabled", http.StatusNotFound)
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/keys/"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.writeDocument(w, "application/octet-stream", s.cache.Segment, "Failed to generate key", http.StatusInternalServerError, "", func(out io.Writer) error {
+		return s.playlist.WriteKey(out, id)
+	})
+}
+
+// variantPath returns the variant index of a request for
+// {prefix}/variant/{N}/playlist.m3u8. Other paths are answered with 404, and
+// invalid indexes with 400.
+func variantPath(w http.ResponseWriter, r *http.Request, prefix string) (int, bool) {
+	path, ok := strings.CutPrefix(r.URL.Path, prefix+"/variant/")
+	if !ok || !strings.HasSuffix(path, "/playlist.m3u8") {
+		http.NotFound(w, r)
+		return 0, false
+	}
+	variantIndex, err := strconv.Atoi(strings.TrimSuffix(path, "/playlist.m3u8"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorInvalidVariant, "Invalid variant index")
+		return 0, false
+	}
+	return variantIndex, true
+}
+
+// blockingReloadPoll is how often a blocking playlist reload checks whether
+// the segment it waits for is live.
+const blockingReloadPoll = 50 * time.Millisecond
+
+// awaitSequence holds a blocking playlist reload until the variant's window
+// contains media sequence number msn. It returns a non-zero status if the
+// request should fail instead: 400 for a malformed msn or one more than two
+// segments past the live edge, and 503 if the segment is not live within
+// three target durations, as the HLS specification requires.
+func (s *Server) awaitSequence(ctx context.Context, variantIndex int, msn string) (int, string) {
+	want, err := strconv.ParseUint(msn, 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, "Invalid _HLS_msn"
+	}
+	deadline := time.Now().Add(3 * s.playlist.AdvanceInterval())
+	for {
+		last, err := s.playlist.LastMediaSequence(variantIndex)
+		if err != nil || last >= want {
+			// Invalid variants are reported by the playlist writer
+			return 0, ""
+		}
+		if want > last+2 {
+			return http.StatusBadRequest, "_HLS_msn is too far in the future"
+		}
+		if time.Now().After(deadline) {
+			return http.StatusServiceUnavailable, "Segment did not become available"
+		}
+		if err := sleep.Sleep(ctx, blockingReloadPoll); err != nil {
+			return http.StatusServiceUnavailable, "Request cancelled"
+		}
+	}
+}
+
+// handleManifest serves the live DASH manifest (--dash only).
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	if !s.playlist.DASHEnabled() {
+		http.Error(w, "DASH output is not enabled", http.StatusNotFound)
+		return
+	}
+	s.writeDocument(w, "application/dash+xml", s.cache.Media, "Failed to generate manifest", http.StatusInternalServerError, "", s.playlist.WriteMPD)
+}
+
+// handleSmooth serves the live Smooth Streaming manifest at /smooth/Manifest
+// and redirects fragment requests to their segments (--smooth only).
+func (s *Server) handleSmooth(w http.ResponseWriter, r *http.Request) {
+	if !s.playlist.SmoothEnabled() {
+		http.Error(w, "Smooth Streaming output is not enabled", http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/smooth/")
+	if path == "Manifest" {
+		s.writeDocument(w, "application/vnd.ms-sstr+xml", s.cache.Media, "Failed to generate manifest", http.StatusInternalServerError, "", s.playlist.WriteSmooth)
+		return
+	}
+
+	bitrate, start, err := smooth.ParseFragmentPath(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	segmentURL, err := s.playlist.SmoothFragmentURL(bitrate, start)
+	if errors.Is(err, playlist.ErrFragmentNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to resolve fragment", "path", path, "error", err)
+		http.Error(w, "Failed to resolve fragment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", expandCacheControl(s.cache.Segment, s.playlist.AdvanceInterval()))
+	http.Redirect(w, r, segmentURL, http.StatusFound)
+}
+
+// handleSubtitles serves the debug subtitle rendition: its playlist at
+// /subtitles/playlist.m3u8 and its segments at /subtitles/{N}.vtt
+// (--debug-subtitles only).
+func (s *Server) handleSubtitles(w http.ResponseWriter, r *http.Request) {
+	if !s.playlist.DebugSubtitlesEnabled() {
+		http.Error(w, "Debug subtitles are not enabled", http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/subtitles/")
+	if name == "playlist.m3u8" {
+		s.writeDocument(w, hlsContentType, s.cache.Media, "Failed to generate subtitle playlist", http.StatusInternalServerError, "", s.playlist.WriteDebugSubtitles)
+		return
+	}
+
+	seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".vtt"), 10, 64)
+	if err != nil || !strings.HasSuffix(name, ".vtt") {
+		http.NotFound(w, r)
+		return
+	}
+	s.writeDocument(w, "text/vtt", s.cache.Segment, "Subtitle segment not found", http.StatusNotFound, "", func(out io.Writer) error {
+		return s.playlist.WriteDebugCue(out, seq)
+	})
+}
+
+// previewPage plays /playlist.m3u8 in the browser, natively where HLS is
+// supported and with hls.js elsewhere, next to the /health state.
+const previewPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>encodersim preview</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+video { width: 100%; max-width: 960px; background: #000; }
+pre { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<video id="video" controls autoplay muted playsinline></video>
+<pre id="state"></pre>
+<script src="https://cdn.jsdelivr.net/npm/hls.js@1"></script>
+<script>
+const video = document.getElementById("video");
+const src = "playlist.m3u8";
+if (video.canPlayType("application/vnd.apple.mpegurl")) {
+  video.src = src;
+} else if (window.Hls && Hls.isSupported()) {
+  const hls = new Hls({ liveSyncDurationCount: 3 });
+  hls.loadSource(src);
+  hls.attachMedia(video);
+} else {
+  document.getElementById("state").textContent = "This browser cannot play HLS.";
+}
+
+async function refresh() {
+  try {
+    const resp = await fetch("health");
+    const health = await resp.json();
+    const stats = health.stats;
+    document.getElementById("state").textContent =
+      "status:          " + health.status + "\n" +
+      "media sequence:  " + stats.sequence_number + "\n" +
+      "target duration: " + stats.target_duration + "s\n" +
+      "window size:     " + stats.window_size;
+  } catch (e) {
+    document.getElementById("state").textContent = "health: " + e;
+  }
+}
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
+
+// handlePreview serves a browser page that plays the live stream.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, previewPage)
+}
+
+// playlistBufferSize is the size of the buffer placed in front of the
+// ResponseWriter when streaming playlists. Playlists smaller than this are
+// written to the connection in a single call.
+const playlistBufferSize = 32 << 10
+
+// hlsContentType is the Content-Type of HLS playlists.
+const hlsContentType = "application/vnd.apple.mpegurl"
+
+// writePlaylist streams a playlist rendered by render to w with HLS headers,
+// its Cache-Control set from cacheControl (see CacheControl).
+// If render fails before any bytes have reached the client, an error response
+// with errStatus is sent instead; otherwise the response is already committed
+// and the error is only logged.
+func (s *Server) writePlaylist(w http.ResponseWriter, cacheControl, errMsg string, errStatus int, render func(io.Writer) error) {
+	cache := "miss"
+	if s.playlist.PreRendered() {
+		cache = "hit"
+	}
+	s.writeDocument(w, hlsContentType, cacheControl, errMsg, errStatus, cache, render)
+}
+
+// writeDocument is writePlaylist for any manifest format. cache is the
+// Server-Timing cache status, or "" if the document is never pre-rendered.
+func (s *Server) writeDocument(w http.ResponseWriter, contentType, cacheControl, errMsg string, errStatus int, cache string, render func(io.Writer) error) {
+	// Set live manifest headers
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", expandCacheControl(cacheControl, s.playlist.AdvanceInterval()))
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	// Write the playlist
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(playlistContent))
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriterSize(cw, playlistBufferSize)
+
+	start := time.Now()
+	if err := render(bw); err != nil {
+		if cw.n == 0 {
+			status, code := documentError(err, errStatus)
+			s.metrics.ObserveGenerationError(code)
+			writeError(w, status, code, fmt.Sprintf("%s: %v", errMsg, err))
+			return
+		}
+		s.logger.Debug("playlist write aborted", "error", err, "bytes", cw.n)
+		return
+	}
+
+	// Documents larger than the buffer are already streaming, and their
+	// headers sent, by the time generation ends
+	if cw.n == 0 {
+		w.Header().Set("Server-Timing", s.serverTiming(time.Since(start), cache))
+		w.Header().Set("Timing-Allow-Origin", "*")
+	}
+
+	if err := bw.Flush(); err != nil {
+		s.logger.Debug("playlist write aborted", "error", err, "bytes", cw.n)
+	}
+}
+
+// SetOriginFetch records the most recent load of the source playlists,
+// reported in the Server-Timing header of every document.
+func (s *Server) SetOriginFetch(f OriginFetch) {
+	s.originFetch.Store(&f)
+}
+
+// serverTiming returns the Server-Timing header value for a document that
+// took gen to generate: the generation time, the cache status (omitted if
+// cache is "") and the source load time with whether the snapshot cache
+// was used (omitted until SetOriginFetch is called).
+func (s *Server) serverTiming(gen time.Duration, cache string) string {
+	timing := fmt.Sprintf("gen;dur=%.3f", durationMillis(gen))
+	if cache != "" {
+		timing += fmt.Sprintf(", cache;desc=%q", cache)
+	}
+	if f := s.originFetch.Load(); f != nil {
+		desc := "fetched"
+		if f.FromCache {
+			desc = "snapshot"
+		}
+		timing += fmt.Sprintf(", origin;dur=%.3f;desc=%q", durationMillis(f.Duration), desc)
+	}
+	return timing
+}
+
+// durationMillis returns d in fractional milliseconds, the Server-Timing
+// unit.
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
 
-// handleHealth serves health check information.
+// countingWriter counts the bytes successfully written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// handleHealth serves the health state, its active reasons and statistics.
+// The status code is 503 while starting or stopping, when the server should
+// not receive traffic, and 200 when ready or degraded: a degraded server
+// still serves playlists, and the reasons tell automation what is wrong.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	stats := s.playlist.GetStats()
+	status := s.health.Status()
 
-	health := map[string]any{
-		"status": "ok",
-		"stats":  stats,
+	reasons := status.Reasons
+	if reasons == nil {
+		reasons = []health.Reason{}
+	}
+	if s.player != nil {
+		stats["player_probe"] = s.player.Stats()
+	}
+	if s.primer != nil {
+		stats["cdn_prime"] = s.primer.Stats()
+	}
+	if s.budget != nil {
+		stats["budget"] = s.budget.Stats()
 	}
+	stats["connections"] = s.conns.summary()
+	resp := map[string]any{
+		"status":  status.State,
+		"since":   status.Since,
+		"reasons": reasons,
+		"stats":   stats,
+		"build":   s.build,
+	}
+
+	code := http.StatusOK
+	if status.State == health.StateStarting || status.State == health.StateStopping {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
 
+// handleVersion serves the build and features of this instance and how long
+// it has been running.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(health)
+	json.NewEncoder(w).Encode(struct {
+		buildinfo.Info
+		Started time.Time `json:"started"`
+		Uptime  float64   `json:"uptime_seconds"`
+	}{s.build, s.started, time.Since(s.started).Seconds()})
+}
+
+// openAPISpec is the OpenAPI document of every endpoint. TestOpenAPI checks
+// that it matches the routes; update it, and the client package, with them.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the OpenAPI document of the HTTP API.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(openAPISpec)
 }
 
 // handleClusterStatus serves cluster status information.
@@ -159,38 +927,737 @@ func (s *Server) handleClusterStatus(w http.ResponseWriter, r *http.Request) {
 		"leader_address":  stats["leader_address"],
 		"raft_state":      stats["raft_state"],
 	}
+	for _, key := range []string{"clock_skew", "raft_delay"} {
+		if v, ok := stats[key]; ok {
+			clusterStatus[key] = v
+		}
+	}
+	// Lets operators tell when a joining node has caught up
+	clusterStatus["nodes"] = s.playlist.ClusterProgress(r.Context())
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(clusterStatus)
 }
 
-// loggingMiddleware logs HTTP requests.
+// handleEvents serves the events published after the ID given by the since
+// query parameter (all retained events if absent), only those of the type
+// given by the type parameter if set, and the ID to pass as since on the
+// next poll.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		http.Error(w, "Events are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+
+	list, last := s.events.Since(since)
+	if typ := r.URL.Query().Get("type"); typ != "" {
+		list = slices.DeleteFunc(list, func(e events.Event) bool { return e.Type != typ })
+	}
+	if list == nil {
+		list = []events.Event{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"events": list,
+		"last":   last,
+	})
+}
+
+// handleNetworkProfile serves the loaded network profiles and the active
+// one, and switches the active profile on PUT with a body such as
+// {"active":"3g"}; an empty name restores normal conditions.
+func (s *Server) handleNetworkProfile(w http.ResponseWriter, r *http.Request) {
+	if s.shaper == nil {
+		http.Error(w, "Network profiles are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req struct {
+			Active *string `json:"active"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil || req.Active == nil {
+			http.Error(w, `Invalid body, want {"active":"PROFILE"}`, http.StatusBadRequest)
+			return
+		}
+		if err := s.SetNetworkProfile(*req.Active); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"active":   s.shaper.Active(),
+		"profiles": s.shaper.Profiles(),
+	})
+}
+
+// EventNetworkProfile is the type of the event published when the active
+// network profile changes.
+const EventNetworkProfile = "network_profile_changed"
+
+// SetNetworkProfile makes the named network profile active, or restores
+// normal conditions if name is empty.
+func (s *Server) SetNetworkProfile(name string) error {
+	if err := s.shaper.Activate(name); err != nil {
+		return err
+	}
+	s.logger.Info("network profile changed", "profile", name)
+	if s.events != nil {
+		msg := "network profile " + name + " active"
+		if name == "" {
+			msg = "network profile cleared"
+		}
+		s.events.Publish(EventNetworkProfile, msg, map[string]any{"profile": name})
+	}
+	return nil
+}
+
+// StartMaintenance takes the streams down until the given time, or until
+// EndMaintenance is called: playlist, manifest, subtitle and fragment
+// requests are answered with 503 and a Retry-After header counting down to
+// the end of the window. Health, metrics and the control endpoints keep
+// working, and the window keeps advancing.
+func (s *Server) StartMaintenance(until time.Time) {
+	s.mu.Lock()
+	s.maintenanceUntil = until
+	s.mu.Unlock()
+	s.health.Set(health.ReasonMaintenance, "simulated maintenance until "+until.UTC().Format(time.RFC3339))
+}
+
+// EndMaintenance ends a maintenance window started with StartMaintenance.
+func (s *Server) EndMaintenance() {
+	s.mu.Lock()
+	s.maintenanceUntil = time.Time{}
+	s.mu.Unlock()
+	s.health.Clear(health.ReasonMaintenance)
+}
+
+// inMaintenance reports whether requests of class are down for maintenance,
+// and the number of seconds until the window ends.
+func (s *Server) inMaintenance(class string) (int, bool) {
+	if !slices.Contains(streamClasses, class) {
+		return 0, false
+	}
+	s.mu.Lock()
+	until := s.maintenanceUntil
+	s.mu.Unlock()
+	left := time.Until(until)
+	if left <= 0 {
+		return 0, false
+	}
+	return int((left + time.Second - 1) / time.Second), true
+}
+
+// FailVariant makes requests for the variant's media playlist fail with
+// status until ClearFailures is called.
+func (s *Server) FailVariant(index, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.variantFailures == nil {
+		s.variantFailures = make(map[int]int)
+	}
+	s.variantFailures[index] = status
+	s.logger.Info("simulating variant failure", "variant", index, "status", status)
+}
+
+// ClearFailures ends every failure started with FailVariant.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.variantFailures) > 0 {
+		s.logger.Info("cleared simulated variant failures", "variants", len(s.variantFailures))
+	}
+	s.variantFailures = nil
+}
+
+// recordVariantRequest counts a request for a variant's media playlist,
+// unless it came from the built-in player probe, and returns the variant's
+// simulated status code, if any.
+func (s *Server) recordVariantRequest(index int, fromProbe bool) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !fromProbe {
+		if s.variantRequests == nil {
+			s.variantRequests = make(map[int]uint64)
+		}
+		s.variantRequests[index]++
+	}
+	status, ok := s.variantFailures[index]
+	return status, ok
+}
+
+// VariantRequests returns the number of requests received for each
+// variant's media playlist, including requests that failed. Requests from
+// the built-in player probe are not counted.
+func (s *Server) VariantRequests() map[int]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[int]uint64, len(s.variantRequests))
+	for index, n := range s.variantRequests {
+		counts[index] = n
+	}
+	return counts
+}
+
+// handleMetrics serves Prometheus metrics. Playlist metrics are sampled from
+// the current stats on every scrape.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := s.playlist.GetStats()
+
+	sample := func(desc metrics.Desc, value float64, labelValues ...string) metrics.Sample {
+		return metrics.Sample{Desc: desc, LabelValues: labelValues, Value: value}
+	}
+	samples := []metrics.Sample{
+		sample(metrics.MediaSequence, toFloat(stats["sequence_number"])),
+		sample(metrics.WindowSegments, toFloat(stats["window_size"])),
+		sample(metrics.TargetDuration, toFloat(stats["target_duration"])),
+	}
+	if variants, ok := stats["variants"].([]map[string]any); ok {
+		for i, v := range variants {
+			index := strconv.Itoa(i)
+			samples = append(samples,
+				sample(metrics.VariantSegments, toFloat(v["total_segments"]), index),
+				sample(metrics.VariantPosition, toFloat(v["position"]), index),
+				sample(metrics.VariantBandwidth, toFloat(v["bandwidth"]), index),
+			)
+		}
+	}
+	if wd, ok := stats["watchdog"].(map[string]any); ok {
+		var stalled float64
+		if wd["stalled"] == true {
+			stalled = 1
+		}
+		samples = append(samples,
+			sample(metrics.LastAdvanceTime, toFloat(wd["last_advance_unix"])),
+			sample(metrics.AdvanceStalled, stalled),
+			sample(metrics.AdvanceStalls, toFloat(wd["stalls"])),
+			sample(metrics.AdvanceRestarts, toFloat(wd["restarts"])),
+		)
+	}
+	if isLeader, ok := stats["is_leader"].(bool); ok {
+		var leader float64
+		if isLeader {
+			leader = 1
+		}
+		samples = append(samples, sample(metrics.ClusterLeader, leader))
+	}
+	if ca, ok := stats["cluster_advance"].(map[string]any); ok {
+		samples = append(samples,
+			sample(metrics.AdvanceApplyErrors, toFloat(ca["apply_errors"])),
+			sample(metrics.AdvanceOwed, toFloat(ca["owed"])),
+			sample(metrics.AdvanceDropped, toFloat(ca["dropped"])),
+			sample(metrics.AdvanceCaughtUp, toFloat(ca["caught_up"])),
+		)
+	}
+	if s.player != nil {
+		ps := s.player.Stats()
+		samples = append(samples, sample(metrics.PlayerPlaylistFetches, toFloat(ps["playlists_fetched"])))
+		anomalies, _ := ps["anomalies"].(map[string]uint64)
+		for _, kind := range player.Kinds {
+			samples = append(samples, sample(metrics.PlayerAnomalies, float64(anomalies[kind]), kind))
+		}
+	}
+	if s.primer != nil {
+		for _, fill := range s.primer.Fills() {
+			samples = append(samples,
+				metrics.Sample{Desc: metrics.CDNPrimeDuration, Suffix: "_sum", LabelValues: []string{fill.Playlist}, Value: fill.Seconds},
+				metrics.Sample{Desc: metrics.CDNPrimeDuration, Suffix: "_count", LabelValues: []string{fill.Playlist}, Value: float64(fill.Fetches - fill.Errors)},
+				sample(metrics.CDNPrimeErrors, float64(fill.Errors), fill.Playlist),
+			)
+		}
+	}
+	if s.budget != nil {
+		bs := s.budget.Stats()
+		samples = append(samples,
+			sample(metrics.MemoryUsed, float64(bs.MemoryUsed)),
+			sample(metrics.CacheBytes, float64(bs.CacheBytes)),
+		)
+		if bs.MemoryLimit > 0 {
+			samples = append(samples,
+				sample(metrics.MemoryLimit, float64(bs.MemoryLimit)),
+				sample(metrics.MemoryHeadroom, float64(bs.MemoryLimit-bs.MemoryUsed)),
+			)
+		}
+		if bs.CacheLimit > 0 {
+			samples = append(samples,
+				sample(metrics.CacheLimit, float64(bs.CacheLimit)),
+				sample(metrics.CacheHeadroom, float64(bs.CacheLimit-bs.CacheBytes)),
+			)
+		}
+		for _, resource := range budget.Resources {
+			samples = append(samples, sample(metrics.BudgetRefused, float64(bs.Refused[resource]), resource))
+		}
+	}
+
+	conns := s.conns.snapshot(0)
+	for _, state := range connStates {
+		samples = append(samples, sample(metrics.ConnectionsOpen, float64(conns.States[state]), state))
+	}
+	samples = append(samples,
+		sample(metrics.ConnectionsAccepted, float64(conns.Accepted)),
+		sample(metrics.ConnectionsClosed, float64(conns.Closed)),
+		sample(metrics.ConnectionClients, float64(conns.ClientCount)),
+	)
+	for _, kind := range connErrorKinds {
+		samples = append(samples, sample(metrics.ConnectionErrors, float64(conns.Errors[kind]), kind))
+	}
+	throttled := s.throttle.counts()
+	for _, reason := range throttleReasons {
+		samples = append(samples, sample(metrics.HTTPThrottled, float64(throttled[reason]), reason))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.Write(w, samples); err != nil {
+		s.logger.Debug("metrics write aborted", "error", err)
+	}
+}
+
+// toFloat converts a numeric stats value to float64, or 0 if it is missing.
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float64:
+		return n
+	default:
+		return 0
+	}
+}
+
+// streamClasses are the endpoint classes that serve the stream, as opposed
+// to monitoring and control endpoints.
+var streamClasses = []string{"playlist", "variant", "rendition", "vod", "startover", "keys", "manifest", "smooth", "subtitles"}
+
+// EndpointClasses returns the handler labels of the metrics, which also
+// select the endpoints that Options.Latency and network profiles affect.
+func EndpointClasses() []string {
+	return []string{"playlist", "variant", "rendition", "vod", "startover", "keys", "manifest", "smooth", "subtitles", "preview", "health", "cluster_status", "metrics", "events", "network_profile", "reload", "connections", "version", "openapi", "other"}
+}
+
+// handlerName maps a request path to the handler label used in metrics,
+// keeping the label set small regardless of the paths clients request.
+func handlerName(path string) string {
+	switch {
+	case path == "/playlist.m3u8":
+		return "playlist"
+	case strings.HasPrefix(path, "/variant/"):
+		return "variant"
+	case strings.HasPrefix(path, "/rendition/"):
+		return "rendition"
+	case strings.HasPrefix(path, "/vod/"):
+		return "vod"
+	case strings.HasPrefix(path, "/startover/"):
+		return "startover"
+	case strings.HasPrefix(path, "/keys/"):
+		return "keys"
+	case path == "/health":
+		return "health"
+	case path == "/cluster/status":
+		return "cluster_status"
+	case path == "/metrics":
+		return "metrics"
+	case path == "/events":
+		return "events"
+	case path == "/manifest.mpd":
+		return "manifest"
+	case strings.HasPrefix(path, "/smooth/"):
+		return "smooth"
+	case path == "/preview":
+		return "preview"
+	case strings.HasPrefix(path, "/subtitles/"):
+		return "subtitles"
+	case path == "/network-profile":
+		return "network_profile"
+	case path == "/admin/reload":
+		return "reload"
+	case path == "/connections":
+		return "connections"
+	case path == "/version":
+		return "version"
+	case path == "/openapi.json":
+		return "openapi"
+	default:
+		return "other"
+	}
+}
+
+// loggingMiddleware logs HTTP requests and records their metrics.
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
 		// Wrap the response writer to capture status code
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		if s.mirror != nil {
+			wrapped.body = new(bytes.Buffer)
+		}
+
+		class := handlerName(r.URL.Path)
+		var params map[string]any
+		audited := s.audit != nil && slices.Contains(adminClasses, class) &&
+			!slices.Contains(readOnly, r.Method) && r.Method != http.MethodOptions
+		if audited {
+			params = auditParams(r)
+		}
 
-		next.ServeHTTP(wrapped, r)
+		var tenantName, adminName string
+		ok := s.limitRequest(wrapped, r, class)
+		if ok {
+			if s.admin != nil && slices.Contains(adminClasses, class) {
+				adminName, ok = s.authorizeAdmin(wrapped, r)
+			} else {
+				tenantName, ok = s.authorize(wrapped, r, class)
+			}
+		}
+		if ok {
+			s.serveSimulated(wrapped, r, class, next)
+		}
 
 		duration := time.Since(start)
+		s.metrics.ObserveRequest(class, wrapped.statusCode, duration)
+		if tenantName != "" {
+			s.metrics.ObserveTenantRequest(tenantName, class, wrapped.statusCode)
+		}
+		if s.mirror != nil {
+			s.mirrorResponse(r, wrapped, start, duration)
+		}
+		if audited {
+			actor := adminName
+			if actor == "" {
+				actor = audit.Anonymous
+			}
+			err := s.audit.Record(audit.Entry{
+				Time:   start,
+				Actor:  actor,
+				Source: audit.SourceAPI,
+				Action: r.Method + " " + r.URL.Path,
+				Params: params,
+				Remote: r.RemoteAddr,
+				Status: wrapped.statusCode,
+			})
+			if err != nil {
+				s.logger.Warn("failed to audit request", "path", r.URL.Path, "error", err)
+			}
+		}
 
-		s.logger.Info("HTTP request",
+		// The player probe polls constantly; keep it out of the request log
+		level := slog.LevelInfo
+		if r.UserAgent() == player.UserAgent {
+			level = slog.LevelDebug
+		}
+		args := []any{
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote", r.RemoteAddr,
 			"status", wrapped.statusCode,
 			"duration", duration,
-		)
+		}
+		if tenantName != "" {
+			args = append(args, "tenant", tenantName)
+		}
+		if adminName != "" {
+			args = append(args, "admin", adminName)
+		}
+		s.logger.Log(r.Context(), level, "HTTP request", args...)
 	})
 }
 
-// responseWriter wraps http.ResponseWriter to capture the status code.
+// openClasses are the endpoint classes served without an API key, so that
+// load balancer health checks, Prometheus and API tooling keep working with
+// Options.Tenants.
+var openClasses = []string{"health", "metrics", "version", "openapi"}
+
+// authorize checks the API key of r, from the tenant.Header header or else
+// the tenant.QueryParam query parameter, and answers r itself if the key is
+// refused. It returns the key's tenant, or "" if r needs no key or the key
+// is unknown, and whether to serve r.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, class string) (string, bool) {
+	if s.tenants == nil || r.Method == http.MethodOptions || slices.Contains(openClasses, class) {
+		return "", true
+	}
+	key := r.Header.Get(tenant.Header)
+	if key == "" {
+		key = r.URL.Query().Get(tenant.QueryParam)
+	}
+
+	name, retryAfter, err := s.tenants.Authorize(key, class)
+	switch {
+	case err == nil:
+		return name, true
+	case errors.Is(err, tenant.ErrRateLimited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+	case errors.Is(err, tenant.ErrEndpointDenied):
+		http.Error(w, "Endpoint not allowed for this API key", http.StatusForbidden)
+	default:
+		http.Error(w, "Missing or invalid API key", http.StatusUnauthorized)
+	}
+	return name, false
+}
+
+// mirrorResponse saves the response to r. Failures are logged rather than
+// failing the request, which has already been answered.
+func (s *Server) mirrorResponse(r *http.Request, w *responseWriter, start time.Time, duration time.Duration) {
+	// The request is answered, so a client that has gone away does not
+	// cancel the writes
+	err := s.mirror.Save(context.WithoutCancel(r.Context()), mirror.Entry{
+		Time:      start,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     s.mirrorQuery(r),
+		Remote:    r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		Status:    w.statusCode,
+		Header:    w.Header().Clone(),
+		Duration:  duration,
+	}, w.body.Bytes())
+	if err != nil {
+		s.logger.Warn("failed to mirror response", "path", r.URL.Path, "error", err)
+	}
+}
+
+// adminClasses are the endpoint classes that control or inspect the
+// simulator, protected by Options.Admin.
+var adminClasses = []string{"cluster_status", "events", "network_profile", "reload", "connections"}
+
+// authorizeAdmin checks the bearer token of r against Options.Admin and
+// answers r itself if the token is missing or its role falls short. It
+// returns the token's name, or "" for a CORS preflight, and whether to
+// serve r.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method == http.MethodOptions {
+		return "", true
+	}
+	tok, ok := s.admin.Authenticate(r.Header.Get("Authorization"))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="encodersim admin"`)
+		http.Error(w, "Missing or invalid admin token", http.StatusUnauthorized)
+		return "", false
+	}
+	required := admin.RoleOperator
+	if slices.Contains(readOnly, r.Method) {
+		required = admin.RoleViewer
+	}
+	if !tok.Role.Allows(required) {
+		http.Error(w, fmt.Sprintf("Admin role %s required", required), http.StatusForbidden)
+		return tok.Name, false
+	}
+	return tok.Name, true
+}
+
+// maxAuditBody is the most of a request body recorded in the audit log.
+const maxAuditBody = 4096
+
+// auditParams returns the parameters of r to audit: the fields of its JSON
+// object body, or else the body as text, and its query string. The body
+// read is put back for the handler.
+func auditParams(r *http.Request) map[string]any {
+	params := make(map[string]any)
+	if r.URL.RawQuery != "" {
+		params["query"] = r.URL.RawQuery
+	}
+	if r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxAuditBody))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		var fields map[string]any
+		if err := json.Unmarshal(body, &fields); err == nil {
+			for k, v := range fields {
+				params[k] = v
+			}
+		} else if len(body) > 0 {
+			params["body"] = string(body)
+		}
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// mirrorQuery returns the query string of r to mirror, with any API key
+// redacted.
+func (s *Server) mirrorQuery(r *http.Request) string {
+	if s.tenants == nil {
+		return r.URL.RawQuery
+	}
+	query := r.URL.Query()
+	if !query.Has(tenant.QueryParam) {
+		return r.URL.RawQuery
+	}
+	query.Set(tenant.QueryParam, "REDACTED")
+	return query.Encode()
+}
+
+// serveSimulated serves r with next under the simulated conditions: during
+// a maintenance window, or when a fault strikes, the request is answered
+// without reaching next.
+func (s *Server) serveSimulated(w *responseWriter, r *http.Request, class string, next http.Handler) {
+	if retryAfter, ok := s.inMaintenance(class); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Origin under maintenance", http.StatusServiceUnavailable)
+		return
+	}
+
+	cond := s.faults.Conditions(r.URL.Path)
+	// Never shape the endpoint that switches profiles, so that a profile
+	// cannot lock the operator out
+	if class != "network_profile" {
+		cond = cond.Add(s.shaper.Conditions(class))
+	}
+	if !s.wait(r, s.latency.Delay(class)+cond.Delay) {
+		return
+	}
+	if cond.Throughput > 0 {
+		w.pacer = faults.NewPacer(cond.Throughput)
+		w.ctx = r.Context()
+	}
+	if s.cdn != nil && slices.Contains(streamClasses, class) {
+		s.setCDNHeaders(w.Header())
+	}
+	if cond.Status != 0 {
+		http.Error(w, "Simulated fault", cond.Status)
+		return
+	}
+	if cond.Stale > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), staleKey{}, cond.Stale))
+	}
+	if cond.Stall > 0 || cond.Truncate {
+		held := &heldWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(held, r)
+		writeFaultyBody(w, r, held, cond)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// heldWriter holds back the response of a handler, so that body faults can
+// be applied to it as a whole.
+type heldWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (hw *heldWriter) Write(p []byte) (int, error) {
+	return hw.body.Write(p)
+}
+
+func (hw *heldWriter) WriteHeader(code int) {
+	hw.statusCode = code
+}
+
+// writeFaultyBody writes the response held by hw to w under the body faults
+// of cond: the first half of the body, a stall, then the rest unless the
+// body is truncated. A truncated body falls short of its Content-Length,
+// which makes the server drop the connection.
+func writeFaultyBody(w *responseWriter, r *http.Request, hw *heldWriter, cond faults.Conditions) {
+	body := hw.body.Bytes()
+	if len(body) == 0 {
+		w.WriteHeader(hw.statusCode)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(hw.statusCode)
+	half := len(body) / 2
+	if _, err := w.Write(body[:half]); err != nil {
+		return
+	}
+	if cond.Stall > 0 {
+		http.NewResponseController(w.ResponseWriter).Flush()
+		if sleep.Sleep(r.Context(), cond.Stall) != nil {
+			return
+		}
+	}
+	if !cond.Truncate {
+		w.Write(body[half:])
+	}
+}
+
+// staleKey is the request context key of the number of advances a stale
+// variant playlist fault goes back (faults.Conditions.Stale).
+type staleKey struct{}
+
+// setCDNHeaders sets the X-Cache, Age and Via headers of a response sampled
+// from the simulated CDN.
+func (s *Server) setCDNHeaders(h http.Header) {
+	status := s.cdn.Sample()
+	if status.Hit {
+		h.Set("X-Cache", "HIT")
+	} else {
+		h.Set("X-Cache", "MISS")
+	}
+	h.Set("Age", strconv.Itoa(int(status.Age/time.Second)))
+	if via := s.cdn.Via(); via != "" {
+		h.Set("Via", via)
+	}
+}
+
+// wait waits for the simulated latency d of r. It returns false if the
+// client went away in the meantime.
+func (s *Server) wait(r *http.Request, d time.Duration) bool {
+	return sleep.Sleep(r.Context(), d) == nil
+}
+
+// pacedChunk is the size of the writes a throughput cap is applied to.
+const pacedChunk = 4096
+
+// responseWriter wraps http.ResponseWriter to capture the status code and,
+// if body is set, the body. If pacer is set, it caps the throughput of the
+// body.
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	body       *bytes.Buffer
+
+	pacer *faults.Pacer
+	ctx   context.Context // of the request, if pacer is set
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.write(p)
+	if rw.body != nil {
+		rw.body.Write(p[:n])
+	}
+	return n, err
+}
+
+// write writes p, paced if pacer is set.
+func (rw *responseWriter) write(p []byte) (int, error) {
+	if rw.pacer == nil {
+		return rw.ResponseWriter.Write(p)
+	}
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), pacedChunk)]
+		if err := sleep.Sleep(rw.ctx, rw.pacer.Reserve(len(chunk))); err != nil {
+			return written, err
+		}
+		n, err := rw.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+	}
+	return written, nil
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -3,16 +3,36 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/agleyzer/encodersim/internal/admin"
+	"github.com/agleyzer/encodersim/internal/audit"
+	"github.com/agleyzer/encodersim/internal/budget"
+	"github.com/agleyzer/encodersim/internal/buildinfo"
+	"github.com/agleyzer/encodersim/internal/client"
+	"github.com/agleyzer/encodersim/internal/events"
+	"github.com/agleyzer/encodersim/internal/faults"
+	"github.com/agleyzer/encodersim/internal/health"
+	"github.com/agleyzer/encodersim/internal/mirror"
+	"github.com/agleyzer/encodersim/internal/player"
 	"github.com/agleyzer/encodersim/internal/playlist"
+	"github.com/agleyzer/encodersim/internal/prime"
 	"github.com/agleyzer/encodersim/internal/segment"
+	"github.com/agleyzer/encodersim/internal/storage"
+	"github.com/agleyzer/encodersim/internal/tenant"
 	"github.com/agleyzer/encodersim/internal/variant"
 )
 
@@ -146,6 +166,1423 @@ func TestHandleVariantPlaylist(t *testing.T) {
 	}
 }
 
+func TestHandleVariantPlaylist_UnknownVariant(t *testing.T) {
+	lp := createTestPlaylist(t)
+	logger := createTestLogger()
+	srv := New(lp, 8080, logger)
+
+	req := httptest.NewRequest("GET", "/variant/99/playlist.m3u8", nil)
+	w := httptest.NewRecorder()
+
+	srv.handleVariantPlaylist(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "#EXTM3U") {
+		t.Error("Expected no playlist content in error response")
+	}
+}
+
+func TestDocumentErrors(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	routes := srv.routes()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"/variant/99/playlist.m3u8", http.StatusNotFound, ErrorVariantOutOfRange},
+		{"/vod/variant/99/playlist.m3u8", http.StatusNotFound, ErrorVariantOutOfRange},
+		{"/variant/first/playlist.m3u8", http.StatusBadRequest, ErrorInvalidVariant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != DefaultCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cc, DefaultCacheControl)
+			}
+			var body errorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON body %q: %v", w.Body, err)
+			}
+			if body.Code != tt.wantCode || body.Message == "" {
+				t.Errorf("body = %+v, want code %s", body, tt.wantCode)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `encodersim_generation_errors_total{error="variant_out_of_range"} 2`; !strings.Contains(w.Body.String(), want+"\n") {
+		t.Errorf("Expected metric line %q, got:\n%s", want, w.Body.String())
+	}
+}
+
+func TestDocumentError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		wantStatus int
+		wantCode   string
+	}{
+		{"out of range", fmt.Errorf("%w: 3 (0-1)", playlist.ErrVariantOutOfRange), http.StatusInternalServerError, http.StatusNotFound, ErrorVariantOutOfRange},
+		{"not ready", fmt.Errorf("%w: cluster state not initialized", playlist.ErrNotReady), http.StatusNotFound, http.StatusServiceUnavailable, ErrorNotReady},
+		{"not found", playlist.ErrCueNotFound, http.StatusNotFound, http.StatusNotFound, ErrorNotFound},
+		{"other", errors.New("boom"), http.StatusInternalServerError, http.StatusInternalServerError, ErrorGenerationFailed},
+	}
+	for _, tt := range tests {
+		status, code := documentError(tt.err, tt.status)
+		if status != tt.wantStatus || code != tt.wantCode {
+			t.Errorf("%s: documentError() = %d, %s, want %d, %s", tt.name, status, code, tt.wantStatus, tt.wantCode)
+		}
+	}
+}
+
+func TestHandleVariantPlaylist_SimulatedFailure(t *testing.T) {
+	lp := createTestPlaylist(t)
+	srv := New(lp, 8080, createTestLogger())
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		srv.handleVariantPlaylist(w, httptest.NewRequest("GET", "/variant/0/playlist.m3u8", nil))
+		return w.Code
+	}
+
+	srv.FailVariant(0, http.StatusBadGateway)
+	if code := get(); code != http.StatusBadGateway {
+		t.Errorf("Expected status 502 while failing, got %d", code)
+	}
+	srv.ClearFailures()
+	if code := get(); code != http.StatusOK {
+		t.Errorf("Expected status 200 after clearing failures, got %d", code)
+	}
+
+	if got := srv.VariantRequests()[0]; got != 2 {
+		t.Errorf("Expected 2 requests counted for variant 0, got %d", got)
+	}
+}
+
+func TestHandleVOD(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	routes := srv.routes()
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/vod/playlist.m3u8", http.StatusOK, "\n/vod/variant/0/playlist.m3u8\n"},
+		{"/vod/variant/0/playlist.m3u8", http.StatusOK, "https://example.com/seg5.ts\n#EXT-X-ENDLIST\n"},
+		{"/vod/variant/1/playlist.m3u8", http.StatusNotFound, ""},
+		{"/vod/variant/x/playlist.m3u8", http.StatusBadRequest, ""},
+		{"/vod/manifest.mpd", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected %q in response:\n%s", tt.wantBody, w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleStartOver(t *testing.T) {
+	variants := []variant.Variant{{Bandwidth: 1000000, TargetDuration: 10, Segments: []segment.Segment{
+		{URL: "seg0.ts", Duration: 10, Sequence: 0},
+		{URL: "seg1.ts", Duration: 10, Sequence: 1},
+		{URL: "seg2.ts", Duration: 10, Sequence: 2},
+	}}}
+	lp, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 2, ProgramDateTime: playlist.PDTContinuous}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	routes := New(lp, 8080, createTestLogger()).routes()
+	from := url.QueryEscape(time.Now().Add(-15 * time.Second).Format(time.RFC3339Nano))
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/startover/playlist.m3u8?from=" + from, http.StatusOK, "\n/startover/variant/0/playlist.m3u8?from="},
+		{"/startover/variant/0/playlist.m3u8?from=" + from, http.StatusOK, "#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:EVENT\n"},
+		{"/startover/variant/0/playlist.m3u8?from=2000-01-01T00:00:00Z", http.StatusNotFound, "before the start of the stream"},
+		{"/startover/variant/0/playlist.m3u8?from=yesterday", http.StatusBadRequest, ""},
+		{"/startover/variant/0/playlist.m3u8", http.StatusBadRequest, ""},
+		{"/startover/variant/1/playlist.m3u8?from=" + from, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected %q in response:\n%s", tt.wantBody, w.Body)
+			}
+		})
+	}
+
+	// Start-over needs dated segments
+	w := httptest.NewRecorder()
+	New(createTestPlaylist(t), 8080, createTestLogger()).routes().ServeHTTP(w, httptest.NewRequest("GET", "/startover/playlist.m3u8?from="+from, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without program date time, got %d", w.Code)
+	}
+}
+
+func TestHandleDVR(t *testing.T) {
+	lp := createTestPlaylist(t)
+	for range 4 {
+		lp.Advance()
+	}
+	routes := New(lp, 8080, createTestLogger()).routes()
+
+	tests := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"/playlist.m3u8?dvr=30m", http.StatusOK, "\n/variant/0/playlist.m3u8?dvr=30m0s\n"},
+		{"/variant/0/playlist.m3u8", http.StatusOK, "#EXT-X-MEDIA-SEQUENCE:4\n"},
+		{"/variant/0/playlist.m3u8?dvr=50s", http.StatusOK, "#EXT-X-MEDIA-SEQUENCE:2\n"},
+		{"/variant/0/playlist.m3u8?dvr=30m0s", http.StatusOK, "#EXT-X-MEDIA-SEQUENCE:0\n"},
+		{"/variant/0/playlist.m3u8?dvr=48h", http.StatusBadRequest, ""},
+		{"/variant/0/playlist.m3u8?dvr=long", http.StatusBadRequest, ""},
+		{"/playlist.m3u8?dvr=", http.StatusBadRequest, ""},
+		{"/variant/1/playlist.m3u8?dvr=30m", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected %q in response:\n%s", tt.wantBody, w.Body)
+			}
+		})
+	}
+
+	// EVENT playlists already hold the whole stream
+	variants := []variant.Variant{{Bandwidth: 1000000, TargetDuration: 10, Segments: []segment.Segment{
+		{URL: "seg0.ts", Duration: 10, Sequence: 0},
+		{URL: "seg1.ts", Duration: 10, Sequence: 1},
+	}}}
+	event, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 1, Type: playlist.TypeEvent}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	New(event, 8080, createTestLogger()).routes().ServeHTTP(w, httptest.NewRequest("GET", "/variant/0/playlist.m3u8?dvr=30m", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an EVENT playlist, got %d", w.Code)
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	variants := []variant.Variant{{Bandwidth: 1000000, TargetDuration: 10, Segments: []segment.Segment{
+		{URL: "seg0.ts", Duration: 10, Sequence: 0},
+		{URL: "seg1.ts", Duration: 10, Sequence: 1},
+	}}}
+	lp, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 1, Encryption: playlist.Encryption{Method: playlist.EncryptionAES128}}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	routes := New(lp, 8080, createTestLogger()).routes()
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/keys/0", http.StatusOK},
+		{"/keys/12", http.StatusOK},
+		{"/keys/", http.StatusNotFound},
+		{"/keys/first", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+			if tt.wantCode == http.StatusOK {
+				if w.Body.Len() != 16 {
+					t.Errorf("Expected a 16-byte key, got %d bytes", w.Body.Len())
+				}
+				if ct := w.Header().Get("Content-Type"); ct != "application/octet-stream" {
+					t.Errorf("Content-Type = %q, want application/octet-stream", ct)
+				}
+			}
+		})
+	}
+
+	// Without --encryption there are no keys
+	w := httptest.NewRecorder()
+	New(createTestPlaylist(t), 8080, createTestLogger()).routes().ServeHTTP(w, httptest.NewRequest("GET", "/keys/0", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without encryption, got %d", w.Code)
+	}
+}
+
+func TestHandleRendition(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "seg0.ts", Duration: 10, Sequence: 0},
+		{URL: "seg1.ts", Duration: 10, Sequence: 1},
+	}
+	variants := []variant.Variant{{Bandwidth: 1000000, TargetDuration: 10, Audio: "aac", Segments: segments}}
+	renditions := []variant.Rendition{
+		{Type: variant.RenditionAudio, GroupID: "aac", Name: "English", Media: variant.Variant{PlaylistURL: "en.m3u8", TargetDuration: 10, Segments: segments}},
+		{Type: variant.RenditionAudio, GroupID: "aac", Name: "Main"},
+	}
+	lp, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 1, Renditions: renditions}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("NewWithOptions() error = %v", err)
+	}
+	routes := New(lp, 8080, createTestLogger()).routes()
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/rendition/0/playlist.m3u8", http.StatusOK},
+		{"/rendition/1/playlist.m3u8", http.StatusNotFound},
+		{"/rendition/2/playlist.m3u8", http.StatusNotFound},
+		{"/rendition/first/playlist.m3u8", http.StatusNotFound},
+		{"/rendition/0/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			routes.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body)
+			}
+			if tt.wantCode == http.StatusOK && !strings.Contains(w.Body.String(), "seg0.ts") {
+				t.Errorf("Expected the rendition playlist, got:\n%s", w.Body)
+			}
+		})
+	}
+}
+
+func TestHandleVariantPlaylist_LLHLS(t *testing.T) {
+	variants := []variant.Variant{{Bandwidth: 1000000, TargetDuration: 10, Segments: []segment.Segment{
+		{URL: "seg0.ts", Duration: 10, Sequence: 0},
+		{URL: "seg1.ts", Duration: 10, Sequence: 1},
+		{URL: "seg2.ts", Duration: 10, Sequence: 2},
+		{URL: "seg3.ts", Duration: 10, Sequence: 3},
+		{URL: "seg4.ts", Duration: 10, Sequence: 4},
+		{URL: "seg5.ts", Duration: 10, Sequence: 5},
+		{URL: "seg6.ts", Duration: 10, Sequence: 6},
+		{URL: "seg7.ts", Duration: 10, Sequence: 7},
+	}}}
+	lp, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 7, BlockingReload: true, DeltaUpdates: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create test playlist: %v", err)
+	}
+	srv := New(lp, 8080, createTestLogger())
+
+	get := func(ctx context.Context, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.handleVariantPlaylist(w, httptest.NewRequest("GET", "/variant/0/playlist.m3u8?"+query, nil).WithContext(ctx))
+		return w
+	}
+
+	// The window holds 0-6, so 6 is served at once and 7 after the advance
+	if w := get(context.Background(), "_HLS_msn=6"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "CAN-BLOCK-RELOAD=YES") {
+		t.Errorf("_HLS_msn=6: status %d, body:\n%s", w.Code, w.Body.String())
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lp.Advance()
+	}()
+	start := time.Now()
+	if w := get(context.Background(), "_HLS_msn=7&_HLS_part=0"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "#EXT-X-MEDIA-SEQUENCE:1\n") {
+		t.Errorf("_HLS_msn=7: status %d, body:\n%s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("_HLS_msn=7 answered after %s, want it held until the advance", elapsed)
+	}
+
+	for _, query := range []string{"_HLS_msn=10", "_HLS_msn=x"} {
+		if w := get(context.Background(), query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if w := get(ctx, "_HLS_msn=8"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("_HLS_msn=8 with the client gone: status %d, want 503", w.Code)
+	}
+
+	// 70s window, 60s skip boundary: one segment skipped
+	if w := get(context.Background(), "_HLS_skip=YES"); !strings.Contains(w.Body.String(), "#EXT-X-SKIP:SKIPPED-SEGMENTS=1\n") {
+		t.Errorf("_HLS_skip=YES: body:\n%s", w.Body.String())
+	}
+
+	// Without the features, the parameters are ignored
+	srv = New(createTestPlaylist(t), 8080, createTestLogger())
+	if w := get(context.Background(), "_HLS_msn=10&_HLS_skip=YES"); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "EXT-X-SKIP") {
+		t.Errorf("without features: status %d, body:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestRoutes_Methods(t *testing.T) {
+	handler := New(createTestPlaylist(t), 8080, createTestLogger()).routes()
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"GET", "/playlist.m3u8", http.StatusOK, ""},
+		{"HEAD", "/variant/0/playlist.m3u8", http.StatusOK, ""},
+		{"POST", "/playlist.m3u8", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"DELETE", "/variant/0/playlist.m3u8", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"PUT", "/health", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/playlist.m3u8", http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/network-profile", http.StatusNoContent, "GET, HEAD, PUT, OPTIONS"},
+		{"OPTIONS", "/unknown", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Access-Control-Request-Headers", "range")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.method == "OPTIONS" && tt.wantStatus == http.StatusNoContent {
+				if w.Header().Get("Access-Control-Allow-Methods") != tt.wantAllow || w.Header().Get("Access-Control-Allow-Headers") != "range" {
+					t.Errorf("Expected CORS preflight headers, got %v", w.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	handler := NewWithOptions(createTestPlaylist(t), Options{
+		CacheControl: CacheControl{Master: "public, max-age=60", Media: "max-age={half-target}, stale-while-revalidate={target}"},
+	}, createTestLogger()).routes()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/playlist.m3u8", "public, max-age=60"},
+		{"/variant/0/playlist.m3u8", "max-age=5, stale-while-revalidate=10"},
+		{"/variant/9/playlist.m3u8", DefaultCacheControl}, // errors are never cached
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if got := w.Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: Cache-Control = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseCacheControl(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" max-age=31536000, immutable ", "max-age=31536000, immutable", false},
+		{"max-age={half-target}", "max-age={half-target}", false},
+		{"max-age={half}", "", true},
+		{"max-age=1\r\nX-Injected: 1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCacheControl(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCacheControl(%q) = %q, %v, want %q (error %v)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if got := expandCacheControl("max-age={half-target}", time.Second); got != "max-age=1" {
+		t.Errorf("expandCacheControl() with a 1s target = %q, want max-age=1", got)
+	}
+}
+
+func TestHandleManifest(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	w := httptest.NewRecorder()
+	srv.handleManifest(w, httptest.NewRequest("GET", "/manifest.mpd", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without DASH, got %d", w.Code)
+	}
+
+	segments := []segment.Segment{
+		{URL: "https://example.com/seg1.m4s", Duration: 6, Sequence: 0, InitURL: "https://example.com/init.mp4"},
+		{URL: "https://example.com/seg2.m4s", Duration: 6, Sequence: 1, InitURL: "https://example.com/init.mp4"},
+	}
+	lp, err := playlist.NewWithOptions([]variant.Variant{{Bandwidth: 1000000, Segments: segments, TargetDuration: 6}},
+		playlist.Options{WindowSize: 2, DASH: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create DASH playlist: %v", err)
+	}
+	srv = New(lp, 8080, createTestLogger())
+	w = httptest.NewRecorder()
+	srv.handleManifest(w, httptest.NewRequest("GET", "/manifest.mpd", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/dash+xml" {
+		t.Errorf("Expected DASH Content-Type, got %q", ct)
+	}
+	if !strings.Contains(w.Body.String(), `media="https://example.com/seg2.m4s"`) {
+		t.Errorf("Expected the HLS segment URLs in the manifest, got:\n%s", w.Body.String())
+	}
+}
+
+func TestHandleSmooth(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	w := httptest.NewRecorder()
+	srv.handleSmooth(w, httptest.NewRequest("GET", "/smooth/Manifest", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without Smooth Streaming, got %d", w.Code)
+	}
+
+	segments := []segment.Segment{
+		{URL: "https://example.com/seg1.m4s", Duration: 6, Sequence: 0, InitURL: "https://example.com/init.mp4"},
+		{URL: "https://example.com/seg2.m4s", Duration: 6, Sequence: 1, InitURL: "https://example.com/init.mp4"},
+	}
+	lp, err := playlist.NewWithOptions([]variant.Variant{{Bandwidth: 1000000, Segments: segments, TargetDuration: 6}},
+		playlist.Options{WindowSize: 2, Smooth: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create Smooth Streaming playlist: %v", err)
+	}
+	srv = New(lp, 8080, createTestLogger())
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{"manifest", "/smooth/Manifest", http.StatusOK, ""},
+		{"fragment", "/smooth/QualityLevels(1000000)/Fragments(video=60000000)", http.StatusFound, "https://example.com/seg2.m4s"},
+		{"unknown fragment", "/smooth/QualityLevels(1000000)/Fragments(video=1)", http.StatusNotFound, ""},
+		{"invalid path", "/smooth/QualityLevels(1000000)", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.handleSmooth(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if loc := w.Header().Get("Location"); loc != tt.wantLocation {
+				t.Errorf("Expected Location %q, got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleSmooth(w, httptest.NewRequest("GET", "/smooth/Manifest", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/vnd.ms-sstr+xml" {
+		t.Errorf("Expected Smooth Streaming Content-Type, got %q", ct)
+	}
+}
+
+func TestHandlePreview(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	w := httptest.NewRecorder()
+	srv.handlePreview(w, httptest.NewRequest("GET", "/preview", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML Content-Type, got %q", ct)
+	}
+	// Relative URLs keep the page working behind a proxy prefix
+	for _, want := range []string{`"playlist.m3u8"`, `fetch("health")`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+}
+
+func TestHandleSubtitles(t *testing.T) {
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	w := httptest.NewRecorder()
+	srv.handleSubtitles(w, httptest.NewRequest("GET", "/subtitles/playlist.m3u8", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without debug subtitles, got %d", w.Code)
+	}
+
+	segments := []segment.Segment{
+		{URL: "https://example.com/seg1.ts", Duration: 6, Sequence: 0},
+		{URL: "https://example.com/seg2.ts", Duration: 6, Sequence: 1},
+	}
+	lp, err := playlist.NewWithOptions([]variant.Variant{{Bandwidth: 1000000, Segments: segments, TargetDuration: 6}},
+		playlist.Options{WindowSize: 2, DebugSubtitles: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create playlist: %v", err)
+	}
+	srv = New(lp, 8080, createTestLogger())
+
+	tests := []struct {
+		name            string
+		path            string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{"playlist", "/subtitles/playlist.m3u8", http.StatusOK, "application/vnd.apple.mpegurl", "/subtitles/1.vtt"},
+		{"segment", "/subtitles/1.vtt", http.StatusOK, "text/vtt", "seq 1 | segment 2/2 | loop 0"},
+		{"outside window", "/subtitles/5.vtt", http.StatusNotFound, "", ""},
+		{"invalid name", "/subtitles/x.vtt", http.StatusNotFound, "", ""},
+		{"wrong extension", "/subtitles/1.ts", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.handleSubtitles(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.wantContentType, w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body to contain %q, got:\n%s", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	segments := []segment.Segment{
+		{URL: "https://example.com/seg1.ts", Duration: 6, Sequence: 0},
+		{URL: "https://example.com/seg2.ts", Duration: 6, Sequence: 1},
+	}
+	variants := []variant.Variant{{Bandwidth: 1000000, Segments: segments, TargetDuration: 6}}
+	prerendered, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 2, PreRender: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create playlist: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		lp      *playlist.Playlist
+		fetch   *OriginFetch
+		path    string
+		pattern string
+	}{
+		{"rendered", createTestPlaylist(t), nil, "/playlist.m3u8", `^gen;dur=\d+\.\d{3}, cache;desc="miss"$`},
+		{"prerendered", prerendered, nil, "/variant/0/playlist.m3u8", `^gen;dur=\d+\.\d{3}, cache;desc="hit"$`},
+		{"fetched", createTestPlaylist(t), &OriginFetch{Duration: 1500 * time.Microsecond}, "/playlist.m3u8",
+			`^gen;dur=\d+\.\d{3}, cache;desc="miss", origin;dur=1\.500;desc="fetched"$`},
+		{"snapshot", createTestPlaylist(t), &OriginFetch{Duration: 20 * time.Millisecond, FromCache: true}, "/playlist.m3u8",
+			`, origin;dur=20\.000;desc="snapshot"$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(tt.lp, 8080, createTestLogger())
+			if tt.fetch != nil {
+				srv.SetOriginFetch(*tt.fetch)
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.path == "/playlist.m3u8" {
+				srv.handlePlaylist(w, req)
+			} else {
+				srv.handleVariantPlaylist(w, req)
+			}
+
+			timing := w.Header().Get("Server-Timing")
+			if !regexp.MustCompile(tt.pattern).MatchString(timing) {
+				t.Errorf("Server-Timing = %q, want it to match %s", timing, tt.pattern)
+			}
+			if got := w.Header().Get("Timing-Allow-Origin"); got != "*" {
+				t.Errorf("Timing-Allow-Origin = %q, want *", got)
+			}
+		})
+	}
+
+	// Documents that are never pre-rendered have no cache status
+	for i := range segments {
+		segments[i].InitURL = "https://example.com/init.mp4"
+	}
+	dash, err := playlist.NewWithOptions(variants, playlist.Options{WindowSize: 2, DASH: true}, nil, createTestLogger())
+	if err != nil {
+		t.Fatalf("Failed to create DASH playlist: %v", err)
+	}
+	w := httptest.NewRecorder()
+	New(dash, 8080, createTestLogger()).handleManifest(w, httptest.NewRequest("GET", "/manifest.mpd", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if timing := w.Header().Get("Server-Timing"); strings.Contains(timing, "cache") || !strings.HasPrefix(timing, "gen;dur=") {
+		t.Errorf("Server-Timing = %q, want only the generation time", timing)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	classes, err := faults.ParseLatency("variant=fixed:100ms")
+	if err != nil {
+		t.Fatalf("ParseLatency() error = %v", err)
+	}
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Latency: faults.NewLatency(classes, 1)}, createTestLogger())
+	handler := srv.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path     string
+		minDelay time.Duration
+	}{
+		{"/variant/0/playlist.m3u8", 100 * time.Millisecond},
+		{"/health", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			start := time.Now()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("served after %s, want at least %s", elapsed, tt.minDelay)
+			}
+			if w.Code != http.StatusNoContent {
+				t.Errorf("Expected status 204, got %d", w.Code)
+			}
+		})
+	}
+
+	// A client that goes away is not kept waiting, and is not served
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/variant/0/playlist.m3u8", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("cancelled request took %s", elapsed)
+	}
+	if w.Code == http.StatusNoContent {
+		t.Error("Expected the cancelled request not to reach the handler")
+	}
+}
+
+func TestNetworkProfile(t *testing.T) {
+	profiles, err := faults.ParseProfiles([]byte("profiles:\n  - name: outage\n    error-rate: 1\n  - name: slow\n    throughput: 80kbps\n"))
+	if err != nil {
+		t.Fatalf("ParseProfiles() error = %v", err)
+	}
+	log := events.NewLog(0)
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Events: log, Shaper: faults.NewShaper(profiles, 1)}, createTestLogger())
+	mux := http.NewServeMux()
+	mux.Handle("/network-profile", srv.routes())
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 2000))
+	})
+	handler := srv.loggingMiddleware(mux)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do("GET", "/network-profile", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":""`) || !strings.Contains(w.Body.String(), `"profiles":["outage","slow"]`) {
+		t.Fatalf("GET /network-profile = %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"unknown profile", `{"active":"edge"}`, http.StatusNotFound},
+		{"missing field", `{}`, http.StatusBadRequest},
+		{"invalid JSON", `outage`, http.StatusBadRequest},
+		{"switch", `{"active":"outage"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do("PUT", "/network-profile", tt.body); w.Code != tt.wantCode {
+				t.Errorf("PUT %s = %d, want %d", tt.body, w.Code, tt.wantCode)
+			}
+		})
+	}
+
+	// Every response fails, except those of the profile endpoint itself
+	if w := do("GET", "/variant/0/playlist.m3u8", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 under the outage profile, got %d", w.Code)
+	}
+	if w := do("GET", "/network-profile", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":"outage"`) {
+		t.Errorf("GET /network-profile = %d %s", w.Code, w.Body.String())
+	}
+	list, _ := log.Since(0)
+	if len(list) != 1 || list[0].Type != EventNetworkProfile {
+		t.Errorf("Expected one %s event, got %v", EventNetworkProfile, list)
+	}
+
+	// 2000 bytes at 10000 bytes per second
+	if w := do("PUT", "/network-profile", `{"active":"slow"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT slow = %d", w.Code)
+	}
+	start := time.Now()
+	w = do("GET", "/variant/0/playlist.m3u8", "")
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("2000 bytes at 80kbps sent in %s, want at least 200ms", elapsed)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 2000 {
+		t.Errorf("Expected the whole body, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+
+	if w := do("DELETE", "/network-profile", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /network-profile = %d, want 405", w.Code)
+	}
+	disabled := NewWithOptions(createTestPlaylist(t), Options{Port: 8080}, createTestLogger())
+	w = httptest.NewRecorder()
+	disabled.handleNetworkProfile(w, httptest.NewRequest("GET", "/network-profile", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without profiles, got %d", w.Code)
+	}
+}
+
+func TestReload(t *testing.T) {
+	log := events.NewLog(0)
+	var reloadErr error
+	srv := NewWithOptions(createTestPlaylist(t), Options{
+		Port:   8080,
+		Events: log,
+		Reload: func(ctx context.Context) (OriginFetch, error) {
+			return OriginFetch{Duration: 40 * time.Millisecond}, reloadErr
+		},
+	}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+	do := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/admin/reload", nil))
+		return w
+	}
+
+	if w := do("POST"); w.Code != http.StatusNoContent {
+		t.Fatalf("POST /admin/reload = %d %s", w.Code, w.Body.String())
+	}
+	list, _ := log.Since(0)
+	if len(list) != 1 || list[0].Type != EventSourceReloaded {
+		t.Errorf("Expected one %s event, got %v", EventSourceReloaded, list)
+	}
+	if f := srv.originFetch.Load(); f == nil || f.Duration != 40*time.Millisecond {
+		t.Errorf("origin fetch = %v, want the reload's", f)
+	}
+
+	reloadErr = errors.New("variant count changed from 2 to 3")
+	if w := do("POST"); w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "variant count changed") {
+		t.Errorf("POST /admin/reload with a failing reload = %d %s", w.Code, w.Body.String())
+	}
+	if w := do("GET"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /admin/reload = %d, want 405", w.Code)
+	}
+
+	disabled := NewWithOptions(createTestPlaylist(t), Options{Port: 8080}, createTestLogger())
+	w := httptest.NewRecorder()
+	disabled.handleReload(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without a reloader, got %d", w.Code)
+	}
+	if err := disabled.Reload(context.Background()); !errors.Is(err, ErrReloadDisabled) {
+		t.Errorf("Reload() error = %v, want ErrReloadDisabled", err)
+	}
+}
+
+func TestPathFaults(t *testing.T) {
+	rules, err := faults.ParseRules(`^/variant/1/ error=404; ^/playlist\.m3u8$ latency=fixed:100ms`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Faults: faults.NewPathFaults(rules, 1)}, createTestLogger())
+	handler := srv.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path     string
+		wantCode int
+		minDelay time.Duration
+	}{
+		{"/variant/1/playlist.m3u8", http.StatusNotFound, 0},
+		{"/variant/0/playlist.m3u8", http.StatusNoContent, 0},
+		{"/playlist.m3u8", http.StatusNoContent, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			start := time.Now()
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("served after %s, want at least %s", elapsed, tt.minDelay)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestPathFaults_Stale(t *testing.T) {
+	rules, err := faults.ParseRules(`^/variant/ stale=2`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	lp := createTestPlaylist(t)
+	srv := NewWithOptions(lp, Options{Port: 8080, Faults: faults.NewPathFaults(rules, 1)}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+	for i := 0; i < 3; i++ {
+		lp.Advance()
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/variant/0/playlist.m3u8?_HLS_skip=YES", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "#EXT-X-MEDIA-SEQUENCE:1\n") {
+		t.Errorf("Expected a 200 playlist two advances behind sequence 3, got %d:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestPathFaults_Body(t *testing.T) {
+	rules, err := faults.ParseRules(`^/variant/0/ stall=200ms; ^/playlist\.m3u8$ truncate=100%`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Faults: faults.NewPathFaults(rules, 1)}, createTestLogger())
+	ts := httptest.NewServer(srv.loggingMiddleware(srv.routes()))
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := http.Get(ts.URL + "/variant/0/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("GET stalled playlist error = %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !strings.HasSuffix(string(body), "/seg3.ts\n") {
+		t.Errorf("stalled playlist = %q, %v, want it complete", body, err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("stalled playlist served in %s, want at least 200ms", elapsed)
+	}
+
+	resp, err = http.Get(ts.URL + "/playlist.m3u8")
+	if err != nil {
+		t.Fatalf("GET truncated playlist error = %v", err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || int64(len(body)) != resp.ContentLength/2 {
+		t.Errorf("truncated playlist read %d of %d bytes, error = %v, want half and an unexpected EOF", len(body), resp.ContentLength, err)
+	}
+}
+
+func TestCDNHeaders(t *testing.T) {
+	age, _ := faults.ParseDistribution("fixed:12500ms")
+	cdn := faults.NewCDNHeaders(faults.CDN{Pattern: []bool{true, false}, Age: age, Via: "1.1 edge-sim"}, 1)
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, CDN: cdn}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+
+	tests := []struct {
+		path      string
+		wantCache string
+		wantAge   string
+		wantVia   string
+	}{
+		{"/playlist.m3u8", "HIT", "12", "1.1 edge-sim"},
+		{"/variant/0/playlist.m3u8", "MISS", "0", "1.1 edge-sim"},
+		{"/health", "", "", ""}, // monitoring endpoints are not behind the CDN
+		{"/variant/0/playlist.m3u8", "HIT", "12", "1.1 edge-sim"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		h := w.Header()
+		if h.Get("X-Cache") != tt.wantCache || h.Get("Age") != tt.wantAge || h.Get("Via") != tt.wantVia {
+			t.Errorf("%s: X-Cache %q, Age %q, Via %q, want %q, %q, %q", tt.path,
+				h.Get("X-Cache"), h.Get("Age"), h.Get("Via"), tt.wantCache, tt.wantAge, tt.wantVia)
+		}
+	}
+}
+
+func TestTenants(t *testing.T) {
+	tenants := tenant.NewRegistry([]tenant.Tenant{
+		{Name: "team-a", Key: "key-a", Endpoints: []string{"playlist"}},
+		{Name: "team-b", Key: "key-b", Rate: 0.5},
+	})
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Tenants: tenants}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+
+	tests := []struct {
+		method, path, key string
+		wantStatus        int
+	}{
+		{"GET", "/playlist.m3u8", "", http.StatusUnauthorized},
+		{"GET", "/playlist.m3u8", "key-c", http.StatusUnauthorized},
+		{"GET", "/playlist.m3u8", "key-a", http.StatusOK},
+		{"GET", "/playlist.m3u8?api_key=key-a", "", http.StatusOK},
+		{"GET", "/variant/0/playlist.m3u8", "key-a", http.StatusForbidden},
+		{"GET", "/variant/0/playlist.m3u8", "key-b", http.StatusOK},
+		{"GET", "/playlist.m3u8", "key-b", http.StatusTooManyRequests},
+		{"GET", "/health", "", http.StatusOK},
+		{"GET", "/version", "", http.StatusOK},
+		{"OPTIONS", "/playlist.m3u8", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.key != "" {
+			req.Header.Set(tenant.Header, tt.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s with key %q: status %d, want %d", tt.method, tt.path, tt.key, w.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Retry-After = %q, want 2", w.Header().Get("Retry-After"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`encodersim_tenant_requests_total{tenant="team-a",handler="playlist",code="200"} 2`,
+		`encodersim_tenant_requests_total{tenant="team-a",handler="variant",code="403"} 1`,
+		`encodersim_tenant_requests_total{tenant="team-b",handler="playlist",code="429"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), want+"\n") {
+			t.Errorf("Expected metric line %q, got:\n%s", want, w.Body.String())
+		}
+	}
+	if regexp.MustCompile(`encodersim_tenant_requests_total\{[^}]*code="401"`).MatchString(w.Body.String()) {
+		t.Errorf("Expected no tenant metrics for unknown keys, got:\n%s", w.Body.String())
+	}
+}
+
+func TestAdminTokens(t *testing.T) {
+	tokens := admin.NewTokens([]admin.Token{
+		{Name: "alice", Secret: "secret-a", Role: admin.RoleOperator},
+		{Name: "bob", Secret: "secret-b", Role: admin.RoleViewer},
+	})
+	tenants := tenant.NewRegistry([]tenant.Tenant{{Name: "team-a", Key: "key-a"}})
+	profiles := []faults.Profile{{Name: "3g"}}
+	srv := NewWithOptions(createTestPlaylist(t), Options{
+		Port:    8080,
+		Shaper:  faults.NewShaper(profiles, 1),
+		Events:  events.NewLog(10),
+		Tenants: tenants,
+		Admin:   tokens,
+	}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+
+	tests := []struct {
+		method, path, token, key string
+		wantStatus               int
+	}{
+		{"GET", "/network-profile", "", "", http.StatusUnauthorized},
+		{"GET", "/network-profile", "", "key-a", http.StatusUnauthorized}, // API keys do not open admin endpoints
+		{"GET", "/network-profile", "secret-c", "", http.StatusUnauthorized},
+		{"GET", "/network-profile", "secret-b", "", http.StatusOK},
+		{"GET", "/events", "secret-b", "", http.StatusOK},
+		{"PUT", "/network-profile", "secret-b", "", http.StatusForbidden},
+		{"PUT", "/network-profile", "secret-a", "", http.StatusOK},
+		{"OPTIONS", "/network-profile", "", "", http.StatusNoContent},
+		{"GET", "/playlist.m3u8", "secret-a", "", http.StatusUnauthorized}, // admin tokens do not open streams
+		{"GET", "/playlist.m3u8", "", "key-a", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"active":"3g"}`))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		if tt.key != "" {
+			req.Header.Set(tenant.Header, tt.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s with token %q and key %q: status %d, want %d", tt.method, tt.path, tt.token, tt.key, w.Code, tt.wantStatus)
+		}
+		if w.Code == http.StatusUnauthorized && tt.path == "/network-profile" && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s %s: Expected a WWW-Authenticate header", tt.method, tt.path)
+		}
+	}
+	if got := srv.shaper.Active(); got != "3g" {
+		t.Errorf("active profile = %q, want the operator's 3g", got)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	log := events.NewLog(10)
+	auditLog, err := audit.New("", log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := admin.NewTokens([]admin.Token{
+		{Name: "alice", Secret: "secret-a", Role: admin.RoleOperator},
+		{Name: "bob", Secret: "secret-b", Role: admin.RoleViewer},
+	})
+	srv := NewWithOptions(createTestPlaylist(t), Options{
+		Port:   8080,
+		Shaper: faults.NewShaper([]faults.Profile{{Name: "3g"}}, 1),
+		Events: log,
+		Admin:  tokens,
+		Audit:  auditLog,
+	}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+
+	for _, req := range []struct{ method, token string }{
+		{"GET", "secret-b"}, // reads are not audited
+		{"PUT", "secret-b"},
+		{"PUT", ""},
+		{"PUT", "secret-a"},
+	} {
+		r := httptest.NewRequest(req.method, "/network-profile", strings.NewReader(`{"active":"3g"}`))
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if got := srv.shaper.Active(); got != "3g" {
+		t.Fatalf("active profile = %q, want 3g: the audited body must reach the handler", got)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/events?type=audit", nil)
+	r.Header.Set("Authorization", "Bearer secret-b")
+	handler.ServeHTTP(w, r)
+	var resp struct {
+		Events []events.Event `json:"events"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := []struct {
+		actor  string
+		status float64
+	}{
+		{"bob", http.StatusForbidden},
+		{audit.Anonymous, http.StatusUnauthorized},
+		{"alice", http.StatusOK},
+	}
+	if len(resp.Events) != len(want) {
+		t.Fatalf("Expected %d audit events, got %+v", len(want), resp.Events)
+	}
+	for i, e := range resp.Events {
+		params, _ := e.Fields["params"].(map[string]any)
+		if e.Fields["actor"] != want[i].actor || e.Fields["status"] != want[i].status ||
+			e.Fields["action"] != "PUT /network-profile" || params["active"] != "3g" {
+			t.Errorf("audit event %d = %+v, want actor %s and status %v", i, e.Fields, want[i].actor, want[i].status)
+		}
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	tracker := health.NewTracker(createTestLogger())
+	tracker.MarkReady()
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Health: tracker}, createTestLogger())
+	handler := srv.loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	srv.StartMaintenance(time.Now().Add(90 * time.Second))
+	for _, path := range []string{"/playlist.m3u8", "/variant/0/playlist.m3u8", "/manifest.mpd"} {
+		w := get(path)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: Expected status 503 during maintenance, got %d", path, w.Code)
+		}
+		if ra := w.Header().Get("Retry-After"); ra != "90" && ra != "89" {
+			t.Errorf("%s: Retry-After = %q, want about 90", path, ra)
+		}
+	}
+	if w := get("/health"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected /health to keep working, got %d", w.Code)
+	}
+	if st := tracker.Status(); st.State != health.StateDegraded || st.Reasons[0].Code != health.ReasonMaintenance {
+		t.Errorf("health status = %+v, want degraded by maintenance", st)
+	}
+
+	srv.EndMaintenance()
+	if w := get("/playlist.m3u8"); w.Code != http.StatusNoContent || w.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected normal service after maintenance, got %d", w.Code)
+	}
+	if st := tracker.Status(); st.State != health.StateReady {
+		t.Errorf("health state = %s, want ready", st.State)
+	}
+
+	// A window that has passed no longer applies
+	srv.StartMaintenance(time.Now().Add(-time.Second))
+	if w := get("/playlist.m3u8"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected normal service after the window, got %d", w.Code)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mirror.New(context.Background(), storage.NewDisk(dir))
+	if err != nil {
+		t.Fatalf("mirror.New() error = %v", err)
+	}
+	lp := createTestPlaylist(t)
+	srv := NewWithOptions(lp, Options{Port: 8080, Mirror: m}, createTestLogger())
+	handler := srv.loggingMiddleware(http.HandlerFunc(srv.handlePlaylist))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/playlist.m3u8?token=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, mirror.IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e mirror.Entry
+	if err := json.Unmarshal(index, &e); err != nil {
+		t.Fatalf("index = %q: %v", index, err)
+	}
+	if e.Path != "/playlist.m3u8" || e.Query != "token=1" || e.Status != http.StatusOK || e.Header.Get("Content-Type") != hlsContentType {
+		t.Errorf("mirrored entry = %+v", e)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(e.File)+".body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != w.Body.String() {
+		t.Errorf("mirrored body = %q, want what was served, %q", body, w.Body.String())
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	build := buildinfo.Info{Version: "1.2.3", Commit: "abc1234", Date: "2026-10-15T12:00:00Z", GoVersion: "go1.22.2", Features: []string{"dash"}}
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Build: build}, createTestLogger())
+
+	w := httptest.NewRecorder()
+	srv.handleVersion(w, httptest.NewRequest("GET", "/version", nil))
+	var got map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+	for key, want := range map[string]any{"version": "1.2.3", "commit": "abc1234", "build_date": "2026-10-15T12:00:00Z", "go_version": "go1.22.2"} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+	if features, _ := got["features"].([]any); len(features) != 1 || features[0] != "dash" {
+		t.Errorf("features = %v, want [dash]", got["features"])
+	}
+	if _, ok := got["uptime_seconds"].(float64); !ok {
+		t.Errorf("uptime_seconds missing: %v", got)
+	}
+
+	// The build is also reported by /health
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	if !strings.Contains(w.Body.String(), `"commit":"abc1234"`) {
+		t.Errorf("Expected the build in /health: %s", w.Body.String())
+	}
+
+	// Without Options.Build, the binary's own build is reported
+	srv = NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Version: "2.0.0"}, createTestLogger())
+	w = httptest.NewRecorder()
+	srv.handleVersion(w, httptest.NewRequest("GET", "/version", nil))
+	if !strings.Contains(w.Body.String(), `"version":"2.0.0"`) || !strings.Contains(w.Body.String(), `"features":[]`) ||
+		!strings.Contains(w.Body.String(), `"experimental":{"delta-updates":false,"ll-hls":false}`) {
+		t.Errorf("default build = %s", w.Body.String())
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Tenants: tenant.NewRegistry(nil)}, createTestLogger())
+	handler := srv.loggingMiddleware(srv.routes())
+
+	// The document is served without an API key
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /openapi.json = %d %v", w.Code, w.Header())
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if spec.OpenAPI == "" {
+		t.Error("Expected the openapi version to be set")
+	}
+
+	// Every operation is routed with its method, and every endpoint class
+	// is documented
+	params := regexp.MustCompile(`\{[^}]+\}`)
+	classes := map[string]bool{"other": true}
+	routes := srv.routes()
+	for path, ops := range spec.Paths {
+		path = params.ReplaceAllString(path, "0")
+		classes[handlerName(path)] = true
+
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, httptest.NewRequest("OPTIONS", path, nil))
+		allow := strings.Split(w.Header().Get("Allow"), ", ")
+		for method := range ops {
+			if !slices.Contains(allow, strings.ToUpper(method)) {
+				t.Errorf("%s %s is documented but not routed (Allow: %v)", strings.ToUpper(method), path, allow)
+			}
+		}
+	}
+	for _, class := range EndpointClasses() {
+		if !classes[class] {
+			t.Errorf("endpoint class %q is not documented", class)
+		}
+	}
+}
+
+func TestOpenAPI_Client(t *testing.T) {
+	profiles, err := faults.ParseProfiles([]byte("profiles:\n  - name: slow\n    throughput: 80kbps\n"))
+	if err != nil {
+		t.Fatalf("ParseProfiles() error = %v", err)
+	}
+	srv := NewWithOptions(createTestPlaylist(t), Options{
+		Port:   8080,
+		Events: events.NewLog(0),
+		Shaper: faults.NewShaper(profiles, 1),
+		Admin:  admin.NewTokens([]admin.Token{{Name: "alice", Secret: "secret", Role: admin.RoleOperator}}),
+	}, createTestLogger())
+	ts := httptest.NewServer(srv.loggingMiddleware(srv.routes()))
+	defer ts.Close()
+
+	c, err := client.New(ts.URL)
+	if err != nil {
+		t.Fatalf("client.New() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if got, err := c.VariantPlaylist(ctx, 0, client.VariantQuery{}); err != nil || !strings.HasPrefix(string(got), "#EXTM3U") {
+		t.Errorf("VariantPlaylist() = %q, %v", got, err)
+	}
+	if got, err := c.VODVariantPlaylist(ctx, 0); err != nil || !strings.HasSuffix(string(got), "#EXT-X-ENDLIST\n") {
+		t.Errorf("VODVariantPlaylist() = %q, %v", got, err)
+	}
+	if h, err := c.Health(ctx); err != nil || h.Stats["window_size"] != float64(3) {
+		t.Errorf("Health() = %+v, %v", h, err)
+	}
+	if _, err := c.Version(ctx); err != nil {
+		t.Errorf("Version() error = %v", err)
+	}
+
+	// Admin endpoints need the token
+	var apiErr *client.Error
+	if _, err := c.SetNetworkProfile(ctx, "slow"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("SetNetworkProfile() without a token error = %v, want 401", err)
+	}
+	c.AdminToken = "secret"
+	if np, err := c.SetNetworkProfile(ctx, "slow"); err != nil || np.Active != "slow" {
+		t.Errorf("SetNetworkProfile() = %+v, %v", np, err)
+	}
+	e, err := c.Events(ctx, 0, EventNetworkProfile)
+	if err != nil || len(e.Events) != 1 || e.Last == 0 {
+		t.Errorf("Events() = %+v, %v", e, err)
+	}
+	if _, err := c.ClusterStatus(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotImplemented {
+		t.Errorf("ClusterStatus() without cluster mode error = %v, want 501", err)
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	lp := createTestPlaylist(t)
+	log := events.NewLog(0)
+	log.Publish("first", "one", nil)
+	log.Publish("second", "two", map[string]any{"step": 2})
+	srv := NewWithOptions(lp, Options{Port: 8080, Events: log}, createTestLogger())
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCode  int
+		wantTypes []string
+	}{
+		{"all", "", http.StatusOK, []string{"first", "second"}},
+		{"since", "?since=1", http.StatusOK, []string{"second"}},
+		{"type", "?type=first", http.StatusOK, []string{"first"}},
+		{"invalid since", "?since=x", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.handleEvents(w, httptest.NewRequest("GET", "/events"+tt.query, nil))
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Events []events.Event `json:"events"`
+				Last   uint64         `json:"last"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Last != 2 {
+				t.Errorf("Expected last 2, got %d", resp.Last)
+			}
+			if len(resp.Events) != len(tt.wantTypes) {
+				t.Fatalf("Expected %d events, got %d", len(tt.wantTypes), len(resp.Events))
+			}
+			for i, e := range resp.Events {
+				if e.Type != tt.wantTypes[i] {
+					t.Errorf("Event %d: expected type %q, got %q", i, tt.wantTypes[i], e.Type)
+				}
+			}
+		})
+	}
+
+	// Without an event log the endpoint is disabled
+	w := httptest.NewRecorder()
+	New(lp, 8080, createTestLogger()).handleEvents(w, httptest.NewRequest("GET", "/events", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501 without an event log, got %d", w.Code)
+	}
+}
+
 func TestHandleHealth(t *testing.T) {
 	lp := createTestPlaylist(t)
 	logger := createTestLogger()
@@ -177,8 +1614,11 @@ func TestHandleHealth(t *testing.T) {
 	}
 
 	// Check status field
-	if health["status"] != "ok" {
-		t.Errorf("Expected status 'ok', got '%v'", health["status"])
+	if health["status"] != "ready" {
+		t.Errorf("Expected status 'ready', got '%v'", health["status"])
+	}
+	if reasons, ok := health["reasons"].([]any); !ok || len(reasons) != 0 {
+		t.Errorf("Expected an empty reasons list, got %v", health["reasons"])
 	}
 
 	// Check stats field exists
@@ -192,7 +1632,7 @@ func TestHandleHealth(t *testing.T) {
 		t.Fatal("Stats is not a map")
 	}
 
-	expectedFields := []string{"variant_count", "window_size", "sequence_number", "target_duration", "is_master"}
+	expectedFields := []string{"variant_count", "window_size", "sequence_number", "target_duration", "is_master", "connections"}
 	for _, field := range expectedFields {
 		if _, ok := stats[field]; !ok {
 			t.Errorf("Stats missing field '%s'", field)
@@ -200,6 +1640,90 @@ func TestHandleHealth(t *testing.T) {
 	}
 }
 
+func TestHandleHealth_States(t *testing.T) {
+	lp := createTestPlaylist(t)
+	logger := createTestLogger()
+
+	tests := []struct {
+		name        string
+		setup       func(*health.Tracker)
+		wantStatus  string
+		wantCode    int
+		wantReasons []string
+	}{
+		{
+			name:       "starting",
+			setup:      func(*health.Tracker) {},
+			wantStatus: "starting",
+			wantCode:   http.StatusServiceUnavailable,
+		},
+		{
+			name:       "ready",
+			setup:      func(tr *health.Tracker) { tr.MarkReady() },
+			wantStatus: "ready",
+			wantCode:   http.StatusOK,
+		},
+		{
+			name: "degraded",
+			setup: func(tr *health.Tracker) {
+				tr.MarkReady()
+				tr.Set(health.ReasonQuorumLost, "no Raft leader")
+				tr.Set(health.ReasonAdvanceStalled, "media sequence stuck")
+			},
+			wantStatus:  "degraded",
+			wantCode:    http.StatusOK,
+			wantReasons: []string{"advance_stalled", "quorum_lost"},
+		},
+		{
+			name: "stopping",
+			setup: func(tr *health.Tracker) {
+				tr.MarkReady()
+				tr.MarkStopping()
+			},
+			wantStatus: "stopping",
+			wantCode:   http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := health.NewTracker(logger)
+			tt.setup(tracker)
+			srv := NewWithOptions(lp, Options{Port: 8080, Health: tracker}, logger)
+
+			w := httptest.NewRecorder()
+			srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status code %d, got %d", tt.wantCode, w.Code)
+			}
+			var resp struct {
+				Status  string `json:"status"`
+				Reasons []struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"reasons"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to parse JSON response: %v", err)
+			}
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Expected status %q, got %q", tt.wantStatus, resp.Status)
+			}
+			var codes []string
+			for _, r := range resp.Reasons {
+				codes = append(codes, r.Code)
+				if r.Message == "" {
+					t.Errorf("Expected a message for reason %s", r.Code)
+				}
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.wantReasons, ",") {
+				t.Errorf("Expected reasons %v, got %v", tt.wantReasons, codes)
+			}
+		})
+	}
+}
+
 func TestHandleHealth_WithAdvancedPlaylist(t *testing.T) {
 	lp := createTestPlaylist(t)
 	logger := createTestLogger()
@@ -297,6 +1821,186 @@ func TestServer_Integration(t *testing.T) {
 	}
 }
 
+func TestHandleMetrics(t *testing.T) {
+	lp := createTestPlaylist(t)
+	logger := createTestLogger()
+	srv := NewWithOptions(lp, Options{Port: 8080, Version: "9.9.9"}, logger)
+	lp.Advance()
+
+	// Requests are counted through the middleware
+	handler := srv.loggingMiddleware(http.HandlerFunc(srv.handleVariantPlaylist))
+	for _, path := range []string{"/variant/0/playlist.m3u8", "/variant/7/playlist.m3u8"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	resp := w.Result()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus text Content-Type, got %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`encodersim_build_info{version="9.9.9",metrics_version="1"} 1`,
+		`encodersim_http_requests_total{handler="variant",code="200"} 1`,
+		`encodersim_http_requests_total{handler="variant",code="404"} 1`,
+		"encodersim_media_sequence 1\n",
+		"encodersim_window_segments 3\n",
+		"encodersim_target_duration_seconds 10\n",
+		`encodersim_variant_segments{variant="0"} 5`,
+		`encodersim_variant_position{variant="0"} 1`,
+		`encodersim_variant_bandwidth_bits_per_second{variant="0"} 1e+06`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "encodersim_cluster_leader") {
+		t.Error("Expected no cluster metric outside cluster mode")
+	}
+}
+
+func TestHandleMetrics_PlayerProbe(t *testing.T) {
+	lp := createTestPlaylist(t)
+	logger := createTestLogger()
+	srv := NewWithOptions(lp, Options{Port: 8080, Player: player.New(player.Options{}, logger)}, logger)
+
+	req := httptest.NewRequest("GET", "/variant/0/playlist.m3u8", nil)
+	req.Header.Set("User-Agent", player.UserAgent)
+	srv.handleVariantPlaylist(httptest.NewRecorder(), req)
+	if got := srv.VariantRequests()[0]; got != 0 {
+		t.Errorf("Expected probe requests not to be counted, got %d", got)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"encodersim_player_playlist_fetches_total 0\n",
+		`encodersim_player_anomalies_total{kind="stale_playlist"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	if !strings.Contains(w.Body.String(), `"player_probe"`) {
+		t.Errorf("Expected player_probe stats in health, got %s", w.Body.String())
+	}
+}
+
+func TestHandleMetrics_CDNPrime(t *testing.T) {
+	edgeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("segment"))
+	}))
+	defer edgeServer.Close()
+	edge, err := prime.ParseEdge(edgeServer.URL + "/cdn")
+	if err != nil {
+		t.Fatalf("ParseEdge() error = %v", err)
+	}
+
+	lp := createTestPlaylist(t)
+	logger := createTestLogger()
+	primer := prime.New(lp, prime.Options{Edge: edge, Interval: 5 * time.Millisecond}, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primer.Run(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(primer.Fills()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	srv := NewWithOptions(lp, Options{Port: 8080, Primer: primer}, logger)
+	w := httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		`encodersim_cdn_prime_duration_seconds_count{playlist="variant/0"} 1`,
+		`encodersim_cdn_prime_errors_total{playlist="variant/0"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	if !strings.Contains(w.Body.String(), `"cdn_prime"`) {
+		t.Errorf("Expected cdn_prime stats in health, got %s", w.Body.String())
+	}
+}
+
+func TestHandleMetrics_Budget(t *testing.T) {
+	b, err := budget.New(budget.Limits{CacheBytes: 1000})
+	if err != nil {
+		t.Fatalf("budget.New() error = %v", err)
+	}
+	if err := b.ReserveCache("test", 400); err != nil {
+		t.Fatalf("ReserveCache() error = %v", err)
+	}
+
+	srv := NewWithOptions(createTestPlaylist(t), Options{Port: 8080, Budget: b}, createTestLogger())
+	w := httptest.NewRecorder()
+	srv.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	for _, want := range []string{
+		"encodersim_cache_bytes 400",
+		"encodersim_cache_limit_bytes 1000",
+		"encodersim_cache_headroom_bytes 600",
+		"encodersim_memory_used_bytes ",
+		`encodersim_budget_refused_total{resource="channels"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest("GET", "/health", nil))
+	if !strings.Contains(w.Body.String(), `"cache_limit_bytes":1000`) {
+		t.Errorf("Expected budget stats in health, got %s", w.Body.String())
+	}
+}
+
+func TestHandlerName(t *testing.T) {
+	tests := map[string]string{
+		"/playlist.m3u8":             "playlist",
+		"/variant/3/playlist.m3u8":   "variant",
+		"/variant/garbage":           "variant",
+		"/vod/playlist.m3u8":         "vod",
+		"/startover/playlist.m3u8":   "startover",
+		"/keys/7":                    "keys",
+		"/rendition/1/playlist.m3u8": "rendition",
+		"/health":                    "health",
+		"/cluster/status":            "cluster_status",
+		"/metrics":                   "metrics",
+		"/events":                    "events",
+		"/manifest.mpd":              "manifest",
+		"/smooth/Manifest":           "smooth",
+		"/preview":                   "preview",
+		"/subtitles/3.vtt":           "subtitles",
+		"/network-profile":           "network_profile",
+		"/admin/reload":              "reload",
+		"/connections":               "connections",
+		"/version":                   "version",
+		"/openapi.json":              "openapi",
+		"/favicon.ico":               "other",
+	}
+	for path, want := range tests {
+		if got := handlerName(path); got != want {
+			t.Errorf("handlerName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
 func TestHandlePlaylist_MultipleRequests(t *testing.T) {
 	lp := createTestPlaylist(t)
 	logger := createTestLogger()
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert creates a self-signed certificate for 127.0.0.1 and its key in
+// dir, named after name, and returns their paths along with the parsed
+// certificate. It is its own CA, so it can also verify itself as a client
+// certificate.
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "encodersim-test-" + name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	return certFile, keyFile, cert
+}
+
+func TestLoadTLSConfig_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey, serverX509 := writeCert(t, dir, "server")
+	clientCert, clientKey, _ := writeCert(t, dir, "client")
+
+	cfg, err := LoadTLSConfig(serverCert, serverKey, clientCert)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig() error = %v", err)
+	}
+	srv := New(createTestPlaylist(t), 8080, createTestLogger())
+	ts := httptest.NewUnstartedServer(srv.routes())
+	ts.TLS = cfg
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverX509)
+	client, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("LoadX509KeyPair() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{"with client certificate", []tls.Certificate{client}, false},
+		{"without client certificate", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: tt.certs}}}
+			resp, err := c.Get(ts.URL + "/playlist.m3u8")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("Expected status 200, got %d", resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadTLSConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeCert(t, dir, "server")
+
+	emptyCA := filepath.Join(dir, "empty.crt")
+	if err := os.WriteFile(emptyCA, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name                            string
+		certFile, keyFile, clientCAFile string
+	}{
+		{name: "cert without key", certFile: certFile},
+		{name: "key without cert", keyFile: keyFile},
+		{name: "client CA without cert", clientCAFile: certFile},
+		{name: "missing cert file", certFile: filepath.Join(dir, "missing.crt"), keyFile: keyFile},
+		{name: "missing client CA file", certFile: certFile, keyFile: keyFile, clientCAFile: filepath.Join(dir, "missing.crt")},
+		{name: "client CA file without certificates", certFile: certFile, keyFile: keyFile, clientCAFile: emptyCA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadTLSConfig(tt.certFile, tt.keyFile, tt.clientCAFile); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	if cfg, err := LoadTLSConfig("", "", ""); cfg != nil || err != nil {
+		t.Errorf("LoadTLSConfig() with no files = %v, %v; want nil, nil", cfg, err)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		port int
+		host string
+		want string
+	}{
+		{8443, "example.com:8080", "https://example.com:8443/variant/0/playlist.m3u8?api_key=k"},
+		{8443, "example.com", "https://example.com:8443/variant/0/playlist.m3u8?api_key=k"},
+		{443, "example.com:80", "https://example.com/variant/0/playlist.m3u8?api_key=k"},
+		{443, "[::1]:80", "https://[::1]/variant/0/playlist.m3u8?api_key=k"},
+		{8443, "[::1]", "https://[::1]:8443/variant/0/playlist.m3u8?api_key=k"},
+	}
+	for _, tt := range tests {
+		srv := New(createTestPlaylist(t), tt.port, createTestLogger())
+		r := httptest.NewRequest("PUT", "/variant/0/playlist.m3u8?api_key=k", nil)
+		r.Host = tt.host
+		w := httptest.NewRecorder()
+		srv.redirectHTTPS(w, r)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("redirect of %s to port %d = %d %s, want 308 %s", tt.host, tt.port, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
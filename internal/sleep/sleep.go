@@ -0,0 +1,24 @@
+// Package sleep provides a sleep that ends early when its context is done,
+// for the waits of the server, scenarios, the load generator and replays.
+package sleep
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep waits for d, or until ctx is done, in which case it returns
+// ctx.Err(). A d of zero or less does not wait.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
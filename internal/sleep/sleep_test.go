@@ -0,0 +1,32 @@
+package sleep
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSleep(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		d       time.Duration
+		wantErr error
+	}{
+		{"elapses", context.Background(), time.Millisecond, nil},
+		{"zero", context.Background(), 0, nil},
+		{"canceled", canceled, time.Hour, context.Canceled},
+		{"zero canceled", canceled, 0, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Sleep(tt.ctx, tt.d); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Sleep() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
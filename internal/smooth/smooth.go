@@ -0,0 +1,227 @@
+// Package smooth renders the looping segment window as a live Microsoft
+// Smooth Streaming client manifest, for legacy set-top boxes.
+//
+// Smooth Streaming addresses fragments by bitrate and start time rather
+// than by URL, and has no equivalent of DASH Periods. The manifest places
+// the window on the continuous DASH stream timeline (see dash.Periods), and
+// the server redirects each fragment request to the HLS segment that starts
+// at the requested time. Support is best-effort: the segments are served as
+// they are, without the tfxd/tfrf boxes or CodecPrivateData some clients
+// expect.
+package smooth
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/dash"
+)
+
+// Timescale is the number of manifest time units per second.
+const Timescale = 10_000_000
+
+// FragmentURL is the StreamIndex URL template, relative to the manifest.
+const FragmentURL = "QualityLevels({bitrate})/Fragments(video={start time})"
+
+// QualityLevel is one variant of a manifest.
+type QualityLevel struct {
+	Bitrate int
+	Width   int // 0 if unknown
+	Height  int // 0 if unknown
+	Codecs  string
+}
+
+// Chunk is one fragment on the stream timeline, in Timescale units.
+type Chunk struct {
+	Time     uint64
+	Duration uint64
+}
+
+// Manifest holds what a live Smooth Streaming manifest is rendered from.
+type Manifest struct {
+	// QualityLevels must have distinct bitrates, which select them in
+	// fragment URLs.
+	QualityLevels []QualityLevel
+
+	// Chunks are the fragments of the window, shared by all quality levels.
+	Chunks []Chunk
+}
+
+// Chunks places the segments of periods on the continuous stream timeline.
+func Chunks(periods []dash.Period) []Chunk {
+	var chunks []Chunk
+	for _, p := range periods {
+		for _, seg := range p.Segments {
+			chunks = append(chunks, Chunk{
+				Time:     (p.Start + seg.Time) * (Timescale / dash.Timescale),
+				Duration: seg.Duration * (Timescale / dash.Timescale),
+			})
+		}
+	}
+	return chunks
+}
+
+// ParseFragmentPath parses a fragment path, relative to the manifest, built
+// from FragmentURL, such as "QualityLevels(2000000)/Fragments(video=0)".
+func ParseFragmentPath(path string) (bitrate int, start uint64, err error) {
+	levels, fragments, ok := strings.Cut(path, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid fragment path %q", path)
+	}
+	b, ok := between(levels, "QualityLevels(", ")")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quality level in %q", path)
+	}
+	t, ok := between(fragments, "Fragments(video=", ")")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid fragment in %q", path)
+	}
+	bitrate, err = strconv.Atoi(b)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid bitrate in %q: %w", path, err)
+	}
+	start, err = strconv.ParseUint(t, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start time in %q: %w", path, err)
+	}
+	return bitrate, start, nil
+}
+
+// between returns s without prefix and suffix, if it has both.
+func between(s, prefix, suffix string) (string, bool) {
+	s, ok := strings.CutPrefix(s, prefix)
+	if !ok {
+		return "", false
+	}
+	return strings.CutSuffix(s, suffix)
+}
+
+// FourCC returns the Smooth Streaming FourCC of the video codec in an HLS
+// CODECS string, or "" if it has none that Smooth Streaming knows.
+func FourCC(codecs string) string {
+	for _, c := range strings.Split(codecs, ",") {
+		switch codec, _, _ := strings.Cut(strings.TrimSpace(c), "."); codec {
+		case "avc1", "avc3":
+			return "AVC1"
+		case "hvc1", "hev1":
+			return "HVC1"
+		}
+	}
+	return ""
+}
+
+// Write renders m as a live client manifest with a single video
+// StreamIndex.
+func Write(w io.Writer, m Manifest) error {
+	if len(m.QualityLevels) == 0 {
+		return fmt.Errorf("manifest has no quality levels")
+	}
+	if len(m.Chunks) == 0 {
+		return fmt.Errorf("manifest has no chunks")
+	}
+
+	var window uint64
+	for _, c := range m.Chunks {
+		window += c.Duration
+	}
+
+	index := streamIndex{
+		Type:          "video",
+		Name:          "video",
+		Chunks:        len(m.Chunks),
+		QualityLevels: len(m.QualityLevels),
+		URL:           FragmentURL,
+	}
+	seen := make(map[int]bool)
+	for i, q := range m.QualityLevels {
+		if seen[q.Bitrate] {
+			return fmt.Errorf("quality levels share bitrate %d", q.Bitrate)
+		}
+		seen[q.Bitrate] = true
+		index.MaxWidth = max(index.MaxWidth, q.Width)
+		index.MaxHeight = max(index.MaxHeight, q.Height)
+		index.Levels = append(index.Levels, qualityLevel{
+			Index:     i,
+			Bitrate:   q.Bitrate,
+			FourCC:    FourCC(q.Codecs),
+			MaxWidth:  q.Width,
+			MaxHeight: q.Height,
+		})
+	}
+	for i, c := range m.Chunks {
+		entry := chunk{D: c.Duration}
+		// Only the first chunk needs an explicit start; the others follow
+		// their predecessor unless there is a gap
+		if i == 0 || c.Time != m.Chunks[i-1].Time+m.Chunks[i-1].Duration {
+			t := c.Time
+			entry.T = &t
+		}
+		index.Entries = append(index.Entries, entry)
+	}
+
+	doc := smoothStreamingMedia{
+		MajorVersion:    2,
+		MinorVersion:    2,
+		TimeScale:       Timescale,
+		IsLive:          "TRUE",
+		LookAheadCount:  0,
+		DVRWindowLength: window,
+		StreamIndex:     index,
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// The client manifest, as far as encodersim uses it.
+type (
+	smoothStreamingMedia struct {
+		XMLName         xml.Name    `xml:"SmoothStreamingMedia"`
+		MajorVersion    int         `xml:"MajorVersion,attr"`
+		MinorVersion    int         `xml:"MinorVersion,attr"`
+		TimeScale       int         `xml:"TimeScale,attr"`
+		Duration        uint64      `xml:"Duration,attr"`
+		IsLive          string      `xml:"IsLive,attr"`
+		LookAheadCount  int         `xml:"LookAheadFragmentCount,attr"`
+		DVRWindowLength uint64      `xml:"DVRWindowLength,attr"`
+		StreamIndex     streamIndex `xml:"StreamIndex"`
+	}
+
+	streamIndex struct {
+		Type          string         `xml:"Type,attr"`
+		Name          string         `xml:"Name,attr"`
+		Chunks        int            `xml:"Chunks,attr"`
+		QualityLevels int            `xml:"QualityLevels,attr"`
+		URL           string         `xml:"Url,attr"`
+		MaxWidth      int            `xml:"MaxWidth,attr,omitempty"`
+		MaxHeight     int            `xml:"MaxHeight,attr,omitempty"`
+		Levels        []qualityLevel `xml:"QualityLevel"`
+		Entries       []chunk        `xml:"c"`
+	}
+
+	qualityLevel struct {
+		Index     int    `xml:"Index,attr"`
+		Bitrate   int    `xml:"Bitrate,attr"`
+		FourCC    string `xml:"FourCC,attr,omitempty"`
+		MaxWidth  int    `xml:"MaxWidth,attr,omitempty"`
+		MaxHeight int    `xml:"MaxHeight,attr,omitempty"`
+	}
+
+	chunk struct {
+		T *uint64 `xml:"t,attr,omitempty"`
+		D uint64  `xml:"d,attr"`
+	}
+)
@@ -0,0 +1,136 @@
+package smooth
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/dash"
+	"github.com/agleyzer/encodersim/internal/segment"
+)
+
+func TestChunks(t *testing.T) {
+	segments := []segment.Segment{{URL: "a", Duration: 2}, {URL: "b", Duration: 2}, {URL: "c", Duration: 2}}
+	// Window [c | a b] spans the loop point of the pass starting at 3
+	periods, err := dash.Periods(dash.Window{Segments: segments, Position: 2, Size: 3, FirstSequence: 2})
+	if err != nil {
+		t.Fatalf("Periods() error = %v", err)
+	}
+
+	got := Chunks(periods)
+	want := []Chunk{{40_000_000, 20_000_000}, {60_000_000, 20_000_000}, {80_000_000, 20_000_000}}
+	if len(got) != len(want) {
+		t.Fatalf("Chunks() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chunk %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseFragmentPath(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantBitrate int
+		wantStart   uint64
+		wantErr     bool
+	}{
+		{"QualityLevels(2000000)/Fragments(video=60000000)", 2000000, 60000000, false},
+		{"QualityLevels(0)/Fragments(video=0)", 0, 0, false},
+		{"QualityLevels(2000000)", 0, 0, true},
+		{"QualityLevels(x)/Fragments(video=0)", 0, 0, true},
+		{"QualityLevels(1)/Fragments(audio=0)", 0, 0, true},
+		{"QualityLevels(1)/Fragments(video=-1)", 0, 0, true},
+		{"Manifest", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			bitrate, start, err := ParseFragmentPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFragmentPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if bitrate != tt.wantBitrate || start != tt.wantStart {
+				t.Errorf("ParseFragmentPath() = %d, %d, want %d, %d", bitrate, start, tt.wantBitrate, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestFourCC(t *testing.T) {
+	tests := []struct {
+		codecs string
+		want   string
+	}{
+		{"avc1.4d401f,mp4a.40.2", "AVC1"},
+		{"mp4a.40.2, avc3.640028", "AVC1"},
+		{"hvc1.1.6.L93.B0", "HVC1"},
+		{"mp4a.40.2", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := FourCC(tt.codecs); got != tt.want {
+			t.Errorf("FourCC(%q) = %q, want %q", tt.codecs, got, tt.want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b strings.Builder
+	err := Write(&b, Manifest{
+		QualityLevels: []QualityLevel{
+			{Bitrate: 1000000, Width: 640, Height: 360, Codecs: "avc1.4d401e"},
+			{Bitrate: 3000000, Width: 1280, Height: 720, Codecs: "avc1.4d401f"},
+		},
+		Chunks: []Chunk{{40_000_000, 20_000_000}, {60_000_000, 20_000_000}, {90_000_000, 20_000_000}},
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	out := b.String()
+
+	if err := xml.Unmarshal([]byte(out), new(any)); err != nil {
+		t.Fatalf("Write() produced invalid XML: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		`IsLive="TRUE"`,
+		`DVRWindowLength="60000000"`,
+		`Url="QualityLevels({bitrate})/Fragments(video={start time})"`,
+		`MaxWidth="1280" MaxHeight="720"`,
+		`<QualityLevel Index="1" Bitrate="3000000" FourCC="AVC1" MaxWidth="1280" MaxHeight="720"></QualityLevel>`,
+		`<c t="40000000" d="20000000"></c>`,
+		`<c d="20000000"></c>`,
+		// A gap needs an explicit start
+		`<c t="90000000" d="20000000"></c>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("manifest missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWrite_Errors(t *testing.T) {
+	chunks := []Chunk{{0, 20_000_000}}
+	tests := []struct {
+		name string
+		m    Manifest
+	}{
+		{"no quality levels", Manifest{Chunks: chunks}},
+		{"no chunks", Manifest{QualityLevels: []QualityLevel{{Bitrate: 1}}}},
+		{"shared bitrate", Manifest{QualityLevels: []QualityLevel{{Bitrate: 1}, {Bitrate: 1}}, Chunks: chunks}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := Write(&b, tt.m); err == nil {
+				t.Error("Write() error = nil, want an error")
+			}
+			if b.Len() != 0 {
+				t.Errorf("Write() wrote %d bytes before failing", b.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package standby
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// Role is the role a node of a standby pair starts in.
+type Role string
+
+// Roles.
+const (
+	// RolePrimary starts active: it advances the window and streams its
+	// position to the standby.
+	RolePrimary Role = "primary"
+	// RoleStandby starts passive: it follows the primary's position and
+	// takes over when the primary's heartbeats stop.
+	RoleStandby Role = "standby"
+)
+
+// MinSecretLen is the minimum length of the shared secret, in bytes.
+const MinSecretLen = 16
+
+// Config holds the configuration of one node of a standby pair.
+type Config struct {
+	// Role is the role the node starts in.
+	Role Role
+	// Listen is the address (host:port) the node streams its position on
+	// while it is active.
+	Listen string
+	// Peer is the Listen address of the other node, followed while this
+	// node is the standby.
+	Peer string
+	// Secret authenticates the stream. Both nodes must use the same one.
+	Secret []byte
+	// HeartbeatInterval is how often the active node sends its position.
+	HeartbeatInterval time.Duration
+	// FailoverTimeout is how long the standby waits without a valid
+	// heartbeat before it takes over.
+	FailoverTimeout time.Duration
+}
+
+// Validate checks if the configuration is valid and sets defaults.
+func (c *Config) Validate() error {
+	if c.Role != RolePrimary && c.Role != RoleStandby {
+		return fmt.Errorf("role must be %q or %q, got %q", RolePrimary, RoleStandby, c.Role)
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", c.Listen, err)
+	}
+	if _, _, err := net.SplitHostPort(c.Peer); err != nil {
+		return fmt.Errorf("invalid peer address %q: %w", c.Peer, err)
+	}
+
+	if len(c.Secret) < MinSecretLen {
+		return fmt.Errorf("secret must be at least %d bytes, got %d", MinSecretLen, len(c.Secret))
+	}
+
+	// Set defaults
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = 500 * time.Millisecond
+	}
+	if c.FailoverTimeout == 0 {
+		c.FailoverTimeout = 3 * time.Second
+	}
+	if c.FailoverTimeout <= c.HeartbeatInterval {
+		return fmt.Errorf("failover timeout %s must be longer than the heartbeat interval %s", c.FailoverTimeout, c.HeartbeatInterval)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package standby
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The stream is line based. The standby opens the connection and sends a
+// random nonce in hex. The active node then sends one heartbeat per line,
+// as "MAC JSON", where MAC is the hex HMAC-SHA256 of the nonce followed by
+// the JSON under the shared secret. The nonce keeps heartbeats of one
+// connection from being replayed on another, and the increasing counter
+// keeps them from being replayed on the same one.
+
+// nonceLen is the length of the connection nonce, in bytes.
+const nonceLen = 16
+
+// maxFrameLen bounds the length of a heartbeat line.
+const maxFrameLen = 1 << 20
+
+// State is the window position of every variant.
+type State struct {
+	Variants []Position `json:"variants"`
+}
+
+// Position is the window position of one variant.
+type Position struct {
+	Position int    `json:"position"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// heartbeat is the payload of one line of the stream.
+type heartbeat struct {
+	Counter uint64 `json:"counter"`
+	State   State  `json:"state"`
+}
+
+// newNonce returns a random connection nonce.
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return nonce, nil
+}
+
+// parseNonce decodes the nonce line sent by the standby.
+func parseNonce(line string) ([]byte, error) {
+	nonce, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil || len(nonce) != nonceLen {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	return nonce, nil
+}
+
+// sign returns the MAC of payload on the connection with nonce.
+func sign(secret, nonce, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(nonce)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encodeFrame returns the signed line carrying hb, including the newline.
+func encodeFrame(secret, nonce []byte, hb heartbeat) ([]byte, error) {
+	payload, err := json.Marshal(hb)
+	if err != nil {
+		return nil, err
+	}
+	frame := hex.AppendEncode(nil, sign(secret, nonce, payload))
+	frame = append(frame, ' ')
+	frame = append(frame, payload...)
+	return append(frame, '\n'), nil
+}
+
+// decodeFrame checks the MAC of a line and returns its heartbeat.
+func decodeFrame(secret, nonce []byte, line string) (heartbeat, error) {
+	macHex, payload, ok := strings.Cut(strings.TrimSpace(line), " ")
+	if !ok {
+		return heartbeat{}, fmt.Errorf("malformed heartbeat")
+	}
+	mac, err := hex.DecodeString(macHex)
+	if err != nil || !hmac.Equal(mac, sign(secret, nonce, []byte(payload))) {
+		return heartbeat{}, fmt.Errorf("heartbeat failed authentication")
+	}
+	var hb heartbeat
+	if err := json.Unmarshal([]byte(payload), &hb); err != nil {
+		return heartbeat{}, fmt.Errorf("parse heartbeat: %w", err)
+	}
+	return hb, nil
+}
@@ -0,0 +1,254 @@
+// Package standby implements a two-node active/standby pair, a lightweight
+// alternative to Raft cluster mode. The active node advances the window and
+// streams its position to the standby over an authenticated TCP connection;
+// the standby serves the same window and takes over when the heartbeats
+// stop. There is no quorum: if the nodes lose sight of each other while
+// both are running, both end up active.
+package standby
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Window is the part of the playlist a node drives.
+type Window interface {
+	// Position returns the current window position.
+	Position() State
+	// Follow moves the window to a position received from the active node.
+	Follow(State) error
+	// SetStandby stops or resumes advancing the window on its own.
+	SetStandby(bool)
+}
+
+// Node is one node of a standby pair.
+type Node struct {
+	config Config
+	window Window
+	logger *slog.Logger
+	active atomic.Bool
+
+	mu            sync.Mutex
+	lastHeartbeat time.Time
+}
+
+// NewNode creates a node. A standby node stops the window from advancing on
+// its own right away, so that it never serves a position of its own.
+func NewNode(config Config, window Window, logger *slog.Logger) (*Node, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	n := &Node{
+		config: config,
+		window: window,
+		logger: logger.With("component", "standby"),
+	}
+	n.active.Store(config.Role == RolePrimary)
+	window.SetStandby(config.Role == RoleStandby)
+	return n, nil
+}
+
+// Active reports whether the node advances the window itself.
+func (n *Node) Active() bool {
+	return n.active.Load()
+}
+
+// LastHeartbeat returns when the standby last received a valid heartbeat,
+// or the zero time if it never did.
+func (n *Node) LastHeartbeat() time.Time {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.lastHeartbeat
+}
+
+// Run follows the active node until its heartbeats stop, if this node is
+// the standby, and then streams the window position until ctx is done.
+func (n *Node) Run(ctx context.Context) error {
+	if !n.Active() {
+		n.logger.Info("following primary", "peer", n.config.Peer)
+		n.follow(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		n.logger.Warn("primary heartbeat lost, taking over",
+			"peer", n.config.Peer,
+			"timeout", n.config.FailoverTimeout,
+		)
+		n.window.SetStandby(false)
+		n.active.Store(true)
+	}
+	return n.serve(ctx)
+}
+
+// follow applies the active node's heartbeats until none arrives within the
+// failover timeout or ctx is done.
+func (n *Node) follow(ctx context.Context) {
+	last := time.Now()
+	connected := false
+	for {
+		remaining := time.Until(last.Add(n.config.FailoverTimeout))
+		if remaining <= 0 || ctx.Err() != nil {
+			return
+		}
+
+		err := n.receive(ctx, &last, &connected)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			n.logger.Warn("lost connection to primary", "peer", n.config.Peer, "error", err)
+			connected = false
+		} else {
+			n.logger.Debug("primary unreachable", "peer", n.config.Peer, "error", err)
+		}
+
+		retry := time.NewTimer(min(n.config.HeartbeatInterval, time.Until(last.Add(n.config.FailoverTimeout))))
+		select {
+		case <-ctx.Done():
+			retry.Stop()
+			return
+		case <-retry.C:
+		}
+	}
+}
+
+// receive connects to the active node and applies its heartbeats until the
+// connection fails or falls silent. It moves last forward with each valid
+// heartbeat and sets connected after the first one.
+func (n *Node) receive(ctx context.Context, last *time.Time, connected *bool) error {
+	dialer := net.Dialer{Timeout: n.config.HeartbeatInterval}
+	conn, err := dialer.DialContext(ctx, "tcp", n.config.Peer)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(n.config.HeartbeatInterval))
+	if _, err := fmt.Fprintf(conn, "%x\n", nonce); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, maxFrameLen)
+	var counter uint64
+	for {
+		conn.SetReadDeadline(last.Add(n.config.FailoverTimeout))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return errors.New("connection closed by primary")
+		}
+
+		hb, err := decodeFrame(n.config.Secret, nonce, scanner.Text())
+		if err != nil {
+			return err
+		}
+		if hb.Counter <= counter {
+			return fmt.Errorf("heartbeat %d replayed after %d", hb.Counter, counter)
+		}
+		counter = hb.Counter
+
+		*last = time.Now()
+		n.mu.Lock()
+		n.lastHeartbeat = *last
+		n.mu.Unlock()
+		if !*connected {
+			n.logger.Info("connected to primary", "peer", n.config.Peer)
+			*connected = true
+		}
+
+		// A position that cannot be applied still proves the primary is
+		// alive, so it does not count towards a failover
+		if err := n.window.Follow(hb.State); err != nil {
+			n.logger.Warn("failed to follow primary position", "error", err)
+		}
+	}
+}
+
+// serve streams the window position to every standby that connects until
+// ctx is done.
+func (n *Node) serve(ctx context.Context) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", n.config.Listen)
+	if err != nil {
+		return fmt.Errorf("listen for standby: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+	n.logger.Info("streaming window position to standby", "listen", ln.Addr().String())
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept standby connection: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.stream(ctx, conn); err != nil && ctx.Err() == nil {
+				n.logger.Warn("standby stream ended", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+		}()
+	}
+}
+
+// stream sends heartbeats on one standby connection until it fails or ctx
+// is done.
+func (n *Node) stream(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetReadDeadline(time.Now().Add(n.config.FailoverTimeout))
+	line, err := bufio.NewReaderSize(conn, 2*nonceLen+2).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("read nonce: %w", err)
+	}
+	nonce, err := parseNonce(line)
+	if err != nil {
+		return err
+	}
+	n.logger.Info("standby connected", "remote", conn.RemoteAddr().String())
+
+	ticker := time.NewTicker(n.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for counter := uint64(1); ; counter++ {
+		frame, err := encodeFrame(n.config.Secret, nonce, heartbeat{
+			Counter: counter,
+			State:   n.window.Position(),
+		})
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(n.config.FailoverTimeout))
+		if _, err := conn.Write(frame); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package standby
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef")
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"primary", Config{Role: RolePrimary, Listen: ":9100", Peer: "b:9100", Secret: testSecret}, ""},
+		{"standby", Config{Role: RoleStandby, Listen: ":9100", Peer: "a:9100", Secret: testSecret}, ""},
+		{"no role", Config{Listen: ":9100", Peer: "a:9100", Secret: testSecret}, "role"},
+		{"bad listen", Config{Role: RolePrimary, Listen: "9100", Peer: "b:9100", Secret: testSecret}, "listen"},
+		{"bad peer", Config{Role: RolePrimary, Listen: ":9100", Secret: testSecret}, "peer"},
+		{"short secret", Config{Role: RolePrimary, Listen: ":9100", Peer: "b:9100", Secret: []byte("short")}, "secret"},
+		{"timeout", Config{Role: RolePrimary, Listen: ":9100", Peer: "b:9100", Secret: testSecret, FailoverTimeout: 100 * time.Millisecond}, "heartbeat interval"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if tt.config.HeartbeatInterval == 0 || tt.config.FailoverTimeout == 0 {
+					t.Errorf("Expected defaults to be set, got %+v", tt.config)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFrame(t *testing.T) {
+	nonce, err := newNonce()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	hb := heartbeat{Counter: 7, State: State{Variants: []Position{{Position: 3, Sequence: 42}}}}
+	frame, err := encodeFrame(testSecret, nonce, hb)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got, err := decodeFrame(testSecret, nonce, string(frame))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got.Counter != 7 || len(got.State.Variants) != 1 || got.State.Variants[0] != hb.State.Variants[0] {
+		t.Errorf("Expected %+v, got %+v", hb, got)
+	}
+
+	otherNonce, _ := newNonce()
+	tampered := strings.Replace(string(frame), `"sequence":42`, `"sequence":43`, 1)
+	rejected := []struct {
+		name   string
+		secret []byte
+		nonce  []byte
+		line   string
+	}{
+		{"wrong secret", []byte("fedcba9876543210"), nonce, string(frame)},
+		{"other connection", testSecret, otherNonce, string(frame)},
+		{"tampered", testSecret, nonce, tampered},
+		{"no MAC", testSecret, nonce, `{"counter":1}`},
+	}
+	for _, tt := range rejected {
+		if _, err := decodeFrame(tt.secret, tt.nonce, tt.line); err == nil {
+			t.Errorf("%s: expected the heartbeat to be rejected", tt.name)
+		}
+	}
+}
+
+// fakeWindow is a Window that advances on request.
+type fakeWindow struct {
+	mu       sync.Mutex
+	state    State
+	standby  bool
+	followed int
+}
+
+func (w *fakeWindow) Position() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return State{Variants: append([]Position(nil), w.state.Variants...)}
+}
+
+func (w *fakeWindow) Follow(state State) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+	w.followed++
+	return nil
+}
+
+func (w *fakeWindow) SetStandby(standby bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.standby = standby
+}
+
+func (w *fakeWindow) snapshot() (State, bool, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.state, w.standby, w.followed
+}
+
+// freeAddr returns a loopback address with a free port.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestNode_Failover(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	primaryAddr, standbyAddr := freeAddr(t), freeAddr(t)
+	config := func(role Role, listen, peer string, secret []byte) Config {
+		return Config{
+			Role:              role,
+			Listen:            listen,
+			Peer:              peer,
+			Secret:            secret,
+			HeartbeatInterval: 20 * time.Millisecond,
+			FailoverTimeout:   200 * time.Millisecond,
+		}
+	}
+
+	primaryWindow := &fakeWindow{state: State{Variants: []Position{{Position: 4, Sequence: 104}}}}
+	primary, err := NewNode(config(RolePrimary, primaryAddr, standbyAddr, testSecret), primaryWindow, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	standbyWindow := &fakeWindow{}
+	node, err := NewNode(config(RoleStandby, standbyAddr, primaryAddr, testSecret), standbyWindow, logger)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, passive, _ := standbyWindow.snapshot(); !passive || node.Active() {
+		t.Fatal("Expected the standby to start passive")
+	}
+
+	primaryCtx, stopPrimary := context.WithCancel(context.Background())
+	primaryDone := make(chan error, 1)
+	go func() { primaryDone <- primary.Run(primaryCtx) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	standbyDone := make(chan error, 1)
+	go func() { standbyDone <- node.Run(ctx) }()
+
+	// The standby follows the primary's position and stays passive
+	time.Sleep(300 * time.Millisecond)
+	state, passive, followed := standbyWindow.snapshot()
+	if !passive || node.Active() || followed == 0 || len(state.Variants) != 1 || state.Variants[0].Sequence != 104 {
+		t.Fatalf("Expected a passive standby at sequence 104, got passive=%v state=%+v followed=%d", passive, state, followed)
+	}
+	if node.LastHeartbeat().IsZero() {
+		t.Error("Expected a heartbeat time")
+	}
+
+	// The standby takes over once the primary stops
+	stopPrimary()
+	if err := <-primaryDone; err != nil {
+		t.Fatalf("Expected the primary to stop cleanly, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !node.Active() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, passive, _ := standbyWindow.snapshot(); passive || !node.Active() {
+		t.Fatal("Expected the standby to take over")
+	}
+
+	// The new primary streams to a node that rejoins as standby, but not
+	// to one with the wrong secret
+	for _, tt := range []struct {
+		secret []byte
+		want   bool
+	}{{[]byte("fedcba9876543210"), false}, {testSecret, true}} {
+		window := &fakeWindow{}
+		rejoined, err := NewNode(config(RoleStandby, primaryAddr, standbyAddr, tt.secret), window, logger)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		rejoinCtx, stopRejoined := context.WithTimeout(context.Background(), 150*time.Millisecond)
+		rejoined.follow(rejoinCtx)
+		stopRejoined()
+		if _, _, followed := window.snapshot(); (followed > 0) != tt.want {
+			t.Errorf("secret %q: expected following=%v, got %d heartbeats", tt.secret, tt.want, followed)
+		}
+	}
+
+	cancel()
+	if err := <-standbyDone; err != nil {
+		t.Errorf("Expected the standby to stop cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Memory is a Storage in process memory, for tests and for runs that need
+// no persistence.
+type Memory struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+	quota  Quota // nil if unbounded
+}
+
+// Quota bounds the bytes a Memory holds (see Memory.SetQuota).
+// *budget.Budget implements it.
+type Quota interface {
+	// ReserveCache charges n more bytes, describing them by what, or
+	// returns an error if they do not fit.
+	ReserveCache(what string, n int64) error
+
+	// ReleaseCache returns n reserved bytes.
+	ReleaseCache(n int64)
+}
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string][]byte)}
+}
+
+// SetQuota charges the values held from now on to q. Set it before the
+// first Put: values already held are not charged.
+func (m *Memory) SetQuota(q Quota) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quota = q
+}
+
+// Put stores a copy of data under key. With a quota, it fails and keeps the
+// previous value if the quota has no room for the growth.
+func (m *Memory) Put(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quota != nil {
+		growth := int64(len(data) - len(m.values[key]))
+		if growth > 0 {
+			if err := m.quota.ReserveCache(key, growth); err != nil {
+				return err
+			}
+		} else {
+			m.quota.ReleaseCache(-growth)
+		}
+	}
+	m.values[key] = slices.Clone(data)
+	return nil
+}
+
+// Append adds a copy of data to the value stored under key. With a quota,
+// it fails and keeps the value unchanged if the quota has no room for data.
+func (m *Memory) Append(ctx context.Context, key string, data []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quota != nil && len(data) > 0 {
+		if err := m.quota.ReserveCache(key, int64(len(data))); err != nil {
+			return err
+		}
+	}
+	m.values[key] = append(m.values[key], data...)
+	return nil
+}
+
+// Get returns a copy of the value stored under key.
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return slices.Clone(data), nil
+}
+
+// List returns the stored keys that start with prefix, sorted.
+func (m *Memory) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := []string{}
+	for key := range m.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// Delete removes key.
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.quota != nil {
+		m.quota.ReleaseCache(int64(len(m.values[key])))
+	}
+	delete(m.values, key)
+	return nil
+}
+
+// String returns "memory:".
+func (m *Memory) String() string {
+	return "memory:"
+}
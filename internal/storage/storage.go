@@ -0,0 +1,102 @@
+// Package storage is the key-value store behind encodersim's recorded output
+// and caches: source recordings (--record-source, --replay-source), cached
+// source snapshots (--cache-dir), mirrored responses (--mirror) and archived
+// Raft snapshots (--raft-snapshot-archive). Each of them takes a Storage, so a
+// deployment picks the backend with the flag's value instead of being tied
+// to a local directory:
+//
+//	./recordings          a directory on local disk (Disk)
+//	file:///var/cache/es  the same, as a URL
+//	s3://bucket/prefix    an S3 or S3-compatible bucket (S3)
+//	memory:               process memory, gone on exit (Memory)
+//
+// Keys are slash-separated relative paths such as "sources/abc.json". Media
+// segments are never stored; see CLAUDE.md.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned by Get for a key that is not stored.
+var ErrNotFound = errors.New("not found")
+
+// Storage stores values by key. Implementations are safe for concurrent
+// use.
+type Storage interface {
+	// Put stores data under key, replacing any previous value. Readers see
+	// either the old or the new value, never a partial one.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Get returns the value stored under key, or an error wrapping
+	// ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// List returns the keys that start with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes key. Deleting a key that is not stored is not an
+	// error.
+	Delete(ctx context.Context, key string) error
+
+	// String describes where values are stored, for logs and errors.
+	String() string
+}
+
+// Appender is implemented by the Storages that can add to a stored value in
+// place, such as a file opened for appending. Users that grow a value, like
+// the --mirror index, append when they can and Put the whole value
+// otherwise.
+type Appender interface {
+	// Append adds data to the end of the value stored under key, storing
+	// it if key is not stored yet.
+	Append(ctx context.Context, key string, data []byte) error
+}
+
+// Open returns the Storage named by spec: "memory:", an s3:// URL, a
+// file:// URL or a directory path. S3 credentials, region and endpoint are
+// read from the standard AWS environment variables (see S3FromEnv), and its
+// requests are sent with client (http.DefaultClient if nil).
+func Open(spec string, client *http.Client) (Storage, error) {
+	switch {
+	case spec == "":
+		return nil, fmt.Errorf("empty storage location")
+	case spec == "memory:" || spec == "memory://":
+		return NewMemory(), nil
+	case strings.HasPrefix(spec, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(spec, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("storage location %q has no bucket", spec)
+		}
+		cfg, err := S3FromEnv(bucket, prefix, os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Client = client
+		return NewS3(cfg), nil
+	case strings.HasPrefix(spec, "file://"):
+		dir := strings.TrimPrefix(spec, "file://")
+		if dir == "" {
+			return nil, fmt.Errorf("storage location %q has no path", spec)
+		}
+		return NewDisk(dir), nil
+	case strings.Contains(spec, "://"):
+		return nil, fmt.Errorf("unsupported storage location %q (want a directory, file://, s3:// or memory:)", spec)
+	}
+	return NewDisk(spec), nil
+}
+
+// checkKey rejects keys that are not clean relative paths, which could
+// escape a directory or prefix.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+	return nil
+}
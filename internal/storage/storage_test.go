@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/budget"
+)
+
+// testStorage runs the behavior every Storage shares.
+func testStorage(t *testing.T, store Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	if keys, err := store.List(ctx, ""); err != nil || len(keys) != 0 {
+		t.Fatalf("List() of an empty store = %v, %v", keys, err)
+	}
+	if _, err := store.Get(ctx, "missing.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	for key, value := range map[string]string{
+		"a.json":         "first",
+		"sources/b.json": "second",
+		"sources/c body": "third",
+	} {
+		if err := store.Put(ctx, key, []byte(value)); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	if err := store.Put(ctx, "a.json", []byte("replaced")); err != nil {
+		t.Fatalf("Put(a.json) again error = %v", err)
+	}
+	if got, err := store.Get(ctx, "a.json"); err != nil || string(got) != "replaced" {
+		t.Errorf("Get(a.json) = %q, %v, want replaced", got, err)
+	}
+	if got, err := store.Get(ctx, "sources/c body"); err != nil || string(got) != "third" {
+		t.Errorf("Get(sources/c body) = %q, %v, want third", got, err)
+	}
+
+	if keys, err := store.List(ctx, ""); err != nil || !slices.Equal(keys, []string{"a.json", "sources/b.json", "sources/c body"}) {
+		t.Errorf("List() = %v, %v", keys, err)
+	}
+	if keys, err := store.List(ctx, "sources/"); err != nil || !slices.Equal(keys, []string{"sources/b.json", "sources/c body"}) {
+		t.Errorf("List(sources/) = %v, %v", keys, err)
+	}
+
+	if err := store.Delete(ctx, "sources/b.json"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := store.Delete(ctx, "sources/b.json"); err != nil {
+		t.Errorf("Delete() of a deleted key error = %v", err)
+	}
+	if _, err := store.Get(ctx, "sources/b.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(deleted) error = %v, want ErrNotFound", err)
+	}
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../b", "a//b"} {
+		if err := store.Put(ctx, key, nil); err == nil {
+			t.Errorf("Put(%q) succeeded, want invalid key", key)
+		}
+	}
+
+	if appender, ok := store.(Appender); ok {
+		for _, line := range []string{"1\n", "2\n"} {
+			if err := appender.Append(ctx, "log/index.jsonl", []byte(line)); err != nil {
+				t.Fatalf("Append(%q) error = %v", line, err)
+			}
+		}
+		if got, err := store.Get(ctx, "log/index.jsonl"); err != nil || string(got) != "1\n2\n" {
+			t.Errorf("Get() of an appended key = %q, %v", got, err)
+		}
+		if err := appender.Append(ctx, "../escape", nil); err == nil {
+			t.Error("Append(../escape) succeeded, want invalid key")
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestMemory_Quota(t *testing.T) {
+	ctx := context.Background()
+	b, err := budget.New(budget.Limits{CacheBytes: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMemory()
+	m.SetQuota(b)
+
+	if err := m.Put(ctx, "a", []byte("123456")); err != nil {
+		t.Fatalf("Put(a) error = %v", err)
+	}
+	if err := m.Put(ctx, "b", []byte("12345")); !errors.Is(err, budget.ErrExceeded) {
+		t.Errorf("Put(b) over the quota error = %v, want ErrExceeded", err)
+	}
+	if _, err := m.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(b) error = %v, want ErrNotFound", err)
+	}
+
+	// Shrinking a value and deleting one return their bytes
+	if err := m.Put(ctx, "a", []byte("12")); err != nil {
+		t.Fatalf("Put(a) shorter error = %v", err)
+	}
+	if err := m.Put(ctx, "b", []byte("12345678")); err != nil {
+		t.Fatalf("Put(b) after shrinking a error = %v", err)
+	}
+	if err := m.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Stats().CacheBytes; got != 2 {
+		t.Errorf("CacheBytes = %d, want 2", got)
+	}
+
+	// Appending is charged for the bytes added
+	if err := m.Append(ctx, "a", []byte("12345678")); err != nil {
+		t.Fatalf("Append(a) error = %v", err)
+	}
+	if err := m.Append(ctx, "a", []byte("9")); !errors.Is(err, budget.ErrExceeded) {
+		t.Errorf("Append(a) over the quota error = %v, want ErrExceeded", err)
+	}
+	if got, _ := m.Get(ctx, "a"); string(got) != "1212345678" {
+		t.Errorf("Get(a) = %q, want it unchanged by the refused append", got)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	testStorage(t, NewDisk(dir))
+
+	// Values are plain files, and temporary files are not listed
+	if data, err := os.ReadFile(filepath.Join(dir, "sources", "c body")); err != nil || string(data) != "third" {
+		t.Errorf("file of sources/c body = %q, %v", data, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.json.123.tmp"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := NewDisk(dir).List(context.Background(), "a"); err != nil || !slices.Equal(keys, []string{"a.json"}) {
+		t.Errorf("List(a) = %v, %v", keys, err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"./recordings", "./recordings", false},
+		{"file:///var/cache/encodersim", "/var/cache/encodersim", false},
+		{"memory:", "memory:", false},
+		{"s3://bucket/records/run1", "s3://bucket/records/run1/", false},
+		{"s3://bucket", "s3://bucket/", false},
+		{"", "", true},
+		{"s3:///prefix", "", true},
+		{"file://", "", true},
+		{"gs://bucket/prefix", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			store, err := Open(tt.spec, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if err == nil && store.String() != tt.want {
+				t.Errorf("Open(%q) = %s, want %s", tt.spec, store, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	if _, err := Open("s3://bucket/prefix", nil); err == nil {
+		t.Error("Open(s3://) without credentials succeeded")
+	}
+}
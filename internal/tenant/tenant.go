@@ -0,0 +1,214 @@
+// Package tenant shares one encodersim between teams with API keys
+// (--api-keys). Each key belongs to a tenant with its own rate limit,
+// allowed endpoints and metrics label.
+package tenant
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/agleyzer/encodersim/internal/ratelimit"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Header and QueryParam carry the API key of a request. The header takes
+// precedence; the query parameter is for players that cannot set headers.
+const (
+	Header     = "X-API-Key"
+	QueryParam = "api_key"
+)
+
+var (
+	// ErrMissingKey is returned by Registry.Authorize for a request
+	// without an API key.
+	ErrMissingKey = errors.New("API key required")
+
+	// ErrInvalidKey is returned by Registry.Authorize for an unknown key.
+	ErrInvalidKey = errors.New("invalid API key")
+
+	// ErrEndpointDenied is returned by Registry.Authorize when the tenant
+	// may not use the endpoint.
+	ErrEndpointDenied = errors.New("endpoint not allowed for this API key")
+
+	// ErrRateLimited is returned by Registry.Authorize when the tenant
+	// exceeded its rate limit.
+	ErrRateLimited = errors.New("rate limit exceeded")
+)
+
+// Tenant is a team sharing the simulator.
+type Tenant struct {
+	// Name identifies the tenant in logs and in the tenant label of the
+	// metrics.
+	Name string
+
+	// Key is the tenant's API key.
+	Key string
+
+	// Rate limits the tenant's requests per second, with bursts of up to
+	// Burst requests. 0 means unlimited.
+	Rate  float64
+	Burst int
+
+	// Endpoints are the endpoint classes the tenant may use. Empty means
+	// every endpoint.
+	Endpoints []string
+}
+
+// tenantFile is the YAML form of a tenants file.
+type tenantFile struct {
+	Tenants []struct {
+		Name      string   `yaml:"name"`
+		Key       string   `yaml:"key"`
+		Rate      float64  `yaml:"rate"`
+		Burst     int      `yaml:"burst"`
+		Endpoints []string `yaml:"endpoints"`
+	} `yaml:"tenants"`
+}
+
+// Load reads and parses a tenants file.
+func Load(path string) ([]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tenants, nil
+}
+
+// Parse parses YAML tenants:
+//
+//	tenants:
+//	  - name: team-a
+//	    key: 5f1d9c...
+//	    rate: 20                     # requests per second, unlimited if omitted
+//	    burst: 40                    # the rate, rounded up, if omitted
+//	    endpoints: [playlist, variant]   # every endpoint if omitted
+//
+// Names and keys must be unique. Unknown fields are rejected so that typos
+// do not silently lift a limit.
+func Parse(data []byte) ([]Tenant, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var file tenantFile
+	if err := dec.Decode(&file); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("tenants file is empty")
+		}
+		return nil, fmt.Errorf("parse tenants: %w", err)
+	}
+	if len(file.Tenants) == 0 {
+		return nil, fmt.Errorf("no tenants defined")
+	}
+
+	names := make(map[string]bool)
+	keys := make(map[string]bool)
+	tenants := make([]Tenant, 0, len(file.Tenants))
+	for i, f := range file.Tenants {
+		if f.Name == "" {
+			return nil, fmt.Errorf("tenant %d: name is required", i+1)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("tenant %q defined twice", f.Name)
+		}
+		names[f.Name] = true
+		if f.Key == "" {
+			return nil, fmt.Errorf("tenant %q: key is required", f.Name)
+		}
+		if keys[f.Key] {
+			return nil, fmt.Errorf("tenant %q: key is already used by another tenant", f.Name)
+		}
+		keys[f.Key] = true
+		if f.Rate < 0 || math.IsInf(f.Rate, 0) || math.IsNaN(f.Rate) {
+			return nil, fmt.Errorf("tenant %q: rate must be a non-negative number", f.Name)
+		}
+		if f.Burst < 0 {
+			return nil, fmt.Errorf("tenant %q: burst must not be negative", f.Name)
+		}
+
+		tenants = append(tenants, Tenant{
+			Name:      f.Name,
+			Key:       f.Key,
+			Rate:      f.Rate,
+			Burst:     f.Burst,
+			Endpoints: f.Endpoints,
+		})
+	}
+	return tenants, nil
+}
+
+// NewKey returns a random API key, for tenants that encodersim creates
+// itself.
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate API key: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Registry authorizes requests by API key. It is safe for concurrent use.
+type Registry struct {
+	byKey map[string]*bucket
+	now   func() time.Time
+}
+
+// bucket is the token bucket rate limiting one tenant.
+type bucket struct {
+	tenant Tenant
+
+	mu      sync.Mutex
+	limiter *ratelimit.Bucket
+}
+
+// NewRegistry creates a Registry of tenants, each starting with a full
+// burst.
+func NewRegistry(tenants []Tenant) *Registry {
+	r := &Registry{byKey: make(map[string]*bucket), now: time.Now}
+	for _, t := range tenants {
+		r.byKey[t.Key] = &bucket{tenant: t, limiter: ratelimit.NewBucket(t.Rate, t.Burst)}
+	}
+	return r
+}
+
+// Authorize checks a request with key for an endpoint of class and takes
+// it from the tenant's rate limit. It returns the tenant's name, which is
+// set whenever the key is valid, and with ErrRateLimited how long to wait
+// before the next request is allowed.
+func (r *Registry) Authorize(key, class string) (string, time.Duration, error) {
+	if key == "" {
+		return "", 0, ErrMissingKey
+	}
+	b, ok := r.byKey[key]
+	if !ok {
+		return "", 0, ErrInvalidKey
+	}
+	t := b.tenant
+	if len(t.Endpoints) > 0 && !slices.Contains(t.Endpoints, class) {
+		return t.Name, 0, ErrEndpointDenied
+	}
+	if wait := b.take(r.now()); wait > 0 {
+		return t.Name, wait, ErrRateLimited
+	}
+	return t.Name, 0, nil
+}
+
+// take takes one token at now, or returns how long until one is available.
+func (b *bucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limiter.Take(now)
+}
@@ -0,0 +1,132 @@
+package tenant
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tenants, err := Parse([]byte(`
+tenants:
+  - name: team-a
+    key: key-a
+    rate: 2.5
+    endpoints: [playlist, variant]
+  - name: team-b
+    key: key-b
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []Tenant{
+		{Name: "team-a", Key: "key-a", Rate: 2.5, Endpoints: []string{"playlist", "variant"}},
+		{Name: "team-b", Key: "key-b"},
+	}
+	if !reflect.DeepEqual(tenants, want) {
+		t.Errorf("Parse() = %+v, want %+v", tenants, want)
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"empty", "", "is empty"},
+		{"no tenants", "tenants: []", "no tenants"},
+		{"unknown field", "tenants:\n  - name: a\n    key: k\n    limit: 3", "field limit not found"},
+		{"no name", "tenants:\n  - key: k", "name is required"},
+		{"no key", "tenants:\n  - name: a", "key is required"},
+		{"duplicate name", "tenants:\n  - {name: a, key: k1}\n  - {name: a, key: k2}", "defined twice"},
+		{"duplicate key", "tenants:\n  - {name: a, key: k}\n  - {name: b, key: k}", "already used"},
+		{"negative rate", "tenants:\n  - {name: a, key: k, rate: -1}", "rate must be"},
+		{"negative burst", "tenants:\n  - {name: a, key: k, burst: -1}", "burst must not"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.yaml")
+	if err := os.WriteFile(path, []byte("tenants:\n  - {name: a, key: k, rate: -1}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("Load() error = %v, want it prefixed with the path", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+func TestRegistry_Authorize(t *testing.T) {
+	r := NewRegistry([]Tenant{
+		{Name: "team-a", Key: "key-a", Endpoints: []string{"playlist"}},
+		{Name: "team-b", Key: "key-b"},
+	})
+
+	tests := []struct {
+		key, class string
+		wantTenant string
+		wantErr    error
+	}{
+		{"", "playlist", "", ErrMissingKey},
+		{"key-c", "playlist", "", ErrInvalidKey},
+		{"key-a", "playlist", "team-a", nil},
+		{"key-a", "variant", "team-a", ErrEndpointDenied},
+		{"key-b", "variant", "team-b", nil},
+	}
+	for _, tt := range tests {
+		tenant, _, err := r.Authorize(tt.key, tt.class)
+		if tenant != tt.wantTenant || !errors.Is(err, tt.wantErr) {
+			t.Errorf("Authorize(%q, %q) = %q, %v, want %q, %v", tt.key, tt.class, tenant, err, tt.wantTenant, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistry_RateLimit(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := NewRegistry([]Tenant{{Name: "team-a", Key: "key-a", Rate: 2, Burst: 3}})
+	r.now = func() time.Time { return now }
+
+	// The full burst is available up front
+	for i := 0; i < 3; i++ {
+		if _, _, err := r.Authorize("key-a", "playlist"); err != nil {
+			t.Fatalf("request %d: Authorize() error = %v", i, err)
+		}
+	}
+	_, wait, err := r.Authorize("key-a", "playlist")
+	if !errors.Is(err, ErrRateLimited) || wait != 500*time.Millisecond {
+		t.Fatalf("Authorize() past the burst = %v, %v, want %v, 500ms", wait, err, ErrRateLimited)
+	}
+
+	// Tokens refill at the rate
+	now = now.Add(500 * time.Millisecond)
+	if _, _, err := r.Authorize("key-a", "playlist"); err != nil {
+		t.Errorf("Authorize() after refill error = %v", err)
+	}
+	if _, _, err := r.Authorize("key-a", "playlist"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Authorize() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	// The burst caps the refill
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, _, err := r.Authorize("key-a", "playlist"); err != nil {
+			t.Fatalf("request %d after an hour: Authorize() error = %v", i, err)
+		}
+	}
+	if _, _, err := r.Authorize("key-a", "playlist"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Authorize() error = %v, want %v", err, ErrRateLimited)
+	}
+}
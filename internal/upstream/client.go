@@ -0,0 +1,154 @@
+// Package upstream provides the shared HTTP client used for all requests to
+// origin servers and CDNs.
+package upstream
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Config tunes the connection pool and timeouts used for upstream requests.
+type Config struct {
+	// Timeout bounds an entire request, including reading the body.
+	Timeout time.Duration
+
+	// DialTimeout bounds establishing a TCP connection.
+	DialTimeout time.Duration
+
+	// KeepAlive is the interval between TCP keep-alive probes.
+	KeepAlive time.Duration
+
+	// TLSHandshakeTimeout bounds the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+
+	// ResponseHeaderTimeout bounds waiting for response headers after the
+	// request has been written. Zero means no limit beyond Timeout.
+	ResponseHeaderTimeout time.Duration
+
+	// IdleConnTimeout is how long an idle keep-alive connection is kept.
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns limits idle connections across all hosts.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost limits idle connections kept per host.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits total connections per host. Zero means no limit.
+	MaxConnsPerHost int
+
+	// ProxyURL, if set, routes every upstream request through this proxy
+	// (http, https, socks5 or socks5h scheme) instead of the proxy taken from
+	// the environment. See ParseProxyURL.
+	ProxyURL *url.URL
+
+	// TLSConfig, if set, is used for HTTPS origins, for example to present a
+	// client certificate. See LoadTLSConfig.
+	TLSConfig *tls.Config
+}
+
+// DefaultConfig returns the configuration used when none is specified.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:             30 * time.Second,
+		DialTimeout:         10 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+	}
+}
+
+// Validate checks that the configuration values are usable.
+func (c Config) Validate() error {
+	if c.Timeout < 0 || c.DialTimeout < 0 || c.KeepAlive < 0 || c.TLSHandshakeTimeout < 0 ||
+		c.ResponseHeaderTimeout < 0 || c.IdleConnTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("connection limits must not be negative")
+	}
+	if c.ProxyURL != nil {
+		if err := checkProxyScheme(c.ProxyURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseProxyURL parses an explicit proxy address such as
+// "http://proxy.lab:3128" or "socks5://127.0.0.1:1080".
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+	if err := checkProxyScheme(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// checkProxyScheme reports an error if u uses a scheme the transport cannot
+// proxy through.
+func checkProxyScheme(u *url.URL) error {
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// NewTransport creates an HTTP transport from cfg. Unless cfg.ProxyURL is set,
+// proxies are taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+// variables.
+func NewTransport(cfg Config) *http.Transport {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != nil {
+		proxy = http.ProxyURL(cfg.ProxyURL)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       cfg.TLSConfig,
+	}
+}
+
+// NewClient creates an HTTP client backed by a transport built from cfg.
+// Clients should be created once and shared so connections are reused.
+func NewClient(cfg Config) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(cfg),
+		Timeout:   cfg.Timeout,
+	}
+}
+
+var defaultClient = NewClient(DefaultConfig())
+
+// DefaultClient returns the process-wide client built from DefaultConfig.
+func DefaultClient() *http.Client {
+	return defaultClient
+}
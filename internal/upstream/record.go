@@ -0,0 +1,139 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+// exchange is the metadata of a recorded response. The body is stored next
+// to it under a separate key so recordings stay easy to inspect and edit.
+type exchange struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// exchangeName returns the base file name for a request. Repeated requests
+// for the same method and URL share a name; the last response wins.
+func exchangeName(method, url string) string {
+	sum := sha256.Sum256([]byte(method + " " + url))
+	return hex.EncodeToString(sum[:16])
+}
+
+// recordingTransport saves every response it forwards.
+type recordingTransport struct {
+	next  http.RoundTripper
+	store storage.Storage
+}
+
+// NewRecordingTransport returns a RoundTripper that sends requests through
+// next and saves each response (status, headers and raw body) in store, so
+// the exchange can be replayed offline with NewReplayTransport. Bodies are
+// recorded exactly as received, before any content decoding.
+func NewRecordingTransport(next http.RoundTripper, store storage.Storage) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordingTransport{next: next, store: store}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("record %s: read body: %w", req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	meta, err := json.MarshalIndent(exchange{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+
+	name := exchangeName(req.Method, req.URL.String())
+	if err := t.store.Put(req.Context(), name+".body", body); err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+	if err := t.store.Put(req.Context(), name+".json", meta); err != nil {
+		return nil, fmt.Errorf("record %s: %w", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// replayTransport answers requests from a recording.
+type replayTransport struct {
+	store storage.Storage
+}
+
+// NewReplayTransport returns a RoundTripper that serves responses recorded by
+// NewRecordingTransport from store without touching the network. Requests
+// that were not recorded fail with an error, and so does a store without a
+// recording.
+func NewReplayTransport(ctx context.Context, store storage.Storage) (http.RoundTripper, error) {
+	keys, err := store.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	if !slices.ContainsFunc(keys, func(key string) bool { return strings.HasSuffix(key, ".json") }) {
+		return nil, fmt.Errorf("open recording: no recorded responses in %s", store)
+	}
+	return &replayTransport{store: store}, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	name := exchangeName(req.Method, req.URL.String())
+	meta, err := t.store.Get(req.Context(), name+".json")
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+		}
+		return nil, fmt.Errorf("replay %s: %w", req.URL, err)
+	}
+	var ex exchange
+	if err := json.Unmarshal(meta, &ex); err != nil {
+		return nil, fmt.Errorf("replay %s: %w", req.URL, err)
+	}
+	body, err := t.store.Get(req.Context(), name+".body")
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", req.URL, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+		StatusCode:    ex.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        ex.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,122 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/storage"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("ETag", `"abc"`)
+		io.WriteString(w, "#EXTM3U\n"+r.URL.Path+"\n")
+	}))
+	defer server.Close()
+
+	dir := filepath.Join(t.TempDir(), "recording")
+	recording := &http.Client{Transport: NewRecordingTransport(nil, storage.NewDisk(dir))}
+	for _, path := range []string{"/master.m3u8", "/missing.m3u8"} {
+		resp, err := recording.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("recording GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if path == "/master.m3u8" && string(body) != "#EXTM3U\n/master.m3u8\n" {
+			t.Errorf("recorded client got body %q", body)
+		}
+	}
+
+	// Replay works with the origin gone
+	server.Close()
+	replayer, err := NewReplayTransport(context.Background(), storage.NewDisk(dir))
+	if err != nil {
+		t.Fatalf("NewReplayTransport() error = %v", err)
+	}
+	replaying := &http.Client{Transport: replayer}
+
+	resp, err := replaying.Get(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("replay GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "#EXTM3U\n/master.m3u8\n" {
+		t.Errorf("replayed %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("ETag") != `"abc"` {
+		t.Errorf("replayed headers = %v", resp.Header)
+	}
+
+	// Error responses are replayed as recorded
+	resp, err = replaying.Get(server.URL + "/missing.m3u8")
+	if err != nil {
+		t.Fatalf("replay GET missing: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("replayed status = %d, want 404", resp.StatusCode)
+	}
+
+	// Unrecorded requests fail instead of reaching the network
+	if _, err := replaying.Get(server.URL + "/other.m3u8"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("expected missing recording error, got %v", err)
+	}
+}
+
+func TestNewReplayTransport_MissingDir(t *testing.T) {
+	if _, err := NewReplayTransport(context.Background(), storage.NewDisk(t.TempDir()+"/nope")); err == nil {
+		t.Error("expected error for missing recording directory")
+	}
+}
+
+func TestNewReplayTransport_NotRecording(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplayTransport(context.Background(), storage.NewDisk(dir)); err == nil || !strings.Contains(err.Error(), "no recorded responses") {
+		t.Errorf("expected no recorded responses error, got %v", err)
+	}
+}
+
+func TestRecordAndReplay_Memory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "#EXTM3U\n")
+	}))
+	defer server.Close()
+
+	store := storage.NewMemory()
+	resp, err := (&http.Client{Transport: NewRecordingTransport(nil, store)}).Get(server.URL + "/live.m3u8")
+	if err != nil {
+		t.Fatalf("recording GET: %v", err)
+	}
+	resp.Body.Close()
+	server.Close()
+
+	replayer, err := NewReplayTransport(context.Background(), store)
+	if err != nil {
+		t.Fatalf("NewReplayTransport() error = %v", err)
+	}
+	resp, err = (&http.Client{Transport: replayer}).Get(server.URL + "/live.m3u8")
+	if err != nil {
+		t.Fatalf("replay GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "#EXTM3U\n" {
+		t.Errorf("replayed body %q", body)
+	}
+}
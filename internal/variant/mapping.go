@@ -0,0 +1,71 @@
+package variant
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The variants served are numbered by their position, as in /variant/N/.
+// A mapping from those positions to source variants is identified by the
+// source variants' playlist URLs, which unlike their positions survive a
+// reordered source ladder.
+
+// ParseIndices parses a comma-separated list of variant indices, such as
+// "0,2,4". The order of the list is the order in which they are served.
+func ParseIndices(s string) ([]int, error) {
+	var indices []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(s, ",") {
+		index, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid variant index %q", strings.TrimSpace(field))
+		}
+		if seen[index] {
+			return nil, fmt.Errorf("duplicate variant index %d", index)
+		}
+		seen[index] = true
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// Select returns the variants at indices, in the order of indices.
+func Select(variants []Variant, indices []int) ([]Variant, error) {
+	selected := make([]Variant, len(indices))
+	for i, index := range indices {
+		if index >= len(variants) {
+			return nil, fmt.Errorf("variant index %d out of range: the source has %d variants", index, len(variants))
+		}
+		selected[i] = variants[index]
+	}
+	return selected, nil
+}
+
+// Sources returns the playlist URL of each variant, which identifies the
+// mapping of variants to positions.
+func Sources(variants []Variant) []string {
+	sources := make([]string, len(variants))
+	for i, v := range variants {
+		sources[i] = v.PlaylistURL
+	}
+	return sources
+}
+
+// Arrange returns the variants whose playlist URLs are sources, in the order
+// of sources. It fails if a source is not among the variants.
+func Arrange(variants []Variant, sources []string) ([]Variant, error) {
+	byURL := make(map[string]int, len(variants))
+	for i, v := range variants {
+		byURL[v.PlaylistURL] = i
+	}
+	arranged := make([]Variant, len(sources))
+	for i, source := range sources {
+		index, ok := byURL[source]
+		if !ok {
+			return nil, fmt.Errorf("variant %d (%s) is not in the source", i, source)
+		}
+		arranged[i] = variants[index]
+	}
+	return arranged, nil
+}
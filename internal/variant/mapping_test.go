@@ -0,0 +1,68 @@
+package variant
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseIndices(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr string
+	}{
+		{"0", []int{0}, ""},
+		{"2, 0,1", []int{2, 0, 1}, ""},
+		{"", nil, "invalid variant index"},
+		{"0,x", nil, "invalid variant index"},
+		{"-1", nil, "invalid variant index"},
+		{"1,1", nil, "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseIndices(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseIndices(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("ParseIndices(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectAndArrange(t *testing.T) {
+	variants := []Variant{
+		{PlaylistURL: "low.m3u8"},
+		{PlaylistURL: "mid.m3u8"},
+		{PlaylistURL: "high.m3u8"},
+	}
+
+	selected, err := Select(variants, []int{2, 0})
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if got, want := Sources(selected), []string{"high.m3u8", "low.m3u8"}; !slices.Equal(got, want) {
+		t.Errorf("Select() = %v, want %v", got, want)
+	}
+	if _, err := Select(variants, []int{3}); err == nil {
+		t.Error("Select() out of range should fail")
+	}
+
+	// The mapping follows the URLs when the source ladder is reordered
+	reordered := []Variant{variants[2], variants[1], variants[0]}
+	arranged, err := Arrange(reordered, Sources(selected))
+	if err != nil {
+		t.Fatalf("Arrange() error = %v", err)
+	}
+	if got, want := Sources(arranged), Sources(selected); !slices.Equal(got, want) {
+		t.Errorf("Arrange() = %v, want %v", got, want)
+	}
+	if _, err := Arrange(variants[:2], Sources(selected)); err == nil {
+		t.Error("Arrange() with a missing variant should fail")
+	}
+}
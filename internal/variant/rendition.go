@@ -0,0 +1,76 @@
+package variant
+
+// Rendition types of the EXT-X-MEDIA tags that are looped.
+const (
+	RenditionAudio     = "AUDIO"
+	RenditionSubtitles = "SUBTITLES"
+)
+
+// Rendition represents an alternate rendition (EXT-X-MEDIA) of an HLS master
+// playlist, such as an audio language or a subtitle track, which variants
+// reference by group ID.
+type Rendition struct {
+	// Type is RenditionAudio or RenditionSubtitles
+	Type string
+
+	// GroupID is the group the rendition belongs to
+	GroupID string
+
+	// Name is the human-readable name of the rendition
+	Name string
+
+	// Language is the RFC 5646 language tag (empty if not specified)
+	Language string
+
+	// Default, Autoselect and Forced are the DEFAULT, AUTOSELECT and FORCED
+	// attributes
+	Default    bool
+	Autoselect bool
+	Forced     bool
+
+	// Characteristics is the CHARACTERISTICS attribute (empty if not
+	// specified)
+	Characteristics string
+
+	// Media is the rendition's media playlist. Its PlaylistURL is empty for
+	// renditions without a URI, whose media is in the variant streams.
+	Media Variant
+}
+
+// HasMedia reports whether the rendition has its own media playlist.
+func (r Rendition) HasMedia() bool {
+	return r.Media.PlaylistURL != ""
+}
+
+// Referenced returns the renditions of the groups that variants reference
+// in their Audio and Subtitles attributes, in order.
+func Referenced(renditions []Rendition, variants []Variant) []Rendition {
+	groups := make(map[[2]string]bool)
+	for _, v := range variants {
+		if v.Audio != "" {
+			groups[[2]string{RenditionAudio, v.Audio}] = true
+		}
+		if v.Subtitles != "" {
+			groups[[2]string{RenditionSubtitles, v.Subtitles}] = true
+		}
+	}
+	var referenced []Rendition
+	for _, r := range renditions {
+		if groups[[2]string{r.Type, r.GroupID}] {
+			referenced = append(referenced, r)
+		}
+	}
+	return referenced
+}
+
+// MediaSources returns the media playlist URLs of the renditions that have
+// one, in order.
+func MediaSources(renditions []Rendition) []string {
+	var sources []string
+	for _, r := range renditions {
+		if r.HasMedia() {
+			sources = append(sources, r.Media.PlaylistURL)
+		}
+	}
+	return sources
+}
@@ -0,0 +1,42 @@
+package variant
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReferenced(t *testing.T) {
+	renditions := []Rendition{
+		{Type: RenditionAudio, GroupID: "aac", Name: "English", Media: Variant{PlaylistURL: "en.m3u8"}},
+		{Type: RenditionAudio, GroupID: "ac3", Name: "English", Media: Variant{PlaylistURL: "en-ac3.m3u8"}},
+		{Type: RenditionSubtitles, GroupID: "subs", Name: "French", Media: Variant{PlaylistURL: "fr.m3u8"}},
+		{Type: RenditionAudio, GroupID: "aac", Name: "Commentary"},
+	}
+
+	tests := []struct {
+		name     string
+		variants []Variant
+		want     []string
+	}{
+		{"no groups", []Variant{{}}, nil},
+		{"audio", []Variant{{Audio: "aac"}}, []string{"English", "Commentary"}},
+		{"audio and subtitles", []Variant{{Audio: "ac3"}, {Audio: "aac", Subtitles: "subs"}}, []string{"English", "English", "French", "Commentary"}},
+		{"type must match", []Variant{{Subtitles: "aac"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range Referenced(renditions, tt.variants) {
+				got = append(got, r.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Referenced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	want := []string{"en.m3u8", "en-ac3.m3u8", "fr.m3u8"}
+	if got := MediaSources(renditions); !slices.Equal(got, want) {
+		t.Errorf("MediaSources() = %v, want %v", got, want)
+	}
+}
@@ -17,6 +17,14 @@ type Variant struct {
 	// Empty string if not specified in master playlist
 	Codecs string
 
+	// Audio is the GROUP-ID of the variant's audio renditions (empty if the
+	// master playlist does not reference one)
+	Audio string
+
+	// Subtitles is the GROUP-ID of the variant's subtitle renditions (empty
+	// if the master playlist does not reference one)
+	Subtitles string
+
 	// PlaylistURL is the URL of the variant's media playlist
 	PlaylistURL string
 
@@ -25,4 +33,23 @@ type Variant struct {
 
 	// TargetDuration is the maximum segment duration in seconds
 	TargetDuration int
+
+	// MediaSequence is the EXT-X-MEDIA-SEQUENCE of the source media playlist
+	MediaSequence uint64
+
+	// Version is the EXT-X-VERSION of the source media playlist (3 if the
+	// source does not declare one)
+	Version int
+
+	// MeasuredBandwidth is the peak segment bitrate in bits per second
+	// computed from probed segment sizes (0 if not probed)
+	MeasuredBandwidth int
+
+	// MeasuredAverageBandwidth is the average bitrate in bits per second
+	// computed from probed segment sizes (0 if not probed)
+	MeasuredAverageBandwidth int
+
+	// HeaderTags holds custom tag lines from the media playlist header that
+	// are passed through to the generated playlist
+	HeaderTags []string
 }
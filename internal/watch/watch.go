@@ -0,0 +1,67 @@
+// Package watch reports changes to local source files.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long File waits after the last change event before
+// reporting it. Editors often save a file in several steps.
+const DefaultDebounce = 200 * time.Millisecond
+
+// File calls onChange whenever the file at path is written or replaced,
+// coalescing events that arrive within debounce of each other. The parent
+// directory is watched rather than the file itself, so editors that save by
+// renaming a temporary file over path keep being tracked. File blocks until
+// ctx is cancelled.
+func File(ctx context.Context, path string, debounce time.Duration, onChange func(), logger *slog.Logger) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve watch path: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("watch %s: %w", filepath.Dir(path), err)
+	}
+	logger.Info("watching source file for changes", "path", path)
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != path || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			logger.Debug("source file event", "path", event.Name, "op", event.Op.String())
+			fire = time.After(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("source file watcher error", "error", err)
+
+		case <-fire:
+			fire = nil
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile_ReportsWritesAndReplacements(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fixture.m3u8")
+	if err := os.WriteFile(path, []byte("#EXTM3U\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- File(ctx, path, 20*time.Millisecond, func() { changes <- struct{}{} },
+			slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}()
+
+	// Give the watcher time to register before changing anything
+	time.Sleep(100 * time.Millisecond)
+
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no change reported after %s", what)
+		}
+	}
+
+	// A burst of writes is reported once
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(path, []byte("#EXTM3U\n#EXT-X-VERSION:3\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectChange("write")
+	select {
+	case <-changes:
+		t.Error("expected a burst of writes to be debounced into one change")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Editors that save by renaming a temporary file over the original
+	tmp := filepath.Join(dir, "fixture.m3u8.tmp")
+	if err := os.WriteFile(tmp, []byte("#EXTM3U\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	expectChange("rename")
+
+	// Other files in the directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "other.m3u8"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Error("expected changes to other files to be ignored")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("File() error = %v", err)
+	}
+}
@@ -91,6 +91,14 @@ func (h *ClusterTestHarness) StartHTTPServer(playlistContent string, playlistNam
 // StartCluster starts a cluster with the specified number of nodes.
 func (h *ClusterTestHarness) StartCluster(nodeCount int) error {
 	h.t.Helper()
+	return h.StartClusterWithArgs(nodeCount, nil)
+}
+
+// StartClusterWithArgs starts a cluster with the specified number of nodes,
+// passing the flags returned by nodeArgs (if not nil) to the node with the
+// given zero-based index.
+func (h *ClusterTestHarness) StartClusterWithArgs(nodeCount int, nodeArgs func(node int) []string) error {
+	h.t.Helper()
 
 	if h.playlistURL == "" {
 		h.t.Fatal("StartHTTPServer must be called before StartCluster")
@@ -115,15 +123,18 @@ func (h *ClusterTestHarness) StartCluster(nodeCount int) error {
 
 		ctx, cancel := context.WithCancel(context.Background())
 
-		cmd := exec.CommandContext(ctx, "./encodersim",
+		args := []string{
 			"--cluster",
 			"--raft-id", nodeID,
 			"--raft-bind", peerAddrs[i],
 			"--peers", peersStr,
 			"--port", strconv.Itoa(httpPorts[i]),
 			"--window-size", "3",
-			h.playlistURL,
-		)
+		}
+		if nodeArgs != nil {
+			args = append(args, nodeArgs(i)...)
+		}
+		cmd := exec.CommandContext(ctx, "./encodersim", append(args, h.playlistURL)...)
 
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -475,3 +486,199 @@ http://example.com/segment4.ts
 
 	t.Log("Leader election test passed")
 }
+
+// TestClusterClockSkew checks that nodes whose clocks disagree still serve
+// identical media playlists, since window advances come from the Raft log.
+func TestClusterClockSkew(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cluster integration test in short mode")
+	}
+
+	harness := NewClusterTestHarness(t, 3)
+	defer harness.Cleanup()
+
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.0,
+http://example.com/segment0.ts
+#EXTINF:2.0,
+http://example.com/segment1.ts
+#EXTINF:2.0,
+http://example.com/segment2.ts
+#EXTINF:2.0,
+http://example.com/segment3.ts
+#EXTINF:2.0,
+http://example.com/segment4.ts
+#EXT-X-ENDLIST`
+
+	harness.StartHTTPServer(playlist, "playlist.m3u8")
+
+	skews := []string{"0s", "90s", "-45s"}
+	err := harness.StartClusterWithArgs(3, func(node int) []string {
+		return []string{"--clock-skew", skews[node]}
+	})
+	if err != nil {
+		t.Fatalf("failed to start cluster: %v", err)
+	}
+
+	for i, inst := range harness.instances {
+		status, err := harness.GetClusterStatus(inst)
+		if err != nil {
+			t.Fatalf("failed to get cluster status from %s: %v", inst.ID, err)
+		}
+		skew, _ := time.ParseDuration(skews[i])
+		var want any
+		if skew != 0 {
+			want = skew.String()
+		}
+		if status["clock_skew"] != want {
+			t.Errorf("%s reports clock skew %v, want %v", inst.ID, status["clock_skew"], want)
+		}
+	}
+
+	// Compare the media playlists across several advances. A fetch can
+	// straddle an advance, so each comparison is retried a few times.
+	fetchVariant := func(inst *ClusterInstance) (string, error) {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/variant/0/playlist.m3u8", inst.HTTPPort))
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+	consistent := func() error {
+		first, err := fetchVariant(harness.instances[0])
+		if err != nil {
+			return err
+		}
+		for _, inst := range harness.instances[1:] {
+			other, err := fetchVariant(inst)
+			if err != nil {
+				return err
+			}
+			if other != first {
+				return fmt.Errorf("media playlist mismatch between %s and %s", harness.instances[0].ID, inst.ID)
+			}
+		}
+		return nil
+	}
+
+	for check := 0; check < 4; check++ {
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			if err = consistent(); err == nil {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("check %d: %v", check, err)
+		}
+		time.Sleep(2500 * time.Millisecond)
+	}
+}
+
+// TestClusterTransportDelay checks that a cluster elects a leader and keeps
+// its nodes consistent when Raft messages cross simulated long links.
+func TestClusterTransportDelay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cluster integration test in short mode")
+	}
+
+	harness := NewClusterTestHarness(t, 3)
+	defer harness.Cleanup()
+
+	playlist := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.0,
+http://example.com/segment0.ts
+#EXTINF:2.0,
+http://example.com/segment1.ts
+#EXTINF:2.0,
+http://example.com/segment2.ts
+#EXTINF:2.0,
+http://example.com/segment3.ts
+#EXT-X-ENDLIST`
+
+	harness.StartHTTPServer(playlist, "playlist.m3u8")
+
+	// Round trips of 80ms to 160ms between the nodes
+	delays := []string{"fixed:40ms", "normal:80ms:10ms", "uniform:20ms:60ms"}
+	err := harness.StartClusterWithArgs(3, func(node int) []string {
+		return []string{"--raft-delay", delays[node]}
+	})
+	if err != nil {
+		t.Fatalf("failed to start cluster: %v", err)
+	}
+
+	for i, inst := range harness.instances {
+		status, err := harness.GetClusterStatus(inst)
+		if err != nil {
+			t.Fatalf("failed to get cluster status from %s: %v", inst.ID, err)
+		}
+		if status["raft_delay"] != delays[i] {
+			t.Errorf("%s reports Raft delay %v, want %s", inst.ID, status["raft_delay"], delays[i])
+		}
+	}
+
+	// The leader stays in place and the nodes agree across several advances
+	leader, err := harness.GetLeader()
+	if err != nil {
+		t.Fatalf("no leader: %v", err)
+	}
+
+	// The leader reaches every node for its replication progress
+	status, err := harness.GetClusterStatus(leader)
+	if err != nil {
+		t.Fatalf("failed to get cluster status from %s: %v", leader.ID, err)
+	}
+	nodes, _ := status["nodes"].([]any)
+	if len(nodes) != 3 {
+		t.Fatalf("leader reports %d nodes, want 3", len(nodes))
+	}
+	for _, node := range nodes {
+		if progress, _ := node.(map[string]any); progress["error"] != nil {
+			t.Errorf("leader could not query %v: %v", progress["id"], progress["error"])
+		}
+	}
+
+	consistent := func() error {
+		var first string
+		for i, inst := range harness.instances {
+			resp, err := http.Get(fmt.Sprintf("http://localhost:%d/variant/0/playlist.m3u8", inst.HTTPPort))
+			if err != nil {
+				return err
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				first = string(body)
+			} else if string(body) != first {
+				return fmt.Errorf("media playlist mismatch between %s and %s", harness.instances[0].ID, inst.ID)
+			}
+		}
+		return nil
+	}
+	for check := 0; check < 3; check++ {
+		time.Sleep(2500 * time.Millisecond)
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			if err = consistent(); err == nil {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("check %d: %v", check, err)
+		}
+	}
+	if current, err := harness.GetLeader(); err != nil || current.ID != leader.ID {
+		t.Errorf("leader changed from %s under delay (now %v, %v)", leader.ID, current, err)
+	}
+}
@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agleyzer/encodersim/internal/encodersim"
+)
+
+// TestEmbeddedWrapping verifies the loop of TestWrappingPlaylist with the
+// simulator running in-process, advanced by the test instead of the clock.
+func TestEmbeddedWrapping(t *testing.T) {
+	engine := encodersim.New(encodersim.Options{WindowSize: 3})
+	info, err := engine.ParseReader(strings.NewReader(createTestPlaylist(5, 1.0)), "https://example.com/test.m3u8")
+	if err != nil {
+		t.Fatalf("ParseReader() error = %v", err)
+	}
+	ch, err := engine.NewChannel(info, "https://example.com/test.m3u8")
+	if err != nil {
+		t.Fatalf("NewChannel() error = %v", err)
+	}
+	ts := httptest.NewServer(ch.Handler())
+	defer ts.Close()
+
+	fetch := func() *ParsedPlaylist {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/variant/0/playlist.m3u8")
+		if err != nil {
+			t.Fatalf("failed to fetch variant playlist: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return ParsePlaylist(string(body))
+	}
+
+	// Advance to the loop point: segments 3, 4, then 0 after a discontinuity
+	for range 3 {
+		ch.Advance()
+	}
+	parsed := fetch()
+	if parsed.MediaSequence != 3 || len(parsed.Segments) != 3 {
+		t.Fatalf("expected 3 segments from media sequence 3, got %d from %d", len(parsed.Segments), parsed.MediaSequence)
+	}
+	expectedURLs := []string{"segment003.ts", "segment004.ts", "segment000.ts"}
+	for i, seg := range parsed.Segments {
+		if !strings.HasSuffix(seg.URL, expectedURLs[i]) {
+			t.Errorf("segment %d: expected %s, got %s", i, expectedURLs[i], seg.URL)
+		}
+		if seg.Discontinuity != (i == 2) {
+			t.Errorf("segment %d: discontinuity = %v", i, seg.Discontinuity)
+		}
+	}
+	if parsed.HasEndList {
+		t.Error("playlist should not have EXT-X-ENDLIST tag for live stream")
+	}
+}
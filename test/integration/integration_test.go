@@ -3,6 +3,8 @@ package integration
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -363,6 +365,61 @@ func TestMasterPlaylist(t *testing.T) {
 	t.Log("✅ All phases passed!")
 }
 
+// TestVariantsFlag verifies that --variants selects variants and that the
+// mapping to /variant/N/ survives a restart with a reordered source ladder.
+func TestVariantsFlag(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	harness := NewTestHarness(t)
+	defer harness.Cleanup()
+
+	harness.StartHTTPServer(createTestMasterPlaylist(), "master.m3u8")
+	harness.AddPlaylist(createTestMediaPlaylist("low", 5, 1.0), "low.m3u8")
+	harness.AddPlaylist(createTestMediaPlaylist("high", 5, 1.0), "high.m3u8")
+
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	args := []string{"--variants", "1", "--state-file", stateFile}
+	harness.StartEncoderSimWithArgs("master.m3u8", 3, args...)
+
+	checkHighOnly := func() {
+		t.Helper()
+		master := harness.FetchPlaylist()
+		if !strings.Contains(master, "BANDWIDTH=2560000") || strings.Contains(master, "BANDWIDTH=1280000") {
+			t.Errorf("master playlist should list only the high variant:\n%s", master)
+		}
+		if strings.Contains(master, "/variant/1/") {
+			t.Error("master playlist should list a single variant")
+		}
+		parsed := ParsePlaylist(harness.FetchVariantPlaylist(0))
+		if len(parsed.Segments) == 0 || !strings.Contains(parsed.Segments[0].URL, "high_seg") {
+			t.Errorf("variant 0 should serve the high variant, got %+v", parsed.Segments)
+		}
+	}
+	checkHighOnly()
+
+	// Wait for a saved state, then restart with the ladder reordered: index
+	// 1 is now the low variant, but variant 0 keeps serving the high one
+	harness.WaitForCondition(func() bool {
+		_, err := os.Stat(stateFile)
+		return err == nil
+	}, 5*time.Second, "the state file to be saved")
+	harness.cancel()
+	harness.encodersimCmd.Wait()
+	harness.AddPlaylist(strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		`#EXT-X-STREAM-INF:BANDWIDTH=2560000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"`,
+		"high.m3u8",
+		`#EXT-X-STREAM-INF:BANDWIDTH=1280000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"`,
+		"low.m3u8",
+		"",
+	}, "\n"), "master.m3u8")
+	harness.StartEncoderSimWithArgs("master.m3u8", 3, args...)
+	checkHighOnly()
+}
+
 // createTestMasterPlaylist creates a test HLS master playlist.
 func createTestMasterPlaylist() string {
 	var sb strings.Builder